@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jsonLog writes each line it is given as a JSON object with a timestamp,
+// for log collectors that expect one event per line.
+type jsonLog struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (j *jsonLog) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		data, err := json.Marshal(struct {
+			Time    string `json:"time"`
+			Message string `json:"msg"`
+		}{time.Now().UTC().Format(time.RFC3339Nano), line})
+		if err != nil {
+			return 0, err
+		}
+		if _, err := j.out.Write(append(data, '\n')); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// logAsJSON turns the log and everything printed to stdout, such as
+// download progress messages, into JSON lines on stdout. The returned func
+// writes out what is still buffered and must be called before exiting.
+func logAsJSON() (func(), error) {
+	out := &jsonLog{out: os.Stdout}
+	log.SetFlags(0)
+	log.SetOutput(out)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	os.Stdout = w
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64<<10), 1<<20)
+		for scanner.Scan() {
+			out.Write(scanner.Bytes())
+		}
+	}()
+	return func() {
+		w.Close()
+		<-done
+	}, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/systemd"
+)
+
+// DefaultSocketMode lets the server's user and group use its Unix socket.
+const DefaultSocketMode = "0660"
+
+// listen opens what the server accepts connections on: the sockets systemd
+// passed it, or else the Unix socket at socketPath, or else TCP addr. It
+// also returns how to describe them in logs and /api/server.
+func listen(addr, socketPath, socketMode string) ([]net.Listener, string, error) {
+	inherited, err := systemd.Listeners()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(inherited) > 0 {
+		var names []string
+		for _, l := range inherited {
+			names = append(names, l.Addr().Network()+":"+l.Addr().String())
+		}
+		return inherited, strings.Join(names, ", "), nil
+	}
+
+	if socketPath == "" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, "", err
+		}
+		return []net.Listener{listener}, addr, nil
+	}
+
+	mode, err := strconv.ParseUint(socketMode, 8, 32)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid -socket-mode %q: must be octal, such as %s", socketMode, DefaultSocketMode)
+	}
+	if err := removeStaleSocket(socketPath); err != nil {
+		return nil, "", err
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := os.Chmod(socketPath, os.FileMode(mode)); err != nil {
+		listener.Close()
+		return nil, "", err
+	}
+	return []net.Listener{listener}, "unix:" + socketPath, nil
+}
+
+// removeStaleSocket removes the socket file at path left by a server that
+// didn't shut down cleanly. A socket another server still listens on is
+// left alone, as is anything that isn't a socket.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and isn't a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("another server is listening on %s", path)
+	}
+	return os.Remove(path)
+}
@@ -1,31 +1,396 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/govind1331/Datablip/internal/api"
+	"github.com/govind1331/Datablip/internal/auth"
+	"github.com/govind1331/Datablip/internal/config"
+	"github.com/govind1331/Datablip/internal/conflict"
 	"github.com/govind1331/Datablip/internal/downloader"
+	"github.com/govind1331/Datablip/internal/hoststats"
+	"github.com/govind1331/Datablip/internal/nametemplate"
+	"github.com/govind1331/Datablip/internal/probecache"
+	"github.com/govind1331/Datablip/internal/redirect"
+	"github.com/govind1331/Datablip/internal/route"
+	"github.com/govind1331/Datablip/internal/scan"
+	"github.com/govind1331/Datablip/internal/stall"
+	"github.com/govind1331/Datablip/internal/store"
+	"github.com/govind1331/Datablip/internal/systemd"
+	"github.com/govind1331/Datablip/internal/telemetry"
+	"github.com/govind1331/Datablip/internal/urlnorm"
+	"github.com/govind1331/Datablip/internal/webhook"
 	"github.com/govind1331/Datablip/internal/websocket"
+	"github.com/govind1331/Datablip/web"
 )
 
+// Version information (set by build system)
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// shutdownTimeout is how long requests in progress, such as file
+// transfers, get to finish when the server is stopped.
+const shutdownTimeout = 10 * time.Second
+
+// queueSaveInterval is how often the queue file is rewritten while the
+// server runs, so downloads are picked up again after a crash too.
+const queueSaveInterval = 30 * time.Second
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "service" {
+		os.Exit(runService(os.Args[2:]))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serve(ctx, os.Args[1:])
+}
+
+// serve parses the server's command-line flags from args and runs it until
+// ctx is done.
+func serve(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("datablip-server", flag.ExitOnError)
 	var (
-		port = flag.String("port", "8080", "Server port")
+		port          = flags.String("port", "8080", "Server port")
+		writeMode     = flags.String("write-mode", "writeat", "How chunks are written into the part file: writeat or mmap")
+		directIO      = flags.Bool("direct-io", false, "Write downloads of 256MB and more with direct I/O, bypassing the page cache")
+		chunkFiles    = flags.Bool("chunk-files", false, "Write chunks to separate temp files and merge them instead of writing in place into <output>.part")
+		chunks        = flags.Int("chunks", 0, "Chunks that downloads added without a count are split into; 0 picks a count from the file size and latency")
+		connTimeout   = flags.Duration("connect-timeout", downloader.DefaultConnectTimeout, "How long requests of downloads added without their own timeout may take to get a response, dialing included; up to 5m")
+		readTimeout   = flags.Duration("read-timeout", downloader.DefaultReadTimeout, "How long a transfer of a download added without its own timeout may go without receiving data")
+		progressRate  = flags.Int("progress-rate", downloader.DefaultProgressRate, "Progress updates per second each download sends WebSocket clients at most; changes in between are coalesced")
+		workers       = flags.Int("workers", downloader.DefaultWorkers, "Maximum chunk transfers running at once across all downloads")
+		maxDownloads  = flags.Int("max-concurrent-downloads", downloader.DefaultMaxConcurrentDownloads, "Maximum downloads running at once; the rest are queued and start as others finish")
+		endgame       = flags.Bool("endgame", true, "Near the end of a download, race a second connection against a chunk that is far slower than the rest")
+		rebalance     = flags.Bool("rebalance", true, "Hand the far end of a chunk that is far slower than the rest to a free connection")
+		stallSpeed    = flags.Int("stall-speed", stall.DefaultSpeed, "Restart a chunk's connection when it moves slower than this many bytes/s while others keep up; 0 disables")
+		stallTime     = flags.Duration("stall-time", stall.DefaultTime, "How long a chunk must stay below -stall-speed before its connection is restarted")
+		grabToken     = flags.String("grab-token", "", "Token enabling GET /api/grab?token=...&url=... for bookmarklets and share shortcuts")
+		filesToken    = flags.String("files-token", "", "Token required as \"Authorization: Bearer <token>\" to rename, move and delete files under /api/files")
+		socket        = flags.String("socket", "", "Listen on this Unix socket instead of -port, for local clients and reverse proxies; sockets passed by systemd socket activation take precedence over both")
+		socketMode    = flags.String("socket-mode", DefaultSocketMode, "Permissions of the -socket file, in octal")
+		tlsCert       = flags.String("tls-cert", "", "Serve HTTPS with this PEM certificate file; a renewed certificate is picked up within a minute")
+		tlsKey        = flags.String("tls-key", "", "Private key file of -tls-cert")
+		acmeDomains   = flags.String("autocert-domains", "", "Serve HTTPS with certificates from Let's Encrypt for these comma-separated domain names; -port should be 443")
+		acmeDir       = flags.String("autocert-dir", DefaultAutocertDir, "Where certificates from Let's Encrypt are kept")
+		acmeEmail     = flags.String("autocert-email", "", "Contact address given to Let's Encrypt for expiry notices")
+		httpRedirect  = flags.String("http-redirect", "", "With HTTPS on, listen on this address, such as :80, to redirect plain HTTP to HTTPS and answer Let's Encrypt's HTTP challenges")
+		apiKey        = flags.String("api-key", "", "Require this key, as \"X-API-Key: <key>\" or \"Authorization: Bearer <key>\", on every /api request and /ws")
+		password      = flags.String("password", "", "Enable POST /api/login, which trades this password for a session token; also requires credentials on every /api request and /ws")
+		keysFile      = flags.String("keys-file", auth.DefaultKeysFile, "Where API keys created through /api/keys are saved; once there is one, every /api request and /ws needs credentials. Empty keeps them in memory only")
+		jwtSecret     = flags.String("jwt-secret", "", "Secret that session tokens are signed with; a random one ends every session when the server restarts")
+		sessionTTL    = flags.Duration("session-ttl", auth.DefaultSessionTTL, "How long a session token from POST /api/login is valid")
+		uploadRetries = flags.Int("upload-retries", downloader.DefaultUploadRetries, "How many times a failed upload to a download's uploadTo destination is retried")
+		clamd         = flags.String("clamd", "", "Scan finished downloads with the clamd daemon at this Unix socket path or host:port")
+		scanCommand   = flags.String("scan-command", "", "Scan finished downloads by running this command with the file path appended; exit status 1 means infected")
+		quarantineDir = flags.String("quarantine-dir", downloader.DefaultQuarantineDir, "Where downloads that fail the scan are moved")
+		mediaPriority = flags.Int64("media-priority", downloader.DefaultMediaPriority, "Fetch this many bytes at each end of audio and video files before the middle, so players can open them early; 0 disables")
+		thumbnailDir  = flags.String("thumbnail-dir", downloader.DefaultThumbnailDir, "Where thumbnails of finished audio, video and image downloads are rendered, when ffmpeg is installed")
+		routeFiles    = flags.Bool("route", false, "Sort finished downloads into folders such as video/ and iso/ by their content type")
+		routeRules    = flags.String("route-rules", "", "JSON file of routing rules replacing the built-in ones; implies -route")
+		webhooks      = flags.String("webhooks", "", "JSON file of webhooks that receive a signed POST when downloads complete, fail, pause, resume or are quarantined")
+		jobsFile      = flags.String("jobs-file", downloader.DefaultJobsFile, "Where recurring download jobs are saved; empty keeps them in memory only")
+		settingsFile  = flags.String("settings-file", downloader.DefaultSettingsFile, "Where settings changed through PUT /api/settings are saved; they win over flags on the next start. Empty keeps them in memory only")
+		feedsFile     = flags.String("feeds-file", downloader.DefaultFeedsFile, "Where watched RSS and Atom feeds are saved; empty keeps them in memory only")
+		categoryFile  = flags.String("categories-file", downloader.DefaultCategoriesFile, "Where download categories are saved; empty keeps them in memory only")
+		probeTTL      = flags.Duration("probe-ttl", probecache.DefaultTTL, "How long a URL's HEAD result is reused by later downloads of it; 0 disables")
+		maxRedirects  = flags.Int("max-redirects", redirect.DefaultMax, "How many redirects in a row a request follows; Authorization and cookies aren't passed to another host")
+		stateDir      = flags.String("state-dir", systemd.StateDirectory(), "Keep downloads, jobs, thumbnails and quarantine under this directory instead of the working directory; defaults to $STATE_DIRECTORY")
+		webDir        = flags.String("web-dir", "", "Directory of a built frontend to serve instead of the one built into the binary")
+		pidFile       = flags.String("pidfile", "", "Write the server's process ID to this file while it runs")
+		logFile       = flags.String("log-file", "", "Append the server's output to this file instead of the terminal; relative to -state-dir when set")
+		logFormat     = flags.String("log-format", "text", "How the server's output is written: text, or json for one object per line")
+		downloadsDir  = flags.String("downloads-dir", downloader.DownloadsDir, "Where downloaded files are saved")
+		historyAge    = flags.Duration("history-max-age", 0, "Remove finished downloads from the list this long after they finish (e.g., '720h'); 0 keeps them")
+		historyCount  = flags.Int("history-max-count", 0, "Keep only this many of the latest finished downloads in the list; 0 keeps all")
+		historyFiles  = flags.Bool("history-delete-files", false, "Delete the files of finished downloads removed by -history-max-age or -history-max-count too")
+		origins       = flags.String("allowed-origins", "", "Comma-separated origins besides the server's own, such as http://localhost:5173, whose pages may open the WebSocket")
+		allowedDirs   = flags.String("allowed-dirs", "", "Comma-separated directories besides -downloads-dir that downloads may be saved in by giving an absolute dir")
+		onConflict    = flags.String("on-conflict", string(conflict.Default), "What downloads that don't say do when their output file already exists: rename (save as 'name (2).ext'), overwrite, resume from its bytes, or fail")
+		nameTemplate  = flags.String("filename-template", "", "Name downloads added without a filename from this template, such as '{date}/{host}/{basename}', once they are probed; variables are "+nametemplate.Names)
+		telemetryURL  = flags.String("telemetry-url", "", "Opt in to sending anonymous usage counts (version, platform, features used) to this URL once a day; GET /api/telemetry shows exactly what is sent")
+		monthlyCap    = flags.Int64("monthly-cap", 0, "Bytes that may be downloaded each calendar month; once reached, new downloads wait for the next month. 0 disables")
+		usageFile     = flags.String("usage-file", downloader.DefaultUsageFile, "Where the bytes downloaded each month are saved; empty keeps them in memory only")
+		statsFile     = flags.String("stats-file", downloader.DefaultStatsFile, "Where the bytes downloaded per day, host and category and the downloads finished are saved, for GET /api/stats; empty keeps them in memory only")
+		urlRules      = flags.String("url-rules", "", "JSON array of query parameters, with * wildcards, stripped from URLs before they are queued, replacing the built-in tracking parameters such as utm_*; [] strips none")
+		rateLimit     = flags.Int64("limit-rate", 0, "Cap the combined speed of all downloads at this many bytes/s; PUT /api/settings changes it while running. 0 disables")
+		hostDelay     = flags.Duration("host-delay", 0, "Wait this long between the starts of requests to the same host, so large batches of small files are fetched politely; 0 disables")
+		hostStatsFile = flags.String("host-stats-file", hoststats.DefaultFile, "Where the throughput measured per host and connection count is saved; empty keeps it in memory only")
+		autoConns     = flags.Bool("auto-connections", false, "Give downloads without a chunk count no more connections than their host was measured to saturate at; see GET /api/stats/hosts")
+		storeFile     = flags.String("store", store.DefaultFile, "BoltDB file where every download is kept, so finished ones stay listed and unfinished ones carry on after a restart; empty keeps them in memory only")
+		_             = flags.String("config", "", "Read flag defaults from this YAML or TOML file instead of the datablip.yaml or datablip.toml found in the working directory, the user's config directory or /etc/datablip")
+		queueFile     = flags.String("queue-file", downloader.DefaultQueueFile, "Where unfinished downloads are saved on shutdown, to be added again on the next start, when -store is empty; with -store, a queue file left by an earlier version is imported once. Empty disables")
 	)
-	flag.Parse()
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of datablip-server:\n")
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "\nEvery flag can also be set in the server section of a configuration file, or with an environment variable named after it, such as %s for -port.\n", config.EnvName("port"))
+	}
+	configPath, err := config.Setup(flags, "server", true, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	flags.Parse(args)
+
+	for _, path := range []*string{tlsCert, tlsKey, socket} {
+		if *path != "" {
+			// Given relative to where the server was started
+			abs, err := filepath.Abs(*path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			*path = abs
+		}
+	}
+	tlsConfig, redirect, err := tlsSettings{
+		cert:     *tlsCert,
+		key:      *tlsKey,
+		domains:  *acmeDomains,
+		cacheDir: *acmeDir,
+		email:    *acmeEmail,
+		port:     *port,
+	}.config()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if configPath != "" {
+		log.Printf("Read settings from %s", configPath)
+	}
+	ui, embedded := web.Frontend()
+	if *webDir == "" && !embedded {
+		*webDir = api.DefaultWebDir
+	}
+	if *stateDir != "" {
+		dir, err := enterStateDir(*stateDir, *webDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		*webDir = dir
+		log.Printf("Keeping state in %s", *stateDir)
+	}
+	if *logFile != "" {
+		if err := redirectOutput(*logFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	switch *logFormat {
+	case "text":
+	case "json":
+		flush, err := logAsJSON()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer flush()
+	default:
+		log.Fatalf("invalid -log-format %q: must be text or json", *logFormat)
+	}
+	downloader.DownloadsDir = *downloadsDir
+	if *pidFile != "" {
+		if err := writePidFile(*pidFile); err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(*pidFile)
+	}
 
 	// Initialize download manager
-	manager := downloader.NewManager()
+	manager := downloader.NewManager(context.Background())
+	manager.ChunkFiles = *chunkFiles
+	if *historyAge < 0 || *historyCount < 0 {
+		log.Fatal("-history-max-age and -history-max-count must be at least 0")
+	}
+	manager.Retention = downloader.HistoryPolicy{MaxAge: *historyAge, MaxCount: *historyCount, DeleteFiles: *historyFiles}
+	if *allowedDirs != "" {
+		manager.AllowedDirs = strings.Split(*allowedDirs, ",")
+	}
+	manager.DirectIO = *directIO
+	manager.Endgame = *endgame
+	manager.Rebalance = *rebalance
+	manager.StallSpeed = float64(*stallSpeed)
+	manager.StallTime = *stallTime
+	manager.UploadRetries = *uploadRetries
+	manager.QuarantineDir = *quarantineDir
+	manager.ThumbnailDir = *thumbnailDir
+	manager.MediaPriority = *mediaPriority
+	manager.Telemetry = telemetry.New(version)
+	manager.Telemetry.URL = *telemetryURL
+	if *urlRules != "" {
+		rules, err := urlnorm.LoadRules(*urlRules)
+		if err != nil {
+			log.Fatal(err)
+		}
+		manager.URLRules = rules
+	}
+	if *webhooks != "" {
+		hooks, err := webhook.Load(*webhooks)
+		if err != nil {
+			log.Fatal(err)
+		}
+		manager.Webhooks = hooks
+	}
+	switch {
+	case *routeRules != "":
+		rules, err := route.LoadRules(*routeRules)
+		if err != nil {
+			log.Fatal(err)
+		}
+		manager.Routes = rules
+	case *routeFiles:
+		manager.Routes = route.DefaultRules
+	}
+	switch {
+	case *clamd != "" && *scanCommand != "":
+		log.Fatal("-clamd and -scan-command are mutually exclusive")
+	case *clamd != "":
+		manager.Scanner = scan.NewClamd(*clamd)
+	case *scanCommand != "":
+		scanner, err := scan.NewCommand(*scanCommand)
+		if err != nil {
+			log.Fatal(err)
+		}
+		manager.Scanner = scanner
+	}
+	manager.CategoriesFile = *categoryFile
+	if err := manager.LoadCategories(); err != nil {
+		log.Fatal(err)
+	}
+	manager.JobsFile = *jobsFile
+	if err := manager.LoadJobs(); err != nil {
+		log.Fatal(err)
+	}
+	manager.FeedsFile = *feedsFile
+	if err := manager.LoadFeeds(); err != nil {
+		log.Fatal(err)
+	}
+	manager.UsageFile = *usageFile
+	if err := manager.LoadUsage(); err != nil {
+		log.Fatal(err)
+	}
+	manager.SetMonthlyCap(*monthlyCap)
+	manager.StatsFile = *statsFile
+	if err := manager.LoadStats(); err != nil {
+		log.Fatal(err)
+	}
+	manager.HostStatsFile = *hostStatsFile
+	if err := manager.LoadHostStats(); err != nil {
+		log.Fatal(err)
+	}
+	manager.AutoConnections = *autoConns
+	manager.SetWorkers(*workers)
+	manager.SetMaxConcurrentDownloads(*maxDownloads)
+	manager.SetHostDelay(*hostDelay)
+	manager.SetRateLimit(*rateLimit)
+	manager.SetProbeTTL(*probeTTL)
+	if *maxRedirects < 0 {
+		log.Fatal("-max-redirects must be at least 0")
+	}
+	manager.SetMaxRedirects(*maxRedirects)
+	if *progressRate < 1 {
+		log.Fatal("-progress-rate must be a positive integer")
+	}
+	manager.SetProgressRate(*progressRate)
+	if *chunks < 0 || *connTimeout <= 0 || *readTimeout <= 0 {
+		log.Fatal("-chunks must be at least 0, and -connect-timeout and -read-timeout positive")
+	}
+	manager.SetDefaultChunks(*chunks)
+	manager.SetConnectTimeout(*connTimeout)
+	manager.SetReadTimeout(*readTimeout)
+	if strings.HasPrefix(*nameTemplate, "/") {
+		log.Fatal("-filename-template must be a path inside the downloads directory")
+	}
+	if err := nametemplate.Validate(*nameTemplate); err != nil {
+		log.Fatal(err)
+	}
+	manager.SetFilenameTemplate(*nameTemplate)
+	// Settings changed through the API last time win over flags
+	manager.SettingsFile = *settingsFile
+	if err := manager.LoadSettings(); err != nil {
+		log.Fatal(err)
+	}
+	mode, err := downloader.ParseWriteMode(*writeMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manager.WriteMode = mode
+	policy, err := conflict.Parse(*onConflict)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manager.OnConflict = policy
+	if *storeFile != "" {
+		restored, err := manager.OpenStore(*storeFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(restored.Imported) > 0 || len(restored.Errors) > 0 {
+			log.Printf("Restored %d downloads from %s", len(restored.Imported), *storeFile)
+		}
+		for _, e := range restored.Errors {
+			log.Printf("Could not restore download %s", e)
+		}
+	}
+	if *queueFile != "" {
+		restored, err := manager.LoadQueue(*queueFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(restored.Imported) > 0 || len(restored.Errors) > 0 {
+			log.Printf("Restored %d unfinished downloads from %s", len(restored.Imported), *queueFile)
+		}
+		for _, e := range restored.Errors {
+			log.Printf("Could not restore download %s", e)
+		}
+	}
 
 	// Initialize API server
 	apiServer := api.NewServer(manager)
+	apiServer.GrabToken = *grabToken
+	keys, err := auth.LoadKeys(*keysFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sessions, err := auth.NewSessions(*jwtSecret)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *sessionTTL <= 0 {
+		log.Fatal("-session-ttl must be positive")
+	}
+	sessions.TTL = *sessionTTL
+	apiServer.Auth = &auth.Authenticator{APIKey: *apiKey, Password: *password, Keys: keys, Sessions: sessions}
+	if apiServer.Auth.Enabled() {
+		log.Printf("API requests need credentials")
+	}
+	apiServer.FilesToken = *filesToken
+	if *webDir != "" {
+		apiServer.Web = os.DirFS(*webDir)
+		log.Printf("Serving the web UI from %s", *webDir)
+	} else {
+		apiServer.Web = ui
+	}
+	apiServer.Build = api.BuildInfo{Version: version, Commit: commit, BuildTime: buildTime}
+	if *origins != "" {
+		apiServer.AllowedOrigins = strings.Split(*origins, ",")
+	}
 
 	// Initialize WebSocket hub
 	wsHub := websocket.NewHub(manager)
+	wsHub.Authorize = apiServer.AuthorizeWS
+	wsHub.CheckOrigin = apiServer.CheckOrigin
 	go wsHub.Run()
 
 	// Setup main router
@@ -37,10 +402,110 @@ func main() {
 	// API and static files
 	router.PathPrefix("/").Handler(apiServer)
 
-	addr := fmt.Sprintf(":%s", *port)
-	log.Printf("Server starting on %s", addr)
+	listeners, addr, err := listen(fmt.Sprintf(":%s", *port), *socket, *socketMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	apiServer.Addr = addr
+	apiServer.TLS = tlsConfig != nil
+	if tlsConfig != nil {
+		log.Printf("Server starting on %s with HTTPS", addr)
+	} else {
+		log.Printf("Server starting on %s", addr)
+	}
+	server := &http.Server{Handler: router, TLSConfig: tlsConfig}
+
+	var redirectServer *http.Server
+	if *httpRedirect != "" {
+		if tlsConfig == nil {
+			log.Fatal("-http-redirect needs -tls-cert or -autocert-domains")
+		}
+		redirectServer = &http.Server{Addr: *httpRedirect, Handler: redirect}
+		go func() {
+			if err := redirectServer.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	if *storeFile != "" {
+		// The store keeps the queue from here on
+		*queueFile = ""
+	}
+	if *queueFile != "" {
+		go func() {
+			ticker := time.NewTicker(queueSaveInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := manager.SaveQueue(*queueFile); err != nil {
+						log.Printf("%v", err)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
 
-	if err := http.ListenAndServe(addr, router); err != nil {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		log.Printf("Shutting down")
+		systemd.Notify("STOPPING=1")
+		// New downloads are refused from here on, and running ones are
+		// paused with their progress recorded, to carry on next time
+		if paused := manager.Shutdown(); paused > 0 {
+			log.Printf("Paused %d running downloads", paused)
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+		if redirectServer != nil {
+			redirectServer.Shutdown(shutdownCtx)
+		}
+		// Shutdown leaves hijacked WebSocket connections alone
+		wsHub.Close()
+		if err := manager.SaveUsage(); err != nil {
+			log.Printf("%v", err)
+		}
+		if err := manager.SaveStats(); err != nil {
+			log.Printf("%v", err)
+		}
+		if *queueFile != "" {
+			if err := manager.SaveQueue(*queueFile); err != nil {
+				log.Printf("%v", err)
+			} else {
+				log.Printf("Saved the queue to %s", *queueFile)
+			}
+		}
+		if err := manager.CloseStore(); err != nil {
+			log.Printf("%v", err)
+		}
+	}()
+
+	// The listener is open, so requests from here on are served
+	if _, err := systemd.Notify("READY=1"); err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+	}
+	go runWatchdog(ctx, manager)
+	go manager.Telemetry.Run(ctx)
+	go manager.RunJanitor(ctx)
+
+	served := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func() {
+			if tlsConfig != nil {
+				served <- server.ServeTLS(listener, "", "")
+			} else {
+				served <- server.Serve(listener)
+			}
+		}()
+	}
+	if err := <-served; err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
+	<-stopped
 }
@@ -0,0 +1,13 @@
+package main
+
+import "os"
+
+// processRunning reports whether a process with the ID exists.
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/downloader"
+	"github.com/govind1331/Datablip/internal/systemd"
+)
+
+// enterStateDir makes dir the working directory, so the downloads
+// directory, jobs file, thumbnails and quarantine, which are relative to
+// it, are kept there. webDir, if given, is returned absolute so the
+// frontend is still found.
+func enterStateDir(dir, webDir string) (string, error) {
+	if webDir != "" && !filepath.IsAbs(webDir) {
+		abs, err := filepath.Abs(webDir)
+		if err != nil {
+			return "", err
+		}
+		webDir = abs
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", fmt.Errorf("failed to create state directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		return "", fmt.Errorf("failed to enter state directory: %v", err)
+	}
+	return webDir, nil
+}
+
+// redirectOutput appends the log and everything printed to stdout and
+// stderr to the file at path.
+func redirectOutput(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	os.Stdout, os.Stderr = file, file
+	log.SetOutput(file)
+	return nil
+}
+
+// writePidFile records the server's process ID in path, refusing to start
+// if it names another server that is still running.
+func writePidFile(path string) error {
+	if data, err := os.ReadFile(path); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && pid != os.Getpid() && processRunning(pid) {
+			return fmt.Errorf("pid file %s names running process %d", path, pid)
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write pid file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write pid file: %v", err)
+	}
+	return nil
+}
+
+// runWatchdog tells systemd the server is alive twice per watchdog
+// interval, until ctx is done. Each ping first asks the manager for its
+// downloads, so a server whose manager has locked up misses its pings and
+// is restarted.
+func runWatchdog(ctx context.Context, manager *downloader.Manager) {
+	interval, ok := systemd.WatchdogInterval()
+	if !ok {
+		return
+	}
+	log.Printf("Pinging the systemd watchdog every %v", interval/2)
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		manager.GetAllDownloads()
+		if _, err := systemd.Notify("WATCHDOG=1"); err != nil {
+			log.Printf("Failed to ping the systemd watchdog: %v", err)
+		}
+	}
+}
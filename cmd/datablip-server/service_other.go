@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func runService(args []string) int {
+	fmt.Fprintln(os.Stderr, "datablip-server service is only available on Windows; on Linux, see build/systemd/datablip-server.service")
+	return 2
+}
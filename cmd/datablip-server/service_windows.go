@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const serviceUsage = `Usage: datablip-server service <command> [server flags]
+
+Commands:
+  install [flags]  Register the server to start at boot, with these server flags
+  uninstall        Remove the service
+  start            Start the service
+  stop             Stop the service and wait for it to exit
+  status           Show whether the service is running
+
+The service runs as LocalSystem without a logged-in session. Unless given,
+-state-dir defaults to %ProgramData%\Datablip and -log-file to
+datablip-server.log in it.
+`
+
+const (
+	serviceName        = "Datablip"
+	serviceDisplayName = "Datablip download server"
+	serviceDescription = "Downloads files in parallel chunks and serves the Datablip web interface."
+)
+
+// The parts of the service control manager API used here, from winsvc.h.
+const (
+	scManagerConnect       = 0x0001
+	scManagerCreateService = 0x0002
+
+	serviceQueryStatus  = 0x0004
+	serviceStart        = 0x0010
+	serviceStop         = 0x0020
+	serviceDelete       = 0x10000
+	serviceChangeConfig = 0x0002
+
+	serviceWin32OwnProcess   = 0x10
+	serviceAutoStart         = 2
+	serviceErrorNormal       = 1
+	serviceConfigDescription = 1
+
+	serviceControlStop        = 1
+	serviceControlInterrogate = 4
+	serviceControlShutdown    = 5
+
+	serviceStopped      = 1
+	serviceStartPending = 2
+	serviceStopPending  = 3
+	serviceRunning      = 4
+
+	serviceAcceptStop     = 0x1
+	serviceAcceptShutdown = 0x4
+
+	errorCallNotImplemented      syscall.Errno = 120
+	errorServiceAlreadyRunning   syscall.Errno = 1056
+	errorServiceNotActive        syscall.Errno = 1062
+	errorFailedServiceController syscall.Errno = 1063
+	errorServiceDoesNotExist     syscall.Errno = 1060
+)
+
+var (
+	advapi32                          = syscall.NewLazyDLL("advapi32.dll")
+	procOpenSCManagerW                = advapi32.NewProc("OpenSCManagerW")
+	procCreateServiceW                = advapi32.NewProc("CreateServiceW")
+	procOpenServiceW                  = advapi32.NewProc("OpenServiceW")
+	procStartServiceW                 = advapi32.NewProc("StartServiceW")
+	procControlService                = advapi32.NewProc("ControlService")
+	procQueryServiceStatus            = advapi32.NewProc("QueryServiceStatus")
+	procDeleteService                 = advapi32.NewProc("DeleteService")
+	procChangeServiceConfig2W         = advapi32.NewProc("ChangeServiceConfig2W")
+	procCloseServiceHandle            = advapi32.NewProc("CloseServiceHandle")
+	procStartServiceCtrlDispatcherW   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = advapi32.NewProc("SetServiceStatus")
+)
+
+// serviceStatus is SERVICE_STATUS.
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// serviceTableEntry is SERVICE_TABLE_ENTRYW.
+type serviceTableEntry struct {
+	ServiceName *uint16
+	ServiceProc uintptr
+}
+
+// result turns what an API function returning zero on failure gave back
+// into a value and error.
+func result(r, _ uintptr, err error) (uintptr, error) {
+	if r == 0 {
+		return 0, err
+	}
+	return r, nil
+}
+
+func utf16(s string) *uint16 {
+	p, _ := syscall.UTF16PtrFromString(s)
+	return p
+}
+
+func runService(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, serviceUsage)
+		return 2
+	}
+
+	var err error
+	switch command, rest := args[0], args[1:]; command {
+	case "install":
+		err = installService(rest)
+	case "uninstall":
+		err = uninstallService()
+	case "start":
+		err = startService()
+	case "stop":
+		err = stopService()
+	case "status":
+		err = printServiceStatus()
+	case "run":
+		// How the service manager starts the server
+		err = runAsService(rest)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown service command %q\n\n", command)
+		fmt.Fprint(os.Stderr, serviceUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// openService opens the installed service with the access rights given.
+func openService(access uint32) (scm, service uintptr, err error) {
+	scm, err = result(procOpenSCManagerW.Call(0, 0, scManagerConnect))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to connect to the service manager: %v", err)
+	}
+	service, err = result(procOpenServiceW.Call(scm, uintptr(unsafe.Pointer(utf16(serviceName))), uintptr(access)))
+	if err != nil {
+		procCloseServiceHandle.Call(scm)
+		if errors.Is(err, errorServiceDoesNotExist) {
+			return 0, 0, fmt.Errorf("the %s service is not installed", serviceName)
+		}
+		return 0, 0, fmt.Errorf("failed to open the %s service: %v", serviceName, err)
+	}
+	return scm, service, nil
+}
+
+func closeService(scm, service uintptr) {
+	procCloseServiceHandle.Call(service)
+	procCloseServiceHandle.Call(scm)
+}
+
+func installService(args []string) error {
+	given := map[string]bool{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			given[name] = true
+		}
+	}
+	if !given["state-dir"] {
+		args = append(args, "-state-dir", filepath.Join(os.Getenv("ProgramData"), serviceName))
+	}
+	if !given["log-file"] {
+		args = append(args, "-log-file", "datablip-server.log")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		return err
+	}
+	command := []string{syscall.EscapeArg(exe), "service", "run"}
+	for _, arg := range args {
+		command = append(command, syscall.EscapeArg(arg))
+	}
+
+	scm, err := result(procOpenSCManagerW.Call(0, 0, scManagerConnect|scManagerCreateService))
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager (run as administrator): %v", err)
+	}
+	defer procCloseServiceHandle.Call(scm)
+
+	service, err := result(procCreateServiceW.Call(scm,
+		uintptr(unsafe.Pointer(utf16(serviceName))),
+		uintptr(unsafe.Pointer(utf16(serviceDisplayName))),
+		serviceStart|serviceStop|serviceQueryStatus|serviceChangeConfig,
+		serviceWin32OwnProcess, serviceAutoStart, serviceErrorNormal,
+		uintptr(unsafe.Pointer(utf16(strings.Join(command, " ")))),
+		0, 0, 0, 0, 0))
+	if err != nil {
+		return fmt.Errorf("failed to install the %s service: %v", serviceName, err)
+	}
+	defer procCloseServiceHandle.Call(service)
+
+	description := struct{ Description *uint16 }{utf16(serviceDescription)}
+	procChangeServiceConfig2W.Call(service, serviceConfigDescription, uintptr(unsafe.Pointer(&description)))
+
+	fmt.Printf("✓ Installed the %s service: %s\n", serviceName, strings.Join(command, " "))
+	fmt.Println("  It starts at boot; start it now with: datablip-server service start")
+	return nil
+}
+
+func uninstallService() error {
+	scm, service, err := openService(serviceDelete | serviceStop | serviceQueryStatus)
+	if err != nil {
+		return err
+	}
+	defer closeService(scm, service)
+
+	if _, err := result(procDeleteService.Call(service)); err != nil {
+		return fmt.Errorf("failed to remove the %s service: %v", serviceName, err)
+	}
+	fmt.Printf("✓ Removed the %s service; it is deleted once it stops\n", serviceName)
+	return nil
+}
+
+func startService() error {
+	scm, service, err := openService(serviceStart)
+	if err != nil {
+		return err
+	}
+	defer closeService(scm, service)
+
+	if _, err := result(procStartServiceW.Call(service, 0, 0)); err != nil {
+		if errors.Is(err, errorServiceAlreadyRunning) {
+			fmt.Printf("The %s service is already running\n", serviceName)
+			return nil
+		}
+		return fmt.Errorf("failed to start the %s service: %v", serviceName, err)
+	}
+	fmt.Printf("✓ Started the %s service\n", serviceName)
+	return nil
+}
+
+func stopService() error {
+	scm, service, err := openService(serviceStop | serviceQueryStatus)
+	if err != nil {
+		return err
+	}
+	defer closeService(scm, service)
+
+	var status serviceStatus
+	if _, err := result(procControlService.Call(service, serviceControlStop, uintptr(unsafe.Pointer(&status)))); err != nil {
+		if errors.Is(err, errorServiceNotActive) {
+			fmt.Printf("The %s service is not running\n", serviceName)
+			return nil
+		}
+		return fmt.Errorf("failed to stop the %s service: %v", serviceName, err)
+	}
+
+	deadline := time.Now().Add(shutdownTimeout + 10*time.Second)
+	for status.CurrentState != serviceStopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the %s service did not stop in time", serviceName)
+		}
+		time.Sleep(300 * time.Millisecond)
+		if _, err := result(procQueryServiceStatus.Call(service, uintptr(unsafe.Pointer(&status)))); err != nil {
+			return fmt.Errorf("failed to query the %s service: %v", serviceName, err)
+		}
+	}
+	fmt.Printf("✓ Stopped the %s service\n", serviceName)
+	return nil
+}
+
+func printServiceStatus() error {
+	scm, service, err := openService(serviceQueryStatus)
+	if err != nil {
+		return err
+	}
+	defer closeService(scm, service)
+
+	var status serviceStatus
+	if _, err := result(procQueryServiceStatus.Call(service, uintptr(unsafe.Pointer(&status)))); err != nil {
+		return fmt.Errorf("failed to query the %s service: %v", serviceName, err)
+	}
+	states := map[uint32]string{
+		serviceStopped:      "stopped",
+		serviceStartPending: "starting",
+		serviceStopPending:  "stopping",
+		serviceRunning:      "running",
+	}
+	state, ok := states[status.CurrentState]
+	if !ok {
+		state = fmt.Sprintf("state %d", status.CurrentState)
+	}
+	fmt.Printf("The %s service is %s\n", serviceName, state)
+	return nil
+}
+
+// The running service's state, shared with the callbacks the service
+// manager calls on its own threads.
+var svc struct {
+	mu     sync.Mutex
+	args   []string
+	handle uintptr
+	status serviceStatus
+	stop   context.CancelFunc
+}
+
+// runAsService hands the process over to the service manager, which calls
+// serviceMain to run the server with args. It returns once the service has
+// stopped.
+func runAsService(args []string) error {
+	svc.args = args
+	table := []serviceTableEntry{
+		{ServiceName: utf16(serviceName), ServiceProc: syscall.NewCallback(serviceMain)},
+		{},
+	}
+	if _, err := result(procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0])))); err != nil {
+		if errors.Is(err, errorFailedServiceController) {
+			return fmt.Errorf("service run is for the Windows service manager; use datablip-server service start")
+		}
+		return err
+	}
+	return nil
+}
+
+func serviceMain(argc, argv uintptr) uintptr {
+	handle, err := result(procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(utf16(serviceName))), syscall.NewCallback(serviceControl), 0))
+	if err != nil {
+		return 0
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	svc.mu.Lock()
+	svc.handle = handle
+	svc.stop = cancel
+	svc.mu.Unlock()
+
+	setServiceState(serviceStartPending, 0)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve(ctx, svc.args)
+	}()
+	setServiceState(serviceRunning, serviceAcceptStop|serviceAcceptShutdown)
+
+	<-done
+	setServiceState(serviceStopped, 0)
+	return 0
+}
+
+// serviceControl handles requests from the service manager.
+func serviceControl(control, eventType, eventData, ctx uintptr) uintptr {
+	switch control {
+	case serviceControlStop, serviceControlShutdown:
+		setServiceState(serviceStopPending, 0)
+		svc.mu.Lock()
+		stop := svc.stop
+		svc.mu.Unlock()
+		stop()
+	case serviceControlInterrogate:
+		svc.mu.Lock()
+		procSetServiceStatus.Call(svc.handle, uintptr(unsafe.Pointer(&svc.status)))
+		svc.mu.Unlock()
+	default:
+		return uintptr(errorCallNotImplemented)
+	}
+	return 0
+}
+
+func setServiceState(state, accepts uint32) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.status = serviceStatus{
+		ServiceType:      serviceWin32OwnProcess,
+		CurrentState:     state,
+		ControlsAccepted: accepts,
+	}
+	if state == serviceStartPending || state == serviceStopPending {
+		svc.status.CheckPoint = 1
+		svc.status.WaitHint = uint32((shutdownTimeout + 10*time.Second).Milliseconds())
+	}
+	procSetServiceStatus.Call(svc.handle, uintptr(unsafe.Pointer(&svc.status)))
+}
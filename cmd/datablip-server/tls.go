@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// DefaultAutocertDir is where certificates from Let's Encrypt are cached,
+// relative to the working directory.
+const DefaultAutocertDir = "autocert"
+
+// certCheckInterval is how often the certificate files are checked for a
+// renewed certificate.
+const certCheckInterval = time.Minute
+
+// tlsSettings are the flags that turn on HTTPS.
+type tlsSettings struct {
+	cert, key string
+	domains   string // Comma-separated, for Let's Encrypt
+	cacheDir  string
+	email     string
+	port      string // That HTTPS is served on
+}
+
+// config returns the TLS configuration to serve with, or nil for plain
+// HTTP, and the handler for plain HTTP requests: a redirect to HTTPS that
+// also answers Let's Encrypt's challenges.
+func (s tlsSettings) config() (*tls.Config, http.Handler, error) {
+	switch {
+	case s.domains != "" && (s.cert != "" || s.key != ""):
+		return nil, nil, errors.New("-autocert-domains and -tls-cert are mutually exclusive")
+	case s.domains != "":
+		var hosts []string
+		for _, host := range strings.Split(s.domains, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(hosts...),
+			Cache:      autocert.DirCache(s.cacheDir),
+			Email:      s.email,
+		}
+		return m.TLSConfig(), m.HTTPHandler(redirectToHTTPS(s.port)), nil
+	case s.cert != "" || s.key != "":
+		if s.cert == "" || s.key == "" {
+			return nil, nil, errors.New("-tls-cert and -tls-key must be given together")
+		}
+		certs := &certFiles{cert: s.cert, key: s.key}
+		if _, err := certs.load(); err != nil {
+			return nil, nil, err
+		}
+		config := &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			NextProtos:     []string{"h2", "http/1.1"},
+			GetCertificate: certs.get,
+		}
+		return config, redirectToHTTPS(s.port), nil
+	}
+	return nil, nil, nil
+}
+
+// certFiles serves a certificate from files, picking up a renewed one, as
+// written by certbot, without a restart.
+type certFiles struct {
+	cert, key string
+	mu        sync.Mutex
+	loaded    *tls.Certificate
+	modified  time.Time // Of the newer file, when loaded
+	checked   time.Time
+}
+
+func (c *certFiles) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checked) < certCheckInterval {
+		return c.loaded, nil
+	}
+	c.checked = time.Now()
+	if c.modTime().After(c.modified) {
+		if _, err := c.loadLocked(); err != nil && c.loaded == nil {
+			return nil, err
+		}
+		// A half-written renewal keeps the old certificate until the next check
+	}
+	return c.loaded, nil
+}
+
+func (c *certFiles) load() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checked = time.Now()
+	return c.loadLocked()
+}
+
+func (c *certFiles) loadLocked() (*tls.Certificate, error) {
+	modified := c.modTime()
+	cert, err := tls.LoadX509KeyPair(c.cert, c.key)
+	if err != nil {
+		return nil, err
+	}
+	c.loaded, c.modified = &cert, modified
+	return c.loaded, nil
+}
+
+// modTime returns when the newer of the two files was last written.
+func (c *certFiles) modTime() time.Time {
+	var latest time.Time
+	for _, path := range []string{c.cert, c.key} {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL over HTTPS on
+// port.
+func redirectToHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
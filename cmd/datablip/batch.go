@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/bufpool"
+	"github.com/govind1331/Datablip/internal/idle"
+	"github.com/govind1331/Datablip/internal/transport"
+	"github.com/govind1331/Datablip/internal/urlnorm"
+	"github.com/govind1331/Datablip/pkg/datablip"
+)
+
+const batchUsage = `Usage: datablip batch [options] <list-file>
+
+Downloads every URL in the list file ("-" reads standard input), one per
+line, optionally followed by the name to save it as. Blank lines and lines
+starting with # are skipped.
+
+Batch mode is tuned for thousands of small files: each file is fetched with
+one request, -parallel requests share persistent connections, files are
+flushed to disk in groups of -sync-every, and the display shows totals
+instead of a bar per file.
+`
+
+// batchItem is one line of a batch list.
+type batchItem struct {
+	URL  string
+	Name string // Relative to the batch directory
+}
+
+// batch holds the counters shown while a batch runs.
+type batch struct {
+	total   int
+	done    atomic.Int64
+	failed  atomic.Int64
+	skipped atomic.Int64
+	bytes   atomic.Int64
+	started time.Time
+
+	printMu sync.Mutex
+}
+
+func runBatch(args []string) int {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	dir := flags.String("dir", ".", "Directory the files are saved in.")
+	parallel := flags.Int("parallel", 16, "How many files are fetched at once, over as many persistent connections.")
+	connectTimeout := flags.Duration("connect-timeout", datablip.DefaultConnectTimeout, "Connection timeout.")
+	readTimeout := flags.Duration("read-timeout", time.Minute, "Give up on a file when no data arrives for this long.")
+	retries := flags.Int("retries", 2, "How many times a failed file is tried again.")
+	syncEvery := flags.Int("sync-every", 256, "Flush finished files to disk in groups of this many instead of one by one.")
+	skipExisting := flags.Bool("skip-existing", true, "Skip files that already exist in -dir, so an interrupted batch can be run again.")
+	loadConfig(flags, args)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, batchUsage)
+		fmt.Fprintln(os.Stderr, "\nOptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	if *parallel < 1 || *syncEvery < 1 || *retries < 0 {
+		fmt.Fprintln(os.Stderr, "-parallel and -sync-every must be at least 1, -retries at least 0")
+		return 2
+	}
+
+	items, err := readBatchFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	httpTransport := transport.New(*connectTimeout, *parallel)
+	defer httpTransport.CloseIdleConnections()
+	client := &http.Client{Transport: httpTransport}
+
+	b := &batch{total: len(items), started: time.Now()}
+	syncer := &batchSyncer{every: *syncEvery, batch: b}
+
+	queue := make(chan batchItem)
+	var workers sync.WaitGroup
+	for range *parallel {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for item := range queue {
+				b.fetch(ctx, client, item, *dir, *readTimeout, *retries, syncer)
+			}
+		}()
+	}
+
+	displayCtx, stopDisplay := context.WithCancel(ctx)
+	displayed := make(chan struct{})
+	go func() {
+		defer close(displayed)
+		b.display(displayCtx)
+	}()
+
+feed:
+	for _, item := range items {
+		if *skipExisting {
+			if _, err := os.Stat(filepath.Join(*dir, item.Name)); err == nil {
+				b.skipped.Add(1)
+				continue
+			}
+		}
+		select {
+		case queue <- item:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	workers.Wait()
+	syncer.flush()
+	stopDisplay()
+	<-displayed
+
+	b.printProgress()
+	fmt.Println()
+	elapsed := time.Since(b.started)
+	fmt.Println(msg.Sprintf("✓ Downloaded %d files (%s) in %v, %.1f files/s",
+		b.done.Load(), datablip.FormatBytes(b.bytes.Load()), elapsed.Round(time.Millisecond), float64(b.done.Load())/elapsed.Seconds()))
+	if skipped := b.skipped.Load(); skipped > 0 {
+		fmt.Println(msg.Sprintf("Skipped %d files that already exist", skipped))
+	}
+	if failed := b.failed.Load(); failed > 0 {
+		fmt.Println(msg.Sprintf("✗ %d files failed", failed))
+		return 1
+	}
+	if ctx.Err() != nil {
+		fmt.Println(msg.Sprintf("✗ %s", msg.Text("batch interrupted")))
+		return 1
+	}
+	return 0
+}
+
+// readBatchFile parses a batch list. Every file needs its own name, so a
+// list naming two files alike is rejected rather than overwriting one.
+func readBatchFile(name string) ([]batchItem, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var items []batchItem
+	lines := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected a URL and an optional name", n)
+		}
+		u, err := url.Parse(fields[0])
+		if err != nil || !urlnorm.Supported(u.Scheme) {
+			return nil, fmt.Errorf("line %d: invalid URL %q", n, fields[0])
+		}
+		item := batchItem{URL: fields[0], Name: path.Base(u.Path)}
+		if len(fields) == 2 {
+			item.Name = fields[1]
+		}
+		item.Name = filepath.Clean(filepath.FromSlash(item.Name))
+		if item.Name == "." || item.Name == string(filepath.Separator) || !filepath.IsLocal(item.Name) {
+			return nil, fmt.Errorf("line %d: no usable file name for %s; add one after the URL", n, fields[0])
+		}
+		if first, ok := lines[item.Name]; ok {
+			return nil, fmt.Errorf("line %d: %s is also the name on line %d; add a different name after the URL", n, item.Name, first)
+		}
+		lines[item.Name] = n
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// fetch downloads one file, trying again after failures.
+func (b *batch) fetch(ctx context.Context, client *http.Client, item batchItem, dir string, readTimeout time.Duration, retries int, syncer *batchSyncer) {
+	final := filepath.Join(dir, item.Name)
+	part := final + ".part"
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		var file *os.File
+		file, err = b.fetchOnce(ctx, client, item.URL, part, readTimeout)
+		if err == nil {
+			b.done.Add(1)
+			syncer.add(file, part, final)
+			return
+		}
+	}
+	os.Remove(part)
+	if ctx.Err() != nil {
+		return // Interrupted, not failed
+	}
+	b.failed.Add(1)
+	b.println(fmt.Sprintf("✗ %s: %v", item.URL, msg.Error(err)))
+}
+
+// fetchOnce writes the body of rawURL into part and returns the still open
+// file for the syncer.
+func (b *batch) fetchOnce(ctx context.Context, client *http.Client, rawURL, part string, readTimeout time.Duration) (*os.File, error) {
+	ctx, watchdog := idle.WithTimeout(ctx, readTimeout)
+	defer watchdog.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, idle.Cause(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(part), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(part)
+	if err != nil {
+		return nil, err
+	}
+	written, err := bufpool.Copy(file, watchdog.Reader(resp.Body))
+	b.bytes.Add(written)
+	if err != nil {
+		file.Close()
+		return nil, idle.Cause(ctx, err)
+	}
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		file.Close()
+		return nil, fmt.Errorf("received %d of %d bytes", written, resp.ContentLength)
+	}
+	return file, nil
+}
+
+// batchSyncer flushes finished files to disk in groups, then gives them
+// their final names, so a crash never leaves a truncated file under a
+// final name and the disk isn't asked to sync after every small file.
+type batchSyncer struct {
+	every int
+	batch *batch
+
+	mu      sync.Mutex
+	pending []syncedFile
+}
+
+type syncedFile struct {
+	file        *os.File
+	part, final string
+}
+
+func (s *batchSyncer) add(file *os.File, part, final string) {
+	s.mu.Lock()
+	s.pending = append(s.pending, syncedFile{file, part, final})
+	full := len(s.pending) >= s.every
+	s.mu.Unlock()
+	if full {
+		s.flush()
+	}
+}
+
+func (s *batchSyncer) flush() {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	dirs := make(map[string]bool)
+	for _, f := range pending {
+		err := f.file.Sync()
+		if closeErr := f.file.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(f.part, f.final)
+		}
+		if err != nil {
+			os.Remove(f.part)
+			s.batch.done.Add(-1)
+			s.batch.failed.Add(1)
+			s.batch.println(fmt.Sprintf("✗ %s: %v", f.final, err))
+			continue
+		}
+		dirs[filepath.Dir(f.final)] = true
+	}
+	// Make the renames durable too; not every platform can sync a
+	// directory, and the files themselves are safe either way
+	for dir := range dirs {
+		if d, err := os.Open(dir); err == nil {
+			d.Sync()
+			d.Close()
+		}
+	}
+}
+
+// display redraws the totals line until ctx ends.
+func (b *batch) display(ctx context.Context) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.printProgress()
+		}
+	}
+}
+
+// printProgress redraws the totals line in place.
+func (b *batch) printProgress() {
+	b.printMu.Lock()
+	defer b.printMu.Unlock()
+
+	done, failed, skipped, bytes := b.done.Load(), b.failed.Load(), b.skipped.Load(), b.bytes.Load()
+	elapsed := time.Since(b.started).Seconds()
+	filesPerSec := float64(done) / elapsed
+	eta := "∞"
+	if remaining := int64(b.total) - done - failed - skipped; filesPerSec > 0 {
+		eta = formatETA(time.Duration(float64(remaining) / filesPerSec * float64(time.Second)))
+	}
+	fmt.Printf("\r\033[K%s  %s  %s  %s  %s  %s: %s",
+		msg.Sprintf("Files: %d/%d", done+skipped, b.total),
+		msg.Sprintf("Failed: %d", failed),
+		msg.Sprintf("%.1f files/s", filesPerSec),
+		datablip.FormatBytes(bytes),
+		datablip.FormatSpeed(float64(bytes)/elapsed),
+		msg.Text("ETA"), eta)
+}
+
+// println prints a line above the totals line.
+func (b *batch) println(line string) {
+	b.printMu.Lock()
+	defer b.printMu.Unlock()
+	fmt.Printf("\r\033[K%s\n", line)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/autochunk"
+	"github.com/govind1331/Datablip/internal/hoststats"
+	"github.com/govind1331/Datablip/internal/transport"
+	"github.com/govind1331/Datablip/pkg/datablip"
+)
+
+const benchUsage = `Usage: datablip bench [options] <url>
+       datablip bench -history [host]
+
+Measures how fast the URL downloads with each number of connections in
+-connections, fetching for -duration each and discarding the data, and
+recommends the fewest connections that come close to the best speed.
+
+Every finished download is measured the same way. -history shows what was
+recorded for each host; downloads started with -auto-connections use no
+more connections than their host was found to saturate at.
+`
+
+// defaultHostStatsFile is where the CLI keeps the throughput it measured
+// per host, shared by every working directory.
+func defaultHostStatsFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "datablip", hoststats.DefaultFile)
+}
+
+// loadHostStats reads the statistics in file, or starts empty when they
+// can't be read.
+func loadHostStats(file string) *hoststats.Store {
+	hosts, err := hoststats.Load(file)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return hoststats.New()
+	}
+	return hosts
+}
+
+// saveHostStats writes the statistics to file, creating its directory.
+func saveHostStats(hosts *hoststats.Store, file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return hosts.Save(file)
+}
+
+func runBench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	counts := flags.String("connections", "1,2,4,8", "Comma-separated connection counts to measure.")
+	duration := flags.Duration("duration", 5*time.Second, "How long each connection count downloads.")
+	connectTimeout := flags.Duration("connect-timeout", datablip.DefaultConnectTimeout, "Connection timeout.")
+	statsFile := flags.String("host-stats-file", defaultHostStatsFile(), "Where the throughput measured per host is kept.")
+	history := flags.Bool("history", false, "Show the throughput recorded for every host, or only for the given one, instead of measuring.")
+	loadConfig(flags, args)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, benchUsage)
+		fmt.Fprintln(os.Stderr, "\nOptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *statsFile == "" {
+		fmt.Fprintln(os.Stderr, "-host-stats-file is required")
+		return 2
+	}
+	hosts := loadHostStats(*statsFile)
+	if *history {
+		if flags.NArg() > 1 {
+			flags.Usage()
+			return 2
+		}
+		return printHostHistory(hosts, flags.Arg(0))
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	var levels []int
+	for _, field := range strings.Split(*counts, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 || n > autochunk.MaxChunks {
+			fmt.Fprintf(os.Stderr, "Invalid -connections %q: expected counts from 1 to %d\n", *counts, autochunk.MaxChunks)
+			return 2
+		}
+		levels = append(levels, n)
+	}
+	if *duration < time.Second {
+		fmt.Fprintln(os.Stderr, "-duration must be at least 1s")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rawURL := flags.Arg(0)
+	host := hoststats.Key(rawURL)
+	probe := datablip.NewDownloader(rawURL, "", 0)
+	probe.SetTimeouts(*connectTimeout, datablip.DefaultReadTimeout)
+	info, err := probe.Probe(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg.Sprintf("✗ %v", msg.Error(err)))
+		return 1
+	}
+	if !info.Ranges {
+		fmt.Fprintln(os.Stderr, msg.Text("✗ The server doesn't support range requests, so only one connection can be used"))
+		return 1
+	}
+	fmt.Println(msg.Sprintf("File size: %s, round trip %v", datablip.FormatBytes(info.Size), info.RTT.Round(time.Microsecond)))
+	fmt.Println()
+	fmt.Printf("%-12s %-12s %s\n", msg.Text("Connections"), msg.Text("Speed"), msg.Text("Per connection"))
+
+	for _, n := range levels {
+		bytes, elapsed, err := benchLevel(ctx, rawURL, info.Size, n, *duration, *connectTimeout)
+		if ctx.Err() != nil {
+			fmt.Println(msg.Sprintf("✗ %s", msg.Text("benchmark interrupted")))
+			return 1
+		}
+		if err != nil {
+			fmt.Printf("%-12d ✗ %v\n", n, msg.Error(err))
+			continue
+		}
+		speed := float64(bytes) / elapsed.Seconds()
+		note := ""
+		if !hosts.Record(host, n, bytes, elapsed) {
+			note = "  " + msg.Text("(too little data to record)")
+		}
+		fmt.Printf("%-12d %-12s %s%s\n", n, datablip.FormatSpeed(speed), datablip.FormatSpeed(speed/float64(n)), note)
+	}
+	fmt.Println()
+
+	if err := saveHostStats(hosts, *statsFile); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if report, ok := hosts.Get(host); ok {
+		fmt.Println(hostSummary(report))
+	}
+	return 0
+}
+
+// benchLevel downloads for up to duration over n connections, each reading
+// its own slice of the file, and returns how much arrived and how long it
+// took.
+func benchLevel(ctx context.Context, rawURL string, size int64, n int, duration, connectTimeout time.Duration) (int64, time.Duration, error) {
+	// A fresh transport per level so connections opened for one count
+	// don't speed up the next
+	httpTransport := transport.New(connectTimeout, n)
+	defer httpTransport.CloseIdleConnections()
+	client := &http.Client{Transport: httpTransport}
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var total atomic.Int64
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	started := time.Now()
+	for i := range n {
+		start, end := size*int64(i)/int64(n), size*int64(i+1)/int64(n)-1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+			if err != nil {
+				errs <- err
+				return
+			}
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+			resp, err := client.Do(req)
+			if err != nil {
+				if ctx.Err() == nil {
+					errs <- err
+				}
+				return
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusPartialContent {
+				errs <- fmt.Errorf("server returned %s", resp.Status)
+				return
+			}
+			written, err := io.Copy(io.Discard, resp.Body)
+			total.Add(written)
+			if err != nil && ctx.Err() == nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(started)
+	close(errs)
+	if err := <-errs; err != nil {
+		return 0, 0, err
+	}
+	return total.Load(), elapsed, nil
+}
+
+// printHostHistory shows the recorded throughput of every host, or of one.
+func printHostHistory(hosts *hoststats.Store, only string) int {
+	reports := hosts.Hosts()
+	if only != "" {
+		report, ok := hosts.Get(strings.ToLower(only))
+		if !ok {
+			fmt.Fprintln(os.Stderr, msg.Sprintf("Nothing recorded for %s", only))
+			return 1
+		}
+		reports = []hoststats.Host{report}
+	}
+	if len(reports) == 0 {
+		fmt.Println(msg.Text("Nothing recorded yet; finished downloads and datablip bench add to the history"))
+		return 0
+	}
+	for i, report := range reports {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(hostSummary(report))
+		fmt.Printf("  %-12s %-12s %-16s %-10s %s\n",
+			msg.Text("Connections"), msg.Text("Speed"), msg.Text("Per connection"), msg.Text("Downloads"), msg.Text("Last"))
+		for _, level := range report.Levels {
+			fmt.Printf("  %-12d %-12s %-16s %-10d %s\n", level.Connections, datablip.FormatSpeed(level.Speed),
+				datablip.FormatSpeed(level.PerConnection), level.Downloads, level.LastSeen.Format("2006-01-02 15:04"))
+		}
+	}
+	return 0
+}
+
+// hostSummary is the recommendation for a host in words.
+func hostSummary(report hoststats.Host) string {
+	levels := report.Levels
+	switch {
+	case report.Recommended == 1:
+		return msg.Sprintf("✓ %s is fastest with a single connection", report.Host)
+	case report.Recommended > 0:
+		return msg.Sprintf("✓ %s saturates at %d connections", report.Host, report.Recommended)
+	case len(levels) == 0:
+		return msg.Sprintf("%s: nothing measured yet", report.Host)
+	case len(levels) == 1:
+		return msg.Sprintf("%s: only measured with %d connections", report.Host, levels[0].Connections)
+	}
+	return msg.Sprintf("%s: still faster with more connections, measured up to %d", report.Host, levels[len(levels)-1].Connections)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/clipboard"
+	"github.com/govind1331/Datablip/internal/savename"
+	"github.com/govind1331/Datablip/pkg/datablip"
+)
+
+const watchClipboardUsage = `Usage: datablip watch-clipboard [options]
+
+Watches the clipboard and downloads the URLs copied to it: those matching a
+-match pattern, or every http, https and ftp URL without one. Files are
+saved in -dir one at a time, named after the URL, or added to a running
+datablip-server with -server. Whatever is on the clipboard when watching
+starts is left alone. Stop with Ctrl+C; an unfinished download keeps its
+state for datablip partials resume.
+`
+
+// clipboardURL finds URLs in copied text, up to whitespace or a quote.
+var clipboardURL = regexp.MustCompile(`(?i)\b(?:https?|ftps?)://[^\s<>"'` + "`" + `]+`)
+
+func runWatchClipboard(args []string) int {
+	flags := flag.NewFlagSet("watch-clipboard", flag.ExitOnError)
+	var patterns []*regexp.Regexp
+	flags.Func("match", "Only take URLs matching this regular expression (e.g., '\\.iso$'); repeat for more.", func(expr string) error {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return err
+		}
+		patterns = append(patterns, re)
+		return nil
+	})
+	server := flags.String("server", "", "Add the URLs to the datablip-server at this base URL (e.g., 'http://localhost:8080') or unix:<path> socket instead of downloading them here.")
+	dir := flags.String("dir", ".", "Directory the files are saved in.")
+	chunks := flags.Int("chunks", 0, "Number of concurrent download chunks; 0 picks a count from the file size and server latency.")
+	interval := flags.Duration("interval", 500*time.Millisecond, "How often the clipboard is checked.")
+	apiKey := flags.String("api-key", "", "API key or session token of a -server that requires credentials.")
+	loadConfig(flags, args)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, watchClipboardUsage)
+		fmt.Fprintln(os.Stderr, "\nOptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+	if *interval <= 0 || *chunks < 0 {
+		fmt.Fprintln(os.Stderr, "-interval must be positive and -chunks at least 0")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	last, err := clipboard.Read(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg.Sprintf("✗ %v", msg.Error(err)))
+		return 1
+	}
+
+	fetch := func(ctx context.Context, rawURL string) { downloadCopied(ctx, rawURL, *dir, *chunks) }
+	if *server != "" {
+		client, api := serverClient(*server, *apiKey)
+		api += "/downloads"
+		fetch = func(ctx context.Context, rawURL string) { submitCopied(ctx, client, api, rawURL, *chunks) }
+	}
+
+	// Downloads run one after another, while copying goes on
+	queue := make(chan string, 64)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for rawURL := range queue {
+			if ctx.Err() == nil {
+				fetch(ctx, rawURL)
+			}
+		}
+	}()
+
+	fmt.Println(msg.Text("Watching the clipboard for URLs; press Ctrl+C to stop"))
+	seen := make(map[string]bool)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+watch:
+	for {
+		select {
+		case <-ctx.Done():
+			break watch
+		case <-ticker.C:
+		}
+		text, err := clipboard.Read(ctx)
+		if err != nil || text == last {
+			continue
+		}
+		last = text
+		for _, rawURL := range copiedURLs(text, patterns) {
+			if seen[rawURL] {
+				continue
+			}
+			seen[rawURL] = true
+			select {
+			case queue <- rawURL:
+			default:
+				fmt.Println(msg.Sprintf("✗ %s: %v", rawURL, msg.Text("too many URLs waiting")))
+			}
+		}
+	}
+	close(queue)
+	<-done
+	fmt.Println()
+	return 0
+}
+
+// copiedURLs returns the URLs in text that match any of patterns, or all of
+// them when there are no patterns.
+func copiedURLs(text string, patterns []*regexp.Regexp) []string {
+	var urls []string
+	for _, found := range clipboardURL.FindAllString(text, -1) {
+		// Punctuation closing a sentence or a bracket isn't part of the URL
+		found = strings.TrimRight(found, ".,;:!?)]}")
+		if _, err := url.Parse(found); err != nil {
+			continue
+		}
+		matched := len(patterns) == 0
+		for _, re := range patterns {
+			matched = matched || re.MatchString(found)
+		}
+		if matched {
+			urls = append(urls, found)
+		}
+	}
+	return urls
+}
+
+// downloadCopied downloads rawURL into dir under the last segment of its
+// path, with a number added if a file of that name exists.
+func downloadCopied(ctx context.Context, rawURL, dir string, chunks int) {
+	u, _ := url.Parse(rawURL)
+	name := savename.Sanitize(path.Base(u.Path))
+	if name == "" {
+		name = "download"
+	}
+	output := freePath(filepath.Join(dir, name))
+
+	fmt.Println(msg.Sprintf("Downloading: %s", rawURL))
+	d := datablip.NewDownloader(rawURL, output, chunks)
+	started := time.Now()
+	if err := d.Download(ctx); err != nil {
+		if ctx.Err() == nil {
+			fmt.Println(msg.Sprintf("✗ %s: %v", rawURL, msg.Error(err)))
+		}
+		return
+	}
+	size := int64(0)
+	if info, err := os.Stat(output); err == nil {
+		size = info.Size()
+	}
+	fmt.Println(msg.Sprintf("✓ Saved %s (%s) in %v", output, datablip.FormatBytes(size), time.Since(started).Round(time.Millisecond)))
+}
+
+// freePath returns name, or name with " (2)", " (3)" and so on before its
+// extension, whichever no file or partial download has yet.
+func freePath(name string) string {
+	ext := filepath.Ext(name)
+	if strings.HasSuffix(strings.TrimSuffix(name, ext), ".tar") {
+		ext = ".tar" + ext
+	}
+	stem := strings.TrimSuffix(name, ext)
+	taken := func(name string) bool {
+		for _, suffix := range []string{"", ".part", datablip.ResumeSuffix} {
+			if _, err := os.Lstat(name + suffix); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+	for n := 2; taken(name); n++ {
+		name = fmt.Sprintf("%s (%d)%s", stem, n, ext)
+	}
+	return name
+}
+
+// submitCopied adds rawURL to the server behind api, which names the file.
+func submitCopied(ctx context.Context, client *http.Client, api, rawURL string, chunks int) {
+	body, _ := json.Marshal(map[string]any{"url": rawURL, "chunks": chunks})
+	req, err := http.NewRequestWithContext(ctx, "POST", api, bytes.NewReader(body))
+	if err != nil {
+		fmt.Println(msg.Sprintf("✗ %s: %v", rawURL, msg.Error(err)))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Println(msg.Sprintf("✗ %s: %v", rawURL, msg.Error(err)))
+		return
+	}
+	defer resp.Body.Close()
+	if err := responseError(resp); err != nil {
+		fmt.Println(msg.Sprintf("✗ %s: %v", rawURL, msg.Error(err)))
+		return
+	}
+	var added struct {
+		ID string `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&added)
+	fmt.Println(msg.Sprintf("✓ Added %s to the server as %s", rawURL, added.ID))
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/speed"
+	"github.com/govind1331/Datablip/pkg/datablip"
+)
+
+// ProgressBarWidth is the width of the overall and merge progress bars.
+const ProgressBarWidth = 30
+
+// console shows a download on the terminal: each step as a translated line,
+// the chunk table redrawn in place while downloading, and the merge as a
+// single line.
+type console struct {
+	d           *datablip.Downloader
+	interactive bool      // Keyboard controls are on
+	keys        chan byte // Keypresses for handleKeys
+
+	mu    sync.Mutex
+	stage datablip.Stage // Of the last progress drawn; cleared by a step line
+	speed float64        // Of the last progress drawn
+	line  bool           // The merge line was left unterminated
+}
+
+// newConsole returns a console showing d's steps and progress.
+func newConsole(d *datablip.Downloader) *console {
+	c := &console{d: d}
+	d.Notify = c.notify
+	d.Progress = c.progress
+	return c
+}
+
+func (c *console) notify(format string, args ...any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.line {
+		fmt.Println()
+		c.line = false
+	}
+	c.stage = ""
+	fmt.Println(msg.Sprintf(format, args...))
+}
+
+func (c *console) progress(p datablip.Progress) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.speed = p.Speed
+	switch p.Stage {
+	case datablip.StageMerging:
+		displayMergeProgress(p)
+		c.line = true
+	case datablip.StageDownloading:
+		if c.stage != datablip.StageDownloading {
+			// Clear the screen once, then redraw over the same lines
+			fmt.Print("\033[2J")
+		}
+		displayProgress(p)
+		if c.interactive {
+			c.displayControls(p.Paused)
+		}
+	}
+	c.stage = p.Stage
+}
+
+// failed reports a download that didn't complete, and how to carry on with
+// it when its state was kept.
+func (c *console) failed(err error) {
+	c.d.Logf("download: failed: %v", err)
+	fmt.Printf("\n%s\n", msg.Sprintf("Download failed: %v", msg.Error(err)))
+	path := datablip.ResumeMetadataPath(c.d.OutputPath)
+	if _, statErr := os.Stat(path); statErr == nil && c.d.KeepPartial {
+		fmt.Println(msg.Sprintf("Partial download kept; resume with: datablip partials resume %s", path))
+	}
+}
+
+func displayProgress(p datablip.Progress) {
+	// Move cursor to the top-left of the display area (no screen clear)
+	fmt.Print("\033[H")
+
+	// Display overall progress
+	percentage := p.Percent()
+	overallCompleted := int(float64(ProgressBarWidth) * percentage / 100)
+	overallRemaining := ProgressBarWidth - overallCompleted
+	progressBar := "[" + strings.Repeat("=", overallCompleted) + strings.Repeat("-", overallRemaining) + "]"
+
+	fmt.Printf("%s\n", msg.Text("Overall Progress:"))
+	overallETA := "∞"
+	if eta, ok := speed.ETA(p.Total-p.Downloaded, p.Speed); ok {
+		overallETA = formatETA(eta)
+	}
+	fmt.Printf("%s %.1f%% (%s/%s) %s %s %s\033[K\n\n",
+		progressBar,
+		percentage,
+		datablip.FormatBytes(p.Downloaded),
+		datablip.FormatBytes(p.Total),
+		datablip.FormatSpeed(p.Speed),
+		msg.Text("ETA"),
+		overallETA)
+
+	// Display individual chunk progress
+	fmt.Printf("%s\n", msg.Text("Individual Chunks:"))
+	fmt.Printf("%-8s %-12s %-32s %-12s %-10s %-8s %s\n",
+		msg.Text("Chunk"), msg.Text("Status"), msg.Text("Progress"), msg.Text("Downloaded"),
+		msg.Text("Speed"), msg.Text("Restarts"), msg.Text("ETA"))
+	fmt.Printf("%s\n", strings.Repeat("-", 94))
+
+	var waiting, downloading, reconnecting, paused, completed, failed int
+	for _, chunk := range p.Chunks {
+		percentage := chunk.Percent()
+
+		// Create mini progress bar for chunk
+		chunkCompleted := int(float64(20) * percentage / 100)
+		chunkRemaining := 20 - chunkCompleted
+		chunkBar := "[" + strings.Repeat("=", chunkCompleted) + strings.Repeat("-", chunkRemaining) + "]"
+
+		// Calculate ETA
+		eta := "∞"
+		if remaining, ok := speed.ETA(chunk.Total-chunk.Downloaded, chunk.Speed); ok && chunk.State == "downloading" {
+			if remaining > 0 && remaining < time.Hour { // Only show if less than 1 hour
+				eta = fmt.Sprintf("%.0fs", remaining.Seconds())
+			}
+		}
+
+		// Status color coding (using ANSI colors)
+		statusColor := ""
+		statusReset := "\033[0m"
+		switch chunk.State {
+		case "waiting":
+			statusColor = "\033[33m" // Yellow
+			waiting++
+		case "downloading":
+			statusColor = "\033[36m" // Cyan
+			downloading++
+		case "reconnecting":
+			statusColor = "\033[35m" // Magenta
+			reconnecting++
+		case "paused":
+			statusColor = "\033[35m" // Magenta
+			paused++
+		case "completed":
+			statusColor = "\033[32m" // Green
+			completed++
+		case "failed":
+			statusColor = "\033[31m" // Red
+			failed++
+		}
+
+		fmt.Printf("%-8d %s%-12s%s %-32s %-12s %-10s %-8d %s\n",
+			chunk.ID,
+			statusColor, msg.Text(chunk.State), statusReset,
+			fmt.Sprintf("%s %.1f%%", chunkBar, percentage),
+			datablip.FormatBytes(chunk.Downloaded),
+			datablip.FormatSpeed(chunk.Speed),
+			chunk.Restarts,
+			eta)
+	}
+
+	// Show active/completed/failed counts
+	fmt.Printf("\n%s", msg.Text("Status Summary: "))
+	fmt.Printf("\033[33m%s\033[0m, ", msg.Sprintf("Waiting: %d", waiting))
+	fmt.Printf("\033[36m%s\033[0m, ", msg.Sprintf("Downloading: %d", downloading))
+	if reconnecting > 0 {
+		fmt.Printf("\033[35m%s\033[0m, ", msg.Sprintf("Reconnecting: %d", reconnecting))
+	}
+	if paused > 0 {
+		fmt.Printf("\033[35m%s\033[0m, ", msg.Sprintf("Paused: %d", paused))
+	}
+	fmt.Printf("\033[32m%s\033[0m, ", msg.Sprintf("Completed: %d", completed))
+	fmt.Printf("\033[31m%s\033[0m\n", msg.Sprintf("Failed: %d", failed))
+}
+
+func displayMergeProgress(p datablip.Progress) {
+	percentage := p.Percent()
+	completed := int(float64(ProgressBarWidth) * percentage / 100)
+	remaining := ProgressBarWidth - completed
+
+	progressBar := "[" + strings.Repeat("=", completed) + strings.Repeat("-", remaining) + "]"
+
+	fmt.Printf("\r%s %s %.1f%% (%s/%s) %s",
+		msg.Text("Merge:"),
+		progressBar,
+		percentage,
+		datablip.FormatBytes(p.Downloaded),
+		datablip.FormatBytes(p.Total),
+		datablip.FormatSpeed(p.Speed))
+}
+
+func formatETA(d time.Duration) string {
+	if d >= time.Hour {
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	if d >= time.Minute {
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
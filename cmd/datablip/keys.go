@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/govind1331/Datablip/pkg/datablip"
+)
+
+// minRateLimit is as low as the - key takes the speed limit.
+const minRateLimit = 1 << 10
+
+// watchKeys lets keypresses on the terminal steer the download:
+//
+//	p       pause every connection
+//	r       resume
+//	+ / -   raise or lower the speed limit by a quarter
+//	q       stop, keeping the partial download to resume later
+//
+// It returns a context that q cancels, and a func that puts the terminal
+// back, which must be called before the program exits. Without a terminal
+// on stdin the download runs as usual.
+func (c *console) watchKeys(ctx context.Context) (context.Context, func()) {
+	restore, err := rawTerminal(os.Stdin)
+	if err != nil {
+		c.d.Logf("download: keyboard controls unavailable: %v", err)
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c.interactive = true
+	c.keys = make(chan byte, 16)
+	go c.handleKeys(ctx)
+
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			if n == 0 {
+				continue
+			}
+			switch key := buf[0]; key {
+			case 'q', 'Q':
+				c.d.Logf("download: quit from the keyboard")
+				c.d.KeepPartial = true
+				cancel()
+				return
+			default:
+				select {
+				case c.keys <- key:
+				default: // Keys pressed faster than they are handled are dropped
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(restore)
+		cancel()
+	}
+}
+
+// handleKeys acts on the keys read by watchKeys until ctx is done.
+func (c *console) handleKeys(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case key := <-c.keys:
+			switch key {
+			case 'p', 'P', ' ':
+				c.d.Pause()
+			case 'r', 'R':
+				c.d.Resume()
+			case '+', '=':
+				c.adjustRateLimit(1.25)
+			case '-', '_':
+				c.adjustRateLimit(0.75)
+			}
+		}
+	}
+}
+
+// adjustRateLimit scales the speed limit by factor. Lowering the limit of an
+// unlimited download starts from its current speed.
+func (c *console) adjustRateLimit(factor float64) {
+	rate := c.d.RateLimit()
+	if rate == 0 {
+		if factor > 1 {
+			return
+		}
+		c.mu.Lock()
+		rate = c.speed
+		c.mu.Unlock()
+		if rate < minRateLimit {
+			rate = 1 << 20
+		}
+	}
+	c.d.SetRateLimit(max(rate*factor, minRateLimit))
+}
+
+// displayControls prints the key help below the progress display.
+func (c *console) displayControls(paused bool) {
+	state := "\033[36m" + msg.Text("running") + "\033[0m"
+	if paused {
+		state = "\033[35m" + msg.Text("paused") + "\033[0m"
+	}
+	fmt.Printf("\n%s\033[K\n", msg.Sprintf("%s, limit %s | p pause, r resume, +/- speed limit, q quit and keep for later",
+		state, formatRateLimit(c.d.RateLimit())))
+}
+
+func formatRateLimit(bytesPerSec float64) string {
+	if bytesPerSec <= 0 {
+		return msg.Text("none")
+	}
+	return datablip.FormatSpeed(bytesPerSec)
+}
@@ -2,16 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strings"
-	"sync"
-	"sync/atomic"
+	"syscall"
 	"time"
+
+	"github.com/govind1331/Datablip/internal/config"
+	"github.com/govind1331/Datablip/internal/conflict"
+	"github.com/govind1331/Datablip/internal/digest"
+	"github.com/govind1331/Datablip/internal/hoststats"
+	"github.com/govind1331/Datablip/internal/i18n"
+	"github.com/govind1331/Datablip/internal/nametemplate"
+	"github.com/govind1331/Datablip/internal/redirect"
+	"github.com/govind1331/Datablip/internal/retry"
+	"github.com/govind1331/Datablip/internal/stall"
+	"github.com/govind1331/Datablip/pkg/datablip"
 )
 
 // Version information (set by build system)
@@ -21,805 +30,230 @@ var (
 	buildTime = "unknown"
 )
 
-const (
-	DefaultConnectTimeout = 30 * time.Second // Connection timeout
-	DefaultReadTimeout    = 5 * time.Minute  // Per-chunk read timeout
-	DefaultConnections    = 4
-	ProgressBarWidth      = 30
-)
+// msg translates what the CLI prints, in the language of the user's locale
+// unless -lang picks another.
+var msg = i18n.New(i18n.FromEnv())
 
-type ChunkInfo struct {
-	ID        int
-	StartByte int64
-	EndByte   int64
-	Size      int64
-}
-
-// ChunkProgress tracks individual chunk download progress
-type ChunkProgress struct {
-	ID              int
-	downloadedBytes int64
-	totalBytes      int64
-	startTime       time.Time
-	status          string // "waiting", "downloading", "completed", "failed"
-	speed           float64
-	mu              sync.RWMutex
-}
+// exitChecksumMismatch is the exit status when the file doesn't match
+// -checksum or a checksum the server declared.
+const exitChecksumMismatch = 3
 
-func NewChunkProgress(id int, totalBytes int64) *ChunkProgress {
-	return &ChunkProgress{
-		ID:         id,
-		totalBytes: totalBytes,
-		startTime:  time.Now(),
-		status:     "waiting",
+// loadConfig adds -config to flags and sets their defaults from the
+// configuration file and environment variables, such as DATABLIP_CHUNKS for
+// -chunks. Flags in args, parsed afterwards, win.
+func loadConfig(flags *flag.FlagSet, args []string) {
+	flags.String("config", "", "Read flag defaults from this YAML or TOML file instead of the datablip.yaml or datablip.toml found in the working directory, the user's config directory or /etc/datablip.")
+	if _, err := config.Setup(flags, "cli", false, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 }
 
-func (cp *ChunkProgress) SetStatus(status string) {
-	cp.mu.Lock()
-	defer cp.mu.Unlock()
-	cp.status = status
-	if status == "downloading" && cp.startTime.IsZero() {
-		cp.startTime = time.Now()
-	}
-}
-
-func (cp *ChunkProgress) AddBytes(bytes int64) {
-	atomic.AddInt64(&cp.downloadedBytes, bytes)
-
-	// Update speed calculation
-	cp.mu.Lock()
-	defer cp.mu.Unlock()
-
-	if cp.status == "downloading" {
-		elapsed := time.Since(cp.startTime).Seconds()
-		if elapsed > 0 {
-			cp.speed = float64(atomic.LoadInt64(&cp.downloadedBytes)) / elapsed
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "partials":
+			os.Exit(runPartials(os.Args[2:]))
+		case "queue":
+			os.Exit(runQueue(os.Args[2:]))
+		case "batch":
+			os.Exit(runBatch(os.Args[2:]))
+		case "bench":
+			os.Exit(runBench(os.Args[2:]))
+		case "watch-clipboard":
+			os.Exit(runWatchClipboard(os.Args[2:]))
 		}
 	}
-}
-
-func (cp *ChunkProgress) GetProgress() (downloaded, total int64, percentage float64, speed float64, status string) {
-	cp.mu.RLock()
-	defer cp.mu.RUnlock()
-
-	downloaded = atomic.LoadInt64(&cp.downloadedBytes)
-	total = cp.totalBytes
-	if total > 0 {
-		percentage = float64(downloaded) / float64(total) * 100
-	}
-	speed = cp.speed
-	status = cp.status
-	return
-}
 
-// ProgressManager manages all chunk progress tracking
-type ProgressManager struct {
-	chunkProgresses []*ChunkProgress
-	totalSize       int64
-	startTime       time.Time
-	mu              sync.RWMutex
-}
-
-func NewProgressManager(chunks []ChunkInfo) *ProgressManager {
-	pm := &ProgressManager{
-		chunkProgresses: make([]*ChunkProgress, len(chunks)),
-		startTime:       time.Now(),
-	}
-
-	for i, chunk := range chunks {
-		pm.chunkProgresses[i] = NewChunkProgress(i, chunk.Size)
-		pm.totalSize += chunk.Size
-	}
-
-	return pm
-}
-
-func (pm *ProgressManager) GetChunkProgress(chunkID int) *ChunkProgress {
-	if chunkID >= 0 && chunkID < len(pm.chunkProgresses) {
-		return pm.chunkProgresses[chunkID]
-	}
-	return nil
-}
-
-func (pm *ProgressManager) GetOverallProgress() (downloaded, total int64, percentage float64, speed float64) {
-	var totalDownloaded int64
-
-	for _, cp := range pm.chunkProgresses {
-		downloaded, _, _, _, _ := cp.GetProgress()
-		totalDownloaded += downloaded
-	}
-
-	total = pm.totalSize
-	if total > 0 {
-		percentage = float64(totalDownloaded) / float64(total) * 100
-	}
-
-	elapsed := time.Since(pm.startTime).Seconds()
-	if elapsed > 0 {
-		speed = float64(totalDownloaded) / elapsed
-	}
-
-	return totalDownloaded, total, percentage, speed
-}
-
-func (pm *ProgressManager) FormatSpeed(bytesPerSec float64) string {
-	if bytesPerSec < 1024 {
-		return fmt.Sprintf("%.0f B/s", bytesPerSec)
-	} else if bytesPerSec < 1024*1024 {
-		return fmt.Sprintf("%.1f KB/s", bytesPerSec/1024)
-	} else {
-		return fmt.Sprintf("%.1f MB/s", bytesPerSec/(1024*1024))
-	}
-}
-
-func (pm *ProgressManager) FormatSize(bytes int64) string {
-	if bytes < 1024 {
-		return fmt.Sprintf("%d B", bytes)
-	} else if bytes < 1024*1024 {
-		return fmt.Sprintf("%.1f KB", float64(bytes)/1024)
-	} else {
-		return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
-	}
-}
-
-func (pm *ProgressManager) DisplayProgress() {
-	// Move cursor to the top-left of the display area (no screen clear)
-	fmt.Print("\033[H")
-
-	// Display overall progress
-	downloaded, total, percentage, speed := pm.GetOverallProgress()
-	overallCompleted := int(float64(ProgressBarWidth) * percentage / 100)
-	overallRemaining := ProgressBarWidth - overallCompleted
-	progressBar := "[" + strings.Repeat("=", overallCompleted) + strings.Repeat("-", overallRemaining) + "]"
-
-	fmt.Printf("Overall Progress:\n")
-	fmt.Printf("%s %.1f%% (%s/%s) %s\n\n",
-		progressBar,
-		percentage,
-		pm.FormatSize(downloaded),
-		pm.FormatSize(total),
-		pm.FormatSpeed(speed))
-
-	// Display individual chunk progress
-	fmt.Printf("Individual Chunks:\n")
-	fmt.Printf("%-8s %-12s %-32s %-12s %-10s %s\n",
-		"Chunk", "Status", "Progress", "Downloaded", "Speed", "ETA")
-	fmt.Printf("%s\n", strings.Repeat("-", 85))
-
-	for _, cp := range pm.chunkProgresses {
-		downloaded, total, percentage, speed, status := cp.GetProgress()
-
-		// Create mini progress bar for chunk
-		chunkCompleted := int(float64(20) * percentage / 100)
-		chunkRemaining := 20 - chunkCompleted
-		chunkBar := "[" + strings.Repeat("=", chunkCompleted) + strings.Repeat("-", chunkRemaining) + "]"
-
-		// Calculate ETA
-		eta := "∞"
-		if speed > 0 && status == "downloading" {
-			remainingBytes := total - downloaded
-			etaSeconds := float64(remainingBytes) / speed
-			if etaSeconds > 0 && etaSeconds < 3600 { // Only show if less than 1 hour
-				eta = fmt.Sprintf("%.0fs", etaSeconds)
-			}
-		}
-
-		// Status color coding (using ANSI colors)
-		statusColor := ""
-		statusReset := "\033[0m"
-		switch status {
-		case "waiting":
-			statusColor = "\033[33m" // Yellow
-		case "downloading":
-			statusColor = "\033[36m" // Cyan
-		case "completed":
-			statusColor = "\033[32m" // Green
-		case "failed":
-			statusColor = "\033[31m" // Red
-		}
-
-		fmt.Printf("%-8d %s%-12s%s %-32s %-12s %-10s %s\n",
-			cp.ID,
-			statusColor, status, statusReset,
-			fmt.Sprintf("%s %.1f%%", chunkBar, percentage),
-			pm.FormatSize(downloaded),
-			pm.FormatSpeed(speed),
-			eta)
-	}
+	// url := "https://ubuntu.mirror.serversaustralia.com.au/ubuntu-releases/noble/ubuntu-24.04.2-desktop-amd64.iso"
+	// outputPath := "ubuntu-24.04.2-desktop-amd64.iso"
+	// chunks := 4
 
-	// Show active/completed/failed counts
-	var waiting, downloading, completed, failed int
-	for _, cp := range pm.chunkProgresses {
-		_, _, _, _, status := cp.GetProgress()
-		switch status {
-		case "waiting":
-			waiting++
-		case "downloading":
-			downloading++
-		case "completed":
-			completed++
-		case "failed":
-			failed++
+	url := flag.String("url", "https://myUrlofTheFile.iso", "URL of the file to download.")
+	var mirrors []string
+	flag.Func("mirror", "Another URL of the same file to spread chunks across; repeat for more mirrors.", func(mirror string) error {
+		mirrors = append(mirrors, mirror)
+		return nil
+	})
+	headers := make(map[string]string)
+	flag.Func("header", "Send this header with every request, as 'Name: value' (e.g., 'Referer: https://example.com/'); repeat for more.", func(header string) error {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("want 'Name: value'")
 		}
-	}
-
-	fmt.Printf("\nStatus Summary: ")
-	fmt.Printf("\033[33mWaiting: %d\033[0m, ", waiting)
-	fmt.Printf("\033[36mDownloading: %d\033[0m, ", downloading)
-	fmt.Printf("\033[32mCompleted: %d\033[0m, ", completed)
-	fmt.Printf("\033[31mFailed: %d\033[0m\n", failed)
-}
-
-type MergeProgress struct {
-	totalSize   int64
-	mergedBytes int64
-	startTime   time.Time
-	mu          sync.RWMutex
-}
-
-func (mp *MergeProgress) AddBytes(bytes int64) {
-	atomic.AddInt64(&mp.mergedBytes, bytes)
-}
-
-func (mp *MergeProgress) GetProgress() (merged, total int64, percentage float64, speed float64) {
-	merged = atomic.LoadInt64(&mp.mergedBytes)
-	total = mp.totalSize
-	percentage = float64(merged) / float64(total) * 100
-
-	elapsed := time.Since(mp.startTime).Seconds()
-	if elapsed > 0 {
-		speed = float64(merged) / elapsed
-	}
-
-	return
-}
-
-type MergeProgressReader struct {
-	reader   io.Reader
-	progress *MergeProgress
-}
-
-func (mpr *MergeProgressReader) Read(p []byte) (n int, err error) {
-	n, err = mpr.reader.Read(p)
-	if n > 0 {
-		mpr.progress.AddBytes(int64(n))
-	}
-	return
-}
-
-type ChunkProgressReader struct {
-	reader        io.Reader
-	chunkProgress *ChunkProgress
-}
-
-func (cpr *ChunkProgressReader) Read(p []byte) (n int, err error) {
-	n, err = cpr.reader.Read(p)
-	if n > 0 {
-		cpr.chunkProgress.AddBytes(int64(n))
-	}
-	return
-}
-
-type Downloader struct {
-	URL             string
-	OutputPath      string
-	Chunks          int
-	ConnectTimeout  time.Duration
-	ReadTimeout     time.Duration
-	client          *http.Client
-	progressManager *ProgressManager
-}
-
-func NewDownloader(url, outputPath string, chunks int) *Downloader {
-	return &Downloader{
-		URL:            url,
-		OutputPath:     outputPath,
-		Chunks:         chunks,
-		ConnectTimeout: DefaultConnectTimeout,
-		ReadTimeout:    DefaultReadTimeout,
-		client: &http.Client{
-			Timeout: DefaultConnectTimeout,
-		},
-	}
-}
-
-func (d *Downloader) SetTimeouts(connectTimeout, readTimeout time.Duration) {
-	d.ConnectTimeout = connectTimeout
-	d.ReadTimeout = readTimeout
-	d.client.Timeout = connectTimeout
-}
-
-func (d *Downloader) getFileSize() (int64, error) {
-	fmt.Printf("Getting file information from: %s\n", d.URL)
-
-	resp, err := d.client.Head(d.URL)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get file info: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("server returned status code %d", resp.StatusCode)
-	}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		return nil
+	})
+	cookie := flag.String("cookie", "", "Send these cookies to the file's host, as in a Cookie header (e.g., 'session=abc; lang=en').")
+	cookiesFile := flag.String("cookies-file", "", "Send the cookies of this cookies.txt, as exported from a browser, to the hosts that set them.")
+	user := flag.String("user", "", "Log in to the file's host with basic auth as 'user:password'.")
+	outputPath := flag.String("output", "filename.extension", "Path to save the downloaded file; may be a template such as '{date}/{host}/{basename}', filled in once the file is probed, with "+nametemplate.Names+".")
+	onConflict := flag.String("on-conflict", string(conflict.Default), "If the output file already exists: rename (save as 'name (2).ext'), overwrite, resume from its bytes, or fail.")
+	chunks := flag.Int("chunks", 0, "Number of concurrent download chunks; 0 picks a count from the file size and server latency.")
+	chunkSize := flag.String("chunk-size", "", "Split the file into chunks of this size (e.g., '32M', '1G') instead of a fixed count; -chunks then limits concurrent connections.")
+	connectTimeout := flag.Duration("connect-timeout", 30*time.Second, "Connection timeout (e.g., '30s', '1m').")
+	readTimeout := flag.Duration("read-timeout", 10*time.Minute, "Read timeout per chunk (e.g., '10m', '1h').")
+	maxTime := flag.Duration("max-time", 0, "Abort the download if it has not finished within this duration (e.g., '2h'); 0 disables.")
+	retries := flag.Int("retries", retry.DefaultMax, "How many times in a row a failed chunk is requested again from where it stopped before the download fails.")
+	retryBackoff := flag.Duration("retry-backoff", retry.DefaultBackoff, "Pause before a chunk's first retry, doubled for each one after (e.g., '1s', '500ms').")
+	maxRedirects := flag.Int("max-redirects", redirect.DefaultMax, "How many redirects in a row a request follows; Authorization and cookies aren't passed to another host.")
+	keepPartial := flag.Bool("keep-partial", true, "Keep resumable state when the download fails or exceeds -max-time.")
+	logFile := flag.String("log-file", "", "Append a detailed, timestamped download log to this file.")
+	endgameMode := flag.Bool("endgame", true, "Near the end of a download, open a second connection for a chunk that is far slower than the rest.")
+	tempDir := flag.String("temp-dir", "", "Directory for chunk files; defaults to the output file's directory.")
+	stallSpeed := flag.String("stall-speed", "5K", "Restart a chunk's connection when it moves slower than this per second (e.g., '5K') while others keep up; 0 disables.")
+	stallTime := flag.Duration("stall-time", stall.DefaultTime, "How long a chunk must stay below -stall-speed before its connection is restarted.")
+	limitRate := flag.String("limit-rate", "", "Cap the combined download speed per second (e.g., '500K', '2M'); + and - adjust it while downloading.")
+	lang := flag.String("lang", msg.Lang(), "Language of progress and status messages: "+strings.Join(i18n.Languages(), ", ")+"; defaults to the locale's.")
+	hostStatsFile := flag.String("host-stats-file", defaultHostStatsFile(), "Record the throughput of finished downloads per host in this file, for datablip bench -history; empty disables.")
+	autoConnections := flag.Bool("auto-connections", false, "With -chunks 0, use no more connections than the host was measured to saturate at.")
+	checksum := flag.String("checksum", "", "Fail unless the file matches this checksum, given as algorithm:hex with md5, sha1, sha256 or sha512 (e.g., 'sha256:9f86d081...'); exits with status 3 on a mismatch.")
+	keys := flag.Bool("keys", true, "Control the download from the keyboard: p pause, r resume, +/- speed limit, q quit and keep state.")
+	loadConfig(flag.CommandLine, os.Args[1:])
 
-	size := resp.ContentLength
-	if size <= 0 {
-		return 0, fmt.Errorf("could not determine file size or server doesn't support range requests")
+	flag.Parse()
+	if !i18n.Supported(*lang) {
+		fmt.Printf("Unsupported -lang %q; available: %s\n", *lang, strings.Join(i18n.Languages(), ", "))
+		os.Exit(1)
 	}
+	msg = i18n.New(*lang)
 
-	return size, nil
-}
-
-func (d *Downloader) createChunks(fileSize int64) []ChunkInfo {
-	var chunks []ChunkInfo
-	chunkSize := fileSize / int64(d.Chunks)
-
-	for i := 0; i < d.Chunks; i++ {
-		startByte := int64(i) * chunkSize
-		endByte := startByte + chunkSize - 1
-
-		if i == d.Chunks-1 {
-			endByte = fileSize - 1
-		}
-
-		chunkInfo := ChunkInfo{
-			ID:        i,
-			StartByte: startByte,
-			EndByte:   endByte,
-			Size:      endByte - startByte + 1,
+	downloader := datablip.NewDownloader(*url, *outputPath, *chunks)
+	if nametemplate.IsTemplate(*outputPath) {
+		if err := nametemplate.Validate(*outputPath); err != nil {
+			fmt.Printf("Invalid -output: %v\n", err)
+			os.Exit(1)
 		}
-
-		chunks = append(chunks, chunkInfo)
-	}
-
-	return chunks
-}
-
-func (d *Downloader) downloadChunk(chunk ChunkInfo, outputFile string) error {
-	chunkProgress := d.progressManager.GetChunkProgress(chunk.ID)
-	chunkProgress.SetStatus("downloading")
-
-	req, err := http.NewRequest("GET", d.URL, nil)
-	if err != nil {
-		chunkProgress.SetStatus("failed")
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	rangeHeader := fmt.Sprintf("bytes=%d-%d", chunk.StartByte, chunk.EndByte)
-	req.Header.Set("Range", rangeHeader)
-	req.Header.Set("User-Agent", "MultiPartDownloader/1.0")
-
-	client := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConns:          100,
-			MaxIdleConnsPerHost:   10,
-			IdleConnTimeout:       90 * time.Second,
-			DisableKeepAlives:     false,
-			ResponseHeaderTimeout: d.ConnectTimeout,
-		},
+		downloader.OutputTemplate = *outputPath
 	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		chunkProgress.SetStatus("failed")
-		return fmt.Errorf("failed to make request for chunk %d: %w", chunk.ID, err)
+	if _, err := conflict.Parse(*onConflict); err != nil {
+		fmt.Printf("Invalid -on-conflict: %v\n", err)
+		os.Exit(1)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
-		chunkProgress.SetStatus("failed")
-		return fmt.Errorf("chunk %d: server returned status code %d", chunk.ID, resp.StatusCode)
+	downloader.OnConflict = *onConflict
+	downloader.Mirrors = mirrors
+	downloader.Headers = headers
+	downloader.Cookie = *cookie
+	downloader.CookiesFile = *cookiesFile
+	if *user != "" {
+		downloader.Username, downloader.Password, _ = strings.Cut(*user, ":")
 	}
-
-	output, err := os.Create(outputFile)
-	if err != nil {
-		chunkProgress.SetStatus("failed")
-		return fmt.Errorf("failed to create output file for chunk %d: %w", chunk.ID, err)
+	downloader.SetTimeouts(*connectTimeout, *readTimeout)
+	downloader.MaxTime = *maxTime
+	if *retries < 0 || *retryBackoff <= 0 {
+		fmt.Println("-retries must be at least 0 and -retry-backoff positive")
+		os.Exit(1)
 	}
-	defer output.Close()
-
-	progressReader := &ChunkProgressReader{
-		reader:        resp.Body,
-		chunkProgress: chunkProgress,
+	downloader.Retries = *retries
+	downloader.RetryBackoff = *retryBackoff
+	if *maxRedirects < 0 {
+		fmt.Println("-max-redirects must be at least 0")
+		os.Exit(1)
 	}
+	downloader.MaxRedirects = *maxRedirects
+	downloader.KeepPartial = *keepPartial
+	downloader.Endgame = *endgameMode
+	downloader.TempDir = *tempDir
 
-	written, err := d.copyWithActivityTimeout(output, progressReader, d.ReadTimeout)
+	floor, err := parseSize(*stallSpeed)
 	if err != nil {
-		chunkProgress.SetStatus("failed")
-		return fmt.Errorf("failed to write data for chunk %d: %w", chunk.ID, err)
-	}
-
-	if resp.StatusCode == http.StatusPartialContent && abs(written-chunk.Size) > 1024 {
-		chunkProgress.SetStatus("failed")
-		return fmt.Errorf("chunk %d: expected %d bytes, got %d bytes (difference: %d)",
-			chunk.ID, chunk.Size, written, abs(written-chunk.Size))
-	}
-
-	chunkProgress.SetStatus("completed")
-	return nil
-}
-
-func abs(x int64) int64 {
-	if x < 0 {
-		return -x
-	}
-	return x
-}
-
-func (d *Downloader) copyWithActivityTimeout(dst io.Writer, src io.Reader, timeout time.Duration) (int64, error) {
-	buf := make([]byte, 64*1024)
-	var written int64
-	lastActivity := time.Now()
-
-	for {
-		if timeout > 0 {
-			deadline := time.Now().Add(timeout)
-			if conn, ok := src.(interface{ SetReadDeadline(time.Time) error }); ok {
-				conn.SetReadDeadline(deadline)
-			}
-		}
-
-		nr, er := src.Read(buf)
-		if nr > 0 {
-			lastActivity = time.Now()
-			nw, ew := dst.Write(buf[0:nr])
-			if nw < 0 || nr < nw {
-				nw = 0
-				if ew == nil {
-					ew = fmt.Errorf("invalid write result")
-				}
-			}
-			written += int64(nw)
-			if ew != nil {
-				return written, ew
-			}
-			if nr != nw {
-				return written, io.ErrShortWrite
-			}
-		}
-
-		if er != nil {
-			if er == io.EOF {
-				break
-			}
-			if timeout > 0 && time.Since(lastActivity) > timeout {
-				return written, fmt.Errorf("read timeout after %v of inactivity", timeout)
-			}
-			return written, er
-		}
-
-		if timeout > 0 && time.Since(lastActivity) > timeout {
-			return written, fmt.Errorf("read timeout after %v of inactivity", timeout)
-		}
+		fmt.Printf("Invalid -stall-speed %q\n", *stallSpeed)
+		os.Exit(1)
 	}
-	return written, nil
-}
-
-func (d *Downloader) verifyChunks(chunkFiles []string, expectedChunks []ChunkInfo) error {
-	fmt.Println("\nVerifying downloaded chunks...")
-	var totalDownloadedSize int64
+	downloader.StallSpeed = float64(floor)
+	downloader.StallTime = *stallTime
 
-	for i, chunkFile := range chunkFiles {
-		info, err := os.Stat(chunkFile)
+	if *limitRate != "" {
+		rate, err := parseSize(*limitRate)
 		if err != nil {
-			return fmt.Errorf("chunk %d verification failed - file not found (%s): %w", i, chunkFile, err)
+			fmt.Printf("Invalid -limit-rate %q\n", *limitRate)
+			os.Exit(1)
 		}
-
-		actualSize := info.Size()
-		expectedSize := expectedChunks[i].Size
-		totalDownloadedSize += actualSize
-
-		if actualSize == 0 {
-			return fmt.Errorf("chunk %d verification failed - file is empty (%s)", i, chunkFile)
-		}
-
-		if actualSize < expectedSize-1024 || actualSize > expectedSize+1024 {
-			fmt.Printf("WARNING: Chunk %d size mismatch - expected %d bytes, got %d bytes (%s)\n",
-				i, expectedSize, actualSize, chunkFile)
-		}
-
-		fmt.Printf("  ✓ Chunk %d: %s (%s)\n", i, chunkFile, d.progressManager.FormatSize(actualSize))
+		downloader.SetRateLimit(float64(rate))
 	}
 
-	fmt.Printf("✓ All %d chunks verified (total: %s)\n",
-		len(chunkFiles), d.progressManager.FormatSize(totalDownloadedSize))
-	return nil
-}
-
-func (d *Downloader) mergeChunks(chunkFiles []string) error {
-	var totalMergeSize int64
-	chunkSizes := make([]int64, len(chunkFiles))
-
-	for i, chunkFile := range chunkFiles {
-		info, err := os.Stat(chunkFile)
-		if err != nil {
-			return fmt.Errorf("failed to stat chunk %d (%s): %w", i, chunkFile, err)
+	if *chunkSize != "" {
+		size, err := parseSize(*chunkSize)
+		if err != nil || size <= 0 {
+			fmt.Printf("Invalid -chunk-size %q\n", *chunkSize)
+			os.Exit(1)
 		}
-		chunkSizes[i] = info.Size()
-		totalMergeSize += info.Size()
+		downloader.ChunkSize = size
 	}
 
-	fmt.Printf("\nMerging %d chunks (total: %s)...\n", len(chunkFiles), d.progressManager.FormatSize(totalMergeSize))
-
-	output, err := os.Create(d.OutputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+	if *checksum != "" {
+		if _, err := digest.Parse(*checksum); err != nil {
+			fmt.Printf("Invalid -checksum: %v\n", err)
+			os.Exit(1)
+		}
+		downloader.Checksum = *checksum
 	}
-	defer output.Close()
 
-	mergeProgress := &MergeProgress{
-		totalSize: totalMergeSize,
-		startTime: time.Now(),
+	var hosts *hoststats.Store
+	if *hostStatsFile != "" {
+		hosts = loadHostStats(*hostStatsFile)
+		downloader.Hosts = hosts
+		downloader.AutoConnections = *autoConnections
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	go d.displayMergeProgress(ctx, mergeProgress)
-
-	for i, chunkFile := range chunkFiles {
-		fmt.Printf("Merging chunk %d/%d (%s)...", i+1, len(chunkFiles), d.progressManager.FormatSize(chunkSizes[i]))
-
-		input, err := os.Open(chunkFile)
+	if *logFile != "" {
+		closeLog, err := openLogFile(downloader, *logFile)
 		if err != nil {
-			return fmt.Errorf("failed to open chunk %d (%s): %w", i, chunkFile, err)
-		}
-
-		progressReader := &MergeProgressReader{
-			reader:   input,
-			progress: mergeProgress,
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
 		}
-
-		written, err := io.Copy(output, progressReader)
-		input.Close()
-
-		if err != nil {
-			return fmt.Errorf("failed to copy chunk %d: %w", i, err)
-		}
-
-		if written != chunkSizes[i] {
-			return fmt.Errorf("chunk %d: expected to copy %d bytes, but copied %d bytes",
-				i, chunkSizes[i], written)
-		}
-
-		fmt.Printf(" ✓\n")
+		defer closeLog()
 	}
 
-	cancel()
-
-	if err := output.Sync(); err != nil {
-		return fmt.Errorf("failed to sync output file: %w", err)
+	fmt.Println(msg.Sprintf("Downloading: %s", *url))
+	fmt.Println(msg.Sprintf("Output: %s", *outputPath))
+	if downloader.ChunkSize > 0 && *chunks > 0 {
+		fmt.Println(msg.Sprintf("Chunk size: %s (%d connections)", datablip.FormatBytes(downloader.ChunkSize), *chunks))
+	} else if downloader.ChunkSize > 0 {
+		fmt.Println(msg.Sprintf("Chunk size: %s (connections: auto)", datablip.FormatBytes(downloader.ChunkSize)))
+	} else if *chunks > 0 {
+		fmt.Println(msg.Sprintf("Chunks: %d", *chunks))
+	} else {
+		fmt.Println(msg.Text("Chunks: auto"))
 	}
-
-	output.Close()
-	return d.verifyFinalFile(totalMergeSize)
-}
-
-func (d *Downloader) verifyFinalFile(expectedSize int64) error {
-	fmt.Println("Performing final file verification...")
-
-	finalInfo, err := os.Stat(d.OutputPath)
-	if err != nil {
-		return fmt.Errorf("final file verification failed - file not found (%s): %w", d.OutputPath, err)
+	fmt.Println(msg.Sprintf("Timeouts - Connect: %v, Read per chunk: %v",
+		downloader.ConnectTimeout, downloader.ReadTimeout))
+	if rate := downloader.RateLimit(); rate > 0 {
+		fmt.Println(msg.Sprintf("Speed limit: %s", formatRateLimit(rate)))
 	}
+	fmt.Println()
 
-	actualSize := finalInfo.Size()
-
-	if actualSize != expectedSize {
-		return fmt.Errorf("final file verification failed - expected %d bytes, got %d bytes (%s)",
-			expectedSize, actualSize, d.OutputPath)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	console := newConsole(downloader)
+	restoreTerminal := func() {}
+	if *keys {
+		ctx, restoreTerminal = console.watchKeys(ctx)
 	}
 
-	file, err := os.Open(d.OutputPath)
+	err = downloader.Download(ctx)
+	restoreTerminal() // os.Exit skips deferred calls
 	if err != nil {
-		return fmt.Errorf("final file verification failed - cannot open file (%s): %w", d.OutputPath, err)
-	}
-	defer file.Close()
-
-	buffer := make([]byte, 1024)
-	n, err := file.Read(buffer)
-	if err != nil && err != io.EOF {
-		return fmt.Errorf("final file verification failed - cannot read file (%s): %w", d.OutputPath, err)
-	}
-	if n == 0 && actualSize > 0 {
-		return fmt.Errorf("final file verification failed - file appears to be empty or corrupted (%s)", d.OutputPath)
-	}
-
-	fmt.Printf("✓ Final file verification successful: %s\n", d.OutputPath)
-	fmt.Printf("  File size: %s (%d bytes)\n", d.progressManager.FormatSize(actualSize), actualSize)
-	fmt.Printf("  File permissions: %v\n", finalInfo.Mode())
-	fmt.Printf("  Modified: %v\n", finalInfo.ModTime())
-
-	return nil
-}
-
-func (d *Downloader) ensureMergeCompletion(chunkFiles []string, maxRetries int) error {
-	var lastErr error
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		fmt.Printf("\nMerge attempt %d of %d...\n", attempt, maxRetries)
-
-		if attempt > 1 {
-			if err := os.Remove(d.OutputPath); err != nil && !os.IsNotExist(err) {
-				fmt.Printf("Warning: failed to remove partial file: %v\n", err)
-			}
-		}
-
-		err := d.mergeChunks(chunkFiles)
-		if err == nil {
-			fmt.Printf("✓ Merge completed successfully on attempt %d\n", attempt)
-			return nil
-		}
-
-		lastErr = err
-		fmt.Printf("✗ Merge attempt %d failed: %v\n", attempt, err)
-
-		if attempt < maxRetries {
-			fmt.Printf("Retrying in 2 seconds...\n")
-			time.Sleep(2 * time.Second)
-		}
-	}
-
-	return fmt.Errorf("merge failed after %d attempts, last error: %w", maxRetries, lastErr)
-}
-
-func (d *Downloader) displayMergeProgress(ctx context.Context, mergeProgress *MergeProgress) {
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			merged, total, percentage, speed := mergeProgress.GetProgress()
-
-			completed := int(float64(ProgressBarWidth) * percentage / 100)
-			remaining := ProgressBarWidth - completed
-
-			progressBar := "[" + strings.Repeat("=", completed) + strings.Repeat("-", remaining) + "]"
-
-			fmt.Printf("\rMerge: %s %.1f%% (%s/%s) %s",
-				progressBar,
-				percentage,
-				d.progressManager.FormatSize(merged),
-				d.progressManager.FormatSize(total),
-				d.progressManager.FormatSpeed(speed))
+		console.failed(err)
+		if errors.Is(err, datablip.ErrChecksumMismatch) {
+			os.Exit(exitChecksumMismatch)
 		}
+		os.Exit(1)
 	}
-}
-
-func (d *Downloader) startProgressDisplay(ctx context.Context) {
-	// Clear screen once at the start
-	fmt.Print("\033[2J\033[H")
-
-	ticker := time.NewTicker(200 * time.Millisecond) // Update every 200ms for smoother display
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			d.progressManager.DisplayProgress()
+	if hosts != nil {
+		if err := saveHostStats(hosts, *hostStatsFile); err != nil {
+			fmt.Printf("Warning: %v\n", err)
 		}
 	}
 }
 
-func (d *Downloader) Download() error {
-	fileSize, err := d.getFileSize()
-	if err != nil {
-		return err
-	}
-
-	fmt.Printf("File size: %d bytes (%.2f MB)\n", fileSize, float64(fileSize)/(1024*1024))
-
-	chunks := d.createChunks(fileSize)
-	d.progressManager = NewProgressManager(chunks)
-
-	fmt.Printf("Created %d chunks for concurrent download\n", len(chunks))
-
-	tempDir, err := os.MkdirTemp("", "download-chunks-*")
+// openLogFile points the downloader's detailed log at path, appending to any
+// existing content. The returned func closes the file.
+func openLogFile(d *datablip.Downloader, path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to create temp directory: %w", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	if err := os.MkdirAll(filepath.Dir(d.OutputPath), 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
-	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	go d.startProgressDisplay(ctx)
-
-	fmt.Printf("\nStarting concurrent download of %d chunks...\n\n", len(chunks))
-
-	var wg sync.WaitGroup
-	chunkFiles := make([]string, len(chunks))
-	errorChan := make(chan error, len(chunks))
-
-	for i, chunk := range chunks {
-		wg.Add(1)
-		chunkFiles[i] = filepath.Join(tempDir, fmt.Sprintf("chunk-%d", i))
-
-		go func(c ChunkInfo, outputFile string) {
-			defer wg.Done()
-
-			if err := d.downloadChunk(c, outputFile); err != nil {
-				errorChan <- fmt.Errorf("chunk %d failed: %w", c.ID, err)
-				return
-			}
-		}(chunk, chunkFiles[i])
-	}
-
-	wg.Wait()
-	close(errorChan)
-
-	cancel() // Stop progress display
-
-	// Final progress display
-	d.progressManager.DisplayProgress()
-	fmt.Println()
-
-	var downloadErrors []error
-	for err := range errorChan {
-		downloadErrors = append(downloadErrors, err)
-	}
-
-	if len(downloadErrors) > 0 {
-		fmt.Printf("Download failed with %d errors:\n", len(downloadErrors))
-		for _, err := range downloadErrors {
-			fmt.Printf("  - %v\n", err)
-		}
-		return fmt.Errorf("download failed with %d chunk errors", len(downloadErrors))
-	}
-
-	fmt.Printf("✓ All %d chunks downloaded successfully\n", len(chunks))
-
-	if err := d.verifyChunks(chunkFiles, chunks); err != nil {
-		return fmt.Errorf("chunk verification failed: %w", err)
-	}
-
-	if err := d.ensureMergeCompletion(chunkFiles, 3); err != nil {
-		return fmt.Errorf("merge completion failed: %w", err)
-	}
-
-	elapsed := time.Since(d.progressManager.startTime)
-	avgSpeed := float64(fileSize) / elapsed.Seconds()
-
-	fmt.Printf("\n🎉 Download completed successfully: %s\n", d.OutputPath)
-	fmt.Printf("Total time: %v, Average speed: %s\n", elapsed.Round(time.Second), d.progressManager.FormatSpeed(avgSpeed))
-
-	return nil
-}
-
-func main() {
-	// url := "https://ubuntu.mirror.serversaustralia.com.au/ubuntu-releases/noble/ubuntu-24.04.2-desktop-amd64.iso"
-	// outputPath := "ubuntu-24.04.2-desktop-amd64.iso"
-	// chunks := 4
-
-	url := flag.String("url", "https://myUrlofTheFile.iso", "URL of the file to download.")
-	outputPath := flag.String("output", "filename.extension", "Path to save the downloaded file.")
-	chunks := flag.Int("chunks", 4, "Number of concurrent download chunks.")
-	connectTimeout := flag.Duration("connect-timeout", 30*time.Second, "Connection timeout (e.g., '30s', '1m').")
-	readTimeout := flag.Duration("read-timeout", 10*time.Minute, "Read timeout per chunk (e.g., '10m', '1h').")
-
-	flag.Parse()
-
-	downloader := NewDownloader(*url, *outputPath, *chunks)
-	downloader.SetTimeouts(*connectTimeout, *readTimeout)
-
-	fmt.Printf("Downloading: %s\n", *url)
-	fmt.Printf("Output: %s\n", *outputPath)
-	fmt.Printf("Chunks: %d\n", *chunks)
-	fmt.Printf("Timeouts - Connect: %v, Read per chunk: %v\n",
-		downloader.ConnectTimeout, downloader.ReadTimeout)
-	fmt.Println()
-
-	if err := downloader.Download(); err != nil {
-		fmt.Printf("\nDownload failed: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to open log file: %w", err)
 	}
+	d.SetLogOutput(file)
+	return func() { file.Close() }, nil
 }
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/govind1331/Datablip/pkg/datablip"
+)
+
+// dirList collects repeated -dir flags.
+type dirList []string
+
+func (dl *dirList) String() string {
+	return strings.Join(*dl, ",")
+}
+
+func (dl *dirList) Set(value string) error {
+	*dl = append(*dl, value)
+	return nil
+}
+
+const partialsUsage = `Usage: datablip partials [-dir DIR]... <command> [control-file...]
+
+Commands:
+  list              Show resumable partial downloads (default)
+  verify [file...]  Check chunk files against their resume metadata
+  resume <file>     Continue a partial download
+  clean <file...>   Remove partial downloads and their chunk files; with
+                    -all, every one found
+  export <file> <token>
+                    Save a partial download with its data as a token file
+                    that can be imported on another machine
+  import <token>    Recreate a partial download from a token, then resume
+                    it there
+
+A control file is the "<output>.datablip" file written next to each
+unfinished download; the output path itself is accepted as well.
+`
+
+func runPartials(args []string) int {
+	flags := flag.NewFlagSet("partials", flag.ExitOnError)
+	var dirs dirList
+	flags.Var(&dirs, "dir", "Directory to scan for partial downloads (repeatable, default: current directory).")
+	connectTimeout := flags.Duration("connect-timeout", datablip.DefaultConnectTimeout, "Connection timeout used by resume.")
+	readTimeout := flags.Duration("read-timeout", 10*time.Minute, "Read timeout per chunk used by resume.")
+	logFile := flags.String("log-file", "", "Append a detailed download log to this file during resume.")
+	rangesOnly := flags.Bool("ranges-only", false, "Leave the chunk data out of an exported token, recording only which ranges are done and their hashes.")
+	output := flags.String("output", "", "Where import puts the download; defaults to the token's file name in the current directory.")
+	dataDir := flags.String("data-dir", "", "Directory with copies of the chunk files, for importing a -ranges-only token.")
+	all := flags.Bool("all", false, "Let clean remove every partial download found when given no control files.")
+	loadConfig(flags, args)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, partialsUsage)
+		fmt.Fprintln(os.Stderr, "\nOptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if len(dirs) == 0 {
+		dirs = dirList{"."}
+	}
+
+	command := "list"
+	rest := flags.Args()
+	if len(rest) > 0 {
+		command, rest = rest[0], rest[1:]
+	}
+
+	switch command {
+	case "list":
+		return listPartials(dirs)
+	case "verify":
+		return verifyPartials(dirs, rest)
+	case "resume":
+		if len(rest) != 1 {
+			fmt.Fprintln(os.Stderr, "resume requires exactly one control file")
+			return 2
+		}
+		return resumePartial(rest[0], *connectTimeout, *readTimeout, *logFile)
+	case "clean":
+		if len(rest) == 0 && !*all {
+			fmt.Fprintln(os.Stderr, "clean requires control files, or -all to remove every partial download found")
+			return 2
+		}
+		return cleanPartials(dirs, rest)
+	case "export":
+		if len(rest) != 2 {
+			fmt.Fprintln(os.Stderr, "export requires a control file and a token file")
+			return 2
+		}
+		return exportPartial(rest[0], rest[1], *rangesOnly)
+	case "import":
+		if len(rest) != 1 {
+			fmt.Fprintln(os.Stderr, "import requires exactly one token file")
+			return 2
+		}
+		return importPartial(rest[0], *output, *dataDir)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown partials command %q\n\n", command)
+		flags.Usage()
+		return 2
+	}
+}
+
+// findPartials walks the given directories and returns every control file.
+func findPartials(dirs []string) ([]string, error) {
+	var found []string
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), datablip.ResumeSuffix) {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+		}
+	}
+	return found, nil
+}
+
+// resolvePartials returns the explicitly named control files, or everything
+// found under dirs when none are given.
+func resolvePartials(dirs []string, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return findPartials(dirs)
+	}
+
+	paths := make([]string, len(names))
+	for i, name := range names {
+		if !strings.HasSuffix(name, datablip.ResumeSuffix) {
+			name = datablip.ResumeMetadataPath(name)
+		}
+		paths[i] = name
+	}
+	return paths, nil
+}
+
+func listPartials(dirs []string) int {
+	paths, err := findPartials(dirs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(paths) == 0 {
+		fmt.Println("No partial downloads found.")
+		return 0
+	}
+
+	fmt.Printf("%-40s %-8s %-22s %-20s %s\n", "Output", "Chunks", "Progress", "Updated", "URL")
+	fmt.Printf("%s\n", strings.Repeat("-", 110))
+
+	for _, path := range paths {
+		meta, err := datablip.LoadResumeMetadata(path)
+		if err != nil {
+			fmt.Printf("%-40s %v\n", path, err)
+			continue
+		}
+
+		downloaded := meta.DownloadedBytes()
+		percentage := 0.0
+		if meta.TotalSize > 0 {
+			percentage = float64(downloaded) / float64(meta.TotalSize) * 100
+		}
+
+		fmt.Printf("%-40s %-8d %-22s %-20s %s\n",
+			meta.OutputPath,
+			len(meta.Chunks),
+			fmt.Sprintf("%s/%s %.1f%%", datablip.FormatBytes(downloaded), datablip.FormatBytes(meta.TotalSize), percentage),
+			meta.UpdatedAt.Format("2006-01-02 15:04:05"),
+			meta.URL)
+	}
+	return 0
+}
+
+func verifyPartials(dirs []string, names []string) int {
+	paths, err := resolvePartials(dirs, names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	status := 0
+	for _, path := range paths {
+		meta, err := datablip.LoadResumeMetadata(path)
+		if err != nil {
+			fmt.Printf("✗ %v\n", err)
+			status = 1
+			continue
+		}
+
+		fmt.Printf("%s:\n", meta.OutputPath)
+		for _, chunk := range meta.Chunks {
+			chunkFile := meta.ChunkFile(chunk.ID)
+			info, err := os.Stat(chunkFile)
+			switch {
+			case os.IsNotExist(err):
+				fmt.Printf("  - Chunk %d: not started\n", chunk.ID)
+			case err != nil:
+				fmt.Printf("  ✗ Chunk %d: %v\n", chunk.ID, err)
+				status = 1
+			case info.Size() > chunk.Size:
+				fmt.Printf("  ✗ Chunk %d: %d bytes exceeds expected %d bytes (%s)\n",
+					chunk.ID, info.Size(), chunk.Size, chunkFile)
+				status = 1
+			case info.Size() == chunk.Size:
+				fmt.Printf("  ✓ Chunk %d: complete (%s)\n", chunk.ID, datablip.FormatBytes(info.Size()))
+			default:
+				fmt.Printf("  ~ Chunk %d: %s of %s\n", chunk.ID, datablip.FormatBytes(info.Size()), datablip.FormatBytes(chunk.Size))
+			}
+		}
+	}
+	return status
+}
+
+func resumePartial(name string, connectTimeout, readTimeout time.Duration, logFile string) int {
+	paths, err := resolvePartials(nil, []string{name})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	meta, err := datablip.LoadResumeMetadata(paths[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load partial download: %v\n", err)
+		return 1
+	}
+
+	connections := meta.Connections
+	if connections <= 0 {
+		connections = len(meta.Chunks)
+	}
+	downloader := datablip.NewDownloader(meta.URL, meta.OutputPath, connections)
+	downloader.SetTimeouts(connectTimeout, readTimeout)
+
+	if logFile != "" {
+		closeLog, err := openLogFile(downloader, logFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer closeLog()
+	}
+
+	fmt.Println(msg.Sprintf("Resuming: %s", meta.URL))
+	fmt.Printf("%s\n\n", msg.Sprintf("Output: %s", meta.OutputPath))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	console := newConsole(downloader)
+	ctx, restoreTerminal := console.watchKeys(ctx)
+	defer restoreTerminal()
+
+	if err := downloader.Download(ctx); err != nil {
+		console.failed(err)
+		if errors.Is(err, datablip.ErrChecksumMismatch) {
+			return exitChecksumMismatch
+		}
+		return 1
+	}
+	return 0
+}
+
+// cleanMinAge is how long a partial download must have gone unwritten for
+// clean to remove it, in case a download without a lock is still running.
+const cleanMinAge = time.Minute
+
+func cleanPartials(dirs []string, names []string) int {
+	paths, err := resolvePartials(dirs, names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	status := 0
+	for _, path := range paths {
+		meta, err := datablip.LoadResumeMetadata(path)
+		if err != nil {
+			fmt.Printf("✗ %v\n", err)
+			status = 1
+			continue
+		}
+		if meta.Locked() {
+			fmt.Printf("⚠ Skipping %s: it is being downloaded\n", meta.OutputPath)
+			status = 1
+			continue
+		}
+		if since := time.Since(meta.LastWrite()); since < cleanMinAge {
+			fmt.Printf("⚠ Skipping %s: written to %v ago, so it may still be downloading\n", meta.OutputPath, since.Round(time.Second))
+			status = 1
+			continue
+		}
+		removing := path + " and its journal"
+		if meta.ChunkDir != "" {
+			removing = fmt.Sprintf("%s, its journal and %s of chunk files in %s", path, datablip.FormatBytes(meta.DownloadedBytes()), meta.ChunkDir)
+		}
+		fmt.Printf("Removing %s\n", removing)
+		if err := meta.Remove(); err != nil {
+			fmt.Printf("✗ %v\n", err)
+			status = 1
+			continue
+		}
+		fmt.Printf("✓ Removed partial download for %s\n", meta.OutputPath)
+	}
+	return status
+}
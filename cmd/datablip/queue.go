@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const queueUsage = `Usage: datablip queue [-server URL] <command> [file]
+
+Commands:
+  export [file]  Save the server's whole queue as JSON (default: stdout)
+  import <file>  Add the unfinished downloads of an export to the server
+
+Exports list every download with its options, status and part file, so a
+queue can be backed up or moved to another instance. Imported downloads
+start over; completed ones are skipped.
+`
+
+// defaultServer is where the queue commands find datablip-server.
+const defaultServer = "http://localhost:8080"
+
+// serverClient returns a client for datablip-server at server, and the base
+// URL of its API. A server of unix:<path> is reached over that Unix socket.
+// A non-empty apiKey is sent with every request.
+func serverClient(server, apiKey string) (*http.Client, string) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	client := &http.Client{Timeout: time.Minute, Transport: &keyTransport{key: apiKey, base: base}}
+	path, ok := strings.CutPrefix(server, "unix:")
+	if !ok {
+		return client, strings.TrimSuffix(server, "/") + "/api"
+	}
+	base.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+	// The host is only there to form URLs
+	return client, "http://datablip/api"
+}
+
+// keyTransport sends the API key of a server that requires credentials.
+type keyTransport struct {
+	key  string
+	base http.RoundTripper
+}
+
+func (t *keyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.key == "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("X-API-Key", t.key)
+	return t.base.RoundTrip(req)
+}
+
+func runQueue(args []string) int {
+	flags := flag.NewFlagSet("queue", flag.ExitOnError)
+	server := flags.String("server", defaultServer, "Base URL of datablip-server, or unix:<path> of its socket.")
+	apiKey := flags.String("api-key", "", "API key or session token of a server that requires credentials.")
+	loadConfig(flags, args)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, queueUsage)
+		fmt.Fprintln(os.Stderr, "\nOptions:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	rest := flags.Args()
+	if len(rest) == 0 {
+		flags.Usage()
+		return 2
+	}
+	client, api := serverClient(*server, *apiKey)
+	api += "/queue"
+
+	switch command, rest := rest[0], rest[1:]; command {
+	case "export":
+		if len(rest) > 1 {
+			fmt.Fprintln(os.Stderr, "export takes at most one file")
+			return 2
+		}
+		return exportQueue(client, api, rest)
+	case "import":
+		if len(rest) != 1 {
+			fmt.Fprintln(os.Stderr, "import requires exactly one file")
+			return 2
+		}
+		return importQueue(client, api, rest[0])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown queue command %q\n\n", command)
+		flags.Usage()
+		return 2
+	}
+}
+
+func exportQueue(client *http.Client, api string, rest []string) int {
+	resp, err := client.Get(api + "/export")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ Failed to reach server: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if err := responseError(resp); err != nil {
+		fmt.Fprintf(os.Stderr, "✗ Export failed: %v\n", err)
+		return 1
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ Export failed: %v\n", err)
+		return 1
+	}
+
+	if len(rest) == 0 {
+		os.Stdout.Write(body)
+		return 0
+	}
+	var export struct {
+		Downloads []json.RawMessage `json:"downloads"`
+	}
+	if err := json.Unmarshal(body, &export); err != nil {
+		fmt.Fprintf(os.Stderr, "✗ Server sent an invalid export: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(rest[0], body, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+		return 1
+	}
+	fmt.Printf("✓ Exported %d downloads to %s\n", len(export.Downloads), rest[0])
+	return 0
+}
+
+func importQueue(client *http.Client, api string, name string) int {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+		return 1
+	}
+	resp, err := client.Post(api+"/import", "application/json", bytes.NewReader(data))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ Failed to reach server: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if err := responseError(resp); err != nil {
+		fmt.Fprintf(os.Stderr, "✗ Import failed: %v\n", err)
+		return 1
+	}
+
+	var result struct {
+		Imported []struct {
+			ID       string `json:"id"`
+			Filename string `json:"filename"`
+			URL      string `json:"url"`
+		} `json:"imported"`
+		Skipped int      `json:"skipped"`
+		Errors  []string `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		fmt.Fprintf(os.Stderr, "✗ Server sent an invalid reply: %v\n", err)
+		return 1
+	}
+
+	for _, d := range result.Imported {
+		fmt.Printf("✓ %s %s (%s)\n", d.ID, d.Filename, d.URL)
+	}
+	for _, e := range result.Errors {
+		fmt.Printf("✗ %s\n", e)
+	}
+	fmt.Printf("Imported %d downloads, skipped %d already finished", len(result.Imported), result.Skipped)
+	if len(result.Errors) > 0 {
+		fmt.Printf(", %d failed\n", len(result.Errors))
+		return 1
+	}
+	fmt.Println()
+	return 0
+}
+
+// responseError turns an unsuccessful response into an error carrying the
+// server's message.
+func responseError(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
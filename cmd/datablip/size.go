@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseSize parses a byte count such as "512", "64K", "32M", "1.5G" or
+// "32MiB". Suffixes are binary multiples.
+func parseSize(value string) (int64, error) {
+	s := strings.TrimSpace(strings.ToUpper(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			s = s[:n-1]
+		}
+	}
+
+	number, err := strconv.ParseFloat(s, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(number * float64(multiplier)), nil
+}
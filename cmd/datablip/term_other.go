@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func rawTerminal(file *os.File) (func(), error) {
+	return nil, errors.New("not supported on this platform")
+}
@@ -0,0 +1,37 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// rawTerminal switches the terminal on file to deliver keypresses one at a
+// time without echoing them. Ctrl+C still interrupts. The returned func
+// restores the previous settings.
+func rawTerminal(file *os.File) (func(), error) {
+	fd := file.Fd()
+	var old syscall.Termios
+	if err := ioctl(fd, ioctlGetTermios, &old); err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	return func() { ioctl(fd, ioctlSetTermios, &old) }, nil
+}
+
+func ioctl(fd uintptr, request uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
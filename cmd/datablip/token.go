@@ -0,0 +1,317 @@
+package main
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/govind1331/Datablip/pkg/datablip"
+)
+
+const (
+	// tokenFormatVersion versions the resume tokens written by
+	// exportPartial.
+	tokenFormatVersion = 1
+
+	// tokenManifest is the first entry of a token archive; chunk data
+	// follows as "chunk-<id>" entries.
+	tokenManifest = "token.json"
+)
+
+// resumeToken carries a partial download to another machine. Paths are
+// left out since they mean nothing there; each chunk records how many of
+// its bytes were done and their hash, so the data can travel inside the
+// token or be copied separately and checked on import.
+type resumeToken struct {
+	Version     int          `json:"version"`
+	URL         string       `json:"url"`
+	Filename    string       `json:"filename"`
+	TotalSize   int64        `json:"totalSize"`
+	ETag        string       `json:"etag,omitempty"`
+	Connections int          `json:"connections,omitempty"`
+	Chunks      []tokenChunk `json:"chunks"`
+	Data        bool         `json:"data"` // Chunk data follows in the archive
+	ExportedAt  time.Time    `json:"exportedAt"`
+}
+
+type tokenChunk struct {
+	datablip.ChunkInfo
+	Done   int64  `json:"done"`             // Bytes from StartByte already downloaded
+	SHA256 string `json:"sha256,omitempty"` // Of those bytes
+}
+
+// doneBytes returns how much of the chunk file can be trusted: no more than
+// the chunk's size, and no more than the journal vouches for when it
+// mentions the chunk.
+func doneBytes(meta *datablip.ResumeMetadata, trusted map[int]int64, chunk datablip.ChunkInfo) int64 {
+	info, err := os.Stat(meta.ChunkFile(chunk.ID))
+	if err != nil {
+		return 0
+	}
+	done := min(info.Size(), chunk.Size)
+	if t, ok := trusted[chunk.ID]; ok {
+		done = min(done, t)
+	}
+	return done
+}
+
+// hashPrefix returns the SHA-256 of the first n bytes of the file.
+func hashPrefix(path string, n int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.CopyN(hash, file, n); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// exportPartial writes a token for the partial download to dest. With
+// rangesOnly the chunk data is left out, for when it is copied separately.
+func exportPartial(name, dest string, rangesOnly bool) int {
+	paths, err := resolvePartials(nil, []string{name})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	meta, err := datablip.LoadResumeMetadata(paths[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load partial download: %v\n", err)
+		return 1
+	}
+	trusted, err := datablip.LoadJournal(meta.OutputPath)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: ignoring unreadable journal: %v\n", err)
+	}
+
+	token := resumeToken{
+		Version:     tokenFormatVersion,
+		URL:         meta.URL,
+		Filename:    filepath.Base(meta.OutputPath),
+		TotalSize:   meta.TotalSize,
+		ETag:        meta.ETag,
+		Connections: meta.Connections,
+		Data:        !rangesOnly,
+		ExportedAt:  time.Now(),
+	}
+	var done int64
+	for _, chunk := range meta.Chunks {
+		entry := tokenChunk{ChunkInfo: chunk, Done: doneBytes(meta, trusted, chunk)}
+		if entry.Done > 0 {
+			if entry.SHA256, err = hashPrefix(meta.ChunkFile(chunk.ID), entry.Done); err != nil {
+				fmt.Fprintf(os.Stderr, "✗ Failed to read chunk %d: %v\n", chunk.ID, err)
+				return 1
+			}
+		}
+		done += entry.Done
+		token.Chunks = append(token.Chunks, entry)
+	}
+
+	if err := writeToken(dest, &token, meta); err != nil {
+		os.Remove(dest)
+		fmt.Fprintf(os.Stderr, "✗ Export failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("✓ Exported %s (%s of %s done) to %s\n",
+		token.Filename, datablip.FormatBytes(done), datablip.FormatBytes(token.TotalSize), dest)
+	if rangesOnly {
+		fmt.Printf("Copy the chunk files in %s along and import with -data-dir to keep them\n", meta.ChunkDir)
+	}
+	return 0
+}
+
+func writeToken(dest string, token *resumeToken, meta *datablip.ResumeMetadata) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	archive := tar.NewWriter(out)
+
+	manifest, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: tokenManifest, Mode: 0644, Size: int64(len(manifest)), ModTime: token.ExportedAt}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := archive.Write(manifest); err != nil {
+		return err
+	}
+
+	for _, chunk := range token.Chunks {
+		if !token.Data || chunk.Done == 0 {
+			continue
+		}
+		file, err := os.Open(meta.ChunkFile(chunk.ID))
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{Name: fmt.Sprintf("chunk-%d", chunk.ID), Mode: 0644, Size: chunk.Done, ModTime: token.ExportedAt}
+		if err = archive.WriteHeader(header); err == nil {
+			_, err = io.CopyN(archive, file, chunk.Done)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// importPartial recreates the partial download described by a token at
+// output, defaulting to the token's file name in the current directory.
+// Chunk data comes from the token or from copies of the chunk files in
+// dataDir; data that doesn't match the token's hashes is downloaded again.
+func importPartial(name, output, dataDir string) int {
+	file, err := os.Open(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+	archive := tar.NewReader(file)
+
+	var token resumeToken
+	header, err := archive.Next()
+	if err == nil && header.Name != tokenManifest {
+		err = fmt.Errorf("%s is missing", tokenManifest)
+	}
+	if err == nil {
+		err = json.NewDecoder(archive).Decode(&token)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ %s is not a resume token: %v\n", name, err)
+		return 1
+	}
+	if token.Version != tokenFormatVersion {
+		fmt.Fprintf(os.Stderr, "✗ Unsupported resume token version %d\n", token.Version)
+		return 1
+	}
+
+	if output == "" {
+		output = filepath.Base(token.Filename)
+	}
+	if _, err := os.Stat(datablip.ResumeMetadataPath(output)); err == nil {
+		fmt.Fprintf(os.Stderr, "✗ %s already has a partial download\n", output)
+		return 1
+	}
+	if _, err := os.Stat(output); err == nil {
+		fmt.Fprintf(os.Stderr, "✗ %s already exists\n", output)
+		return 1
+	}
+	dir, err := filepath.Abs(filepath.Dir(output))
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+		return 1
+	}
+	chunkDir, err := os.MkdirTemp(dir, "download-chunks-*")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ Failed to create chunk directory: %v\n", err)
+		return 1
+	}
+
+	meta := &datablip.ResumeMetadata{
+		Version:     datablip.ResumeFormatVersion,
+		URL:         token.URL,
+		OutputPath:  output,
+		TotalSize:   token.TotalSize,
+		ETag:        token.ETag,
+		ChunkDir:    chunkDir,
+		Connections: token.Connections,
+		CreatedAt:   time.Now(),
+	}
+	chunks := make(map[int]tokenChunk)
+	for _, chunk := range token.Chunks {
+		meta.Chunks = append(meta.Chunks, chunk.ChunkInfo)
+		chunks[chunk.ID] = chunk
+	}
+
+	restored := make(map[int]bool)
+	if token.Data {
+		for {
+			header, err := archive.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				os.RemoveAll(chunkDir)
+				fmt.Fprintf(os.Stderr, "✗ Failed to read %s: %v\n", name, err)
+				return 1
+			}
+			id, err := strconv.Atoi(strings.TrimPrefix(header.Name, "chunk-"))
+			chunk, ok := chunks[id]
+			if err != nil || !ok || !strings.HasPrefix(header.Name, "chunk-") {
+				continue
+			}
+			restored[id] = restoreChunk(meta, chunk, archive)
+		}
+	}
+	if dataDir != "" {
+		for _, chunk := range token.Chunks {
+			if restored[chunk.ID] || chunk.Done == 0 {
+				continue
+			}
+			src, err := os.Open(filepath.Join(dataDir, fmt.Sprintf("chunk-%d", chunk.ID)))
+			if err != nil {
+				fmt.Printf("  - Chunk %d: %v\n", chunk.ID, err)
+				continue
+			}
+			restored[chunk.ID] = restoreChunk(meta, chunk, src)
+			src.Close()
+		}
+	}
+
+	if err := meta.Save(); err != nil {
+		os.RemoveAll(chunkDir)
+		fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+		return 1
+	}
+	fmt.Printf("✓ Imported %s (%s of %s on disk)\n", output, datablip.FormatBytes(meta.DownloadedBytes()), datablip.FormatBytes(meta.TotalSize))
+	fmt.Printf("Continue it with: datablip partials resume %s\n", output)
+	return 0
+}
+
+// restoreChunk copies the chunk's done bytes from r into its chunk file and
+// keeps them only if they match the token's hash.
+func restoreChunk(meta *datablip.ResumeMetadata, chunk tokenChunk, r io.Reader) bool {
+	path := meta.ChunkFile(chunk.ID)
+	out, err := os.Create(path)
+	if err != nil {
+		fmt.Printf("  ✗ Chunk %d: %v\n", chunk.ID, err)
+		return false
+	}
+	hash := sha256.New()
+	_, err = io.CopyN(io.MultiWriter(out, hash), r, chunk.Done)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(hash.Sum(nil)) != chunk.SHA256 {
+		err = fmt.Errorf("data does not match the token")
+	}
+	if err != nil {
+		os.Remove(path)
+		fmt.Printf("  ✗ Chunk %d: %v; it will be downloaded again\n", chunk.ID, err)
+		return false
+	}
+	fmt.Printf("  ✓ Chunk %d: %s restored\n", chunk.ID, datablip.FormatBytes(chunk.Done))
+	return true
+}
@@ -3,6 +3,16 @@ module github.com/govind1331/Datablip
 go 1.23.3
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/gorilla/mux v1.8.0
 	github.com/gorilla/websocket v1.5.0
+	go.etcd.io/bbolt v1.4.0
+	golang.org/x/crypto v0.32.0
+	golang.org/x/net v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
 )
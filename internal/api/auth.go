@@ -0,0 +1,213 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/govind1331/Datablip/internal/auth"
+)
+
+// KeyHeader carries an API key or session token. Authorization can carry
+// either too, as a bearer token, but is then taken by the files token for
+// requests that need both.
+const KeyHeader = "X-API-Key"
+
+// publicRoutes are served without credentials: logging in, grabs, which
+// check their own token, and the API description.
+var publicRoutes = map[string]bool{
+	"/api/login":        true,
+	"/api/grab":         true,
+	"/api/openapi.json": true,
+	"/api/docs":         true,
+}
+
+var errOrigin = errors.New("origin not allowed")
+
+// credential returns the API key or session token r carries.
+func credential(r *http.Request) string {
+	if key := r.Header.Get(KeyHeader); key != "" {
+		return key
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token
+}
+
+// authorize reports whether r may be served, answering it with 401 if not.
+// Only /api routes are checked; the frontend is served to everyone.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, credential string) bool {
+	if !s.Auth.Enabled() {
+		return true
+	}
+	if _, err := s.Auth.Check(credential); err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="datablip"`)
+		httpError(w, r, err.Error(), http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// AuthorizeWS reports whether a WebSocket client may connect: one that
+// brings a ticket from POST /api/ws-token, which is used up, or, once
+// authentication is on, one that sent valid credentials in its headers.
+// Without authentication a ticket is still needed, and only pages the
+// server's own or AllowedOrigins get one, so pages on other sites can't
+// just open the socket and watch.
+func (s *Server) AuthorizeWS(r *http.Request, ticket string) bool {
+	if ticket != "" {
+		return s.tickets.Redeem(ticket)
+	}
+	if !s.Auth.Enabled() {
+		return false
+	}
+	_, err := s.Auth.Check(credential(r))
+	return err == nil
+}
+
+type ticketResponse struct {
+	Ticket    string    `json:"ticket"` // Send as /ws?ticket=<ticket> or in the first message
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// CheckOrigin reports whether a browser request came from a page that may
+// use the WebSocket: one served by this server or from one of
+// AllowedOrigins. Requests without an Origin aren't from a browser page.
+func (s *Server) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range s.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// wsToken issues a ticket that opens one WebSocket, to clients that aren't
+// pages on other sites.
+func (s *Server) wsToken(w http.ResponseWriter, r *http.Request) {
+	if !s.CheckOrigin(r) {
+		httpError(w, r, errOrigin.Error(), http.StatusForbidden)
+		return
+	}
+	ticket, expires, err := s.tickets.Issue()
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ticketResponse{Ticket: ticket, ExpiresAt: expires})
+}
+
+type loginRequest struct {
+	Password string `json:"password"`
+}
+
+type loginResponse struct {
+	Token     string    `json:"token"` // Send as "Authorization: Bearer <token>"
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// login exchanges the server's password for a session token.
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	if s.Auth == nil {
+		httpError(w, r, auth.ErrNoLogin.Error(), http.StatusNotFound)
+		return
+	}
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	token, expires, err := s.Auth.Login(req.Password)
+	switch {
+	case errors.Is(err, auth.ErrNoLogin):
+		httpError(w, r, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, auth.ErrWrongPassword):
+		httpError(w, r, err.Error(), http.StatusUnauthorized)
+		return
+	case err != nil:
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loginResponse{Token: token, ExpiresAt: expires})
+}
+
+type createKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// createdKey is a new key with its secret, which is only ever shown here.
+type createdKey struct {
+	auth.Key
+	Secret string `json:"key"` // Send as the X-API-Key header
+}
+
+func (s *Server) listKeys(w http.ResponseWriter, r *http.Request) {
+	keys := []auth.Key{}
+	if s.Auth != nil {
+		keys = s.Auth.Keys.List()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// createKey makes an API key. The first one turns authentication on, if
+// nothing else had.
+func (s *Server) createKey(w http.ResponseWriter, r *http.Request) {
+	if s.Auth == nil {
+		httpError(w, r, "API keys are not set up", http.StatusNotFound)
+		return
+	}
+	var req createKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		httpError(w, r, "name is required", http.StatusBadRequest)
+		return
+	}
+	key, secret, err := s.Auth.Keys.Add(req.Name)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.manager.Telemetry.Count("feature.apiKeys")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createdKey{Key: key, Secret: secret})
+}
+
+func (s *Server) deleteKey(w http.ResponseWriter, r *http.Request) {
+	if s.Auth == nil {
+		httpError(w, r, auth.ErrKeyNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if err := s.Auth.Keys.Delete(mux.Vars(r)["id"]); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrKeyNotFound) {
+			code = http.StatusNotFound
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
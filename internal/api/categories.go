@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/govind1331/Datablip/internal/downloader"
+)
+
+func (s *Server) listCategories(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.manager.Categories())
+}
+
+func (s *Server) getCategory(w http.ResponseWriter, r *http.Request) {
+	category, err := s.manager.GetCategory(mux.Vars(r)["name"])
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
+
+// putCategory adds the category named in the path, or replaces it.
+func (s *Server) putCategory(w http.ResponseWriter, r *http.Request) {
+	var category downloader.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	category.Name = mux.Vars(r)["name"]
+	category, err := s.manager.PutCategory(category)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
+
+func (s *Server) deleteCategory(w http.ResponseWriter, r *http.Request) {
+	if err := s.manager.DeleteCategory(mux.Vars(r)["name"]); err != nil {
+		httpError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
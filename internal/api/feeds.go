@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/govind1331/Datablip/internal/downloader"
+	"github.com/govind1331/Datablip/internal/reqauth"
+)
+
+func (s *Server) listFeeds(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.manager.Feeds())
+}
+
+// createFeedRequest is a feed's settings with the credentials the feed's
+// own JSON leaves out.
+type createFeedRequest struct {
+	downloader.Feed
+	reqauth.Auth
+}
+
+// createFeed starts watching a feed, after a first poll whose outcome is
+// in the returned feed's lastError.
+func (s *Server) createFeed(w http.ResponseWriter, r *http.Request) {
+	var req createFeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	settings := req.Feed
+	settings.Auth = req.Auth
+	f, err := s.manager.AddFeed(settings)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.manager.Telemetry.Count("feature.feeds")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(f)
+}
+
+func (s *Server) getFeed(w http.ResponseWriter, r *http.Request) {
+	f, err := s.manager.GetFeed(mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f)
+}
+
+func (s *Server) deleteFeed(w http.ResponseWriter, r *http.Request) {
+	if err := s.manager.DeleteFeed(mux.Vars(r)["id"]); err != nil {
+		httpError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pollFeed polls a feed right away and returns it.
+func (s *Server) pollFeed(w http.ResponseWriter, r *http.Request) {
+	f, err := s.manager.PollFeed(mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f)
+}
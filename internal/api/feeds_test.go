@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/govind1331/Datablip/internal/downloader"
+)
+
+func TestFeedCredentialsNotListed(t *testing.T) {
+	var sentPassword string
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, sentPassword, _ = r.BasicAuth()
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Dumps</title></channel></rss>`))
+	}))
+	defer feedServer.Close()
+
+	s, m := newTestServer(t)
+	created := call(t, s, "POST", "/api/feeds", `{"url": "`+feedServer.URL+`/feed.xml", `+credentialFields+`}`, http.StatusCreated)
+	assertNoSecrets(t, "POST /api/feeds", created)
+	var f downloader.Feed
+	if err := json.Unmarshal([]byte(created), &f); err != nil {
+		t.Fatal(err)
+	}
+	if !f.HasCredentials {
+		t.Errorf("created feed %s lacks hasCredentials", created)
+	}
+	if f.LastError != "" || sentPassword != "hunter2" {
+		t.Errorf("feed polled with password %q, error %q; want the credentials sent", sentPassword, f.LastError)
+	}
+
+	listed := call(t, s, "GET", "/api/feeds", "", http.StatusOK)
+	assertNoSecrets(t, "GET /api/feeds", listed)
+	if !strings.Contains(listed, `"hasCredentials":true`) {
+		t.Errorf("GET /api/feeds lacks hasCredentials: %s", listed)
+	}
+	assertNoSecrets(t, "GET /api/feeds/{id}", call(t, s, "GET", "/api/feeds/"+f.ID, "", http.StatusOK))
+
+	// The feeds file keeps the credentials, readable only by the server's user
+	info, err := os.Stat(m.FeedsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("feeds file has mode %v, want 0600", perm)
+	}
+	restored := downloader.NewManager(context.Background())
+	restored.FeedsFile = m.FeedsFile
+	if err := restored.LoadFeeds(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := restored.GetFeed(f.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != "alice" || got.Password != "hunter2" || got.Cookie != "session=opaque" ||
+		got.Headers["Authorization"] != "Bearer sekrit" || !got.HasCredentials {
+		t.Errorf("got %+v restored from the feeds file, want the credentials sent", got.Auth)
+	}
+	m.DeleteFeed(f.ID)
+	restored.DeleteFeed(f.ID)
+}
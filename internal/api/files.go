@@ -0,0 +1,129 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/govind1331/Datablip/internal/downloader"
+)
+
+// The file browser distinguishes two roles. The server has no user
+// accounts, so anyone who can reach the API may list and fetch files, the
+// viewer role, while renaming, moving and deleting them takes the editor
+// role: a request carrying "Authorization: Bearer <FilesToken>". Without a
+// FilesToken every client is an editor, like the rest of the API.
+
+// canEditFiles reports whether the request has the editor role.
+func (s *Server) canEditFiles(r *http.Request) bool {
+	if s.FilesToken == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.FilesToken)) == 1
+}
+
+// fileError maps the manager's file errors to status codes.
+func fileError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case os.IsNotExist(err):
+		httpError(w, r, "File not found", http.StatusNotFound)
+	default:
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+	}
+}
+
+type fileList struct {
+	Path  string                 `json:"path"`
+	Files []downloader.FileEntry `json:"files"`
+}
+
+// listFiles lists the directory named by the path query parameter, relative
+// to the downloads directory; it defaults to the directory itself.
+func (s *Server) listFiles(w http.ResponseWriter, r *http.Request) {
+	dir := r.URL.Query().Get("path")
+	files, err := s.manager.ListFiles(dir)
+	if err != nil {
+		fileError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fileList{Path: filepath.ToSlash(filepath.Clean(dir)), Files: files})
+}
+
+// fileContent serves the file named by the path query parameter.
+func (s *Server) fileContent(w http.ResponseWriter, r *http.Request) {
+	file, err := s.manager.OpenFile(r.URL.Query().Get("path"))
+	if err != nil {
+		fileError(w, r, err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		httpError(w, r, "Error opening file", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", info.Name()))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+type fileRequest struct {
+	Path string `json:"path"`
+	Name string `json:"name,omitempty"` // New name, for renames
+	To   string `json:"to,omitempty"`   // Destination directory, for moves
+}
+
+func (s *Server) renameFile(w http.ResponseWriter, r *http.Request) {
+	s.changeFile(w, r, func(req fileRequest) (interface{}, error) {
+		return s.manager.RenameFile(req.Path, req.Name)
+	})
+}
+
+func (s *Server) moveFile(w http.ResponseWriter, r *http.Request) {
+	s.changeFile(w, r, func(req fileRequest) (interface{}, error) {
+		return s.manager.MoveFile(req.Path, req.To)
+	})
+}
+
+// changeFile checks the editor role and runs a rename or move.
+func (s *Server) changeFile(w http.ResponseWriter, r *http.Request, change func(fileRequest) (interface{}, error)) {
+	if !s.canEditFiles(r) {
+		httpError(w, r, "Changing files requires the files token", http.StatusForbidden)
+		return
+	}
+	var req fileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, err := change(req)
+	if err != nil {
+		fileError(w, r, err)
+		return
+	}
+	s.manager.Telemetry.Count("feature.files")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(file)
+}
+
+// deleteFile removes the file named by the path query parameter; recursive=1
+// also removes directories that aren't empty.
+func (s *Server) deleteFile(w http.ResponseWriter, r *http.Request) {
+	if !s.canEditFiles(r) {
+		httpError(w, r, "Deleting files requires the files token", http.StatusForbidden)
+		return
+	}
+	query := r.URL.Query()
+	if err := s.manager.DeleteFile(query.Get("path"), query.Get("recursive") != ""); err != nil {
+		fileError(w, r, err)
+		return
+	}
+	s.manager.Telemetry.Count("feature.files")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/govind1331/Datablip/internal/downloader"
+	"github.com/govind1331/Datablip/internal/urlnorm"
+)
+
+var grabPage = template.Must(template.New("grab").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Datablip</title>
+</head>
+<body style="font-family: sans-serif; margin: 2em">
+<p>Added to Datablip: <strong>{{.Name}}</strong></p>
+<p style="color: #666; word-break: break-all">{{.URL}}</p>
+</body>
+</html>
+`))
+
+// grab queues the url query parameter with default settings. It takes a
+// plain GET so bookmarklets and share shortcuts can call it, and is only
+// served once a grab token has been configured.
+func (s *Server) grab(w http.ResponseWriter, r *http.Request) {
+	if s.GrabToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("token")), []byte(s.GrabToken)) != 1 {
+		httpError(w, r, "Invalid token", http.StatusForbidden)
+		return
+	}
+
+	target, err := url.Parse(query.Get("url"))
+	if err != nil || !urlnorm.Supported(target.Scheme) || target.Host == "" {
+		httpError(w, r, "url must be an http, https, ftp, ftps, s3, gs or az URL", http.StatusBadRequest)
+		return
+	}
+
+	filename := query.Get("filename")
+	if filename == "" {
+		filename = target.Path
+	}
+	filename = grabFilename(filename)
+
+	download, err := s.manager.AddDownload(target.String(), downloader.AddOptions{Filename: filename})
+	if err != nil {
+		code := addError(err)
+		if code == http.StatusBadRequest {
+			code = http.StatusInternalServerError
+		}
+		httpError(w, r, err.Error(), code)
+		return
+	}
+	s.manager.Telemetry.Count("feature.grab")
+
+	_, outputPath, name := download.Output()
+	if name == "" {
+		name = path.Base(outputPath)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	grabPage.Execute(w, struct{ Name, URL string }{name, download.URL})
+}
+
+// grabFilename keeps only the last segment of name, so a shared link can't
+// write outside the downloads directory, or returns "" to let the manager
+// pick a name.
+func grabFilename(name string) string {
+	name = path.Base(name)
+	switch name {
+	case "", ".", "..", "/":
+		return ""
+	}
+	return name
+}
@@ -2,25 +2,68 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/govind1331/Datablip/internal/auth"
 	"github.com/govind1331/Datablip/internal/downloader"
+	"github.com/govind1331/Datablip/internal/metalink"
+	"github.com/govind1331/Datablip/internal/reqauth"
 )
 
+// DefaultWebDir is where the built frontend is served from, relative to the
+// working directory, when the binary was compiled without one.
+const DefaultWebDir = "./web/frontend/build/"
+
 type Server struct {
 	manager *downloader.Manager
 	router  *mux.Router
+
+	// GrabToken must accompany requests to /api/grab; the endpoint is
+	// disabled while it is empty.
+	GrabToken string
+
+	// Auth, if set, checks the credentials of /api requests.
+	Auth *auth.Authenticator
+
+	// FilesToken, if set, is required to rename, move and delete files in
+	// the downloads directory.
+	FilesToken string
+
+	// Web holds the built frontend.
+	Web fs.FS
+
+	// tickets open WebSockets; see AuthorizeWS.
+	tickets *auth.Tickets
+
+	// AllowedOrigins are origins besides the server's own, such as
+	// "http://localhost:5173", whose pages may open WebSockets.
+	AllowedOrigins []string
+
+	// Build, Addr and TLS are reported by /api/server.
+	Build   BuildInfo
+	Addr    string
+	TLS     bool
+	started time.Time
 }
 
 func NewServer(manager *downloader.Manager) *Server {
 	s := &Server{
 		manager: manager,
 		router:  mux.NewRouter(),
+		Web:     os.DirFS(DefaultWebDir),
+		tickets: auth.NewTickets(),
+		started: time.Now(),
 	}
 	s.setupRoutes()
 	return s
@@ -34,13 +77,66 @@ func (s *Server) setupRoutes() {
 	api.HandleFunc("/downloads/{id}", s.getDownload).Methods("GET")
 	api.HandleFunc("/downloads/{id}/pause", s.pauseDownload).Methods("POST")
 	api.HandleFunc("/downloads/{id}/resume", s.resumeDownload).Methods("POST")
+	api.HandleFunc("/downloads/{id}/rate-limit", s.setRateLimit).Methods("PUT")
+	api.HandleFunc("/downloads/{id}/limit", s.setRateLimit).Methods("PATCH")
 	api.HandleFunc("/downloads/{id}/file", s.downloadFile).Methods("GET")
+	api.HandleFunc("/downloads/{id}/extracted", s.extractedFiles).Methods("GET")
+	api.HandleFunc("/downloads/{id}/thumbnail", s.thumbnail).Methods("GET")
+	api.HandleFunc("/downloads/{id}/metalink", s.metalink).Methods("GET")
+	api.HandleFunc("/downloads/{id}/log", s.downloadLog).Methods("GET")
 	api.HandleFunc("/downloads/{id}", s.deleteDownload).Methods("DELETE")
+	api.HandleFunc("/history", s.listHistory).Methods("GET")
+	api.HandleFunc("/history", s.clearHistory).Methods("DELETE")
+	api.HandleFunc("/queue/export", s.exportQueue).Methods("GET")
+	api.HandleFunc("/queue/import", s.importQueue).Methods("POST")
+	api.HandleFunc("/jobs", s.listJobs).Methods("GET")
+	api.HandleFunc("/jobs", s.createJob).Methods("POST")
+	api.HandleFunc("/jobs/{id}", s.getJob).Methods("GET")
+	api.HandleFunc("/jobs/{id}", s.deleteJob).Methods("DELETE")
+	api.HandleFunc("/jobs/{id}/run", s.runJob).Methods("POST")
+	api.HandleFunc("/feeds", s.listFeeds).Methods("GET")
+	api.HandleFunc("/feeds", s.createFeed).Methods("POST")
+	api.HandleFunc("/feeds/{id}", s.getFeed).Methods("GET")
+	api.HandleFunc("/feeds/{id}", s.deleteFeed).Methods("DELETE")
+	api.HandleFunc("/feeds/{id}/poll", s.pollFeed).Methods("POST")
+	api.HandleFunc("/categories", s.listCategories).Methods("GET")
+	api.HandleFunc("/categories/{name}", s.getCategory).Methods("GET")
+	api.HandleFunc("/categories/{name}", s.putCategory).Methods("PUT")
+	api.HandleFunc("/categories/{name}", s.deleteCategory).Methods("DELETE")
+	api.HandleFunc("/archives", s.listArchives).Methods("GET")
+	api.HandleFunc("/archives", s.createArchive).Methods("POST")
+	api.HandleFunc("/archives/{id}", s.getArchive).Methods("GET")
+	api.HandleFunc("/files", s.listFiles).Methods("GET")
+	api.HandleFunc("/files", s.deleteFile).Methods("DELETE")
+	api.HandleFunc("/files/content", s.fileContent).Methods("GET")
+	api.HandleFunc("/files/rename", s.renameFile).Methods("POST")
+	api.HandleFunc("/files/move", s.moveFile).Methods("POST")
+	api.HandleFunc("/grab", s.grab).Methods("GET")
+	api.HandleFunc("/probes", s.listProbes).Methods("GET")
+	api.HandleFunc("/probes", s.forgetProbes).Methods("DELETE")
+	api.HandleFunc("/server", s.serverInfo).Methods("GET")
+	api.HandleFunc("/telemetry", s.telemetry).Methods("GET")
+	api.HandleFunc("/usage", s.usage).Methods("GET")
+	api.HandleFunc("/stats", s.stats).Methods("GET")
+	api.HandleFunc("/stats/hosts", s.hostStats).Methods("GET")
 	api.HandleFunc("/settings", s.getSettings).Methods("GET")
 	api.HandleFunc("/settings", s.updateSettings).Methods("PUT")
+	api.HandleFunc("/settings/speed-limit", s.getSpeedLimit).Methods("GET")
+	api.HandleFunc("/settings/speed-limit", s.setSpeedLimit).Methods("PUT", "PATCH")
+	api.HandleFunc("/login", s.login).Methods("POST")
+	api.HandleFunc("/ws-token", s.wsToken).Methods("POST")
+	api.HandleFunc("/keys", s.listKeys).Methods("GET")
+	api.HandleFunc("/keys", s.createKey).Methods("POST")
+	api.HandleFunc("/keys/{id}", s.deleteKey).Methods("DELETE")
+	api.HandleFunc("/openapi.json", s.openAPIDocument).Methods("GET")
+	api.HandleFunc("/docs", s.apiDocs).Methods("GET")
 
 	// Serve frontend
-	s.router.PathPrefix("/").Handler(http.FileServer(http.Dir("./web/frontend/build/")))
+	s.router.PathPrefix("/").HandlerFunc(s.serveFrontend)
+}
+
+func (s *Server) serveFrontend(w http.ResponseWriter, r *http.Request) {
+	http.FileServer(http.FS(s.Web)).ServeHTTP(w, r)
 }
 
 type CreateDownloadRequest struct {
@@ -49,34 +145,47 @@ type CreateDownloadRequest struct {
 	Chunks         int    `json:"chunks"`
 	ConnectTimeout string `json:"connectTimeout"`
 	ReadTimeout    string `json:"readTimeout"`
+	Checksum       string `json:"checksum,omitempty"`  // algorithm:hex, such as sha256:9f86d081...
+	RateLimit      int64  `json:"rateLimit,omitempty"` // Bytes/s; 0 leaves only the server's limit
+	Category       string `json:"category,omitempty"`  // Saves it in the category's directory, with its defaults
+	Dir            string `json:"dir,omitempty"`       // Saves it here instead; relative to the category's or downloads directory
+	downloader.Retry
+	reqauth.Auth
+	downloader.Delivery
+	DependsOn []string `json:"dependsOn,omitempty"` // IDs of downloads to wait for
+	Mirrors   []string `json:"mirrors,omitempty"`   // More URLs of the same file
+}
+
+// AddOptions returns the settings of the download asked for.
+func (req *CreateDownloadRequest) AddOptions() downloader.AddOptions {
+	return downloader.AddOptions{
+		Mirrors:        req.Mirrors,
+		Filename:       req.Filename,
+		Chunks:         req.Chunks,
+		ConnectTimeout: req.ConnectTimeout,
+		ReadTimeout:    req.ReadTimeout,
+		Checksum:       req.Checksum,
+		RateLimit:      req.RateLimit,
+		Retry:          req.Retry,
+		Auth:           req.Auth,
+		Delivery:       req.Delivery,
+		DependsOn:      req.DependsOn,
+		Category:       req.Category,
+		Dir:            req.Dir,
+	}
 }
 
 func (s *Server) createDownload(w http.ResponseWriter, r *http.Request) {
 	var req CreateDownloadRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Debug logging
-	fmt.Printf("=== CREATE DOWNLOAD REQUEST ===\n")
-	fmt.Printf("URL: %s\n", req.URL)
-	fmt.Printf("Filename: %s\n", req.Filename)
-	fmt.Printf("Chunks: %d\n", req.Chunks)
-	fmt.Printf("ConnectTimeout: %s\n", req.ConnectTimeout)
-	fmt.Printf("ReadTimeout: %s\n", req.ReadTimeout)
-	fmt.Printf("===============================\n")
-
-	download, err := s.manager.AddDownload(
-		req.URL,
-		req.Filename,
-		req.Chunks,
-		req.ConnectTimeout,
-		req.ReadTimeout,
-	)
+	download, err := s.manager.AddDownload(req.URL, req.AddOptions())
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		httpError(w, r, err.Error(), addError(err))
 		return
 	}
 
@@ -84,8 +193,35 @@ func (s *Server) createDownload(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(download)
 }
 
+// addError picks the status for an error from AddDownload or
+// ResumeDownload.
+func addError(err error) int {
+	var duplicate *downloader.DuplicateError
+	if errors.As(err, &duplicate) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, downloader.ErrShuttingDown) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+// listDownloads lists every download, or with ?url= those of one URL
+// however it is spelled, and with ?category= those of one category.
 func (s *Server) listDownloads(w http.ResponseWriter, r *http.Request) {
 	downloads := s.manager.GetAllDownloads()
+	if url := r.URL.Query().Get("url"); url != "" {
+		var err error
+		if downloads, err = s.manager.DownloadsByURL(url); err != nil {
+			httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if category := r.URL.Query().Get("category"); category != "" {
+		downloads = slices.DeleteFunc(downloads, func(d *downloader.Download) bool {
+			return d.Category != category
+		})
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(downloads)
 }
@@ -95,7 +231,7 @@ func (s *Server) getDownload(w http.ResponseWriter, r *http.Request) {
 	download, err := s.manager.GetDownload(vars["id"])
 
 	if err != nil {
-		http.Error(w, "Download not found", http.StatusNotFound)
+		httpError(w, r, "Download not found", http.StatusNotFound)
 		return
 	}
 
@@ -106,7 +242,7 @@ func (s *Server) getDownload(w http.ResponseWriter, r *http.Request) {
 func (s *Server) pauseDownload(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	if err := s.manager.PauseDownload(vars["id"]); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -115,94 +251,281 @@ func (s *Server) pauseDownload(w http.ResponseWriter, r *http.Request) {
 func (s *Server) resumeDownload(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	if err := s.manager.ResumeDownload(vars["id"]); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpError(w, r, err.Error(), addError(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// RateLimitRequest changes a download's rate limit, or the server's.
+type RateLimitRequest struct {
+	RateLimit int64 `json:"rateLimit"` // Bytes/s; 0 removes the limit
+}
+
+func (s *Server) setRateLimit(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var req RateLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.manager.SetDownloadRateLimit(vars["id"], req.RateLimit); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
+// downloadFile serves a download's file, honouring Range requests. While
+// the download is still running, the part written so far is streamed and
+// reads of ranges that haven't arrived yet wait for them, so media can be
+// previewed early. ?inline=1 asks browsers to show the file rather than
+// save it.
 func (s *Server) downloadFile(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	download, err := s.manager.GetDownload(vars["id"])
 
 	if err != nil {
-		http.Error(w, "Download not found", http.StatusNotFound)
+		httpError(w, r, "Download not found", http.StatusNotFound)
 		return
 	}
 
-	if download.Status != "completed" {
-		http.Error(w, "Download not completed yet", http.StatusBadRequest)
+	status, outputPath, filename := download.Output()
+	var content io.ReadSeeker
+	var modified time.Time
+	if status == downloader.StatusCompleted {
+		file, err := os.Open(outputPath)
+		if os.IsNotExist(err) {
+			httpError(w, r, "Downloaded file not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			httpError(w, r, "Error opening file", http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+		if info, err := file.Stat(); err == nil {
+			modified = info.ModTime()
+		}
+		content = file
+	} else {
+		stream, err := s.manager.OpenStream(r.Context(), download.ID)
+		if err != nil {
+			httpError(w, r, printer(r).Sprintf("Download not available yet: %v", err), http.StatusBadRequest)
+			return
+		}
+		defer stream.Close()
+		content = stream
+		s.manager.Telemetry.Count("feature.stream")
+	}
+
+	// Set appropriate headers
+	disposition := "attachment"
+	if r.URL.Query().Get("inline") != "" {
+		disposition = "inline"
+	}
+	name := filepath.Base(filename)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=%s", disposition, name))
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	http.ServeContent(w, r, name, modified, content)
+}
+
+type extractedList struct {
+	ExtractTo string   `json:"extractTo"`
+	Files     []string `json:"files"` // Relative to ExtractTo
+}
+
+// extractedFiles lists what was unpacked from a download's archive.
+func (s *Server) extractedFiles(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := s.manager.GetDownload(vars["id"]); err != nil {
+		httpError(w, r, "Download not found", http.StatusNotFound)
 		return
 	}
+	dir, files, err := s.manager.ExtractedFiles(vars["id"])
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if files == nil {
+		files = []string{} // Nothing unpacked yet
+	}
 
-	// Check if file exists
-	if _, err := os.Stat(download.OutputPath); os.IsNotExist(err) {
-		http.Error(w, "Downloaded file not found", http.StatusNotFound)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(extractedList{ExtractTo: dir, Files: files})
+}
+
+func (s *Server) thumbnail(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	download, err := s.manager.GetDownload(vars["id"])
+	if err != nil || download.Thumbnail == "" {
+		httpError(w, r, "Thumbnail not found", http.StatusNotFound)
 		return
 	}
 
-	// Open the file
-	file, err := os.Open(download.OutputPath)
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeFile(w, r, download.Thumbnail)
+}
+
+func (s *Server) metalink(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	doc, err := s.manager.Metalink(vars["id"])
 	if err != nil {
-		http.Error(w, "Error opening file", http.StatusInternalServerError)
+		httpError(w, r, "Download not found", http.StatusNotFound)
 		return
 	}
-	defer file.Close()
 
-	// Set appropriate headers
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(download.Filename)))
-	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Type", metalink.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.meta4", doc.Files[0].Name))
+	doc.Write(w)
+}
 
-	// Copy file to response
-	_, err = io.Copy(w, file)
+// downloadLog serves the latest lines the engine logged about a download,
+// such as its probe, chunk retries and verification, as plain text.
+func (s *Server) downloadLog(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	lines, err := s.manager.Log(vars["id"])
 	if err != nil {
-		http.Error(w, "Error serving file", http.StatusInternalServerError)
+		httpError(w, r, "Download not found", http.StatusNotFound)
 		return
 	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
 }
 
 func (s *Server) deleteDownload(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	if err := s.manager.DeleteDownload(vars["id"]); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (s *Server) getSettings(w http.ResponseWriter, r *http.Request) {
-	// Return global settings
-	settings := map[string]interface{}{
-		"defaultChunks":          4,
-		"connectTimeout":         "30s",
-		"readTimeout":            "10m",
-		"maxConcurrentDownloads": 3,
+func (s *Server) listHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.manager.History())
+}
+
+// HistoryCleared reports how many finished downloads DELETE /history
+// purged.
+type HistoryCleared struct {
+	Purged int `json:"purged"`
+}
+
+func (s *Server) clearHistory(w http.ResponseWriter, r *http.Request) {
+	deleteFiles := r.URL.Query().Get("deleteFiles") == "true"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HistoryCleared{Purged: s.manager.ClearHistory(deleteFiles)})
+}
+
+func (s *Server) exportQueue(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=datablip-queue.json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(s.manager.ExportQueue())
+}
+
+func (s *Server) importQueue(w http.ResponseWriter, r *http.Request) {
+	var export downloader.QueueExport
+	if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
 	}
+	result, err := s.manager.ImportQueue(export)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.manager.Telemetry.Count("feature.queueImport")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (s *Server) listProbes(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(settings)
+	json.NewEncoder(w).Encode(s.manager.ProbeCache())
+}
+
+// forgetProbes drops the cached probe of the url query parameter, or every
+// cached probe without one.
+func (s *Server) forgetProbes(w http.ResponseWriter, r *http.Request) {
+	s.manager.ForgetProbe(r.URL.Query().Get("url"))
+	w.WriteHeader(http.StatusNoContent)
 }
 
+func (s *Server) getSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.manager.Settings())
+}
+
+// updateSettings applies the settings it is given, all or none of them,
+// and saves them so they survive a restart.
 func (s *Server) updateSettings(w http.ResponseWriter, r *http.Request) {
-	// Update global settings
-	var settings map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var update downloader.SettingsUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := update.Validate(); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.manager.UpdateSettings(update); err != nil {
+		httpError(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.manager.Settings())
+}
+
+// getSpeedLimit returns the cap on the combined speed of every download,
+// as a RateLimitRequest.
+func (s *Server) getSpeedLimit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RateLimitRequest{RateLimit: s.manager.RateLimit()})
+}
+
+// setSpeedLimit changes the cap on the combined speed of every download.
+// Running downloads slow down or speed up right away.
+func (s *Server) setSpeedLimit(w http.ResponseWriter, r *http.Request) {
+	var req RateLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.RateLimit < 0 {
+		httpError(w, r, "rateLimit must be a whole number of bytes/s, 0 for none", http.StatusBadRequest)
+		return
+	}
+	s.manager.SetRateLimit(req.RateLimit)
+	s.getSpeedLimit(w, r)
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Enable CORS for development
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+KeyHeader)
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+	if strings.HasPrefix(r.URL.Path, "/api/") && !publicRoutes[r.URL.Path] && !s.authorize(w, r, credential(r)) {
+		return
+	}
 
 	s.router.ServeHTTP(w, r)
 }
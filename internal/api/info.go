@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/directio"
+	"github.com/govind1331/Datablip/internal/diskspace"
+	"github.com/govind1331/Datablip/internal/downloader"
+	"github.com/govind1331/Datablip/internal/media"
+)
+
+// BuildInfo identifies the server binary. The fields are set by the build
+// system; whatever it leaves unset is filled in from the Go build info.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+type serverInfo struct {
+	BuildInfo
+	StartedAt     time.Time        `json:"startedAt"`
+	Uptime        string           `json:"uptime"`
+	UptimeSeconds int64            `json:"uptimeSeconds"`
+	ListenAddress string           `json:"listenAddress"`
+	DownloadsDir  string           `json:"downloadsDir"`
+	Disk          *diskspace.Usage `json:"disk,omitempty"`
+	DiskError     string           `json:"diskError,omitempty"`
+	Features      serverFeatures   `json:"features"`
+	Limits        serverLimits     `json:"limits"`
+}
+
+type serverFeatures struct {
+	WriteMode       downloader.WriteMode `json:"writeMode"`
+	ChunkFiles      bool                 `json:"chunkFiles"`
+	DirectIO        bool                 `json:"directIO"`
+	Endgame         bool                 `json:"endgame"`
+	StallRestarts   bool                 `json:"stallRestarts"`
+	Scanning        bool                 `json:"scanning"`
+	Routing         bool                 `json:"routing"`
+	MediaPriority   int64                `json:"mediaPriority"` // Bytes at each end, 0 when off
+	MediaInfo       bool                 `json:"mediaInfo"`     // ffprobe is installed
+	Auth            bool                 `json:"auth"`          // Requests need credentials
+	TLS             bool                 `json:"tls"`           // Served over HTTPS
+	Grab            bool                 `json:"grab"`
+	FilesToken      bool                 `json:"filesToken"` // Editing files needs a token
+	Jobs            int                  `json:"jobs"`
+	Feeds           int                  `json:"feeds"`
+	Webhooks        int                  `json:"webhooks"`
+	Telemetry       bool                 `json:"telemetry"` // Usage reports are sent
+	ProbeCacheTTL   string               `json:"probeCacheTTL"`
+	AutoConnections bool                 `json:"autoConnections"` // Chunk counts follow host statistics
+}
+
+type serverLimits struct {
+	Workers               int     `json:"workers"`
+	MaxConnsPerHost       int     `json:"maxConnsPerHost"`
+	DefaultConnectTimeout string  `json:"defaultConnectTimeout"`
+	DefaultReadTimeout    string  `json:"defaultReadTimeout"`
+	StallSpeed            float64 `json:"stallSpeed"` // Bytes/s
+	StallTime             string  `json:"stallTime"`
+	UploadRetries         int     `json:"uploadRetries"`
+	MinMonitorInterval    string  `json:"minMonitorInterval"`
+	MonthlyCap            int64   `json:"monthlyCap"` // Bytes, 0 when there is none
+	HostDelay             string  `json:"hostDelay"`  // Between requests to one host
+}
+
+// fill completes the build info from what the Go toolchain embedded.
+func (b BuildInfo) fill() BuildInfo {
+	b.GoVersion = runtime.Version()
+	b.Platform = runtime.GOOS + "/" + runtime.GOARCH
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	if b.Version == "" || b.Version == "dev" {
+		if v := info.Main.Version; v != "" && v != "(devel)" {
+			b.Version = v
+		}
+	}
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && (b.Commit == "" || b.Commit == "unknown"):
+			b.Commit = setting.Value
+		case setting.Key == "vcs.time" && (b.BuildTime == "" || b.BuildTime == "unknown"):
+			b.BuildTime = setting.Value
+		}
+	}
+	return b
+}
+
+// serverInfo describes the server for the UI and for support requests.
+func (s *Server) serverInfo(w http.ResponseWriter, r *http.Request) {
+	m := s.manager
+	settings := m.Settings()
+	uptime := time.Since(s.started)
+	info := serverInfo{
+		BuildInfo:     s.Build.fill(),
+		StartedAt:     s.started,
+		Uptime:        uptime.Round(time.Second).String(),
+		UptimeSeconds: int64(uptime.Seconds()),
+		ListenAddress: s.Addr,
+		DownloadsDir:  s.manager.DownloadsDir(),
+		Features: serverFeatures{
+			WriteMode:       m.WriteMode,
+			ChunkFiles:      m.ChunkFiles,
+			DirectIO:        m.DirectIO && directio.Supported,
+			Endgame:         m.Endgame,
+			StallRestarts:   m.StallSpeed > 0,
+			Scanning:        m.Scanner != nil,
+			Routing:         len(m.Routes) > 0,
+			MediaPriority:   m.MediaPriority,
+			MediaInfo:       media.Available(),
+			Auth:            s.Auth.Enabled(),
+			TLS:             s.TLS,
+			Grab:            s.GrabToken != "",
+			FilesToken:      s.FilesToken != "",
+			Jobs:            len(m.Jobs()),
+			Feeds:           len(m.Feeds()),
+			Webhooks:        len(m.Webhooks),
+			Telemetry:       m.Telemetry != nil && m.Telemetry.URL != "",
+			ProbeCacheTTL:   m.ProbeCache().TTL,
+			AutoConnections: m.AutoConnections,
+		},
+		Limits: serverLimits{
+			Workers:               m.Workers(),
+			MaxConnsPerHost:       downloader.MaxConnsPerHost,
+			DefaultConnectTimeout: settings.ConnectTimeout,
+			DefaultReadTimeout:    settings.ReadTimeout,
+			StallSpeed:            m.StallSpeed,
+			StallTime:             m.StallTime.String(),
+			UploadRetries:         m.UploadRetries,
+			MinMonitorInterval:    downloader.MinMonitorInterval.String(),
+			MonthlyCap:            m.MonthlyCap(),
+			HostDelay:             m.HostDelay().String(),
+		},
+	}
+	if dir, err := filepath.Abs(s.manager.DownloadsDir()); err == nil {
+		info.DownloadsDir = dir
+	}
+	// The directory only exists once something was downloaded; its file
+	// system is then the working directory's
+	disk, err := diskspace.Get(info.DownloadsDir)
+	if err != nil {
+		disk, err = diskspace.Get(".")
+	}
+	if err != nil {
+		info.DiskError = err.Error()
+	} else {
+		info.Disk = &disk
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// telemetry shows whether usage reports are sent and exactly what the next
+// one holds, so operators can check before opting in.
+func (s *Server) telemetry(w http.ResponseWriter, r *http.Request) {
+	if s.manager.Telemetry == nil {
+		httpError(w, r, "Telemetry is not set up", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.manager.Telemetry.Status())
+}
+
+// usage reports the bandwidth downloaded this month and in earlier ones,
+// against the monthly cap.
+func (s *Server) usage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.manager.Usage())
+}
+
+// stats reports what was downloaded per day, host and category, totals and
+// averages, and the combined speed over the last hour.
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	days := downloader.DefaultStatsDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 366 {
+			httpError(w, r, "days must be a number from 1 to 366", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.manager.Stats(days))
+}
+
+// hostStats reports the throughput measured per host and connection count,
+// and the connections recommended for each host.
+func (s *Server) hostStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.manager.HostStats())
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/govind1331/Datablip/internal/downloader"
+	"github.com/govind1331/Datablip/internal/reqauth"
+)
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.manager.Jobs())
+}
+
+// createJobRequest is a job's settings with the credentials the job's own
+// JSON leaves out.
+type createJobRequest struct {
+	downloader.Job
+	reqauth.Auth
+}
+
+func (s *Server) createJob(w http.ResponseWriter, r *http.Request) {
+	var req createJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	settings := req.Job
+	settings.Auth = req.Auth
+	job, err := s.manager.AddJob(settings)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.manager.Telemetry.Count("feature.jobs")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.manager.GetJob(mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func (s *Server) deleteJob(w http.ResponseWriter, r *http.Request) {
+	if err := s.manager.DeleteJob(mux.Vars(r)["id"]); err != nil {
+		httpError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runJob starts a run of the job right away and returns its download.
+func (s *Server) runJob(w http.ResponseWriter, r *http.Request) {
+	download, err := s.manager.RunJob(mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(download)
+}
+
+type createArchiveRequest struct {
+	Name          string   `json:"name"`
+	Downloads     []string `json:"downloads"`
+	RemoveSources bool     `json:"removeSources"`
+}
+
+func (s *Server) listArchives(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.manager.Archives())
+}
+
+// createArchive packs downloads into one archive once they have finished.
+func (s *Server) createArchive(w http.ResponseWriter, r *http.Request) {
+	var req createArchiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	archive, err := s.manager.AddArchive(req.Name, req.Downloads, req.RemoveSources)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.manager.Telemetry.Count("feature.archive")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(archive)
+}
+
+func (s *Server) getArchive(w http.ResponseWriter, r *http.Request) {
+	archive, err := s.manager.GetArchive(mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(archive)
+}
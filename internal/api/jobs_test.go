@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/govind1331/Datablip/internal/downloader"
+)
+
+// secrets are credentials a test sends, none of which may come back.
+var secrets = []string{"hunter2", "session=opaque", "Bearer sekrit"}
+
+const credentialFields = `"username": "alice", "password": "hunter2",
+	"cookie": "session=opaque", "headers": {"Authorization": "Bearer sekrit"}`
+
+// newTestServer returns an API server whose manager keeps its files in a
+// temporary directory.
+func newTestServer(t *testing.T) (*Server, *downloader.Manager) {
+	dir := t.TempDir()
+	m := downloader.NewManager(context.Background())
+	m.StatsFile, m.UsageFile, m.HostStatsFile = "", "", ""
+	m.JobsFile = filepath.Join(dir, "jobs.json")
+	m.FeedsFile = filepath.Join(dir, "feeds.json")
+	m.CategoriesFile = ""
+	return NewServer(m), m
+}
+
+// call sends a request to s and returns the response body, failing the
+// test unless the status is want.
+func call(t *testing.T, s *Server, method, path, body string, want int) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	if rec.Code != want {
+		t.Fatalf("%s %s: got %d %s, want %d", method, path, rec.Code, rec.Body, want)
+	}
+	return rec.Body.String()
+}
+
+// assertNoSecrets fails the test if what holds any of the credentials sent.
+func assertNoSecrets(t *testing.T, name, what string) {
+	t.Helper()
+	for _, secret := range secrets {
+		if strings.Contains(what, secret) {
+			t.Errorf("%s holds %q: %s", name, secret, what)
+		}
+	}
+}
+
+func TestJobCredentialsNotListed(t *testing.T) {
+	s, m := newTestServer(t)
+
+	created := call(t, s, "POST", "/api/jobs", `{"url": "https://db.example.com/dump.sql.gz",
+		"schedule": "0 3 * * *", `+credentialFields+`}`, http.StatusCreated)
+	assertNoSecrets(t, "POST /api/jobs", created)
+	var job downloader.Job
+	if err := json.Unmarshal([]byte(created), &job); err != nil {
+		t.Fatal(err)
+	}
+	if !job.HasCredentials {
+		t.Errorf("created job %s lacks hasCredentials", created)
+	}
+
+	listed := call(t, s, "GET", "/api/jobs", "", http.StatusOK)
+	assertNoSecrets(t, "GET /api/jobs", listed)
+	if !strings.Contains(listed, `"hasCredentials":true`) {
+		t.Errorf("GET /api/jobs lacks hasCredentials: %s", listed)
+	}
+	assertNoSecrets(t, "GET /api/jobs/{id}", call(t, s, "GET", "/api/jobs/"+job.ID, "", http.StatusOK))
+
+	// The jobs file keeps the credentials, readable only by the server's user
+	info, err := os.Stat(m.JobsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("jobs file has mode %v, want 0600", perm)
+	}
+	restored := downloader.NewManager(context.Background())
+	restored.JobsFile = m.JobsFile
+	if err := restored.LoadJobs(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := restored.GetJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != "alice" || got.Password != "hunter2" || got.Cookie != "session=opaque" ||
+		got.Headers["Authorization"] != "Bearer sekrit" || !got.HasCredentials {
+		t.Errorf("got %+v restored from the jobs file, want the credentials sent", got.Auth)
+	}
+	m.DeleteJob(job.ID)
+	restored.DeleteJob(job.ID)
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/govind1331/Datablip/internal/i18n"
+)
+
+// printer translates messages into the language the request's
+// Accept-Language header prefers.
+func printer(r *http.Request) *i18n.Printer {
+	return i18n.New(i18n.Match(r.Header.Get("Accept-Language")))
+}
+
+// httpError is http.Error with the message translated for the request.
+// Error strings from the manager are translated too when they are fixed
+// messages such as "download not found".
+func httpError(w http.ResponseWriter, r *http.Request, message string, code int) {
+	p := printer(r)
+	w.Header().Set("Content-Language", p.Lang())
+	http.Error(w, p.Text(message), code)
+}
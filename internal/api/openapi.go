@@ -0,0 +1,308 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/govind1331/Datablip/internal/auth"
+	"github.com/govind1331/Datablip/internal/digest"
+	"github.com/govind1331/Datablip/internal/diskspace"
+	"github.com/govind1331/Datablip/internal/downloader"
+	"github.com/govind1331/Datablip/internal/hoststats"
+	"github.com/govind1331/Datablip/internal/media"
+	"github.com/govind1331/Datablip/internal/mirror"
+	"github.com/govind1331/Datablip/internal/openapi"
+	"github.com/govind1331/Datablip/internal/probecache"
+	"github.com/govind1331/Datablip/internal/telemetry"
+)
+
+// operation documents a route. Request and Response are values, or nil
+// pointers, of the types the handler decodes and encodes.
+type operation struct {
+	Summary  string
+	Tag      string
+	Query    []openapi.Parameter
+	Request  any
+	Response any
+	Status   int    // Of a successful response, 200 when unset
+	Content  string // Type of a response that isn't JSON
+	Files    bool   // Needs the files token, when one is set
+	Public   bool   // Served without credentials
+}
+
+func query(name, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: openapi.Text()}
+}
+
+// operations documents the routes of setupRoutes by method and path below
+// /api. Routes missing here are still listed, without a description.
+var operations = map[string]operation{
+	"GET /downloads": {
+		Summary:  "List downloads",
+		Tag:      "downloads",
+		Query:    []openapi.Parameter{query("url", "Only downloads of this URL, however it is spelled"), query("category", "Only downloads added to this category")},
+		Response: []*downloader.Download{},
+	},
+	"POST /downloads": {
+		Summary:  "Add a download",
+		Tag:      "downloads",
+		Request:  (*CreateDownloadRequest)(nil),
+		Response: (*downloader.Download)(nil),
+	},
+	"GET /downloads/{id}":         {Summary: "Get a download", Tag: "downloads", Response: (*downloader.Download)(nil)},
+	"DELETE /downloads/{id}":      {Summary: "Remove a download and its partial data", Tag: "downloads", Status: http.StatusNoContent},
+	"POST /downloads/{id}/pause":  {Summary: "Pause a download", Tag: "downloads"},
+	"POST /downloads/{id}/resume": {Summary: "Resume a paused download from where its chunks stopped", Tag: "downloads"},
+	"PUT /downloads/{id}/rate-limit": {
+		Summary: "Set a download's speed limit",
+		Tag:     "downloads",
+		Request: (*RateLimitRequest)(nil),
+	},
+	"PATCH /downloads/{id}/limit": {
+		Summary: "Set a download's speed limit",
+		Tag:     "downloads",
+		Request: (*RateLimitRequest)(nil),
+	},
+	"GET /downloads/{id}/file": {
+		Summary: "Fetch a download's file, with Range support, while it is still downloading too",
+		Tag:     "downloads",
+		Query:   []openapi.Parameter{query("inline", "Any value asks browsers to show the file rather than save it")},
+		Content: "application/octet-stream",
+	},
+	"GET /downloads/{id}/extracted": {
+		Summary:  "List the files unpacked from a download's archive",
+		Tag:      "downloads",
+		Response: (*extractedList)(nil),
+	},
+	"GET /downloads/{id}/thumbnail": {Summary: "Fetch a download's preview image", Tag: "downloads", Content: "image/jpeg"},
+	"GET /downloads/{id}/metalink":  {Summary: "Export a download as a Metalink", Tag: "downloads", Content: "application/metalink4+xml"},
+	"GET /downloads/{id}/log":       {Summary: "Fetch the latest lines logged about a download", Tag: "downloads", Content: "text/plain"},
+
+	"GET /queue/export": {Summary: "Export every download", Tag: "queue", Response: (*downloader.QueueExport)(nil)},
+	"POST /queue/import": {
+		Summary:  "Add the downloads of an export",
+		Tag:      "queue",
+		Request:  (*downloader.QueueExport)(nil),
+		Response: (*downloader.QueueImport)(nil),
+	},
+
+	"GET /history": {Summary: "List finished downloads, latest to finish first", Tag: "downloads", Response: []*downloader.Download{}},
+	"DELETE /history": {
+		Summary:  "Remove every finished download from the list",
+		Tag:      "downloads",
+		Query:    []openapi.Parameter{query("deleteFiles", "\"true\" deletes their files too")},
+		Response: (*HistoryCleared)(nil),
+	},
+
+	"GET /jobs":                   {Summary: "List recurring jobs", Tag: "jobs", Response: []downloader.Job{}},
+	"POST /jobs":                  {Summary: "Add a recurring job", Tag: "jobs", Request: (*downloader.Job)(nil), Response: (*downloader.Job)(nil), Status: http.StatusCreated},
+	"GET /jobs/{id}":              {Summary: "Get a recurring job", Tag: "jobs", Response: (*downloader.Job)(nil)},
+	"DELETE /jobs/{id}":           {Summary: "Remove a recurring job", Tag: "jobs", Status: http.StatusNoContent},
+	"POST /jobs/{id}/run":         {Summary: "Run a job now", Tag: "jobs", Response: (*downloader.Download)(nil)},
+	"GET /feeds":                  {Summary: "List watched feeds", Tag: "feeds", Response: []downloader.Feed{}},
+	"POST /feeds":                 {Summary: "Watch a feed", Tag: "feeds", Request: (*downloader.Feed)(nil), Response: (*downloader.Feed)(nil), Status: http.StatusCreated},
+	"GET /feeds/{id}":             {Summary: "Get a watched feed", Tag: "feeds", Response: (*downloader.Feed)(nil)},
+	"DELETE /feeds/{id}":          {Summary: "Stop watching a feed", Tag: "feeds", Status: http.StatusNoContent},
+	"POST /feeds/{id}/poll":       {Summary: "Poll a feed now", Tag: "feeds", Response: (*downloader.Feed)(nil)},
+	"GET /categories":             {Summary: "List categories", Tag: "categories", Response: []downloader.Category{}},
+	"GET /categories/{name}":      {Summary: "Get a category", Tag: "categories", Response: (*downloader.Category)(nil)},
+	"PUT /categories/{name}":      {Summary: "Add or replace a category", Tag: "categories", Request: (*downloader.Category)(nil), Response: (*downloader.Category)(nil)},
+	"DELETE /categories/{name}":   {Summary: "Remove a category; its downloads are left alone", Tag: "categories", Status: http.StatusNoContent},
+	"GET /archives":               {Summary: "List archives", Tag: "archives", Response: []downloader.Archive{}},
+	"POST /archives":              {Summary: "Pack downloads into an archive once they finish", Tag: "archives", Request: (*createArchiveRequest)(nil), Response: (*downloader.Archive)(nil), Status: http.StatusCreated},
+	"GET /archives/{id}":          {Summary: "Get an archive", Tag: "archives", Response: (*downloader.Archive)(nil)},
+	"GET /files":                  {Summary: "List a directory of the downloads directory", Tag: "files", Query: []openapi.Parameter{query("path", "Relative to the downloads directory")}, Response: (*fileList)(nil)},
+	"GET /files/content":          {Summary: "Fetch a file of the downloads directory", Tag: "files", Query: []openapi.Parameter{query("path", "Relative to the downloads directory")}, Content: "application/octet-stream"},
+	"POST /files/rename":          {Summary: "Rename a file", Tag: "files", Request: (*fileRequest)(nil), Response: (*downloader.FileEntry)(nil), Files: true},
+	"POST /files/move":            {Summary: "Move a file to another directory", Tag: "files", Request: (*fileRequest)(nil), Response: (*downloader.FileEntry)(nil), Files: true},
+	"DELETE /files":               {Summary: "Delete a file", Tag: "files", Query: []openapi.Parameter{query("path", "Relative to the downloads directory"), query("recursive", "Any value also deletes directories that aren't empty")}, Status: http.StatusNoContent, Files: true},
+	"GET /grab":                   {Summary: "Add a download from a bookmarklet or share shortcut", Tag: "downloads", Query: []openapi.Parameter{query("token", "The server's grab token"), query("url", "What to download"), query("filename", "Name to save it under")}, Content: "text/html"},
+	"GET /probes":                 {Summary: "List cached probe results", Tag: "server", Response: (*probecache.Stats)(nil)},
+	"DELETE /probes":              {Summary: "Forget cached probe results", Tag: "server", Query: []openapi.Parameter{query("url", "Only this URL's")}, Status: http.StatusNoContent},
+	"GET /server":                 {Summary: "Describe the server", Tag: "server", Response: (*serverInfo)(nil)},
+	"GET /telemetry":              {Summary: "Show whether usage reports are sent and the next one", Tag: "server", Response: (*telemetry.Status)(nil)},
+	"GET /usage":                  {Summary: "Report this month's bandwidth and earlier months'", Tag: "server", Response: (*downloader.Usage)(nil)},
+	"GET /stats":                  {Summary: "Report bytes downloaded per day, host and category, totals, averages and the last hour's speed", Tag: "server", Query: []openapi.Parameter{query("days", "How many days of bytes per day, up to 366; 30 by default")}, Response: (*downloader.Stats)(nil)},
+	"GET /stats/hosts":            {Summary: "Report throughput per host and connection count", Tag: "server", Response: []hoststats.Host{}},
+	"GET /settings":               {Summary: "Get global settings", Tag: "settings", Response: (*downloader.Settings)(nil)},
+	"PUT /settings":               {Summary: "Change and save global settings", Tag: "settings", Request: (*downloader.SettingsUpdate)(nil), Response: (*downloader.Settings)(nil)},
+	"GET /settings/speed-limit":   {Summary: "Get the server's speed limit", Tag: "settings", Response: (*RateLimitRequest)(nil)},
+	"PUT /settings/speed-limit":   {Summary: "Set the server's speed limit", Tag: "settings", Request: (*RateLimitRequest)(nil), Response: (*RateLimitRequest)(nil)},
+	"PATCH /settings/speed-limit": {Summary: "Set the server's speed limit", Tag: "settings", Request: (*RateLimitRequest)(nil), Response: (*RateLimitRequest)(nil)},
+	"GET /openapi.json":           {Summary: "This document", Tag: "server", Content: "application/json", Public: true},
+	"GET /docs":                   {Summary: "Browse this document with Swagger UI", Tag: "server", Content: "text/html", Public: true},
+	"POST /login":                 {Summary: "Trade the server's password for a session token", Tag: "auth", Request: (*loginRequest)(nil), Response: (*loginResponse)(nil), Public: true},
+	"POST /ws-token":              {Summary: "Get a ticket that opens one WebSocket within 30 seconds", Tag: "auth", Response: (*ticketResponse)(nil)},
+	"GET /keys":                   {Summary: "List API keys", Tag: "auth", Response: []auth.Key{}},
+	"POST /keys":                  {Summary: "Create an API key, returned with its secret only this once", Tag: "auth", Request: (*createKeyRequest)(nil), Response: (*createdKey)(nil), Status: http.StatusCreated},
+	"DELETE /keys/{id}":           {Summary: "Revoke an API key", Tag: "auth", Status: http.StatusNoContent},
+}
+
+var pathParam = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// openAPI describes every route of the API.
+func (s *Server) openAPI() *openapi.Document {
+	gen := openapi.NewGenerator()
+	gen.Enum(downloader.DownloadStatus(""),
+		string(downloader.StatusQueued), string(downloader.StatusWaiting), string(downloader.StatusDownloading),
+		string(downloader.StatusPaused), string(downloader.StatusUploading), string(downloader.StatusMoving),
+		string(downloader.StatusScanning), string(downloader.StatusExtracting), string(downloader.StatusCompressing),
+		string(downloader.StatusCompleted), string(downloader.StatusError), string(downloader.StatusQuarantined),
+		string(downloader.StatusChecksumMismatch))
+	gen.Enum(downloader.WriteMode(""), string(downloader.WriteModeWriteAt), string(downloader.WriteModeMmap))
+	gen.Name((*downloader.Usage)(nil), "MonthlyUsage")
+	gen.Name((*diskspace.Usage)(nil), "DiskUsage")
+	gen.Name((*mirror.Stats)(nil), "MirrorStats")
+	gen.Name((*probecache.Stats)(nil), "ProbeCacheStats")
+	gen.Name((*probecache.Entry)(nil), "ProbeCacheEntry")
+	gen.Name((*telemetry.Status)(nil), "TelemetryStatus")
+	gen.Name((*telemetry.Report)(nil), "TelemetryReport")
+	gen.Name((*media.Info)(nil), "MediaInfo")
+	gen.Name((*digest.Result)(nil), "Verification")
+	gen.Name((*hoststats.Level)(nil), "HostLevel")
+
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Datablip",
+			Description: "Errors are plain text, translated for the Accept-Language header. Once the server has an API key or password, requests need an API key or session token.",
+			Version:     s.Build.fill().Version,
+		},
+		Paths: make(map[string]openapi.PathItem),
+		Components: openapi.Components{
+			SecuritySchemes: map[string]openapi.SecurityScheme{
+				"apiKey":     {Type: "apiKey", In: "header", Name: KeyHeader, Description: "An API key or session token"},
+				"bearer":     {Type: "http", Scheme: "bearer", Description: "An API key or session token"},
+				"filesToken": {Type: "http", Scheme: "bearer", Description: "The files token, when the server has one"},
+			},
+		},
+		Security: []map[string][]string{{"apiKey": {}}, {"bearer": {}}},
+	}
+
+	s.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // The frontend
+		}
+		path := pathParam.ReplaceAllString(template, "{$1}")
+		for _, method := range methods {
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = make(openapi.PathItem)
+			}
+			doc.Paths[path][strings.ToLower(method)] = s.describe(gen, method, path)
+		}
+		return nil
+	})
+	doc.Paths["/ws"] = openapi.PathItem{"get": {
+		Summary:     "Receive download updates over a WebSocket",
+		Description: "Needs a ticket from POST /api/ws-token, in the ticket parameter or as the first message, {\"type\": \"auth\", \"ticket\": \"...\"}, sent within 10 seconds; once authentication is on, valid credentials in the headers do too. Each message is a DownloadUpdate. Its data is a ProgressUpdate for progress updates, the Archive for archive updates, and the Download for the rest. Sending {\"type\": \"subscribe\", \"downloads\": [...], \"types\": [...]} narrows them to those downloads and types; an empty list doesn't narrow. Commands, {\"type\": \"add\" | \"pause\" | \"resume\" | \"cancel\" | \"setLimit\", \"id\": \"...\", \"downloadId\": \"...\", \"rateLimit\": 0, \"download\": {...}}, are each answered with {\"type\": \"ack\", \"id\": \"...\", \"ok\": true}, or with an error.",
+		OperationID: "getWs",
+		Tags:        []string{"downloads"},
+		Parameters:  []openapi.Parameter{query("ticket", "A ticket from POST /api/ws-token"), query("since", "The seq of the last update received; the updates after it are sent first, or a resync update if they are no longer all kept")},
+		Responses:   map[string]openapi.Response{"101": {Description: "Switching to the WebSocket protocol"}},
+	}}
+	gen.Schema((*downloader.DownloadUpdate)(nil))
+	gen.Schema((*downloader.ProgressUpdate)(nil))
+
+	doc.Components.Schemas = gen.Schemas()
+	return doc
+}
+
+// describe documents the route of method and path, a full path under /api.
+func (s *Server) describe(gen *openapi.Generator, method, path string) *openapi.Operation {
+	op := operations[method+" "+strings.TrimPrefix(path, "/api")]
+	described := &openapi.Operation{
+		Summary:     op.Summary,
+		OperationID: operationID(method, path),
+		Responses: map[string]openapi.Response{
+			"default": {Description: "Error", Content: map[string]openapi.MediaType{"text/plain": {Schema: openapi.Text()}}},
+		},
+	}
+	if op.Tag != "" {
+		described.Tags = []string{op.Tag}
+	}
+	for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+		described.Parameters = append(described.Parameters, openapi.Parameter{
+			Name: match[1], In: "path", Required: true, Schema: openapi.Text(),
+		})
+	}
+	described.Parameters = append(described.Parameters, op.Query...)
+	if op.Request != nil {
+		described.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JSON(gen.Schema(op.Request))}
+	}
+	switch {
+	case op.Public:
+		described.Security = []map[string][]string{{}}
+	case op.Files:
+		described.Security = []map[string][]string{{"apiKey": {}, "filesToken": {}}}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := openapi.Response{Description: http.StatusText(status)}
+	switch {
+	case op.Response != nil:
+		response.Content = openapi.JSON(gen.Schema(op.Response))
+	case op.Content != "":
+		response.Content = map[string]openapi.MediaType{op.Content: {}}
+	}
+	described.Responses[strconv.Itoa(status)] = response
+	return described
+}
+
+// operationID names an operation for generated clients, such as
+// "postDownloadsIdPause".
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '-' || r == '.' }) {
+		part = strings.Trim(part, "{}")
+		if part == "api" || part == "" {
+			continue
+		}
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// swaggerUI is a page that loads Swagger UI from a CDN and points it at
+// the document.
+const swaggerUI = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Datablip API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`
+
+func (s *Server) apiDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, swaggerUI)
+}
+
+func (s *Server) openAPIDocument(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(s.openAPI())
+}
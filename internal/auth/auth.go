@@ -0,0 +1,76 @@
+// Package auth guards the server's API. Clients present either an API key,
+// the static one from the configuration or one created at runtime, or a
+// session token from logging in with the server's password. Session tokens
+// are JSON Web Tokens signed with HMAC-SHA256. Secrets are compared in
+// constant time throughout.
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoCredential is returned for requests without a key or token.
+	ErrNoCredential = errors.New("authentication required")
+	// ErrInvalidCredential is returned for a key or token that isn't valid.
+	ErrInvalidCredential = errors.New("invalid credentials")
+	// ErrNoLogin is returned by Login when the server has no password.
+	ErrNoLogin = errors.New("logins are not enabled")
+	// ErrWrongPassword is returned by Login for a wrong password.
+	ErrWrongPassword = errors.New("wrong password")
+)
+
+// Authenticator checks credentials. Authentication is on once there is a
+// static key, a password or a created key.
+type Authenticator struct {
+	APIKey   string // Static key, from the configuration
+	Password string // Enables logins
+	Keys     *Keys
+	Sessions *Sessions
+}
+
+// Enabled reports whether requests must carry credentials.
+func (a *Authenticator) Enabled() bool {
+	return a != nil && (a.APIKey != "" || a.Password != "" || a.Keys.Len() > 0)
+}
+
+// Check returns who credential, an API key or session token, belongs to.
+func (a *Authenticator) Check(credential string) (string, error) {
+	if credential == "" {
+		return "", ErrNoCredential
+	}
+	if a.APIKey != "" && equal(credential, a.APIKey) {
+		return "key:static", nil
+	}
+	if key, ok := a.Keys.Check(credential); ok {
+		return "key:" + key.Name, nil
+	}
+	if strings.Count(credential, ".") == 2 {
+		if claims, err := a.Sessions.Verify(credential); err == nil {
+			return "session:" + claims.Subject, nil
+		}
+	}
+	return "", ErrInvalidCredential
+}
+
+// Login returns a session token for the right password.
+func (a *Authenticator) Login(password string) (string, time.Time, error) {
+	if a.Password == "" {
+		return "", time.Time{}, ErrNoLogin
+	}
+	if !equal(password, a.Password) {
+		return "", time.Time{}, ErrWrongPassword
+	}
+	return a.Sessions.Issue("admin")
+}
+
+// equal compares secrets in constant time. Hashing them first keeps their
+// lengths from showing either.
+func equal(a, b string) bool {
+	x, y := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(x[:], y[:]) == 1
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// DefaultSessionTTL is how long a session token from a login is valid.
+const DefaultSessionTTL = 24 * time.Hour
+
+var errInvalidToken = errors.New("invalid token")
+
+// jwtHeader is the only header tokens are issued with and accepted with:
+// HS256, so a token naming another algorithm, or none, is refused.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims are what a session token holds.
+type Claims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Sessions issues and verifies JSON Web Tokens signed with HMAC-SHA256.
+type Sessions struct {
+	secret []byte
+	TTL    time.Duration
+}
+
+// NewSessions signs tokens with secret, or with a random one when it is
+// empty, which ends every session when the server restarts.
+func NewSessions(secret string) (*Sessions, error) {
+	if secret == "" {
+		random, err := randomString(32)
+		if err != nil {
+			return nil, err
+		}
+		secret = random
+	}
+	return &Sessions{secret: []byte(secret), TTL: DefaultSessionTTL}, nil
+}
+
+// Issue returns a token for subject that expires after the TTL.
+func (s *Sessions) Issue(subject string) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(s.TTL)
+	payload, err := json.Marshal(Claims{Subject: subject, IssuedAt: now.Unix(), ExpiresAt: expires.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + s.sign(unsigned), expires, nil
+}
+
+// Verify checks the signature and expiry of token and returns its claims.
+func (s *Sessions) Verify(token string) (Claims, error) {
+	header, rest, ok := strings.Cut(token, ".")
+	if !ok || header != jwtHeader {
+		return Claims{}, errInvalidToken
+	}
+	payload, signature, ok := strings.Cut(rest, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(header+"."+payload))) {
+		return Claims{}, errInvalidToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Claims{}, errInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return Claims{}, errInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return Claims{}, errors.New("token expired")
+	}
+	return claims, nil
+}
+
+func (s *Sessions) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
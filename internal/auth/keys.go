@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultKeysFile is where API keys are saved, relative to the working
+// directory.
+const DefaultKeysFile = "api-keys.json"
+
+// keyPrefix starts every generated key, so leaked keys are easy to spot.
+const keyPrefix = "dbk_"
+
+// ErrKeyNotFound is returned for an unknown key ID.
+var ErrKeyNotFound = errors.New("key not found")
+
+// Key is an API key. Only a hash of the secret is kept; the secret itself
+// is shown once, when the key is created.
+type Key struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	Prefix   string     `json:"prefix"`         // Start of the secret, to tell keys apart
+	Hash     string     `json:"hash,omitempty"` // Hex SHA-256 of the secret
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+}
+
+// Keys holds the API keys created at runtime, saved to a file.
+type Keys struct {
+	path string // Empty keeps them in memory only
+	mu   sync.Mutex
+	keys []*Key
+}
+
+// LoadKeys reads the keys saved at path, if any. An empty path keeps keys
+// in memory only.
+func LoadKeys(path string) (*Keys, error) {
+	k := &Keys{path: path}
+	if path == "" {
+		return k, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &k.keys); err != nil {
+		return nil, fmt.Errorf("invalid API keys in %s: %v", path, err)
+	}
+	return k, nil
+}
+
+// List returns every key, without the hashes of their secrets.
+func (k *Keys) List() []Key {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	keys := make([]Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		listed := *key
+		listed.Hash = ""
+		keys = append(keys, listed)
+	}
+	return keys
+}
+
+// Len returns how many keys there are.
+func (k *Keys) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.keys)
+}
+
+// Add creates a key called name and returns it with its secret, which
+// isn't kept.
+func (k *Keys) Add(name string) (Key, string, error) {
+	secret, err := randomString(24)
+	if err != nil {
+		return Key{}, "", err
+	}
+	secret = keyPrefix + secret
+	id, err := randomString(8)
+	if err != nil {
+		return Key{}, "", err
+	}
+	key := &Key{
+		ID:      id,
+		Name:    name,
+		Prefix:  secret[:len(keyPrefix)+4],
+		Hash:    hash(secret),
+		Created: time.Now().UTC(),
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = append(k.keys, key)
+	if err := k.save(); err != nil {
+		k.keys = k.keys[:len(k.keys)-1]
+		return Key{}, "", err
+	}
+	created := *key
+	created.Hash = ""
+	return created, secret, nil
+}
+
+// Delete revokes the key with id.
+func (k *Keys) Delete(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for i, key := range k.keys {
+		if key.ID == id {
+			k.keys = append(k.keys[:i:i], k.keys[i+1:]...)
+			return k.save()
+		}
+	}
+	return ErrKeyNotFound
+}
+
+// Check returns the key whose secret is secret. Every key is compared in
+// constant time, so timing doesn't tell how close a guess was.
+func (k *Keys) Check(secret string) (Key, bool) {
+	sum := []byte(hash(secret))
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var found *Key
+	for _, key := range k.keys {
+		if subtle.ConstantTimeCompare(sum, []byte(key.Hash)) == 1 {
+			found = key
+		}
+	}
+	if found == nil {
+		return Key{}, false
+	}
+	now := time.Now().UTC()
+	found.LastUsed = &now // Saved with the next change; losing it is harmless
+	return *found, true
+}
+
+// save writes the keys to the file. The caller must hold k.mu.
+func (k *Keys) save() error {
+	if k.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(k.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes as hex.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
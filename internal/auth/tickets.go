@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// DefaultTicketTTL is how long a ticket may wait to be used.
+const DefaultTicketTTL = 30 * time.Second
+
+// Tickets issues short-lived tokens that open one WebSocket each, so
+// clients needn't put an API key or session token in a URL, where logs and
+// browser history keep it.
+type Tickets struct {
+	TTL time.Duration
+	mu  sync.Mutex
+	// expires holds when each ticket not yet used stops being valid, by
+	// the ticket's hash, so looking one up doesn't time its secret.
+	expires map[[sha256.Size]byte]time.Time
+}
+
+// NewTickets returns tickets valid for DefaultTicketTTL.
+func NewTickets() *Tickets {
+	return &Tickets{TTL: DefaultTicketTTL, expires: make(map[[sha256.Size]byte]time.Time)}
+}
+
+// Issue returns a new ticket and when it expires.
+func (t *Tickets) Issue() (string, time.Time, error) {
+	ticket, err := randomString(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expires := now.Add(t.TTL)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for issued, at := range t.expires {
+		if !now.Before(at) {
+			delete(t.expires, issued)
+		}
+	}
+	t.expires[sha256.Sum256([]byte(ticket))] = expires
+	return ticket, expires, nil
+}
+
+// Redeem reports whether ticket was issued and hasn't expired, and uses it
+// up.
+func (t *Tickets) Redeem(ticket string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hash := sha256.Sum256([]byte(ticket))
+	expires, ok := t.expires[hash]
+	if !ok {
+		return false
+	}
+	delete(t.expires, hash)
+	return time.Now().Before(expires)
+}
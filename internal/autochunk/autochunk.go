@@ -0,0 +1,90 @@
+// Package autochunk picks how many segments a download is split into from
+// what was learned while probing the file, so tiny files use a single
+// stream and large ones fan out across more connections.
+package autochunk
+
+import (
+	"context"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+const (
+	// MinChunkSize is the smallest segment worth a connection of its own.
+	MinChunkSize = 4 << 20
+
+	// TargetChunkSize is the amount of data each additional segment should
+	// carry once the file is large enough to be split.
+	TargetChunkSize = 32 << 20
+
+	// MaxChunks caps the number of segments for any file.
+	MaxChunks = 32
+)
+
+// Probe is what the initial request revealed about the file and server.
+type Probe struct {
+	Size   int64         // Content length, or <= 0 when unknown
+	RTT    time.Duration // Time from sending the request to the first response byte
+	Ranges bool          // Server advertised byte range support
+	HTTP2  bool          // Response arrived over HTTP/2
+}
+
+// Count returns the number of chunks to split the probed file into.
+func Count(p Probe) int {
+	if !p.Ranges || p.Size < 2*MinChunkSize {
+		return 1
+	}
+
+	// Grow with the file size, but never below MinChunkSize per chunk
+	n := min(p.Size/TargetChunkSize+2, p.Size/MinChunkSize)
+	return int(max(min(n, int64(connectionLimit(p))), 1))
+}
+
+// connectionLimit is how many parallel connections are likely to help. On a
+// low-latency link a few connections already fill the pipe; far-away servers
+// need more in flight to cover the bandwidth-delay product. HTTP/2 streams
+// share one TCP connection, so extra segments gain less there.
+func connectionLimit(p Probe) int {
+	limit := MaxChunks
+	switch {
+	case p.RTT < 5*time.Millisecond:
+		limit = 8
+	case p.RTT < 50*time.Millisecond:
+		limit = 16
+	}
+	if p.HTTP2 {
+		limit = min(limit, 8)
+	}
+	return limit
+}
+
+// TraceRTT returns a context that times a request made with it. The returned
+// function reports the delay between writing the request and receiving the
+// first response byte, which excludes connection setup.
+func TraceRTT(ctx context.Context) (context.Context, func() time.Duration) {
+	var mu sync.Mutex
+	var wrote, firstByte time.Time
+
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			mu.Lock()
+			wrote = time.Now()
+			mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			firstByte = time.Now()
+			mu.Unlock()
+		},
+	})
+
+	return ctx, func() time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		if wrote.IsZero() || firstByte.Before(wrote) {
+			return 0
+		}
+		return firstByte.Sub(wrote)
+	}
+}
@@ -0,0 +1,47 @@
+// Package bufpool provides the large copy buffers shared by the chunk
+// download and merge paths, so many concurrent transfers don't each allocate
+// their own.
+package bufpool
+
+import (
+	"io"
+	"sync"
+)
+
+// Size is the length of every pooled buffer.
+const Size = 256 * 1024
+
+var pool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, Size)
+		return &buf
+	},
+}
+
+// Get returns a buffer of Size bytes. Return it with Put when done.
+func Get() *[]byte {
+	return pool.Get().(*[]byte)
+}
+
+// Put returns a buffer obtained from Get to the pool.
+func Put(buf *[]byte) {
+	if buf == nil || len(*buf) != Size {
+		return
+	}
+	pool.Put(buf)
+}
+
+// Copy copies src to dst through a pooled buffer. Unlike io.Copy it always
+// uses the buffer, so wrapped readers and writers (progress counters, rate
+// limiters) don't fall back to a freshly allocated one.
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := Get()
+	defer Put(buf)
+	return io.CopyBuffer(writerOnly{dst}, readerOnly{src}, *buf)
+}
+
+// writerOnly and readerOnly hide ReaderFrom/WriterTo so io.CopyBuffer uses
+// the supplied buffer.
+type writerOnly struct{ io.Writer }
+
+type readerOnly struct{ io.Reader }
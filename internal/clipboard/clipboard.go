@@ -0,0 +1,36 @@
+// Package clipboard reads the system clipboard as text through the tools
+// each platform ships or commonly has installed, so no cgo is needed:
+// pbpaste on macOS, PowerShell on Windows, and wl-paste, xclip or xsel
+// elsewhere.
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// ErrUnavailable is returned when none of the platform's clipboard tools
+// can be used.
+var ErrUnavailable = errors.New("no clipboard tool found; " + hint)
+
+// Read returns the text on the clipboard. An empty clipboard, or one
+// holding something other than text, reads as "".
+func Read(ctx context.Context) (string, error) {
+	for _, command := range commands() {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		out, err := exec.CommandContext(ctx, command[0], command[1:]...).Output()
+		if err != nil {
+			// The tools fail when there is no text to paste
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", nil
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+	return "", ErrUnavailable
+}
@@ -0,0 +1,7 @@
+package clipboard
+
+const hint = "pbpaste is missing"
+
+func commands() [][]string {
+	return [][]string{{"pbpaste"}}
+}
@@ -0,0 +1,22 @@
+//go:build !darwin && !windows
+
+package clipboard
+
+import "os"
+
+const hint = "install wl-clipboard, xclip or xsel and run in a graphical session"
+
+// commands returns the tools for the display servers in use, since each
+// fails without its own.
+func commands() [][]string {
+	var commands [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		commands = append(commands, []string{"wl-paste", "--no-newline", "--type", "text"})
+	}
+	if os.Getenv("DISPLAY") != "" {
+		commands = append(commands,
+			[]string{"xclip", "-selection", "clipboard", "-out"},
+			[]string{"xsel", "--clipboard", "--output"})
+	}
+	return commands
+}
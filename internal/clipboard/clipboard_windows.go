@@ -0,0 +1,7 @@
+package clipboard
+
+const hint = "PowerShell is missing"
+
+func commands() [][]string {
+	return [][]string{{"powershell", "-NoProfile", "-NonInteractive", "-Command", "Get-Clipboard -Raw"}}
+}
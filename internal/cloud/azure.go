@@ -0,0 +1,187 @@
+package cloud
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	azureVersion    = "2021-08-06"
+	azureResource   = "https://storage.azure.com/"
+	azureIMDSURL    = "http://169.254.169.254/metadata/identity/oauth2/token"
+	azureLoginURL   = "https://login.microsoftonline.com/"
+	azureBlobSuffix = "blob.core.windows.net"
+)
+
+// azureSource authorizes requests for az://account/container/blob URLs.
+// Of the storage account's own credentials, a connection string in
+// AZURE_STORAGE_CONNECTION_STRING, a key in AZURE_STORAGE_KEY or a SAS in
+// AZURE_STORAGE_SAS_TOKEN is used first; then a service principal from
+// AZURE_CLIENT_ID, AZURE_CLIENT_SECRET and AZURE_TENANT_ID, or else the
+// instance's managed identity.
+type azureSource struct {
+	client   *http.Client
+	metadata *http.Client
+	token    cached[string] // Empty when there are no credentials
+}
+
+func newAzureSource(client, metadata *http.Client) *azureSource {
+	s := &azureSource{client: client, metadata: metadata}
+	s.token.fetch = s.findToken
+	return s
+}
+
+// parseConnectionString splits a storage connection string into its
+// settings.
+func parseConnectionString(raw string) map[string]string {
+	settings := make(map[string]string)
+	for _, part := range strings.Split(raw, ";") {
+		if name, value, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			settings[name] = value
+		}
+	}
+	return settings
+}
+
+// azureURL returns where the blob of u is, using the endpoint of the
+// connection string when it belongs to the same account.
+func azureURL(u *url.URL, conn map[string]string) (*url.URL, error) {
+	account := u.Host
+	container, blob := objectPath(u)
+	if account == "" || container == "" || blob == "" {
+		return nil, fmt.Errorf("invalid Azure Blob URL %q: want az://account/container/blob", u.Redacted())
+	}
+	endpoint := "https://" + account + "." + azureBlobSuffix
+	if conn["AccountName"] == account {
+		if conn["BlobEndpoint"] != "" {
+			endpoint = strings.TrimSuffix(conn["BlobEndpoint"], "/")
+		} else if suffix := conn["EndpointSuffix"]; suffix != "" {
+			protocol := conn["DefaultEndpointsProtocol"]
+			if protocol == "" {
+				protocol = "https"
+			}
+			endpoint = protocol + "://" + account + ".blob." + suffix
+		}
+	}
+	return url.Parse(endpoint + "/" + URIEncode(container, true) + "/" + URIEncode(blob, false))
+}
+
+func (s *azureSource) roundTrip(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	conn := parseConnectionString(os.Getenv("AZURE_STORAGE_CONNECTION_STRING"))
+	target, err := azureURL(req.URL, conn)
+	if err != nil {
+		return nil, err
+	}
+	account := req.URL.Host
+	key, sas := os.Getenv("AZURE_STORAGE_KEY"), os.Getenv("AZURE_STORAGE_SAS_TOKEN")
+	if conn["AccountName"] == account {
+		key, sas = conn["AccountKey"], conn["SharedAccessSignature"]
+	}
+	if sas != "" && key == "" {
+		target.RawQuery = strings.TrimPrefix(sas, "?")
+	}
+
+	out := outgoing(req, target)
+	out.Header.Set("X-Ms-Version", azureVersion)
+	switch {
+	case key != "":
+		if err := signAzure(out, account, key, time.Now()); err != nil {
+			return nil, err
+		}
+	case sas == "":
+		token, err := s.token.get(req.Context())
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			out.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	return base.RoundTrip(out)
+}
+
+// findToken gets a token for Azure Storage as the service principal in the
+// environment, or else as the instance's managed identity.
+func (s *azureSource) findToken(ctx context.Context) (string, time.Time, error) {
+	clientID, secret, tenant := os.Getenv("AZURE_CLIENT_ID"), os.Getenv("AZURE_CLIENT_SECRET"), os.Getenv("AZURE_TENANT_ID")
+	if clientID != "" && secret != "" && tenant != "" {
+		return postForm(ctx, s.client, azureLoginURL+url.PathEscape(tenant)+"/oauth2/v2.0/token", url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {clientID},
+			"client_secret": {secret},
+			"scope":         {azureResource + ".default"},
+		})
+	}
+
+	query := url.Values{"api-version": {"2018-02-01"}, "resource": {azureResource}}
+	if clientID != "" {
+		// A user-assigned identity
+		query.Set("client_id", clientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", azureIMDSURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Metadata", "true")
+	if token, expires, err := decodeToken(s.metadata, req); err == nil {
+		return token, expires, nil
+	}
+	return "", time.Now().Add(anonymousFor), nil
+}
+
+// signAzure adds a Shared Key Authorization header made with the storage
+// account's key, which is base64 as the portal shows it.
+func signAzure(req *http.Request, account, key string, now time.Time) error {
+	secret, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("invalid Azure storage key: %v", err)
+	}
+	req.Header.Set("X-Ms-Date", now.UTC().Format(http.TimeFormat))
+
+	var msHeaders []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower)
+		}
+	}
+	sort.Strings(msHeaders)
+	var canonical strings.Builder
+	for _, name := range msHeaders {
+		canonical.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+
+	canonical.WriteString("/" + account + req.URL.EscapedPath())
+	query := req.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		canonical.WriteString("\n" + strings.ToLower(name) + ":" + strings.Join(values, ","))
+	}
+
+	// The standard headers signed, in order; Date is left empty for X-Ms-Date
+	var standard []string
+	for _, name := range []string{"Content-Encoding", "Content-Language", "Content-Length", "Content-MD5",
+		"Content-Type", "Date", "If-Modified-Since", "If-Match", "If-None-Match", "If-Unmodified-Since", "Range"} {
+		standard = append(standard, req.Header.Get(name))
+	}
+	stringToSign := req.Method + "\n" + strings.Join(standard, "\n") + "\n" + canonical.String()
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(stringToSign))
+	req.Header.Set("Authorization", "SharedKey "+account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return nil
+}
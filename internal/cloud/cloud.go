@@ -0,0 +1,205 @@
+// Package cloud downloads objects from S3 (s3://bucket/key), Google Cloud
+// Storage (gs://bucket/object) and Azure Blob Storage
+// (az://account/container/blob) behind an http.RoundTripper. Each request
+// is readdressed to the service's HTTPS endpoint and signed, so an object
+// goes through the same ranged GETs as any http URL: the chunks of a
+// download are parallel ranged GetObject calls, and the ETag, x-goog-hash
+// or Content-MD5 the service sends verifies the result.
+//
+// Credentials are found the way the providers' SDKs find them: environment
+// variables first, then the usual credentials files, then the metadata
+// service of the instance or container it runs on. Without any, requests
+// go out unsigned, which is enough for public objects.
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// metadataTimeout bounds each request to an instance metadata service,
+	// which isn't there at all off the cloud.
+	metadataTimeout = 2 * time.Second
+
+	// anonymousFor is how long a lookup that found no credentials holds
+	// before they are looked for again.
+	anonymousFor = 5 * time.Minute
+
+	// refreshEarly is how long before temporary credentials expire that
+	// new ones are fetched.
+	refreshEarly = time.Minute
+)
+
+// Schemes are the URL schemes the transport answers.
+var Schemes = []string{"s3", "gs", "az"}
+
+// Transport answers HEAD and GET requests for object URLs by sending them
+// on to the service through base.
+type Transport struct {
+	base  http.RoundTripper
+	s3    *s3Source
+	gcs   *gcsSource
+	azure *azureSource
+}
+
+// New returns a transport that sends requests through base, and fetches
+// credentials from token endpoints through it as well.
+func New(base http.RoundTripper) *Transport {
+	client := &http.Client{Transport: base, Timeout: time.Minute}
+	// Metadata services are link-local and must never go through a proxy
+	metadata := &http.Client{Transport: &http.Transport{}, Timeout: metadataTimeout}
+	return &Transport{
+		base:  base,
+		s3:    newS3Source(metadata),
+		gcs:   newGCSSource(client, metadata),
+		azure: newAzureSource(client, metadata),
+	}
+}
+
+// RoundTrip sends req to the service holding its object. The response is
+// the service's own, but for a HEAD it advertises byte ranges, which every
+// one of them serves.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodHead && req.Method != http.MethodGet {
+		return nil, fmt.Errorf("%s: unsupported method %s", req.URL.Scheme, req.Method)
+	}
+	var resp *http.Response
+	var err error
+	switch req.URL.Scheme {
+	case "s3":
+		resp, err = t.s3.roundTrip(t.base, req)
+	case "gs":
+		resp, err = t.gcs.roundTrip(t.base, req)
+	case "az":
+		resp, err = t.azure.roundTrip(t.base, req)
+	default:
+		return nil, fmt.Errorf("unsupported URL scheme %q", req.URL.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Request = req
+	if req.Method == http.MethodHead && resp.StatusCode == http.StatusOK && resp.Header.Get("Accept-Ranges") == "" {
+		resp.Header.Set("Accept-Ranges", "bytes")
+	}
+	return resp, nil
+}
+
+// Endpoint returns the HTTPS URL an object URL is fetched from, ignoring
+// credentials, or false if u isn't one.
+func Endpoint(u *url.URL) (*url.URL, bool) {
+	var endpoint *url.URL
+	var err error
+	switch u.Scheme {
+	case "s3":
+		endpoint, err = s3URL(u, envRegion())
+	case "gs":
+		endpoint, err = gcsURL(u)
+	case "az":
+		endpoint, err = azureURL(u, parseConnectionString(os.Getenv("AZURE_STORAGE_CONNECTION_STRING")))
+	default:
+		return nil, false
+	}
+	return endpoint, err == nil
+}
+
+// outgoing returns a copy of req addressed to target, to be signed.
+func outgoing(req *http.Request, target *url.URL) *http.Request {
+	out := req.Clone(req.Context())
+	out.URL = target
+	out.Host = ""
+	return out
+}
+
+// objectPath splits the path of an object URL into its first segment and
+// the rest: the container and blob name of an az:// URL.
+func objectPath(u *url.URL) (first, rest string) {
+	first, rest, _ = strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	return first, rest
+}
+
+// cached holds credentials until they are about to expire, fetching them
+// again with fetch after that.
+type cached[T any] struct {
+	mu      sync.Mutex
+	value   T
+	expires time.Time
+	fetch   func(ctx context.Context) (T, time.Time, error)
+}
+
+func (c *cached[T]) get(ctx context.Context) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.expires.Add(-refreshEarly)) {
+		return c.value, nil
+	}
+	value, expires, err := c.fetch(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	c.value, c.expires = value, expires
+	return value, nil
+}
+
+// getJSON decodes the JSON reply to req into v.
+func getJSON(client *http.Client, req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned status %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// postForm sends form to tokenURL and decodes the OAuth token in the reply.
+func postForm(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (string, time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return decodeToken(client, req)
+}
+
+// decodeToken sends req and reads the OAuth access token it answers with.
+func decodeToken(client *http.Client, req *http.Request) (string, time.Time, error) {
+	var token struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresIn   json.Number `json:"expires_in"` // A string from Azure's metadata service
+	}
+	if err := getJSON(client, req, &token); err != nil {
+		return "", time.Time{}, err
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("%s returned no access token", req.URL.Host)
+	}
+	seconds, err := token.ExpiresIn.Int64()
+	if err != nil || seconds <= 0 {
+		seconds = 300
+	}
+	return token.AccessToken, time.Now().Add(time.Duration(seconds) * time.Second), nil
+}
+
+// firstEnv returns the first of the environment variables that is set.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
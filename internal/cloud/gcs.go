@@ -0,0 +1,210 @@
+package cloud
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	gcsEndpoint     = "https://storage.googleapis.com"
+	gcsScope        = "https://www.googleapis.com/auth/devstorage.read_only"
+	googleTokenURL  = "https://oauth2.googleapis.com/token"
+	gceMetadataHost = "metadata.google.internal"
+)
+
+// gcsSource authorizes requests for gs:// URLs with an OAuth token. They go
+// to the XML API, whose ranged GETs and x-goog-hash header work like S3's;
+// STORAGE_EMULATOR_HOST points it at an emulator instead, unauthenticated.
+type gcsSource struct {
+	client   *http.Client
+	metadata *http.Client
+	token    cached[string] // Empty when there are no credentials
+}
+
+func newGCSSource(client, metadata *http.Client) *gcsSource {
+	s := &gcsSource{client: client, metadata: metadata}
+	s.token.fetch = s.findToken
+	return s
+}
+
+// gcsURL returns where the object of u is.
+func gcsURL(u *url.URL) (*url.URL, error) {
+	bucket, object := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || object == "" {
+		return nil, fmt.Errorf("invalid Cloud Storage URL %q: want gs://bucket/object", u.Redacted())
+	}
+	endpoint := gcsEndpoint
+	if emulator := os.Getenv("STORAGE_EMULATOR_HOST"); emulator != "" {
+		endpoint = emulator
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+	}
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Cloud Storage endpoint %q: %v", endpoint, err)
+	}
+	return base.Parse("/" + URIEncode(bucket, true) + "/" + URIEncode(object, false))
+}
+
+func (s *gcsSource) roundTrip(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	target, err := gcsURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	out := outgoing(req, target)
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		token, err := s.token.get(req.Context())
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			out.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	return base.RoundTrip(out)
+}
+
+// findToken gets an access token with the application default credentials:
+// the file named by GOOGLE_APPLICATION_CREDENTIALS or the one gcloud
+// writes, or else the service account of the Compute Engine instance.
+func (s *gcsSource) findToken(ctx context.Context) (string, time.Time, error) {
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		path = gcloudCredentials()
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return s.fileToken(ctx, path, data)
+		}
+		if !os.IsNotExist(err) || os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") != "" {
+			return "", time.Time{}, err
+		}
+	}
+
+	host := firstEnv("GCE_METADATA_HOST")
+	if host == "" {
+		host = gceMetadataHost
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	if token, expires, err := decodeToken(s.metadata, req); err == nil {
+		return token, expires, nil
+	}
+	return "", time.Now().Add(anonymousFor), nil
+}
+
+// gcloudCredentials returns where `gcloud auth application-default login`
+// keeps its credentials.
+func gcloudCredentials() string {
+	if runtime.GOOS == "windows" {
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			return filepath.Join(appData, "gcloud", "application_default_credentials.json")
+		}
+		return ""
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+}
+
+// fileToken exchanges a service account key or a gcloud user's refresh
+// token, read from path, for an access token.
+func (s *gcsSource) fileToken(ctx context.Context, path string, data []byte) (string, time.Time, error) {
+	var creds struct {
+		Type         string `json:"type"`
+		ClientEmail  string `json:"client_email"`
+		PrivateKey   string `json:"private_key"`
+		TokenURI     string `json:"token_uri"`
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return "", time.Time{}, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if creds.TokenURI == "" {
+		creds.TokenURI = googleTokenURL
+	}
+
+	switch creds.Type {
+	case "service_account":
+		assertion, err := signJWT(creds.ClientEmail, creds.PrivateKey, creds.TokenURI)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("reading %s: %w", path, err)
+		}
+		return postForm(ctx, s.client, creds.TokenURI, url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		})
+	case "authorized_user":
+		return postForm(ctx, s.client, creds.TokenURI, url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {creds.ClientID},
+			"client_secret": {creds.ClientSecret},
+			"refresh_token": {creds.RefreshToken},
+		})
+	default:
+		return "", time.Time{}, fmt.Errorf("%s: unsupported credentials type %q", path, creds.Type)
+	}
+}
+
+// signJWT returns the assertion a service account trades for an access
+// token, signed with its RSA key.
+func signJWT(email, privateKey, audience string) (string, error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return "", fmt.Errorf("no PEM private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", fmt.Errorf("invalid private key: %w", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("private key isn't RSA")
+	}
+
+	now := time.Now()
+	claims, err := json.Marshal(map[string]any{
+		"iss":   email,
+		"scope": gcsScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+	unsigned := encode([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + encode(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + encode(signature), nil
+}
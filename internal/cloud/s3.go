@@ -0,0 +1,282 @@
+package cloud
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	imdsURL      = "http://169.254.169.254"
+	ecsURL       = "http://169.254.170.2"
+	imdsTokenTTL = "21600"
+)
+
+// s3Source signs requests for s3:// URLs. AWS_ENDPOINT_URL_S3 or
+// AWS_ENDPOINT_URL points it at an S3-compatible service such as MinIO,
+// addressed path-style.
+type s3Source struct {
+	metadata *http.Client
+	keys     cached[*AWSKeys] // nil when there are none
+
+	mu      sync.Mutex
+	regions map[string]string // Of buckets S3 said are elsewhere than AWS_REGION
+}
+
+func newS3Source(metadata *http.Client) *s3Source {
+	s := &s3Source{metadata: metadata, regions: make(map[string]string)}
+	s.keys.fetch = s.findKeys
+	return s
+}
+
+func envRegion() string {
+	if region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"); region != "" {
+		return region
+	}
+	return "us-east-1"
+}
+
+// s3URL returns where the object of u is in region: the bucket's virtual
+// host on AWS, or a path under a custom endpoint.
+func s3URL(u *url.URL, region string) (*url.URL, error) {
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid S3 URL %q: want s3://bucket/key", u.Redacted())
+	}
+	if endpoint := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); endpoint != "" {
+		base, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint %q: %v", endpoint, err)
+		}
+		return base.Parse("/" + URIEncode(bucket, true) + "/" + URIEncode(key, false))
+	}
+	if strings.Contains(bucket, ".") {
+		// A dotted bucket name doesn't match the wildcard certificate of
+		// its virtual host
+		return url.Parse(fmt.Sprintf("https://s3.%s.amazonaws.com/%s/%s", region, URIEncode(bucket, true), URIEncode(key, false)))
+	}
+	return url.Parse(fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, URIEncode(key, false)))
+}
+
+func (s *s3Source) region(bucket string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if region := s.regions[bucket]; region != "" {
+		return region
+	}
+	return envRegion()
+}
+
+// roundTrip sends req to S3, once more in the bucket's own region if S3
+// answers that it is in another one.
+func (s *s3Source) roundTrip(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	keys, err := s.keys.get(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	bucket := req.URL.Host
+	region := s.region(bucket)
+	for {
+		target, err := s3URL(req.URL, region)
+		if err != nil {
+			return nil, err
+		}
+		out := outgoing(req, target)
+		if keys != nil {
+			SignAWS(out, *keys, region, EmptySHA256, time.Now())
+		}
+		resp, err := base.RoundTrip(out)
+		if err != nil {
+			return nil, err
+		}
+		moved := resp.Header.Get("X-Amz-Bucket-Region")
+		if moved == "" || moved == region || (resp.StatusCode != http.StatusMovedPermanently && resp.StatusCode != http.StatusBadRequest) {
+			return resp, nil
+		}
+		resp.Body.Close()
+		s.mu.Lock()
+		s.regions[bucket] = moved
+		s.mu.Unlock()
+		region = moved
+	}
+}
+
+// findKeys looks for credentials in the environment, the shared
+// credentials file, the ECS container endpoint and the EC2 instance
+// profile, in that order.
+func (s *s3Source) findKeys(ctx context.Context) (*AWSKeys, time.Time, error) {
+	never := time.Now().Add(100 * 365 * 24 * time.Hour)
+	if access, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); access != "" && secret != "" {
+		return &AWSKeys{AccessKey: access, SecretKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, never, nil
+	}
+	keys, err := sharedKeys()
+	if err != nil || keys != nil {
+		return keys, never, err
+	}
+	if keys, expires, err := s.containerKeys(ctx); keys != nil || err != nil {
+		return keys, expires, err
+	}
+	if keys, expires := s.instanceKeys(ctx); keys != nil {
+		return keys, expires, nil
+	}
+	return nil, time.Now().Add(anonymousFor), nil
+}
+
+// sharedKeys reads the profile named by AWS_PROFILE, or the default one,
+// from the shared credentials file.
+func sharedKeys() (*AWSKeys, error) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	profile := firstEnv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	var keys AWSKeys
+	var section string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(name) {
+		case "aws_access_key_id":
+			keys.AccessKey = value
+		case "aws_secret_access_key":
+			keys.SecretKey = value
+		case "aws_session_token":
+			keys.SessionToken = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if keys.AccessKey == "" || keys.SecretKey == "" {
+		return nil, nil
+	}
+	return &keys, nil
+}
+
+// awsTemporaryKeys is how the container and instance endpoints answer.
+type awsTemporaryKeys struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+func (k awsTemporaryKeys) keys() (*AWSKeys, time.Time) {
+	return &AWSKeys{AccessKey: k.AccessKeyID, SecretKey: k.SecretAccessKey, SessionToken: k.Token}, k.Expiration
+}
+
+// containerKeys fetches the task role's credentials on ECS and other
+// hosts that set AWS_CONTAINER_CREDENTIALS_*.
+func (s *s3Source) containerKeys(ctx context.Context) (*AWSKeys, time.Time, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = ecsURL + relative
+	}
+	if endpoint == "" {
+		return nil, time.Time{}, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	var creds awsTemporaryKeys
+	if err := getJSON(s.metadata, req, &creds); err != nil {
+		return nil, time.Time{}, fmt.Errorf("fetching container credentials: %w", err)
+	}
+	keys, expires := creds.keys()
+	return keys, expires, nil
+}
+
+// instanceKeys fetches the instance profile's credentials from the EC2
+// metadata service, using an IMDSv2 session token. It returns nil off EC2.
+func (s *s3Source) instanceKeys(ctx context.Context) (*AWSKeys, time.Time) {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return nil, time.Time{}
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", imdsURL+"/latest/api/token", nil)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", imdsTokenTTL)
+	resp, err := s.metadata.Do(req)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	token, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return nil, time.Time{}
+	}
+
+	get := func(path string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", imdsURL+"/latest/meta-data/iam/security-credentials/"+path, nil)
+		if err == nil {
+			req.Header.Set("X-Aws-Ec2-Metadata-Token", string(token))
+		}
+		return req, err
+	}
+	req, err = get("")
+	if err != nil {
+		return nil, time.Time{}
+	}
+	resp, err = s.metadata.Do(req)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	var role string
+	if scanner.Scan() {
+		role = strings.TrimSpace(scanner.Text())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || role == "" {
+		return nil, time.Time{}
+	}
+
+	if req, err = get(role); err != nil {
+		return nil, time.Time{}
+	}
+	var creds awsTemporaryKeys
+	if err := getJSON(s.metadata, req, &creds); err != nil {
+		return nil, time.Time{}
+	}
+	return creds.keys()
+}
@@ -0,0 +1,328 @@
+// Package compress shrinks finished downloads: it compresses single files
+// with gzip or zstd and packs several files into one tar or zip archive.
+// zstd is run as an external command, when it is installed.
+package compress
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/govind1331/Datablip/internal/bufpool"
+)
+
+// ZstdCommand is the zstd executable, looked up on PATH by default.
+var ZstdCommand = "zstd"
+
+// Format is how a single file is compressed.
+type Format string
+
+const (
+	Gzip Format = "gzip"
+	Zstd Format = "zstd"
+)
+
+// Extension is the suffix a compressed file gets.
+func (f Format) Extension() string {
+	switch f {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// Validate reports a format that is unknown or can't be used here.
+func (f Format) Validate() error {
+	switch f {
+	case Gzip:
+		return nil
+	case Zstd:
+		if _, err := exec.LookPath(ZstdCommand); err != nil {
+			return fmt.Errorf("zstd compression needs the %s command: %v", ZstdCommand, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown compression %q: must be gzip or zstd", string(f))
+}
+
+// Progress receives updates while files are compressed or packed.
+type Progress struct {
+	// Entry, if non-nil, is called with the name of each file before it
+	// is added to an archive.
+	Entry func(name string)
+
+	// Bytes, if non-nil, is called with how many bytes of the input files
+	// were consumed, so they add up to their combined size.
+	Bytes func(n int64)
+}
+
+func (p Progress) entry(name string) {
+	if p.Entry != nil {
+		p.Entry(name)
+	}
+}
+
+type countingReader struct {
+	r        io.Reader
+	progress Progress
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if c.progress.Bytes != nil {
+		c.progress.Bytes(int64(n))
+	}
+	return n, err
+}
+
+// File compresses src into dest, which must not exist yet. src is left in
+// place. On failure dest is removed.
+func File(ctx context.Context, src, dest string, format Format, progress Progress) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(dest)
+		}
+	}()
+
+	w, err := newWriter(ctx, out, format)
+	if err != nil {
+		return err
+	}
+	if _, err := copyContext(ctx, w, &countingReader{r: in, progress: progress}); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// newWriter compresses what is written to it into out.
+func newWriter(ctx context.Context, out io.Writer, format Format) (io.WriteCloser, error) {
+	switch format {
+	case Gzip:
+		return gzip.NewWriter(out), nil
+	case Zstd:
+		return newZstdWriter(ctx, out)
+	}
+	return nil, fmt.Errorf("unknown compression %q", string(format))
+}
+
+// zstdWriter pipes into a zstd process.
+type zstdWriter struct {
+	io.WriteCloser
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+}
+
+func newZstdWriter(ctx context.Context, out io.Writer) (*zstdWriter, error) {
+	w := &zstdWriter{cmd: exec.CommandContext(ctx, ZstdCommand, "-q", "-c", "-T0", "-")}
+	w.cmd.Stdout = out
+	w.cmd.Stderr = &w.stderr
+	stdin, err := w.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	w.WriteCloser = stdin
+	if err := w.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %v", ZstdCommand, err)
+	}
+	return w, nil
+}
+
+// Close finishes the input and waits for zstd to write the rest.
+func (w *zstdWriter) Close() error {
+	w.WriteCloser.Close()
+	if err := w.cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(w.stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %v: %s", ZstdCommand, err, msg)
+		}
+		return fmt.Errorf("%s: %v", ZstdCommand, err)
+	}
+	return nil
+}
+
+// ArchiveFormat is a kind of archive Pack can write.
+type ArchiveFormat int
+
+const (
+	Zip ArchiveFormat = iota + 1
+	Tar
+	TarGzip
+	TarZstd
+)
+
+// DetectArchive picks the archive format from a file name.
+func DetectArchive(name string) (ArchiveFormat, bool) {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return Zip, true
+	case strings.HasSuffix(name, ".tar"):
+		return Tar, true
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return TarGzip, true
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return TarZstd, true
+	}
+	return 0, false
+}
+
+// Pack writes the files into a new archive at dest. Each file is stored
+// under its base name, so the names must differ. On failure dest is
+// removed.
+func Pack(ctx context.Context, dest string, format ArchiveFormat, files []string, progress Progress) (err error) {
+	if format == TarZstd {
+		if err := Zstd.Validate(); err != nil {
+			return err
+		}
+	}
+	names := make(map[string]bool)
+	for _, file := range files {
+		name := filepath.Base(file)
+		if names[name] {
+			return fmt.Errorf("two files are named %s", name)
+		}
+		names[name] = true
+	}
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(dest)
+		}
+	}()
+
+	if format == Zip {
+		return packZip(ctx, out, files, progress)
+	}
+	var w io.WriteCloser = nopCloser{out}
+	switch format {
+	case TarGzip:
+		w = gzip.NewWriter(out)
+	case TarZstd:
+		if w, err = newZstdWriter(ctx, out); err != nil {
+			return err
+		}
+	}
+	if err := packTar(ctx, w, files, progress); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func packTar(ctx context.Context, w io.Writer, files []string, progress Progress) error {
+	archive := tar.NewWriter(w)
+	for _, file := range files {
+		err := addFile(ctx, file, progress, func(info os.FileInfo) (io.Writer, error) {
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return nil, err
+			}
+			return archive, archive.WriteHeader(header)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func packZip(ctx context.Context, w io.Writer, files []string, progress Progress) error {
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		err := addFile(ctx, file, progress, func(info os.FileInfo) (io.Writer, error) {
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return nil, err
+			}
+			header.Method = zip.Deflate
+			return archive.CreateHeader(header)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// addFile copies a file into an archive through the entry create opens.
+func addFile(ctx context.Context, file string, progress Progress, create func(os.FileInfo) (io.Writer, error)) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", filepath.Base(file))
+	}
+	progress.entry(info.Name())
+	entry, err := create(info)
+	if err != nil {
+		return err
+	}
+	_, err = copyContext(ctx, entry, &countingReader{r: in, progress: progress})
+	return err
+}
+
+// copyContext is io.Copy that stops between reads once ctx is done.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	pooled := bufpool.Get()
+	defer bufpool.Put(pooled)
+	buf := *pooled
+	var written int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			m, werr := dst.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package config sets the defaults of the CLI's and the server's flags from
+// a datablip.yaml or datablip.toml file and from environment variables, so
+// they needn't be given every time. Flags on the command line override
+// environment variables, which override the file.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the environment variable that sets each flag: -port is
+// DATABLIP_PORT, -files-token is DATABLIP_FILES_TOKEN.
+const EnvPrefix = "DATABLIP_"
+
+// Names are the file names looked for, in this order, in each directory
+// of Dirs.
+var Names = []string{"datablip.yaml", "datablip.yml", "datablip.toml"}
+
+// EnvName returns the environment variable that sets the flag called
+// flagName.
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ApplyEnv sets the flags that have an environment variable. Flags given on
+// the command line are parsed afterwards and override them.
+func ApplyEnv(flags *flag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(EnvName(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		if setErr := flags.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid %s %q: %v", EnvName(f.Name), value, setErr)
+		}
+	})
+	return err
+}
+
+// Dirs returns where a configuration file is looked for: the working
+// directory, then the user's configuration directory, such as
+// ~/.config/datablip, then /etc/datablip.
+func Dirs() []string {
+	dirs := []string{"."}
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "datablip"))
+	}
+	return append(dirs, "/etc/datablip")
+}
+
+// Find returns the configuration file to use: the one given as -config in
+// args, else the one $DATABLIP_CONFIG names, else the first found in Dirs.
+// It returns "" if there is none.
+func Find(args []string) string {
+	if path, ok := flagValue(args, "config"); ok {
+		return path
+	}
+	if path, ok := os.LookupEnv(EnvName("config")); ok {
+		return path
+	}
+	for _, dir := range Dirs() {
+		for _, name := range Names {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// flagValue returns the value given to -name in args, which haven't been
+// parsed yet.
+func flagValue(args []string, name string) (string, bool) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		arg = strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if value, ok := strings.CutPrefix(arg, name+"="); ok {
+			return value, true
+		}
+		if arg == name && i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// File is a parsed configuration file. Its keys are flag names; those at
+// the top level are shared by every program, and those in a section, such
+// as server or cli, only apply to that program and win over shared ones.
+type File struct {
+	Path     string
+	shared   map[string]any
+	sections map[string]map[string]any
+}
+
+// Load reads the configuration file at path, parsed as TOML if its name
+// ends in .toml and as YAML otherwise.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]any)
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = toml.Unmarshal(data, &values)
+	} else {
+		err = yaml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", path, err)
+	}
+
+	f := &File{Path: path, shared: make(map[string]any), sections: make(map[string]map[string]any)}
+	for key, value := range values {
+		if section, ok := value.(map[string]any); ok {
+			f.sections[key] = section
+		} else {
+			f.shared[key] = value
+		}
+	}
+	return f, nil
+}
+
+// Apply sets the flags named in the file for the program whose section is
+// section. Shared keys for flags the program doesn't have are left to the
+// others; with strict, keys in its own section must all name a flag.
+func (f *File) Apply(flags *flag.FlagSet, section string, strict bool) error {
+	own := f.sections[section]
+	if strict {
+		for _, key := range slices.Sorted(maps.Keys(own)) {
+			if flags.Lookup(key) == nil {
+				return fmt.Errorf("%s: unknown setting %q in %s", f.Path, key, section)
+			}
+		}
+	}
+	for _, values := range []map[string]any{f.shared, own} {
+		for _, key := range slices.Sorted(maps.Keys(values)) {
+			if flags.Lookup(key) == nil || key == "config" {
+				continue
+			}
+			if err := set(flags, key, values[key]); err != nil {
+				return fmt.Errorf("%s: invalid %s: %v", f.Path, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// set sets the flag called name to value, once for each item of a list,
+// for flags that may be repeated.
+func set(flags *flag.FlagSet, name string, value any) error {
+	items, ok := value.([]any)
+	if !ok {
+		items = []any{value}
+	}
+	for _, item := range items {
+		s, err := format(item)
+		if err != nil {
+			return err
+		}
+		if err := flags.Set(name, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// format writes a value from the file the way it would be given as a flag.
+func format(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", nil
+	case []any, map[string]any:
+		return "", fmt.Errorf("must be a value or a list of values")
+	}
+	return fmt.Sprint(value), nil
+}
+
+// Setup sets the defaults of flags, which are then parsed from args: first
+// from the configuration file, if there is one, then from environment
+// variables. It returns the path of the file used, or "".
+func Setup(flags *flag.FlagSet, section string, strict bool, args []string) (string, error) {
+	path := Find(args)
+	if path != "" {
+		f, err := Load(path)
+		if err != nil {
+			return "", err
+		}
+		if err := f.Apply(flags, section, strict); err != nil {
+			return "", err
+		}
+	}
+	return path, ApplyEnv(flags)
+}
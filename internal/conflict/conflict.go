@@ -0,0 +1,51 @@
+// Package conflict decides what happens when a download's output file
+// already exists: it is kept and the download saved under a numbered name,
+// replaced, taken as the start of the download, or left alone while the
+// download fails.
+package conflict
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Policy is what to do with an existing output file.
+type Policy string
+
+const (
+	// Rename saves the download as "name (2).ext", "name (3).ext" and so
+	// on, whichever is free.
+	Rename Policy = "rename"
+	// Overwrite replaces the file once the download has been verified.
+	Overwrite Policy = "overwrite"
+	// Resume takes the file as the first bytes of the download and fetches
+	// the rest; one of the full size is kept as is, once verified.
+	Resume Policy = "resume"
+	// Fail leaves the file alone and fails the download.
+	Fail Policy = "fail"
+)
+
+// Default is the policy of downloads that don't pick one.
+const Default = Rename
+
+// Parse validates a policy name; empty means Default.
+func Parse(name string) (Policy, error) {
+	switch policy := Policy(name); policy {
+	case "":
+		return Default, nil
+	case Rename, Overwrite, Resume, Fail:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q (want %q, %q, %q or %q)", name, Rename, Overwrite, Resume, Fail)
+}
+
+// Numbered returns name with " (n)" before its extension, counting
+// ".tar.gz" and the like as one.
+func Numbered(name string, n int) string {
+	ext := filepath.Ext(name)
+	if strings.HasSuffix(strings.TrimSuffix(name, ext), ".tar") {
+		ext = ".tar" + ext
+	}
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+}
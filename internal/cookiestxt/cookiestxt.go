@@ -0,0 +1,88 @@
+// Package cookiestxt reads the cookies.txt files that browser extensions,
+// curl and yt-dlp export, in the Netscape format: one cookie per line with
+// seven tab-separated fields, domain, whether subdomains get it too, path,
+// secure, expiry as a Unix time, name and value. Lines starting with # are
+// comments, except that #HttpOnly_ in front of the domain marks an HttpOnly
+// cookie.
+package cookiestxt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLine bounds a line, since cookie values can run long.
+const maxLine = 1 << 20
+
+// Read loads the cookies in r into a new jar, which picks the ones that
+// belong to each request as a browser would. It returns how many unexpired
+// cookies it loaded.
+func Read(r io.Reader) (*cookiejar.Jar, int, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	now := time.Now()
+	loaded := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxLine)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(line, "#HttpOnly_"); ok {
+			line, httpOnly = rest, true
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, 0, fmt.Errorf("line %d: want 7 tab-separated fields, got %d", n, len(fields))
+		}
+		domain, subdomains, path, secure, name, value := fields[0], fields[1], fields[2], fields[3], fields[5], fields[6]
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: invalid expiry %q", n, fields[4])
+		}
+		host := strings.TrimPrefix(domain, ".")
+		if host == "" || name == "" {
+			return nil, 0, fmt.Errorf("line %d: missing domain or name", n)
+		}
+
+		cookie := &http.Cookie{
+			Name:     name,
+			Value:    value,
+			Path:     path,
+			Secure:   strings.EqualFold(secure, "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		if strings.EqualFold(subdomains, "TRUE") {
+			cookie.Domain = host
+		}
+		// 0 is a session cookie, kept for as long as the jar
+		if expiry > 0 {
+			cookie.Expires = time.Unix(expiry, 0)
+			if cookie.Expires.Before(now) {
+				continue
+			}
+		}
+		scheme := "http"
+		if cookie.Secure {
+			scheme = "https"
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: path}, []*http.Cookie{cookie})
+		loaded++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	return jar, loaded, nil
+}
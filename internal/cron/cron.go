@@ -0,0 +1,203 @@
+// Package cron parses cron schedules: five fields for minute, hour, day of
+// month, month and day of week, or shorthands such as "@weekly".
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression. Each field is a bit set of the
+// values it allows.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// domStar and dowStar note unrestricted day fields, those starting
+	// with "*" such as "*/2"; when both day fields are restricted, a day
+	// matching either one is enough.
+	domStar, dowStar bool
+}
+
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    []string // Names for values from min, such as "jan"
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// Parse reads a five-field cron expression or shorthand. Fields take "*",
+// values, ranges ("1-5"), lists ("1,15") and steps ("*/15"); months and
+// days of the week may be given by their English abbreviation. Sunday is
+// 0 or 7.
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := shorthands[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: want 5 fields (minute hour day-of-month month day-of-week) or a shorthand like @daily", spec)
+	}
+
+	s := &Schedule{
+		domStar: unrestricted(fields[2]),
+		dowStar: unrestricted(fields[4]),
+	}
+	var err error
+	for i, target := range []struct {
+		f    field
+		bits *uint64
+	}{
+		{minuteField, &s.minute},
+		{hourField, &s.hour},
+		{domField, &s.dom},
+		{monthField, &s.month},
+		{dowField, &s.dow},
+	} {
+		if *target.bits, err = parseField(fields[i], target.f); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+	}
+	// Sunday may be written as 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// unrestricted reports whether a day field starts with "*" or "?", as
+// cron only lets a restricted day field widen the other one.
+func unrestricted(expr string) bool {
+	return strings.HasPrefix(expr, "*") || strings.HasPrefix(expr, "?")
+}
+
+func parseField(expr string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepExpr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s", stepExpr, f.name)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rangeExpr == "*" || rangeExpr == "?":
+		case strings.Contains(rangeExpr, "-"):
+			a, b, _ := strings.Cut(rangeExpr, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q in %s", rangeExpr, f.name)
+			}
+		default:
+			v, err := f.value(rangeExpr)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q: want %d-%d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first time after t the schedule fires, in t's location,
+// or the zero time if it never does (such as on February 30th). A time
+// skipped when clocks go forward fires as the clocks reach it, shifted by
+// the gap; a time repeated when they go back fires once.
+func (s *Schedule) Next(t time.Time) time.Time {
+	// Walk the wall clock in UTC, which has no DST, and place each match in
+	// t's location
+	loc := t.Location()
+	w := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC).Add(time.Minute)
+	limit := w.AddDate(5, 0, 0)
+
+	for w.Before(limit) {
+		if s.month&(1<<uint(w.Month())) == 0 {
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(w) {
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hour&(1<<uint(w.Hour())) == 0 {
+			w = w.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minute&(1<<uint(w.Minute())) == 0 {
+			w = w.Add(time.Minute)
+			continue
+		}
+		next := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), 0, 0, loc)
+		// A wall clock time in the gap may be placed before it; move it past
+		if wall := time.Date(next.Year(), next.Month(), next.Day(), next.Hour(), next.Minute(), 0, 0, time.UTC); wall.Before(w) {
+			next = next.Add(w.Sub(wall))
+		}
+		if !next.After(t) {
+			// The second pass through a repeated hour
+			w = w.Add(time.Minute)
+			continue
+		}
+		return next
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
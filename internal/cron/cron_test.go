@@ -0,0 +1,150 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+// bits sets the given values.
+func bits(values ...int) uint64 {
+	var b uint64
+	for _, v := range values {
+		b |= 1 << v
+	}
+	return b
+}
+
+// span sets every value from lo to hi.
+func span(lo, hi int) uint64 {
+	var b uint64
+	for v := lo; v <= hi; v++ {
+		b |= 1 << v
+	}
+	return b
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		want *Schedule // Nil if the spec is invalid
+	}{
+		{"*/15 * * * *", &Schedule{
+			minute: bits(0, 15, 30, 45), hour: span(0, 23), dom: span(1, 31), month: span(1, 12), dow: span(0, 7),
+			domStar: true, dowStar: true,
+		}},
+		{"0 3 * * sun", &Schedule{
+			minute: bits(0), hour: bits(3), dom: span(1, 31), month: span(1, 12), dow: bits(0),
+			domStar: true,
+		}},
+		{"0 3 * * 7", &Schedule{
+			minute: bits(0), hour: bits(3), dom: span(1, 31), month: span(1, 12), dow: bits(0, 7),
+			domStar: true,
+		}},
+		{"@weekly", &Schedule{
+			minute: bits(0), hour: bits(0), dom: span(1, 31), month: span(1, 12), dow: bits(0),
+			domStar: true,
+		}},
+		{"5 0-6/2 1,15 JAN-mar mon-fri", &Schedule{
+			minute: bits(5), hour: bits(0, 2, 4, 6), dom: bits(1, 15), month: span(1, 3), dow: span(1, 5),
+		}},
+		{"0 0 */2 * 1", &Schedule{
+			minute: bits(0), hour: bits(0), dom: bits(1, 3, 5, 7, 9, 11, 13, 15, 17, 19, 21, 23, 25, 27, 29, 31),
+			month: span(1, 12), dow: bits(1),
+			domStar: true,
+		}},
+		{"0 0 10/5 ? *", &Schedule{
+			minute: bits(0), hour: bits(0), dom: bits(10, 15, 20, 25, 30), month: span(1, 12), dow: span(0, 7),
+			dowStar: true,
+		}},
+		{"", nil},
+		{"* * * *", nil},
+		{"* * * * * *", nil},
+		{"@sometimes", nil},
+		{"60 * * * *", nil},
+		{"0 24 * * *", nil},
+		{"0 0 0 * *", nil},
+		{"0 0 * 13 *", nil},
+		{"0 0 * * 8", nil},
+		{"*/0 * * * *", nil},
+		{"*/x * * * *", nil},
+		{"30-10 * * * *", nil},
+		{"x * * * *", nil},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.spec)
+		switch {
+		case test.want == nil && err == nil:
+			t.Errorf("Parse(%q) = %+v, want an error", test.spec, got)
+		case test.want != nil && err != nil:
+			t.Errorf("Parse(%q): %v", test.spec, err)
+		case test.want != nil && *got != *test.want:
+			t.Errorf("Parse(%q) = %+v, want %+v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	utc := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+	// In 2026 New York's clocks go forward on March 8th at 2:00 and back
+	// on November 1st at 2:00
+	edt := time.FixedZone("EDT", -4*60*60)
+	est := time.FixedZone("EST", -5*60*60)
+
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time // Zero if the schedule never fires
+	}{
+		{"step", "*/15 * * * *", time.Date(2026, 10, 16, 10, 7, 30, 0, time.UTC), utc(2026, 10, 16, 10, 15)},
+		{"not at from itself", "0 3 * * *", utc(2026, 10, 16, 3, 0), utc(2026, 10, 17, 3, 0)},
+		{"hour rollover", "0 * * * *", utc(2026, 10, 16, 23, 30), utc(2026, 10, 17, 0, 0)},
+		{"month rollover", "0 0 31 * *", utc(2026, 4, 15, 12, 0), utc(2026, 5, 31, 0, 0)},
+		{"year rollover", "0 0 1 1 *", utc(2026, 12, 31, 23, 59), utc(2027, 1, 1, 0, 0)},
+		{"leap day", "0 0 29 2 *", utc(2026, 3, 1, 0, 0), utc(2028, 2, 29, 0, 0)},
+		{"never", "0 0 30 2 *", utc(2026, 1, 1, 0, 0), time.Time{}},
+		{"day of week", "0 3 * * sun", utc(2026, 10, 16, 12, 0), utc(2026, 10, 18, 3, 0)},
+		{"sunday as 7", "0 3 * * 7", utc(2026, 10, 16, 12, 0), utc(2026, 10, 18, 3, 0)},
+
+		// Both day fields restricted: either one matching is enough
+		{"friday before the 13th", "0 0 13 * 5", utc(2026, 10, 3, 12, 0), utc(2026, 10, 9, 0, 0)},
+		{"13th before friday", "0 0 13 * 5", utc(2026, 10, 9, 12, 0), utc(2026, 10, 13, 0, 0)},
+		// A day field starting with "*" isn't restricted, so both must match:
+		// Mondays falling on an odd day of the month
+		{"step day of month and weekday", "0 0 */2 * 1", utc(2026, 10, 1, 12, 0), utc(2026, 10, 5, 0, 0)},
+		{"step day of month skips even", "0 0 */2 * 1", utc(2026, 10, 5, 12, 0), utc(2026, 10, 19, 0, 0)},
+
+		// 2:30 doesn't exist on March 8th; it fires as the clocks reach it
+		{"spring forward", "30 2 * * *", time.Date(2026, 3, 7, 12, 0, 0, 0, newYork), time.Date(2026, 3, 8, 3, 30, 0, 0, edt)},
+		{"after spring forward", "30 2 * * *", time.Date(2026, 3, 8, 3, 30, 0, 0, newYork), time.Date(2026, 3, 9, 2, 30, 0, 0, edt)},
+		{"hourly over spring forward", "0 * * * *", time.Date(2026, 3, 8, 1, 30, 0, 0, newYork), time.Date(2026, 3, 8, 3, 0, 0, 0, edt)},
+		// 1:30 happens twice on November 1st; it fires once
+		{"fall back", "30 1 * * *", time.Date(2026, 10, 31, 12, 0, 0, 0, newYork), time.Date(2026, 11, 1, 1, 30, 0, 0, edt)},
+		{"after fall back", "30 1 * * *", time.Date(2026, 11, 1, 1, 30, 0, 0, edt), time.Date(2026, 11, 2, 1, 30, 0, 0, est)},
+		{"during the repeated hour", "30 1 * * *", time.Date(2026, 11, 1, 1, 15, 0, 0, est), time.Date(2026, 11, 2, 1, 30, 0, 0, est)},
+		{"daily over fall back", "0 3 * * *", time.Date(2026, 11, 1, 1, 30, 0, 0, edt), time.Date(2026, 11, 1, 3, 0, 0, 0, est)},
+	}
+	for _, test := range tests {
+		schedule, err := Parse(test.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		from := test.from
+		if from.Location() != time.UTC {
+			from = from.In(newYork)
+		}
+		got := schedule.Next(from)
+		if !got.Equal(test.want) {
+			t.Errorf("%s: %q after %v = %v, want %v", test.name, test.spec, from, got, test.want)
+		}
+		if !got.IsZero() && got.Location() != from.Location() {
+			t.Errorf("%s: got %v in %v, want it in %v", test.name, got, got.Location(), from.Location())
+		}
+	}
+}
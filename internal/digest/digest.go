@@ -0,0 +1,240 @@
+// Package digest reads the checksums servers advertise in response headers
+// and checks downloaded files against them.
+package digest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Algorithm names, as used in the Digest header.
+const (
+	MD5    = "md5"
+	SHA1   = "sha-1"
+	SHA256 = "sha-256"
+	SHA512 = "sha-512"
+	CRC32C = "crc32c"
+)
+
+// ErrMismatch is wrapped by the error Failed returns.
+var ErrMismatch = errors.New("checksum mismatch")
+
+// Expected is a checksum the server published for the file.
+type Expected struct {
+	Algorithm string
+	Value     []byte
+	Source    string // Header the value came from
+	Advisory  bool   // Inferred rather than declared, so a mismatch isn't fatal
+}
+
+// FromHeaders collects every checksum found in Content-MD5, Digest,
+// Repr-Digest and x-goog-hash, plus an ETag that looks like a plain MD5.
+func FromHeaders(h http.Header) []Expected {
+	var found []Expected
+
+	if value := h.Get("Content-MD5"); value != "" {
+		if sum, err := base64.StdEncoding.DecodeString(value); err == nil && len(sum) == md5.Size {
+			found = append(found, Expected{Algorithm: MD5, Value: sum, Source: "Content-MD5"})
+		}
+	}
+
+	// RFC 3230: Digest: SHA-256=<base64>, MD5=<base64>
+	for _, p := range pairs(h.Values("Digest")) {
+		alg, value := p.alg, p.value
+		if alg == "sha" {
+			alg = SHA1
+		}
+		if sum, err := base64.StdEncoding.DecodeString(value); err == nil && validSize(alg, sum) {
+			found = append(found, Expected{Algorithm: alg, Value: sum, Source: "Digest"})
+		}
+	}
+
+	// RFC 9530: Repr-Digest: sha-256=:<base64>:
+	for _, p := range pairs(h.Values("Repr-Digest")) {
+		alg, value := p.alg, p.value
+		value = strings.Trim(value, ":")
+		if sum, err := base64.StdEncoding.DecodeString(value); err == nil && validSize(alg, sum) {
+			found = append(found, Expected{Algorithm: alg, Value: sum, Source: "Repr-Digest"})
+		}
+	}
+
+	// Google Cloud Storage: x-goog-hash: crc32c=<base64>,md5=<base64>
+	for _, p := range pairs(h.Values("X-Goog-Hash")) {
+		alg, value := p.alg, p.value
+		if sum, err := base64.StdEncoding.DecodeString(value); err == nil && validSize(alg, sum) {
+			found = append(found, Expected{Algorithm: alg, Value: sum, Source: "x-goog-hash"})
+		}
+	}
+
+	// S3 and several other stores use the MD5 of single-part objects as the
+	// ETag. Multipart ETags carry a "-N" suffix and never match.
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		etag = strings.Trim(etag, `"`)
+		if sum, err := hex.DecodeString(etag); err == nil && len(sum) == md5.Size {
+			found = append(found, Expected{Algorithm: MD5, Value: sum, Source: "ETag", Advisory: true})
+		}
+	}
+
+	return found
+}
+
+type pair struct {
+	alg   string
+	value string
+}
+
+// pairs splits every "alg=value" item across the header values, with the
+// algorithm lowercased.
+func pairs(values []string) []pair {
+	var items []pair
+	for _, header := range values {
+		for _, item := range strings.Split(header, ",") {
+			alg, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if !ok {
+				continue
+			}
+			items = append(items, pair{strings.ToLower(strings.TrimSpace(alg)), strings.TrimSpace(value)})
+		}
+	}
+	return items
+}
+
+func validSize(algorithm string, sum []byte) bool {
+	h := newHash(algorithm)
+	return h != nil && h.Size() == len(sum)
+}
+
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case MD5:
+		return md5.New()
+	case SHA1:
+		return sha1.New()
+	case SHA256:
+		return sha256.New()
+	case SHA512:
+		return sha512.New()
+	case CRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	}
+	return nil
+}
+
+// Hasher computes several digests of the same data in one pass.
+type Hasher struct {
+	hashes map[string]hash.Hash
+	writer io.Writer
+}
+
+// NewHasher returns a hasher for the given algorithms. Unknown names and
+// duplicates are ignored.
+func NewHasher(algorithms ...string) *Hasher {
+	h := &Hasher{hashes: make(map[string]hash.Hash)}
+	var writers []io.Writer
+	for _, algorithm := range algorithms {
+		if _, ok := h.hashes[algorithm]; ok {
+			continue
+		}
+		if hasher := newHash(algorithm); hasher != nil {
+			h.hashes[algorithm] = hasher
+			writers = append(writers, hasher)
+		}
+	}
+	h.writer = io.MultiWriter(writers...)
+	return h
+}
+
+// ForExpected returns a hasher covering SHA-256 and every expected
+// algorithm.
+func ForExpected(expected []Expected) *Hasher {
+	algorithms := []string{SHA256}
+	for _, e := range expected {
+		algorithms = append(algorithms, e.Algorithm)
+	}
+	return NewHasher(algorithms...)
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	return h.writer.Write(p)
+}
+
+// Sum returns the digest for algorithm, or nil if it isn't being computed.
+func (h *Hasher) Sum(algorithm string) []byte {
+	if hasher, ok := h.hashes[algorithm]; ok {
+		return hasher.Sum(nil)
+	}
+	return nil
+}
+
+// Result is the outcome of checking one expected digest.
+type Result struct {
+	Algorithm string `json:"algorithm"`
+	Source    string `json:"source"`
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual"`
+	Match     bool   `json:"match"`
+	Advisory  bool   `json:"advisory,omitempty"`
+}
+
+// Check compares the hasher's digests with the expected ones.
+func Check(expected []Expected, h *Hasher) []Result {
+	results := make([]Result, 0, len(expected))
+	for _, e := range expected {
+		actual := h.Sum(e.Algorithm)
+		results = append(results, Result{
+			Algorithm: e.Algorithm,
+			Source:    e.Source,
+			Expected:  hex.EncodeToString(e.Value),
+			Actual:    hex.EncodeToString(actual),
+			Match:     bytes.Equal(actual, e.Value),
+			Advisory:  e.Advisory,
+		})
+	}
+	return results
+}
+
+// Failed returns an error for the first declared digest that didn't match.
+// Advisory mismatches are ignored.
+func Failed(results []Result) error {
+	for _, r := range results {
+		if !r.Match && !r.Advisory {
+			return fmt.Errorf("%s %w (from %s): expected %s, got %s", r.Algorithm, ErrMismatch, r.Source, r.Expected, r.Actual)
+		}
+	}
+	return nil
+}
+
+// Parse reads a checksum given as "algorithm:hex", such as
+// "sha256:9f86d081...". md5, sha1, sha256 and sha512 are accepted, with or
+// without the dash.
+func Parse(value string) (Expected, error) {
+	name, sum, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok {
+		return Expected{}, fmt.Errorf("invalid checksum %q: expected algorithm:hex, such as sha256:9f86d081...", value)
+	}
+	algorithm := strings.ToLower(name)
+	switch algorithm {
+	case "sha1", "sha256", "sha512":
+		algorithm = "sha-" + algorithm[3:]
+	}
+	if algorithm != MD5 && algorithm != SHA1 && algorithm != SHA256 && algorithm != SHA512 {
+		return Expected{}, fmt.Errorf("unsupported checksum algorithm %q: use md5, sha1, sha256 or sha512", name)
+	}
+	decoded, err := hex.DecodeString(sum)
+	if err != nil || !validSize(algorithm, decoded) {
+		return Expected{}, fmt.Errorf("invalid %s checksum %q", name, sum)
+	}
+	return Expected{Algorithm: algorithm, Value: decoded, Source: "checksum"}, nil
+}
@@ -0,0 +1,88 @@
+// Package directio writes files while bypassing the page cache, so very large
+// downloads don't evict the working set of other processes on the host.
+//
+// Direct writes must be aligned in offset, length and memory; Writer takes
+// care of that as long as it starts at an aligned offset.
+package directio
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+const (
+	// AlignSize is the offset, length and memory alignment of every write.
+	AlignSize = 4096
+	// BlockSize is the amount buffered before each write.
+	BlockSize = 1 << 20
+)
+
+// AlignedBlock returns a zeroed buffer of size bytes whose first byte is
+// AlignSize-aligned in memory.
+func AlignedBlock(size int) []byte {
+	buf := make([]byte, size+AlignSize)
+	shift := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & (AlignSize - 1)); rem != 0 {
+		shift = AlignSize - rem
+	}
+	return buf[shift : shift+size : shift+size]
+}
+
+// Writer writes sequentially from an aligned offset of a file opened with
+// OpenFile.
+type Writer struct {
+	file   *os.File
+	offset int64
+	buf    []byte
+	n      int
+}
+
+func NewWriter(file *os.File, offset int64) (*Writer, error) {
+	if offset%AlignSize != 0 {
+		return nil, fmt.Errorf("direct I/O offset %d is not %d-byte aligned", offset, AlignSize)
+	}
+	return &Writer{
+		file:   file,
+		offset: offset,
+		buf:    AlignedBlock(BlockSize),
+	}, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		copied := copy(w.buf[w.n:], p)
+		w.n += copied
+		written += copied
+		p = p[copied:]
+
+		if w.n == len(w.buf) {
+			if err := w.writeBlock(w.n); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Flush writes any buffered data, zero-padding it to a whole number of
+// aligned blocks. Only the writer at the end of the file may end on a
+// partial block; the caller truncates the padding away afterwards.
+func (w *Writer) Flush() error {
+	if w.n == 0 {
+		return nil
+	}
+	padded := (w.n + AlignSize - 1) &^ (AlignSize - 1)
+	clear(w.buf[w.n:padded])
+	return w.writeBlock(padded)
+}
+
+func (w *Writer) writeBlock(length int) error {
+	if _, err := w.file.WriteAt(w.buf[:length], w.offset); err != nil {
+		return err
+	}
+	w.offset += int64(w.n)
+	w.n = 0
+	return nil
+}
@@ -0,0 +1,22 @@
+package directio
+
+import (
+	"os"
+	"syscall"
+)
+
+// Supported reports whether OpenFile actually bypasses the page cache.
+const Supported = true
+
+// OpenFile opens the named file and disables caching with F_NOCACHE.
+func OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	file, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, file.Fd(), syscall.F_NOCACHE, 1); errno != 0 {
+		file.Close()
+		return nil, errno
+	}
+	return file, nil
+}
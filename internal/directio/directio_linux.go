@@ -0,0 +1,14 @@
+package directio
+
+import (
+	"os"
+	"syscall"
+)
+
+// Supported reports whether OpenFile actually bypasses the page cache.
+const Supported = true
+
+// OpenFile opens the named file with O_DIRECT.
+func OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(name, flag|syscall.O_DIRECT, perm)
+}
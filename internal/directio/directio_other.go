@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package directio
+
+import "os"
+
+// Supported reports whether OpenFile actually bypasses the page cache.
+const Supported = false
+
+// OpenFile falls back to a regular buffered open on this platform.
+func OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(name, flag, perm)
+}
@@ -0,0 +1,13 @@
+// Package diskspace reports how much room is left on a file system.
+package diskspace
+
+import "errors"
+
+// ErrUnsupported is returned by Get on platforms without an implementation.
+var ErrUnsupported = errors.New("disk space is not available on this platform")
+
+// Usage describes the file system holding a path.
+type Usage struct {
+	Total uint64 `json:"total"` // Bytes
+	Free  uint64 `json:"free"`  // Bytes available to unprivileged users
+}
@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd)
+
+package diskspace
+
+// Get always fails on this platform.
+func Get(path string) (Usage, error) {
+	return Usage{}, ErrUnsupported
+}
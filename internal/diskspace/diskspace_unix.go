@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd
+
+package diskspace
+
+import "syscall"
+
+// Get reports the size and free space of the file system holding path.
+func Get(path string) (Usage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Usage{}, err
+	}
+	return Usage{
+		Total: uint64(st.Blocks) * uint64(st.Bsize),
+		Free:  uint64(st.Bavail) * uint64(st.Bsize),
+	}, nil
+}
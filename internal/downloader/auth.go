@@ -0,0 +1,16 @@
+package downloader
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// authorize adds the download's headers, and its cookie and credentials
+// unless req goes to a mirror on another host.
+func (d *Download) authorize(req *http.Request) {
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return
+	}
+	d.Auth.Apply(req, u.Host)
+}
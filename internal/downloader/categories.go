@@ -0,0 +1,181 @@
+package downloader
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+)
+
+// DefaultCategoriesFile is where categories are saved, relative to the
+// server's working directory like the jobs file.
+const DefaultCategoriesFile = "categories.json"
+
+// categoryName is what a category may be called, so its name fits in a URL
+// path as is.
+var categoryName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Category groups downloads, such as "linux-isos" or "videos", and gives
+// those added to it their directory and defaults.
+type Category struct {
+	Name string `json:"name"`
+	// Dir is where the category's downloads are saved. A relative path is
+	// inside the downloads directory; empty saves them in it.
+	Dir string `json:"dir,omitempty"`
+	// Chunks and RateLimit apply to downloads added without their own; 0
+	// leaves the server's.
+	Chunks    int   `json:"chunks,omitempty"`
+	RateLimit int64 `json:"rateLimit,omitempty"` // Bytes/s for each download
+}
+
+// validate checks the category.
+func (c *Category) validate() error {
+	if !categoryName.MatchString(c.Name) {
+		return errors.New("category name must be letters, digits, '.', '_' and '-', starting with a letter or digit")
+	}
+	if c.Dir != "" && !filepath.IsAbs(c.Dir) && !filepath.IsLocal(c.Dir) {
+		return errors.New("category dir must be an absolute path or one inside the downloads directory")
+	}
+	if c.Chunks < 0 {
+		return errors.New("category chunks must be at least 0, 0 for the server's default")
+	}
+	if c.RateLimit < 0 {
+		return errNegativeRateLimit
+	}
+	return nil
+}
+
+// dir returns where the category's downloads are saved.
+func (c *Category) dir() string {
+	switch {
+	case c.Dir == "":
+		return downloadsDir()
+	case filepath.IsAbs(c.Dir):
+		return filepath.Clean(c.Dir)
+	}
+	return filepath.Join(downloadsDir(), c.Dir)
+}
+
+// PutCategory adds a category, or replaces the one of the same name.
+// Downloads already in it keep the directory and defaults they were added
+// with.
+func (m *Manager) PutCategory(c Category) (Category, error) {
+	if err := c.validate(); err != nil {
+		return Category{}, err
+	}
+	m.categoriesMu.Lock()
+	defer m.categoriesMu.Unlock()
+	m.categories[c.Name] = &c
+	m.saveCategories()
+	return c, nil
+}
+
+// Categories returns every category, by name.
+func (m *Manager) Categories() []Category {
+	m.categoriesMu.Lock()
+	defer m.categoriesMu.Unlock()
+	categories := make([]Category, 0, len(m.categories))
+	for _, c := range m.categories {
+		categories = append(categories, *c)
+	}
+	slices.SortFunc(categories, func(a, b Category) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return categories
+}
+
+// GetCategory returns the category called name.
+func (m *Manager) GetCategory(name string) (Category, error) {
+	m.categoriesMu.Lock()
+	defer m.categoriesMu.Unlock()
+	c, ok := m.categories[name]
+	if !ok {
+		return Category{}, fmt.Errorf("category not found")
+	}
+	return *c, nil
+}
+
+// DeleteCategory removes a category. Its downloads keep their files and
+// the category's name.
+func (m *Manager) DeleteCategory(name string) error {
+	m.categoriesMu.Lock()
+	defer m.categoriesMu.Unlock()
+	if _, ok := m.categories[name]; !ok {
+		return fmt.Errorf("category not found")
+	}
+	delete(m.categories, name)
+	m.saveCategories()
+	return nil
+}
+
+// category looks up the category a download is added to; an empty name is
+// none.
+func (m *Manager) category(name string) (*Category, error) {
+	if name == "" {
+		return nil, nil
+	}
+	c, err := m.GetCategory(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown category %q", name)
+	}
+	return &c, nil
+}
+
+// LoadCategories reads the categories saved in m.CategoriesFile. A missing
+// file is not an error.
+func (m *Manager) LoadCategories() error {
+	if m.CategoriesFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.CategoriesFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var categories []*Category
+	if err := json.Unmarshal(data, &categories); err != nil {
+		return fmt.Errorf("invalid categories file %s: %v", m.CategoriesFile, err)
+	}
+
+	m.categoriesMu.Lock()
+	defer m.categoriesMu.Unlock()
+	for _, c := range categories {
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("invalid category %q in %s: %v", c.Name, m.CategoriesFile, err)
+		}
+		m.categories[c.Name] = c
+	}
+	return nil
+}
+
+// saveCategories writes every category to m.CategoriesFile. The caller
+// holds m.categoriesMu.
+func (m *Manager) saveCategories() {
+	if m.CategoriesFile == "" {
+		return
+	}
+	categories := make([]*Category, 0, len(m.categories))
+	for _, c := range m.categories {
+		categories = append(categories, c)
+	}
+	slices.SortFunc(categories, func(a, b *Category) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	data, err := json.MarshalIndent(categories, "", "  ")
+	if err == nil {
+		tmp := m.CategoriesFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, m.CategoriesFile)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to save categories to %s: %v", m.CategoriesFile, err)
+	}
+}
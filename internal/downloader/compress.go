@@ -0,0 +1,47 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/govind1331/Datablip/internal/compress"
+)
+
+// compress replaces the finished file with a copy compressed as
+// d.Compress, which becomes the download's output.
+func (m *Manager) compress(d *Download) error {
+	m.startStage(d, StatusCompressing)
+
+	info, err := os.Stat(d.OutputPath)
+	if err != nil {
+		return err
+	}
+	format := compress.Format(d.Compress)
+	dest := d.OutputPath + format.Extension()
+	tmp := dest + PartSuffix
+	os.Remove(tmp)
+	progress := &stageProgress{m: m, d: d, total: info.Size()}
+	err = compress.File(d.ctx, d.OutputPath, tmp, format, compress.Progress{Bytes: progress.add})
+	if err == nil {
+		// A monitored download's earlier copy is replaced
+		err = os.Rename(tmp, dest)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("%s compression failed: %v", d.Compress, err)
+	}
+	if err := os.Remove(d.OutputPath); err != nil {
+		d.logf("Could not remove %s after compressing it: %v", d.OutputPath, err)
+	}
+
+	compressed, err := os.Stat(dest)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.OutputPath = dest
+	d.CompressedSize = compressed.Size()
+	d.mu.Unlock()
+	d.logf("Compressed %s with %s: %d to %d bytes", d.Filename, d.Compress, info.Size(), compressed.Size())
+	return nil
+}
@@ -0,0 +1,116 @@
+package downloader
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/conflict"
+	"github.com/govind1331/Datablip/internal/directio"
+)
+
+// resolveConflict applies d's conflict policy if its output file already
+// exists, before anything is written: the download is saved under a numbered
+// name, replaces the file once verified, carries on from the file's bytes, or
+// fails. A download already under way, or a monitored one fetched again,
+// keeps its file.
+func (m *Manager) resolveConflict(d *Download, ranges bool) error {
+	if d.Refreshes > 0 {
+		return nil
+	}
+	if _, err := os.Lstat(partPath(d)); err == nil {
+		return nil
+	}
+	info, err := os.Stat(d.OutputPath)
+	if err != nil {
+		return nil
+	}
+	policy, err := conflict.Parse(cmp.Or(d.OnConflict, string(m.OnConflict)))
+	if err != nil {
+		return err
+	}
+
+	switch policy {
+	case conflict.Overwrite:
+		d.logf("Overwriting %s once the download is verified", d.OutputPath)
+	case conflict.Fail:
+		return fmt.Errorf("%s already exists", d.OutputPath)
+	case conflict.Resume:
+		return m.adoptOutput(d, info.Size(), ranges)
+	default:
+		existing, base := d.OutputPath, filepath.Base(d.OutputPath)
+		m.mu.Lock()
+		name := m.freeName(d, base, true)
+		outputPath := filepath.Join(filepath.Dir(d.OutputPath), name)
+		d.mu.Lock()
+		d.Filename = strings.TrimSuffix(d.Filename, base) + name
+		d.OutputPath = outputPath
+		d.PartPath = outputPath + PartSuffix
+		d.localPath = outputPath
+		d.mu.Unlock()
+		m.mu.Unlock()
+		d.logf("%s already exists; saving as %s", existing, name)
+		m.save(d)
+	}
+	return nil
+}
+
+// adoptOutput makes an existing output file of size bytes the part file of
+// d, with a control file saying its bytes are the start of the download, so
+// the download fetches only the rest and verifies the whole.
+func (m *Manager) adoptOutput(d *Download, size int64, ranges bool) error {
+	switch {
+	case m.ChunkFiles:
+		return fmt.Errorf("%s already exists and can't be resumed with chunk files", d.OutputPath)
+	case !ranges || d.TotalSize <= 0:
+		return fmt.Errorf("%s already exists and can't be resumed: the server doesn't support range requests or send a size", d.OutputPath)
+	case size > d.TotalSize:
+		return fmt.Errorf("%s already exists and is larger than the download (%d > %d bytes)", d.OutputPath, size, d.TotalSize)
+	}
+
+	sizes, prioritized, direct := []int64{d.TotalSize}, false, false
+	if d.Chunks != 1 {
+		direct = m.useDirectIO(d)
+		sizes, prioritized = m.layoutChunks(d, direct)
+	}
+	c := control{
+		Version:     controlVersion,
+		URL:         d.URL,
+		OutputPath:  d.OutputPath,
+		TotalSize:   d.TotalSize,
+		Prioritized: prioritized,
+		Chunks:      sizes,
+		Done:        make([]int64, len(sizes)),
+		UpdatedAt:   time.Now(),
+	}
+	if d.Remote != nil {
+		c.ETag, c.LastModified = d.Remote.ETag, d.Remote.LastModified
+	}
+	var start int64
+	for i, chunk := range sizes {
+		done := min(max(size-start, 0), chunk)
+		if direct && done < chunk {
+			done &^= directio.AlignSize - 1
+		}
+		c.Done[i] = done
+		start += chunk
+	}
+
+	// The part file is preallocated, as control files expect
+	if err := os.Rename(d.OutputPath, partPath(d)); err != nil {
+		return fmt.Errorf("failed to resume from %s: %v", d.OutputPath, err)
+	}
+	err := os.Truncate(partPath(d), d.TotalSize)
+	if err == nil {
+		err = writeControl(d, c)
+	}
+	if err != nil {
+		os.Rename(partPath(d), d.OutputPath)
+		return fmt.Errorf("failed to resume from %s: %v", d.OutputPath, err)
+	}
+	d.logf("%s already exists; resuming from its %d bytes", d.OutputPath, size)
+	return nil
+}
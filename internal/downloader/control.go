@@ -0,0 +1,173 @@
+package downloader
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/directio"
+)
+
+const (
+	// ControlSuffix names the file kept next to a part file that records
+	// how far each chunk got, so a download added again after a restart
+	// carries on in the part file instead of starting over.
+	ControlSuffix = ".datablip"
+
+	// controlVersion versions the control file format.
+	controlVersion = 1
+
+	// controlInterval is how often a running download's control file is
+	// rewritten.
+	controlInterval = 2 * time.Second
+)
+
+// control is the content of a control file.
+type control struct {
+	Version      int       `json:"version"`
+	URL          string    `json:"url"`
+	OutputPath   string    `json:"outputPath"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	TotalSize    int64     `json:"totalSize"`
+	Prioritized  bool      `json:"prioritized,omitempty"` // The first and last chunks are fetched first
+	Chunks       []int64   `json:"chunks"`                // Sizes, in file order
+	Done         []int64   `json:"done"`                  // Bytes in the part file from each chunk's start
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+func controlPath(d *Download) string {
+	return partPath(d) + ControlSuffix
+}
+
+// loadControl returns the progress recorded for d's part file, if it is for
+// the same remote file and fits the chunk alignment. Anything stale is
+// removed.
+func loadControl(d *Download, direct bool) *control {
+	data, err := os.ReadFile(controlPath(d))
+	if err != nil {
+		return nil
+	}
+	var c control
+	if err := json.Unmarshal(data, &c); err != nil || !c.resumes(d, direct) {
+		d.logf("Discarding stale progress in %s", controlPath(d))
+		removeControl(d)
+		return nil
+	}
+	return &c
+}
+
+// resumes reports whether c describes d's remote file and a part file that
+// still holds the bytes it records.
+func (c *control) resumes(d *Download, direct bool) bool {
+	remote := d.Remote
+	if c.Version != controlVersion || c.URL != d.URL || c.TotalSize != d.TotalSize ||
+		len(c.Chunks) == 0 || len(c.Done) != len(c.Chunks) || remote == nil {
+		return false
+	}
+	if (c.ETag != "" && remote.ETag != "" && c.ETag != remote.ETag) ||
+		(c.LastModified != "" && remote.LastModified != "" && c.LastModified != remote.LastModified) {
+		return false
+	}
+	info, err := os.Stat(partPath(d))
+	if err != nil {
+		return false
+	}
+	var start int64
+	for i, size := range c.Chunks {
+		if size <= 0 || c.Done[i] < 0 || c.Done[i] > size || (direct && start%directio.AlignSize != 0) ||
+			start+c.Done[i] > info.Size() {
+			return false
+		}
+		start += size
+	}
+	return start == d.TotalSize
+}
+
+// saveControl records how many bytes of each chunk are in the part file.
+// Direct I/O holds up to a block per chunk in memory before writing it, so
+// that much less is claimed for those downloads.
+func saveControl(d *Download, prioritized, direct bool) error {
+	d.mu.RLock()
+	c := control{
+		Version:     controlVersion,
+		URL:         d.URL,
+		OutputPath:  d.OutputPath,
+		TotalSize:   d.TotalSize,
+		Prioritized: prioritized,
+		Chunks:      d.chunkSizes,
+		Done:        make([]int64, len(d.chunkBytes)),
+		UpdatedAt:   time.Now(),
+	}
+	if d.Remote != nil {
+		c.ETag, c.LastModified = d.Remote.ETag, d.Remote.LastModified
+	}
+	for i := range d.chunkBytes {
+		done := atomic.LoadInt64(&d.chunkBytes[i])
+		if direct && done < c.Chunks[i] {
+			done = max(done-directio.BlockSize, 0) &^ (directio.AlignSize - 1)
+		}
+		c.Done[i] = done
+	}
+	d.mu.RUnlock()
+	return writeControl(d, c)
+}
+
+// writeControl replaces d's control file with c.
+func writeControl(d *Download, c control) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := controlPath(d) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, controlPath(d))
+}
+
+func removeControl(d *Download) {
+	os.Remove(controlPath(d))
+}
+
+// keepControl rewrites d's control file every controlInterval until stop is
+// closed, then once more unless the part file is gone. Meanwhile d.record
+// rewrites it on demand.
+func keepControl(d *Download, prioritized, direct bool, stop <-chan struct{}) {
+	var saving sync.Mutex
+	save := func() error {
+		saving.Lock()
+		defer saving.Unlock()
+		return saveControl(d, prioritized, direct)
+	}
+	d.mu.Lock()
+	d.record = save
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.record = nil
+		d.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(controlInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := save(); err != nil {
+				d.logf("Failed to record progress: %v", err)
+			}
+		case <-stop:
+			if _, err := os.Stat(partPath(d)); err != nil {
+				removeControl(d)
+				return
+			}
+			if err := save(); err != nil {
+				d.logf("Failed to record progress: %v", err)
+			}
+			return
+		}
+	}
+}
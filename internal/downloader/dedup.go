@@ -0,0 +1,57 @@
+package downloader
+
+import (
+	"fmt"
+
+	"github.com/govind1331/Datablip/internal/urlnorm"
+)
+
+// DuplicateError is returned by AddDownload when an unfinished download
+// already fetches the same URL.
+type DuplicateError struct {
+	URL string
+	ID  string // The download already queued
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("%s is already queued as download %s", e.URL, e.ID)
+}
+
+// NormalizeURL returns the form of url downloads are queued and matched by.
+func (m *Manager) NormalizeURL(url string) (string, error) {
+	return urlnorm.Normalize(url, m.URLRules)
+}
+
+// findUnfinished returns the download of url that hasn't settled yet, if
+// any. The caller holds m.mu and url is normalized.
+func (m *Manager) findUnfinished(url string) *Download {
+	for _, d := range m.downloads {
+		if d.URL != url {
+			continue
+		}
+		select {
+		case <-d.settled.ch:
+		default:
+			return d
+		}
+	}
+	return nil
+}
+
+// DownloadsByURL returns every download of url, finished or not, however
+// the URL is spelled.
+func (m *Manager) DownloadsByURL(url string) ([]*Download, error) {
+	normalized, err := m.NormalizeURL(url)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matches []*Download
+	for _, d := range m.downloads {
+		if d.URL == normalized {
+			matches = append(matches, d)
+		}
+	}
+	return matches, nil
+}
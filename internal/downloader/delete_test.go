@@ -0,0 +1,86 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stallingReader serves its data up to limit, then blocks until ctx is
+// done, like a server that stops sending halfway.
+type stallingReader struct {
+	*bytes.Reader
+	ctx   context.Context
+	limit int64
+}
+
+func (r *stallingReader) Read(p []byte) (int, error) {
+	pos := r.Size() - int64(r.Len())
+	if pos >= r.limit {
+		<-r.ctx.Done()
+		return 0, r.ctx.Err()
+	}
+	if int64(len(p)) > r.limit-pos {
+		p = p[:r.limit-pos]
+	}
+	return r.Reader.Read(p)
+}
+
+func TestDeletePausedDownloadRemovesPartialData(t *testing.T) {
+	data := bytes.Repeat([]byte("datablip"), 512<<10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content := &stallingReader{Reader: bytes.NewReader(data), ctx: r.Context(), limit: int64(len(data) / 4)}
+		http.ServeContent(w, r, "file.bin", time.Time{}, content)
+	}))
+	defer server.Close()
+
+	root := t.TempDir()
+	withDownloadsDir(t, filepath.Join(root, "downloads"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx)
+	m.StatsFile, m.UsageFile, m.HostStatsFile = "", "", ""
+
+	d, err := m.AddDownload(server.URL+"/file.bin", AddOptions{Filename: "file.bin", Chunks: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := func() int64 {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+		return d.bytesReceived()
+	}
+	for deadline := time.Now().Add(30 * time.Second); received() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the download to receive data")
+		}
+	}
+	if err := m.PauseDownload(d.ID); err != nil {
+		t.Fatal(err)
+	}
+	if status := d.status(); status != StatusPaused {
+		t.Fatalf("got status %s after pausing, want %s", status, StatusPaused)
+	}
+	_, outputPath, _ := d.Output()
+	part := outputPath + PartSuffix
+	if _, err := os.Stat(part); err != nil {
+		t.Fatalf("paused download has no part file: %v", err)
+	}
+	if err := saveControl(d, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.DeleteDownload(d.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{part, part + ControlSuffix, outputPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s is left after deleting the paused download (%v)", path, err)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/compress"
+	"github.com/govind1331/Datablip/internal/conflict"
+	"github.com/govind1331/Datablip/internal/extract"
+	"github.com/govind1331/Datablip/internal/upload"
+)
+
+const (
+	// DefaultUploadRetries is how many times a failed upload is retried.
+	DefaultUploadRetries = 3
+
+	// uploadBackoff is the wait before the first retry; it doubles after
+	// each further failure.
+	uploadBackoff = 5 * time.Second
+)
+
+// Delivery says what happens to a download once it has been verified and
+// saved under its final name, and what if a file already has that name.
+type Delivery struct {
+	UploadTo          string `json:"uploadTo,omitempty"` // s3://bucket/prefix or an rclone remote:path
+	DeleteAfterUpload bool   `json:"deleteAfterUpload,omitempty"`
+	MoveTo            string `json:"moveTo,omitempty"`     // Directory the file ends up in, such as a NAS mount
+	KeepLocal         bool   `json:"keepLocal,omitempty"`  // Copy to MoveTo rather than move
+	ExtractTo         string `json:"extractTo,omitempty"`  // Directory a zip or tar download is unpacked into
+	Compress          string `json:"compress,omitempty"`   // "gzip" or "zstd" replaces the file with a compressed copy
+	Monitor           string `json:"monitor,omitempty"`    // How often to check the source and download it again if it changed, such as "1h"
+	OnConflict        string `json:"onConflict,omitempty"` // "rename", "overwrite", "resume" or "fail" if the file already exists; the server's default when empty
+}
+
+// Validate reports a delivery that can't be carried out.
+func (dl Delivery) Validate() error {
+	if strings.HasPrefix(dl.UploadTo, "-") {
+		return fmt.Errorf("uploadTo must not start with \"-\"")
+	}
+	if dl.UploadTo != "" {
+		if _, err := upload.New(dl.UploadTo); err != nil {
+			return err
+		}
+	}
+	if dl.DeleteAfterUpload && dl.UploadTo == "" {
+		return fmt.Errorf("deleteAfterUpload needs uploadTo")
+	}
+	if dl.DeleteAfterUpload && dl.MoveTo != "" {
+		return fmt.Errorf("deleteAfterUpload leaves nothing to move to moveTo")
+	}
+	if dl.KeepLocal && dl.MoveTo == "" {
+		return fmt.Errorf("keepLocal needs moveTo")
+	}
+	if dl.Compress != "" {
+		if err := compress.Format(dl.Compress).Validate(); err != nil {
+			return err
+		}
+	}
+	if _, err := conflict.Parse(dl.OnConflict); err != nil {
+		return err
+	}
+	if dl.Monitor != "" {
+		interval, err := time.ParseDuration(dl.Monitor)
+		if err != nil {
+			return fmt.Errorf("invalid monitor interval: %v", err)
+		}
+		if interval < MinMonitorInterval {
+			return fmt.Errorf("monitor interval must be at least %v", MinMonitorInterval)
+		}
+	}
+	return nil
+}
+
+// validateFor also checks the delivery against the download's file name.
+// Archives are recognised by their extension, so extracting needs a name.
+func (dl Delivery) validateFor(filename string) error {
+	if dl.ExtractTo != "" {
+		if _, ok := extract.Detect(filename); !ok {
+			return fmt.Errorf("extractTo needs a filename ending in .zip, .tar, .tar.gz or .tar.bz2")
+		}
+	}
+	return nil
+}
+
+// deliver runs the download's delivery stages and marks it completed, or
+// failed if a stage fails. A scan comes first so nothing infected leaves
+// the download directory, extraction comes before the archive can be
+// compressed, deleted or moved, compression before the file is delivered,
+// and uploads read from the scratch directory rather than the final
+// destination.
+func (m *Manager) deliver(d *Download) {
+	if m.Scanner != nil {
+		clean, err := m.scan(d)
+		if err != nil {
+			m.failDownload(d, fmt.Errorf("scan failed: %v", err))
+			return
+		}
+		if !clean {
+			return
+		}
+	}
+	m.describeMedia(d)
+	m.route(d)
+	if d.ExtractTo != "" {
+		if err := m.extract(d); err != nil {
+			m.failDownload(d, err)
+			return
+		}
+	}
+	if d.Compress != "" {
+		if err := m.compress(d); err != nil {
+			m.failDownload(d, err)
+			return
+		}
+	}
+	if d.UploadTo != "" {
+		if err := m.upload(d); err != nil {
+			m.failDownload(d, err)
+			return
+		}
+	}
+	if d.MoveTo != "" {
+		if err := m.moveToDestination(d); err != nil {
+			m.failDownload(d, fmt.Errorf("delivery to %s failed: %v", d.MoveTo, err))
+			return
+		}
+	}
+
+	d.mu.Lock()
+	d.Status = StatusCompleted
+	d.refreshProgress()
+	d.Progress = 100
+	d.Speed, d.TimeRemaining = 0, 0
+	d.mu.Unlock()
+	m.broadcastUpdate(DownloadUpdate{
+		DownloadID: d.ID,
+		Type:       "completed",
+		Data:       d,
+	})
+}
+
+func (m *Manager) failDownload(d *Download, err error) {
+	d.mu.Lock()
+	d.Status = failedStatus(err)
+	d.Error = err.Error()
+	d.mu.Unlock()
+	m.broadcastUpdate(DownloadUpdate{
+		DownloadID: d.ID,
+		Type:       "error",
+		Data:       d,
+	})
+}
+
+// startStage moves the download into a delivery stage, reported through
+// its status.
+func (m *Manager) startStage(d *Download, status DownloadStatus) {
+	d.mu.Lock()
+	d.Status = status
+	d.StageProgress = 0
+	d.mu.Unlock()
+	m.broadcastUpdate(DownloadUpdate{
+		DownloadID: d.ID,
+		Type:       "status",
+		Data:       d,
+	})
+}
+
+// stageProgress counts bytes passing through a delivery stage and publishes
+// the stage's progress.
+type stageProgress struct {
+	m     *Manager
+	d     *Download
+	total int64
+	done  int64
+}
+
+func (p *stageProgress) add(n int64) {
+	done := atomic.AddInt64(&p.done, n)
+	if p.total > 0 {
+		p.d.mu.Lock()
+		p.d.StageProgress = float64(done) / float64(p.total) * 100
+		p.d.mu.Unlock()
+	}
+	p.m.publishProgress(p.d)
+}
+
+type stageReader struct {
+	r        io.Reader
+	progress *stageProgress
+}
+
+func (r *stageReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.progress.add(int64(n))
+	return n, err
+}
+
+// upload sends the finished file to d.UploadTo, retrying with backoff, and
+// removes the local copy afterwards if asked to.
+func (m *Manager) upload(d *Download) error {
+	uploader, err := upload.New(d.UploadTo)
+	if err != nil {
+		return err
+	}
+	m.startStage(d, StatusUploading)
+
+	backoff := uploadBackoff
+	for attempt := 0; ; attempt++ {
+		var location string
+		location, err = m.uploadOnce(d, uploader)
+		if err == nil {
+			d.mu.Lock()
+			d.UploadedTo = location
+			d.mu.Unlock()
+			d.logf("Uploaded %s to %s", d.Filename, location)
+			break
+		}
+		if d.ctx.Err() != nil || attempt >= m.UploadRetries {
+			return fmt.Errorf("upload to %s failed: %v", d.UploadTo, err)
+		}
+
+		d.logf("Upload of %s failed, retrying in %v: %v", d.Filename, backoff, err)
+		select {
+		case <-d.ctx.Done():
+			return fmt.Errorf("upload to %s failed: %v", d.UploadTo, d.ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	if d.DeleteAfterUpload {
+		if err := os.Remove(d.OutputPath); err != nil {
+			return fmt.Errorf("uploaded, but failed to delete local copy: %v", err)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) uploadOnce(d *Download, uploader upload.Uploader) (string, error) {
+	file, err := os.Open(d.OutputPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	progress := &stageProgress{m: m, d: d, total: info.Size()}
+	progress.add(0)
+	body := &stageReader{r: file, progress: progress}
+	return uploader.Upload(d.ctx, body, info.Size(), filepath.Base(d.OutputPath))
+}
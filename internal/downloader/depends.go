@@ -0,0 +1,63 @@
+package downloader
+
+import (
+	"fmt"
+	"sync"
+)
+
+// settled is closed once a download reaches a final state, releasing the
+// downloads that depend on it.
+type settled struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func newSettled() *settled {
+	return &settled{ch: make(chan struct{})}
+}
+
+func (s *settled) close() {
+	s.once.Do(func() { close(s.ch) })
+}
+
+// finalUpdates are the update types announcing that a download is done,
+// one way or another.
+var finalUpdates = map[string]bool{
+	"completed":   true,
+	"error":       true,
+	"quarantined": true,
+}
+
+// resolveDependencies looks up the downloads ids name. The caller holds
+// m.mu. Dependencies must already exist, which also rules out cycles.
+func (m *Manager) resolveDependencies(ids []string) ([]*Download, error) {
+	deps := make([]*Download, 0, len(ids))
+	for _, id := range ids {
+		dep, ok := m.downloads[id]
+		if !ok {
+			return nil, fmt.Errorf("dependency %s not found", id)
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// awaitDependencies blocks until every download d depends on has settled,
+// and fails unless they all completed.
+func (m *Manager) awaitDependencies(d *Download) error {
+	for _, dep := range d.deps {
+		select {
+		case <-dep.settled.ch:
+		case <-d.ctx.Done():
+			return fmt.Errorf("cancelled while waiting for %s", dep.ID)
+		}
+
+		dep.mu.RLock()
+		status, filename := dep.Status, dep.Filename
+		dep.mu.RUnlock()
+		if status != StatusCompleted {
+			return fmt.Errorf("dependency %s (%s) did not complete: %s", dep.ID, filename, status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/endgame"
+)
+
+// runEndgame watches a chunked download until stop is closed. Once the
+// download is nearly complete, any chunk moving at less than half the
+// typical per-connection speed gets a helper connection for the rest of its
+// range; whichever connection finishes first completes the chunk.
+func (m *Manager) runEndgame(d *Download, sink outputSink, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	started := time.Now()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if d.pause.Paused() {
+			continue
+		}
+		received := d.bytesReceived()
+		if d.TotalSize <= 0 || float64(received) < endgame.Threshold*float64(d.TotalSize) {
+			continue
+		}
+
+		elapsed := time.Since(started).Seconds()
+		typical := float64(received) / elapsed / float64(d.Chunks)
+
+		for i := range d.races {
+			d.mu.RLock()
+			race, handedOff := d.races[i], d.tails[i] != nil
+			d.mu.RUnlock()
+			if race == nil || race.Helping() || handedOff {
+				continue
+			}
+
+			done := atomic.LoadInt64(&d.chunkBytes[i])
+			if !endgame.Straggler(d.chunkSizes[i]-done, float64(done)/elapsed, typical) {
+				continue
+			}
+
+			// Helpers only use otherwise idle workers
+			if !m.pool.TryAcquire() {
+				continue
+			}
+
+			chunkIndex := i
+			startByte := d.chunkStart(i)
+			from := startByte + done
+			endByte := startByte + d.chunkSizes[i] - 1
+			helping := race.Help(d.ctx, func(ctx context.Context) error {
+				defer m.pool.Release()
+				ctx, release := d.pause.Track(ctx)
+				defer release()
+				url := d.mirrors.Pick()
+				written, err := m.fetchRange(ctx, d, url, chunkIndex, startByte, from, endByte, sink, nil)
+				d.mirrors.Done(url, err != nil && ctx.Err() == nil)
+				if err != nil {
+					return err
+				}
+				if written != endByte-from+1 {
+					return fmt.Errorf("endgame connection for chunk %d got %d of %d bytes", chunkIndex, written, endByte-from+1)
+				}
+				return nil
+			})
+			if !helping {
+				m.pool.Release()
+				continue
+			}
+			d.logf("Endgame: chunk %d is slow, fetching bytes %d-%d on a second connection", chunkIndex, from, endByte)
+		}
+	}
+}
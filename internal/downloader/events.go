@@ -0,0 +1,56 @@
+package downloader
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultEventHistory is how many recent updates are kept for clients that
+// reconnect and ask for what they missed.
+const DefaultEventHistory = 1024
+
+// events numbers updates and keeps the most recent ones.
+type events struct {
+	mu      sync.Mutex
+	seq     uint64
+	recent  []DownloadUpdate // Oldest first
+	history int
+}
+
+// newEvents numbers updates from the current time in microseconds, so
+// their sequence numbers keep increasing across restarts and those of an
+// earlier run are never taken for this one's.
+func newEvents(history int) *events {
+	return &events{seq: uint64(time.Now().UnixMicro()), history: history}
+}
+
+// add numbers update and keeps it. The caller holds e.mu.
+func (e *events) add(update DownloadUpdate) DownloadUpdate {
+	e.seq++
+	update.Seq = e.seq
+	e.recent = append(e.recent, update)
+	if len(e.recent) > e.history {
+		e.recent = e.recent[len(e.recent)-e.history:]
+	}
+	return update
+}
+
+// EventsSince returns the updates sent after the one numbered seq, oldest
+// first. It returns false if some of them are no longer kept, or if seq is
+// from the future, such as one of another server, in which case the
+// client should fetch every download again.
+func (m *Manager) EventsSince(seq uint64) ([]DownloadUpdate, bool) {
+	m.events.mu.Lock()
+	defer m.events.mu.Unlock()
+	if seq > m.events.seq {
+		return nil, false
+	}
+	if seq == m.events.seq {
+		return nil, true
+	}
+	if len(m.events.recent) == 0 || m.events.recent[0].Seq > seq+1 {
+		return nil, false
+	}
+	first := len(m.events.recent) - int(m.events.seq-seq)
+	return append([]DownloadUpdate(nil), m.events.recent[first:]...), true
+}
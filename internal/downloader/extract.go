@@ -0,0 +1,54 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/govind1331/Datablip/internal/extract"
+)
+
+// extract unpacks the finished archive into d.ExtractTo, reporting each
+// entry as it goes. The archive itself is left in place.
+func (m *Manager) extract(d *Download) error {
+	m.startStage(d, StatusExtracting)
+
+	info, err := os.Stat(d.OutputPath)
+	if err != nil {
+		return err
+	}
+	progress := &stageProgress{m: m, d: d, total: info.Size()}
+	files, err := extract.Extract(d.ctx, d.OutputPath, d.ExtractTo, extract.Progress{
+		Entry: func(name string) {
+			d.mu.Lock()
+			d.Extracting = name
+			d.mu.Unlock()
+			m.publishProgress(d)
+		},
+		Bytes: progress.add,
+		Logf:  d.logf,
+	})
+
+	d.mu.Lock()
+	d.Extracting = ""
+	d.Extracted = files
+	d.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("extraction to %s failed: %v", d.ExtractTo, err)
+	}
+	d.logf("Extracted %d files from %s to %s", len(files), d.Filename, d.ExtractTo)
+	return nil
+}
+
+// ExtractedFiles lists the files unpacked from a download's archive.
+func (m *Manager) ExtractedFiles(id string) (dir string, files []string, err error) {
+	d, err := m.GetDownload(id)
+	if err != nil {
+		return "", nil, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.ExtractTo == "" {
+		return "", nil, fmt.Errorf("download %s is not extracted", id)
+	}
+	return d.ExtractTo, d.Extracted, nil
+}
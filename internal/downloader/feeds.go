@@ -0,0 +1,416 @@
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/feed"
+	"github.com/govind1331/Datablip/internal/reqauth"
+)
+
+const (
+	// DefaultFeedsFile is where watched feeds are saved, relative to the
+	// server's working directory like the jobs file.
+	DefaultFeedsFile = "feeds.json"
+
+	// DefaultFeedInterval is how often a feed is polled unless it says.
+	DefaultFeedInterval = 30 * time.Minute
+
+	// MinFeedInterval keeps feeds from being polled abusively often.
+	MinFeedInterval = time.Minute
+
+	// maxSeen is how many enclosure IDs a feed remembers, enough for any
+	// feed's full length while keeping the feeds file small.
+	maxSeen = 1000
+
+	// maxFeedSize bounds what is read of a feed.
+	maxFeedSize = 16 << 20
+)
+
+// Feed watches an RSS or Atom feed and downloads the enclosures of new
+// items that match its filters.
+type Feed struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Match is a regular expression an item's title or enclosure URL must
+	// match to be downloaded; empty matches every item.
+	Match string `json:"match,omitempty"`
+	// Exclude is a regular expression that skips items whose title or
+	// enclosure URL it matches.
+	Exclude string `json:"exclude,omitempty"`
+	// Interval is how often the feed is polled, such as "15m";
+	// DefaultFeedInterval when empty.
+	Interval string `json:"interval,omitempty"`
+	// Backlog downloads the matching items already in the feed when it is
+	// added. Otherwise only items that appear later are downloaded.
+	Backlog        bool   `json:"backlog,omitempty"`
+	Chunks         int    `json:"chunks,omitempty"`
+	ConnectTimeout string `json:"connectTimeout,omitempty"`
+	ReadTimeout    string `json:"readTimeout,omitempty"`
+	RateLimit      int64  `json:"rateLimit,omitempty"` // Bytes/s for each download
+	Category       string `json:"category,omitempty"`
+	HasCredentials bool   `json:"hasCredentials,omitempty"` // Set if Auth sends anything
+	Retry
+	// Auth is sent when fetching the feed as well as its enclosures. It is
+	// kept out of the API; only the feeds file has it.
+	reqauth.Auth `json:"-"`
+	Delivery
+
+	NextPoll  time.Time  `json:"nextPoll"`
+	LastPoll  *time.Time `json:"lastPoll,omitempty"`  // When the feed was last read
+	LastError string     `json:"lastError,omitempty"` // Of the last poll
+	Queued    int        `json:"queued"`              // Downloads added so far
+	// Seen are the IDs of the enclosures already handled, oldest first.
+	Seen []string `json:"seen,omitempty"`
+
+	match, exclude *regexp.Regexp
+	interval       time.Duration
+	timer          *time.Timer
+	polling        bool
+}
+
+// validate checks the feed, compiles its filters and notes whether it has
+// credentials.
+func (f *Feed) validate() error {
+	if f.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if u, err := url.Parse(f.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	var err error
+	if f.match, err = compileFilter("match", f.Match); err != nil {
+		return err
+	}
+	if f.exclude, err = compileFilter("exclude", f.Exclude); err != nil {
+		return err
+	}
+	f.interval = DefaultFeedInterval
+	if f.Interval != "" {
+		f.interval, err = time.ParseDuration(f.Interval)
+		if err != nil || f.interval < MinFeedInterval {
+			return fmt.Errorf("interval must be a duration of at least %v", MinFeedInterval)
+		}
+	}
+	if f.RateLimit < 0 {
+		return errNegativeRateLimit
+	}
+	if f.Monitor != "" {
+		return fmt.Errorf("monitor doesn't apply to feeds, which download each item once")
+	}
+	if f.ExtractTo != "" {
+		return fmt.Errorf("extractTo doesn't apply to feeds, whose file names are only known once fetched")
+	}
+	if err := f.Retry.Validate(); err != nil {
+		return err
+	}
+	if err := f.Auth.Validate(); err != nil {
+		return err
+	}
+	f.HasCredentials = !f.Auth.Empty()
+	return f.Delivery.Validate()
+}
+
+// compileFilter compiles the regular expression of the named filter, or
+// returns nil if it is empty.
+func compileFilter(name, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return re, nil
+}
+
+// wants reports whether item passes the feed's filters.
+func (f *Feed) wants(item feed.Item) bool {
+	matches := func(re *regexp.Regexp) bool {
+		return re.MatchString(item.Title) || re.MatchString(item.URL)
+	}
+	return (f.match == nil || matches(f.match)) && (f.exclude == nil || !matches(f.exclude))
+}
+
+// AddFeed validates a new feed and polls it right away. Only the feed's
+// settings are used; its ID and poll history are filled in here.
+func (m *Manager) AddFeed(settings Feed) (Feed, error) {
+	f := &Feed{
+		ID:             generateID(),
+		URL:            settings.URL,
+		Match:          settings.Match,
+		Exclude:        settings.Exclude,
+		Interval:       settings.Interval,
+		Backlog:        settings.Backlog,
+		Chunks:         settings.Chunks,
+		ConnectTimeout: settings.ConnectTimeout,
+		ReadTimeout:    settings.ReadTimeout,
+		RateLimit:      settings.RateLimit,
+		Category:       settings.Category,
+		Retry:          settings.Retry,
+		Auth:           settings.Auth,
+		Delivery:       settings.Delivery,
+	}
+	if err := f.validate(); err != nil {
+		return Feed{}, err
+	}
+	if _, err := m.category(f.Category); err != nil {
+		return Feed{}, err
+	}
+	if err := m.confineDelivery(&f.Delivery); err != nil {
+		return Feed{}, err
+	}
+
+	m.feedsMu.Lock()
+	m.feeds[f.ID] = f
+	f.polling = true
+	m.saveFeeds()
+	m.feedsMu.Unlock()
+
+	m.pollFeed(f)
+	return m.GetFeed(f.ID)
+}
+
+// Feeds returns a snapshot of every feed.
+func (m *Manager) Feeds() []Feed {
+	m.feedsMu.Lock()
+	defer m.feedsMu.Unlock()
+	feeds := make([]Feed, 0, len(m.feeds))
+	for _, f := range m.feeds {
+		feeds = append(feeds, *f)
+	}
+	return feeds
+}
+
+// GetFeed returns a snapshot of a feed.
+func (m *Manager) GetFeed(id string) (Feed, error) {
+	m.feedsMu.Lock()
+	defer m.feedsMu.Unlock()
+	f, ok := m.feeds[id]
+	if !ok {
+		return Feed{}, fmt.Errorf("feed not found")
+	}
+	return *f, nil
+}
+
+// DeleteFeed stops watching a feed. Downloads it added are left alone.
+func (m *Manager) DeleteFeed(id string) error {
+	m.feedsMu.Lock()
+	defer m.feedsMu.Unlock()
+	f, ok := m.feeds[id]
+	if !ok {
+		return fmt.Errorf("feed not found")
+	}
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+	delete(m.feeds, id)
+	m.saveFeeds()
+	return nil
+}
+
+// PollFeed polls a feed now, outside its interval, and returns it after.
+func (m *Manager) PollFeed(id string) (Feed, error) {
+	m.feedsMu.Lock()
+	f, ok := m.feeds[id]
+	if !ok {
+		m.feedsMu.Unlock()
+		return Feed{}, fmt.Errorf("feed not found")
+	}
+	if f.polling {
+		m.feedsMu.Unlock()
+		return Feed{}, fmt.Errorf("the feed is being polled already")
+	}
+	f.polling = true
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+	m.feedsMu.Unlock()
+
+	m.pollFeed(f)
+	return m.GetFeed(id)
+}
+
+// armFeed sets the timer for the feed's next poll, after delay. The caller
+// holds m.feedsMu.
+func (m *Manager) armFeed(f *Feed, delay time.Duration) {
+	f.NextPoll = time.Now().Add(delay)
+	f.timer = time.AfterFunc(delay, func() {
+		m.feedsMu.Lock()
+		if m.feeds[f.ID] != f || f.polling {
+			m.feedsMu.Unlock()
+			return // Deleted or being polled meanwhile
+		}
+		f.polling = true
+		m.feedsMu.Unlock()
+		m.pollFeed(f)
+	})
+}
+
+// pollFeed fetches the feed and adds a download for each new enclosure
+// that passes its filters, then arms the next poll. The first poll of a
+// feed without Backlog only records what the feed holds. The caller has
+// set f.polling.
+func (m *Manager) pollFeed(f *Feed) {
+	items, err := m.fetchFeed(f)
+
+	m.feedsMu.Lock()
+	defer m.feedsMu.Unlock()
+	f.polling = false
+	if m.feeds[f.ID] != f {
+		return
+	}
+	defer m.saveFeeds()
+	m.armFeed(f, f.interval)
+	if err != nil {
+		f.LastError = err.Error()
+		log.Printf("Feed %s (%s) could not be polled: %v", f.ID, f.URL, err)
+		return
+	}
+	now := time.Now()
+	first := f.LastPoll == nil
+	f.LastPoll = &now
+	f.LastError = ""
+
+	seen := make(map[string]bool, len(f.Seen))
+	for _, id := range f.Seen {
+		seen[id] = true
+	}
+	base, _ := url.Parse(f.URL)
+	for _, item := range items {
+		if seen[item.ID] {
+			continue
+		}
+		seen[item.ID] = true
+		f.Seen = append(f.Seen, item.ID)
+		if (first && !f.Backlog) || !f.wants(item) {
+			continue
+		}
+		ref, err := url.Parse(item.URL)
+		if err != nil {
+			f.LastError = fmt.Sprintf("item %q: invalid enclosure URL: %v", item.Title, err)
+			continue
+		}
+		d, err := m.AddDownload(base.ResolveReference(ref).String(), AddOptions{
+			Chunks:         f.Chunks,
+			ConnectTimeout: f.ConnectTimeout,
+			ReadTimeout:    f.ReadTimeout,
+			RateLimit:      f.RateLimit,
+			Retry:          f.Retry,
+			Auth:           f.Auth,
+			Delivery:       f.Delivery,
+			Category:       f.Category,
+		})
+		var duplicate *DuplicateError
+		if errors.As(err, &duplicate) {
+			continue
+		}
+		if err != nil {
+			f.LastError = fmt.Sprintf("item %q: %v", item.Title, err)
+			continue
+		}
+		f.Queued++
+		d.logf("Added by feed %s for item %q", f.URL, item.Title)
+	}
+	if len(f.Seen) > maxSeen {
+		f.Seen = append([]string(nil), f.Seen[len(f.Seen)-maxSeen:]...)
+	}
+}
+
+// fetchFeed downloads and parses the feed, sending its auth as a download
+// would.
+func (m *Manager) fetchFeed(f *Feed) ([]feed.Item, error) {
+	req, err := http.NewRequestWithContext(m.ctx, "GET", f.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+	f.Auth.Apply(req, req.URL.Host)
+	client := m.client
+	if jar, err := f.Jar(); err == nil && jar != nil {
+		client = &http.Client{Transport: m.client.Transport, CheckRedirect: m.client.CheckRedirect, Jar: jar}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return feed.Parse(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+// LoadFeeds reads and arms the feeds saved in m.FeedsFile. A missing file
+// is not an error.
+func (m *Manager) LoadFeeds() error {
+	if m.FeedsFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.FeedsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var feeds []storedFeed
+	if err := json.Unmarshal(data, &feeds); err != nil {
+		return fmt.Errorf("invalid feeds file %s: %v", m.FeedsFile, err)
+	}
+
+	m.feedsMu.Lock()
+	defer m.feedsMu.Unlock()
+	for _, stored := range feeds {
+		f := stored.Feed
+		if f == nil {
+			return fmt.Errorf("invalid feeds file %s: empty feed", m.FeedsFile)
+		}
+		f.Auth = stored.Auth
+		if err := f.validate(); err != nil {
+			return fmt.Errorf("invalid feed %s in %s: %v", f.ID, m.FeedsFile, err)
+		}
+		m.feeds[f.ID] = f
+		// A poll missed while the server was down is made up for soon
+		m.armFeed(f, max(time.Until(f.NextPoll), 10*time.Second))
+	}
+	return nil
+}
+
+// storedFeed is a feed as the feeds file keeps it, with the credentials its
+// own JSON leaves out alongside its other fields.
+type storedFeed struct {
+	*Feed
+	reqauth.Auth
+}
+
+// saveFeeds writes every feed to m.FeedsFile, readable only by its owner as
+// it holds their credentials. The caller holds m.feedsMu.
+func (m *Manager) saveFeeds() {
+	if m.FeedsFile == "" {
+		return
+	}
+	feeds := make([]storedFeed, 0, len(m.feeds))
+	for _, f := range m.feeds {
+		feeds = append(feeds, storedFeed{Feed: f, Auth: f.Auth})
+	}
+	data, err := json.MarshalIndent(feeds, "", "  ")
+	if err == nil {
+		tmp := m.FeedsFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, m.FeedsFile)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to save feeds to %s: %v", m.FeedsFile, err)
+	}
+}
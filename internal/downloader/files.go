@@ -0,0 +1,253 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileEntry describes a file or directory under DownloadsDir.
+type FileEntry struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"` // Relative to DownloadsDir, with forward slashes
+	Dir        bool      `json:"dir"`
+	Size       int64     `json:"size"`
+	Modified   time.Time `json:"modified"`
+	DownloadID string    `json:"downloadId,omitempty"` // The download that saved it, if still listed
+}
+
+// resolveFile turns a path relative to DownloadsDir into one the server can
+// open, refusing anything that leads outside DownloadsDir, including
+// through symlinks. The path itself need not exist, but its closest
+// existing ancestor must resolve inside DownloadsDir.
+func resolveFile(rel string) (string, error) {
+	rel = filepath.Clean(filepath.FromSlash(rel))
+	if rel != "." && !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("path %q is outside the downloads directory", rel)
+	}
+	dir := downloadsDir()
+	full := filepath.Join(dir, rel)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	check := full
+	for {
+		if _, err := os.Lstat(check); !os.IsNotExist(err) {
+			break
+		}
+		check = filepath.Dir(check)
+	}
+	real, err := filepath.EvalSymlinks(check)
+	if err != nil {
+		return "", err
+	}
+	if inside, err := filepath.Rel(root, real); err != nil || (inside != "." && !filepath.IsLocal(inside)) {
+		return "", fmt.Errorf("path %q is outside the downloads directory", rel)
+	}
+	return full, nil
+}
+
+// relativeFile is the inverse of resolveFile.
+func relativeFile(full string) string {
+	rel, err := filepath.Rel(downloadsDir(), full)
+	if err != nil {
+		return filepath.ToSlash(full)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// within reports whether path is dir or lies under it.
+func within(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// fileInUse returns an error if a download that hasn't finished is writing
+// or delivering a file at or under path.
+func (m *Manager) fileInUse(path string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, d := range m.downloads {
+		select {
+		case <-d.settled.ch:
+			continue
+		default:
+		}
+		d.mu.RLock()
+		output := d.OutputPath
+		d.mu.RUnlock()
+		if within(output, path) || within(output+PartSuffix, path) {
+			return fmt.Errorf("%s is in use by download %s", relativeFile(path), d.ID)
+		}
+	}
+	return nil
+}
+
+func fileEntry(path string, info os.FileInfo) FileEntry {
+	file := FileEntry{
+		Name:     info.Name(),
+		Path:     relativeFile(path),
+		Dir:      info.IsDir(),
+		Modified: info.ModTime(),
+	}
+	if !file.Dir {
+		file.Size = info.Size()
+	}
+	return file
+}
+
+// ListFiles lists a directory under DownloadsDir, directories first.
+func (m *Manager) ListFiles(dir string) ([]FileEntry, error) {
+	full, err := resolveFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(full)
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make(map[string]string)
+	for _, d := range m.GetAllDownloads() {
+		d.mu.RLock()
+		owners[filepath.Clean(d.OutputPath)] = d.ID
+		d.mu.RUnlock()
+	}
+
+	files := make([]FileEntry, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed meanwhile
+		}
+		path := filepath.Join(full, entry.Name())
+		file := fileEntry(path, info)
+		file.DownloadID = owners[path]
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Dir != files[j].Dir {
+			return files[i].Dir
+		}
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// OpenFile opens a file under DownloadsDir for reading.
+func (m *Manager) OpenFile(path string) (*os.File, error) {
+	full, err := resolveFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(full); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", relativeFile(full))
+	}
+	return os.Open(full)
+}
+
+// RenameFile gives a file or directory under DownloadsDir a new name in the
+// same directory.
+func (m *Manager) RenameFile(path, name string) (FileEntry, error) {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return FileEntry{}, fmt.Errorf("invalid name %q", name)
+	}
+	return m.relocateFile(path, filepath.Join(filepath.Dir(filepath.FromSlash(path)), name))
+}
+
+// MoveFile moves a file or directory into another directory under
+// DownloadsDir, creating it if needed.
+func (m *Manager) MoveFile(path, toDir string) (FileEntry, error) {
+	src, err := resolveFile(path)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	dest, err := resolveFile(toDir)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	if within(dest, src) {
+		return FileEntry{}, fmt.Errorf("can't move %s into itself", path)
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return FileEntry{}, err
+	}
+	return m.relocateFile(path, filepath.Join(filepath.FromSlash(toDir), filepath.Base(filepath.FromSlash(path))))
+}
+
+// relocateFile renames from to to, both relative to DownloadsDir, and
+// points finished downloads that saved files there at the new location.
+func (m *Manager) relocateFile(from, to string) (FileEntry, error) {
+	src, err := resolveFile(from)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	dest, err := resolveFile(to)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	if src == filepath.Clean(downloadsDir()) {
+		return FileEntry{}, fmt.Errorf("the downloads directory itself can't be moved")
+	}
+	if within(dest, src) {
+		return FileEntry{}, fmt.Errorf("can't move %s into itself", from)
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return FileEntry{}, fmt.Errorf("%s already exists", relativeFile(dest))
+	}
+	if err := m.fileInUse(src); err != nil {
+		return FileEntry{}, err
+	}
+	if err := os.Rename(src, dest); err != nil {
+		return FileEntry{}, err
+	}
+
+	for _, d := range m.GetAllDownloads() {
+		d.mu.Lock()
+		if within(d.OutputPath, src) {
+			d.OutputPath = filepath.Join(dest, strings.TrimPrefix(filepath.Clean(d.OutputPath), src))
+		}
+		if within(d.localPath, src) {
+			d.localPath = filepath.Join(dest, strings.TrimPrefix(filepath.Clean(d.localPath), src))
+		}
+		d.mu.Unlock()
+	}
+
+	info, err := os.Lstat(dest)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	return fileEntry(dest, info), nil
+}
+
+// DeleteFile removes a file under DownloadsDir. Directories must be empty
+// unless recursive is set.
+func (m *Manager) DeleteFile(path string, recursive bool) error {
+	full, err := resolveFile(path)
+	if err != nil {
+		return err
+	}
+	if full == filepath.Clean(downloadsDir()) {
+		return fmt.Errorf("the downloads directory itself can't be deleted")
+	}
+	if err := m.fileInUse(full); err != nil {
+		return err
+	}
+	if recursive {
+		if _, err := os.Lstat(full); err != nil {
+			return err
+		}
+		return os.RemoveAll(full)
+	}
+	return os.Remove(full)
+}
@@ -0,0 +1,131 @@
+package downloader
+
+import (
+	"context"
+	"log"
+	"os"
+	"slices"
+	"time"
+)
+
+// janitorInterval is how often RunJanitor looks for finished downloads to
+// purge.
+const janitorInterval = time.Minute
+
+// HistoryPolicy says how long finished downloads stay listed.
+type HistoryPolicy struct {
+	MaxAge      time.Duration // Purge those that finished longer ago; 0 keeps them
+	MaxCount    int           // Keep only this many of the latest to finish; 0 keeps all
+	DeleteFiles bool          // Delete the files of those purged too
+}
+
+// finishedAt returns when d finished, if it is done for good: completed,
+// failed or quarantined, and not monitored, since those are fetched again.
+// Downloads saved before finish times were recorded count from their start.
+func (d *Download) finishedAt() (time.Time, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	switch d.Status {
+	case StatusCompleted, StatusError, StatusChecksumMismatch, StatusQuarantined:
+	default:
+		return time.Time{}, false
+	}
+	if d.Monitor != "" {
+		return time.Time{}, false
+	}
+	if d.FinishedAt != nil {
+		return *d.FinishedAt, true
+	}
+	return d.StartTime, true
+}
+
+// History returns the finished downloads, latest to finish first.
+func (m *Manager) History() []*Download {
+	type entry struct {
+		d  *Download
+		at time.Time
+	}
+	var entries []entry
+	for _, d := range m.GetAllDownloads() {
+		if at, ok := d.finishedAt(); ok {
+			entries = append(entries, entry{d, at})
+		}
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		return b.at.Compare(a.at)
+	})
+	history := make([]*Download, len(entries))
+	for i, e := range entries {
+		history[i] = e.d
+	}
+	return history
+}
+
+// RunJanitor purges finished downloads that m.Retention no longer keeps,
+// every janitorInterval until ctx is done. Without a MaxAge or MaxCount it
+// returns at once.
+func (m *Manager) RunJanitor(ctx context.Context) {
+	if m.Retention.MaxAge <= 0 && m.Retention.MaxCount <= 0 {
+		return
+	}
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	for {
+		if purged := m.purgeExpired(time.Now()); purged > 0 {
+			log.Printf("Purged %d finished downloads from the history", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeExpired purges the finished downloads past m.Retention at now and
+// returns how many.
+func (m *Manager) purgeExpired(now time.Time) int {
+	var expired []*Download
+	for i, d := range m.History() {
+		at, _ := d.finishedAt()
+		if (m.Retention.MaxCount > 0 && i >= m.Retention.MaxCount) ||
+			(m.Retention.MaxAge > 0 && now.Sub(at) > m.Retention.MaxAge) {
+			expired = append(expired, d)
+		}
+	}
+	return m.purge(expired, m.Retention.DeleteFiles)
+}
+
+// ClearHistory purges every finished download, and with deleteFiles their
+// files, and returns how many.
+func (m *Manager) ClearHistory(deleteFiles bool) int {
+	return m.purge(m.History(), deleteFiles)
+}
+
+// purge removes downloads from the list and the store, skipping any that
+// was restarted meanwhile. With deleteFiles their output files, and part
+// files of failed ones, are deleted too.
+func (m *Manager) purge(downloads []*Download, deleteFiles bool) int {
+	purged := 0
+	for _, d := range downloads {
+		if _, ok := d.finishedAt(); !ok {
+			continue
+		}
+		if err := m.DeleteDownload(d.ID); err != nil {
+			continue
+		}
+		purged++
+		if !deleteFiles {
+			continue
+		}
+		d.mu.RLock()
+		output := d.OutputPath
+		d.mu.RUnlock()
+		for _, path := range []string{output, partPath(d), controlPath(d)} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to delete %s of purged download %s: %v", path, d.ID, err)
+			}
+		}
+	}
+	return purged
+}
@@ -0,0 +1,76 @@
+package downloader
+
+import (
+	"time"
+
+	"github.com/govind1331/Datablip/internal/hoststats"
+)
+
+// transferClock measures a download's transfer so its throughput can be
+// recorded for the host.
+type transferClock struct {
+	start  time.Time
+	bytes  int64 // Already on disk when the transfer started
+	pauses int
+}
+
+func (d *Download) startClock() transferClock {
+	return transferClock{start: time.Now(), bytes: d.bytesReceived(), pauses: d.pause.Pauses()}
+}
+
+// recordThroughput adds a finished transfer to the host's statistics.
+// Transfers that were paused or rate limited are left out, since that would
+// count as slowness.
+func (m *Manager) recordThroughput(d *Download, connections int, clock transferClock) {
+	if d.pause.Pauses() != clock.pauses || m.HostDelay() > 0 || m.limited(d) {
+		return
+	}
+	host := hoststats.Key(d.URL)
+	elapsed := time.Since(clock.start)
+	bytes := d.bytesReceived() - clock.bytes
+	if !m.hosts.Record(host, connections, bytes, elapsed) {
+		return
+	}
+	report, _ := m.hosts.Get(host)
+	d.logf("Throughput from %s with %d connections: %.0f bytes/s; %s",
+		host, connections, float64(bytes)/elapsed.Seconds(), report.Summary)
+	if m.HostStatsFile != "" {
+		if err := m.hosts.Save(m.HostStatsFile); err != nil {
+			d.logf("%v", err)
+		}
+	}
+}
+
+// recommendedChunks lowers an automatically picked chunk count to what the
+// host's statistics recommend, when AutoConnections is on.
+func (m *Manager) recommendedChunks(d *Download, chunks int) int {
+	if !m.AutoConnections {
+		return chunks
+	}
+	host := hoststats.Key(d.URL)
+	if recommended, ok := m.hosts.Recommend(host); ok && recommended < chunks {
+		d.logf("Using %d connections, where %s saturates", recommended, host)
+		return recommended
+	}
+	return chunks
+}
+
+// LoadHostStats reads the statistics saved in m.HostStatsFile. A missing
+// file is not an error.
+func (m *Manager) LoadHostStats() error {
+	if m.HostStatsFile == "" {
+		return nil
+	}
+	hosts, err := hoststats.Load(m.HostStatsFile)
+	if err != nil {
+		return err
+	}
+	m.hosts = hosts
+	return nil
+}
+
+// HostStats returns the throughput report and recommendation for every
+// host downloaded from.
+func (m *Manager) HostStats() []hoststats.Host {
+	return m.hosts.Hosts()
+}
@@ -0,0 +1,388 @@
+package downloader
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/cron"
+	"github.com/govind1331/Datablip/internal/nametemplate"
+	"github.com/govind1331/Datablip/internal/reqauth"
+)
+
+// DefaultJobsFile is where recurring jobs are saved, relative to the
+// server's working directory like the downloads directory.
+const DefaultJobsFile = "jobs.json"
+
+// Job downloads a URL again and again on a cron schedule.
+type Job struct {
+	ID string `json:"id"`
+	// URL is fetched on every run.
+	URL string `json:"url"`
+	// Filename is a template for each copy's name, with the variables of
+	// nametemplate; {id} is the job's, and {type} and {subtype} are
+	// "unknown" as the run isn't probed yet. Without any variable,
+	// "-{datetime}" is added before the extension so copies don't collide.
+	Filename string `json:"filename"`
+	// Schedule is a cron expression, such as "0 3 * * sun", in the
+	// server's time zone.
+	Schedule string `json:"schedule"`
+	// Keep is how many completed copies are kept; older ones are deleted.
+	// 0 keeps them all. Only local files are pruned.
+	Keep           int      `json:"keep,omitempty"`
+	Chunks         int      `json:"chunks,omitempty"`
+	ConnectTimeout string   `json:"connectTimeout,omitempty"`
+	ReadTimeout    string   `json:"readTimeout,omitempty"`
+	RateLimit      int64    `json:"rateLimit,omitempty"` // Bytes/s for each run
+	Category       string   `json:"category,omitempty"`
+	Mirrors        []string `json:"mirrors,omitempty"`
+	HasCredentials bool     `json:"hasCredentials,omitempty"` // Set if Auth sends anything
+	Retry
+	reqauth.Auth `json:"-"` // Kept out of the API; only the jobs file has it
+	Delivery
+
+	NextRun        time.Time  `json:"nextRun"`
+	LastRun        *time.Time `json:"lastRun,omitempty"`
+	Runs           int        `json:"runs"`
+	LastDownloadID string     `json:"lastDownloadId,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	Copies         []string   `json:"copies,omitempty"` // Kept copies, oldest first
+
+	schedule *cron.Schedule
+	timer    *time.Timer
+	running  *Download // The last run, until it settles
+}
+
+// basename is the name the job's copies are based on: the file name of
+// its URL.
+func (j *Job) basename() string {
+	var name string
+	if u, err := url.Parse(j.URL); err == nil {
+		name = path.Base(u.Path)
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "download"
+	}
+	return name
+}
+
+// filenameTemplate returns the job's filename template, defaulting to the
+// URL's file name and adding a timestamp if it has no variable.
+func (j *Job) filenameTemplate() string {
+	name := cmp.Or(j.Filename, j.basename())
+	if nametemplate.IsTemplate(name) {
+		return name
+	}
+	ext := filepath.Ext(name)
+	if strings.HasSuffix(strings.TrimSuffix(name, ext), ".tar") {
+		ext = ".tar" + ext
+	}
+	return strings.TrimSuffix(name, ext) + "-{datetime}" + ext
+}
+
+// filename renders the name of a run's copy.
+func (j *Job) filename(t time.Time, run int) string {
+	u, _ := url.Parse(j.URL)
+	name := nametemplate.Render(j.filenameTemplate(), nametemplate.Vars{
+		URL:      u,
+		Basename: j.basename(),
+		ID:       j.ID,
+		Time:     t,
+		Run:      run,
+	})
+	return path.Base(name)
+}
+
+// validate checks the job, parses its schedule and notes whether it has
+// credentials.
+func (j *Job) validate() error {
+	if j.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	schedule, err := cron.Parse(j.Schedule)
+	if err != nil {
+		return err
+	}
+	if err := nametemplate.Validate(j.Filename); err != nil {
+		return err
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return fmt.Errorf("schedule %q never fires", j.Schedule)
+	}
+	if j.Monitor != "" {
+		return fmt.Errorf("monitor doesn't apply to jobs, which download on their schedule")
+	}
+	if j.Keep < 0 {
+		return fmt.Errorf("keep must not be negative")
+	}
+	if j.RateLimit < 0 {
+		return errNegativeRateLimit
+	}
+	if err := j.Retry.Validate(); err != nil {
+		return err
+	}
+	if err := j.Auth.Validate(); err != nil {
+		return err
+	}
+	j.HasCredentials = !j.Auth.Empty()
+	if err := j.Delivery.Validate(); err != nil {
+		return err
+	}
+	if err := j.Delivery.validateFor(j.filename(time.Now(), 1)); err != nil {
+		return err
+	}
+	j.schedule = schedule
+	return nil
+}
+
+// AddJob validates and schedules a new job. Only the job's settings are
+// used; its ID and run history are filled in here.
+func (m *Manager) AddJob(settings Job) (Job, error) {
+	job := &Job{
+		ID:             generateID(),
+		URL:            settings.URL,
+		Filename:       settings.Filename,
+		Schedule:       settings.Schedule,
+		Keep:           settings.Keep,
+		Chunks:         settings.Chunks,
+		ConnectTimeout: settings.ConnectTimeout,
+		ReadTimeout:    settings.ReadTimeout,
+		RateLimit:      settings.RateLimit,
+		Category:       settings.Category,
+		Mirrors:        settings.Mirrors,
+		Retry:          settings.Retry,
+		Auth:           settings.Auth,
+		Delivery:       settings.Delivery,
+	}
+	if err := job.validate(); err != nil {
+		return Job{}, err
+	}
+	if _, err := m.category(job.Category); err != nil {
+		return Job{}, err
+	}
+	if err := m.confineDelivery(&job.Delivery); err != nil {
+		return Job{}, err
+	}
+
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	m.jobs[job.ID] = job
+	m.armJob(job)
+	m.saveJobs()
+	return *job, nil
+}
+
+// Jobs returns a snapshot of every job.
+func (m *Manager) Jobs() []Job {
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+// GetJob returns a snapshot of a job.
+func (m *Manager) GetJob(id string) (Job, error) {
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("job not found")
+	}
+	return *job, nil
+}
+
+// DeleteJob stops a job. Its copies and any run in progress are left alone.
+func (m *Manager) DeleteJob(id string) error {
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return fmt.Errorf("job not found")
+	}
+	job.timer.Stop()
+	delete(m.jobs, id)
+	m.saveJobs()
+	return nil
+}
+
+// RunJob starts a run of the job now, outside its schedule.
+func (m *Manager) RunJob(id string) (*Download, error) {
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("job not found")
+	}
+	return m.startRun(job)
+}
+
+// armJob sets the timer for the job's next run. The caller holds m.jobsMu.
+func (m *Manager) armJob(job *Job) {
+	job.NextRun = job.schedule.Next(time.Now())
+	if job.NextRun.IsZero() {
+		return
+	}
+	job.timer = time.AfterFunc(time.Until(job.NextRun), func() {
+		m.jobsMu.Lock()
+		defer m.jobsMu.Unlock()
+		if m.jobs[job.ID] != job {
+			return // Deleted meanwhile
+		}
+		if _, err := m.startRun(job); err != nil {
+			log.Printf("Job %s (%s) did not run: %v", job.ID, job.URL, err)
+		}
+		m.armJob(job)
+		m.saveJobs()
+	})
+}
+
+// startRun adds the download for one run of the job. Runs don't overlap:
+// while the last one is unfinished the job is skipped. The caller holds
+// m.jobsMu.
+func (m *Manager) startRun(job *Job) (*Download, error) {
+	now := time.Now()
+	if job.running != nil {
+		select {
+		case <-job.running.settled.ch:
+		default:
+			job.LastError = fmt.Sprintf("skipped the run at %s: the previous run is still in progress", now.Format(time.DateTime))
+			return nil, fmt.Errorf("the previous run is still in progress")
+		}
+	}
+
+	run := job.Runs + 1
+	d, err := m.AddDownload(job.URL, AddOptions{
+		Mirrors:        job.Mirrors,
+		Filename:       job.filename(now, run),
+		Chunks:         job.Chunks,
+		ConnectTimeout: job.ConnectTimeout,
+		ReadTimeout:    job.ReadTimeout,
+		RateLimit:      job.RateLimit,
+		Retry:          job.Retry,
+		Auth:           job.Auth,
+		Delivery:       job.Delivery,
+		Category:       job.Category,
+	})
+	if err != nil {
+		job.LastError = err.Error()
+		return nil, err
+	}
+	job.Runs = run
+	job.LastRun = &now
+	job.LastDownloadID = d.ID
+	job.LastError = ""
+	job.running = d
+	m.saveJobs()
+
+	go m.collectCopy(job, d)
+	return d, nil
+}
+
+// collectCopy waits for a run to finish, then records its file among the
+// job's copies and deletes the oldest beyond job.Keep.
+func (m *Manager) collectCopy(job *Job, d *Download) {
+	<-d.settled.ch
+
+	d.mu.RLock()
+	status, outputPath, errMsg := d.Status, d.OutputPath, d.Error
+	deleted := d.UploadTo != "" && d.DeleteAfterUpload
+	d.mu.RUnlock()
+
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	if m.jobs[job.ID] != job {
+		return
+	}
+	if status != StatusCompleted {
+		job.LastError = fmt.Sprintf("run %s failed: %s", d.ID, errMsg)
+		m.saveJobs()
+		return
+	}
+	if !deleted {
+		job.Copies = append(job.Copies, outputPath)
+	}
+	for job.Keep > 0 && len(job.Copies) > job.Keep {
+		oldest := job.Copies[0]
+		if err := os.Remove(oldest); err != nil && !os.IsNotExist(err) {
+			log.Printf("Job %s could not remove old copy %s: %v", job.ID, oldest, err)
+		} else {
+			log.Printf("Job %s removed old copy %s", job.ID, oldest)
+		}
+		job.Copies = job.Copies[1:]
+	}
+	m.saveJobs()
+}
+
+// LoadJobs reads and schedules the jobs saved in m.JobsFile. A missing
+// file is not an error.
+func (m *Manager) LoadJobs() error {
+	if m.JobsFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.JobsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var jobs []storedJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return fmt.Errorf("invalid jobs file %s: %v", m.JobsFile, err)
+	}
+
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	for _, stored := range jobs {
+		job := stored.Job
+		if job == nil {
+			return fmt.Errorf("invalid jobs file %s: empty job", m.JobsFile)
+		}
+		job.Auth = stored.Auth
+		if err := job.validate(); err != nil {
+			return fmt.Errorf("invalid job %s in %s: %v", job.ID, m.JobsFile, err)
+		}
+		m.jobs[job.ID] = job
+		m.armJob(job)
+	}
+	return nil
+}
+
+// storedJob is a job as the jobs file keeps it, with the credentials its
+// own JSON leaves out alongside its other fields.
+type storedJob struct {
+	*Job
+	reqauth.Auth
+}
+
+// saveJobs writes every job to m.JobsFile, readable only by its owner as it
+// holds their credentials. The caller holds m.jobsMu.
+func (m *Manager) saveJobs() {
+	if m.JobsFile == "" {
+		return
+	}
+	jobs := make([]storedJob, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, storedJob{Job: job, Auth: job.Auth})
+	}
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err == nil {
+		tmp := m.JobsFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, m.JobsFile)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to save jobs to %s: %v", m.JobsFile, err)
+	}
+}
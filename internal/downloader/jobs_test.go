@@ -0,0 +1,29 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobFilename(t *testing.T) {
+	at := time.Date(2026, 10, 16, 2, 30, 5, 0, time.UTC)
+	tests := []struct {
+		url, filename string
+		want          string
+	}{
+		{"https://db.example.com/dump.sql.gz", "", "dump.sql-20261016-023005.gz"},
+		{"https://db.example.com/backup.tar.gz", "", "backup-20261016-023005.tar.gz"},
+		{"https://db.example.com/", "", "download-20261016-023005"},
+		{"https://db.example.com/dump.sql.gz", "dump.sql.gz", "dump.sql-20261016-023005.gz"},
+		{"https://db.example.com/dump.sql.gz", "dump-{date}.sql.gz", "dump-2026-10-16.sql.gz"},
+		{"https://db.example.com/dump.sql.gz", "{run}-{unix}-{time}-{basename}", "7-1792117805-023005-dump.sql.gz"},
+		{"https://db.example.com/dump.sql.gz", "{host}-{id}-{type}", "db.example.com-job1-unknown"},
+		{"https://db.example.com/dump.sql.gz", "{date}/{host}/{basename}", "dump.sql.gz"},
+	}
+	for _, test := range tests {
+		job := &Job{ID: "job1", URL: test.url, Filename: test.filename}
+		if got := job.filename(at, 7); got != test.want {
+			t.Errorf("%q from %s: got %q, want %q", test.filename, test.url, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var errNegativeRateLimit = errors.New("rate limit must be a whole number of bytes/s, 0 for none")
+
+// SetRateLimit caps the combined speed of every download at bytesPerSec;
+// 0 removes the cap. Running downloads follow the change right away.
+func (m *Manager) SetRateLimit(bytesPerSec int64) {
+	m.limiter.SetRate(float64(bytesPerSec))
+}
+
+// RateLimit returns the cap on the combined speed of every download in
+// bytes/s, 0 when there is none.
+func (m *Manager) RateLimit() int64 {
+	return int64(m.limiter.Rate())
+}
+
+// SetDownloadRateLimit caps the speed of one download at bytesPerSec, within
+// the server's limit; 0 removes the cap.
+func (m *Manager) SetDownloadRateLimit(id string, bytesPerSec int64) error {
+	if bytesPerSec < 0 {
+		return errNegativeRateLimit
+	}
+	m.mu.RLock()
+	download, exists := m.downloads[id]
+	m.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("download not found")
+	}
+
+	download.mu.Lock()
+	download.RateLimit = bytesPerSec
+	download.mu.Unlock()
+	download.limiter.SetRate(float64(bytesPerSec))
+	download.logf("Rate limit set to %d bytes/s", bytesPerSec)
+	m.broadcastUpdate(DownloadUpdate{
+		DownloadID: id,
+		Type:       "status",
+		Data:       download,
+	})
+	return nil
+}
+
+// limitReader slows r down to d's rate limit and the server's.
+func (m *Manager) limitReader(ctx context.Context, d *Download, r io.Reader) io.Reader {
+	return m.limiter.Reader(ctx, d.limiter.Reader(ctx, r))
+}
+
+// limited reports whether d's speed is held down by a rate limit.
+func (m *Manager) limited(d *Download) bool {
+	return m.limiter.Rate() > 0 || d.limiter.Rate() > 0
+}
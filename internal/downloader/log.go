@@ -0,0 +1,56 @@
+package downloader
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// logLines is how many of its latest log lines each download keeps.
+const logLines = 1000
+
+// downloadLog keeps the latest lines logged about one download, so users
+// can see why it failed without access to the server's output. The zero
+// value is ready to use.
+type downloadLog struct {
+	mu    sync.Mutex
+	lines []string
+	next  int // Index of the oldest line once the buffer is full
+}
+
+func (l *downloadLog) add(line string) {
+	line = time.Now().Format("2006-01-02 15:04:05.000000") + " " + line
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.lines) < logLines {
+		l.lines = append(l.lines, line)
+		return
+	}
+	l.lines[l.next] = line
+	l.next = (l.next + 1) % logLines
+}
+
+// snapshot returns the kept lines, oldest first.
+func (l *downloadLog) snapshot() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lines := make([]string, 0, len(l.lines))
+	lines = append(lines, l.lines[l.next:]...)
+	return append(lines, l.lines[:l.next]...)
+}
+
+// logf writes a line to the server's output and to the download's log.
+func (d *Download) logf(format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	fmt.Println(line)
+	d.log.add(line)
+}
+
+// Log returns the latest lines logged about a download, oldest first.
+func (m *Manager) Log(id string) ([]string, error) {
+	d, err := m.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+	return d.log.snapshot(), nil
+}
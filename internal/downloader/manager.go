@@ -1,103 +1,704 @@
 package downloader
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/govind1331/Datablip/internal/autochunk"
+	"github.com/govind1331/Datablip/internal/bufpool"
+	"github.com/govind1331/Datablip/internal/conflict"
+	"github.com/govind1331/Datablip/internal/digest"
+	"github.com/govind1331/Datablip/internal/directio"
+	"github.com/govind1331/Datablip/internal/endgame"
+	"github.com/govind1331/Datablip/internal/fastcopy"
+	"github.com/govind1331/Datablip/internal/hoststats"
+	"github.com/govind1331/Datablip/internal/idle"
+	"github.com/govind1331/Datablip/internal/media"
+	"github.com/govind1331/Datablip/internal/mirror"
+	"github.com/govind1331/Datablip/internal/netwait"
+	"github.com/govind1331/Datablip/internal/pause"
+	"github.com/govind1331/Datablip/internal/probecache"
+	"github.com/govind1331/Datablip/internal/rangeprobe"
+	"github.com/govind1331/Datablip/internal/ratelimit"
+	"github.com/govind1331/Datablip/internal/redirect"
+	"github.com/govind1331/Datablip/internal/reqauth"
+	"github.com/govind1331/Datablip/internal/route"
+	"github.com/govind1331/Datablip/internal/savename"
+	"github.com/govind1331/Datablip/internal/scan"
+	"github.com/govind1331/Datablip/internal/speed"
+	"github.com/govind1331/Datablip/internal/stall"
+	"github.com/govind1331/Datablip/internal/store"
+	"github.com/govind1331/Datablip/internal/telemetry"
+	"github.com/govind1331/Datablip/internal/transport"
+	"github.com/govind1331/Datablip/internal/urlnorm"
+	"github.com/govind1331/Datablip/internal/webhook"
 )
 
 type DownloadStatus string
 
 const (
-	StatusPending     DownloadStatus = "pending"
+	StatusQueued      DownloadStatus = "queued"  // For a free download slot
+	StatusWaiting     DownloadStatus = "waiting" // For the downloads in DependsOn, or the monthly cap
 	StatusDownloading DownloadStatus = "downloading"
 	StatusPaused      DownloadStatus = "paused"
+	StatusUploading   DownloadStatus = "uploading"
+	StatusMoving      DownloadStatus = "moving"
+	StatusScanning    DownloadStatus = "scanning"
+	StatusExtracting  DownloadStatus = "extracting"
+	StatusCompressing DownloadStatus = "compressing"
 	StatusCompleted   DownloadStatus = "completed"
 	StatusError       DownloadStatus = "error"
+	StatusQuarantined DownloadStatus = "quarantined"
+
+	// StatusChecksumMismatch is a download whose data didn't match a
+	// declared checksum, either the one it was added with or one the server
+	// advertised.
+	StatusChecksumMismatch DownloadStatus = "checksum_mismatch"
 )
 
 type Download struct {
-	ID             string         `json:"id"`
-	URL            string         `json:"url"`
-	Filename       string         `json:"filename"`
-	OutputPath     string         `json:"outputPath"`
-	Status         DownloadStatus `json:"status"`
-	Progress       float64        `json:"progress"`
-	TotalSize      int64          `json:"totalSize"`
-	Downloaded     int64          `json:"downloaded"`
-	Speed          float64        `json:"speed"`
-	Chunks         int            `json:"chunks"`
-	ChunkProgress  []float64      `json:"chunkProgress"`
-	TimeRemaining  int            `json:"timeRemaining"`
-	StartTime      time.Time      `json:"startTime"`
-	Error          string         `json:"error,omitempty"`
-	ConnectTimeout string         `json:"connectTimeout"`
-	ReadTimeout    string         `json:"readTimeout"`
-
-	mu             sync.RWMutex
-	pauseChan      chan bool
-	lastDownloaded int64
-	lastUpdateTime time.Time
+	ID             string          `json:"id"`
+	URL            string          `json:"url"`
+	Mirrors        []string        `json:"mirrors,omitempty"`  // More URLs of the same file; chunks are spread across all of them
+	FinalURL       string          `json:"finalUrl,omitempty"` // Where URL redirected the probe, if elsewhere
+	Filename       string          `json:"filename"`
+	OutputPath     string          `json:"outputPath"`
+	PartPath       string          `json:"partPath,omitempty"` // Where data is written until it has been verified
+	Status         DownloadStatus  `json:"status"`
+	Progress       float64         `json:"progress"`
+	TotalSize      int64           `json:"totalSize"`
+	Downloaded     int64           `json:"downloaded"`
+	Speed          float64         `json:"speed"`
+	Chunks         int             `json:"chunks"` // 0 picks a count once the file is probed
+	ChunkProgress  []float64       `json:"chunkProgress"`
+	ChunkRestarts  []int           `json:"chunkRestarts"` // Stalled connections restarted, per chunk
+	TimeRemaining  int             `json:"timeRemaining"`
+	StartTime      time.Time       `json:"startTime"`
+	Error          string          `json:"error,omitempty"`
+	ConnectTimeout string          `json:"connectTimeout"`
+	ReadTimeout    string          `json:"readTimeout"`
+	Checksum       string          `json:"checksum,omitempty"`  // Expected checksum as algorithm:hex, such as sha256:9f86d081...
+	RateLimit      int64           `json:"rateLimit,omitempty"` // Bytes/s this download may use, on top of the server's limit; 0 is unlimited
+	Category       string          `json:"category,omitempty"`  // Set when added; where it is saved and its defaults
+	Dir            string          `json:"dir,omitempty"`       // Set when added; where it is saved, inside the category's or downloads directory if relative
+	Verification   []digest.Result `json:"verification,omitempty"`
+	HasCredentials bool            `json:"hasCredentials,omitempty"` // Set if Auth sends anything
+	Retry
+	reqauth.Auth `json:"-"` // Kept out of the API and updates; only the store has it
+	Delivery
+	StageProgress  float64     `json:"stageProgress,omitempty"` // Percent through the current delivery stage
+	UploadedTo     string      `json:"uploadedTo,omitempty"`
+	MovedTo        string      `json:"movedTo,omitempty"`
+	Threat         string      `json:"threat,omitempty"`         // What the scanner found
+	QuarantinedTo  string      `json:"quarantinedTo,omitempty"`  // Where the infected file was put
+	Extracting     string      `json:"extracting,omitempty"`     // Archive entry being unpacked
+	Extracted      []string    `json:"extracted,omitempty"`      // Files unpacked into ExtractTo, relative to it
+	CompressedSize int64       `json:"compressedSize,omitempty"` // Size of the output once compressed
+	PackedInto     string      `json:"packedInto,omitempty"`     // Archive the file was packed into
+	Media          *media.Info `json:"media,omitempty"`          // Set for audio, video and images when ffprobe is installed
+	Thumbnail      string      `json:"thumbnail,omitempty"`      // Path of the rendered preview image
+	ContentType    string      `json:"contentType,omitempty"`    // Sniffed from the file's content
+	RoutedTo       string      `json:"routedTo,omitempty"`       // Folder the routing rules picked
+
+	DependsOn   []string       `json:"dependsOn,omitempty"`   // IDs of downloads that must complete first
+	MirrorStats []mirror.Stats `json:"mirrorStats,omitempty"` // What each of URL and Mirrors contributed
+	Remote      *RemoteVersion `json:"remote,omitempty"`      // Version of the source last downloaded
+	LastChecked *time.Time     `json:"lastChecked,omitempty"` // When a monitored source was last checked
+	FinishedAt  *time.Time     `json:"finishedAt,omitempty"`  // When it last completed, failed or was quarantined
+	Refreshes   int            `json:"refreshes,omitempty"`   // Times a monitored download was fetched again
+
+	mu         sync.RWMutex
+	ctx        context.Context
+	cancel     context.CancelFunc
+	connStats  transport.Stats
+	client     *http.Client              // The manager's, or one with the cookies of CookiesTxt
+	races      []*endgame.Race           // Per chunk while endgame mode may help it
+	aborts     []context.CancelCauseFunc // Per chunk: cancels the request in flight
+	sources    []string                  // Per chunk: the mirror of the request in flight
+	mirrors    *mirror.Set               // URL and Mirrors
+	checksum   []digest.Expected         // Checksum parsed from Checksum, if set
+	digests    []digest.Expected         // checksum plus those advertised by the server
+	pause      pause.Gate
+	held       bool               // Restored paused; starts once resumed
+	record     func() error       // Writes the control file now, while keepControl runs
+	limiter    *ratelimit.Limiter // Shared by every connection of the download
+	chunkBytes []int64            // Bytes received per chunk, updated atomically
+	chunkSizes []int64
+	chunkEnds  []int64 // Per chunk, atomic: where its connection stops, short of its size once a tail was handed off
+	tailBytes  []int64 // Per chunk, atomic: bytes of its tail received, until they join chunkBytes
+	tails      []*tail // Per chunk: the far end of its range fetched by another connection
+	meter      *speed.Meter
+	updates    int64  // Full updates broadcast, updated atomically
+	localPath  string // OutputPath as added, before any delivery moved the file
+	streamable bool   // Data lands in the part file as chunkBytes advance
+
+	progressPending int32 // Atomic: 1 while waiting for coalesceProgress
+	deps            []*Download
+	sha256          []byte // Of the finished file, once something has hashed it
+	settled         *settled
+	log             downloadLog
+}
+
+// DownloadsDir is where files are saved, relative to the server's working
+// directory unless absolute. Set it before adding downloads; later,
+// SetDownloadsDir changes it.
+var DownloadsDir = "downloads"
+
+const (
+	// DefaultConnectTimeout bounds dialing and waiting for response headers
+	// on the manager's shared transport.
+	DefaultConnectTimeout = 30 * time.Second
+
+	// DefaultReadTimeout applies when a download has no valid ReadTimeout.
+	DefaultReadTimeout = 10 * time.Minute
+
+	// MaxConnsPerHost is how many idle connections are kept per host for
+	// reuse by later chunk requests.
+	MaxConnsPerHost = 32
+)
+
+// readTimeout is how long a transfer may go without receiving data.
+func (d *Download) readTimeout() time.Duration {
+	return parseTimeout(d.ReadTimeout, DefaultReadTimeout)
+}
+
+func parseTimeout(value string, fallback time.Duration) time.Duration {
+	if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+		return timeout
+	}
+	return fallback
+}
+
+// bytesReceived returns the real number of bytes written so far across all
+// chunks.
+func (d *Download) bytesReceived() int64 {
+	var total int64
+	for i := range d.chunkBytes {
+		total += atomic.LoadInt64(&d.chunkBytes[i])
+	}
+	for i := range d.tailBytes {
+		total += atomic.LoadInt64(&d.tailBytes[i])
+	}
+	return total
+}
+
+// advanceChunk raises chunk i's byte counter to pos. Connections racing over
+// the same range report positions so overlapping bytes count once.
+func (d *Download) advanceChunk(i int, pos int64) {
+	for {
+		current := atomic.LoadInt64(&d.chunkBytes[i])
+		if pos <= current || atomic.CompareAndSwapInt64(&d.chunkBytes[i], current, pos) {
+			return
+		}
+	}
+}
+
+// status returns d's status, which other goroutines may be changing.
+func (d *Download) status() DownloadStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.Status
+}
+
+// Output returns d's status, output path and file name as of one moment,
+// read under d.mu, for serving its file.
+func (d *Download) Output() (status DownloadStatus, outputPath, filename string) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.Status, d.OutputPath, d.Filename
+}
+
+// setStatus changes d's status under d.mu, so it isn't read half-written
+// when d is saved or listed meanwhile.
+func (d *Download) setStatus(status DownloadStatus) {
+	d.mu.Lock()
+	d.Status = status
+	d.mu.Unlock()
+}
+
+// refreshProgress derives Downloaded, Progress and ChunkProgress from the
+// per-chunk byte counters. The caller must hold d.mu.
+func (d *Download) refreshProgress() {
+	for i := range d.chunkBytes {
+		if i < len(d.ChunkProgress) && d.chunkSizes[i] > 0 {
+			received := atomic.LoadInt64(&d.chunkBytes[i])
+			if i < len(d.tailBytes) {
+				received += atomic.LoadInt64(&d.tailBytes[i])
+			}
+			d.ChunkProgress[i] = float64(received) / float64(d.chunkSizes[i]) * 100
+		}
+	}
+	d.Downloaded = d.bytesReceived()
+	if d.TotalSize > 0 {
+		d.Progress = float64(d.Downloaded) / float64(d.TotalSize) * 100
+	}
+	if len(d.Mirrors) > 0 {
+		d.MirrorStats = d.mirrors.Stats()
+	}
 }
 
 type Manager struct {
-	downloads map[string]*Download
-	mu        sync.RWMutex
-	listeners []chan DownloadUpdate
+	ctx        context.Context
+	client     *http.Client // Shared so chunk requests reuse connections
+	warmer     *transport.Warmer
+	polite     *transport.Polite // Spaces out requests to each host
+	probes     *probecache.Cache // Recent HEAD results by URL
+	pool       *workerPool       // Bounds chunk transfers across all downloads
+	active     *workerPool       // Bounds the downloads running at once
+	downloads  map[string]*Download
+	mu         sync.RWMutex
+	listeners  []chan DownloadUpdate
+	jobs       map[string]*Job
+	jobsMu     sync.Mutex
+	feeds      map[string]*Feed
+	feedsMu    sync.Mutex
+	archives   map[string]*Archive
+	archivesMu sync.Mutex
+	usage      usage
+	stats      stats
+	hosts      *hoststats.Store   // Throughput per host and connection count
+	limiter    *ratelimit.Limiter // Shared by every download
+	store      *store.Store       // Where downloads are saved, if opened
+	storeMu    sync.Mutex
+	webhooks   *webhook.Sender
+	closing    bool // Shutdown was called; guarded by mu
+
+	progressMu      sync.Mutex           // Orders progress events after full updates
+	progressPending map[string]*Download // Moved since their last progress event
+	progressEvery   int64                // Atomic: nanoseconds between progress events
+	events          *events              // Numbers updates, in the order listeners get them
+
+	categories   map[string]*Category
+	categoriesMu sync.Mutex
+
+	settingsMu       sync.Mutex
+	defaultChunks    int
+	connectTimeout   time.Duration
+	readTimeout      time.Duration
+	filenameTemplate string
+	changed          SettingsUpdate // Settings changed through the API, as saved
+
+	// SettingsFile is where settings changed through the API are saved;
+	// empty keeps them in memory only.
+	SettingsFile string
+
+	// JobsFile is where recurring jobs are saved; empty keeps them in
+	// memory only.
+	JobsFile string
+
+	// FeedsFile is where watched feeds are saved; empty keeps them in
+	// memory only.
+	FeedsFile string
+
+	// CategoriesFile is where categories are saved; empty keeps them in
+	// memory only.
+	CategoriesFile string
+
+	// UsageFile is where the bytes downloaded each month are saved; empty
+	// keeps them in memory only.
+	UsageFile string
+
+	// StatsFile is where the transfer history GET /api/stats reports is
+	// saved; empty keeps it in memory only.
+	StatsFile string
+
+	// HostStatsFile is where the throughput measured per host is saved;
+	// empty keeps it in memory only.
+	HostStatsFile string
+
+	// AutoConnections lowers the automatically picked chunk count of a
+	// download to what its host was measured to saturate at.
+	AutoConnections bool
+
+	// URLRules are the tracking parameters stripped from URLs before they
+	// are queued, so links that differ only by them count as duplicates.
+	URLRules urlnorm.Rules
+
+	// WriteMode selects WriteAt or memory-mapped writes into the part file.
+	WriteMode WriteMode
+
+	// DirectIO writes large downloads with O_DIRECT (F_NOCACHE on macOS) so
+	// they don't churn the page cache of a busy host.
+	DirectIO bool
+
+	// Endgame starts a second connection for a chunk that crawls behind the
+	// rest once a download is nearly complete.
+	Endgame bool
+
+	// Rebalance hands the far end of a chunk moving at a fraction of the
+	// others' speed to a connection that is free, before the endgame.
+	Rebalance bool
+
+	// StallSpeed and StallTime restart a chunk's connection once it has
+	// moved at less than StallSpeed bytes/s for StallTime while other
+	// chunks keep up. A StallSpeed of 0 disables restarts.
+	StallSpeed float64
+	StallTime  time.Duration
+
+	// UploadRetries is how many times a failed upload is retried before the
+	// download is marked failed.
+	UploadRetries int
+
+	// Scanner, if set, checks every finished download before it is
+	// delivered. Infected files are moved into QuarantineDir.
+	Scanner       scan.Scanner
+	QuarantineDir string
+
+	// MediaPriority is how many bytes at each end of audio and video files
+	// are fetched before the middle, so players can open them early; 0
+	// fetches them in plain chunk order.
+	MediaPriority int64
+
+	// ThumbnailDir holds the preview images rendered for media downloads.
+	ThumbnailDir string
+
+	// Routes, if set, sort finished downloads into folders by content type.
+	Routes []route.Rule
+
+	// Telemetry, if set, counts downloads and the delivery features they
+	// use.
+	Telemetry *telemetry.Reporter
+
+	// Webhooks receive a signed POST when a download completes, fails, is
+	// paused or resumed, or is quarantined.
+	Webhooks []webhook.Hook
+
+	// ChunkFiles restores the old layout where each chunk is written to its
+	// own chunk_<id>_<n>.tmp file in the working directory and merged at the
+	// end. By default chunks are written in place into <output>.part.
+	ChunkFiles bool
+
+	// AllowedDirs are directories besides the downloads directory that
+	// downloads may be added with an absolute dir inside of.
+	AllowedDirs []string
+
+	// Retention says how long finished downloads stay listed, once
+	// RunJanitor is started.
+	Retention HistoryPolicy
+
+	// OnConflict is what happens when a download's output file already
+	// exists and the download doesn't say; empty is conflict.Default.
+	OnConflict conflict.Policy
 }
 
 type DownloadUpdate struct {
 	DownloadID string      `json:"downloadId"`
 	Type       string      `json:"type"`
 	Data       interface{} `json:"data"`
+	Seq        uint64      `json:"seq"` // Increases with every update, across restarts too
 }
 
-func NewManager() *Manager {
-	return &Manager{
-		downloads: make(map[string]*Download),
-		listeners: make([]chan DownloadUpdate, 0),
+// NewManager creates a manager whose downloads are all cancelled when ctx is.
+func NewManager(ctx context.Context) *Manager {
+	httpTransport := transport.New(maxConnectTimeout, MaxConnsPerHost)
+	polite := transport.NewPolite(httpTransport)
+	m := &Manager{
+		ctx:           ctx,
+		warmer:        transport.NewWarmer(httpTransport),
+		polite:        polite,
+		probes:        probecache.New(probecache.DefaultTTL),
+		pool:          newWorkerPool(DefaultWorkers),
+		active:        newWorkerPool(DefaultMaxConcurrentDownloads),
+		downloads:     make(map[string]*Download),
+		jobs:          make(map[string]*Job),
+		feeds:         make(map[string]*Feed),
+		archives:      make(map[string]*Archive),
+		hosts:         hoststats.New(),
+		limiter:       ratelimit.New(0),
+		webhooks:      webhook.NewSender(),
+		HostStatsFile: hoststats.DefaultFile,
+		JobsFile:      DefaultJobsFile,
+		FeedsFile:     DefaultFeedsFile,
+		UsageFile:     DefaultUsageFile,
+		StatsFile:     DefaultStatsFile,
+		URLRules:      urlnorm.DefaultRules,
+		listeners:     make([]chan DownloadUpdate, 0),
+
+		progressPending: make(map[string]*Download),
+		progressEvery:   int64(progressInterval),
+		events:          newEvents(DefaultEventHistory),
+		categories:      make(map[string]*Category),
+		CategoriesFile:  DefaultCategoriesFile,
+		WriteMode:       WriteModeWriteAt,
+		Endgame:         true,
+		Rebalance:       true,
+		StallSpeed:      stall.DefaultSpeed,
+		StallTime:       stall.DefaultTime,
+		UploadRetries:   DefaultUploadRetries,
+		QuarantineDir:   DefaultQuarantineDir,
+		ThumbnailDir:    DefaultThumbnailDir,
+		MediaPriority:   DefaultMediaPriority,
+
+		connectTimeout: DefaultConnectTimeout,
+		readTimeout:    DefaultReadTimeout,
+		SettingsFile:   DefaultSettingsFile,
 	}
+	m.client = &http.Client{
+		Transport:     &transport.Deadline{Transport: polite, Timeout: m.ConnectTimeout},
+		CheckRedirect: redirect.Policy(redirect.DefaultMax),
+	}
+	go m.coalesceProgress()
+	return m
+}
+
+// SetWorkers sets how many chunk transfers may run at once across all
+// downloads.
+func (m *Manager) SetWorkers(n int) {
+	m.pool.Resize(n)
+}
+
+func (m *Manager) Workers() int {
+	return m.pool.Size()
+}
+
+// SetMaxConcurrentDownloads sets how many downloads may run at once. The
+// rest stay queued and start in the order they were added as slots free
+// up. Lowering it lets running downloads finish rather than stopping them.
+func (m *Manager) SetMaxConcurrentDownloads(n int) {
+	m.active.Resize(n)
+}
+
+func (m *Manager) MaxConcurrentDownloads() int {
+	return m.active.Size()
+}
+
+// SetHostDelay sets the time between the starts of requests to one host,
+// across all downloads, so large batches of small files from one server
+// don't hammer it. Connections are reused either way; 0 disables the delay.
+func (m *Manager) SetHostDelay(delay time.Duration) {
+	m.polite.SetDelay(delay)
 }
 
-func (m *Manager) AddDownload(url, filename string, chunks int, connectTimeout, readTimeout string) (*Download, error) {
+func (m *Manager) HostDelay() time.Duration {
+	return m.polite.Delay()
+}
+
+// AddOptions are the settings of a download being added; the zero value
+// takes the server's defaults.
+type AddOptions struct {
+	Mirrors        []string // Other URLs of the same file its chunks are spread across
+	Filename       string   // Empty takes the name the server suggests
+	Chunks         int
+	ConnectTimeout string
+	ReadTimeout    string
+	Checksum       string // Such as "sha256:9f86d081..."; the download fails if its data doesn't match
+	RateLimit      int64
+	Retry          Retry        // How often a failed chunk is requested again
+	Auth           reqauth.Auth // Sent with every request
+	Delivery       Delivery
+	DependsOn      []string // Downloads that must complete first
+	Category       string
+	Dir            string // Saved here rather than the category's directory or the downloads directory; see outputDir
+}
+
+// AddDownload queues a download of url, with its chunks spread across url
+// and opts.Mirrors if there are any. If opts.DependsOn names other downloads
+// it waits for all of them to complete, and fails if any of them doesn't.
+// The URL is normalized first, and a *DuplicateError is returned if an
+// unfinished download already fetches it.
+func (m *Manager) AddDownload(url string, opts AddOptions) (*Download, error) {
+	if err := opts.Delivery.Validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Retry.Validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Auth.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.RateLimit < 0 {
+		return nil, errNegativeRateLimit
+	}
+	if err := opts.Delivery.validateFor(opts.Filename); err != nil {
+		return nil, err
+	}
+	var expected []digest.Expected
+	if opts.Checksum != "" {
+		parsed, err := digest.Parse(opts.Checksum)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Delivery.Monitor != "" {
+			return nil, fmt.Errorf("checksum can't be combined with monitor, since a changed file won't match it")
+		}
+		expected = append(expected, parsed)
+	}
+	url, err := m.NormalizeURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %v", err)
+	}
+	opts.Mirrors, err = m.normalizeMirrors(url, opts.Mirrors)
+	if err != nil {
+		return nil, err
+	}
+	cat, err := m.category(opts.Category)
+	if err != nil {
+		return nil, err
+	}
+	outDir, err := m.outputDir(opts.Dir, cat)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Filename != "" && !within(filepath.Join(outDir, opts.Filename), outDir) {
+		return nil, errFilenameOutside
+	}
+	if err := m.confineDelivery(&opts.Delivery); err != nil {
+		return nil, err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Set output path in downloads directory
-	outputPath := fmt.Sprintf("downloads/%s", filename)
-	if filename == "" {
-		outputPath = fmt.Sprintf("downloads/download_%s", generateID())
+	if m.closing {
+		return nil, ErrShuttingDown
+	}
+	defaultChunks, defaultConnect, defaultRead := m.defaults()
+	if cat != nil {
+		if opts.Chunks == 0 {
+			opts.Chunks = cat.Chunks
+		}
+		if opts.RateLimit == 0 {
+			opts.RateLimit = cat.RateLimit
+		}
+	}
+	if opts.Chunks == 0 {
+		opts.Chunks = defaultChunks
+	}
+	if opts.ConnectTimeout == "" {
+		opts.ConnectTimeout = defaultConnect.String()
+	}
+	if opts.ReadTimeout == "" {
+		opts.ReadTimeout = defaultRead.String()
+	}
+	if existing := m.findUnfinished(url); existing != nil {
+		return nil, &DuplicateError{URL: url, ID: existing.ID}
+	}
+
+	deps, err := m.resolveDependencies(opts.DependsOn)
+	if err != nil {
+		return nil, err
+	}
+	status := StatusQueued
+	if len(deps) > 0 {
+		status = StatusWaiting
+	}
+
+	// Set output path in the directory asked for, the category's or the
+	// downloads directory; without a filename this is a placeholder until
+	// the probe suggests one
+	outputPath := fmt.Sprintf("%s/%s", outDir, opts.Filename)
+	if opts.Filename == "" {
+		outputPath = fmt.Sprintf("%s/download_%s", outDir, generateID())
 	}
 
 	download := &Download{
 		ID:             generateID(),
 		URL:            url,
-		Filename:       filename,
+		Mirrors:        opts.Mirrors,
+		Filename:       opts.Filename,
 		OutputPath:     outputPath,
-		Status:         StatusPending,
-		Chunks:         chunks,
-		ChunkProgress:  make([]float64, chunks),
-		ConnectTimeout: connectTimeout,
-		ReadTimeout:    readTimeout,
+		PartPath:       outputPath + PartSuffix,
+		Status:         status,
+		Chunks:         opts.Chunks,
+		ChunkProgress:  make([]float64, opts.Chunks),
+		ChunkRestarts:  make([]int, opts.Chunks),
+		ConnectTimeout: opts.ConnectTimeout,
+		ReadTimeout:    opts.ReadTimeout,
+		Checksum:       opts.Checksum,
+		RateLimit:      opts.RateLimit,
+		Category:       opts.Category,
+		Dir:            opts.Dir,
+		Retry:          opts.Retry,
+		Auth:           opts.Auth,
+		Delivery:       opts.Delivery,
+		DependsOn:      opts.DependsOn,
 		StartTime:      time.Now(),
-		pauseChan:      make(chan bool),
-		lastDownloaded: 0,
-		lastUpdateTime: time.Now(),
 	}
-
-	m.downloads[download.ID] = download
+	m.track(download, deps, expected)
+	m.countFeatures(download)
+	m.save(download)
 
 	// Start download in goroutine
 	go m.startDownload(download)
+	if opts.Delivery.Monitor != "" {
+		go m.monitor(download)
+	}
 
 	return download, nil
 }
 
+// track sets up the runtime state of d, whose exported fields are filled
+// in, and adds it to the manager. The caller holds m.mu.
+func (m *Manager) track(d *Download, deps []*Download, expected []digest.Expected) {
+	d.ctx, d.cancel = context.WithCancel(m.ctx)
+	d.limiter = ratelimit.New(float64(d.RateLimit))
+	d.meter = speed.New(speed.DefaultWindow)
+	d.deps = deps
+	d.settled = newSettled()
+	d.localPath = d.OutputPath
+	d.checksum = expected
+	d.mirrors = mirror.New(append([]string{d.URL}, d.Mirrors...))
+	d.HasCredentials = !d.Auth.Empty()
+	// A download's own connect timeout is fixed when it is added; older
+	// ones follow the server's
+	deadline := &transport.Deadline{Transport: m.polite, Timeout: func() time.Duration {
+		return parseTimeout(d.ConnectTimeout, m.ConnectTimeout())
+	}}
+	d.client = &http.Client{Transport: deadline, CheckRedirect: m.client.CheckRedirect}
+	if jar, err := d.Jar(); err == nil && jar != nil {
+		d.client.Jar = jar
+	}
+	m.downloads[d.ID] = d
+}
+
+// awaitSlot waits until fewer than MaxConcurrentDownloads downloads are
+// running and takes the free slot, which the caller must release. A
+// download that has to wait is shown as queued meanwhile.
+func (m *Manager) awaitSlot(d *Download) error {
+	if m.active.TryAcquire() {
+		return nil
+	}
+	if d.status() != StatusQueued {
+		d.setStatus(StatusQueued)
+		m.broadcastUpdate(DownloadUpdate{
+			DownloadID: d.ID,
+			Type:       "status",
+			Data:       d,
+		})
+	}
+	if err := m.active.Acquire(d.ctx, d.ID); err != nil {
+		return fmt.Errorf("cancelled while queued")
+	}
+	return nil
+}
+
 func (m *Manager) startDownload(d *Download) {
+	if err := m.awaitDependencies(d); err != nil {
+		m.failDownload(d, err)
+		return
+	}
+	if err := m.awaitMonthlyCap(d); err != nil {
+		m.failDownload(d, err)
+		return
+	}
+	if err := m.awaitSlot(d); err != nil {
+		m.failDownload(d, err)
+		return
+	}
+	defer m.active.Release()
+	d.mu.Lock()
+	d.StartTime = time.Now()
 	d.Status = StatusDownloading
+	d.mu.Unlock()
 	m.broadcastUpdate(DownloadUpdate{
 		DownloadID: d.ID,
 		Type:       "status",
@@ -105,54 +706,197 @@ func (m *Manager) startDownload(d *Download) {
 	})
 
 	// Get file size and check if server supports range requests
-	resp, err := http.Head(d.URL)
+	probe, err := m.probe(d)
 	if err != nil {
-		d.Status = StatusError
-		d.Error = err.Error()
-		m.broadcastUpdate(DownloadUpdate{
-			DownloadID: d.ID,
-			Type:       "error",
-			Data:       d,
-		})
+		m.failDownload(d, err)
 		return
 	}
-	d.TotalSize = resp.ContentLength
+	d.digests = slices.Concat(d.checksum, probe.Digests)
+	d.mu.Lock()
+	d.TotalSize = probe.Size
+	d.mu.Unlock()
+	m.nameDownload(d, probe)
+	d.mu.Lock()
+	d.Remote = &RemoteVersion{ETag: probe.ETag, LastModified: probe.Modified, Size: probe.Size}
+	if probe.FinalURL != d.URL {
+		d.FinalURL = probe.FinalURL
+	}
+	d.mu.Unlock()
+	if d.FinalURL != "" {
+		d.logf("%s redirects to %s", d.URL, d.FinalURL)
+	}
 
-	// Check if server supports range requests
-	supportsRanges := resp.Header.Get("Accept-Ranges") == "bytes"
-	fmt.Printf("Server supports range requests: %v\n", supportsRanges)
-	fmt.Printf("Total file size: %d bytes\n", d.TotalSize)
+	supportsRanges := probe.Ranges
+	d.logf("Server supports range requests: %v", supportsRanges)
+	d.logf("Total file size: %d bytes", d.TotalSize)
+
+	if d.Chunks <= 0 {
+		chunks := m.recommendedChunks(d, autochunk.Count(autochunk.Probe{
+			Size:   d.TotalSize,
+			RTT:    probe.RTT,
+			Ranges: supportsRanges,
+			HTTP2:  probe.HTTP2,
+		}))
+		d.mu.Lock()
+		d.Chunks = chunks
+		d.ChunkProgress = make([]float64, d.Chunks)
+		d.ChunkRestarts = make([]int, d.Chunks)
+		d.mu.Unlock()
+		d.logf("Auto-selected %d chunks (round trip %v)", d.Chunks, probe.RTT.Round(time.Microsecond))
+	}
+
+	if err := m.resolveConflict(d, supportsRanges); err != nil {
+		m.failDownload(d, err)
+		return
+	}
 
 	if !supportsRanges || d.Chunks == 1 {
 		// Download as single file
-		fmt.Printf("Downloading as single file (no chunking)\n")
-		m.downloadSingleFile(d)
+		d.logf("Downloading as single file (no chunking)")
+		if err := m.pool.Acquire(d.ctx, d.ID); err != nil {
+			m.failDownload(d, err)
+			return
+		}
+		defer m.pool.Release()
+		d.mu.Lock()
+		d.streamable = true
+		d.mu.Unlock()
+		m.downloadSingleFile(d, supportsRanges)
 		return
 	}
 
-	// Create chunks and download
-	chunkSize := d.TotalSize / int64(d.Chunks)
+	// Create chunks and download, carrying on from a control file left by
+	// an earlier run
+	direct := !m.ChunkFiles && m.useDirectIO(d)
+	sizes, prioritized := m.layoutChunks(d, direct)
+	var resumed *control
+	if !m.ChunkFiles {
+		if resumed = loadControl(d, direct); resumed != nil {
+			sizes, prioritized = resumed.Chunks, resumed.Prioritized
+		}
+	}
+	pieces := len(sizes)
+	d.mu.Lock()
+	d.chunkBytes = make([]int64, pieces)
+	d.chunkSizes = sizes
+	d.chunkEnds = slices.Clone(sizes)
+	d.tailBytes = make([]int64, pieces)
+	d.tails = make([]*tail, pieces)
+	d.aborts = make([]context.CancelCauseFunc, pieces)
+	d.sources = make([]string, pieces)
+	if len(d.ChunkProgress) != pieces {
+		d.ChunkProgress = make([]float64, pieces)
+		d.ChunkRestarts = make([]int, pieces)
+	}
+	if resumed != nil {
+		copy(d.chunkBytes, resumed.Done)
+		d.refreshProgress()
+	}
+	d.mu.Unlock()
+
+	var partFile *os.File
+	var sink outputSink
+	if !m.ChunkFiles {
+		partFile, err = createPartFile(d)
+		if err != nil {
+			m.failDownload(d, err)
+			return
+		}
+		defer partFile.Close()
+
+		sink = m.openSink(d, partFile, direct)
+		if resumed != nil {
+			d.logf("Resuming %s with %d of %d bytes already in %s", d.Filename, d.bytesReceived(), d.TotalSize, partPath(d))
+		}
+	}
+	stopControl := make(chan struct{})
+	controlDone := make(chan struct{})
+	if sink != nil {
+		go func() {
+			defer close(controlDone)
+			keepControl(d, prioritized, direct, stopControl)
+		}()
+	} else {
+		close(controlDone)
+	}
+
 	var wg sync.WaitGroup
-	errorChan := make(chan error, d.Chunks)
+	errorChan := make(chan error, pieces)
 
-	fmt.Printf("Starting chunked download with %d chunks of %d bytes each\n", d.Chunks, chunkSize)
+	if prioritized {
+		d.logf("Fetching the first and last %d bytes of %s before the rest", sizes[0], d.Filename)
+		d.logf("Starting chunked download with %d chunks of %d bytes each in between", d.Chunks, sizes[1])
+	} else {
+		d.logf("Starting chunked download with %d chunks of %d bytes each", d.Chunks, sizes[0])
+	}
 
 	// Start progress updater goroutine
 	go m.updateProgress(d)
 
-	for i := 0; i < d.Chunks; i++ {
+	// Endgame helpers rewrite bytes the original connection may also write,
+	// and streams read bytes as soon as they are counted, which both need a
+	// sink that stores every write immediately
+	stopWatching := make(chan struct{})
+	_, buffered := sink.(*directSink)
+	d.mu.Lock()
+	d.streamable = sink != nil && !buffered
+	d.mu.Unlock()
+	if m.Endgame && sink != nil && !buffered {
+		d.races = make([]*endgame.Race, pieces)
+		go m.runEndgame(d, sink, stopWatching)
+	}
+	if m.Rebalance && sink != nil && !buffered {
+		go m.runRebalancer(d, sink, stopWatching)
+	}
+	if m.StallSpeed > 0 {
+		go m.watchStalls(d, stopWatching)
+	}
+	if len(d.Mirrors) > 0 {
+		go m.watchMirrors(d, stopWatching)
+	}
+
+	m.prewarm(d)
+	clock := d.startClock()
+
+	// The middle of a prioritized download waits for both ends
+	var ends sync.WaitGroup
+	endsDone := make(chan struct{})
+	for i := 0; i < pieces; i++ {
+		end := prioritized && (i == 0 || i == pieces-1)
+		if end {
+			ends.Add(1)
+		}
 		wg.Add(1)
 		go func(chunkIndex int) {
 			defer wg.Done()
-			err := m.downloadChunk(d, chunkIndex, chunkSize)
+			if end {
+				defer ends.Done()
+			} else {
+				select {
+				case <-endsDone:
+				case <-d.ctx.Done():
+				}
+			}
+			if err := m.pool.Acquire(d.ctx, d.ID); err != nil {
+				errorChan <- fmt.Errorf("chunk %d not started: %v", chunkIndex, err)
+				return
+			}
+			defer m.pool.Release()
+			err := m.downloadChunk(d, chunkIndex, sink)
 			if err != nil {
 				errorChan <- fmt.Errorf("chunk %d failed: %v", chunkIndex, err)
 			}
 		}(i)
 	}
+	go func() {
+		ends.Wait()
+		close(endsDone)
+	}()
 
 	wg.Wait()
 	close(errorChan)
+	close(stopWatching)
+	d.logf("Connections for %s: %s", d.Filename, &d.connStats)
 
 	// Check for chunk errors
 	var chunkErrors []string
@@ -160,300 +904,633 @@ func (m *Manager) startDownload(d *Download) {
 		chunkErrors = append(chunkErrors, err.Error())
 	}
 
+	if sink != nil {
+		if err := sink.Close(); err != nil {
+			chunkErrors = append(chunkErrors, fmt.Sprintf("failed to flush output: %v", err))
+		}
+	}
+	close(stopControl)
+	<-controlDone
+
 	if len(chunkErrors) > 0 {
-		d.Status = StatusError
-		d.Error = fmt.Sprintf("Some chunks failed: %v", chunkErrors)
-		m.broadcastUpdate(DownloadUpdate{
-			DownloadID: d.ID,
-			Type:       "error",
-			Data:       d,
-		})
+		m.failDownload(d, fmt.Errorf("Some chunks failed: %v", chunkErrors))
 		return
 	}
 
-	// Merge chunks
-	if d.Status == StatusDownloading {
-		fmt.Printf("All chunks downloaded successfully, merging files...\n")
-		err := m.mergeChunks(d)
+	// Paused just as the last chunk finished; finish once resumed
+	d.pause.Wait(d.ctx)
+
+	// Merge chunks or close the in-place .part file, then verify it and move
+	// it to its final name
+	if d.status() == StatusDownloading {
+		m.recordThroughput(d, min(d.Chunks, pieces), clock)
+		// Merging hashes the data on its way through; a part file written
+		// in place is read back instead
+		var hasher *digest.Hasher
+		if partFile != nil {
+			d.logf("All chunks downloaded successfully, finalizing file...")
+			err = finishPartFile(d, partFile)
+		} else {
+			d.logf("All chunks downloaded successfully, merging files...")
+			hasher, err = m.mergeChunks(d)
+		}
+		if err == nil {
+			err = m.verifyDigests(d, hasher)
+		}
+		if err == nil {
+			err = commitPartFile(d)
+		}
+		removeControl(d)
 		if err != nil {
-			d.Status = StatusError
-			d.Error = err.Error()
-			m.broadcastUpdate(DownloadUpdate{
-				DownloadID: d.ID,
-				Type:       "error",
-				Data:       d,
-			})
+			m.failDownload(d, err)
 			return
 		}
 
-		d.Status = StatusCompleted
-		d.Progress = 100
-		m.broadcastUpdate(DownloadUpdate{
-			DownloadID: d.ID,
-			Type:       "completed",
-			Data:       d,
-		})
+		m.deliver(d)
 	}
 }
 
-func (m *Manager) downloadChunk(d *Download, chunkIndex int, chunkSize int64) error {
-	startByte := int64(chunkIndex) * chunkSize
-	endByte := startByte + chunkSize - 1
+// probe sends a HEAD request for the download's URL, or reuses the result
+// of one sent for the same URL within the probe cache's TTL.
+func (m *Manager) probe(d *Download) (probecache.Result, error) {
+	if result, ok := m.probes.Get(d.URL); ok {
+		d.logf("Using cached probe of %s from %v ago", d.URL, time.Since(result.ProbedAt).Round(time.Second))
+		return result, nil
+	}
 
-	if chunkIndex == d.Chunks-1 {
-		endByte = d.TotalSize - 1
+	headCtx, rtt := autochunk.TraceRTT(d.connStats.Trace(d.ctx, nil))
+	headReq, err := http.NewRequestWithContext(headCtx, "HEAD", d.URL, nil)
+	if err != nil {
+		return probecache.Result{}, err
+	}
+	d.authorize(headReq)
+	resp, headErr := d.client.Do(headReq)
+	var size int64 = -1
+	var ranges bool
+	if headErr == nil {
+		resp.Body.Close()
+		d.logf("HEAD %s: %s, %d bytes, Accept-Ranges %q", d.URL, resp.Status, resp.ContentLength, resp.Header.Get("Accept-Ranges"))
+		size, ranges = resp.ContentLength, resp.Header.Get("Accept-Ranges") == "bytes"
+	} else {
+		d.logf("HEAD %s failed: %v", d.URL, headErr)
 	}
 
-	actualChunkSize := endByte - startByte + 1
+	// Some servers, and URLs signed for GET alone, reject HEAD or leave
+	// the size or range support out, while a GET, which may be sent to
+	// another CDN, answers both
+	if rangeprobe.Needed(resp) {
+		get, found, err := m.probeGet(d)
+		if err != nil {
+			d.logf("Ranged GET of %s failed: %v", d.URL, err)
+		} else {
+			resp, size, ranges, headErr = get, found.Size, found.Ranges, nil
+		}
+	}
+	if headErr != nil {
+		return probecache.Result{}, headErr
+	}
 
-	fmt.Printf("Downloading chunk %d: bytes %d-%d (%d bytes)\n", chunkIndex, startByte, endByte, actualChunkSize)
+	result := probecache.Result{
+		URL:      d.URL,
+		FinalURL: resp.Request.URL.String(),
+		Size:     size,
+		Ranges:   ranges,
+		HTTP2:    resp.ProtoMajor == 2,
+		ETag:     resp.Header.Get("ETag"),
+		Modified: resp.Header.Get("Last-Modified"),
+		Filename: savename.FromResponse(resp.Header, resp.Request.URL),
+		Type:     resp.Header.Get("Content-Type"),
+		RTT:      rtt(),
+		Digests:  digest.FromHeaders(resp.Header),
+		ProbedAt: time.Now(),
+	}
+	// Error pages say nothing about the file
+	if resp.StatusCode < 300 {
+		m.probes.Put(result)
+	}
+	return result, nil
+}
 
-	req, err := http.NewRequest("GET", d.URL, nil)
+// probeGet asks for the first byte of the download's URL, to learn what a
+// HEAD request didn't.
+func (m *Manager) probeGet(d *Download) (*http.Response, rangeprobe.Result, error) {
+	req, err := http.NewRequestWithContext(d.connStats.Trace(d.ctx, nil), "GET", d.URL, nil)
 	if err != nil {
-		return fmt.Errorf("error creating request for chunk %d: %v", chunkIndex, err)
+		return nil, rangeprobe.Result{}, err
 	}
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", startByte, endByte))
+	d.authorize(req)
+	resp, found, err := rangeprobe.Get(d.client, req)
+	if err == nil {
+		d.logf("GET %s for its first byte: %s, %d bytes, ranges %v", d.URL, resp.Status, found.Size, found.Ranges)
+	}
+	return resp, found, err
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// SetMaxRedirects sets how many redirects in a row a request follows; 0
+// follows none. It must be called before any download is added.
+func (m *Manager) SetMaxRedirects(limit int) {
+	m.client.CheckRedirect = redirect.Policy(limit)
+}
+
+// SetProbeTTL sets how long HEAD results are reused for the same URL; 0
+// disables the cache. It must be called before any download is added.
+func (m *Manager) SetProbeTTL(ttl time.Duration) {
+	m.probes = probecache.New(ttl)
+}
+
+// ProbeCache describes the cached HEAD results.
+func (m *Manager) ProbeCache() probecache.Stats {
+	return m.probes.Stats()
+}
+
+// ForgetProbe drops the cached HEAD result for url, or all of them when url
+// is empty, so the next download of it probes afresh.
+func (m *Manager) ForgetProbe(url string) {
+	m.probes.Forget(url)
+}
+
+// prewarm opens connections for the chunks that can start at once, so they
+// don't each wait for their own handshakes. The HEAD request's connection
+// is still idle in the pool, so one fewer is needed.
+func (m *Manager) prewarm(d *Download) {
+	connections := min(d.Chunks, m.pool.Size())
+	if connections < 2 {
+		return
+	}
+	started := time.Now()
+	opened, err := m.warmer.Prewarm(d.ctx, d.URL, connections-1)
 	if err != nil {
-		return fmt.Errorf("error downloading chunk %d: %v", chunkIndex, err)
+		d.logf("Pre-warming connections for %s failed: %v", d.Filename, err)
+		return
 	}
-	defer resp.Body.Close()
+	d.logf("Pre-warmed %d connections for %s in %v", opened, d.Filename, time.Since(started).Round(time.Millisecond))
+}
 
-	// Check if server supports range requests
-	if resp.StatusCode != http.StatusPartialContent {
-		return fmt.Errorf("server doesn't support range requests for chunk %d, status: %d", chunkIndex, resp.StatusCode)
-	}
+// downloadChunk fetches one byte range. With a sink the data is written at its
+// offset in the part file; otherwise it goes to a temp chunk file for merging.
+func (m *Manager) downloadChunk(d *Download, chunkIndex int, sink outputSink) error {
+	startByte := d.chunkStart(chunkIndex)
+	endByte := startByte + d.chunkSizes[chunkIndex] - 1
 
-	// Create temp file for chunk with specific naming
-	tempFileName := fmt.Sprintf("chunk_%s_%d.tmp", d.ID, chunkIndex)
-	tempFile, err := os.Create(tempFileName)
-	if err != nil {
-		return fmt.Errorf("error creating temp file for chunk %d: %v", chunkIndex, err)
+	actualChunkSize := endByte - startByte + 1
+
+	if done := atomic.LoadInt64(&d.chunkBytes[chunkIndex]); done >= actualChunkSize {
+		d.logf("Chunk %d was already downloaded", chunkIndex)
+		return nil
 	}
-	defer tempFile.Close()
+	d.logf("Downloading chunk %d: bytes %d-%d (%d bytes)", chunkIndex, startByte, endByte, actualChunkSize)
 
-	// Copy with progress tracking
-	buffer := make([]byte, 32*1024)
-	var downloaded int64
+	ctx := d.ctx
+	var race *endgame.Race
+	if d.races != nil {
+		// Let endgame mode race a second connection against this chunk
+		ctx, race = endgame.New(d.ctx)
+		d.mu.Lock()
+		d.races[chunkIndex] = race
+		d.mu.Unlock()
+	}
 
-downloadLoop:
-	for {
-		select {
-		case <-d.pauseChan:
-			// Handle pause
-			<-d.pauseChan // Wait for resume
-		default:
-			n, err := resp.Body.Read(buffer)
-			if err != nil && err != io.EOF {
-				return fmt.Errorf("error reading chunk %d: %v", chunkIndex, err)
-			}
-			if n == 0 {
-				break downloadLoop
+	// A dropped, stalled or failed connection resumes from where it
+	// stopped, as does a chunk restored from a control file
+	downloaded := atomic.LoadInt64(&d.chunkBytes[chunkIndex])
+	var err error
+	for reconnects, retries := 0, 0; ; {
+		var n int64
+		end := startByte + atomic.LoadInt64(&d.chunkEnds[chunkIndex]) - 1
+		n, err = m.fetchAttempt(ctx, d, chunkIndex, startByte, startByte+downloaded, end, sink)
+		downloaded += n
+		if n > 0 {
+			reconnects, retries = 0, 0
+		}
+		if err == nil && downloaded < actualChunkSize && downloaded >= atomic.LoadInt64(&d.chunkEnds[chunkIndex]) {
+			// The rest of the chunk was handed to another connection
+			if d.awaitTail(ctx, chunkIndex) {
+				downloaded = actualChunkSize
+				break
 			}
+			continue
+		}
+		if err == nil && downloaded < actualChunkSize {
+			err = fmt.Errorf("chunk %d ended early: expected %d bytes, got %d bytes", chunkIndex, actualChunkSize, downloaded)
+		}
+		if err == nil {
+			break
+		}
+
+		if _, direct := sink.(*directSink); direct {
+			// Direct I/O writes must start on a block boundary
+			downloaded -= downloaded % directio.AlignSize
+		}
 
-			_, writeErr := tempFile.Write(buffer[:n])
-			if writeErr != nil {
-				return fmt.Errorf("error writing chunk %d: %v", chunkIndex, writeErr)
+		if errors.Is(err, pause.ErrPaused) {
+			// Carry on from here once resumed
+			if err = d.pause.Wait(ctx); err != nil {
+				break
 			}
-			downloaded += int64(n)
+			d.logf("Chunk %d resuming at byte %d", chunkIndex, startByte+downloaded)
+			continue
+		}
 
-			// Update chunk progress
+		if errors.Is(err, mirror.ErrDropped) {
+			d.logf("Chunk %d moving to another mirror at byte %d", chunkIndex, startByte+downloaded)
+			continue
+		}
+
+		if errors.Is(err, stall.ErrStalled) {
 			d.mu.Lock()
-			d.ChunkProgress[chunkIndex] = float64(downloaded) / float64(actualChunkSize) * 100
+			d.ChunkRestarts[chunkIndex]++
 			d.mu.Unlock()
+			d.logf("Chunk %d restarting its stalled connection at byte %d", chunkIndex, startByte+downloaded)
+			continue
+		}
 
-			// Send immediate progress update for chunk progress
-			if downloaded%1048576 == 0 || err == io.EOF { // Update every 1MB or at end
-				m.broadcastUpdate(DownloadUpdate{
-					DownloadID: d.ID,
-					Type:       "progress",
-					Data:       d,
-				})
+		if !netwait.Dropped(err) || reconnects >= netwait.MaxReconnects {
+			retries++
+			if !m.awaitRetry(ctx, d, chunkIndex, retries, startByte+downloaded, err) {
+				break
 			}
+			continue
+		}
 
-			if err == io.EOF {
-				break downloadLoop
-			}
+		reconnects++
+		d.logf("Chunk %d lost its connection at byte %d, waiting for the network: %v", chunkIndex, startByte+downloaded, err)
+		if waitErr := netwait.WaitForHost(ctx, d.URL, netwait.MaxOutage); waitErr != nil {
+			err = fmt.Errorf("%v (waiting to reconnect: %v)", err, waitErr)
+			break
+		}
+		m.client.CloseIdleConnections()
+		d.logf("Chunk %d reconnecting to resume at byte %d", chunkIndex, startByte+downloaded)
+	}
+	if err != nil {
+		d.dropTail(chunkIndex)
+	}
+	if race != nil {
+		var byHelper bool
+		if byHelper, err = race.Finish(err); byHelper {
+			d.logf("Chunk %d completed by endgame connection", chunkIndex)
+			m.publishProgress(d)
+			return nil
 		}
 	}
+	if err != nil {
+		return err
+	}
 
 	// Verify we downloaded the expected amount
 	if downloaded != actualChunkSize {
 		return fmt.Errorf("chunk %d incomplete: expected %d bytes, got %d bytes", chunkIndex, actualChunkSize, downloaded)
 	}
 
-	fmt.Printf("Chunk %d completed successfully: %d bytes downloaded\n", chunkIndex, downloaded)
+	d.logf("Chunk %d completed successfully: %d bytes downloaded", chunkIndex, downloaded)
 
-	// Send immediate progress update when chunk completes
-	m.broadcastUpdate(DownloadUpdate{
-		DownloadID: d.ID,
-		Type:       "progress",
-		Data:       d,
-	})
+	// Show the chunk complete on the next progress event
+	m.publishProgress(d)
 
 	return nil
 }
 
-func (m *Manager) downloadSingleFile(d *Download) {
-	// Create downloads directory if it doesn't exist
-	os.MkdirAll("downloads", 0755)
+// fetchAttempt runs fetchRange against the next mirror, with a request that
+// watchStalls, watchMirrors and pausing can cancel.
+func (m *Manager) fetchAttempt(ctx context.Context, d *Download, chunkIndex int, startByte, from, endByte int64, sink outputSink) (int64, error) {
+	ctx, release := d.pause.Track(ctx)
+	defer release()
+	attemptCtx, abort := context.WithCancelCause(ctx)
+	url := d.mirrors.Pick()
+	d.mu.Lock()
+	d.aborts[chunkIndex] = abort
+	d.sources[chunkIndex] = url
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.aborts[chunkIndex] = nil
+		d.sources[chunkIndex] = ""
+		d.mu.Unlock()
+		abort(nil)
+	}()
+	n, err := m.fetchRange(attemptCtx, d, url, chunkIndex, startByte, from, endByte, sink, nil)
+	// Requests cancelled on purpose, such as by a pause, don't count
+	// against the mirror
+	if d.mirrors.Done(url, err != nil && attemptCtx.Err() == nil) {
+		d.logf("Dropped mirror %s after %d failed requests in a row", url, mirror.MaxFailures)
+		m.abortMirror(d, url)
+	}
+	return n, err
+}
 
-	req, err := http.NewRequest("GET", d.URL, nil)
+// fetchRange requests bytes from..endByte of the chunk starting at
+// startByte from url, one of the download's mirrors, and writes them out,
+// returning how many bytes were written. t is the chunk's tail when this
+// request fetches it; otherwise the request stops where a tail handed off
+// meanwhile starts.
+func (m *Manager) fetchRange(ctx context.Context, d *Download, url string, chunkIndex int, startByte, from, endByte int64, sink outputSink, t *tail) (int64, error) {
+	chunkCtx, watchdog := idle.WithTimeout(ctx, d.readTimeout())
+	defer watchdog.Stop()
+
+	req, err := http.NewRequestWithContext(d.connStats.Trace(chunkCtx, func(conn transport.Conn) {
+		if conn.Reused {
+			d.logf("Chunk %d reusing connection to %s (idle %v)", chunkIndex, conn.Remote, conn.IdleTime)
+		}
+	}), "GET", url, nil)
 	if err != nil {
-		d.Status = StatusError
-		d.Error = err.Error()
-		m.broadcastUpdate(DownloadUpdate{
-			DownloadID: d.ID,
-			Type:       "error",
-			Data:       d,
-		})
+		return 0, fmt.Errorf("error creating request for chunk %d: %v", chunkIndex, err)
+	}
+	d.authorize(req)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, endByte))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error downloading chunk %d: %w", chunkIndex, idle.Cause(chunkCtx, err))
+	}
+	defer resp.Body.Close()
+
+	// Check if server supports range requests
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("server doesn't support range requests for chunk %d, status: %d", chunkIndex, resp.StatusCode)
+	}
+	// The request may have been redirected to another server than the
+	// probe was, which can hold another version of the file
+	if size, ok := mirror.FileSize(resp); ok && size != d.TotalSize {
+		if url == d.URL {
+			return 0, fmt.Errorf("%s has a file of %d bytes instead of %d", resp.Request.URL.Redacted(), size, d.TotalSize)
+		}
+		return 0, fmt.Errorf("mirror %s has a file of %d bytes instead of %d", url, size, d.TotalSize)
+	}
+
+	var output chunkWriter
+	if sink != nil {
+		output, err = sink.ChunkWriter(from)
+		if err != nil {
+			return 0, fmt.Errorf("error preparing output for chunk %d: %v", chunkIndex, err)
+		}
+	} else {
+		// Create temp file for chunk with specific naming, keeping anything
+		// received before a reconnect
+		tempFileName := fmt.Sprintf("chunk_%s_%d.tmp", d.ID, chunkIndex)
+		tempFile, err := os.OpenFile(tempFileName, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return 0, fmt.Errorf("error creating temp file for chunk %d: %v", chunkIndex, err)
+		}
+		defer tempFile.Close()
+		if err := tempFile.Truncate(from - startByte); err != nil {
+			return 0, fmt.Errorf("error preparing temp file for chunk %d: %v", chunkIndex, err)
+		}
+		output = nopFlusher{io.NewOffsetWriter(tempFile, from-startByte)}
+	}
+
+	// Copy with progress tracking
+	body := m.limitReader(chunkCtx, d, resp.Body)
+	pooled := bufpool.Get()
+	defer bufpool.Put(pooled)
+	buffer := *pooled
+	var downloaded int64
+
+	// Pausing cancels the request, so the read fails with ErrPaused as its
+	// cause and the chunk asks for the rest once resumed
+	for {
+		n, err := body.Read(buffer)
+		if n > 0 {
+			watchdog.Touch()
+		}
+		if err != nil && err != io.EOF {
+			// Keep what arrived so a reconnect can carry on after it
+			output.Flush()
+			return downloaded, fmt.Errorf("error reading chunk %d: %w", chunkIndex, idle.Cause(chunkCtx, err))
+		}
+		if t == nil {
+			if allowed := atomic.LoadInt64(&d.chunkEnds[chunkIndex]) - (from - startByte + downloaded); int64(n) >= allowed {
+				n, err = int(max(allowed, 0)), io.EOF
+			}
+		}
+		if n == 0 {
+			break
+		}
+
+		_, writeErr := output.Write(buffer[:n])
+		if writeErr != nil {
+			return downloaded, fmt.Errorf("error writing chunk %d: %v", chunkIndex, writeErr)
+		}
+		downloaded += int64(n)
+		m.countBytes(d, url, n)
+		d.mirrors.Count(url, n)
+		if t != nil {
+			atomic.AddInt64(&d.tailBytes[chunkIndex], int64(n))
+		} else {
+			d.advanceChunk(chunkIndex, from-startByte+downloaded)
+		}
+
+		m.publishProgress(d)
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if err := output.Flush(); err != nil {
+		return downloaded, fmt.Errorf("error flushing chunk %d: %v", chunkIndex, err)
+	}
+	return downloaded, nil
+}
+
+// downloadSingleFile fetches the file with one request. When the server
+// supports ranges, a part file left by an earlier run is continued.
+func (m *Manager) downloadSingleFile(d *Download, ranges bool) {
+	// Create the download's directory if it doesn't exist
+	os.MkdirAll(filepath.Dir(partPath(d)), 0755)
+
+	var resumed *control
+	if ranges && d.TotalSize > 0 {
+		if resumed = loadControl(d, false); resumed != nil && len(resumed.Chunks) != 1 {
+			removeControl(d)
+			resumed = nil
+		}
+	}
+
+	ctx, watchdog := idle.WithTimeout(d.ctx, d.readTimeout())
+	defer watchdog.Stop()
+
+	req, err := http.NewRequestWithContext(d.connStats.Trace(ctx, nil), "GET", d.URL, nil)
+	if err != nil {
+		m.failDownload(d, err)
 		return
 	}
+	d.authorize(req)
+
+	if resumed != nil && resumed.Done[0] > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", resumed.Done[0]))
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := d.client.Do(req)
 	if err != nil {
-		d.Status = StatusError
-		d.Error = err.Error()
-		m.broadcastUpdate(DownloadUpdate{
-			DownloadID: d.ID,
-			Type:       "error",
-			Data:       d,
-		})
+		m.failDownload(d, idle.Cause(ctx, err))
 		return
 	}
 	defer resp.Body.Close()
 
-	// Create the output file
-	outputFile, err := os.Create(d.OutputPath)
+	// Write to the part file; it is renamed once verified
+	var from int64
+	if resumed != nil && resp.StatusCode == http.StatusPartialContent {
+		from = resumed.Done[0]
+	}
+	outputFile, err := os.OpenFile(partPath(d), os.O_CREATE|os.O_WRONLY, 0644)
+	if err == nil {
+		if err = outputFile.Truncate(from); err == nil {
+			_, err = outputFile.Seek(from, io.SeekStart)
+		}
+		if err != nil {
+			outputFile.Close()
+		}
+	}
 	if err != nil {
-		d.Status = StatusError
-		d.Error = err.Error()
-		m.broadcastUpdate(DownloadUpdate{
-			DownloadID: d.ID,
-			Type:       "error",
-			Data:       d,
-		})
+		m.failDownload(d, err)
 		return
 	}
 	defer outputFile.Close()
 
-	fmt.Printf("Downloading single file: %s\n", d.Filename)
+	d.logf("Downloading single file: %s", d.Filename)
 
 	// Copy with progress tracking
-	buffer := make([]byte, 32*1024)
-	var downloaded int64
+	body := m.limitReader(ctx, d, resp.Body)
+	pooled := bufpool.Get()
+	defer bufpool.Put(pooled)
+	buffer := *pooled
+	d.mu.Lock()
+	d.chunkBytes = []int64{from}
+	d.chunkSizes = []int64{d.TotalSize}
+	d.mu.Unlock()
+	if from > 0 {
+		d.logf("Resuming %s with %d of %d bytes already in %s", d.Filename, from, d.TotalSize, partPath(d))
+	}
+	if ranges && d.TotalSize > 0 {
+		stopControl, controlDone := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(controlDone)
+			keepControl(d, false, false, stopControl)
+		}()
+		defer func() {
+			close(stopControl)
+			<-controlDone
+		}()
+	}
+
+	// Hash the data as it arrives, unless part of it came from an earlier
+	// run
+	if len(d.digests) == len(d.checksum) {
+		d.digests = append(d.digests, digest.FromHeaders(resp.Header)...)
+	}
+	var hasher *digest.Hasher
+	if from == 0 && len(d.digests) > 0 {
+		hasher = digest.ForExpected(d.digests)
+	}
 
 	// Start progress updater for single file download
-	go func() {
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
+	go m.updateProgress(d)
+	clock := d.startClock()
 
-		for range ticker.C {
-			if d.Status != StatusDownloading {
-				return
-			}
+	// A single request for the whole file can't carry on from an offset,
+	// so while paused it is held open instead
+	for {
+		if d.pause.Paused() {
+			watchdog.Pause()
+			d.pause.Wait(ctx)
+			watchdog.Touch()
+		}
+		n, err := body.Read(buffer)
+		if n > 0 {
+			watchdog.Touch()
+		}
+		if err != nil && err != io.EOF {
+			m.failDownload(d, idle.Cause(ctx, err))
+			return
+		}
+		if n == 0 {
+			break
+		}
 
-			d.mu.Lock()
-			if d.TotalSize > 0 {
-				d.Progress = float64(downloaded) / float64(d.TotalSize) * 100
-				d.Downloaded = downloaded
-			}
-			d.mu.Unlock()
+		_, writeErr := outputFile.Write(buffer[:n])
+		if writeErr != nil {
+			m.failDownload(d, writeErr)
+			return
+		}
+		if hasher != nil {
+			hasher.Write(buffer[:n])
+		}
+		atomic.AddInt64(&d.chunkBytes[0], int64(n))
+		m.countBytes(d, d.URL, n)
 
-			m.broadcastUpdate(DownloadUpdate{
-				DownloadID: d.ID,
-				Type:       "progress",
-				Data:       d,
-			})
+		if err == io.EOF {
+			break
 		}
-	}()
+	}
 
-downloadLoop:
-	for {
-		select {
-		case <-d.pauseChan:
-			// Handle pause
-			<-d.pauseChan // Wait for resume
-		default:
-			n, err := resp.Body.Read(buffer)
-			if err != nil && err != io.EOF {
-				d.Status = StatusError
-				d.Error = err.Error()
-				m.broadcastUpdate(DownloadUpdate{
-					DownloadID: d.ID,
-					Type:       "error",
-					Data:       d,
-				})
-				return
-			}
-			if n == 0 {
-				break downloadLoop
-			}
+	if err := outputFile.Close(); err != nil {
+		m.failDownload(d, err)
+		return
+	}
 
-			_, writeErr := outputFile.Write(buffer[:n])
-			if writeErr != nil {
-				d.Status = StatusError
-				d.Error = writeErr.Error()
-				m.broadcastUpdate(DownloadUpdate{
-					DownloadID: d.ID,
-					Type:       "error",
-					Data:       d,
-				})
-				return
-			}
-			downloaded += int64(n)
+	m.recordThroughput(d, 1, clock)
 
-			if err == io.EOF {
-				break downloadLoop
-			}
-		}
+	err = m.verifyDigests(d, hasher)
+	if err == nil {
+		err = commitPartFile(d)
+	}
+	if err != nil {
+		m.failDownload(d, err)
+		return
 	}
 
-	d.Status = StatusCompleted
-	d.Progress = 100
-	d.Downloaded = downloaded
-	fmt.Printf("Single file download completed: %d bytes\n", downloaded)
-
-	m.broadcastUpdate(DownloadUpdate{
-		DownloadID: d.ID,
-		Type:       "completed",
-		Data:       d,
-	})
+	d.logf("Single file download completed: %d bytes", d.bytesReceived())
+	m.deliver(d)
 }
 
-func (m *Manager) mergeChunks(d *Download) error {
-	// Create downloads directory if it doesn't exist
-	os.MkdirAll("downloads", 0755)
+// mergeChunks joins the chunk files into the part file. When d has
+// checksums to verify, the data is hashed on the way through and the hasher
+// returned.
+func (m *Manager) mergeChunks(d *Download) (*digest.Hasher, error) {
+	// Create the download's directory if it doesn't exist
+	os.MkdirAll(filepath.Dir(partPath(d)), 0755)
 
-	// Create the final output file
-	outputFile, err := os.Create(d.OutputPath)
+	// Merge into the part file; it is renamed once verified
+	outputFile, err := os.Create(partPath(d))
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
+		return nil, fmt.Errorf("failed to create output file: %v", err)
 	}
 	defer outputFile.Close()
 
-	fmt.Printf("Merging %d chunks for download %s\n", d.Chunks, d.ID)
+	pieces := len(d.chunkSizes)
+	d.logf("Merging %d chunks for download %s", pieces, d.ID)
 
+	var hasher *digest.Hasher
+	if len(d.digests) > 0 {
+		hasher = digest.ForExpected(d.digests)
+	}
 	var totalMerged int64
 
 	// Merge all chunk files in order
-	for i := 0; i < d.Chunks; i++ {
+	for i := 0; i < pieces; i++ {
 		chunkFileName := fmt.Sprintf("chunk_%s_%d.tmp", d.ID, i)
 
 		chunkFile, err := os.Open(chunkFileName)
 		if err != nil {
-			return fmt.Errorf("failed to open chunk file %d: %v", i, err)
+			return nil, fmt.Errorf("failed to open chunk file %d: %v", i, err)
+		}
+
+		info, err := chunkFile.Stat()
+		if err != nil {
+			chunkFile.Close()
+			return nil, fmt.Errorf("failed to stat chunk file %d: %v", i, err)
 		}
 
 		// Copy chunk content to output file
-		copied, err := io.Copy(outputFile, chunkFile)
+		var copied int64
+		if hasher != nil {
+			copied, err = fastcopy.Reader(io.MultiWriter(outputFile, hasher), chunkFile)
+		} else {
+			copied, err = fastcopy.File(outputFile, chunkFile, info.Size(), nil)
+		}
 		chunkFile.Close()
 
 		if err != nil {
-			return fmt.Errorf("failed to copy chunk %d: %v", i, err)
+			return nil, fmt.Errorf("failed to copy chunk %d: %v", i, err)
 		}
 
 		totalMerged += copied
@@ -461,16 +1538,16 @@ func (m *Manager) mergeChunks(d *Download) error {
 		// Remove temporary chunk file
 		os.Remove(chunkFileName)
 
-		fmt.Printf("Merged chunk %d/%d (%d bytes)\n", i+1, d.Chunks, copied)
+		d.logf("Merged chunk %d/%d (%d bytes)", i+1, pieces, copied)
 	}
 
 	// Verify total size
 	if totalMerged != d.TotalSize {
-		return fmt.Errorf("merged file size mismatch: expected %d bytes, got %d bytes", d.TotalSize, totalMerged)
+		return nil, fmt.Errorf("merged file size mismatch: expected %d bytes, got %d bytes", d.TotalSize, totalMerged)
 	}
 
-	fmt.Printf("Successfully merged all chunks for download %s (%d bytes total)\n", d.ID, totalMerged)
-	return nil
+	d.logf("Successfully merged all chunks for download %s (%d bytes total)", d.ID, totalMerged)
+	return hasher, nil
 }
 
 func (m *Manager) PauseDownload(id string) error {
@@ -482,9 +1559,10 @@ func (m *Manager) PauseDownload(id string) error {
 		return fmt.Errorf("download not found")
 	}
 
-	if download.Status == StatusDownloading {
-		download.Status = StatusPaused
-		download.pauseChan <- true
+	// Every connection is dropped; chunks request the rest of their range
+	// once resumed
+	if download.status() == StatusDownloading && download.pause.Pause() {
+		download.setStatus(StatusPaused)
 		m.broadcastUpdate(DownloadUpdate{
 			DownloadID: id,
 			Type:       "paused",
@@ -503,10 +1581,20 @@ func (m *Manager) ResumeDownload(id string) error {
 	if !exists {
 		return fmt.Errorf("download not found")
 	}
+	if m.shuttingDown() {
+		return ErrShuttingDown
+	}
 
-	if download.Status == StatusPaused {
-		download.Status = StatusDownloading
-		download.pauseChan <- false
+	if download.status() == StatusPaused {
+		if download.held {
+			// Restored paused, so nothing is running yet
+			download.held = false
+			download.setStatus(StatusQueued)
+			go m.startDownload(download)
+		} else {
+			download.setStatus(StatusDownloading)
+			download.pause.Resume()
+		}
 		m.broadcastUpdate(DownloadUpdate{
 			DownloadID: id,
 			Type:       "resumed",
@@ -526,7 +1614,62 @@ func (m *Manager) Subscribe() chan DownloadUpdate {
 	return ch
 }
 
+// countFeatures records a new download and which optional features it
+// asked for.
+func (m *Manager) countFeatures(d *Download) {
+	m.Telemetry.Count("downloads.added")
+	features := map[string]bool{
+		"upload":    d.UploadTo != "",
+		"move":      d.MoveTo != "",
+		"extract":   d.ExtractTo != "",
+		"compress":  d.Compress != "",
+		"monitor":   d.Monitor != "",
+		"dependsOn": len(d.DependsOn) > 0,
+	}
+	for feature, used := range features {
+		if used {
+			m.Telemetry.Count("feature." + feature)
+		}
+	}
+}
+
 func (m *Manager) broadcastUpdate(update DownloadUpdate) {
+	// Every final state is announced here, so dependents are released here
+	if d, ok := update.Data.(*Download); ok && finalUpdates[update.Type] {
+		d.settled.close()
+		now := time.Now()
+		d.mu.Lock()
+		d.FinishedAt = &now
+		d.mu.Unlock()
+		m.countFinished(d, update.Type == "completed")
+		m.Telemetry.Count("downloads." + update.Type)
+		if update.Type == "error" {
+			d.log.add("Failed: " + d.Error)
+		} else {
+			d.log.add("Finished: " + update.Type)
+		}
+	}
+	d, ok := update.Data.(*Download)
+	if !ok {
+		m.send(update)
+		return
+	}
+	m.save(d)
+	m.notifyWebhooks(update, d)
+
+	// Progress events still waiting are stale once this one is out
+	m.progressMu.Lock()
+	defer m.progressMu.Unlock()
+	atomic.AddInt64(&d.updates, 1)
+	m.send(update)
+}
+
+// send numbers update and hands it to every listener with room for it.
+func (m *Manager) send(update DownloadUpdate) {
+	m.events.mu.Lock()
+	defer m.events.mu.Unlock()
+	update = m.events.add(update)
+
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
@@ -567,41 +1710,29 @@ func (m *Manager) updateProgress(d *Download) {
 
 	for tick := range ticker.C {
 		_ = tick // Use the tick variable to avoid unused variable warning
-		if d.Status != StatusDownloading {
+		switch d.status() {
+		case StatusPaused:
+			continue
+		case StatusDownloading:
+		default:
 			return
 		}
 
 		d.mu.Lock()
-		totalProgress := 0.0
-		for _, chunkProgress := range d.ChunkProgress {
-			totalProgress += chunkProgress
-		}
-		d.Progress = totalProgress / float64(d.Chunks)
-		d.Downloaded = int64(float64(d.TotalSize) * d.Progress / 100)
+		d.refreshProgress()
 
-		// Calculate speed
-		now := time.Now()
-		timeDiff := now.Sub(d.lastUpdateTime).Seconds()
-		if timeDiff > 0 {
-			bytesDiff := d.Downloaded - d.lastDownloaded
-			d.Speed = float64(bytesDiff) / timeDiff
-			d.lastDownloaded = d.Downloaded
-			d.lastUpdateTime = now
-
-			// Calculate time remaining
-			if d.Speed > 0 {
-				remainingBytes := d.TotalSize - d.Downloaded
-				d.TimeRemaining = int(float64(remainingBytes) / d.Speed)
-			}
+		// Speed over the recent window, smoothed so the UI doesn't jitter
+		d.meter.Set(d.Downloaded)
+		d.Speed = d.meter.Rate()
+		if eta, ok := speed.ETA(d.TotalSize-d.Downloaded, d.Speed); ok {
+			d.TimeRemaining = int(eta.Seconds())
 		}
 
 		d.mu.Unlock()
 
-		m.broadcastUpdate(DownloadUpdate{
-			DownloadID: d.ID,
-			Type:       "progress",
-			Data:       d,
-		})
+		// Keeps events flowing while reads are slow; coalesced with the
+		// chunks' own
+		m.publishProgress(d)
 	}
 }
 
@@ -614,19 +1745,34 @@ func (m *Manager) DeleteDownload(id string) error {
 		return fmt.Errorf("download not found")
 	}
 
+	// Stop any transfer still running for this download
+	download.cancel()
+
 	// Cancel the download if it's in progress
+	download.mu.Lock()
 	if download.Status == StatusDownloading {
 		download.Status = StatusError
 		download.Error = "Download cancelled"
-
-		// Clean up any temporary chunk files
-		for i := 0; i < download.Chunks; i++ {
+	}
+	unfinished := download.Status != StatusCompleted
+	download.mu.Unlock()
+	if unfinished {
+		// Clean up the partial data of a download deleted before it
+		// finished, whether running, paused, queued or failed
+		for i := 0; i < max(download.Chunks, len(download.chunkSizes)); i++ {
 			chunkFileName := fmt.Sprintf("chunk_%s_%d.tmp", download.ID, i)
 			os.Remove(chunkFileName)
 		}
+		os.Remove(partPath(download))
+		removeControl(download)
+	}
+	if download.Thumbnail != "" {
+		os.Remove(download.Thumbnail)
 	}
 
+	download.settled.close()
 	delete(m.downloads, id)
+	m.forget(id)
 	return nil
 }
 
@@ -0,0 +1,76 @@
+package downloader
+
+import (
+	"encoding/hex"
+	"path/filepath"
+
+	"github.com/govind1331/Datablip/internal/digest"
+	"github.com/govind1331/Datablip/internal/metalink"
+)
+
+// metalinkHashes are the digest algorithms Metalink has names for; they are
+// spelled the same as the digest package's.
+var metalinkHashes = map[string]bool{
+	digest.MD5:    true,
+	digest.SHA1:   true,
+	digest.SHA256: true,
+	digest.SHA512: true,
+}
+
+// Metalink describes a download as a Metalink 4 document. Checksums the
+// file was verified against are included, or while it is still downloading
+// the ones the server declared. A completed file still on disk is hashed
+// with SHA-256 if no checksum covered that, once.
+func (m *Manager) Metalink(id string) (*metalink.Metalink, error) {
+	d, err := m.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	file := metalink.File{
+		Name: filepath.Base(d.OutputPath),
+		Size: d.TotalSize,
+		URLs: []metalink.URL{{Priority: 1, Location: d.URL}},
+	}
+	if d.Filename != "" {
+		file.Name = filepath.Base(d.Filename)
+	}
+	seen := make(map[string]bool)
+	addHash := func(algorithm, value string) {
+		if metalinkHashes[algorithm] && !seen[algorithm] {
+			seen[algorithm] = true
+			file.Hashes = append(file.Hashes, metalink.Hash{Type: algorithm, Value: value})
+		}
+	}
+	for _, result := range d.Verification {
+		if result.Match {
+			addHash(result.Algorithm, result.Actual)
+		}
+	}
+	if d.Verification == nil {
+		for _, expected := range d.digests {
+			if !expected.Advisory {
+				addHash(expected.Algorithm, hex.EncodeToString(expected.Value))
+			}
+		}
+	}
+	sum, completed, path := d.sha256, d.Status == StatusCompleted, d.OutputPath
+	d.mu.RUnlock()
+
+	if sum == nil && completed && !seen[digest.SHA256] {
+		if sum, err = hashFile(path, nil); err == nil {
+			d.mu.Lock()
+			d.sha256 = sum
+			d.mu.Unlock()
+		}
+	}
+	if sum != nil {
+		addHash(digest.SHA256, hex.EncodeToString(sum))
+	}
+
+	return &metalink.Metalink{
+		Generator: "Datablip",
+		Files:     []metalink.File{file},
+	}, nil
+}
@@ -0,0 +1,66 @@
+package downloader
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/mirror"
+	"github.com/govind1331/Datablip/internal/urlnorm"
+)
+
+// normalizeMirrors normalizes the mirrors of a download of primary like
+// its URL, dropping repeats and primary itself.
+func (m *Manager) normalizeMirrors(primary string, mirrors []string) ([]string, error) {
+	var normalized []string
+	seen := map[string]bool{primary: true}
+	for _, raw := range mirrors {
+		u, err := url.Parse(raw)
+		if err != nil || !urlnorm.Supported(u.Scheme) || u.Host == "" {
+			return nil, fmt.Errorf("invalid mirror %q: must be an http, https, ftp, ftps, s3, gs or az URL", raw)
+		}
+		mirror, err := m.NormalizeURL(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mirror %q: %v", raw, err)
+		}
+		if !seen[mirror] {
+			seen[mirror] = true
+			normalized = append(normalized, mirror)
+		}
+	}
+	return normalized, nil
+}
+
+// watchMirrors measures the download's mirrors every second until stop is
+// closed, dropping those that stay far slower than the fastest one.
+func (m *Manager) watchMirrors(d *Download, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if d.pause.Paused() {
+			continue
+		}
+		for _, url := range d.mirrors.Check() {
+			d.logf("Dropped mirror %s for staying below %.0f%% of the fastest mirror's speed", url, mirror.SlowFactor*100)
+			m.abortMirror(d, url)
+		}
+	}
+}
+
+// abortMirror cancels the requests in flight to a dropped mirror, so their
+// chunks carry on from where they are on the others.
+func (m *Manager) abortMirror(d *Download, url string) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for i, source := range d.sources {
+		if source == url && d.aborts[i] != nil {
+			d.aborts[i](mirror.ErrDropped)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/speed"
+)
+
+// MinMonitorInterval is the shortest interval at which a monitored
+// download's source may be checked.
+const MinMonitorInterval = 30 * time.Second
+
+// RemoteVersion identifies the version of the remote file a download
+// fetched.
+type RemoteVersion struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Size         int64  `json:"size"`
+}
+
+// changed reports whether v and newer describe different files. Validators
+// the server didn't send on both occasions are ignored.
+func (v RemoteVersion) changed(newer RemoteVersion) bool {
+	switch {
+	case v.ETag != "" && newer.ETag != "":
+		return v.ETag != newer.ETag
+	case v.LastModified != "" && newer.LastModified != "":
+		return v.LastModified != newer.LastModified
+	}
+	return v.Size >= 0 && newer.Size >= 0 && v.Size != newer.Size
+}
+
+// monitor checks the source of a download with the Monitor option every
+// interval and downloads it again when it has changed, keeping the local
+// copy current. A download that failed is retried at the next check. It
+// stops when the download is deleted.
+func (m *Manager) monitor(d *Download) {
+	interval, _ := time.ParseDuration(d.Monitor)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.mu.RLock()
+		status, known := d.Status, d.Remote
+		d.mu.RUnlock()
+
+		switch status {
+		case StatusCompleted:
+			current, err := m.checkRemote(d)
+			if err != nil {
+				d.logf("Checking %s for changes failed: %v", d.URL, err)
+				continue
+			}
+			if known != nil && !known.changed(current) {
+				continue
+			}
+			d.logf("%s changed, downloading it again", d.URL)
+		case StatusError, StatusChecksumMismatch:
+			d.logf("Retrying monitored download %s", d.URL)
+		default:
+			continue // Still running, or quarantined
+		}
+		m.refresh(d)
+	}
+}
+
+// checkRemote sends a HEAD request for the download's URL, bypassing the
+// probe cache, or a GET for its first byte if HEAD doesn't give the size.
+func (m *Manager) checkRemote(d *Download) (RemoteVersion, error) {
+	req, err := http.NewRequestWithContext(d.ctx, "HEAD", d.URL, nil)
+	if err != nil {
+		return RemoteVersion{}, err
+	}
+	d.authorize(req)
+	resp, err := d.client.Do(req)
+	size := int64(-1)
+	if err == nil {
+		resp.Body.Close()
+		size = resp.ContentLength
+	}
+	if err != nil || resp.StatusCode >= 400 || size < 0 {
+		if get, found, getErr := m.probeGet(d); getErr == nil {
+			resp, size, err = get, found.Size, nil
+		}
+	}
+	if err != nil {
+		return RemoteVersion{}, err
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	d.LastChecked = &now
+	d.mu.Unlock()
+
+	if resp.StatusCode >= 300 {
+		return RemoteVersion{}, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return RemoteVersion{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Size:         size,
+	}, nil
+}
+
+// refresh resets the download and runs it again from the start. The old
+// file stays in place until the new one is verified and replaces it, and
+// delivery then runs again.
+func (m *Manager) refresh(d *Download) {
+	m.probes.Forget(d.URL)
+
+	d.mu.Lock()
+	d.Status = StatusQueued
+	d.Progress, d.Downloaded, d.Speed, d.TimeRemaining = 0, 0, 0, 0
+	d.ChunkProgress = make([]float64, d.Chunks)
+	d.ChunkRestarts = make([]int, d.Chunks)
+	d.Error = ""
+	d.Verification = nil
+	d.OutputPath = d.localPath
+	d.StageProgress = 0
+	d.UploadedTo, d.MovedTo = "", ""
+	d.Threat, d.QuarantinedTo = "", ""
+	d.Extracting, d.Extracted = "", nil
+	d.Media = nil
+	d.ContentType = ""
+	d.Refreshes++
+	d.chunkBytes, d.chunkSizes = nil, nil
+	d.chunkEnds, d.tailBytes, d.tails = nil, nil, nil
+	d.races, d.aborts = nil, nil
+	d.digests, d.sha256 = nil, nil
+	d.meter = speed.New(speed.DefaultWindow)
+	d.mu.Unlock()
+
+	go m.startDownload(d)
+}
@@ -0,0 +1,140 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/govind1331/Datablip/internal/fastcopy"
+)
+
+// moveSlice is how much is copied between checks for cancellation.
+const moveSlice = 64 << 20
+
+// moveToDestination moves the finished file into d.MoveTo, or copies it
+// there when d.KeepLocal is set. A rename within one filesystem is instant;
+// otherwise the file is copied beside its destination under a temporary
+// name, both copies are hashed to make sure the destination holds the same
+// bytes, and only then is it renamed into place.
+func (m *Manager) moveToDestination(d *Download) error {
+	dir := filepath.Join(d.MoveTo, d.RoutedTo)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %v", err)
+	}
+	dest := filepath.Join(dir, filepath.Base(d.OutputPath))
+	m.startStage(d, StatusMoving)
+
+	if !d.KeepLocal && os.Rename(d.OutputPath, dest) == nil {
+		m.finishMove(d, dest)
+		return nil
+	}
+
+	if err := m.copyVerified(d, d.OutputPath, dest); err != nil {
+		return err
+	}
+	if !d.KeepLocal {
+		if err := os.Remove(d.OutputPath); err != nil {
+			return fmt.Errorf("copied to %s, but failed to remove the original: %v", dest, err)
+		}
+	}
+	m.finishMove(d, dest)
+	return nil
+}
+
+func (m *Manager) finishMove(d *Download, dest string) {
+	d.mu.Lock()
+	d.MovedTo = dest
+	if !d.KeepLocal {
+		d.OutputPath = dest
+	}
+	d.StageProgress = 100
+	d.mu.Unlock()
+	d.logf("Delivered %s to %s", d.Filename, dest)
+}
+
+func (m *Manager) copyVerified(d *Download, src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := dest + PartSuffix
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", tmp, err)
+	}
+	committed := false
+	defer func() {
+		out.Close()
+		if !committed {
+			os.Remove(tmp)
+		}
+	}()
+
+	// Copying and then reading the copy back count as one stage
+	progress := &stageProgress{m: m, d: d, total: 2 * info.Size()}
+	for copied := int64(0); copied < info.Size(); {
+		if err := d.ctx.Err(); err != nil {
+			return err
+		}
+		n, err := fastcopy.File(out, in, min(moveSlice, info.Size()-copied), func(n int64) { progress.add(n) })
+		copied += n
+		if err != nil {
+			return fmt.Errorf("failed to copy to %s: %v", tmp, err)
+		}
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("failed to flush %s: %v", tmp, err)
+	}
+
+	// Read the copy back from the destination rather than trusting the
+	// write path, which may be a network mount
+	srcSum, err := hashFile(src, nil)
+	if err != nil {
+		return err
+	}
+	destSum, err := hashFile(tmp, progress)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(srcSum, destSum) {
+		return fmt.Errorf("copy at %s does not match the download (sha256 %x, expected %x)", dest, destSum, srcSum)
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return fmt.Errorf("failed to move %s into place: %v", tmp, err)
+	}
+	committed = true
+	return nil
+}
+
+// hashFile returns the SHA-256 of the file at path, reporting the bytes
+// read to progress if it is non-nil.
+func hashFile(path string, progress *stageProgress) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	var r io.Reader = file
+	if progress != nil {
+		r = &stageReader{r: file, progress: progress}
+	}
+	if _, err := fastcopy.Reader(hasher, r); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return hasher.Sum(nil), nil
+}
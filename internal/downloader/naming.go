@@ -0,0 +1,95 @@
+package downloader
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/govind1331/Datablip/internal/conflict"
+	"github.com/govind1331/Datablip/internal/nametemplate"
+	"github.com/govind1331/Datablip/internal/probecache"
+)
+
+// nameDownload saves a download added without a filename under the name
+// its probe found, instead of its download_<id> placeholder, or under what
+// the filename template renders to if one is set. A number is added if
+// another download already has the name. A download that already wrote to
+// its placeholder keeps it, so it resumes.
+func (m *Manager) nameDownload(d *Download, probe probecache.Result) {
+	template := m.FilenameTemplate()
+	if d.Filename != "" || (probe.Filename == "" && template == "") {
+		return
+	}
+	if _, err := os.Stat(partPath(d)); err == nil {
+		return
+	}
+
+	suggested := probe.Filename
+	if template != "" {
+		basename := cmp.Or(suggested, filepath.Base(d.OutputPath))
+		u, _ := url.Parse(cmp.Or(probe.FinalURL, d.URL))
+		suggested = nametemplate.Render(template, nametemplate.Vars{
+			URL:         u,
+			Basename:    basename,
+			ID:          d.ID,
+			ContentType: probe.Type,
+			Time:        d.StartTime,
+		})
+	}
+
+	// A file already there is left to the download's conflict policy
+	m.mu.Lock()
+	name := m.freeName(d, suggested, false)
+	outputPath := fmt.Sprintf("%s/%s", filepath.Dir(d.OutputPath), name)
+	d.mu.Lock()
+	d.Filename = name
+	d.OutputPath = outputPath
+	d.PartPath = outputPath + PartSuffix
+	d.localPath = outputPath
+	d.mu.Unlock()
+	m.mu.Unlock()
+
+	if template != "" {
+		d.logf("Saving as %s, from the filename template", name)
+	} else {
+		d.logf("Saving as %s, the name the server suggested", name)
+	}
+	m.save(d)
+}
+
+// freeName returns name, or name numbered with conflict.Numbered, whichever
+// no other download is saving under in d's directory, nor, with onDisk, a
+// file there. The caller holds m.mu.
+func (m *Manager) freeName(d *Download, name string, onDisk bool) string {
+	free := name
+	for n := 2; m.nameTaken(d, free, onDisk); n++ {
+		free = conflict.Numbered(name, n)
+	}
+	return free
+}
+
+// nameTaken reports whether a download other than d is saving under name
+// in the directory d is saved in, or, with onDisk, a file named name or
+// its part file is there.
+func (m *Manager) nameTaken(d *Download, name string, onDisk bool) bool {
+	path := fmt.Sprintf("%s/%s", filepath.Dir(d.OutputPath), name)
+	for _, candidate := range []string{path, path + PartSuffix} {
+		if _, err := os.Lstat(candidate); err == nil && onDisk {
+			return true
+		}
+	}
+	for _, other := range m.downloads {
+		if other == d {
+			continue
+		}
+		other.mu.RLock()
+		output := other.OutputPath
+		other.mu.RUnlock()
+		if filepath.Clean(output) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var (
+	errDirOutside      = errors.New("dir must be inside the downloads directory, or one of -allowed-dirs if absolute")
+	errFilenameOutside = errors.New("filename must be a path inside the download's directory")
+)
+
+// outputDir returns the directory a download added with dir is saved in,
+// creating it. Empty is the downloads directory, or cat's. A relative dir is
+// inside that; an absolute one must be inside the downloads directory or one
+// of AllowedDirs. Neither may lead out of it, with ".." or a symlink.
+func (m *Manager) outputDir(dir string, cat *Category) (string, error) {
+	base := downloadsDir()
+	if cat != nil {
+		base = cat.dir()
+	}
+	if dir == "" {
+		return base, nil
+	}
+
+	allowed := []string{base}
+	if filepath.IsAbs(dir) {
+		allowed = append([]string{downloadsDir()}, m.AllowedDirs...)
+	} else if filepath.IsLocal(dir) {
+		dir = filepath.Join(base, dir)
+	} else {
+		return "", errDirOutside
+	}
+	if !dirAllowed(dir, allowed) {
+		return "", errDirOutside
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create dir: %v", err)
+	}
+	return filepath.Clean(dir), nil
+}
+
+// dirAllowed reports whether dir, with symlinks in the part of it that
+// exists followed, is at or under one of allowed.
+func dirAllowed(dir string, allowed []string) bool {
+	real, err := realPath(dir)
+	if err != nil {
+		return false
+	}
+	for _, base := range allowed {
+		if base, err := realPath(base); err == nil && within(real, base) {
+			return true
+		}
+	}
+	return false
+}
+
+// realPath returns the absolute path path leads to, following symlinks in
+// its longest part that exists; the rest is joined on as is.
+func realPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var rest string
+	for {
+		real, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		parent := filepath.Dir(path)
+		if !os.IsNotExist(err) || parent == path {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// deliveryDir returns dir, a directory a download is moved or unpacked into,
+// made absolute. A relative dir is inside the downloads directory; like an
+// absolute one, it must not lead out of it or one of AllowedDirs.
+func (m *Manager) deliveryDir(dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	if !filepath.IsAbs(dir) {
+		if !filepath.IsLocal(dir) {
+			return "", errDirOutside
+		}
+		dir = filepath.Join(downloadsDir(), dir)
+	}
+	if !dirAllowed(dir, append([]string{downloadsDir()}, m.AllowedDirs...)) {
+		return "", errDirOutside
+	}
+	return filepath.Abs(dir)
+}
+
+// confineDelivery makes the directories dl delivers to absolute, refusing
+// any outside the downloads directory and AllowedDirs.
+func (m *Manager) confineDelivery(dl *Delivery) (err error) {
+	if dl.MoveTo, err = m.deliveryDir(dl.MoveTo); err != nil {
+		return err
+	}
+	dl.ExtractTo, err = m.deliveryDir(dl.ExtractTo)
+	return err
+}
@@ -0,0 +1,89 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withDownloadsDir points the downloads directory at dir for the test.
+func withDownloadsDir(t *testing.T, dir string) {
+	downloadsDirMu.Lock()
+	saved := DownloadsDir
+	DownloadsDir = dir
+	downloadsDirMu.Unlock()
+	t.Cleanup(func() {
+		downloadsDirMu.Lock()
+		DownloadsDir = saved
+		downloadsDirMu.Unlock()
+	})
+}
+
+func TestAddDownloadRefusesExtractToOutside(t *testing.T) {
+	root := t.TempDir()
+	withDownloadsDir(t, filepath.Join(root, "downloads"))
+	m := NewManager(context.Background())
+	m.AllowedDirs = []string{filepath.Join(root, "nas")}
+
+	for _, extractTo := range []string{
+		filepath.Join(root, "elsewhere"),
+		"/etc",
+		filepath.Join(root, "nas", "..", "elsewhere"),
+		"../elsewhere",
+	} {
+		_, err := m.AddDownload("https://example.com/a.zip", AddOptions{
+			Filename: "a.zip",
+			Delivery: Delivery{ExtractTo: extractTo},
+		})
+		if !errors.Is(err, errDirOutside) {
+			t.Errorf("extractTo %q: got error %v, want %v", extractTo, err, errDirOutside)
+		}
+	}
+	if downloads := m.GetAllDownloads(); len(downloads) != 0 {
+		t.Errorf("got %d downloads added, want none", len(downloads))
+	}
+}
+
+func TestConfineDelivery(t *testing.T) {
+	root := t.TempDir()
+	downloads := filepath.Join(root, "downloads")
+	withDownloadsDir(t, downloads)
+	m := NewManager(context.Background())
+	m.AllowedDirs = []string{filepath.Join(root, "nas")}
+
+	// A symlink inside the downloads directory leading out of it
+	if err := os.MkdirAll(downloads, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(downloads, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dir  string
+		want string // Empty if refused
+	}{
+		{"unpacked", filepath.Join(downloads, "unpacked")},
+		{filepath.Join(downloads, "a", "b"), filepath.Join(downloads, "a", "b")},
+		{filepath.Join(root, "nas", "films"), filepath.Join(root, "nas", "films")},
+		{filepath.Join(root, "other"), ""},
+		{"../other", ""},
+		{"escape/other", ""},
+	}
+	for _, test := range tests {
+		for _, dl := range []Delivery{{MoveTo: test.dir}, {ExtractTo: test.dir}} {
+			err := m.confineDelivery(&dl)
+			got := dl.MoveTo + dl.ExtractTo
+			switch {
+			case test.want == "" && !errors.Is(err, errDirOutside):
+				t.Errorf("%q: got error %v, want %v", test.dir, err, errDirOutside)
+			case test.want != "" && err != nil:
+				t.Errorf("%q: got error %v", test.dir, err)
+			case test.want != "" && got != test.want:
+				t.Errorf("%q: got %q, want %q", test.dir, got, test.want)
+			}
+		}
+	}
+}
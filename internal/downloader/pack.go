@@ -0,0 +1,252 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/compress"
+)
+
+// Archive packs the files of several downloads into one .zip, .tar,
+// .tar.gz or .tar.zst file under DownloadsDir, once they have all settled.
+type Archive struct {
+	ID            string         `json:"id"`
+	Name          string         `json:"name"`
+	Downloads     []string       `json:"downloads"`
+	RemoveSources bool           `json:"removeSources,omitempty"` // Delete the files once packed
+	Status        DownloadStatus `json:"status"`                  // waiting, compressing, completed or error
+	Progress      float64        `json:"progress"`
+	Packing       string         `json:"packing,omitempty"` // File being added
+	OutputPath    string         `json:"outputPath"`
+	Size          int64          `json:"size,omitempty"`
+	Packed        []string       `json:"packed,omitempty"`  // Downloads in the archive
+	Skipped       []string       `json:"skipped,omitempty"` // Downloads that failed or left no local file
+	Error         string         `json:"error,omitempty"`
+	Created       time.Time      `json:"created"`
+}
+
+// snapshot copies the archive for callers outside the manager. The caller
+// holds m.archivesMu, which guards every archive.
+func (a *Archive) snapshot() Archive {
+	return Archive{
+		ID:            a.ID,
+		Name:          a.Name,
+		Downloads:     a.Downloads,
+		RemoveSources: a.RemoveSources,
+		Status:        a.Status,
+		Progress:      a.Progress,
+		Packing:       a.Packing,
+		OutputPath:    a.OutputPath,
+		Size:          a.Size,
+		Packed:        append([]string(nil), a.Packed...),
+		Skipped:       append([]string(nil), a.Skipped...),
+		Error:         a.Error,
+		Created:       a.Created,
+	}
+}
+
+// AddArchive packs the files of the given downloads into name under
+// DownloadsDir once every one of them has finished. Downloads that fail are
+// left out.
+func (m *Manager) AddArchive(name string, ids []string, removeSources bool) (Archive, error) {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return Archive{}, fmt.Errorf("invalid archive name %q", name)
+	}
+	format, ok := compress.DetectArchive(name)
+	if !ok {
+		return Archive{}, fmt.Errorf("archive name must end in .zip, .tar, .tar.gz or .tar.zst")
+	}
+	if format == compress.TarZstd {
+		if err := compress.Zstd.Validate(); err != nil {
+			return Archive{}, err
+		}
+	}
+	if len(ids) == 0 {
+		return Archive{}, fmt.Errorf("no downloads to pack")
+	}
+	output := filepath.Join(downloadsDir(), name)
+	if _, err := os.Stat(output); err == nil {
+		return Archive{}, fmt.Errorf("%s already exists", name)
+	}
+
+	m.mu.RLock()
+	downloads := make([]*Download, len(ids))
+	for i, id := range ids {
+		downloads[i] = m.downloads[id]
+		if downloads[i] == nil {
+			m.mu.RUnlock()
+			return Archive{}, fmt.Errorf("download %s not found", id)
+		}
+	}
+	m.mu.RUnlock()
+
+	a := &Archive{
+		ID:            generateID(),
+		Name:          name,
+		Downloads:     ids,
+		RemoveSources: removeSources,
+		Status:        StatusWaiting,
+		OutputPath:    output,
+		Created:       time.Now(),
+	}
+	m.archivesMu.Lock()
+	for _, other := range m.archives {
+		if other.OutputPath == output && other.Status != StatusError {
+			m.archivesMu.Unlock()
+			return Archive{}, fmt.Errorf("archive %s is already being packed", name)
+		}
+	}
+	m.archives[a.ID] = a
+	snapshot := a.snapshot()
+	m.archivesMu.Unlock()
+
+	go m.pack(a, format, downloads)
+	return snapshot, nil
+}
+
+// Archives returns a snapshot of every archive, oldest first.
+func (m *Manager) Archives() []Archive {
+	m.archivesMu.Lock()
+	defer m.archivesMu.Unlock()
+	archives := make([]Archive, 0, len(m.archives))
+	for _, a := range m.archives {
+		archives = append(archives, a.snapshot())
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Created.Before(archives[j].Created) })
+	return archives
+}
+
+// GetArchive returns a snapshot of an archive.
+func (m *Manager) GetArchive(id string) (Archive, error) {
+	m.archivesMu.Lock()
+	defer m.archivesMu.Unlock()
+	a, ok := m.archives[id]
+	if !ok {
+		return Archive{}, fmt.Errorf("archive not found")
+	}
+	return a.snapshot(), nil
+}
+
+// pack waits for the downloads to settle, then writes the archive.
+func (m *Manager) pack(a *Archive, format compress.ArchiveFormat, downloads []*Download) {
+	var files []string
+	var packed []*Download
+	for _, d := range downloads {
+		select {
+		case <-d.settled.ch:
+		case <-m.ctx.Done():
+			m.archiveDone(a, fmt.Errorf("cancelled while waiting for download %s", d.ID))
+			return
+		}
+		d.mu.RLock()
+		status, output := d.Status, d.OutputPath
+		d.mu.RUnlock()
+		if _, err := os.Stat(output); status != StatusCompleted || err != nil {
+			m.archivesMu.Lock()
+			a.Skipped = append(a.Skipped, d.ID)
+			m.archivesMu.Unlock()
+			continue
+		}
+		files = append(files, output)
+		packed = append(packed, d)
+	}
+	if len(files) == 0 {
+		m.archiveDone(a, fmt.Errorf("none of the downloads left a file to pack"))
+		return
+	}
+
+	var total int64
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			total += info.Size()
+		}
+	}
+	m.archivesMu.Lock()
+	a.Status = StatusCompressing
+	m.archivesMu.Unlock()
+	m.publishArchive(a)
+
+	var done int64
+	lastPublish := time.Now()
+	tmp := a.OutputPath + PartSuffix
+	os.Remove(tmp)
+	err := compress.Pack(m.ctx, tmp, format, files, compress.Progress{
+		Entry: func(name string) {
+			m.archivesMu.Lock()
+			a.Packing = name
+			m.archivesMu.Unlock()
+			m.publishArchive(a)
+		},
+		Bytes: func(n int64) {
+			done += n
+			if total > 0 {
+				m.archivesMu.Lock()
+				a.Progress = float64(done) / float64(total) * 100
+				m.archivesMu.Unlock()
+			}
+			if time.Since(lastPublish) >= m.progressInterval() {
+				lastPublish = time.Now()
+				m.publishArchive(a)
+			}
+		},
+	})
+	if err == nil {
+		err = os.Rename(tmp, a.OutputPath)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		m.archiveDone(a, err)
+		return
+	}
+
+	for _, d := range packed {
+		d.mu.Lock()
+		d.PackedInto = a.OutputPath
+		output := d.OutputPath
+		d.mu.Unlock()
+		m.archivesMu.Lock()
+		a.Packed = append(a.Packed, d.ID)
+		m.archivesMu.Unlock()
+		if a.RemoveSources {
+			if err := os.Remove(output); err != nil {
+				d.logf("Could not remove %s after packing it: %v", output, err)
+			}
+		}
+		d.logf("Packed %s into %s", d.Filename, a.OutputPath)
+	}
+	m.archiveDone(a, nil)
+}
+
+// archiveDone records how packing ended and announces it.
+func (m *Manager) archiveDone(a *Archive, err error) {
+	m.archivesMu.Lock()
+	a.Packing = ""
+	if err != nil {
+		a.Status = StatusError
+		a.Error = err.Error()
+	} else {
+		a.Status = StatusCompleted
+		a.Progress = 100
+		if info, err := os.Stat(a.OutputPath); err == nil {
+			a.Size = info.Size()
+		}
+	}
+	m.archivesMu.Unlock()
+	m.publishArchive(a)
+}
+
+// publishArchive sends the archive's state to listeners as an "archive"
+// update.
+func (m *Manager) publishArchive(a *Archive) {
+	m.archivesMu.Lock()
+	snapshot := a.snapshot()
+	m.archivesMu.Unlock()
+	m.broadcastUpdate(DownloadUpdate{
+		DownloadID: a.ID,
+		Type:       "archive",
+		Data:       &snapshot,
+	})
+}
@@ -0,0 +1,222 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/govind1331/Datablip/internal/directio"
+	"github.com/govind1331/Datablip/internal/mmap"
+)
+
+// WriteMode selects how chunk data is written into the part file.
+type WriteMode string
+
+const (
+	// WriteModeWriteAt writes each chunk with positioned writes (default).
+	WriteModeWriteAt WriteMode = "writeat"
+	// WriteModeMmap copies chunk data into a shared memory mapping of the
+	// preallocated part file. Running out of disk space while pages are
+	// flushed crashes the process, so keep it to filesystems with room.
+	WriteModeMmap WriteMode = "mmap"
+)
+
+// ParseWriteMode validates a write mode name; empty means WriteModeWriteAt.
+func ParseWriteMode(name string) (WriteMode, error) {
+	switch mode := WriteMode(name); mode {
+	case "", WriteModeWriteAt:
+		return WriteModeWriteAt, nil
+	case WriteModeMmap:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown write mode %q (want %q or %q)", name, WriteModeWriteAt, WriteModeMmap)
+	}
+}
+
+// PartSuffix marks a download that is still being written or verified.
+const PartSuffix = ".part"
+
+// directIOMinSize is the smallest download written with direct I/O when the
+// manager has it enabled; smaller files gain nothing from skipping the cache.
+const directIOMinSize = 256 << 20
+
+func partPath(d *Download) string {
+	return d.OutputPath + PartSuffix
+}
+
+// outputSink receives chunk data written in place into the part file.
+type outputSink interface {
+	// ChunkWriter returns a sequential writer starting at offset.
+	ChunkWriter(offset int64) (chunkWriter, error)
+	Close() error
+}
+
+type chunkWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// offsetSink writes through the page cache with WriteAt.
+type offsetSink struct {
+	file *os.File
+}
+
+func (s *offsetSink) ChunkWriter(offset int64) (chunkWriter, error) {
+	return nopFlusher{io.NewOffsetWriter(s.file, offset)}, nil
+}
+
+func (s *offsetSink) Close() error { return nil }
+
+type nopFlusher struct{ io.Writer }
+
+func (nopFlusher) Flush() error { return nil }
+
+// mmapSink copies chunk data straight into a shared mapping of the part
+// file.
+type mmapSink struct {
+	region *mmap.Region
+}
+
+func openMmapSink(file *os.File, size int64) (*mmapSink, error) {
+	region, err := mmap.Map(file, size)
+	if err != nil {
+		return nil, err
+	}
+	return &mmapSink{region: region}, nil
+}
+
+func (s *mmapSink) ChunkWriter(offset int64) (chunkWriter, error) {
+	return &mmapWriter{data: s.region.Bytes(), offset: offset}, nil
+}
+
+func (s *mmapSink) Close() error {
+	return s.region.Close()
+}
+
+type mmapWriter struct {
+	data   []byte
+	offset int64
+}
+
+func (w *mmapWriter) Write(p []byte) (int, error) {
+	if w.offset >= int64(len(w.data)) {
+		return 0, io.ErrShortWrite
+	}
+	n := copy(w.data[w.offset:], p)
+	w.offset += int64(n)
+	if n < len(p) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+
+func (w *mmapWriter) Flush() error { return nil }
+
+// directSink writes through a second, O_DIRECT descriptor of the part file.
+// Chunk offsets must be aligned to directio.AlignSize.
+type directSink struct {
+	file *os.File
+}
+
+func openDirectSink(d *Download) (*directSink, error) {
+	file, err := directio.OpenFile(partPath(d), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open part file for direct I/O: %v", err)
+	}
+	return &directSink{file: file}, nil
+}
+
+func (s *directSink) ChunkWriter(offset int64) (chunkWriter, error) {
+	return directio.NewWriter(s.file, offset)
+}
+
+func (s *directSink) Close() error {
+	return s.file.Close()
+}
+
+// useDirectIO reports whether d should bypass the page cache.
+func (m *Manager) useDirectIO(d *Download) bool {
+	return m.WriteMode == WriteModeWriteAt && m.DirectIO && directio.Supported && d.TotalSize >= directIOMinSize
+}
+
+// openSink picks the writer for the part file according to the manager's
+// write mode, falling back to WriteAt when the preferred mode is unavailable.
+func (m *Manager) openSink(d *Download, file *os.File, direct bool) outputSink {
+	switch {
+	case m.WriteMode == WriteModeMmap:
+		sink, err := openMmapSink(file, d.TotalSize)
+		if err == nil {
+			d.logf("Writing through memory-mapped output")
+			return sink
+		}
+		d.logf("Memory-mapped output unavailable, using WriteAt: %v", err)
+	case direct:
+		sink, err := openDirectSink(d)
+		if err == nil {
+			d.logf("Writing with direct I/O")
+			return sink
+		}
+		d.logf("Direct I/O unavailable, using buffered writes: %v", err)
+	}
+	return &offsetSink{file: file}
+}
+
+// createPartFile opens <output>.part and sizes it to the full download so
+// every chunk can write at its own offset.
+func createPartFile(d *Download) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(d.OutputPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	file, err := os.OpenFile(partPath(d), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create part file: %v", err)
+	}
+
+	if err := file.Truncate(d.TotalSize); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to preallocate part file: %v", err)
+	}
+	return file, nil
+}
+
+// finishPartFile flushes and closes the part file once every chunk is in.
+func finishPartFile(d *Download, file *os.File) error {
+	// Direct I/O pads the final block; drop anything past the real size
+	if err := file.Truncate(d.TotalSize); err != nil {
+		return fmt.Errorf("failed to truncate part file: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync part file: %v", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat part file: %v", err)
+	}
+	if info.Size() != d.TotalSize {
+		return fmt.Errorf("part file size mismatch: expected %d bytes, got %d bytes", d.TotalSize, info.Size())
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close part file: %v", err)
+	}
+
+	d.logf("Successfully wrote all chunks for download %s (%d bytes total)", d.ID, info.Size())
+	return nil
+}
+
+// commitPartFile renames the verified part file to the output path. The
+// rename is atomic, so anything watching the downloads directory only ever
+// sees the finished file under its real name.
+func commitPartFile(d *Download) error {
+	if err := os.Rename(partPath(d), d.OutputPath); err != nil {
+		return fmt.Errorf("failed to rename part file: %v", err)
+	}
+
+	d.mu.Lock()
+	d.PartPath = ""
+	d.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,176 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/govind1331/Datablip/internal/digest"
+	"github.com/govind1331/Datablip/internal/reqauth"
+	"github.com/govind1331/Datablip/internal/store"
+)
+
+// OpenStore opens the store in path, restores the downloads saved in it and
+// saves every download there from then on. Finished downloads come back as
+// history. Unfinished ones are queued again and carry on from their part
+// files, except paused ones, which wait to be resumed. Records that can't be
+// restored are listed in the result's Errors and dropped.
+func (m *Manager) OpenStore(path string) (*QueueImport, error) {
+	s, err := store.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []*Download
+	var dropped []string
+	result := &QueueImport{Imported: []*Download{}}
+	err = s.ForEach(func(id string, record []byte) error {
+		d := &Download{}
+		stored := storedDownload{Download: d}
+		if err := json.Unmarshal(record, &stored); err != nil || d.ID != id {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: invalid record", id))
+			dropped = append(dropped, id)
+			return nil
+		}
+		d.Auth = stored.Auth
+		saved = append(saved, d)
+		return nil
+	})
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	// Dependencies are older than their dependents, so they are restored
+	// first
+	slices.SortFunc(saved, func(a, b *Download) int { return compareIDs(a.ID, b.ID) })
+
+	m.mu.Lock()
+	for _, d := range saved {
+		if err := m.restore(d); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s (%s): %v", d.ID, d.URL, err))
+			dropped = append(dropped, d.ID)
+			continue
+		}
+		result.Imported = append(result.Imported, d)
+	}
+	m.mu.Unlock()
+
+	m.storeMu.Lock()
+	m.store = s
+	m.storeMu.Unlock()
+	for _, id := range dropped {
+		m.forget(id)
+	}
+	for _, d := range result.Imported {
+		m.save(d)
+		if d.Status != StatusPaused && !finished(d.Status) {
+			go m.startDownload(d)
+		}
+		if d.Monitor != "" {
+			go m.monitor(d)
+		}
+	}
+	return result, nil
+}
+
+// restore adds a download saved by an earlier run. The caller holds m.mu.
+func (m *Manager) restore(d *Download) error {
+	if _, exists := m.downloads[d.ID]; exists {
+		return fmt.Errorf("already added")
+	}
+	var expected []digest.Expected
+	if d.Checksum != "" {
+		parsed, err := digest.Parse(d.Checksum)
+		if err != nil {
+			return err
+		}
+		expected = append(expected, parsed)
+	}
+
+	if finished(d.Status) {
+		m.track(d, nil, expected)
+		d.settled.close()
+		return nil
+	}
+
+	deps, err := m.resolveDependencies(d.DependsOn)
+	if err != nil {
+		return err
+	}
+	switch {
+	case d.Status == StatusPaused:
+		d.held = true
+	case len(deps) > 0:
+		d.Status = StatusWaiting
+	default:
+		d.Status = StatusQueued
+	}
+	d.Speed, d.TimeRemaining, d.Error = 0, 0, ""
+	m.track(d, deps, expected)
+	return nil
+}
+
+// finished reports whether a download in status is done, one way or
+// another, and won't start again by itself.
+func finished(status DownloadStatus) bool {
+	switch status {
+	case StatusCompleted, StatusError, StatusChecksumMismatch, StatusQuarantined:
+		return true
+	}
+	return false
+}
+
+// storedDownload is a download as the store keeps it, with the credentials
+// its own JSON leaves out alongside its other fields.
+type storedDownload struct {
+	*Download
+	reqauth.Auth
+}
+
+// save writes d to the store, if one is open.
+func (m *Manager) save(d *Download) {
+	m.storeMu.Lock()
+	defer m.storeMu.Unlock()
+	if m.store == nil {
+		return
+	}
+	d.mu.RLock()
+	record, err := json.Marshal(storedDownload{Download: d, Auth: d.Auth})
+	d.mu.RUnlock()
+	if err == nil {
+		err = m.store.Put(d.ID, record)
+	}
+	if err != nil {
+		log.Printf("Failed to save download %s: %v", d.ID, err)
+	}
+}
+
+// forget removes the download with the given ID from the store, if one is
+// open.
+func (m *Manager) forget(id string) {
+	m.storeMu.Lock()
+	defer m.storeMu.Unlock()
+	if m.store == nil {
+		return
+	}
+	if err := m.store.Delete(id); err != nil {
+		log.Printf("Failed to remove download %s from the store: %v", id, err)
+	}
+}
+
+// CloseStore saves every download once more, with the progress it made, and
+// closes the store.
+func (m *Manager) CloseStore() error {
+	for _, d := range m.GetAllDownloads() {
+		m.save(d)
+	}
+	m.storeMu.Lock()
+	defer m.storeMu.Unlock()
+	if m.store == nil {
+		return nil
+	}
+	err := m.store.Close()
+	m.store = nil
+	return err
+}
@@ -0,0 +1,118 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/reqauth"
+)
+
+// TestDownloadSavedToStore downloads a file with a store open, so every
+// update is saved while the transfer changes the download; run it with
+// -race.
+func TestDownloadSavedToStore(t *testing.T) {
+	for _, chunks := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d chunks", chunks), func(t *testing.T) {
+			testDownloadSavedToStore(t, chunks)
+		})
+	}
+}
+
+func testDownloadSavedToStore(t *testing.T, chunks int) {
+	data := bytes.Repeat([]byte("datablip"), 512<<10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	root := t.TempDir()
+	withDownloadsDir(t, filepath.Join(root, "downloads"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := NewManager(ctx)
+	m.StatsFile, m.UsageFile, m.HostStatsFile = "", "", ""
+	if _, err := m.OpenStore(filepath.Join(root, "downloads.db")); err != nil {
+		t.Fatal(err)
+	}
+	defer m.CloseStore()
+	updates := m.Subscribe()
+
+	d, err := m.AddDownload(server.URL+"/file.bin", AddOptions{Filename: "file.bin", Chunks: chunks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(30 * time.Second)
+	for done := false; !done; {
+		select {
+		case update := <-updates:
+			if update.DownloadID != d.ID {
+				continue
+			}
+			switch update.Type {
+			case "completed":
+				done = true
+			case "error", "quarantined":
+				t.Fatalf("got %s update, want completed", update.Type)
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for the download to complete")
+		}
+	}
+
+	got, err := os.ReadFile(d.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %d bytes saved, want the %d served", len(got), len(data))
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.Progress != 100 || d.Downloaded != int64(len(data)) || d.Speed != 0 {
+		t.Errorf("got progress %v, %d bytes at %v B/s, want 100, %d at 0", d.Progress, d.Downloaded, d.Speed, len(data))
+	}
+}
+
+func TestCredentialsOnlyInStore(t *testing.T) {
+	auth := reqauth.Auth{
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+		Cookie:   "session=cookie",
+		Username: "alice",
+		Password: "password",
+	}
+	d := &Download{ID: "1", URL: "https://example.com/a.zip", Auth: auth, HasCredentials: true}
+
+	listed, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"token", "cookie", "password"} {
+		if bytes.Contains(listed, []byte(secret)) {
+			t.Errorf("download JSON %s holds %q", listed, secret)
+		}
+	}
+	if !bytes.Contains(listed, []byte(`"hasCredentials":true`)) {
+		t.Errorf("download JSON %s lacks hasCredentials", listed)
+	}
+
+	record, err := json.Marshal(storedDownload{Download: d, Auth: d.Auth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := storedDownload{Download: &Download{}}
+	if err := json.Unmarshal(record, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored.Auth, auth) {
+		t.Errorf("got %+v restored from the store, want %+v", restored.Auth, auth)
+	}
+}
@@ -0,0 +1,152 @@
+package downloader
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultWorkers is how many chunk transfers run at once across all
+// downloads unless configured otherwise.
+const DefaultWorkers = 16
+
+// DefaultMaxConcurrentDownloads is how many downloads run at once unless
+// configured otherwise. The rest stay queued until a slot frees up.
+const DefaultMaxConcurrentDownloads = 3
+
+// workerPool limits the number of chunk transfers, and so connections, in
+// flight across every download. Waiting transfers are granted slots round
+// robin by download, so one download with many chunks can't starve the
+// others. The manager keeps a second pool of whole-download slots, where
+// each download waits at most once and so slots go out in queue order.
+type workerPool struct {
+	mu     sync.Mutex
+	size   int
+	busy   int
+	queues map[string][]chan struct{} // Waiters per download, oldest first
+	order  []string                   // Downloads with waiters, in turn order
+	next   int
+}
+
+func newWorkerPool(size int) *workerPool {
+	return &workerPool{
+		size:   max(size, 1),
+		queues: make(map[string][]chan struct{}),
+	}
+}
+
+// Acquire blocks until a slot is granted to the download or ctx is done.
+// A successful Acquire must be paired with Release.
+func (p *workerPool) Acquire(ctx context.Context, downloadID string) error {
+	p.mu.Lock()
+	if p.busy < p.size && len(p.order) == 0 {
+		p.busy++
+		p.mu.Unlock()
+		return nil
+	}
+
+	grant := make(chan struct{})
+	if len(p.queues[downloadID]) == 0 {
+		p.order = append(p.order, downloadID)
+	}
+	p.queues[downloadID] = append(p.queues[downloadID], grant)
+	p.mu.Unlock()
+
+	select {
+	case <-grant:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		select {
+		case <-grant:
+			// Granted while giving up; hand the slot on
+			p.busy--
+			p.dispatch()
+		default:
+			p.remove(downloadID, grant)
+		}
+		return ctx.Err()
+	}
+}
+
+// TryAcquire takes a slot only if one is free and nobody is waiting.
+func (p *workerPool) TryAcquire() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.busy < p.size && len(p.order) == 0 {
+		p.busy++
+		return true
+	}
+	return false
+}
+
+// Release returns a slot and grants it to the next waiting download.
+func (p *workerPool) Release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.busy--
+	p.dispatch()
+}
+
+// Resize changes the number of slots. Shrinking takes effect as running
+// transfers finish.
+func (p *workerPool) Resize(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.size = max(size, 1)
+	p.dispatch()
+}
+
+func (p *workerPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+// dispatch hands free slots to waiters, one download at a time. The caller
+// must hold p.mu.
+func (p *workerPool) dispatch() {
+	for p.busy < p.size && len(p.order) > 0 {
+		p.next %= len(p.order)
+		id := p.order[p.next]
+
+		queue := p.queues[id]
+		grant := queue[0]
+		p.queues[id] = queue[1:]
+		p.busy++
+		close(grant)
+
+		if len(p.queues[id]) == 0 {
+			delete(p.queues, id)
+			p.order = append(p.order[:p.next], p.order[p.next+1:]...)
+		} else {
+			p.next++
+		}
+	}
+}
+
+// remove drops a waiter that gave up. The caller must hold p.mu.
+func (p *workerPool) remove(downloadID string, grant chan struct{}) {
+	queue := p.queues[downloadID]
+	for i, waiting := range queue {
+		if waiting == grant {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(queue) > 0 {
+		p.queues[downloadID] = queue
+		return
+	}
+
+	delete(p.queues, downloadID)
+	for i, id := range p.order {
+		if id == downloadID {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			if i < p.next {
+				p.next--
+			}
+			break
+		}
+	}
+}
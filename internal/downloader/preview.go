@@ -0,0 +1,53 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/media"
+)
+
+// DefaultThumbnailDir is where thumbnails of media downloads are kept,
+// relative to the server's working directory like the downloads directory.
+const DefaultThumbnailDir = "thumbnails"
+
+// mediaTimeout bounds probing a file and rendering its thumbnail.
+const mediaTimeout = time.Minute
+
+// describeMedia fills in the metadata and thumbnail of audio, video and
+// image downloads when ffprobe is installed. It never fails the download;
+// a file that can't be described is simply shown without a preview.
+func (m *Manager) describeMedia(d *Download) {
+	if !media.IsMedia(d.OutputPath) || !media.Available() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(d.ctx, mediaTimeout)
+	defer cancel()
+
+	info, err := media.Probe(ctx, d.OutputPath)
+	if err != nil {
+		d.logf("Could not read media info of %s: %v", d.Filename, err)
+		return
+	}
+
+	var thumbnail string
+	if info.Width > 0 {
+		dest := filepath.Join(m.ThumbnailDir, d.ID+".jpg")
+		err := os.MkdirAll(m.ThumbnailDir, 0755)
+		if err == nil {
+			err = media.Thumbnail(ctx, d.OutputPath, dest, info)
+		}
+		if err != nil {
+			d.logf("Could not render a thumbnail of %s: %v", d.Filename, err)
+		} else {
+			thumbnail = dest
+		}
+	}
+
+	d.mu.Lock()
+	d.Media = info
+	d.Thumbnail = thumbnail
+	d.mu.Unlock()
+}
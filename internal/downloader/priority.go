@@ -0,0 +1,52 @@
+package downloader
+
+import (
+	"github.com/govind1331/Datablip/internal/directio"
+	"github.com/govind1331/Datablip/internal/media"
+)
+
+// DefaultMediaPriority is how many bytes at each end of an audio or video
+// file are fetched before the rest.
+const DefaultMediaPriority = 4 << 20
+
+// layoutChunks splits a chunked download into the byte ranges its chunks
+// fetch, returning their sizes in file order. Media files get two extra
+// pieces, the first and last MediaPriority bytes, which is where containers
+// keep their headers and indexes; prioritized reports whether they did. The
+// d.Chunks chunks in between split the middle as usual. With direct I/O
+// every range starts on an aligned offset.
+func (m *Manager) layoutChunks(d *Download, direct bool) (sizes []int64, prioritized bool) {
+	align := int64(1)
+	if direct {
+		align = directio.AlignSize
+	}
+
+	start, end := int64(0), d.TotalSize
+	piece := m.MediaPriority &^ (align - 1)
+	prioritized = piece > 0 && media.IsMedia(d.Filename) && d.TotalSize > 4*piece
+	if prioritized {
+		start = piece
+		end = (d.TotalSize - piece) &^ (align - 1)
+		sizes = append(sizes, piece)
+	}
+
+	chunkSize := (end - start) / int64(d.Chunks) &^ (align - 1)
+	for range d.Chunks - 1 {
+		sizes = append(sizes, chunkSize)
+	}
+	sizes = append(sizes, end-start-chunkSize*int64(d.Chunks-1))
+
+	if prioritized {
+		sizes = append(sizes, d.TotalSize-end)
+	}
+	return sizes, prioritized
+}
+
+// chunkStart returns the offset of chunk i's first byte.
+func (d *Download) chunkStart(i int) int64 {
+	var start int64
+	for _, size := range d.chunkSizes[:i] {
+		start += size
+	}
+	return start
+}
@@ -0,0 +1,124 @@
+package downloader
+
+import (
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/mirror"
+)
+
+// DefaultProgressRate is how many progress events a download gets per
+// second at most.
+const DefaultProgressRate = 4
+
+// progressInterval is the gap between progress events at the default rate.
+const progressInterval = time.Second / DefaultProgressRate
+
+// moving are the statuses progress events are sent in; once a download
+// stops, its last full update has the final counters.
+var moving = map[DownloadStatus]bool{
+	StatusDownloading: true,
+	StatusUploading:   true,
+	StatusMoving:      true,
+	StatusScanning:    true,
+	StatusExtracting:  true,
+	StatusCompressing: true,
+}
+
+// ProgressUpdate is the data of a progress event: only what changes while a
+// download runs, named as in Download, rather than the whole download.
+type ProgressUpdate struct {
+	ID            string         `json:"id"`
+	Downloaded    int64          `json:"downloaded"`
+	Progress      float64        `json:"progress"`
+	Speed         float64        `json:"speed"`
+	TimeRemaining int            `json:"timeRemaining"`
+	ChunkProgress []float64      `json:"chunkProgress,omitempty"`
+	StageProgress float64        `json:"stageProgress,omitempty"`
+	Extracting    string         `json:"extracting,omitempty"`
+	MirrorStats   []mirror.Stats `json:"mirrorStats,omitempty"`
+}
+
+// SetProgressRate sets how many progress events per second each download
+// gets at most. Changes in between are coalesced into the next one.
+func (m *Manager) SetProgressRate(n int) {
+	atomic.StoreInt64(&m.progressEvery, int64(time.Second/time.Duration(max(n, 1))))
+}
+
+// ProgressRate returns how many progress events per second each download
+// gets at most.
+func (m *Manager) ProgressRate() int {
+	return int(time.Second / m.progressInterval())
+}
+
+func (m *Manager) progressInterval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&m.progressEvery))
+}
+
+// publishProgress notes that the download's counters moved. They are
+// refreshed and published by coalesceProgress on its next tick, however
+// many times the download's chunks report in between.
+func (m *Manager) publishProgress(d *Download) {
+	if !atomic.CompareAndSwapInt32(&d.progressPending, 0, 1) {
+		return // Already waiting for the next tick
+	}
+	m.progressMu.Lock()
+	m.progressPending[d.ID] = d
+	m.progressMu.Unlock()
+}
+
+// coalesceProgress publishes a progress event for each download that moved
+// since the last tick, until the manager's context is cancelled.
+func (m *Manager) coalesceProgress() {
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(m.progressInterval()):
+		}
+
+		m.progressMu.Lock()
+		pending := m.progressPending
+		m.progressPending = make(map[string]*Download, len(pending))
+		m.progressMu.Unlock()
+
+		for _, d := range pending {
+			atomic.StoreInt32(&d.progressPending, 0)
+			updates := atomic.LoadInt64(&d.updates)
+			progress, ok := d.progressUpdate()
+			if !ok {
+				continue
+			}
+
+			// A full update sent meanwhile already carries newer counters
+			m.progressMu.Lock()
+			if atomic.LoadInt64(&d.updates) == updates {
+				m.send(DownloadUpdate{DownloadID: d.ID, Type: "progress", Data: progress})
+			}
+			m.progressMu.Unlock()
+		}
+	}
+}
+
+// progressUpdate refreshes the download's counters and returns them, or
+// false if it has stopped moving.
+func (d *Download) progressUpdate() (*ProgressUpdate, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !moving[d.Status] {
+		return nil, false
+	}
+	d.refreshProgress()
+	return &ProgressUpdate{
+		ID:            d.ID,
+		Downloaded:    d.Downloaded,
+		Progress:      d.Progress,
+		Speed:         d.Speed,
+		TimeRemaining: d.TimeRemaining,
+		ChunkProgress: slices.Clone(d.ChunkProgress),
+		StageProgress: d.StageProgress,
+		Extracting:    d.Extracting,
+		MirrorStats:   slices.Clone(d.MirrorStats),
+	}, true
+}
@@ -0,0 +1,69 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultQuarantineDir is where infected downloads are moved, relative to
+// the server's working directory like the downloads directory.
+const DefaultQuarantineDir = "quarantine"
+
+// scan runs the manager's scanner over the finished file. It reports false
+// when the file was infected, in which case it has been quarantined and the
+// download marked accordingly.
+func (m *Manager) scan(d *Download) (bool, error) {
+	m.startStage(d, StatusScanning)
+
+	info, err := os.Stat(d.OutputPath)
+	if err != nil {
+		return false, err
+	}
+	progress := &stageProgress{m: m, d: d, total: info.Size()}
+	result, err := m.Scanner.Scan(d.ctx, d.OutputPath, progress.add)
+	if err != nil {
+		return false, err
+	}
+	if result.Clean {
+		return true, nil
+	}
+
+	d.logf("Scan of %s found %s, quarantining it", d.Filename, result.Threat)
+	quarantined, err := m.quarantine(d)
+
+	d.mu.Lock()
+	d.Status = StatusQuarantined
+	d.Threat = result.Threat
+	d.QuarantinedTo = quarantined
+	if err != nil {
+		d.Error = fmt.Sprintf("%s found; the file was deleted because it could not be quarantined: %v", result.Threat, err)
+	} else {
+		d.Error = fmt.Sprintf("%s found", result.Threat)
+	}
+	d.mu.Unlock()
+
+	m.broadcastUpdate(DownloadUpdate{
+		DownloadID: d.ID,
+		Type:       "quarantined",
+		Data:       d,
+	})
+	return false, nil
+}
+
+// quarantine moves the infected file into the quarantine directory under
+// the download's ID, readable only by its owner. If it can't be moved it is
+// deleted instead, so it is never left where it was downloaded.
+func (m *Manager) quarantine(d *Download) (string, error) {
+	dest := filepath.Join(m.QuarantineDir, d.ID+"-"+filepath.Base(d.OutputPath))
+	err := os.MkdirAll(m.QuarantineDir, 0700)
+	if err == nil {
+		err = os.Rename(d.OutputPath, dest)
+	}
+	if err != nil {
+		os.Remove(d.OutputPath)
+		return "", err
+	}
+	os.Chmod(dest, 0400)
+	return dest, nil
+}
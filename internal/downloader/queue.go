@@ -0,0 +1,215 @@
+package downloader
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/reqauth"
+)
+
+// QueueVersion is the version of the export format written by ExportQueue.
+const QueueVersion = 1
+
+// QueueExport is a snapshot of every download, for moving a queue to
+// another instance or keeping a backup of it.
+type QueueExport struct {
+	Version    int          `json:"version"`
+	ExportedAt time.Time    `json:"exportedAt"`
+	Downloads  []QueueEntry `json:"downloads"`
+}
+
+// QueueEntry holds what's needed to add a download again, plus where it
+// stood. The part file is referenced rather than included; an imported
+// download starts over unless it was already completed.
+type QueueEntry struct {
+	ID             string `json:"id"` // As on the exporting instance; DependsOn refers to these
+	URL            string `json:"url"`
+	Filename       string `json:"filename"`
+	Chunks         int    `json:"chunks"`
+	ConnectTimeout string `json:"connectTimeout,omitempty"`
+	ReadTimeout    string `json:"readTimeout,omitempty"`
+	Checksum       string `json:"checksum,omitempty"`
+	RateLimit      int64  `json:"rateLimit,omitempty"`
+	Category       string `json:"category,omitempty"`
+	Dir            string `json:"dir,omitempty"`
+	Retry
+	reqauth.Auth
+	Delivery
+	DependsOn []string `json:"dependsOn,omitempty"`
+	Mirrors   []string `json:"mirrors,omitempty"`
+
+	Status     DownloadStatus `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	OutputPath string         `json:"outputPath"`
+	PartPath   string         `json:"partPath,omitempty"`
+	TotalSize  int64          `json:"totalSize,omitempty"`
+	Downloaded int64          `json:"downloaded,omitempty"`
+}
+
+// QueueImport reports the outcome of ImportQueue.
+type QueueImport struct {
+	Imported []*Download `json:"imported"`
+	Skipped  int         `json:"skipped"` // Already completed or quarantined
+	Errors   []string    `json:"errors,omitempty"`
+}
+
+// ExportQueue snapshots every download in the order they were added.
+func (m *Manager) ExportQueue() QueueExport {
+	downloads := m.GetAllDownloads()
+	slices.SortFunc(downloads, func(a, b *Download) int {
+		return compareIDs(a.ID, b.ID)
+	})
+
+	export := QueueExport{
+		Version:    QueueVersion,
+		ExportedAt: time.Now(),
+		Downloads:  make([]QueueEntry, 0, len(downloads)),
+	}
+	for _, d := range downloads {
+		d.mu.RLock()
+		entry := QueueEntry{
+			ID:             d.ID,
+			URL:            d.URL,
+			Filename:       d.Filename,
+			Chunks:         d.Chunks,
+			ConnectTimeout: d.ConnectTimeout,
+			ReadTimeout:    d.ReadTimeout,
+			Checksum:       d.Checksum,
+			RateLimit:      d.RateLimit,
+			Category:       d.Category,
+			Dir:            d.Dir,
+			Retry:          d.Retry,
+			Auth:           d.Auth,
+			Delivery:       d.Delivery,
+			DependsOn:      d.DependsOn,
+			Mirrors:        d.Mirrors,
+			Status:         d.Status,
+			Error:          d.Error,
+			OutputPath:     d.OutputPath,
+			TotalSize:      d.TotalSize,
+			Downloaded:     d.bytesReceived(),
+		}
+		if d.Status != StatusCompleted {
+			entry.PartPath = d.PartPath
+		}
+		d.mu.RUnlock()
+		export.Downloads = append(export.Downloads, entry)
+	}
+	return export
+}
+
+// ImportQueue adds the unfinished downloads of an export. Dependencies are
+// mapped to the new downloads; ones on downloads that had already completed
+// are dropped, as they are satisfied. An entry that can't be added is
+// reported and the rest are still imported.
+func (m *Manager) ImportQueue(export QueueExport) (*QueueImport, error) {
+	if export.Version != QueueVersion {
+		return nil, fmt.Errorf("unsupported queue export version %d", export.Version)
+	}
+
+	result := &QueueImport{Imported: []*Download{}}
+	completed := make(map[string]bool)
+	imported := make(map[string]string) // Exported ID to new ID
+	for _, entry := range export.Downloads {
+		if entry.Status == StatusCompleted || entry.Status == StatusQuarantined {
+			completed[entry.ID] = entry.Status == StatusCompleted
+			result.Skipped++
+			continue
+		}
+
+		var dependsOn []string
+		var err error
+		for _, id := range entry.DependsOn {
+			switch {
+			case imported[id] != "":
+				dependsOn = append(dependsOn, imported[id])
+			case completed[id]:
+			default:
+				err = fmt.Errorf("its dependency %s was not imported", id)
+			}
+		}
+
+		var d *Download
+		if err == nil {
+			d, err = m.AddDownload(entry.URL, AddOptions{
+				Mirrors:        entry.Mirrors,
+				Filename:       entry.Filename,
+				Chunks:         entry.Chunks,
+				ConnectTimeout: entry.ConnectTimeout,
+				ReadTimeout:    entry.ReadTimeout,
+				Checksum:       entry.Checksum,
+				RateLimit:      entry.RateLimit,
+				Retry:          entry.Retry,
+				Auth:           entry.Auth,
+				Delivery:       entry.Delivery,
+				DependsOn:      dependsOn,
+				Category:       entry.Category,
+				Dir:            entry.Dir,
+			})
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s (%s): %v", entry.ID, entry.URL, err))
+			continue
+		}
+		imported[entry.ID] = d.ID
+		result.Imported = append(result.Imported, d)
+	}
+	return result, nil
+}
+
+// DefaultQueueFile is where the queue is saved on shutdown, relative to the
+// server's working directory like the downloads directory.
+const DefaultQueueFile = "queue.json"
+
+// SaveQueue writes an export of the queue to path, for LoadQueue to pick up
+// when the server starts again.
+func (m *Manager) SaveQueue(path string) error {
+	data, err := json.MarshalIndent(m.ExportQueue(), "", "  ")
+	if err != nil {
+		return err
+	}
+	// Only the server's user may read the credentials in it
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save queue to %s: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save queue to %s: %v", path, err)
+	}
+	return nil
+}
+
+// LoadQueue imports the queue saved in path and removes the file, so a
+// crash before the next save doesn't import it twice. A missing file is not
+// an error and imports nothing.
+func (m *Manager) LoadQueue(path string) (*QueueImport, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &QueueImport{Imported: []*Download{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var export QueueExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid queue file %s: %v", path, err)
+	}
+	result, err := m.ImportQueue(export)
+	if err != nil {
+		return nil, fmt.Errorf("invalid queue file %s: %v", path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// compareIDs orders download IDs, which are decimal creation timestamps,
+// by age.
+func compareIDs(a, b string) int {
+	return cmp.Or(cmp.Compare(len(a), len(b)), cmp.Compare(a, b))
+}
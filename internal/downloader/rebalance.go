@@ -0,0 +1,183 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/endgame"
+	"github.com/govind1331/Datablip/internal/pause"
+	"github.com/govind1331/Datablip/internal/speed"
+	"github.com/govind1331/Datablip/internal/split"
+)
+
+// tail is the far end of a chunk's range, handed to a connection of its
+// own while the chunk's connection carries on up to where it starts.
+type tail struct {
+	start, end int64 // Absolute; end is inclusive
+	cancel     context.CancelFunc
+	done       chan struct{}
+	err        error // Set before done is closed
+}
+
+// runRebalancer watches a chunked download until stop is closed. When a
+// connection is free and a chunk moves at a fraction of the download's
+// typical per-connection speed, the second half of the chunk's remaining
+// range goes to the free connection, so one bad path doesn't hold up the
+// rest. Near the end endgame mode takes over instead, when enabled.
+func (m *Manager) runRebalancer(d *Download, sink outputSink, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	started := time.Now()
+	meters := make(map[int]*speed.Meter)
+	since := make(map[int]time.Time)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if d.pause.Paused() {
+			continue
+		}
+		received := d.bytesReceived()
+		if d.TotalSize <= 0 || (m.Endgame && float64(received) >= endgame.Threshold*float64(d.TotalSize)) {
+			continue
+		}
+		typical := float64(received) / time.Since(started).Seconds() / float64(d.Chunks)
+
+		// Rates are only known for chunks that have been fetching for a
+		// whole window without reconnecting
+		var candidates []split.Chunk
+		d.mu.RLock()
+		for i, abort := range d.aborts {
+			if abort == nil {
+				delete(meters, i)
+				continue
+			}
+			pos := atomic.LoadInt64(&d.chunkBytes[i])
+			if meters[i] == nil {
+				meters[i], since[i] = speed.New(speed.DefaultWindow), time.Now()
+			}
+			meters[i].Set(pos)
+			if d.tails[i] != nil || (d.races != nil && d.races[i] != nil && d.races[i].Helping()) ||
+				time.Since(since[i]) < speed.DefaultWindow {
+				continue
+			}
+			if rate := meters[i].Rate(); split.Lagging(rate, typical) {
+				start := d.chunkStart(i)
+				candidates = append(candidates, split.Chunk{
+					ID:   i,
+					Pos:  start + pos,
+					End:  start + atomic.LoadInt64(&d.chunkEnds[i]),
+					Rate: rate,
+				})
+			}
+		}
+		d.mu.RUnlock()
+
+		id, at, ok := split.Pick(candidates)
+		if !ok || !m.pool.TryAcquire() {
+			continue
+		}
+		if !m.handOffTail(d, id, at, sink) {
+			m.pool.Release()
+		}
+	}
+}
+
+// handOffTail has chunk i's connection stop at byte at and starts a
+// connection, holding a worker slot, for the rest of the chunk. It reports
+// false if the chunk got past at or to endgame mode meanwhile.
+func (m *Manager) handOffTail(d *Download, i int, at int64, sink outputSink) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	start := d.chunkStart(i)
+	if d.tails[i] != nil || d.aborts[i] == nil || atomic.LoadInt64(&d.chunkBytes[i]) >= at-start ||
+		(d.races != nil && d.races[i] != nil && d.races[i].Helping()) {
+		return false
+	}
+	ctx, cancel := context.WithCancel(d.ctx)
+	t := &tail{start: at, end: start + d.chunkSizes[i] - 1, cancel: cancel, done: make(chan struct{})}
+	d.tails[i] = t
+	atomic.StoreInt64(&d.chunkEnds[i], at-start)
+
+	d.logf("Chunk %d is far slower than the rest, handing bytes %d-%d to another connection", i, t.start, t.end)
+	go func() {
+		defer m.pool.Release()
+		t.err = m.fetchTail(ctx, d, i, t, sink)
+		close(t.done)
+	}()
+	return true
+}
+
+// fetchTail fetches t, the far end of chunk i, carrying on after a pause.
+func (m *Manager) fetchTail(ctx context.Context, d *Download, i int, t *tail, sink outputSink) error {
+	from := t.start
+	for from <= t.end {
+		attemptCtx, release := d.pause.Track(ctx)
+		url := d.mirrors.Pick()
+		n, err := m.fetchRange(attemptCtx, d, url, i, d.chunkStart(i), from, t.end, sink, t)
+		release()
+		d.mirrors.Done(url, err != nil && attemptCtx.Err() == nil)
+		from += n
+		if errors.Is(err, pause.ErrPaused) {
+			if err := d.pause.Wait(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("tail of chunk %d ended early at byte %d", i, from)
+		}
+	}
+	return nil
+}
+
+// awaitTail waits for the tail of chunk i, once the chunk's own connection
+// has reached it. It reports whether the tail completed the chunk; if not,
+// the rest of the chunk is the chunk's connection's to fetch again.
+func (d *Download) awaitTail(ctx context.Context, i int) bool {
+	d.mu.RLock()
+	t := d.tails[i]
+	d.mu.RUnlock()
+	if t == nil {
+		return false
+	}
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		t.cancel()
+		<-t.done
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tails[i] = nil
+	atomic.StoreInt64(&d.tailBytes[i], 0)
+	atomic.StoreInt64(&d.chunkEnds[i], d.chunkSizes[i])
+	if t.err != nil {
+		d.logf("Connection for the tail of chunk %d failed, the chunk carries on itself: %v", i, t.err)
+		return false
+	}
+	d.advanceChunk(i, d.chunkSizes[i])
+	return true
+}
+
+// dropTail stops the tail of chunk i, if any, when the chunk gives up.
+func (d *Download) dropTail(i int) {
+	d.mu.RLock()
+	t := d.tails[i]
+	d.mu.RUnlock()
+	if t != nil {
+		t.cancel()
+		<-t.done
+	}
+}
@@ -0,0 +1,52 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/retry"
+)
+
+// Retry is how a download requests a failed chunk again, from the bytes it
+// already has, before giving up on the whole download.
+type Retry struct {
+	MaxRetries   *int   `json:"maxRetries,omitempty"`   // Retries in a row per chunk; unset picks retry.DefaultMax, 0 disables
+	RetryBackoff string `json:"retryBackoff,omitempty"` // Pause before the first retry, doubled for each one after, such as "2s"
+}
+
+// Validate checks the retry settings of a new download.
+func (r Retry) Validate() error {
+	if r.MaxRetries != nil && *r.MaxRetries < 0 {
+		return fmt.Errorf("maxRetries must be at least 0")
+	}
+	if r.RetryBackoff != "" {
+		if backoff, err := time.ParseDuration(r.RetryBackoff); err != nil || backoff <= 0 {
+			return fmt.Errorf("retryBackoff must be a duration such as \"2s\"")
+		}
+	}
+	return nil
+}
+
+func (r Retry) maxRetries() int {
+	if r.MaxRetries == nil {
+		return retry.DefaultMax
+	}
+	return *r.MaxRetries
+}
+
+func (r Retry) retryBackoff() time.Duration {
+	return parseTimeout(r.RetryBackoff, retry.DefaultBackoff)
+}
+
+// awaitRetry waits before retrying chunk i of d for the attempt'th time in
+// a row, after it failed with err at byte pos. It returns false if the
+// chunk has used up its retries or ctx was cancelled meanwhile.
+func (m *Manager) awaitRetry(ctx context.Context, d *Download, i, attempt int, pos int64, err error) bool {
+	if attempt > d.maxRetries() || ctx.Err() != nil {
+		return false
+	}
+	backoff := d.retryBackoff()
+	d.logf("Chunk %d failed at byte %d, retry %d of %d in %v: %v", i, pos, attempt, d.maxRetries(), retry.Delay(backoff, attempt), err)
+	return retry.Wait(ctx, backoff, attempt) == nil
+}
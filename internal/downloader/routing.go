@@ -0,0 +1,48 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/govind1331/Datablip/internal/route"
+)
+
+// route records what the finished file really is and, when the manager has
+// routing rules, moves it into the folder they pick under the downloads
+// directory. A later move to d.MoveTo keeps the same folder under it.
+func (m *Manager) route(d *Download) {
+	contentType, err := route.Sniff(d.OutputPath)
+	if err != nil {
+		d.logf("Could not identify %s: %v", d.Filename, err)
+		return
+	}
+	d.mu.Lock()
+	d.ContentType = contentType
+	d.mu.Unlock()
+
+	folder, ok := route.Match(m.Routes, contentType, d.OutputPath)
+	if !ok {
+		return
+	}
+	dir := filepath.Join(filepath.Dir(d.OutputPath), folder)
+	dest := filepath.Join(dir, filepath.Base(d.OutputPath))
+	// A monitored download's earlier copy may be replaced, nothing else
+	if _, err := os.Stat(dest); err == nil && d.RoutedTo != folder {
+		d.logf("Leaving %s in place: %s already exists", d.Filename, dest)
+		return
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = os.Rename(d.OutputPath, dest)
+	}
+	if err != nil {
+		d.logf("Could not route %s to %s: %v", d.Filename, dir, err)
+		return
+	}
+
+	d.mu.Lock()
+	d.OutputPath = dest
+	d.RoutedTo = folder
+	d.mu.Unlock()
+	d.logf("Routed %s (%s) to %s", d.Filename, contentType, dir)
+}
@@ -0,0 +1,322 @@
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/nametemplate"
+)
+
+// DefaultSettingsFile is where settings changed through the API are saved,
+// relative to the server's working directory.
+const DefaultSettingsFile = "settings.json"
+
+// maxConnectTimeout bounds the shared transport's own timeouts, so that any
+// connect timeout up to it can be set per download.
+const maxConnectTimeout = 5 * time.Minute
+
+// downloadsDirMu guards DownloadsDir once the server runs, since
+// SetDownloadsDir may change it while files are being named and listed.
+var downloadsDirMu sync.RWMutex
+
+// downloadsDir returns DownloadsDir.
+func downloadsDir() string {
+	downloadsDirMu.RLock()
+	defer downloadsDirMu.RUnlock()
+	return DownloadsDir
+}
+
+// Settings are the server-wide settings that can be changed while it runs.
+// The defaults apply to downloads added afterwards that don't set their own.
+type Settings struct {
+	DefaultChunks          int    `json:"defaultChunks"` // 0 picks a count from the file size and latency
+	ConnectTimeout         string `json:"connectTimeout"`
+	ReadTimeout            string `json:"readTimeout"`
+	DownloadsDir           string `json:"downloadsDir"`
+	MaxConcurrentDownloads int    `json:"maxConcurrentDownloads"`
+	MaxWorkers             int    `json:"maxWorkers"`
+	MonthlyCap             int64  `json:"monthlyCap"` // Bytes, 0 for none
+	HostDelay              string `json:"hostDelay"`
+	RateLimit              int64  `json:"rateLimit"`        // Bytes/s, 0 for none
+	FilenameTemplate       string `json:"filenameTemplate"` // Names downloads added without a filename; empty for the server's suggestion
+}
+
+// SettingsUpdate changes the settings that are set in it and leaves the
+// rest alone.
+type SettingsUpdate struct {
+	DefaultChunks          *int    `json:"defaultChunks,omitempty"`
+	ConnectTimeout         *string `json:"connectTimeout,omitempty"`
+	ReadTimeout            *string `json:"readTimeout,omitempty"`
+	DownloadsDir           *string `json:"downloadsDir,omitempty"`
+	MaxConcurrentDownloads *int    `json:"maxConcurrentDownloads,omitempty"`
+	MaxWorkers             *int    `json:"maxWorkers,omitempty"`
+	MonthlyCap             *int64  `json:"monthlyCap,omitempty"`
+	HostDelay              *string `json:"hostDelay,omitempty"`
+	RateLimit              *int64  `json:"rateLimit,omitempty"`
+	FilenameTemplate       *string `json:"filenameTemplate,omitempty"`
+}
+
+// Validate reports the first setting in u that can't be applied.
+func (u *SettingsUpdate) Validate() error {
+	if u.DefaultChunks != nil && *u.DefaultChunks < 0 {
+		return errors.New("defaultChunks must be at least 0, 0 to pick a count per download")
+	}
+	if u.ConnectTimeout != nil {
+		if timeout, err := time.ParseDuration(*u.ConnectTimeout); err != nil || timeout <= 0 || timeout > maxConnectTimeout {
+			return errors.New("connectTimeout must be a duration such as \"30s\", up to 5m")
+		}
+	}
+	if u.ReadTimeout != nil {
+		if timeout, err := time.ParseDuration(*u.ReadTimeout); err != nil || timeout <= 0 {
+			return errors.New("readTimeout must be a duration such as \"10m\"")
+		}
+	}
+	if u.DownloadsDir != nil && *u.DownloadsDir == "" {
+		return errors.New("downloadsDir must not be empty")
+	}
+	if u.MaxWorkers != nil && *u.MaxWorkers < 1 {
+		return errors.New("maxWorkers must be a positive integer")
+	}
+	if u.MaxConcurrentDownloads != nil && *u.MaxConcurrentDownloads < 1 {
+		return errors.New("maxConcurrentDownloads must be a positive integer")
+	}
+	if u.MonthlyCap != nil && *u.MonthlyCap < 0 {
+		return errors.New("monthlyCap must be a whole number of bytes, 0 for none")
+	}
+	if u.HostDelay != nil {
+		if delay, err := time.ParseDuration(*u.HostDelay); err != nil || delay < 0 {
+			return errors.New("hostDelay must be a duration such as \"500ms\", 0 for none")
+		}
+	}
+	if u.RateLimit != nil && *u.RateLimit < 0 {
+		return errors.New("rateLimit must be a whole number of bytes/s, 0 for none")
+	}
+	if u.FilenameTemplate != nil {
+		if strings.HasPrefix(*u.FilenameTemplate, "/") || nametemplate.Validate(*u.FilenameTemplate) != nil {
+			return errors.New("filenameTemplate must be a path inside the downloads directory using {host}, {basename}, {date}, {time}, {datetime}, {unix}, {id}, {run}, {type} and {subtype}")
+		}
+	}
+	return nil
+}
+
+// merge sets in u what is set in other.
+func (u *SettingsUpdate) merge(other SettingsUpdate) {
+	u.DefaultChunks = firstSet(other.DefaultChunks, u.DefaultChunks)
+	u.ConnectTimeout = firstSet(other.ConnectTimeout, u.ConnectTimeout)
+	u.ReadTimeout = firstSet(other.ReadTimeout, u.ReadTimeout)
+	u.DownloadsDir = firstSet(other.DownloadsDir, u.DownloadsDir)
+	u.MaxConcurrentDownloads = firstSet(other.MaxConcurrentDownloads, u.MaxConcurrentDownloads)
+	u.MaxWorkers = firstSet(other.MaxWorkers, u.MaxWorkers)
+	u.MonthlyCap = firstSet(other.MonthlyCap, u.MonthlyCap)
+	u.HostDelay = firstSet(other.HostDelay, u.HostDelay)
+	u.RateLimit = firstSet(other.RateLimit, u.RateLimit)
+	u.FilenameTemplate = firstSet(other.FilenameTemplate, u.FilenameTemplate)
+}
+
+// firstSet returns the first of values that isn't nil.
+func firstSet[T any](values ...*T) *T {
+	for _, v := range values {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// Settings returns the current settings.
+func (m *Manager) Settings() Settings {
+	chunks, connect, read := m.defaults()
+	return Settings{
+		DefaultChunks:          chunks,
+		ConnectTimeout:         connect.String(),
+		ReadTimeout:            read.String(),
+		DownloadsDir:           downloadsDir(),
+		MaxConcurrentDownloads: m.MaxConcurrentDownloads(),
+		MaxWorkers:             m.Workers(),
+		MonthlyCap:             m.MonthlyCap(),
+		HostDelay:              m.HostDelay().String(),
+		RateLimit:              m.RateLimit(),
+		FilenameTemplate:       m.FilenameTemplate(),
+	}
+}
+
+// UpdateSettings validates u, applies it and saves what was changed to
+// SettingsFile, so it is applied again by LoadSettings on the next start.
+// Nothing is changed if any setting is invalid.
+func (m *Manager) UpdateSettings(u SettingsUpdate) error {
+	if err := u.Validate(); err != nil {
+		return err
+	}
+	if err := m.applySettings(u); err != nil {
+		return err
+	}
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	m.changed.merge(u)
+	return m.saveSettings()
+}
+
+// LoadSettings applies the settings saved in SettingsFile by earlier runs.
+// They win over those the server was started with.
+func (m *Manager) LoadSettings() error {
+	if m.SettingsFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.SettingsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved SettingsUpdate
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("invalid settings file %s: %v", m.SettingsFile, err)
+	}
+	if err := saved.Validate(); err != nil {
+		return fmt.Errorf("invalid settings file %s: %v", m.SettingsFile, err)
+	}
+	if err := m.applySettings(saved); err != nil {
+		return err
+	}
+	m.settingsMu.Lock()
+	m.changed = saved
+	m.settingsMu.Unlock()
+	return nil
+}
+
+// applySettings applies u, which is valid.
+func (m *Manager) applySettings(u SettingsUpdate) error {
+	if u.DownloadsDir != nil {
+		if err := m.SetDownloadsDir(*u.DownloadsDir); err != nil {
+			return err
+		}
+	}
+	if u.DefaultChunks != nil {
+		m.SetDefaultChunks(*u.DefaultChunks)
+	}
+	if u.ConnectTimeout != nil {
+		timeout, _ := time.ParseDuration(*u.ConnectTimeout)
+		m.SetConnectTimeout(timeout)
+	}
+	if u.ReadTimeout != nil {
+		timeout, _ := time.ParseDuration(*u.ReadTimeout)
+		m.SetReadTimeout(timeout)
+	}
+	if u.MaxWorkers != nil {
+		m.SetWorkers(*u.MaxWorkers)
+	}
+	if u.MaxConcurrentDownloads != nil {
+		m.SetMaxConcurrentDownloads(*u.MaxConcurrentDownloads)
+	}
+	if u.MonthlyCap != nil {
+		m.SetMonthlyCap(*u.MonthlyCap)
+	}
+	if u.HostDelay != nil {
+		delay, _ := time.ParseDuration(*u.HostDelay)
+		m.SetHostDelay(delay)
+	}
+	if u.RateLimit != nil {
+		m.SetRateLimit(*u.RateLimit)
+	}
+	if u.FilenameTemplate != nil {
+		m.SetFilenameTemplate(*u.FilenameTemplate)
+	}
+	return nil
+}
+
+// saveSettings writes the settings changed through the API to
+// SettingsFile. The caller holds m.settingsMu.
+func (m *Manager) saveSettings() error {
+	if m.SettingsFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(m.changed, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.SettingsFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.SettingsFile)
+}
+
+// SetDownloadsDir changes where new downloads are saved and what the files
+// API lists, creating the directory if needed. Files already downloaded
+// stay where they are.
+func (m *Manager) SetDownloadsDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	downloadsDirMu.Lock()
+	defer downloadsDirMu.Unlock()
+	DownloadsDir = dir
+	return nil
+}
+
+// DownloadsDir returns where new downloads are saved.
+func (m *Manager) DownloadsDir() string {
+	return downloadsDir()
+}
+
+// SetDefaultChunks sets how many chunks downloads added without a count
+// are split into; 0 picks a count for each from its size and latency.
+func (m *Manager) SetDefaultChunks(n int) {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	m.defaultChunks = max(n, 0)
+}
+
+// SetConnectTimeout sets how long requests may take to get a response,
+// dialing included: those of downloads added without their own timeout,
+// and the server's own, such as feed checks.
+func (m *Manager) SetConnectTimeout(timeout time.Duration) {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	m.connectTimeout = min(timeout, maxConnectTimeout)
+}
+
+// ConnectTimeout returns how long requests may take to get a response.
+func (m *Manager) ConnectTimeout() time.Duration {
+	_, connect, _ := m.defaults()
+	return connect
+}
+
+// SetReadTimeout sets how long a transfer of a download added without its
+// own read timeout may go without receiving data.
+func (m *Manager) SetReadTimeout(timeout time.Duration) {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	m.readTimeout = timeout
+}
+
+// SetFilenameTemplate sets the template that names downloads added without
+// a filename once they are probed, such as "{date}/{host}/{basename}";
+// empty saves them under the name the server suggests.
+func (m *Manager) SetFilenameTemplate(template string) {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	m.filenameTemplate = template
+}
+
+// FilenameTemplate returns the template that names downloads added without
+// a filename.
+func (m *Manager) FilenameTemplate() string {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	return m.filenameTemplate
+}
+
+// defaults returns what downloads added without their own get: the chunk
+// count and the connect and read timeouts.
+func (m *Manager) defaults() (int, time.Duration, time.Duration) {
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	return m.defaultChunks, m.connectTimeout, m.readTimeout
+}
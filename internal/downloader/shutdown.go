@@ -0,0 +1,42 @@
+package downloader
+
+import "errors"
+
+// ErrShuttingDown is returned for downloads added or resumed once Shutdown
+// was called.
+var ErrShuttingDown = errors.New("the server is shutting down")
+
+// Shutdown stops taking new downloads and pauses every running one, which
+// drops its connections, and records how far each of its chunks got. Their
+// status is left as it was, so once saved they are restored queued and
+// carry on in their part files, while downloads paused by hand stay paused.
+// It returns how many downloads were paused.
+func (m *Manager) Shutdown() int {
+	m.mu.Lock()
+	m.closing = true
+	m.mu.Unlock()
+
+	paused := 0
+	for _, d := range m.GetAllDownloads() {
+		if d.status() != StatusDownloading || !d.pause.Pause() {
+			continue
+		}
+		paused++
+		d.mu.RLock()
+		record := d.record
+		d.mu.RUnlock()
+		if record != nil {
+			if err := record(); err != nil {
+				d.logf("Failed to record progress: %v", err)
+			}
+		}
+	}
+	return paused
+}
+
+// shuttingDown reports whether Shutdown was called.
+func (m *Manager) shuttingDown() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.closing
+}
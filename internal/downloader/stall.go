@@ -0,0 +1,46 @@
+package downloader
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/stall"
+)
+
+// watchStalls restarts the connection of any chunk that has crawled below
+// the manager's StallSpeed for StallTime while other chunks keep up, until
+// stop is closed. The chunk carries on from its current offset.
+func (m *Manager) watchStalls(d *Download, stop <-chan struct{}) {
+	detector := stall.NewDetector(m.StallSpeed, m.StallTime)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		positions := make(map[int]int64)
+		d.mu.RLock()
+		for i, abort := range d.aborts {
+			if abort != nil {
+				positions[i] = atomic.LoadInt64(&d.chunkBytes[i])
+			}
+		}
+		d.mu.RUnlock()
+
+		for _, i := range detector.Check(positions) {
+			d.mu.RLock()
+			abort := d.aborts[i]
+			d.mu.RUnlock()
+			if abort == nil {
+				continue
+			}
+			d.logf("Chunk %d stayed below %.0f bytes/s for %v, restarting its connection", i, m.StallSpeed, m.StallTime)
+			abort(stall.ErrStalled)
+			detector.Reset(i)
+		}
+	}
+}
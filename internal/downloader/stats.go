@@ -0,0 +1,295 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultStatsFile is where the transfer history is saved, relative to the
+// server's working directory like the usage file.
+const DefaultStatsFile = "stats.json"
+
+const (
+	// DefaultStatsDays is how many days Stats reports when asked for none.
+	DefaultStatsDays = 30
+
+	// statsKeepDays is how long bytes per day are kept.
+	statsKeepDays = 366
+
+	// speedStep is how long each speed sample covers, and speedSamples how
+	// many are kept, an hour's worth.
+	speedStep    = 10 * time.Second
+	speedSamples = 360
+)
+
+// Stats is the server's transfer history, for the dashboard's charts.
+type Stats struct {
+	Totals     StatsTotals      `json:"totals"`
+	Averages   StatsAverages    `json:"averages"`
+	Days       []DayBytes       `json:"days"`       // Oldest first, days without any included
+	Hosts      map[string]int64 `json:"hosts"`      // Bytes from each host
+	Categories map[string]int64 `json:"categories"` // Bytes of each category's downloads
+	Speed      []SpeedSample    `json:"speed"`      // Combined speed over the last hour, oldest first
+}
+
+// StatsTotals are counts since stats were first kept.
+type StatsTotals struct {
+	Bytes     int64 `json:"bytes"` // Received from servers, retries included
+	Today     int64 `json:"today"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+}
+
+// StatsAverages are worked out from the totals.
+type StatsAverages struct {
+	Speed float64 `json:"speed"` // Bytes/s of completed downloads, from start to finish
+	Size  int64   `json:"size"`  // Of completed downloads
+	Daily int64   `json:"daily"` // Bytes on the days any were downloaded
+}
+
+// DayBytes is what was downloaded on a day.
+type DayBytes struct {
+	Date  string `json:"date"` // Such as "2026-10-16", in the server's time zone
+	Bytes int64  `json:"bytes"`
+}
+
+// SpeedSample is the combined speed of every download over speedStep.
+type SpeedSample struct {
+	Time  time.Time `json:"time"`  // Start of the sample
+	Speed float64   `json:"speed"` // Bytes/s
+}
+
+// stats counts what is downloaded, by day, host and category, and what
+// finished.
+type stats struct {
+	mu    sync.Mutex
+	saved statsRecord
+	hosts map[string]string // Host of each source URL seen
+	speed [speedSamples]int64
+	step  int64 // Number of the speedStep the last sample is for
+	save  time.Time
+}
+
+// statsRecord is what is kept in StatsFile.
+type statsRecord struct {
+	Bytes          int64            `json:"bytes"`
+	Days           map[string]int64 `json:"days"`
+	Hosts          map[string]int64 `json:"hosts"`
+	Categories     map[string]int64 `json:"categories"`
+	Completed      int64            `json:"completed"`
+	Failed         int64            `json:"failed"`
+	CompletedBytes int64            `json:"completedBytes"`
+	CompletedTime  time.Duration    `json:"completedTime"`
+}
+
+func day(t time.Time) string {
+	return t.Format(time.DateOnly)
+}
+
+// init makes the record's maps. The caller holds s.mu.
+func (s *stats) init() {
+	if s.saved.Days == nil {
+		s.saved.Days = make(map[string]int64)
+		s.saved.Hosts = make(map[string]int64)
+		s.saved.Categories = make(map[string]int64)
+		s.hosts = make(map[string]string)
+	}
+}
+
+// advance moves the speed samples on to now's, zeroing those skipped. The
+// caller holds s.mu.
+func (s *stats) advance(now time.Time) {
+	step := now.UnixNano() / int64(speedStep)
+	for i := max(s.step+1, step-speedSamples+1); i <= step; i++ {
+		s.speed[i%speedSamples] = 0
+	}
+	s.step = max(s.step, step)
+}
+
+// countStats adds n bytes of d received from source to the stats, saving
+// them now and then.
+func (m *Manager) countStats(d *Download, source string, n int, now time.Time) {
+	s := &m.stats
+	s.mu.Lock()
+	s.init()
+	host, ok := s.hosts[source]
+	if !ok {
+		if len(s.hosts) >= 1024 {
+			clear(s.hosts)
+		}
+		if u, err := url.Parse(source); err == nil {
+			host = u.Hostname()
+		}
+		s.hosts[source] = host
+	}
+	s.saved.Bytes += int64(n)
+	s.saved.Days[day(now)] += int64(n)
+	s.saved.Hosts[host] += int64(n)
+	if d.Category != "" {
+		s.saved.Categories[d.Category] += int64(n)
+	}
+	s.advance(now)
+	s.speed[s.step%speedSamples] += int64(n)
+	due := now.Sub(s.save) >= usageSaveInterval
+	if due {
+		s.save = now
+	}
+	s.mu.Unlock()
+
+	if due {
+		if err := m.SaveStats(); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// countFinished records a download that completed or failed.
+func (m *Manager) countFinished(d *Download, completed bool) {
+	s := &m.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !completed {
+		s.saved.Failed++
+		return
+	}
+	s.saved.Completed++
+	d.mu.RLock()
+	s.saved.CompletedBytes += d.TotalSize
+	if d.FinishedAt != nil {
+		s.saved.CompletedTime += d.FinishedAt.Sub(d.StartTime)
+	}
+	d.mu.RUnlock()
+}
+
+// Stats reports the transfer history, with bytes per day for the last days
+// days.
+func (m *Manager) Stats(days int) Stats {
+	s := &m.stats
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+
+	r := s.saved
+	report := Stats{
+		Totals: StatsTotals{
+			Bytes:     r.Bytes,
+			Today:     r.Days[day(now)],
+			Completed: r.Completed,
+			Failed:    r.Failed,
+		},
+		Days:       make([]DayBytes, 0, days),
+		Hosts:      make(map[string]int64, len(r.Hosts)),
+		Categories: make(map[string]int64, len(r.Categories)),
+		Speed:      make([]SpeedSample, 0, speedSamples),
+	}
+	if r.Completed > 0 {
+		report.Averages.Size = r.CompletedBytes / r.Completed
+	}
+	if r.CompletedTime > 0 {
+		report.Averages.Speed = float64(r.CompletedBytes) / r.CompletedTime.Seconds()
+	}
+	var active, total int64
+	for _, bytes := range r.Days {
+		if bytes > 0 {
+			active++
+			total += bytes
+		}
+	}
+	if active > 0 {
+		report.Averages.Daily = total / active
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for i := days - 1; i >= 0; i-- {
+		date := day(today.AddDate(0, 0, -i))
+		report.Days = append(report.Days, DayBytes{Date: date, Bytes: r.Days[date]})
+	}
+	for host, bytes := range r.Hosts {
+		report.Hosts[host] = bytes
+	}
+	for category, bytes := range r.Categories {
+		report.Categories[category] = bytes
+	}
+
+	s.advance(now)
+	for step := s.step - speedSamples + 1; step <= s.step; step++ {
+		report.Speed = append(report.Speed, SpeedSample{
+			Time:  time.Unix(0, step*int64(speedStep)),
+			Speed: float64(s.speed[step%speedSamples]) / speedStep.Seconds(),
+		})
+	}
+	return report
+}
+
+// LoadStats reads the history saved in m.StatsFile. A missing file is not
+// an error.
+func (m *Manager) LoadStats() error {
+	if m.StatsFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.StatsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved statsRecord
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("invalid stats file %s: %v", m.StatsFile, err)
+	}
+
+	s := &m.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+	s.saved.Bytes += saved.Bytes
+	s.saved.Completed += saved.Completed
+	s.saved.Failed += saved.Failed
+	s.saved.CompletedBytes += saved.CompletedBytes
+	s.saved.CompletedTime += saved.CompletedTime
+	for date, bytes := range saved.Days {
+		s.saved.Days[date] += bytes
+	}
+	for host, bytes := range saved.Hosts {
+		s.saved.Hosts[host] += bytes
+	}
+	for category, bytes := range saved.Categories {
+		s.saved.Categories[category] += bytes
+	}
+	return nil
+}
+
+// SaveStats writes the history to m.StatsFile, dropping days older than
+// statsKeepDays.
+func (m *Manager) SaveStats() error {
+	if m.StatsFile == "" {
+		return nil
+	}
+	s := &m.stats
+	s.mu.Lock()
+	s.init()
+	oldest := day(time.Now().AddDate(0, 0, -statsKeepDays))
+	for date := range s.saved.Days {
+		if date < oldest {
+			delete(s.saved.Days, date)
+		}
+	}
+	data, err := json.MarshalIndent(s.saved, "", "  ")
+	s.mu.Unlock()
+	if err == nil {
+		tmp := m.StatsFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, m.StatsFile)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save stats to %s: %v", m.StatsFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// streamPoll is how often a stream waiting for data checks for it again.
+const streamPoll = 100 * time.Millisecond
+
+// Stream reads a download's part file while it is still being written,
+// so it can be played or previewed early. Reads of data that hasn't
+// arrived yet block until it does. It implements io.ReadSeeker, which is
+// what http.ServeContent needs to serve ranges of it.
+type Stream struct {
+	d      *Download
+	ctx    context.Context
+	file   *os.File
+	size   int64
+	offset int64
+}
+
+// OpenStream opens the part file of a running or paused download. Reads
+// give up once ctx is done. Downloads written to separate chunk files or
+// with direct I/O can't be streamed, as their data only lands in the part
+// file at the end.
+func (m *Manager) OpenStream(ctx context.Context, id string) (*Stream, error) {
+	d, err := m.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	status, streamable, size, path := d.Status, d.streamable, d.TotalSize, partPath(d)
+	d.mu.RUnlock()
+	switch {
+	case status != StatusDownloading && status != StatusPaused:
+		return nil, fmt.Errorf("download is %s", status)
+	case !streamable:
+		return nil, fmt.Errorf("download can't be streamed until it completes")
+	case size <= 0:
+		return nil, fmt.Errorf("download size is unknown")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{d: d, ctx: ctx, file: file, size: size}, nil
+}
+
+func (s *Stream) Read(p []byte) (int, error) {
+	if s.offset >= s.size {
+		return 0, io.EOF
+	}
+	for {
+		if available := s.d.available(s.offset); available > 0 {
+			n, err := s.file.ReadAt(p[:min(int64(len(p)), available)], s.offset)
+			s.offset += int64(n)
+			if err == io.EOF && n > 0 {
+				err = nil
+			}
+			return n, err
+		}
+
+		select {
+		case <-s.d.ctx.Done():
+			return 0, fmt.Errorf("download was cancelled")
+		case <-s.ctx.Done():
+			return 0, s.ctx.Err()
+		case <-time.After(streamPoll):
+		}
+		s.d.mu.RLock()
+		status, errMsg := s.d.Status, s.d.Error
+		s.d.mu.RUnlock()
+		if status == StatusError || status == StatusChecksumMismatch {
+			return 0, fmt.Errorf("download failed: %s", errMsg)
+		}
+	}
+}
+
+func (s *Stream) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("seek before start of stream")
+	}
+	s.offset = offset
+	return offset, nil
+}
+
+func (s *Stream) Close() error {
+	return s.file.Close()
+}
+
+// available reports how many bytes from offset on have been written to
+// the part file, up to the end of the chunk holding offset.
+func (d *Download) available(offset int64) int64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var start int64
+	for i, size := range d.chunkSizes {
+		if offset < start+size {
+			end := start + atomic.LoadInt64(&d.chunkBytes[i])
+			return max(end-offset, 0)
+		}
+		start += size
+	}
+	return 0
+}
@@ -0,0 +1,212 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultUsageFile is where the bytes downloaded each month are saved,
+// relative to the server's working directory like the downloads directory.
+const DefaultUsageFile = "usage.json"
+
+// usageSaveInterval is how often the counts are written to UsageFile while
+// downloads are running.
+const usageSaveInterval = time.Minute
+
+// capRecheck bounds how long a download waiting for the monthly cap sleeps
+// before looking again, in case the clock jumps.
+const capRecheck = time.Hour
+
+// Usage is the bandwidth downloaded in the current calendar month, in the
+// server's time zone, against the monthly cap.
+type Usage struct {
+	Month     string           `json:"month"` // Such as "2026-10"
+	Bytes     int64            `json:"bytes"`
+	Cap       int64            `json:"cap"`                 // 0 when there is none
+	Remaining int64            `json:"remaining,omitempty"` // Bytes left under the cap
+	Capped    bool             `json:"capped"`              // New downloads wait for Resets
+	Resets    time.Time        `json:"resets"`              // Start of the next month
+	Months    map[string]int64 `json:"months"`              // Every recorded month
+}
+
+// usage counts the bytes received from servers per month.
+type usage struct {
+	mu      sync.Mutex
+	months  map[string]int64
+	cap     int64
+	changed chan struct{} // Closed when the cap changes
+	saved   time.Time
+}
+
+func month(t time.Time) string {
+	return t.Format("2006-01")
+}
+
+// nextMonth returns the start of the month after t's.
+func nextMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+}
+
+// countBytes adds n bytes of d received from source to the current month
+// and the stats, saving the counts now and then.
+func (m *Manager) countBytes(d *Download, source string, n int) {
+	u := &m.usage
+	now := time.Now()
+	u.mu.Lock()
+	if u.months == nil {
+		u.months = make(map[string]int64)
+	}
+	u.months[month(now)] += int64(n)
+	due := now.Sub(u.saved) >= usageSaveInterval
+	if due {
+		u.saved = now
+	}
+	u.mu.Unlock()
+
+	if due {
+		if err := m.SaveUsage(); err != nil {
+			fmt.Println(err)
+		}
+	}
+	m.countStats(d, source, n, now)
+}
+
+// Usage reports this month's bandwidth use and the cap.
+func (m *Manager) Usage() Usage {
+	u := &m.usage
+	now := time.Now()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	report := Usage{
+		Month:  month(now),
+		Bytes:  u.months[month(now)],
+		Cap:    u.cap,
+		Resets: nextMonth(now),
+		Months: make(map[string]int64, len(u.months)),
+	}
+	for key, bytes := range u.months {
+		report.Months[key] = bytes
+	}
+	if report.Cap > 0 {
+		report.Capped = report.Bytes >= report.Cap
+		report.Remaining = max(report.Cap-report.Bytes, 0)
+	}
+	return report
+}
+
+// MonthlyCap returns the bytes that may be downloaded each month before new
+// downloads wait for the next one; 0 means there is no cap.
+func (m *Manager) MonthlyCap() int64 {
+	m.usage.mu.Lock()
+	defer m.usage.mu.Unlock()
+	return m.usage.cap
+}
+
+// SetMonthlyCap changes the monthly cap, starting any downloads that were
+// waiting for a cap they are now under. Downloads already running are never
+// stopped by the cap, so a month can end slightly over it.
+func (m *Manager) SetMonthlyCap(bytes int64) {
+	u := &m.usage
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.cap = max(bytes, 0)
+	if u.changed != nil {
+		close(u.changed)
+		u.changed = nil
+	}
+}
+
+// awaitMonthlyCap holds a download back while this month's usage is at the
+// cap, until the next month starts or the cap is raised.
+func (m *Manager) awaitMonthlyCap(d *Download) error {
+	u := &m.usage
+	for {
+		now := time.Now()
+		u.mu.Lock()
+		capped := u.cap > 0 && u.months[month(now)] >= u.cap
+		if capped && u.changed == nil {
+			u.changed = make(chan struct{})
+		}
+		changed, limit := u.changed, u.cap
+		u.mu.Unlock()
+		if !capped {
+			return nil
+		}
+
+		if d.status() != StatusWaiting {
+			d.logf("Monthly cap of %d bytes reached; waiting until %s", limit, nextMonth(now).Format(time.DateTime))
+			d.setStatus(StatusWaiting)
+			m.broadcastUpdate(DownloadUpdate{
+				DownloadID: d.ID,
+				Type:       "status",
+				Data:       d,
+			})
+		}
+		timer := time.NewTimer(min(time.Until(nextMonth(now)), capRecheck))
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-d.ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("cancelled while waiting for the monthly cap to reset")
+		}
+	}
+}
+
+// LoadUsage reads the counts saved in m.UsageFile. A missing file is not an
+// error.
+func (m *Manager) LoadUsage() error {
+	if m.UsageFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.UsageFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved struct {
+		Months map[string]int64 `json:"months"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("invalid usage file %s: %v", m.UsageFile, err)
+	}
+
+	m.usage.mu.Lock()
+	defer m.usage.mu.Unlock()
+	if m.usage.months == nil {
+		m.usage.months = make(map[string]int64)
+	}
+	for key, bytes := range saved.Months {
+		m.usage.months[key] += bytes
+	}
+	return nil
+}
+
+// SaveUsage writes the counts to m.UsageFile.
+func (m *Manager) SaveUsage() error {
+	if m.UsageFile == "" {
+		return nil
+	}
+	m.usage.mu.Lock()
+	data, err := json.MarshalIndent(struct {
+		Months map[string]int64 `json:"months"`
+	}{m.usage.months}, "", "  ")
+	m.usage.mu.Unlock()
+	if err == nil {
+		tmp := m.UsageFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, m.UsageFile)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save usage to %s: %v", m.UsageFile, err)
+	}
+	return nil
+}
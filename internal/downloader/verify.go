@@ -0,0 +1,54 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/govind1331/Datablip/internal/digest"
+	"github.com/govind1331/Datablip/internal/fastcopy"
+)
+
+// verifyDigests checks the finished part file against the checksum the
+// download was added with and those the server advertised, recording the
+// outcome on d. hasher holds the digests computed while the data was
+// written; when it is nil the part file is read back. Only a mismatch with a
+// declared checksum is an error.
+func (m *Manager) verifyDigests(d *Download, hasher *digest.Hasher) error {
+	if len(d.digests) == 0 {
+		return nil
+	}
+
+	if hasher == nil {
+		file, err := os.Open(partPath(d))
+		if err != nil {
+			return fmt.Errorf("error opening file for verification: %v", err)
+		}
+		defer file.Close()
+
+		hasher = digest.ForExpected(d.digests)
+		if _, err := fastcopy.Reader(hasher, file); err != nil {
+			return fmt.Errorf("error hashing file for verification: %v", err)
+		}
+	}
+
+	results := digest.Check(d.digests, hasher)
+	for _, result := range results {
+		d.logf("Checksum %s from %s for %s: match=%v", result.Algorithm, result.Source, d.Filename, result.Match)
+	}
+
+	d.mu.Lock()
+	d.Verification = results
+	d.sha256 = hasher.Sum(digest.SHA256)
+	d.mu.Unlock()
+
+	return digest.Failed(results)
+}
+
+// failedStatus is the status of a download that failed with err.
+func failedStatus(err error) DownloadStatus {
+	if errors.Is(err, digest.ErrMismatch) {
+		return StatusChecksumMismatch
+	}
+	return StatusError
+}
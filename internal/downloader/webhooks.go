@@ -0,0 +1,102 @@
+package downloader
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/digest"
+	"github.com/govind1331/Datablip/internal/webhook"
+)
+
+// webhookEvents maps the updates that are sent to webhooks to their event.
+var webhookEvents = map[string]string{
+	"completed":   webhook.Completed,
+	"error":       webhook.Failed,
+	"paused":      webhook.Paused,
+	"resumed":     webhook.Resumed,
+	"quarantined": webhook.Quarantined,
+}
+
+// webhookPayload is the body of a webhook delivery.
+type webhookPayload struct {
+	ID       string          `json:"id"` // Also in the delivery header
+	Event    string          `json:"event"`
+	Time     time.Time       `json:"time"`
+	Download webhookDownload `json:"download"`
+}
+
+// webhookDownload is what webhooks learn of a download. The headers,
+// cookies and login it was added with are left out.
+type webhookDownload struct {
+	ID            string          `json:"id"`
+	URL           string          `json:"url"`
+	FinalURL      string          `json:"finalUrl,omitempty"`
+	Filename      string          `json:"filename"`
+	OutputPath    string          `json:"outputPath"`
+	Status        DownloadStatus  `json:"status"`
+	TotalSize     int64           `json:"totalSize"`
+	Downloaded    int64           `json:"downloaded"`
+	StartTime     time.Time       `json:"startTime"`
+	Error         string          `json:"error,omitempty"`
+	Checksum      string          `json:"checksum,omitempty"`
+	Verification  []digest.Result `json:"verification,omitempty"`
+	ContentType   string          `json:"contentType,omitempty"`
+	UploadedTo    string          `json:"uploadedTo,omitempty"`
+	MovedTo       string          `json:"movedTo,omitempty"`
+	RoutedTo      string          `json:"routedTo,omitempty"`
+	Threat        string          `json:"threat,omitempty"`
+	QuarantinedTo string          `json:"quarantinedTo,omitempty"`
+}
+
+// notifyWebhooks sends the event of update, if it has one, to every hook
+// that asked for it. Deliveries run in the background.
+func (m *Manager) notifyWebhooks(update DownloadUpdate, d *Download) {
+	event, ok := webhookEvents[update.Type]
+	if !ok || len(m.Webhooks) == 0 {
+		return
+	}
+
+	d.mu.RLock()
+	payload := webhookPayload{
+		ID:    generateID(),
+		Event: event,
+		Time:  time.Now().UTC(),
+		Download: webhookDownload{
+			ID:            d.ID,
+			URL:           d.URL,
+			FinalURL:      d.FinalURL,
+			Filename:      d.Filename,
+			OutputPath:    d.OutputPath,
+			Status:        d.Status,
+			TotalSize:     d.TotalSize,
+			Downloaded:    d.Downloaded,
+			StartTime:     d.StartTime,
+			Error:         d.Error,
+			Checksum:      d.Checksum,
+			Verification:  d.Verification,
+			ContentType:   d.ContentType,
+			UploadedTo:    d.UploadedTo,
+			MovedTo:       d.MovedTo,
+			RoutedTo:      d.RoutedTo,
+			Threat:        d.Threat,
+			QuarantinedTo: d.QuarantinedTo,
+		},
+	}
+	body, err := json.Marshal(payload)
+	d.mu.RUnlock()
+	if err != nil {
+		d.logf("Webhook payload for %s failed: %v", event, err)
+		return
+	}
+
+	for _, hook := range m.Webhooks {
+		if !hook.Wants(event) {
+			continue
+		}
+		go func() {
+			if err := m.webhooks.Deliver(m.ctx, hook, event, payload.ID, body); err != nil {
+				d.logf("Webhook %s for %s failed: %v", hook.URL, event, err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,118 @@
+// Package endgame lets a download that is nearly finished race a second
+// connection against a chunk that is crawling, so one bad connection can't
+// hold up the whole transfer.
+package endgame
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+const (
+	// Threshold is the fraction of the download that must be complete
+	// before helpers are started.
+	Threshold = 0.95
+
+	// MinRemaining is the least a chunk must have left to be worth a second
+	// connection.
+	MinRemaining = 1 << 20
+)
+
+// ErrOvertaken is the cancellation cause seen by a chunk's original
+// connection when its helper finished the range first.
+var ErrOvertaken = errors.New("chunk finished by endgame connection")
+
+// Straggler reports whether a chunk with remaining bytes left, moving at
+// speed bytes/s, is crawling compared with the typical per-connection speed
+// of the download.
+func Straggler(remaining int64, speed, typical float64) bool {
+	return remaining >= MinRemaining && speed < typical/2
+}
+
+// Race coordinates a chunk's original connection with at most one helper
+// fetching the rest of the same range. Whichever finishes first wins and the
+// other is cancelled.
+type Race struct {
+	cancelPrimary context.CancelCauseFunc
+
+	mu           sync.Mutex
+	finished     bool
+	helping      bool
+	cancelHelper context.CancelFunc
+	helperDone   chan struct{}
+	helperErr    error
+}
+
+// New returns a race and the context the original connection must use.
+func New(parent context.Context) (context.Context, *Race) {
+	ctx, cancel := context.WithCancelCause(parent)
+	return ctx, &Race{cancelPrimary: cancel}
+}
+
+// Help starts fetch as the helper connection unless one was already
+// started or the race is already finished. fetch must write the remainder of the chunk and return nil only
+// once all of it is stored; the original connection is then cancelled with
+// ErrOvertaken.
+func (r *Race) Help(parent context.Context, fetch func(ctx context.Context) error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.helping || r.finished {
+		return false
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	r.helping = true
+	r.cancelHelper = cancel
+	r.helperDone = make(chan struct{})
+
+	go func() {
+		defer close(r.helperDone)
+		err := fetch(ctx)
+		r.mu.Lock()
+		r.helperErr = err
+		r.mu.Unlock()
+		if err == nil {
+			r.cancelPrimary(ErrOvertaken)
+		}
+	}()
+	return true
+}
+
+// Helping reports whether a helper has been started.
+func (r *Race) Helping() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.helping
+}
+
+// Finish is called by the original connection once it returns. If it
+// succeeded any helper is stopped. Otherwise a running helper is waited for,
+// and the chunk still succeeds if the helper completed it. Finish reports
+// whether the helper produced the result, and the chunk's outcome.
+func (r *Race) Finish(primaryErr error) (byHelper bool, err error) {
+	r.mu.Lock()
+	r.finished = true
+	helping, done, cancel := r.helping, r.helperDone, r.cancelHelper
+	r.mu.Unlock()
+
+	defer r.cancelPrimary(nil)
+	if !helping {
+		return false, primaryErr
+	}
+
+	if primaryErr == nil {
+		cancel()
+		<-done
+		return false, nil
+	}
+
+	<-done
+	cancel()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.helperErr == nil {
+		return true, nil
+	}
+	return false, primaryErr
+}
@@ -0,0 +1,131 @@
+// Package extract unpacks zip and tar archives, refusing entries that would
+// land outside the destination directory.
+package extract
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format is a supported archive format.
+type Format int
+
+const (
+	Zip Format = iota + 1
+	Tar
+	TarGzip
+	TarBzip2
+)
+
+// Detect picks the archive format from a file name.
+func Detect(name string) (Format, bool) {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return Zip, true
+	case strings.HasSuffix(name, ".tar"):
+		return Tar, true
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return TarGzip, true
+	case strings.HasSuffix(name, ".tar.bz2"), strings.HasSuffix(name, ".tbz2"):
+		return TarBzip2, true
+	}
+	return 0, false
+}
+
+// Progress receives updates while an archive is unpacked.
+type Progress struct {
+	// Entry, if non-nil, is called with the name of each entry before it
+	// is extracted.
+	Entry func(name string)
+
+	// Bytes, if non-nil, is called with how many bytes of the archive file
+	// were consumed, so they add up to its size.
+	Bytes func(n int64)
+
+	// Logf, if non-nil, is called with a message about each entry that is
+	// skipped.
+	Logf func(format string, args ...any)
+}
+
+func (p Progress) entry(name string) {
+	if p.Entry != nil {
+		p.Entry(name)
+	}
+}
+
+func (p Progress) bytes(n int64) {
+	if p.Bytes != nil {
+		p.Bytes(n)
+	}
+}
+
+func (p Progress) logf(format string, args ...any) {
+	if p.Logf != nil {
+		p.Logf(format, args...)
+	}
+}
+
+// Extract unpacks the archive at path into dest and returns the files it
+// created, relative to dest with forward slashes. Entries with absolute
+// paths or ".." elements that escape dest fail the extraction; links are
+// skipped, as they could point outside it.
+func Extract(ctx context.Context, path, dest string, progress Progress) ([]string, error) {
+	format, ok := Detect(path)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a supported archive", filepath.Base(path))
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+	if format == Zip {
+		return extractZip(ctx, path, dest, progress)
+	}
+	return extractTar(ctx, path, dest, format, progress)
+}
+
+// target resolves an entry name inside dest.
+func target(dest, name string) (string, error) {
+	local := filepath.FromSlash(strings.TrimSuffix(name, "/"))
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("refusing entry %q: it points outside the destination", name)
+	}
+	return filepath.Join(dest, local), nil
+}
+
+// writeFile creates the entry's file, and any missing parent directories,
+// from r.
+func writeFile(ctx context.Context, path string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if mode.Perm() == 0 {
+		mode = 0644
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, &ctxReader{ctx: ctx, r: r})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ctxReader stops a copy once ctx is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,208 @@
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// entry is a file, directory or link to put in a test archive.
+type entry struct {
+	name string
+	body string
+	link string // Link target; the entry is a symlink if set
+	hard bool   // Make the link a hard link (tar only)
+	dir  bool
+}
+
+func writeZip(t *testing.T, path string, entries []entry) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		body := e.body
+		switch {
+		case e.dir:
+			header.SetMode(fs.ModeDir | 0755)
+		case e.link != "":
+			header.SetMode(fs.ModeSymlink | 0777)
+			body = e.link
+		default:
+			header.SetMode(0644)
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTar(t *testing.T, path string, entries []entry) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		switch {
+		case e.dir:
+			header.Typeflag, header.Mode, header.Size = tar.TypeDir, 0755, 0
+		case e.hard:
+			header.Typeflag, header.Linkname, header.Size = tar.TypeLink, e.link, 0
+		case e.link != "":
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, e.link, 0
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			if _, err := w.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// outside lists what exists under root apart from the archive and dest,
+// and any symlinks inside dest.
+func outside(t *testing.T, root, archive, dest string) []string {
+	var found []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case path == root, path == archive, path == dest:
+		case d.Type()&fs.ModeSymlink != 0:
+			found = append(found, path)
+		case filepath.Dir(path) == root:
+			found = append(found, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestExtractStaysInDestination(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+		want    []string // Files extracted; nil if the extraction fails
+	}{
+		{
+			name:    "parent entry",
+			entries: []entry{{name: "ok.txt", body: "ok"}, {name: "../evil.txt", body: "evil"}},
+		},
+		{
+			name:    "parent inside a directory",
+			entries: []entry{{name: "a/", dir: true}, {name: "a/../../evil.txt", body: "evil"}},
+		},
+		{
+			name:    "absolute entry",
+			entries: []entry{{name: "/tmp/evil.txt", body: "evil"}},
+		},
+		{
+			name: "symlink out",
+			entries: []entry{
+				{name: "link", link: ".."},
+				{name: "abs", link: "/"},
+				{name: "ok.txt", body: "ok"},
+			},
+			want: []string{"ok.txt"},
+		},
+		{
+			name: "write through a skipped symlink",
+			entries: []entry{
+				{name: "link", link: ".."},
+				{name: "link/evil.txt", body: "evil"},
+			},
+			want: []string{"link/evil.txt"},
+		},
+	}
+	formats := []struct {
+		ext   string
+		write func(*testing.T, string, []entry)
+	}{
+		{".zip", writeZip},
+		{".tar.gz", writeTar},
+	}
+	for _, format := range formats {
+		for _, test := range tests {
+			t.Run(format.ext+"/"+test.name, func(t *testing.T) {
+				root := t.TempDir()
+				archive := filepath.Join(root, "archive"+format.ext)
+				dest := filepath.Join(root, "dest")
+				format.write(t, archive, test.entries)
+
+				files, err := Extract(context.Background(), archive, dest, Progress{})
+				switch {
+				case test.want == nil && err == nil:
+					t.Errorf("extracted %v, want an error", files)
+				case test.want != nil && err != nil:
+					t.Errorf("got error %v", err)
+				case test.want != nil && !reflect.DeepEqual(files, test.want):
+					t.Errorf("got %v extracted, want %v", files, test.want)
+				}
+				if found := outside(t, root, archive, dest); len(found) != 0 {
+					t.Errorf("wrote %v outside the destination or as links", found)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractSkipsHardLinks(t *testing.T) {
+	root := t.TempDir()
+	archive := filepath.Join(root, "archive.tar.gz")
+	dest := filepath.Join(root, "dest")
+	secret := filepath.Join(root, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeTar(t, archive, []entry{
+		{name: "hard", link: secret, hard: true},
+		{name: "up", link: "../secret.txt", hard: true},
+	})
+
+	files, err := Extract(context.Background(), archive, dest, Progress{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("got %v extracted, want nothing", files)
+	}
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %d entries in the destination, want none", len(entries))
+	}
+}
@@ -0,0 +1,87 @@
+package extract
+
+import (
+	"archive/tar"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+func extractTar(ctx context.Context, src, dest string, format Format, progress Progress) ([]string, error) {
+	file, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Progress follows the compressed bytes read from the archive file
+	counted := &countingReader{r: file, progress: progress}
+	var r io.Reader = counted
+	switch format {
+	case TarGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	case TarBzip2:
+		r = bzip2.NewReader(r)
+	}
+
+	var files []string
+	archive := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return files, err
+		}
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return files, err
+		}
+		out, err := target(dest, header.Name)
+		if err != nil {
+			return files, err
+		}
+		progress.entry(header.Name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(out, 0755)
+		case tar.TypeReg:
+			err = writeFile(ctx, out, archive, header.FileInfo().Mode())
+			if err == nil {
+				files = append(files, path.Clean(header.Name))
+			}
+		case tar.TypeXGlobalHeader:
+		default:
+			progress.logf("Skipping %s in %s: not a regular file", header.Name, filepath.Base(src))
+		}
+		if err != nil {
+			return files, fmt.Errorf("failed to extract %s: %v", header.Name, err)
+		}
+	}
+
+	// Account for padding after the last entry
+	io.Copy(io.Discard, counted)
+	return files, nil
+}
+
+type countingReader struct {
+	r        io.Reader
+	progress Progress
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.progress.bytes(int64(n))
+	return n, err
+}
@@ -0,0 +1,57 @@
+package extract
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+func extractZip(ctx context.Context, src, dest string, progress Progress) ([]string, error) {
+	archive, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	var files []string
+	for _, f := range archive.File {
+		if err := ctx.Err(); err != nil {
+			return files, err
+		}
+		out, err := target(dest, f.Name)
+		if err != nil {
+			return files, err
+		}
+		progress.entry(f.Name)
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = os.MkdirAll(out, 0755)
+		case mode.IsRegular():
+			err = extractZipFile(ctx, f, out)
+			if err == nil {
+				files = append(files, path.Clean(f.Name))
+			}
+		default:
+			progress.logf("Skipping %s in %s: not a regular file", f.Name, filepath.Base(src))
+		}
+		if err != nil {
+			return files, fmt.Errorf("failed to extract %s: %v", f.Name, err)
+		}
+		progress.bytes(int64(f.CompressedSize64))
+	}
+	return files, nil
+}
+
+func extractZipFile(ctx context.Context, f *zip.File, out string) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return writeFile(ctx, out, r, f.Mode())
+}
@@ -0,0 +1,12 @@
+package fastcopy
+
+import (
+	"io"
+	"os"
+)
+
+// copySegment hands the copy to os.File.ReadFrom, which uses copy_file_range
+// so the data never passes through user space.
+func copySegment(dst, src *os.File, n int64) (int64, error) {
+	return io.CopyN(dst, src, n)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package fastcopy
+
+import (
+	"io"
+	"os"
+)
+
+// copySegment copies through a pooled multi-megabyte buffer.
+func copySegment(dst, src *os.File, n int64) (int64, error) {
+	buf := buffers.Get().(*[]byte)
+	defer buffers.Put(buf)
+	return io.CopyBuffer(writerOnly{dst}, io.LimitReader(src, n), *buf)
+}
@@ -0,0 +1,59 @@
+// Package fastcopy appends one file to another as quickly as the platform
+// allows: through the kernel (copy_file_range) where available, or through
+// multi-megabyte buffers elsewhere.
+package fastcopy
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	// SegmentSize is the amount copied per call, which also sets how often
+	// progress is reported.
+	SegmentSize = 8 << 20
+	// BufferSize is the user-space buffer used when there is no kernel path.
+	BufferSize = 4 << 20
+)
+
+var buffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, BufferSize)
+		return &buf
+	},
+}
+
+// File copies n bytes from the current offset of src to the current offset
+// of dst. progress, if non-nil, is called with the byte count of every
+// completed segment.
+func File(dst, src *os.File, n int64, progress func(int64)) (int64, error) {
+	var written int64
+	for written < n {
+		segment := min(SegmentSize, n-written)
+		copied, err := copySegment(dst, src, segment)
+		written += copied
+		if progress != nil && copied > 0 {
+			progress(copied)
+		}
+		if err != nil {
+			return written, err
+		}
+		if copied < segment {
+			return written, io.ErrUnexpectedEOF
+		}
+	}
+	return written, nil
+}
+
+// Reader streams r through a pooled multi-megabyte buffer into w. It is the
+// read side used to hash data while File moves it.
+func Reader(w io.Writer, r io.Reader) (int64, error) {
+	buf := buffers.Get().(*[]byte)
+	defer buffers.Put(buf)
+	return io.CopyBuffer(writerOnly{w}, readerOnly{r}, *buf)
+}
+
+type writerOnly struct{ io.Writer }
+
+type readerOnly struct{ io.Reader }
@@ -0,0 +1,146 @@
+// Package feed reads the enclosures of RSS 2.0, RSS 1.0 and Atom feeds:
+// the files, such as podcast episodes or release archives, their items
+// point to. Feeds in the wild are often not well-formed XML, so parsing is
+// lenient about HTML entities, unclosed tags and Latin-1 encodings.
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Item is one enclosure of a feed item. An item with several enclosures
+// gives one Item for each.
+type Item struct {
+	// ID identifies the enclosure across polls: the item's guid or Atom
+	// id, with "#2", "#3" and so on for further enclosures, or the URL
+	// when the item has no id.
+	ID    string
+	Title string
+	URL   string // As written in the feed, possibly relative
+}
+
+// document holds the parts of any of the three formats that matter.
+// Element names are matched without their namespace, so RSS 1.0's items,
+// which sit beside its channel rather than in it, are found as well.
+type document struct {
+	Channel struct {
+		Items []entry `xml:"item"`
+	} `xml:"channel"`
+	Items   []entry `xml:"item"`
+	Entries []entry `xml:"entry"`
+}
+
+// entry is an RSS item or an Atom entry.
+type entry struct {
+	Title      string `xml:"title"`
+	GUID       string `xml:"guid"`
+	ID         string `xml:"id"`
+	Enclosures []struct {
+		URL string `xml:"url,attr"`
+	} `xml:"enclosure"`
+	Links []struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"link"`
+	Media []struct {
+		URL string `xml:"url,attr"`
+	} `xml:"http://search.yahoo.com/mrss/ content"`
+}
+
+// Parse reads a feed and returns its enclosures, oldest first on the
+// usual assumption that feeds list their newest items first.
+func Parse(r io.Reader) ([]Item, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+	decoder.CharsetReader = charsetReader
+
+	var doc document
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid feed: %v", err)
+	}
+	entries := append(append(doc.Channel.Items, doc.Items...), doc.Entries...)
+
+	var items []Item
+	for i := len(entries) - 1; i >= 0; i-- {
+		items = append(items, entries[i].items()...)
+	}
+	return items, nil
+}
+
+// items returns the enclosures of e.
+func (e entry) items() []Item {
+	var urls []string
+	for _, enclosure := range e.Enclosures {
+		urls = append(urls, enclosure.URL)
+	}
+	for _, link := range e.Links {
+		if link.Rel == "enclosure" {
+			urls = append(urls, link.Href)
+		}
+	}
+	if len(urls) == 0 {
+		for _, media := range e.Media {
+			urls = append(urls, media.URL)
+		}
+	}
+
+	id := strings.TrimSpace(e.GUID)
+	if id == "" {
+		id = strings.TrimSpace(e.ID)
+	}
+	var items []Item
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		item := Item{ID: url, Title: strings.TrimSpace(e.Title), URL: url}
+		if id != "" {
+			item.ID = id
+			if len(items) > 0 {
+				item.ID = fmt.Sprintf("%s#%d", id, len(items)+1)
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// charsetReader decodes the single-byte encodings feeds declare besides
+// UTF-8. Windows-1252 is read as Latin-1, which differs only in a few
+// punctuation marks.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1", "windows-1252", "cp1252", "us-ascii", "ascii":
+		return &latin1Reader{r: input}, nil
+	}
+	return nil, fmt.Errorf("unsupported feed encoding %q", charset)
+}
+
+// latin1Reader turns Latin-1 bytes into UTF-8.
+type latin1Reader struct {
+	r       io.Reader
+	pending []byte
+}
+
+func (l *latin1Reader) Read(p []byte) (int, error) {
+	if len(l.pending) == 0 {
+		buf := make([]byte, len(p)/2+1)
+		n, err := l.r.Read(buf)
+		for _, b := range buf[:n] {
+			l.pending = utf8.AppendRune(l.pending, rune(b))
+		}
+		if n == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
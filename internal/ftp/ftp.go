@@ -0,0 +1,481 @@
+// Package ftp fetches files over FTP and FTPS behind an http.RoundTripper,
+// so ftp:// and ftps:// URLs take the same path through a download as http
+// ones. A HEAD request learns the size with SIZE and whether the server can
+// start a transfer partway with REST; a GET with a Range header starts the
+// transfer at the range's first byte with REST and stops at its last, so a
+// file is fetched in parallel chunks just like over HTTP.
+//
+// ftps:// is implicit FTPS: the control connection is TLS from the start,
+// on port 990 unless the URL gives one, and data connections are protected
+// too. Each request logs in on a connection of its own, anonymously unless
+// the URL carries a user name and password or the request basic auth.
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transport answers HEAD and GET requests for ftp:// and ftps:// URLs.
+type Transport struct {
+	dial    func(ctx context.Context, network, addr string) (net.Conn, error)
+	timeout time.Duration
+	tls     *tls.Config
+}
+
+// New returns a transport that opens its connections with dial. timeout
+// bounds logging in and each reply up to the start of a transfer, like the
+// response header timeout of an HTTP transport; 0 waits as long as it takes.
+func New(dial func(ctx context.Context, network, addr string) (net.Conn, error), timeout time.Duration) *Transport {
+	return &Transport{
+		dial:    dial,
+		timeout: timeout,
+		// Servers commonly insist that data connections resume the control
+		// connection's TLS session
+		tls: &tls.Config{ClientSessionCache: tls.NewLRUClientSessionCache(64)},
+	}
+}
+
+// RoundTrip logs in to the request's server and answers it as an HTTP
+// server would: 200 with Content-Length and, when REST works, Accept-Ranges
+// for HEAD; the file, or 206 with the requested range of it, for GET. FTP
+// errors come back as the nearest HTTP status.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if req.Method != http.MethodHead && req.Method != http.MethodGet {
+		return nil, fmt.Errorf("ftp: unsupported method %s", req.Method)
+	}
+	ctx := req.Context()
+
+	c, err := t.connect(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.serve(ctx, c, req)
+	if err != nil || resp.Body == http.NoBody {
+		c.close()
+	}
+	return resp, err
+}
+
+// serve answers req on the logged in connection c. Unless it returns a body
+// to read the file from, the caller closes c.
+func (t *Transport) serve(ctx context.Context, c *conn, req *http.Request) (*http.Response, error) {
+	name := filePath(req.URL)
+	size := int64(-1)
+	code, msg, err := c.cmd(2, "SIZE %s", name)
+	switch {
+	case err == nil:
+		if size, err = strconv.ParseInt(strings.TrimSpace(msg), 10, 64); err != nil {
+			size = -1
+		}
+	case code == 550:
+		return respond(req, http.StatusNotFound, -1), nil
+	case code == 0:
+		return nil, err
+	}
+
+	if req.Method == http.MethodHead {
+		resp := respond(req, http.StatusOK, size)
+		if c.rest() {
+			resp.Header.Set("Accept-Ranges", "bytes")
+		}
+		return resp, nil
+	}
+
+	start, end, ranged := parseRange(req.Header.Get("Range"))
+	if ranged && size >= 0 {
+		if start >= size {
+			resp := respond(req, http.StatusRequestedRangeNotSatisfiable, -1)
+			resp.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			return resp, nil
+		}
+		if end < 0 || end >= size {
+			end = size - 1
+		}
+	}
+	if ranged && start > 0 {
+		if code, _, err := c.cmd(3, "REST %d", start); err != nil {
+			if code == 0 {
+				return nil, err
+			}
+			// Without REST the file can only be sent from the start, which
+			// a client takes as the server ignoring the range
+			ranged = false
+		}
+	}
+
+	data, err := c.passive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if code, msg, err := c.cmd(1, "RETR %s", name); err != nil {
+		data.Close()
+		if code == 0 {
+			return nil, err
+		}
+		return respond(req, status(code), -1, msg), nil
+	}
+	c.ctrl.SetDeadline(time.Time{})
+
+	resp := respond(req, http.StatusOK, size)
+	length := size
+	if ranged {
+		resp.StatusCode = http.StatusPartialContent
+		resp.Status = "206 Partial Content"
+		total := "*"
+		if size >= 0 {
+			total = strconv.FormatInt(size, 10)
+		}
+		if end >= 0 {
+			length = end - start + 1
+			resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%s", start, end, total))
+		} else {
+			length = -1
+			resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-*/%s", start, total))
+		}
+	}
+	resp.ContentLength = length
+	if length >= 0 {
+		resp.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+	} else {
+		resp.Header.Del("Content-Length")
+	}
+	resp.Body = newBody(ctx, c, data, length)
+	return resp, nil
+}
+
+// respond returns a bodiless response to req with the given status, and
+// the file's size as its length when known.
+func respond(req *http.Request, code int, size int64, msg ...string) *http.Response {
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "FTP",
+		ProtoMajor:    1,
+		Header:        make(http.Header),
+		Body:          http.NoBody,
+		ContentLength: size,
+		Request:       req,
+	}
+	if len(msg) > 0 {
+		resp.Status = fmt.Sprintf("%d %s", code, msg[0])
+	}
+	if size >= 0 {
+		resp.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	return resp
+}
+
+// status maps an FTP reply code to the HTTP status closest to it.
+func status(code int) int {
+	switch {
+	case code == 530 || code == 532:
+		return http.StatusForbidden
+	case code == 550:
+		return http.StatusNotFound
+	case code >= 400 && code < 500:
+		// Transient on the server's side, such as too many connections
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// filePath returns the path of u to give the server. As in RFC 1738 it is
+// relative to the directory logged in to, so a path starting at the root
+// spells its leading slash as %2F.
+func filePath(u *url.URL) string {
+	return strings.TrimPrefix(u.Path, "/")
+}
+
+// parseRange reads a single "bytes=start-end" range, where end is -1 when
+// the range runs to the end of the file.
+func parseRange(header string) (start, end int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	from, to, found := strings.Cut(spec, "-")
+	if !found || from == "" {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(from, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	end = -1
+	if to != "" {
+		if end, err = strconv.ParseInt(to, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+	}
+	return start, end, true
+}
+
+// body reads a transfer from its data connection, stopping after length
+// bytes if the range ends before the file does. Closing it closes both of
+// the request's connections.
+type body struct {
+	ctx       context.Context
+	c         *conn
+	data      net.Conn
+	remaining int64 // -1 when unknown
+	stop      func() bool
+}
+
+func newBody(ctx context.Context, c *conn, data net.Conn, length int64) *body {
+	b := &body{ctx: ctx, c: c, data: data, remaining: length}
+	b.stop = context.AfterFunc(ctx, func() {
+		data.Close()
+		c.ctrl.Close()
+	})
+	return b
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.remaining == 0 {
+		return 0, io.EOF
+	}
+	if b.remaining > 0 && int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.data.Read(p)
+	if b.remaining > 0 {
+		b.remaining -= int64(n)
+	}
+	if err == io.EOF && b.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil && err != io.EOF && b.ctx.Err() != nil {
+		err = b.ctx.Err()
+	}
+	return n, err
+}
+
+func (b *body) Close() error {
+	b.stop()
+	b.data.Close()
+	b.c.close()
+	return nil
+}
+
+// conn is a logged in control connection.
+type conn struct {
+	t        *Transport
+	ctrl     net.Conn
+	text     *textproto.Conn
+	host     string // To dial data connections on, whatever PASV says
+	secure   bool
+	features string // FEAT's reply, once asked for
+}
+
+// connect dials and logs in to the server of req.
+func (t *Transport) connect(ctx context.Context, req *http.Request) (*conn, error) {
+	u := req.URL
+	secure := u.Scheme == "ftps"
+	port := u.Port()
+	if port == "" {
+		port = "21"
+		if secure {
+			port = "990"
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+	ctrl, err := t.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if secure {
+		tlsConn := tls.Client(ctrl, t.tlsConfig(u.Hostname()))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			ctrl.Close()
+			return nil, err
+		}
+		ctrl = tlsConn
+	}
+
+	c := &conn{t: t, ctrl: ctrl, text: textproto.NewConn(ctrl), host: u.Hostname(), secure: secure}
+	// Hang up if the request is cancelled while logging in
+	stop := context.AfterFunc(ctx, func() { ctrl.Close() })
+	defer stop()
+	if err := c.login(req); err != nil {
+		c.close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func (t *Transport) tlsConfig(host string) *tls.Config {
+	config := t.tls.Clone()
+	config.ServerName = host
+	return config
+}
+
+func (c *conn) login(req *http.Request) error {
+	c.deadline()
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		return fmt.Errorf("ftp: %s: %w", c.host, err)
+	}
+
+	user, password := "anonymous", "anonymous@"
+	if req.URL.User != nil {
+		user = req.URL.User.Username()
+		password, _ = req.URL.User.Password()
+	} else if basicUser, basicPassword, ok := req.BasicAuth(); ok {
+		user, password = basicUser, basicPassword
+	}
+	code, _, err := c.cmd(0, "USER %s", user)
+	if err == nil && code == 331 {
+		_, _, err = c.cmd(2, "PASS %s", password)
+	} else if err == nil && code >= 300 {
+		err = fmt.Errorf("ftp: USER: unexpected reply %d", code)
+	}
+	if err != nil {
+		return fmt.Errorf("ftp: login to %s failed: %w", c.host, err)
+	}
+
+	if c.secure {
+		if _, _, err := c.cmd(2, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, _, err := c.cmd(2, "PROT P"); err != nil {
+			return err
+		}
+	}
+	_, _, err = c.cmd(2, "TYPE I")
+	return err
+}
+
+// cmd sends a command and reads its reply, which must start with the digit
+// expect unless that is 0. A reply that doesn't comes back as a
+// *textproto.Error along with its code; code is 0 only when the connection
+// itself failed.
+func (c *conn) cmd(expect int, format string, args ...any) (int, string, error) {
+	c.deadline()
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	code, msg, err := c.text.ReadResponse(expect)
+	if err != nil {
+		var protoErr *textproto.Error
+		if !errors.As(err, &protoErr) {
+			return 0, "", err
+		}
+		return code, msg, fmt.Errorf("ftp: %s: %w", strings.Fields(format)[0], err)
+	}
+	return code, msg, nil
+}
+
+// deadline bounds the next reply by the transport's timeout.
+func (c *conn) deadline() {
+	if c.t.timeout > 0 {
+		c.ctrl.SetDeadline(time.Now().Add(c.t.timeout))
+	}
+}
+
+// rest reports whether the server announces REST STREAM, the restart of a
+// transfer at a byte offset.
+func (c *conn) rest() bool {
+	if c.features == "" {
+		_, msg, err := c.cmd(2, "FEAT")
+		if err != nil {
+			return false
+		}
+		c.features = strings.ToUpper(msg)
+	}
+	return strings.Contains(c.features, "REST STREAM")
+}
+
+// passive opens a data connection with EPSV, or PASV for servers that only
+// know that.
+func (c *conn) passive(ctx context.Context) (net.Conn, error) {
+	var port int
+	code, msg, err := c.cmd(2, "EPSV")
+	if err == nil {
+		// 229 Entering Extended Passive Mode (|||6446|)
+		if open, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)"); open >= 0 && end > open {
+			port, err = strconv.Atoi(msg[open+4 : end])
+		} else {
+			err = fmt.Errorf("ftp: EPSV: malformed reply %q", msg)
+		}
+	}
+	if err != nil {
+		if code == 0 {
+			return nil, err
+		}
+		if port, err = c.pasv(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.t.timeout)
+		defer cancel()
+	}
+	data, err := c.t.dial(ctx, "tcp", net.JoinHostPort(c.host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	if c.secure {
+		// The server only handshakes once RETR is sent, so this one
+		// happens on the first read
+		data = tls.Client(data, c.t.tlsConfig(c.host))
+	}
+	return data, nil
+}
+
+// pasv asks for a passive data port the old way. The address in the reply
+// is ignored in favour of the control connection's, since servers behind
+// NAT often give their private one.
+func (c *conn) pasv() (int, error) {
+	_, msg, err := c.cmd(2, "PASV")
+	if err != nil {
+		return 0, err
+	}
+	// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+	open, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if open < 0 || end < open {
+		return 0, fmt.Errorf("ftp: PASV: malformed reply %q", msg)
+	}
+	fields := strings.Split(msg[open+1:end], ",")
+	if len(fields) != 6 {
+		return 0, fmt.Errorf("ftp: PASV: malformed reply %q", msg)
+	}
+	high, err1 := strconv.Atoi(strings.TrimSpace(fields[4]))
+	low, err2 := strconv.Atoi(strings.TrimSpace(fields[5]))
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("ftp: PASV: malformed reply %q", msg)
+	}
+	return high<<8 | low, nil
+}
+
+// close hangs up, without waiting for the server to acknowledge a transfer
+// that was cut short.
+func (c *conn) close() {
+	c.ctrl.SetDeadline(time.Now().Add(time.Second))
+	c.text.PrintfLine("QUIT")
+	c.ctrl.Close()
+}
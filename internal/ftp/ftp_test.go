@@ -0,0 +1,403 @@
+package ftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is an FTP server on localhost serving files from memory. It
+// speaks just enough of the protocol for the transport.
+type fakeServer struct {
+	listener net.Listener
+	files    map[string][]byte
+	user     string
+	password string
+	noEPSV   bool // Refuse EPSV, so clients fall back to PASV
+	noSize   bool // Refuse SIZE
+	noRest   bool // Refuse REST and leave it out of FEAT
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func newFakeServer(t *testing.T, configure func(*fakeServer)) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		listener: listener,
+		files:    map[string][]byte{},
+		user:     "alice",
+		password: "secret",
+	}
+	if configure != nil {
+		configure(s)
+	}
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		listener.Close()
+		wg.Wait()
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	return s
+}
+
+// url returns the ftp:// URL of name with the given login.
+func (s *fakeServer) url(login, name string) string {
+	if login != "" {
+		login += "@"
+	}
+	return fmt.Sprintf("ftp://%s%s/%s", login, s.listener.Addr(), name)
+}
+
+// sent reports whether a command starting with prefix was received.
+func (s *fakeServer) sent(prefix string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, command := range s.commands {
+		if strings.HasPrefix(command, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	text := textproto.NewConn(conn)
+	reply := func(format string, args ...any) { text.PrintfLine(format, args...) }
+
+	var (
+		user     string
+		loggedIn bool
+		offset   int64
+		data     net.Listener
+	)
+	defer func() {
+		if data != nil {
+			data.Close()
+		}
+	}()
+	listen := func() (int, bool) {
+		if data != nil {
+			data.Close()
+		}
+		var err error
+		if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			reply("425 Can't open data connection")
+			return 0, false
+		}
+		return data.Addr().(*net.TCPAddr).Port, true
+	}
+
+	reply("220 Fake FTP ready")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+		command, arg, _ := strings.Cut(line, " ")
+
+		if !loggedIn && command != "USER" && command != "PASS" && command != "QUIT" {
+			reply("530 Please login with USER and PASS")
+			continue
+		}
+		switch command {
+		case "USER":
+			user = arg
+			reply("331 Password required")
+		case "PASS":
+			if user != s.user || arg != s.password {
+				reply("530 Login incorrect")
+				continue
+			}
+			loggedIn = true
+			reply("230 Logged in")
+		case "TYPE":
+			reply("200 Type set")
+		case "FEAT":
+			text.PrintfLine("211-Features:")
+			if !s.noRest {
+				text.PrintfLine(" REST STREAM")
+			}
+			if !s.noSize {
+				text.PrintfLine(" SIZE")
+			}
+			reply("211 End")
+		case "SIZE":
+			file, ok := s.files[arg]
+			switch {
+			case s.noSize:
+				reply("502 Command not implemented")
+			case !ok:
+				reply("550 No such file")
+			default:
+				reply("213 %d", len(file))
+			}
+		case "REST":
+			n, err := strconv.ParseInt(arg, 10, 64)
+			if s.noRest || err != nil {
+				reply("502 Command not implemented")
+				continue
+			}
+			offset = n
+			reply("350 Restarting at %d", n)
+		case "EPSV":
+			if s.noEPSV {
+				reply("502 Command not implemented")
+				continue
+			}
+			if port, ok := listen(); ok {
+				reply("229 Entering Extended Passive Mode (|||%d|)", port)
+			}
+		case "PASV":
+			// A private address, as servers behind NAT give; clients dial
+			// the control connection's host instead
+			if port, ok := listen(); ok {
+				reply("227 Entering Passive Mode (10,0,0,1,%d,%d)", port>>8, port&0xff)
+			}
+		case "RETR":
+			file, ok := s.files[arg]
+			if !ok {
+				reply("550 No such file")
+				continue
+			}
+			if data == nil {
+				reply("425 Use PASV or EPSV first")
+				continue
+			}
+			reply("150 Opening data connection")
+			dataConn, err := data.Accept()
+			if err != nil {
+				return
+			}
+			dataConn.Write(file[min(offset, int64(len(file))):])
+			dataConn.Close()
+			data.Close()
+			data, offset = nil, 0
+			reply("226 Transfer complete")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func newTransport() *Transport {
+	return New((&net.Dialer{}).DialContext, 5*time.Second)
+}
+
+func get(t *testing.T, url, rangeHeader string) *http.Response {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	resp, err := newTransport().RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func readBody(t *testing.T, resp *http.Response) []byte {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestResume(t *testing.T) {
+	file := bytes.Repeat([]byte("0123456789"), 10000)
+	size := len(file)
+	for _, passive := range []string{"EPSV", "PASV"} {
+		t.Run(passive, func(t *testing.T) {
+			s := newFakeServer(t, func(s *fakeServer) {
+				s.files["pub/file.bin"] = file
+				s.noEPSV = passive == "PASV"
+			})
+
+			req, err := http.NewRequest(http.MethodHead, s.url("alice:secret", "pub/file.bin"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			head, err := newTransport().RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			head.Body.Close()
+			if head.StatusCode != http.StatusOK || head.ContentLength != int64(size) || head.Header.Get("Accept-Ranges") != "bytes" {
+				t.Errorf("HEAD: got %d, length %d, Accept-Ranges %q; want 200, %d, bytes",
+					head.StatusCode, head.ContentLength, head.Header.Get("Accept-Ranges"), size)
+			}
+
+			resp := get(t, s.url("alice:secret", "pub/file.bin"), "bytes=1000-")
+			body := readBody(t, resp)
+			wantRange := fmt.Sprintf("bytes 1000-%d/%d", size-1, size)
+			if resp.StatusCode != http.StatusPartialContent || resp.Header.Get("Content-Range") != wantRange {
+				t.Errorf("got %d with Content-Range %q, want 206 with %q", resp.StatusCode, resp.Header.Get("Content-Range"), wantRange)
+			}
+			if !bytes.Equal(body, file[1000:]) {
+				t.Errorf("got %d bytes resumed, want the %d from offset 1000", len(body), size-1000)
+			}
+			if !s.sent("REST 1000") || !s.sent(passive) {
+				t.Errorf("server didn't get REST 1000 and %s", passive)
+			}
+
+			// A chunk in the middle stops at its end
+			resp = get(t, s.url("alice:secret", "pub/file.bin"), "bytes=2000-2999")
+			body = readBody(t, resp)
+			if resp.StatusCode != http.StatusPartialContent || resp.ContentLength != 1000 || !bytes.Equal(body, file[2000:3000]) {
+				t.Errorf("got %d with %d bytes, want 206 with bytes 2000-2999", resp.StatusCode, len(body))
+			}
+		})
+	}
+}
+
+func TestResumeWithoutSize(t *testing.T) {
+	file := bytes.Repeat([]byte("datablip"), 1000)
+	s := newFakeServer(t, func(s *fakeServer) {
+		s.files["file.bin"] = file
+		s.noSize = true
+	})
+
+	resp := get(t, s.url("alice:secret", "file.bin"), "bytes=100-")
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusPartialContent || resp.ContentLength != -1 || resp.Header.Get("Content-Range") != "bytes 100-*/*" {
+		t.Errorf("got %d, length %d, Content-Range %q; want 206, unknown, bytes 100-*/*",
+			resp.StatusCode, resp.ContentLength, resp.Header.Get("Content-Range"))
+	}
+	if !bytes.Equal(body, file[100:]) {
+		t.Errorf("got %d bytes resumed, want %d", len(body), len(file)-100)
+	}
+}
+
+func TestResumeWithoutRest(t *testing.T) {
+	file := bytes.Repeat([]byte("datablip"), 1000)
+	s := newFakeServer(t, func(s *fakeServer) {
+		s.files["file.bin"] = file
+		s.noRest = true
+	})
+
+	resp := get(t, s.url("alice:secret", "file.bin"), "bytes=100-")
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, file) {
+		t.Errorf("got %d with %d bytes, want 200 with the whole %d byte file", resp.StatusCode, len(body), len(file))
+	}
+}
+
+func TestFailedLogin(t *testing.T) {
+	s := newFakeServer(t, func(s *fakeServer) {
+		s.files["file.bin"] = []byte("data")
+	})
+
+	for _, login := range []string{"alice:wrong", "", "bob:secret"} {
+		req, err := http.NewRequest(http.MethodGet, s.url(login, "file.bin"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := newTransport().RoundTrip(req)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("login %q: got %d, want an error", login, resp.StatusCode)
+			continue
+		}
+		var protoErr *textproto.Error
+		if !errors.As(err, &protoErr) || protoErr.Code != 530 || !strings.Contains(err.Error(), "login") {
+			t.Errorf("login %q: got error %v, want a failed login with 530", login, err)
+		}
+	}
+	if s.sent("RETR") {
+		t.Error("server got RETR without a login")
+	}
+
+	// Basic auth logs in when the URL has no user
+	req, err := http.NewRequest(http.MethodGet, s.url("", "file.bin"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("alice", "secret")
+	resp, err := newTransport().RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, resp); string(body) != "data" {
+		t.Errorf("got %q with basic auth, want %q", body, "data")
+	}
+}
+
+func TestMissingFile(t *testing.T) {
+	s := newFakeServer(t, nil)
+	resp := get(t, s.url("alice:secret", "missing.bin"), "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestPasvReply(t *testing.T) {
+	tests := []struct {
+		reply string
+		port  int // 0 if malformed
+	}{
+		{"Entering Passive Mode (10,0,0,1,25,26)", 25<<8 | 26},
+		{"Entering Passive Mode (10, 0, 0, 1, 4, 1).", 4<<8 | 1},
+		{"Entering Passive Mode 10,0,0,1,25,26", 0},
+		{"Entering Passive Mode (10,0,0,1,25)", 0},
+		{"Entering Passive Mode (10,0,0,1,x,26)", 0},
+	}
+	for _, test := range tests {
+		client, server := net.Pipe()
+		c := &conn{t: &Transport{}, ctrl: client, text: textproto.NewConn(client)}
+		go func() {
+			text := textproto.NewConn(server)
+			text.ReadLine()
+			text.PrintfLine("227 %s", test.reply)
+		}()
+		port, err := c.pasv()
+		switch {
+		case test.port == 0 && err == nil:
+			t.Errorf("%q: got port %d, want an error", test.reply, port)
+		case test.port != 0 && (err != nil || port != test.port):
+			t.Errorf("%q: got port %d, %v, want %d", test.reply, port, err, test.port)
+		}
+		client.Close()
+		server.Close()
+	}
+}
@@ -0,0 +1,231 @@
+// Package hoststats remembers how fast downloads from each host went with
+// each number of connections, and recommends the fewest connections that
+// come close to the best speed seen: past that point a host is saturated
+// and more connections only add load.
+package hoststats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFile is where the server keeps its host statistics.
+	DefaultFile = "hosts.json"
+
+	// MinBytes leaves out transfers too small to measure bandwidth rather
+	// than latency.
+	MinBytes = 4 << 20
+
+	// Saturation is the share of the best speed at which fewer connections
+	// count as just as good.
+	Saturation = 0.9
+
+	// weight is how much a new download moves a level's average, so the
+	// numbers follow a host whose capacity changes.
+	weight = 0.3
+)
+
+// Level is how downloads from a host went with one number of connections.
+type Level struct {
+	Connections   int       `json:"connections"`
+	Downloads     int       `json:"downloads"`
+	Speed         float64   `json:"speed"`         // Bytes/s, averaged over recent downloads
+	PerConnection float64   `json:"perConnection"` // Speed divided by Connections
+	LastSeen      time.Time `json:"lastSeen"`
+}
+
+// Host is the report for one host.
+type Host struct {
+	Host        string  `json:"host"`
+	Levels      []Level `json:"levels"`                // Fewest connections first
+	Recommended int     `json:"recommended,omitempty"` // 0 until the host was seen to saturate
+	Summary     string  `json:"summary"`
+}
+
+// Store holds the statistics of every host. It is safe for concurrent use.
+type Store struct {
+	mu    sync.Mutex
+	hosts map[string]map[int]*Level
+}
+
+// New returns an empty store.
+func New() *Store {
+	return &Store{hosts: make(map[string]map[int]*Level)}
+}
+
+// Key returns the host a URL's statistics are kept under, or "" when it has
+// none.
+func Key(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// Record adds a download that moved bytes from host in elapsed over the
+// given number of connections. It reports whether the download was large
+// enough to count.
+func (s *Store) Record(host string, connections int, bytes int64, elapsed time.Duration) bool {
+	if host == "" || connections < 1 || bytes < MinBytes || elapsed <= 0 {
+		return false
+	}
+	speed := float64(bytes) / elapsed.Seconds()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	levels := s.hosts[host]
+	if levels == nil {
+		levels = make(map[int]*Level)
+		s.hosts[host] = levels
+	}
+	level := levels[connections]
+	if level == nil {
+		level = &Level{Connections: connections, Speed: speed}
+		levels[connections] = level
+	} else {
+		level.Speed = level.Speed*(1-weight) + speed*weight
+	}
+	level.Downloads++
+	level.PerConnection = level.Speed / float64(connections)
+	level.LastSeen = time.Now()
+	return true
+}
+
+// Recommend returns the connections recommended for host, once downloads
+// with more connections were seen to be no faster.
+func (s *Store) Recommend(host string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := s.report(host)
+	return report.Recommended, report.Recommended > 0
+}
+
+// Get returns the report for host.
+func (s *Store) Get(host string) (Host, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.hosts[host]; !ok {
+		return Host{}, false
+	}
+	return s.report(host), true
+}
+
+// Hosts returns the report for every host, sorted by name.
+func (s *Store) Hosts() []Host {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hosts := make([]Host, 0, len(s.hosts))
+	for host := range s.hosts {
+		hosts = append(hosts, s.report(host))
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Host < hosts[j].Host })
+	return hosts
+}
+
+// report builds the report for host. The caller holds s.mu.
+func (s *Store) report(host string) Host {
+	report := Host{Host: host, Levels: []Level{}}
+	for _, level := range s.hosts[host] {
+		report.Levels = append(report.Levels, *level)
+	}
+	sort.Slice(report.Levels, func(i, j int) bool {
+		return report.Levels[i].Connections < report.Levels[j].Connections
+	})
+
+	levels := report.Levels
+	switch len(levels) {
+	case 0:
+		report.Summary = "no downloads measured yet"
+		return report
+	case 1:
+		report.Summary = "only measured with " + connections(levels[0].Connections)
+		return report
+	}
+	best := levels[0]
+	for _, level := range levels[1:] {
+		if level.Speed > best.Speed {
+			best = level
+		}
+	}
+	for _, level := range levels {
+		if level.Speed >= best.Speed*Saturation {
+			report.Recommended = level.Connections
+			break
+		}
+	}
+	if most := levels[len(levels)-1].Connections; report.Recommended == most {
+		report.Recommended = 0
+		report.Summary = fmt.Sprintf("still faster with more connections, measured up to %d", most)
+		return report
+	}
+	report.Summary = "this host saturates at " + connections(report.Recommended)
+	return report
+}
+
+func connections(n int) string {
+	if n == 1 {
+		return "1 connection"
+	}
+	return fmt.Sprintf("%d connections", n)
+}
+
+// Load reads the statistics saved in file. A missing file gives an empty
+// store.
+func Load(file string) (*Store, error) {
+	s := New()
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved map[string][]Level
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("invalid host statistics in %s: %v", file, err)
+	}
+	for host, levels := range saved {
+		s.hosts[host] = make(map[int]*Level)
+		for _, level := range levels {
+			if level.Connections > 0 {
+				s.hosts[host][level.Connections] = &level
+			}
+		}
+	}
+	return s, nil
+}
+
+// Save writes the statistics to file.
+func (s *Store) Save(file string) error {
+	s.mu.Lock()
+	saved := make(map[string][]Level, len(s.hosts))
+	for host, levels := range s.hosts {
+		for _, level := range levels {
+			saved[host] = append(saved[host], *level)
+		}
+		sort.Slice(saved[host], func(i, j int) bool {
+			return saved[host][i].Connections < saved[host][j].Connections
+		})
+	}
+	s.mu.Unlock()
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err == nil {
+		tmp := file + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, file)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save host statistics to %s: %v", file, err)
+	}
+	return nil
+}
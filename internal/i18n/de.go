@@ -0,0 +1,136 @@
+package i18n
+
+var german = map[string]string{
+	// CLI progress display
+	"Overall Progress:":  "Gesamtfortschritt:",
+	"Individual Chunks:": "Einzelne Teile:",
+	"Chunk":              "Teil",
+	"Status":             "Status",
+	"Progress":           "Fortschritt",
+	"Downloaded":         "Geladen",
+	"Speed":              "Tempo",
+	"Restarts":           "Neustarts",
+	"ETA":                "Rest",
+	"waiting":            "wartend",
+	"downloading":        "lädt",
+	"reconnecting":       "verbindet",
+	"paused":             "pausiert",
+	"completed":          "fertig",
+	"failed":             "gescheitert",
+	"running":            "läuft",
+	"none":               "keins",
+	"Status Summary: ":   "Übersicht: ",
+	"Waiting: %d":        "Wartend: %d",
+	"Downloading: %d":    "Lädt: %d",
+	"Reconnecting: %d":   "Verbindet: %d",
+	"Paused: %d":         "Pausiert: %d",
+	"Completed: %d":      "Fertig: %d",
+	"Failed: %d":         "Fehlgeschlagen: %d",
+	"%s, limit %s | p pause, r resume, +/- speed limit, q quit and keep for later": "%s, Limit %s | p Pause, r Weiter, +/- Tempolimit, q Beenden und für später behalten",
+	"Merge:": "Zusammenfügen:",
+
+	// CLI messages
+	"Downloading: %s":                            "Lade herunter: %s",
+	"Resuming: %s":                               "Setze fort: %s",
+	"Output: %s":                                 "Ziel: %s",
+	"Chunks: %d":                                 "Teile: %d",
+	"Chunks: auto":                               "Teile: automatisch",
+	"Chunk size: %s (%d connections)":            "Teilgröße: %s (%d Verbindungen)",
+	"Chunk size: %s (connections: auto)":         "Teilgröße: %s (Verbindungen: automatisch)",
+	"Timeouts - Connect: %v, Read per chunk: %v": "Zeitlimits - Verbinden: %v, Lesen je Teil: %v",
+	"Speed limit: %s":                            "Tempolimit: %s",
+	"File size: %d bytes (%.2f MB)":              "Dateigröße: %d Bytes (%.2f MB)",
+	"Auto-selected %d chunks (round trip %v, ranges supported: %v)":   "%d Teile automatisch gewählt (Umlaufzeit %v, Bereiche unterstützt: %v)",
+	"Created %d chunks for concurrent download (%d connections)":      "%d Teile für parallelen Download angelegt (%d Verbindungen)",
+	"Spreading chunks across %d mirrors":                              "Verteile die Teile auf %d Spiegelserver",
+	"Saving as %s":                                                    "Speichere als %s",
+	"Overwriting %s once the download is verified":                    "Überschreibe %s, sobald der Download geprüft ist",
+	"Resuming from the %s already in %s":                              "Setze mit den %s fort, die schon in %s liegen",
+	"%s already exists; saving as %s":                                 "%s existiert bereits; speichere als %s",
+	"Dropped mirror %s for being too slow":                            "Spiegelserver %s wegen zu geringem Tempo aufgegeben",
+	"Dropped mirror %s after repeated failures":                       "Spiegelserver %s nach wiederholten Fehlern aufgegeben",
+	"Starting concurrent download of %d chunks...":                    "Starte parallelen Download von %d Teilen...",
+	"✓ All %d chunks downloaded successfully":                         "✓ Alle %d Teile erfolgreich heruntergeladen",
+	"🎉 Download completed successfully: %s":                           "🎉 Download erfolgreich abgeschlossen: %s",
+	"Total time: %v, Average speed: %s":                               "Gesamtzeit: %v, Durchschnittstempo: %s",
+	"Download failed: %v":                                             "Download fehlgeschlagen: %v",
+	"Download failed with %d errors:":                                 "Download mit %d Fehlern fehlgeschlagen:",
+	"Partial download kept; resume with: datablip partials resume %s": "Teildownload behalten; fortsetzen mit: datablip partials resume %s",
+	"download interrupted":                                            "Download unterbrochen",
+
+	// CLI batch mode
+	"Files: %d/%d": "Dateien: %d/%d",
+	"%.1f files/s": "%.1f Dateien/s",
+	"✓ Downloaded %d files (%s) in %v, %.1f files/s": "✓ %d Dateien (%s) in %v geladen, %.1f Dateien/s",
+	"Skipped %d files that already exist":            "%d bereits vorhandene Dateien übersprungen",
+	"✗ %d files failed":                              "✗ %d Dateien fehlgeschlagen",
+	"batch interrupted":                              "Stapel unterbrochen",
+
+	// CLI clipboard watching
+	"Watching the clipboard for URLs; press Ctrl+C to stop": "Beobachte die Zwischenablage auf URLs; Strg+C beendet",
+	"too many URLs waiting":                                 "zu viele wartende URLs",
+	"✓ Saved %s (%s) in %v":                                 "✓ %s (%s) in %v gespeichert",
+	"✓ Added %s to the server as %s":                        "✓ %s dem Server als %s hinzugefügt",
+
+	// CLI bench
+	"✗ The server doesn't support range requests, so only one connection can be used": "✗ Der Server unterstützt keine Bereichsanfragen, daher ist nur eine Verbindung möglich",
+	"File size: %s, round trip %v": "Dateigröße: %s, Umlaufzeit %v",
+	"Connections":                  "Verbindungen",
+	"Per connection":               "Pro Verbindung",
+	"Downloads":                    "Downloads",
+	"Last":                         "Zuletzt",
+	"benchmark interrupted":        "Messung unterbrochen",
+	"(too little data to record)":  "(zu wenig Daten zum Speichern)",
+	"Nothing recorded for %s":      "Für %s ist nichts gespeichert",
+	"Nothing recorded yet; finished downloads and datablip bench add to the history": "Noch nichts gespeichert; abgeschlossene Downloads und datablip bench füllen den Verlauf",
+	"✓ %s is fastest with a single connection":                                       "✓ %s ist mit einer einzigen Verbindung am schnellsten",
+	"✓ %s saturates at %d connections":                                               "✓ %s ist ab %d Verbindungen ausgelastet",
+	"%s: nothing measured yet":                                                       "%s: noch nichts gemessen",
+	"%s: only measured with %d connections":                                          "%s: nur mit %d Verbindungen gemessen",
+	"%s: still faster with more connections, measured up to %d":                      "%s: mit mehr Verbindungen noch schneller, gemessen bis %d",
+	"Using %d connections, where %s saturates":                                       "Verwende %d Verbindungen, ab denen %s ausgelastet ist",
+
+	// API errors
+	"Download not found":                                      "Download nicht gefunden",
+	"download not found":                                      "Download nicht gefunden",
+	"Downloaded file not found":                               "Heruntergeladene Datei nicht gefunden",
+	"File not found":                                          "Datei nicht gefunden",
+	"Thumbnail not found":                                     "Vorschaubild nicht gefunden",
+	"Error opening file":                                      "Fehler beim Öffnen der Datei",
+	"Download not available yet: %v":                          "Download noch nicht verfügbar: %v",
+	"Changing files requires the files token":                 "Zum Ändern von Dateien ist das Datei-Token nötig",
+	"Deleting files requires the files token":                 "Zum Löschen von Dateien ist das Datei-Token nötig",
+	"Invalid token":                                           "Ungültiges Token",
+	"url must be an http, https, ftp, ftps, s3, gs or az URL": "url muss eine http-, https-, ftp-, ftps-, s3-, gs- oder az-URL sein",
+	"url is required":                                         "url ist erforderlich",
+	"job not found":                                           "Auftrag nicht gefunden",
+	"feed not found":                                          "Feed nicht gefunden",
+	"archive not found":                                       "Archiv nicht gefunden",
+	"no downloads to pack":                                    "keine Downloads zum Packen",
+	"maxWorkers must be a positive integer":                   "maxWorkers muss eine positive ganze Zahl sein",
+	"Telemetry is not set up":                                 "Telemetrie ist nicht eingerichtet",
+	"authentication required":                                 "Anmeldung erforderlich",
+	"invalid credentials":                                     "Ungültige Anmeldedaten",
+	"logins are not enabled":                                  "Anmeldungen sind nicht aktiviert",
+	"wrong password":                                          "Falsches Passwort",
+	"key not found":                                           "Schlüssel nicht gefunden",
+	"name is required":                                        "name ist erforderlich",
+	"API keys are not set up":                                 "API-Schlüssel sind nicht eingerichtet",
+	"the server is shutting down":                             "Der Server wird heruntergefahren",
+	"defaultChunks must be at least 0, 0 to pick a count per download": "defaultChunks muss mindestens 0 sein, 0 wählt die Anzahl je Download",
+	"connectTimeout must be a duration such as \"30s\", up to 5m":      "connectTimeout muss eine Dauer wie \"30s\" sein, höchstens 5m",
+	"readTimeout must be a duration such as \"10m\"":                   "readTimeout muss eine Dauer wie \"10m\" sein",
+	"downloadsDir must not be empty":                                   "downloadsDir darf nicht leer sein",
+	"filenameTemplate must be a path inside the downloads directory using {host}, {basename}, {date}, {time}, {datetime}, {unix}, {id}, {run}, {type} and {subtype}": "filenameTemplate muss ein Pfad innerhalb des Download-Verzeichnisses sein, mit {host}, {basename}, {date}, {time}, {datetime}, {unix}, {id}, {run}, {type} und {subtype}",
+
+	"category not found": "Kategorie nicht gefunden",
+	"category name must be letters, digits, '.', '_' and '-', starting with a letter or digit": "Der Kategoriename darf nur Buchstaben, Ziffern, '.', '_' und '-' enthalten und muss mit einem Buchstaben oder einer Ziffer beginnen",
+	"category dir must be an absolute path or one inside the downloads directory":              "Das Kategorieverzeichnis muss ein absoluter Pfad oder einer innerhalb des Download-Verzeichnisses sein",
+	"category chunks must be at least 0, 0 for the server's default":                           "Die Chunks der Kategorie müssen mindestens 0 sein, 0 für die Vorgabe des Servers",
+
+	"dir must be inside the downloads directory, or one of -allowed-dirs if absolute": "dir muss innerhalb des Download-Verzeichnisses liegen, oder als absoluter Pfad in einem der -allowed-dirs",
+	"filename must be a path inside the download's directory":                         "filename muss ein Pfad innerhalb des Verzeichnisses des Downloads sein",
+	"days must be a number from 1 to 366":                                             "days muss eine Zahl von 1 bis 366 sein",
+
+	"origin not allowed": "Herkunft nicht erlaubt",
+}
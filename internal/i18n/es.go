@@ -0,0 +1,136 @@
+package i18n
+
+var spanish = map[string]string{
+	// CLI progress display
+	"Overall Progress:":  "Progreso total:",
+	"Individual Chunks:": "Fragmentos:",
+	"Chunk":              "Fragm.",
+	"Status":             "Estado",
+	"Progress":           "Progreso",
+	"Downloaded":         "Descargado",
+	"Speed":              "Velocidad",
+	"Restarts":           "Reinicios",
+	"ETA":                "Resta",
+	"waiting":            "esperando",
+	"downloading":        "descargando",
+	"reconnecting":       "reconectando",
+	"paused":             "en pausa",
+	"completed":          "completado",
+	"failed":             "fallido",
+	"running":            "en curso",
+	"none":               "ninguno",
+	"Status Summary: ":   "Resumen: ",
+	"Waiting: %d":        "Esperando: %d",
+	"Downloading: %d":    "Descargando: %d",
+	"Reconnecting: %d":   "Reconectando: %d",
+	"Paused: %d":         "En pausa: %d",
+	"Completed: %d":      "Completados: %d",
+	"Failed: %d":         "Fallidos: %d",
+	"%s, limit %s | p pause, r resume, +/- speed limit, q quit and keep for later": "%s, límite %s | p pausar, r reanudar, +/- límite de velocidad, q salir y guardar para después",
+	"Merge:": "Unión:",
+
+	// CLI messages
+	"Downloading: %s":                            "Descargando: %s",
+	"Resuming: %s":                               "Reanudando: %s",
+	"Output: %s":                                 "Destino: %s",
+	"Chunks: %d":                                 "Fragmentos: %d",
+	"Chunks: auto":                               "Fragmentos: automático",
+	"Chunk size: %s (%d connections)":            "Tamaño de fragmento: %s (%d conexiones)",
+	"Chunk size: %s (connections: auto)":         "Tamaño de fragmento: %s (conexiones: automático)",
+	"Timeouts - Connect: %v, Read per chunk: %v": "Tiempos límite - Conexión: %v, Lectura por fragmento: %v",
+	"Speed limit: %s":                            "Límite de velocidad: %s",
+	"File size: %d bytes (%.2f MB)":              "Tamaño del archivo: %d bytes (%.2f MB)",
+	"Auto-selected %d chunks (round trip %v, ranges supported: %v)":   "%d fragmentos elegidos automáticamente (ida y vuelta %v, rangos admitidos: %v)",
+	"Created %d chunks for concurrent download (%d connections)":      "%d fragmentos creados para descarga simultánea (%d conexiones)",
+	"Spreading chunks across %d mirrors":                              "Repartiendo los fragmentos entre %d réplicas",
+	"Saving as %s":                                                    "Guardando como %s",
+	"Overwriting %s once the download is verified":                    "Se sobrescribirá %s cuando se verifique la descarga",
+	"Resuming from the %s already in %s":                              "Reanudando desde los %s que ya hay en %s",
+	"%s already exists; saving as %s":                                 "%s ya existe; guardando como %s",
+	"Dropped mirror %s for being too slow":                            "Réplica %s descartada por ser demasiado lenta",
+	"Dropped mirror %s after repeated failures":                       "Réplica %s descartada tras fallos repetidos",
+	"Starting concurrent download of %d chunks...":                    "Iniciando la descarga simultánea de %d fragmentos...",
+	"✓ All %d chunks downloaded successfully":                         "✓ Los %d fragmentos se descargaron correctamente",
+	"🎉 Download completed successfully: %s":                           "🎉 Descarga completada correctamente: %s",
+	"Total time: %v, Average speed: %s":                               "Tiempo total: %v, Velocidad media: %s",
+	"Download failed: %v":                                             "La descarga falló: %v",
+	"Download failed with %d errors:":                                 "La descarga falló con %d errores:",
+	"Partial download kept; resume with: datablip partials resume %s": "Descarga parcial guardada; reanúdela con: datablip partials resume %s",
+	"download interrupted":                                            "descarga interrumpida",
+
+	// CLI batch mode
+	"Files: %d/%d": "Archivos: %d/%d",
+	"%.1f files/s": "%.1f archivos/s",
+	"✓ Downloaded %d files (%s) in %v, %.1f files/s": "✓ Descargados %d archivos (%s) en %v, %.1f archivos/s",
+	"Skipped %d files that already exist":            "Omitidos %d archivos que ya existen",
+	"✗ %d files failed":                              "✗ %d archivos fallidos",
+	"batch interrupted":                              "lote interrumpido",
+
+	// CLI clipboard watching
+	"Watching the clipboard for URLs; press Ctrl+C to stop": "Vigilando el portapapeles en busca de URL; pulsa Ctrl+C para parar",
+	"too many URLs waiting":                                 "demasiadas URL en espera",
+	"✓ Saved %s (%s) in %v":                                 "✓ %s (%s) guardado en %v",
+	"✓ Added %s to the server as %s":                        "✓ %s añadido al servidor como %s",
+
+	// CLI bench
+	"✗ The server doesn't support range requests, so only one connection can be used": "✗ El servidor no admite solicitudes de rango, así que solo se puede usar una conexión",
+	"File size: %s, round trip %v": "Tamaño del archivo: %s, ida y vuelta %v",
+	"Connections":                  "Conexiones",
+	"Per connection":               "Por conexión",
+	"Downloads":                    "Descargas",
+	"Last":                         "Última",
+	"benchmark interrupted":        "medición interrumpida",
+	"(too little data to record)":  "(muy pocos datos para registrar)",
+	"Nothing recorded for %s":      "No hay nada registrado para %s",
+	"Nothing recorded yet; finished downloads and datablip bench add to the history": "Aún no hay nada registrado; las descargas terminadas y datablip bench añaden al historial",
+	"✓ %s is fastest with a single connection":                                       "✓ %s es más rápido con una sola conexión",
+	"✓ %s saturates at %d connections":                                               "✓ %s se satura con %d conexiones",
+	"%s: nothing measured yet":                                                       "%s: aún no se ha medido nada",
+	"%s: only measured with %d connections":                                          "%s: solo medido con %d conexiones",
+	"%s: still faster with more connections, measured up to %d":                      "%s: aún más rápido con más conexiones, medido hasta %d",
+	"Using %d connections, where %s saturates":                                       "Usando %d conexiones, con las que %s se satura",
+
+	// API errors
+	"Download not found":                                      "Descarga no encontrada",
+	"download not found":                                      "descarga no encontrada",
+	"Downloaded file not found":                               "Archivo descargado no encontrado",
+	"File not found":                                          "Archivo no encontrado",
+	"Thumbnail not found":                                     "Miniatura no encontrada",
+	"Error opening file":                                      "Error al abrir el archivo",
+	"Download not available yet: %v":                          "La descarga aún no está disponible: %v",
+	"Changing files requires the files token":                 "Modificar archivos requiere el token de archivos",
+	"Deleting files requires the files token":                 "Eliminar archivos requiere el token de archivos",
+	"Invalid token":                                           "Token no válido",
+	"url must be an http, https, ftp, ftps, s3, gs or az URL": "url debe ser una URL http, https, ftp, ftps, s3, gs o az",
+	"url is required":                                         "url es obligatoria",
+	"job not found":                                           "tarea no encontrada",
+	"feed not found":                                          "feed no encontrado",
+	"archive not found":                                       "archivo comprimido no encontrado",
+	"no downloads to pack":                                    "no hay descargas que empaquetar",
+	"maxWorkers must be a positive integer":                   "maxWorkers debe ser un entero positivo",
+	"Telemetry is not set up":                                 "La telemetría no está configurada",
+	"authentication required":                                 "Se requiere autenticación",
+	"invalid credentials":                                     "Credenciales no válidas",
+	"logins are not enabled":                                  "Los inicios de sesión no están habilitados",
+	"wrong password":                                          "Contraseña incorrecta",
+	"key not found":                                           "Clave no encontrada",
+	"name is required":                                        "name es obligatorio",
+	"API keys are not set up":                                 "Las claves de API no están configuradas",
+	"the server is shutting down":                             "El servidor se está apagando",
+	"defaultChunks must be at least 0, 0 to pick a count per download": "defaultChunks debe ser al menos 0; 0 elige el número para cada descarga",
+	"connectTimeout must be a duration such as \"30s\", up to 5m":      "connectTimeout debe ser una duración como \"30s\", de hasta 5m",
+	"readTimeout must be a duration such as \"10m\"":                   "readTimeout debe ser una duración como \"10m\"",
+	"downloadsDir must not be empty":                                   "downloadsDir no puede estar vacío",
+	"filenameTemplate must be a path inside the downloads directory using {host}, {basename}, {date}, {time}, {datetime}, {unix}, {id}, {run}, {type} and {subtype}": "filenameTemplate debe ser una ruta dentro del directorio de descargas que use {host}, {basename}, {date}, {time}, {datetime}, {unix}, {id}, {run}, {type} y {subtype}",
+
+	"category not found": "categoría no encontrada",
+	"category name must be letters, digits, '.', '_' and '-', starting with a letter or digit": "el nombre de la categoría solo puede tener letras, dígitos, '.', '_' y '-', y debe empezar por una letra o un dígito",
+	"category dir must be an absolute path or one inside the downloads directory":              "el directorio de la categoría debe ser una ruta absoluta o una dentro del directorio de descargas",
+	"category chunks must be at least 0, 0 for the server's default":                           "los fragmentos de la categoría deben ser al menos 0, 0 para el valor del servidor",
+
+	"dir must be inside the downloads directory, or one of -allowed-dirs if absolute": "dir debe estar dentro del directorio de descargas, o en uno de -allowed-dirs si es absoluto",
+	"filename must be a path inside the download's directory":                         "filename debe ser una ruta dentro del directorio de la descarga",
+	"days must be a number from 1 to 366":                                             "days debe ser un número del 1 al 366",
+
+	"origin not allowed": "origen no permitido",
+}
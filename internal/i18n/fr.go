@@ -0,0 +1,136 @@
+package i18n
+
+var french = map[string]string{
+	// CLI progress display
+	"Overall Progress:":  "Progression globale :",
+	"Individual Chunks:": "Segments :",
+	"Chunk":              "Segment",
+	"Status":             "État",
+	"Progress":           "Progression",
+	"Downloaded":         "Téléchargé",
+	"Speed":              "Débit",
+	"Restarts":           "Reprises",
+	"ETA":                "Reste",
+	"waiting":            "en attente",
+	"downloading":        "en cours",
+	"reconnecting":       "reconnexion",
+	"paused":             "en pause",
+	"completed":          "terminé",
+	"failed":             "échoué",
+	"running":            "en cours",
+	"none":               "aucune",
+	"Status Summary: ":   "Résumé : ",
+	"Waiting: %d":        "En attente : %d",
+	"Downloading: %d":    "En cours : %d",
+	"Reconnecting: %d":   "Reconnexion : %d",
+	"Paused: %d":         "En pause : %d",
+	"Completed: %d":      "Terminés : %d",
+	"Failed: %d":         "Échoués : %d",
+	"%s, limit %s | p pause, r resume, +/- speed limit, q quit and keep for later": "%s, limite %s | p pause, r reprise, +/- limite de débit, q quitter et garder pour plus tard",
+	"Merge:": "Fusion :",
+
+	// CLI messages
+	"Downloading: %s":                            "Téléchargement : %s",
+	"Resuming: %s":                               "Reprise : %s",
+	"Output: %s":                                 "Destination : %s",
+	"Chunks: %d":                                 "Segments : %d",
+	"Chunks: auto":                               "Segments : automatique",
+	"Chunk size: %s (%d connections)":            "Taille des segments : %s (%d connexions)",
+	"Chunk size: %s (connections: auto)":         "Taille des segments : %s (connexions : automatique)",
+	"Timeouts - Connect: %v, Read per chunk: %v": "Délais - Connexion : %v, Lecture par segment : %v",
+	"Speed limit: %s":                            "Limite de débit : %s",
+	"File size: %d bytes (%.2f MB)":              "Taille du fichier : %d octets (%.2f Mo)",
+	"Auto-selected %d chunks (round trip %v, ranges supported: %v)":   "%d segments choisis automatiquement (aller-retour %v, plages prises en charge : %v)",
+	"Created %d chunks for concurrent download (%d connections)":      "%d segments créés pour le téléchargement parallèle (%d connexions)",
+	"Spreading chunks across %d mirrors":                              "Répartition des segments sur %d miroirs",
+	"Saving as %s":                                                    "Enregistrement sous %s",
+	"Overwriting %s once the download is verified":                    "%s sera écrasé une fois le téléchargement vérifié",
+	"Resuming from the %s already in %s":                              "Reprise à partir des %s déjà présents dans %s",
+	"%s already exists; saving as %s":                                 "%s existe déjà ; enregistrement sous %s",
+	"Dropped mirror %s for being too slow":                            "Miroir %s abandonné car trop lent",
+	"Dropped mirror %s after repeated failures":                       "Miroir %s abandonné après des échecs répétés",
+	"Starting concurrent download of %d chunks...":                    "Début du téléchargement parallèle de %d segments...",
+	"✓ All %d chunks downloaded successfully":                         "✓ Les %d segments ont été téléchargés",
+	"🎉 Download completed successfully: %s":                           "🎉 Téléchargement terminé : %s",
+	"Total time: %v, Average speed: %s":                               "Durée totale : %v, Débit moyen : %s",
+	"Download failed: %v":                                             "Échec du téléchargement : %v",
+	"Download failed with %d errors:":                                 "Échec du téléchargement avec %d erreurs :",
+	"Partial download kept; resume with: datablip partials resume %s": "Téléchargement partiel conservé ; reprenez-le avec : datablip partials resume %s",
+	"download interrupted":                                            "téléchargement interrompu",
+
+	// CLI batch mode
+	"Files: %d/%d": "Fichiers : %d/%d",
+	"%.1f files/s": "%.1f fichiers/s",
+	"✓ Downloaded %d files (%s) in %v, %.1f files/s": "✓ %d fichiers téléchargés (%s) en %v, %.1f fichiers/s",
+	"Skipped %d files that already exist":            "%d fichiers déjà présents ignorés",
+	"✗ %d files failed":                              "✗ %d fichiers en échec",
+	"batch interrupted":                              "lot interrompu",
+
+	// CLI clipboard watching
+	"Watching the clipboard for URLs; press Ctrl+C to stop": "Surveillance du presse-papiers ; Ctrl+C pour arrêter",
+	"too many URLs waiting":                                 "trop d'URL en attente",
+	"✓ Saved %s (%s) in %v":                                 "✓ %s (%s) enregistré en %v",
+	"✓ Added %s to the server as %s":                        "✓ %s ajouté au serveur sous %s",
+
+	// CLI bench
+	"✗ The server doesn't support range requests, so only one connection can be used": "✗ Le serveur ne prend pas en charge les requêtes de plage, une seule connexion est donc possible",
+	"File size: %s, round trip %v": "Taille du fichier : %s, aller-retour %v",
+	"Connections":                  "Connexions",
+	"Per connection":               "Par connexion",
+	"Downloads":                    "Téléchargements",
+	"Last":                         "Dernier",
+	"benchmark interrupted":        "mesure interrompue",
+	"(too little data to record)":  "(trop peu de données à enregistrer)",
+	"Nothing recorded for %s":      "Rien d'enregistré pour %s",
+	"Nothing recorded yet; finished downloads and datablip bench add to the history": "Rien d'enregistré pour l'instant ; les téléchargements terminés et datablip bench alimentent l'historique",
+	"✓ %s is fastest with a single connection":                                       "✓ %s est le plus rapide avec une seule connexion",
+	"✓ %s saturates at %d connections":                                               "✓ %s sature à %d connexions",
+	"%s: nothing measured yet":                                                       "%s : rien de mesuré pour l'instant",
+	"%s: only measured with %d connections":                                          "%s : mesuré uniquement avec %d connexions",
+	"%s: still faster with more connections, measured up to %d":                      "%s : encore plus rapide avec plus de connexions, mesuré jusqu'à %d",
+	"Using %d connections, where %s saturates":                                       "Utilisation de %d connexions, où %s sature",
+
+	// API errors
+	"Download not found":                                      "Téléchargement introuvable",
+	"download not found":                                      "téléchargement introuvable",
+	"Downloaded file not found":                               "Fichier téléchargé introuvable",
+	"File not found":                                          "Fichier introuvable",
+	"Thumbnail not found":                                     "Miniature introuvable",
+	"Error opening file":                                      "Erreur à l'ouverture du fichier",
+	"Download not available yet: %v":                          "Téléchargement pas encore disponible : %v",
+	"Changing files requires the files token":                 "Modifier des fichiers nécessite le jeton des fichiers",
+	"Deleting files requires the files token":                 "Supprimer des fichiers nécessite le jeton des fichiers",
+	"Invalid token":                                           "Jeton non valide",
+	"url must be an http, https, ftp, ftps, s3, gs or az URL": "url doit être une URL http, https, ftp, ftps, s3, gs ou az",
+	"url is required":                                         "url est obligatoire",
+	"job not found":                                           "tâche introuvable",
+	"feed not found":                                          "flux introuvable",
+	"archive not found":                                       "archive introuvable",
+	"no downloads to pack":                                    "aucun téléchargement à empaqueter",
+	"maxWorkers must be a positive integer":                   "maxWorkers doit être un entier positif",
+	"Telemetry is not set up":                                 "La télémétrie n'est pas configurée",
+	"authentication required":                                 "Authentification requise",
+	"invalid credentials":                                     "Identifiants non valides",
+	"logins are not enabled":                                  "Les connexions ne sont pas activées",
+	"wrong password":                                          "Mot de passe incorrect",
+	"key not found":                                           "Clé introuvable",
+	"name is required":                                        "name est obligatoire",
+	"API keys are not set up":                                 "Les clés d'API ne sont pas configurées",
+	"the server is shutting down":                             "Le serveur est en cours d'arrêt",
+	"defaultChunks must be at least 0, 0 to pick a count per download": "defaultChunks doit être au moins 0 ; 0 choisit le nombre pour chaque téléchargement",
+	"connectTimeout must be a duration such as \"30s\", up to 5m":      "connectTimeout doit être une durée comme \"30s\", jusqu'à 5m",
+	"readTimeout must be a duration such as \"10m\"":                   "readTimeout doit être une durée comme \"10m\"",
+	"downloadsDir must not be empty":                                   "downloadsDir ne doit pas être vide",
+	"filenameTemplate must be a path inside the downloads directory using {host}, {basename}, {date}, {time}, {datetime}, {unix}, {id}, {run}, {type} and {subtype}": "filenameTemplate doit être un chemin dans le dossier des téléchargements utilisant {host}, {basename}, {date}, {time}, {datetime}, {unix}, {id}, {run}, {type} et {subtype}",
+
+	"category not found": "catégorie introuvable",
+	"category name must be letters, digits, '.', '_' and '-', starting with a letter or digit": "le nom de la catégorie ne peut contenir que des lettres, des chiffres, '.', '_' et '-', et doit commencer par une lettre ou un chiffre",
+	"category dir must be an absolute path or one inside the downloads directory":              "le dossier de la catégorie doit être un chemin absolu ou un chemin dans le dossier des téléchargements",
+	"category chunks must be at least 0, 0 for the server's default":                           "les segments de la catégorie doivent être au moins 0, 0 pour la valeur du serveur",
+
+	"dir must be inside the downloads directory, or one of -allowed-dirs if absolute": "dir doit se trouver dans le dossier des téléchargements, ou dans l'un des -allowed-dirs s'il est absolu",
+	"filename must be a path inside the download's directory":                         "filename doit être un chemin dans le dossier du téléchargement",
+	"days must be a number from 1 to 366":                                             "days doit être un nombre de 1 à 366",
+
+	"origin not allowed": "origine non autorisée",
+}
@@ -0,0 +1,123 @@
+// Package i18n translates the messages shown to users of the CLI and the
+// API. Messages are looked up by their English text, so the code still
+// reads naturally and anything without a translation stays in English.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// English is the language messages are written in.
+const English = "en"
+
+// catalogs maps each language to its translations of English messages.
+var catalogs = map[string]map[string]string{
+	"de": german,
+	"es": spanish,
+	"fr": french,
+}
+
+// Languages lists the supported languages, English first.
+func Languages() []string {
+	langs := []string{English}
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs[1:])
+	return langs
+}
+
+// Supported reports whether messages can be shown in lang.
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok || lang == English
+}
+
+// Printer formats messages in one language.
+type Printer struct {
+	lang     string
+	messages map[string]string
+}
+
+// New returns a printer for lang, such as "de" or "de_DE.UTF-8". Languages
+// without a catalog get English.
+func New(lang string) *Printer {
+	lang = base(lang)
+	if messages, ok := catalogs[lang]; ok {
+		return &Printer{lang: lang, messages: messages}
+	}
+	return &Printer{lang: English}
+}
+
+// Lang returns the language the printer writes in.
+func (p *Printer) Lang() string {
+	return p.lang
+}
+
+// Text translates message.
+func (p *Printer) Text(message string) string {
+	if translated, ok := p.messages[message]; ok {
+		return translated
+	}
+	return message
+}
+
+// Sprintf translates format, then formats it like fmt.Sprintf.
+func (p *Printer) Sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(p.Text(format), args...)
+}
+
+// Error translates the error's message if it is one of the catalog's, as
+// fixed messages such as "download not found" are.
+func (p *Printer) Error(err error) string {
+	return p.Text(err.Error())
+}
+
+// base reduces a language tag or locale name to its language: "pt-BR" and
+// "pt_BR.UTF-8" are "pt".
+func base(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_.@"); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
+
+// FromEnv returns the language of the user's locale, from $LC_ALL,
+// $LC_MESSAGES or $LANG, or English.
+func FromEnv() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			if lang := base(value); lang != "c" && lang != "posix" {
+				return lang
+			}
+			return English
+		}
+	}
+	return English
+}
+
+// Match picks the supported language the client prefers most from an
+// Accept-Language header such as "fr-CH, fr;q=0.9, en;q=0.8", or English.
+func Match(acceptLanguage string) string {
+	best, bestQ := English, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if lang := base(tag); q > bestQ && Supported(lang) {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
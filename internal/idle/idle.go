@@ -0,0 +1,103 @@
+// Package idle cancels transfers that stop receiving data. Unlike read
+// deadlines it works on any io.Reader, because it cancels the request's
+// context, which makes net/http abort the body read in progress.
+package idle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// TimeoutError is the cancellation cause of a context whose watchdog fired.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("read timeout after %v of inactivity", e.Timeout)
+}
+
+// Watchdog cancels its context when Touch is not called for the timeout.
+type Watchdog struct {
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelCauseFunc
+	mu      sync.Mutex
+	stopped bool
+}
+
+// WithTimeout returns a child of parent that is cancelled with a
+// *TimeoutError once timeout passes without activity. A zero timeout never
+// fires. Call Stop to release the timer.
+func WithTimeout(parent context.Context, timeout time.Duration) (context.Context, *Watchdog) {
+	ctx, cancel := context.WithCancelCause(parent)
+	w := &Watchdog{timeout: timeout, cancel: cancel}
+	if timeout > 0 {
+		w.timer = time.AfterFunc(timeout, func() {
+			cancel(&TimeoutError{Timeout: timeout})
+		})
+	}
+	return ctx, w
+}
+
+// Touch records activity and restarts the countdown.
+func (w *Watchdog) Touch() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil && !w.stopped {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+// Pause suspends the countdown until the next Touch, for deliberate waits
+// such as a user pause.
+func (w *Watchdog) Pause() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+// Stop releases the timer and cancels the context.
+func (w *Watchdog) Stop() {
+	w.mu.Lock()
+	w.stopped = true
+	w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.cancel(context.Canceled)
+}
+
+// Reader wraps r so every read that returns data counts as activity.
+func (w *Watchdog) Reader(r io.Reader) io.Reader {
+	return &reader{r: r, w: w}
+}
+
+type reader struct {
+	r io.Reader
+	w *Watchdog
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.w.Touch()
+	}
+	return n, err
+}
+
+// Cause returns the reason ctx was cancelled, such as the watchdog's
+// timeout error or a cause given to a parent's CancelCauseFunc, or err
+// unchanged if ctx ended without one. Use it to replace the opaque "context
+// canceled" read error with the real reason.
+func Cause(ctx context.Context, err error) error {
+	cause := context.Cause(ctx)
+	if cause == nil || errors.Is(cause, context.Canceled) || errors.Is(cause, context.DeadlineExceeded) {
+		return err
+	}
+	return cause
+}
@@ -0,0 +1,159 @@
+// Package media describes audio, video and image files with ffprobe and
+// renders thumbnails of them with ffmpeg, when those tools are installed.
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The ffprobe and ffmpeg executables, looked up on PATH by default.
+var (
+	FFprobeCommand = "ffprobe"
+	FFmpegCommand  = "ffmpeg"
+)
+
+// ThumbnailWidth is the width thumbnails are scaled to, keeping the aspect
+// ratio.
+const ThumbnailWidth = 320
+
+// extensions are the file types worth handing to ffprobe.
+var extensions = map[string]bool{
+	".mp4": true, ".m4v": true, ".mkv": true, ".webm": true, ".mov": true,
+	".avi": true, ".wmv": true, ".flv": true, ".mpg": true, ".mpeg": true,
+	".ts": true, ".3gp": true, ".ogv": true,
+	".mp3": true, ".m4a": true, ".aac": true, ".flac": true, ".wav": true,
+	".ogg": true, ".opus": true, ".wma": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true,
+	".bmp": true, ".tiff": true,
+}
+
+// Info is what ffprobe reports about a media file.
+type Info struct {
+	Format     string  `json:"format"`             // Container, such as "matroska,webm"
+	Duration   float64 `json:"duration,omitempty"` // Seconds
+	Bitrate    int64   `json:"bitrate,omitempty"`  // Bits per second
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	FrameRate  float64 `json:"frameRate,omitempty"`
+	VideoCodec string  `json:"videoCodec,omitempty"`
+	AudioCodec string  `json:"audioCodec,omitempty"`
+}
+
+// IsMedia reports whether the file name looks like audio, video or an
+// image.
+func IsMedia(name string) bool {
+	return extensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// Available reports whether ffprobe can be run.
+func Available() bool {
+	_, err := exec.LookPath(FFprobeCommand)
+	return err == nil
+}
+
+type probeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType    string `json:"codec_type"`
+		CodecName    string `json:"codec_name"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		Disposition  struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+}
+
+// Probe runs ffprobe on the file at path. Only the first video and audio
+// streams are described.
+func Probe(ctx context.Context, path string) (*Info, error) {
+	out, err := run(ctx, FFprobeCommand, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path)
+	if err != nil {
+		return nil, err
+	}
+	var probe probeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %v", err)
+	}
+
+	info := &Info{Format: probe.Format.FormatName}
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	info.Bitrate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+	for _, s := range probe.Streams {
+		switch s.CodecType {
+		case "video":
+			if info.Width == 0 {
+				info.Width, info.Height = s.Width, s.Height
+			}
+			// Cover art embedded in audio files is not a video
+			if info.VideoCodec == "" && s.Disposition.AttachedPic == 0 {
+				info.VideoCodec = s.CodecName
+				info.FrameRate = parseRate(s.AvgFrameRate)
+			}
+		case "audio":
+			if info.AudioCodec == "" {
+				info.AudioCodec = s.CodecName
+			}
+		}
+	}
+	return info, nil
+}
+
+// Thumbnail renders a JPEG of one frame of the file to dest, taken a tenth
+// of the way in so it skips past title cards and fades from black.
+func Thumbnail(ctx context.Context, path, dest string, info *Info) error {
+	if info.Width == 0 {
+		return fmt.Errorf("no picture to take a thumbnail of")
+	}
+	args := []string{"-v", "error", "-y"}
+	if info.Duration > 0 && info.VideoCodec != "" {
+		args = append(args, "-ss", strconv.FormatFloat(info.Duration/10, 'f', 3, 64))
+	}
+	args = append(args, "-i", path, "-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:-2", ThumbnailWidth), "-f", "image2", dest)
+	_, err := run(ctx, FFmpegCommand, args...)
+	return err
+}
+
+func run(ctx context.Context, command string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %v: %s", command, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %v", command, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseRate turns ffprobe's "30000/1001" frame rates into a number.
+func parseRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
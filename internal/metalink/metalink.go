@@ -0,0 +1,58 @@
+// Package metalink writes Metalink 4 documents (RFC 5854), which describe
+// where a file can be fetched from and how to check it.
+package metalink
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// ContentType is the media type of Metalink 4 documents.
+const ContentType = "application/metalink4+xml"
+
+// Namespace is the XML namespace of Metalink 4.
+const Namespace = "urn:ietf:params:xml:ns:metalink"
+
+// Metalink is a document describing one or more files.
+type Metalink struct {
+	XMLName   xml.Name   `xml:"urn:ietf:params:xml:ns:metalink metalink"`
+	Generator string     `xml:"generator,omitempty"`
+	Published *time.Time `xml:"published,omitempty"`
+	Files     []File     `xml:"file"`
+}
+
+// File is a file and the places it can be fetched from.
+type File struct {
+	Name   string `xml:"name,attr"`
+	Size   int64  `xml:"size,omitempty"`
+	Hashes []Hash `xml:"hash"`
+	URLs   []URL  `xml:"url"`
+}
+
+// Hash is a checksum of the whole file. Type uses the IANA hash function
+// names, such as "sha-256".
+type Hash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"` // Lowercase hex
+}
+
+// URL is a location of the file. Lower priorities are preferred.
+type URL struct {
+	Priority int    `xml:"priority,attr,omitempty"`
+	Location string `xml:",chardata"`
+}
+
+// Write encodes m as an XML document.
+func (m *Metalink) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,206 @@
+// Package mirror spreads the range requests of one download across several
+// servers holding the same file. Each request goes to the healthy mirror
+// with the fewest requests in flight. Mirrors whose requests keep failing,
+// or that stay far slower than the fastest one, are dropped, and the chunks
+// they were serving carry on from the same offset on the others. The last
+// healthy mirror is never dropped.
+package mirror
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxFailures is how many requests in a row may fail on a mirror
+	// before it is dropped.
+	MaxFailures = 3
+
+	// SlowFactor is the fraction of the fastest mirror's speed per
+	// connection below which a mirror counts as slow.
+	SlowFactor = 0.25
+
+	// SlowChecks is how many checks in a row a mirror must be slow for
+	// before it is dropped, so one bad second doesn't cost a mirror.
+	SlowChecks = 10
+)
+
+// ErrDropped is the cancellation cause of a request to a mirror that was
+// dropped. The chunk requests the rest of its range from another mirror.
+var ErrDropped = errors.New("mirror dropped")
+
+// Stats is a mirror's share of a download.
+type Stats struct {
+	URL        string  `json:"url"`
+	Downloaded int64   `json:"downloaded"`
+	Speed      float64 `json:"speed"`             // Bytes/s per connection, as of the last check
+	Dropped    string  `json:"dropped,omitempty"` // Why it is no longer used
+}
+
+type state struct {
+	Stats
+	active   int   // Requests in flight
+	recent   int64 // Bytes since the last check
+	failures int   // Requests in a row that failed
+	slow     int   // Checks in a row spent well behind the fastest mirror
+}
+
+// Set is the mirrors of one download. It is safe for concurrent use.
+type Set struct {
+	mu      sync.Mutex
+	mirrors []*state
+	next    int // Where ties between mirrors are broken from, round robin
+	checked time.Time
+}
+
+// New returns a set of the given URLs, all of which serve the same file.
+func New(urls []string) *Set {
+	s := &Set{checked: time.Now()}
+	for _, url := range urls {
+		s.mirrors = append(s.mirrors, &state{Stats: Stats{URL: url}})
+	}
+	return s
+}
+
+// Pick returns the mirror the next request should go to and counts the
+// request as in flight until Done is called.
+func (s *Set) Pick() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var best *state
+	for i := range s.mirrors {
+		m := s.mirrors[(s.next+i)%len(s.mirrors)]
+		if m.Dropped == "" && (best == nil || m.active < best.active) {
+			best = m
+		}
+	}
+	s.next = (s.next + 1) % len(s.mirrors)
+	best.active++
+	return best.URL
+}
+
+// Count adds n bytes received from url.
+func (s *Set) Count(url string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m := s.find(url); m != nil {
+		m.Downloaded += int64(n)
+		m.recent += int64(n)
+	}
+}
+
+// Done ends a request to url, which failed if failed is set. It reports
+// whether that failure got the mirror dropped.
+func (s *Set) Done(url string, failed bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.find(url)
+	if m == nil {
+		return false
+	}
+	m.active--
+	if !failed {
+		m.failures = 0
+		return false
+	}
+	m.failures++
+	if m.failures < MaxFailures || m.Dropped != "" || s.healthy() < 2 {
+		return false
+	}
+	m.Dropped = "failed"
+	return true
+}
+
+// Check measures each mirror's speed per connection since the last check
+// and drops those that have stayed slow for SlowChecks checks. It returns
+// the URLs it dropped; requests in flight to them should be cancelled with
+// ErrDropped.
+func (s *Set) Check() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	elapsed := now.Sub(s.checked).Seconds()
+	s.checked = now
+	if elapsed <= 0 {
+		return nil
+	}
+
+	// A mirror that has gone idle keeps its last speed, so the one still
+	// crawling through the last chunks is judged against it
+	var fastest float64
+	for _, m := range s.mirrors {
+		if m.active > 0 {
+			m.Speed = float64(m.recent) / elapsed / float64(m.active)
+		}
+		m.recent = 0
+		if m.Dropped == "" {
+			fastest = max(fastest, m.Speed)
+		}
+	}
+
+	var dropped []string
+	for _, m := range s.mirrors {
+		if m.active == 0 || m.Dropped != "" {
+			continue
+		}
+		if m.Speed >= SlowFactor*fastest {
+			m.slow = 0
+			continue
+		}
+		m.slow++
+		if m.slow >= SlowChecks && s.healthy() > 1 {
+			m.Dropped = "slow"
+			dropped = append(dropped, m.URL)
+		}
+	}
+	return dropped
+}
+
+// Stats returns the state of every mirror, in the order they were given.
+func (s *Set) Stats() []Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make([]Stats, len(s.mirrors))
+	for i, m := range s.mirrors {
+		stats[i] = m.Stats
+	}
+	return stats
+}
+
+// find returns the mirror with the given URL. The caller must hold s.mu.
+func (s *Set) find(url string) *state {
+	for _, m := range s.mirrors {
+		if m.URL == url {
+			return m
+		}
+	}
+	return nil
+}
+
+// healthy returns the number of mirrors not dropped. The caller must hold
+// s.mu.
+func (s *Set) healthy() int {
+	n := 0
+	for _, m := range s.mirrors {
+		if m.Dropped == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// FileSize returns the size of the whole file given in the Content-Range of
+// a partial response, so a mirror holding a different file can be told
+// apart.
+func FileSize(resp *http.Response) (int64, bool) {
+	_, total, found := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	if !found {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	return size, err == nil
+}
@@ -0,0 +1,18 @@
+// Package mmap maps a preallocated output file into memory so chunk
+// goroutines can copy received data straight into the mapped pages.
+package mmap
+
+import "errors"
+
+// ErrUnsupported is returned by Map on platforms without an implementation.
+var ErrUnsupported = errors.New("memory-mapped output is not supported on this platform")
+
+// Region is a writable shared mapping of a file.
+type Region struct {
+	data []byte
+}
+
+// Bytes returns the mapped memory. Writes go directly to the file's pages.
+func (r *Region) Bytes() []byte {
+	return r.data
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || openbsd)
+
+package mmap
+
+import "os"
+
+// Map always fails on this platform; callers fall back to WriteAt.
+func Map(file *os.File, size int64) (*Region, error) {
+	return nil, ErrUnsupported
+}
+
+func (r *Region) Close() error {
+	return nil
+}
@@ -0,0 +1,38 @@
+//go:build linux || darwin || freebsd || openbsd
+
+package mmap
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Map maps the first size bytes of file, which must already be at least that
+// large, for shared read/write access.
+func Map(file *os.File, size int64) (*Region, error) {
+	if size <= 0 || size > math.MaxInt {
+		return nil, fmt.Errorf("cannot map %d bytes", size)
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("mmap failed: %w", err)
+	}
+	return &Region{data: data}, nil
+}
+
+// Close flushes dirty pages to the file and unmaps the region.
+func (r *Region) Close() error {
+	if r.data == nil {
+		return nil
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&r.data[0])), uintptr(len(r.data)), syscall.MS_SYNC)
+	unmapErr := syscall.Munmap(r.data)
+	r.data = nil
+	if errno != 0 {
+		return fmt.Errorf("msync failed: %w", errno)
+	}
+	return unmapErr
+}
@@ -0,0 +1,111 @@
+// Package nametemplate renders filename templates such as
+// "{date}/{host}/{basename}", so downloads can be sorted into folders by
+// where and when they came from. Each path segment of the result is made
+// safe with savename.Sanitize, so a value from the server can't reach
+// outside the directory the template is rendered in.
+package nametemplate
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/savename"
+)
+
+// Vars are what a template's variables are replaced with.
+type Vars struct {
+	URL         *url.URL  // Where the file was fetched from, after redirects
+	Basename    string    // The name the file would be saved under without a template
+	ID          string    // The download's ID, if it has one
+	ContentType string    // As the server sent it
+	Time        time.Time // When the download started
+	Run         int       // The job run the download is for, if any
+}
+
+// variables are the ones a template may use.
+var variables = map[string]func(v Vars) string{
+	"{host}": func(v Vars) string {
+		if v.URL == nil {
+			return ""
+		}
+		return v.URL.Hostname()
+	},
+	"{basename}": func(v Vars) string { return v.Basename },
+	"{date}":     func(v Vars) string { return v.Time.Format("2006-01-02") },
+	"{time}":     func(v Vars) string { return v.Time.Format("150405") },
+	"{datetime}": func(v Vars) string { return v.Time.Format("20060102-150405") },
+	"{unix}":     func(v Vars) string { return strconv.FormatInt(v.Time.Unix(), 10) },
+	"{id}":       func(v Vars) string { return v.ID },
+	"{run}": func(v Vars) string {
+		if v.Run == 0 {
+			return ""
+		}
+		return strconv.Itoa(v.Run)
+	},
+	"{type}":    func(v Vars) string { typ, _ := mediaType(v.ContentType); return typ },
+	"{subtype}": func(v Vars) string { _, sub := mediaType(v.ContentType); return sub },
+}
+
+// Names lists the variables, for messages.
+const Names = "{host}, {basename}, {date}, {time}, {datetime}, {unix}, {id}, {run}, {type} and {subtype}"
+
+var variable = regexp.MustCompile(`\{[a-z]+\}`)
+
+// IsTemplate reports whether s holds any variable, known or not.
+func IsTemplate(s string) bool {
+	return variable.MatchString(s)
+}
+
+// Validate reports a variable the template uses that doesn't exist.
+func Validate(template string) error {
+	for _, name := range variable.FindAllString(template, -1) {
+		if variables[name] == nil {
+			return fmt.Errorf("unknown variable %s in filename template; use %s", name, Names)
+		}
+	}
+	return nil
+}
+
+// Render replaces the template's variables with v's values and returns the
+// resulting path, slash separated. Segments left empty are dropped, and a
+// template that renders to nothing gives v.Basename. A leading slash is
+// kept, so an absolute template stays absolute.
+func Render(template string, v Vars) string {
+	rendered := variable.ReplaceAllStringFunc(template, func(name string) string {
+		if value := variables[name]; value != nil {
+			return strings.ReplaceAll(value(v), "/", "_")
+		}
+		return name
+	})
+	var segments []string
+	for _, segment := range strings.Split(strings.ReplaceAll(rendered, `\`, "/"), "/") {
+		if segment = savename.Sanitize(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		return v.Basename
+	}
+	result := path.Join(segments...)
+	if strings.HasPrefix(template, "/") {
+		result = "/" + result
+	}
+	return result
+}
+
+// mediaType splits a Content-Type such as "video/mp4" into its type and
+// subtype, or returns "unknown" for both without one.
+func mediaType(contentType string) (string, string) {
+	media, _, err := mime.ParseMediaType(contentType)
+	typ, sub, ok := strings.Cut(media, "/")
+	if err != nil || !ok || typ == "" || sub == "" {
+		return "unknown", "unknown"
+	}
+	return typ, sub
+}
@@ -0,0 +1,125 @@
+// Package netwait recognises transfers cut off by the network changing
+// underneath them, such as a laptop moving from Wi-Fi to a mobile hotspot
+// or a VPN reconnecting, and waits for the server to become reachable again
+// so the transfer can carry on from where it stopped.
+package netwait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/cloud"
+)
+
+const (
+	// MaxOutage is how long a transfer waits for the network to come back
+	// before failing.
+	MaxOutage = 5 * time.Minute
+
+	// MaxReconnects is how many reconnects in a row may fail to move a
+	// transfer forward before it is treated as a real failure.
+	MaxReconnects = 5
+
+	firstBackoff = 500 * time.Millisecond
+	maxBackoff   = 10 * time.Second
+	dialTimeout  = 5 * time.Second
+)
+
+// Dropped reports whether err looks like the connection or the route to the
+// server went away, rather than the server refusing the request or the
+// transfer being cancelled or timing out.
+func Dropped(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// The connection closed part way through the body
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	for _, errno := range []syscall.Errno{
+		syscall.ECONNRESET,
+		syscall.ECONNABORTED,
+		syscall.ECONNREFUSED,
+		syscall.EPIPE,
+		syscall.ENETDOWN,
+		syscall.ENETUNREACH,
+		syscall.ENETRESET,
+		syscall.EHOSTUNREACH,
+		syscall.ETIMEDOUT,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+
+	// Name resolution fails while there is no network at all
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// WaitForHost blocks until a TCP connection to the host in rawURL succeeds,
+// retrying with backoff. It gives up once maxOutage has passed or ctx is
+// done.
+func WaitForHost(ctx context.Context, rawURL string, maxOutage time.Duration) error {
+	address, err := hostAddress(rawURL)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(maxOutage)
+	dialer := net.Dialer{Timeout: dialTimeout}
+	backoff := firstBackoff
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("%s still unreachable after %v: %w", address, maxOutage, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func hostAddress(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	// An object is waited for at the service holding it
+	if endpoint, ok := cloud.Endpoint(u); ok {
+		u = endpoint
+	}
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https":
+			port = "443"
+		case "ftp":
+			port = "21"
+		case "ftps":
+			port = "990"
+		default:
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
@@ -0,0 +1,280 @@
+// Package openapi describes an HTTP API as an OpenAPI 3 document. Schemas
+// are derived from the Go types handlers encode and decode, following the
+// encoding/json rules for field names and embedded structs, so the document
+// can't drift from what the server actually sends.
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Version is the OpenAPI version documents are written in.
+const Version = "3.0.3"
+
+// Document is the root of an OpenAPI description.
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"` // For operations without their own
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem holds the operations of one path by lower-case method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"` // An empty requirement allows anonymous requests
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // "path", "query" or "header"
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`             // Such as "http" or "apiKey"
+	Scheme      string `json:"scheme,omitempty"` // Such as "bearer", for type http
+	Name        string `json:"name,omitempty"`   // Header or parameter, for type apiKey
+	In          string `json:"in,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schema describes a JSON value. A schema with Ref stands for the named
+// schema in the document's components.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Text is the schema of a plain string, for text bodies and parameters.
+func Text() *Schema {
+	return &Schema{Type: "string"}
+}
+
+// JSON returns content of schema as application/json.
+func JSON(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+// Generator derives schemas from Go types. Structs become named schemas
+// in the components, referred to wherever they are used.
+type Generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+	enums   map[reflect.Type][]string
+}
+
+func NewGenerator() *Generator {
+	return &Generator{
+		schemas: make(map[string]*Schema),
+		names:   make(map[reflect.Type]string),
+		enums:   make(map[reflect.Type][]string),
+	}
+}
+
+// Enum lists the values of the string type of v, which reflection can't
+// find on its own.
+func (g *Generator) Enum(v any, values ...string) {
+	g.enums[reflect.TypeOf(v)] = values
+}
+
+// Name sets the schema name of the struct type of v, for types whose own
+// name is vague or shared with a type of another package.
+func (g *Generator) Name(v any, name string) {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	g.names[t] = name
+}
+
+// Schema returns the schema of the type of v. A nil pointer such as
+// (*T)(nil) stands for T.
+func (g *Generator) Schema(v any) *Schema {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return &Schema{}
+	}
+	return g.schema(t)
+}
+
+// Schemas returns every named schema generated so far.
+func (g *Generator) Schemas() map[string]*Schema {
+	return g.schemas
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	zero     = 0.0
+)
+
+func (g *Generator) schema(t reflect.Type) *Schema {
+	if values, ok := g.enums[t]; ok {
+		return &Schema{Type: "string", Enum: values}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer", Minimum: &zero}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"} // Base64, as encoding/json writes it
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+		if t.Name() == "" {
+			schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+			g.fields(t, schema)
+			return schema
+		}
+		return &Schema{Ref: "#/components/schemas/" + g.define(t)}
+	default:
+		return &Schema{} // Interfaces hold any value
+	}
+}
+
+// define adds the schema of struct type t to the components, once, and
+// returns its name.
+func (g *Generator) define(t reflect.Type) string {
+	name, ok := g.names[t]
+	if ok && g.schemas[name] != nil {
+		return name
+	}
+	if !ok {
+		name = exported(t.Name())
+	}
+	if _, taken := g.schemas[name]; taken {
+		// Another package has a type of the same name
+		name = exported(pkgName(t)) + name
+	}
+
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	g.names[t] = name
+	g.schemas[name] = schema
+	g.fields(t, schema)
+	return name
+}
+
+// fields adds the JSON fields of struct type t to schema, flattening
+// embedded structs as encoding/json does: their fields come after the
+// struct's own, which win over them.
+func (g *Generator) fields(t reflect.Type, schema *Schema) {
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			inner := field.Type
+			if inner.Kind() == reflect.Pointer {
+				inner = inner.Elem()
+			}
+			if inner.Kind() == reflect.Struct {
+				embedded = append(embedded, inner)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.Contains(options, "string") {
+			schema.Properties[name] = &Schema{Type: "string"}
+			continue
+		}
+		schema.Properties[name] = g.schema(field.Type)
+	}
+	for _, inner := range embedded {
+		nested := &Schema{Properties: make(map[string]*Schema)}
+		g.fields(inner, nested)
+		for name, property := range nested.Properties {
+			if _, ok := schema.Properties[name]; !ok {
+				schema.Properties[name] = property
+			}
+		}
+	}
+}
+
+func exported(name string) string {
+	if name == "" {
+		return ""
+	}
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+func pkgName(t reflect.Type) string {
+	path := t.PkgPath()
+	return path[strings.LastIndex(path, "/")+1:]
+}
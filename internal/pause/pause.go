@@ -0,0 +1,114 @@
+// Package pause halts a download mid-transfer by cancelling every request
+// in flight and holding its chunks back until it is resumed, when each one
+// requests the rest of its range from where it stopped.
+package pause
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrPaused is the cancellation cause of a request dropped because the
+// download was paused. The chunk requests the rest once it is resumed.
+var ErrPaused = errors.New("download paused")
+
+// Gate pauses a download by cancelling every request in flight and holding
+// chunks back until it is resumed. What was written stays as it is, so a
+// paused download is no different from an interrupted one. The zero value
+// is a running download; a Gate is safe for concurrent use.
+type Gate struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{} // Closed on resume; nil while running
+	active  map[int]context.CancelCauseFunc
+	nextID  int
+	pauses  int // Times paused
+}
+
+// Track returns a context for one request that is cancelled with ErrPaused
+// when the download is paused, at once if it already is. Call release when
+// the request is over.
+func (g *Gate) Track(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		cancel(ErrPaused)
+		return ctx, func() {}
+	}
+	if g.active == nil {
+		g.active = make(map[int]context.CancelCauseFunc)
+	}
+	id := g.nextID
+	g.nextID++
+	g.active[id] = cancel
+	return ctx, func() {
+		g.mu.Lock()
+		delete(g.active, id)
+		g.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// Pause stops every tracked request. It reports whether the download was
+// running.
+func (g *Gate) Pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		return false
+	}
+	g.paused = true
+	g.pauses++
+	g.resumed = make(chan struct{})
+	for id, cancel := range g.active {
+		cancel(ErrPaused)
+		delete(g.active, id)
+	}
+	return true
+}
+
+// Resume lets paused chunks carry on. It reports whether the download was
+// paused.
+func (g *Gate) Resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return false
+	}
+	g.paused = false
+	close(g.resumed)
+	g.resumed = nil
+	return true
+}
+
+func (g *Gate) Paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// Wait blocks while the download is paused, or until ctx is done.
+func (g *Gate) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pauses returns how many times the download was paused.
+func (g *Gate) Pauses() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.pauses
+}
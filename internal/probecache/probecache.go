@@ -0,0 +1,124 @@
+// Package probecache remembers what probing a URL found out for a short
+// while, so adding the same URL again, or probing several mirrors of it,
+// doesn't send the origin a fresh HEAD request every time.
+package probecache
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/digest"
+)
+
+// DefaultTTL is how long a probe result is reused.
+const DefaultTTL = 2 * time.Minute
+
+// Result is what a probe learned about a URL.
+type Result struct {
+	URL      string            `json:"url"`
+	FinalURL string            `json:"finalUrl"` // After following redirects
+	Size     int64             `json:"size"`
+	Ranges   bool              `json:"ranges"`
+	HTTP2    bool              `json:"http2"`
+	ETag     string            `json:"etag,omitempty"`
+	Modified string            `json:"lastModified,omitempty"` // Last-Modified header
+	Filename string            `json:"filename,omitempty"`     // From Content-Disposition or the final URL
+	Type     string            `json:"contentType,omitempty"`  // Content-Type header
+	RTT      time.Duration     `json:"rtt"`
+	Digests  []digest.Expected `json:"-"`
+	ProbedAt time.Time         `json:"probedAt"`
+}
+
+// Entry is a cached result with the time it stops being used.
+type Entry struct {
+	Result
+	ExpiresAt time.Time `json:"expiresAt"`
+	Hits      int       `json:"hits"`
+}
+
+// Stats summarises the cache for introspection.
+type Stats struct {
+	TTL     string  `json:"ttl"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	Entries []Entry `json:"entries"`
+}
+
+// Cache holds probe results by URL. It is safe for concurrent use.
+type Cache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*Entry
+	hits    int64
+	misses  int64
+}
+
+// New returns a cache that reuses results for ttl. A ttl of 0 or less
+// disables caching.
+func New(ttl time.Duration) *Cache {
+	return &Cache{ttl: ttl, entries: make(map[string]*Entry)}
+}
+
+// Get returns the cached result for url if it hasn't expired.
+func (c *Cache) Get(url string) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[url]
+	if ok && time.Now().After(entry.ExpiresAt) {
+		delete(c.entries, url)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return Result{}, false
+	}
+	c.hits++
+	entry.Hits++
+	return entry.Result, true
+}
+
+// Put caches result under its URL.
+func (c *Cache) Put(result Result) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[result.URL] = &Entry{Result: result, ExpiresAt: result.ProbedAt.Add(c.ttl)}
+}
+
+// Forget drops the cached result for url, or every result when url is
+// empty.
+func (c *Cache) Forget(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if url == "" {
+		clear(c.entries)
+		return
+	}
+	delete(c.entries, url)
+}
+
+// Stats returns the counters and the results that haven't expired, most
+// recent first.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	stats := Stats{TTL: c.ttl.String(), Hits: c.hits, Misses: c.misses, Entries: []Entry{}}
+	for url, entry := range c.entries {
+		if now.After(entry.ExpiresAt) {
+			delete(c.entries, url)
+			continue
+		}
+		stats.Entries = append(stats.Entries, *entry)
+	}
+	sort.Slice(stats.Entries, func(i, j int) bool {
+		return stats.Entries[i].ProbedAt.After(stats.Entries[j].ProbedAt)
+	})
+	return stats
+}
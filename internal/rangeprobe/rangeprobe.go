@@ -0,0 +1,66 @@
+// Package rangeprobe learns a file's size and whether it can be fetched in
+// ranges from a GET for its first byte. Many servers reject HEAD, or leave
+// Content-Length or Accept-Ranges out of their answer to it, while a ranged
+// GET is answered with a Content-Range that gives both.
+package rangeprobe
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Range is what the probe asks for.
+const Range = "bytes=0-0"
+
+// Result is what a probe learned.
+type Result struct {
+	Size   int64 // -1 if the server didn't say
+	Ranges bool
+}
+
+// Needed reports whether a HEAD response, or its absence after a failed
+// request, leaves the size or the range support of the file unknown. A
+// server that says "Accept-Ranges: none" is taken at its word.
+func Needed(head *http.Response) bool {
+	return head == nil || head.StatusCode >= 400 || head.ContentLength < 0 || head.Header.Get("Accept-Ranges") == ""
+}
+
+// Get sends req, a GET for the file, with a Range for its first byte, and
+// returns the response, its body closed. A 206 Partial Content gives the
+// size in its Content-Range; a 200 OK means the server ignores ranges and
+// sends the whole file, of Content-Length bytes.
+func Get(client *http.Client, req *http.Request) (*http.Response, Result, error) {
+	req.Header.Set("Range", Range)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, Result{}, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Its Content-MD5 is that of the byte, not of the file
+		resp.Header.Del("Content-MD5")
+		return resp, Result{Size: total(resp), Ranges: true}, nil
+	case http.StatusOK:
+		return resp, Result{Size: resp.ContentLength}, nil
+	default:
+		return nil, Result{}, fmt.Errorf("server returned %s", resp.Status)
+	}
+}
+
+// total returns the size of the whole file given in the Content-Range of a
+// partial response, or -1 if it gives none.
+func total(resp *http.Response) int64 {
+	_, whole, found := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	if !found {
+		return -1
+	}
+	size, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
@@ -0,0 +1,110 @@
+// Package ratelimit caps the combined speed of several transfers, such as
+// the chunks of one download.
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// burst is how far ahead of schedule transfers may get after idling, so a
+// limit doesn't turn into a stop-and-go crawl.
+const burst = 100 * time.Millisecond
+
+// Limited reads are cut to about a tenth of a second's worth of bytes, within
+// these bounds, so waits stay short and transfers sharing the limit take
+// turns. Long waits would look like a dead connection to read timeouts.
+const (
+	minRead = 512
+	maxRead = 16 << 10
+)
+
+// Limiter hands out bytes at a fixed rate. The zero value and a nil
+// *Limiter are unlimited. It is safe for concurrent use.
+type Limiter struct {
+	mu   sync.Mutex
+	rate float64   // Bytes per second; 0 is unlimited
+	next time.Time // When the bytes handed out so far are paid for
+}
+
+// New returns a limiter allowing rate bytes per second; 0 is unlimited.
+func New(rate float64) *Limiter {
+	return &Limiter{rate: max(rate, 0)}
+}
+
+// SetRate changes the limit, taking effect for the next bytes requested.
+func (l *Limiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = max(rate, 0)
+	l.next = time.Time{}
+}
+
+// Rate returns the limit in bytes per second, 0 when unlimited.
+func (l *Limiter) Rate() float64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Wait blocks until n more bytes may pass or ctx is done.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if earliest := now.Add(-burst); l.next.Before(earliest) {
+		l.next = earliest
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reader returns r slowed down to the limiter's rate.
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &reader{ctx: ctx, r: r, limiter: l}
+}
+
+type reader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if rate := r.limiter.Rate(); rate > 0 {
+		if size := min(max(int(rate/10), minRead), maxRead); len(p) > size {
+			p = p[:size]
+		}
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.Wait(r.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,42 @@
+// Package redirect decides which redirects a download follows. Files are
+// often served from a CDN the original host redirects to, sometimes a
+// different one for each request, so redirects are followed up to a
+// limit. Credentials meant for the original host aren't passed on to
+// another one, or over plain HTTP after HTTPS.
+package redirect
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// DefaultMax is how many redirects in a row are followed, as by browsers.
+const DefaultMax = 10
+
+// sensitive are the headers dropped when a redirect leaves the original
+// host.
+var sensitive = []string{"Authorization", "Cookie", "Cookie2", "WWW-Authenticate"}
+
+// Policy returns an http.Client CheckRedirect that follows at most limit
+// redirects, none if limit is 0, and drops the Authorization and Cookie
+// headers from requests to any host but the first request's. Cookies from
+// a client's jar are still added for the hosts they belong to.
+func Policy(limit int) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > limit {
+			return fmt.Errorf("stopped after %d redirects", limit)
+		}
+		if crossOrigin(via[0], req) {
+			for _, name := range sensitive {
+				req.Header.Del(name)
+			}
+		}
+		return nil
+	}
+}
+
+// crossOrigin reports whether to goes to another host than from, or
+// downgrades it from HTTPS to HTTP.
+func crossOrigin(from, to *http.Request) bool {
+	return from.URL.Host != to.URL.Host || (from.URL.Scheme == "https" && to.URL.Scheme == "http")
+}
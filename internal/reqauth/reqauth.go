@@ -0,0 +1,106 @@
+// Package reqauth adds the headers, cookie and credentials a download was
+// given to every request it sends, so files behind a login, or on servers
+// that insist on a Referer, can be fetched. Extra headers go to every
+// mirror; the cookie and the user name and password only to the host of
+// the download's own URL, and the cookies of a cookies.txt export to the
+// hosts they were set by, as a browser would send them.
+package reqauth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/govind1331/Datablip/internal/cookiestxt"
+)
+
+// managed are headers each request sets for itself.
+var managed = map[string]bool{"Range": true, "Host": true, "Content-Length": true, "Transfer-Encoding": true}
+
+// Auth is what a download sends along with each request.
+type Auth struct {
+	Headers  map[string]string `json:"headers,omitempty"` // Such as "Referer" or "Authorization"
+	Cookie   string            `json:"cookie,omitempty"`  // As in a Cookie header: "name=value; other=value"
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"` // With Username, sent as basic auth
+
+	// CookiesTxt is a browser's cookies exported in the Netscape
+	// cookies.txt format, such as a logged in session.
+	CookiesTxt string `json:"cookiesTxt,omitempty"`
+}
+
+// Empty reports whether a sends nothing.
+func (a Auth) Empty() bool {
+	return len(a.Headers) == 0 && a.Cookie == "" && a.Username == "" && a.Password == "" && a.CookiesTxt == ""
+}
+
+// Validate reports a header that can't be sent.
+func (a Auth) Validate() error {
+	for name, value := range a.Headers {
+		if !validName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if managed[http.CanonicalHeaderKey(name)] {
+			return fmt.Errorf("header %s can't be set, each request sets its own", http.CanonicalHeaderKey(name))
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("invalid value for header %s", name)
+		}
+	}
+	if strings.ContainsAny(a.Cookie, "\r\n\x00") {
+		return fmt.Errorf("invalid cookie")
+	}
+	if a.Password != "" && a.Username == "" {
+		return fmt.Errorf("password needs username")
+	}
+	if _, err := a.Jar(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Jar returns a cookie jar holding CookiesTxt, or nil if it is empty.
+func (a Auth) Jar() (http.CookieJar, error) {
+	if a.CookiesTxt == "" {
+		return nil, nil
+	}
+	jar, _, err := cookiestxt.Read(strings.NewReader(a.CookiesTxt))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cookiesTxt: %v", err)
+	}
+	return jar, nil
+}
+
+// Apply sets a's headers on req, and its cookie and credentials when req
+// goes to host, the host of the download's URL.
+func (a Auth) Apply(req *http.Request, host string) {
+	for name, value := range a.Headers {
+		req.Header.Set(name, value)
+	}
+	if req.URL.Host != host {
+		return
+	}
+	if a.Cookie != "" {
+		if existing := req.Header.Get("Cookie"); existing != "" {
+			req.Header.Set("Cookie", existing+"; "+a.Cookie)
+		} else {
+			req.Header.Set("Cookie", a.Cookie)
+		}
+	}
+	if a.Username != "" {
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+}
+
+// validName reports whether name is an HTTP token.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > 0x7e || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+// Package retry spaces out new attempts at a chunk whose request failed
+// outright, such as on a server error or a connection that broke for good,
+// doubling the pause after each failure in a row. The chunk carries on with
+// a range request from the bytes it already has.
+package retry
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// DefaultMax is how many times in a row a chunk is retried before the
+	// download fails.
+	DefaultMax = 3
+
+	// DefaultBackoff is the pause before the first retry.
+	DefaultBackoff = time.Second
+
+	// maxDelay caps the pause however many retries came before.
+	maxDelay = time.Minute
+)
+
+// Delay returns the pause before retry attempt, counting from 1: backoff,
+// then twice that, and so on up to a minute.
+func Delay(backoff time.Duration, attempt int) time.Duration {
+	delay := backoff
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// Wait pauses before retry attempt, returning early with ctx's error if it
+// is done first.
+func Wait(ctx context.Context, backoff time.Duration, attempt int) error {
+	timer := time.NewTimer(Delay(backoff, attempt))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,103 @@
+// Package route sorts finished files into folders by what they contain,
+// such as video/ or iso/, following a list of rules.
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rule sends files of the given types into Folder. Types are MIME types,
+// with "video/*" style wildcards. Extensions are only consulted when the
+// content gives no type away, so a mislabeled file still lands by what it
+// really is.
+type Rule struct {
+	Folder     string   `json:"folder"`
+	Types      []string `json:"types,omitempty"`
+	Extensions []string `json:"extensions,omitempty"`
+}
+
+// DefaultRules sort the common kinds of download.
+var DefaultRules = []Rule{
+	{Folder: "video", Types: []string{"video/*"}, Extensions: []string{".mkv", ".mp4", ".avi", ".mov", ".ts"}},
+	{Folder: "audio", Types: []string{"audio/*"}, Extensions: []string{".mp3", ".flac", ".m4a"}},
+	{Folder: "images", Types: []string{"image/*"}},
+	{Folder: "iso", Types: []string{"application/x-iso9660-image"}, Extensions: []string{".iso", ".img"}},
+	{Folder: "documents", Types: []string{
+		"application/pdf",
+		"application/epub+zip",
+		"application/vnd.openxmlformats-officedocument.*",
+		"application/vnd.oasis.opendocument.*",
+		"text/*",
+	}},
+	{Folder: "archives", Types: []string{
+		"application/zip",
+		"application/gzip",
+		"application/x-gzip",
+		"application/x-tar",
+		"application/x-xz",
+		"application/x-bzip2",
+		"application/x-7z-compressed",
+		"application/x-rar-compressed",
+		"application/zstd",
+	}},
+	{Folder: "programs", Types: []string{
+		"application/x-executable",
+		"application/vnd.microsoft.portable-executable",
+		"application/vnd.android.package-archive",
+		"application/java-archive",
+	}, Extensions: []string{".exe", ".msi", ".deb", ".rpm", ".dmg", ".appimage"}},
+}
+
+// LoadRules reads a JSON array of rules from path.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid rules in %s: %v", path, err)
+	}
+	for i, rule := range rules {
+		if !filepath.IsLocal(rule.Folder) {
+			return nil, fmt.Errorf("invalid rule %d in %s: folder %q must be a relative path inside the download directory", i+1, path, rule.Folder)
+		}
+	}
+	return rules, nil
+}
+
+// Match returns the folder of the first rule matching the file's sniffed
+// MIME type, or, if the type is the generic application/octet-stream, its
+// name's extension.
+func Match(rules []Rule, mime, name string) (string, bool) {
+	for _, rule := range rules {
+		for _, pattern := range rule.Types {
+			if matchType(pattern, mime) {
+				return rule.Folder, true
+			}
+		}
+	}
+	if mime != "application/octet-stream" {
+		return "", false
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, rule := range rules {
+		for _, e := range rule.Extensions {
+			if strings.ToLower(e) == ext {
+				return rule.Folder, true
+			}
+		}
+	}
+	return "", false
+}
+
+func matchType(pattern, mime string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(mime, prefix)
+	}
+	return pattern == mime
+}
@@ -0,0 +1,88 @@
+package route
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen covers the ISO 9660 volume descriptor, the deepest signature
+// checked.
+const sniffLen = 0x8001 + 5
+
+// signature is a magic number at a fixed offset.
+type signature struct {
+	offset int
+	magic  string
+	mime   string
+}
+
+// signatures cover types http.DetectContentType doesn't know.
+var signatures = []signature{
+	{0x8001, "CD001", "application/x-iso9660-image"},
+	{0, "\x7fELF", "application/x-executable"},
+	{0, "MZ", "application/vnd.microsoft.portable-executable"},
+	{0, "\xfd7zXZ\x00", "application/x-xz"},
+	{0, "BZh", "application/x-bzip2"},
+	{0, "7z\xbc\xaf\x27\x1c", "application/x-7z-compressed"},
+	{0, "\x28\xb5\x2f\xfd", "application/zstd"},
+	{257, "ustar", "application/x-tar"},
+	{0, "fLaC", "audio/flac"},
+	{8, "M4A ", "audio/mp4"},
+	{8, "qt  ", "video/quicktime"},
+}
+
+// zipFormats are the file formats that are zip archives underneath, told
+// apart by their extension.
+var zipFormats = map[string]string{
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".epub": "application/epub+zip",
+	".apk":  "application/vnd.android.package-archive",
+	".jar":  "application/java-archive",
+}
+
+// Sniff reads the start of the file at path and returns its MIME type,
+// without parameters, going by content rather than by name.
+func Sniff(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return sniffBytes(head[:n], filepath.Ext(path)), nil
+}
+
+func sniffBytes(head []byte, ext string) string {
+	for _, sig := range signatures {
+		if len(head) >= sig.offset+len(sig.magic) && string(head[sig.offset:sig.offset+len(sig.magic)]) == sig.magic {
+			return sig.mime
+		}
+	}
+
+	mime, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	switch mime {
+	case "application/zip":
+		if format, ok := zipFormats[strings.ToLower(ext)]; ok {
+			return format
+		}
+	case "video/webm":
+		// Both share the EBML header; the doctype says which it is
+		if bytes.Contains(head[:min(len(head), 64)], []byte("matroska")) {
+			return "video/x-matroska"
+		}
+	}
+	return mime
+}
@@ -0,0 +1,86 @@
+// Package savename picks the name to save a download under when none was
+// given: the one the server suggests in Content-Disposition, or else the
+// last segment of the URL the download ended up at after redirects. Either
+// comes from the server, so it is reduced to a plain file name that can't
+// reach outside the directory it is saved in.
+package savename
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxLen is the longest name most file systems take, in bytes.
+const maxLen = 255
+
+// FromResponse returns the name suggested by header's Content-Disposition,
+// or the last segment of u's path, made safe with Sanitize. It returns ""
+// when neither gives a usable name.
+func FromResponse(header http.Header, u *url.URL) string {
+	if name := Sanitize(fromDisposition(header.Get("Content-Disposition"))); name != "" {
+		return name
+	}
+	if u == nil {
+		return ""
+	}
+	return Sanitize(path.Base(u.Path))
+}
+
+// fromDisposition returns the filename parameter of a Content-Disposition
+// header, preferring the RFC 5987 filename* form.
+func fromDisposition(header string) string {
+	if header == "" {
+		return ""
+	}
+	if _, params, err := mime.ParseMediaType(header); err == nil {
+		return params["filename"]
+	}
+	// Servers often leave a name with spaces unquoted, which the parser
+	// rejects; take what follows filename= up to the next parameter
+	lower := strings.ToLower(header)
+	i := strings.Index(lower, "filename=")
+	if i < 0 {
+		return ""
+	}
+	value, _, _ := strings.Cut(header[i+len("filename="):], ";")
+	return strings.Trim(strings.TrimSpace(value), `"'`)
+}
+
+// Sanitize returns the last segment of name, with either kind of slash as
+// a separator, without control characters or the ones Windows forbids,
+// leading dots or trailing dots and spaces, and cut to maxLen bytes keeping
+// the extension. It returns "" if nothing is left.
+func Sanitize(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "/" {
+		return ""
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError || unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`<>:"/|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	name = strings.TrimRight(name, ". ")
+	if len(name) > maxLen {
+		ext := path.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		stem := name[:maxLen-len(ext)]
+		for !utf8.ValidString(stem) {
+			stem = stem[:len(stem)-1]
+		}
+		name = stem + ext
+	}
+	return name
+}
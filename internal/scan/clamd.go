@@ -0,0 +1,106 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// clamdChunk is how much file data goes into each INSTREAM chunk.
+const clamdChunk = 64 << 10
+
+// Clamd streams files to clamd with the INSTREAM command, so the daemon
+// needs no access to the download directory.
+type Clamd struct {
+	Network string // "unix" or "tcp"
+	Address string
+}
+
+func (c *Clamd) Scan(ctx context.Context, path string, progress func(int64)) (Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer file.Close()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to reach clamd: %v", err)
+	}
+	defer conn.Close()
+
+	// Unblock reads and writes if the download is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return Result{}, fmt.Errorf("failed to send to clamd: %v", err)
+	}
+
+	buf := make([]byte, 4+clamdChunk)
+	for {
+		n, err := file.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return Result{}, c.failure(ctx, conn, err)
+			}
+			if progress != nil {
+				progress(int64(n))
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	// A zero-length chunk ends the stream
+	if _, err := conn.Write(make([]byte, 4)); err != nil {
+		return Result{}, c.failure(ctx, conn, err)
+	}
+
+	// The z prefix on the command makes clamd end its reply with a NUL
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return Result{}, c.failure(ctx, conn, err)
+	}
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// failure explains a broken conversation; clamd often closes the
+// connection with a reason, such as the stream size limit, before reading
+// everything.
+func (c *Clamd) failure(ctx context.Context, conn net.Conn, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if reply, _ := io.ReadAll(conn); len(reply) > 0 {
+		return fmt.Errorf("clamd: %s", bytes.TrimRight(reply, "\x00\n"))
+	}
+	return fmt.Errorf("clamd connection failed: %v", err)
+}
+
+// parseClamdReply interprets "stream: OK", "stream: <name> FOUND" and
+// "... ERROR" replies.
+func parseClamdReply(reply string) (Result, error) {
+	verdict := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case verdict == "OK":
+		return Result{Clean: true}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Threat: strings.TrimSuffix(verdict, " FOUND")}, nil
+	default:
+		return Result{}, fmt.Errorf("clamd: %s", reply)
+	}
+}
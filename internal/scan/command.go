@@ -0,0 +1,50 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Command runs an external scanner that follows the clamscan convention:
+// exit status 0 for a clean file, 1 when something was found, anything
+// else for an error.
+type Command struct {
+	Args []string
+}
+
+func (c *Command) Scan(ctx context.Context, path string, progress func(int64)) (Result, error) {
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Args[0], append(c.Args[1:], path)...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return Result{Clean: true}, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return Result{Threat: threatFromOutput(output.String(), path)}, nil
+	default:
+		return Result{}, fmt.Errorf("%s failed: %v: %s", c.Args[0], err, strings.TrimSpace(output.String()))
+	}
+}
+
+// threatFromOutput picks the finding out of the scanner's output: the
+// "<path>: <name> FOUND" line clamscan prints, or else the first line.
+func threatFromOutput(output, path string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for _, line := range lines {
+		if name, ok := strings.CutSuffix(strings.TrimSpace(line), " FOUND"); ok {
+			return strings.TrimPrefix(name, path+": ")
+		}
+	}
+	if lines[0] != "" {
+		return lines[0]
+	}
+	return "threat found"
+}
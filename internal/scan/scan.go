@@ -0,0 +1,41 @@
+// Package scan checks finished downloads for malware, either by streaming
+// them to a clamd daemon or by running a scanner command.
+package scan
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Result is the verdict on a scanned file.
+type Result struct {
+	Clean  bool
+	Threat string // What was found, when not clean
+}
+
+// Scanner scans a file on disk.
+type Scanner interface {
+	// Scan reports the verdict on the file at path. progress, if non-nil,
+	// is called with the byte count of every piece sent for scanning.
+	Scan(ctx context.Context, path string, progress func(int64)) (Result, error)
+}
+
+// NewClamd returns a scanner for the clamd daemon at address: a Unix
+// socket path, or host:port for TCP.
+func NewClamd(address string) *Clamd {
+	if strings.HasPrefix(address, "/") || strings.HasPrefix(address, "unix:") {
+		return &Clamd{Network: "unix", Address: strings.TrimPrefix(address, "unix:")}
+	}
+	return &Clamd{Network: "tcp", Address: strings.TrimPrefix(address, "tcp:")}
+}
+
+// NewCommand returns a scanner running command with the file's path
+// appended. The command line is split on spaces.
+func NewCommand(command string) (*Command, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty scan command")
+	}
+	return &Command{Args: args}, nil
+}
@@ -0,0 +1,122 @@
+// Package speed estimates transfer rates from a sliding window of recent
+// progress, smoothed so speed and ETA readouts don't jump around with every
+// read.
+package speed
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWindow is how much recent history a Meter considers.
+	DefaultWindow = 5 * time.Second
+
+	// resolution is the minimum spacing between recorded samples.
+	resolution = 100 * time.Millisecond
+
+	// smoothing is the time constant of the moving average applied on top
+	// of the windowed rate.
+	smoothing = 2 * time.Second
+)
+
+type sample struct {
+	at    time.Time
+	total int64
+}
+
+// Meter tracks a cumulative byte count and reports the rate it grew at over
+// the last window. It is safe for concurrent use.
+type Meter struct {
+	mu         sync.Mutex
+	window     time.Duration
+	samples    []sample // Oldest first, at least resolution apart
+	total      int64
+	smoothed   float64
+	smoothedAt time.Time
+}
+
+// New returns a meter averaging over window, or DefaultWindow if window is
+// not positive.
+func New(window time.Duration) *Meter {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &Meter{window: window}
+}
+
+// Set records the cumulative number of bytes transferred so far.
+func (m *Meter) Set(total int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.record(time.Now(), total)
+}
+
+// Add records n more bytes transferred.
+func (m *Meter) Add(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.record(time.Now(), m.total+n)
+}
+
+func (m *Meter) record(now time.Time, total int64) {
+	m.total = total
+	if n := len(m.samples); n > 0 && now.Sub(m.samples[n-1].at) < resolution {
+		return
+	}
+	m.samples = append(m.samples, sample{at: now, total: total})
+	m.trim(now)
+}
+
+// trim drops samples that fell out of the window, keeping the newest of
+// them as the baseline the window's growth is measured from.
+func (m *Meter) trim(now time.Time) {
+	cutoff := now.Add(-m.window)
+	drop := 0
+	for drop+1 < len(m.samples) && !m.samples[drop+1].at.After(cutoff) {
+		drop++
+	}
+	m.samples = m.samples[drop:]
+}
+
+// Rate returns the smoothed transfer rate in bytes per second. A transfer
+// that stops making progress decays towards zero.
+func (m *Meter) Rate() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.trim(now)
+	if len(m.samples) == 0 {
+		return 0
+	}
+
+	base := m.samples[0]
+	elapsed := now.Sub(base.at)
+	if elapsed < resolution {
+		return m.smoothed
+	}
+	raw := float64(m.total-base.total) / elapsed.Seconds()
+
+	if m.smoothedAt.IsZero() {
+		m.smoothed = raw
+	} else {
+		alpha := 1 - math.Exp(-now.Sub(m.smoothedAt).Seconds()/smoothing.Seconds())
+		m.smoothed += alpha * (raw - m.smoothed)
+	}
+	m.smoothedAt = now
+	return m.smoothed
+}
+
+// ETA estimates how long the remaining bytes take at rate bytes per second.
+// It reports false when the rate is too low to give a meaningful estimate.
+func ETA(remaining int64, rate float64) (time.Duration, bool) {
+	if remaining <= 0 {
+		return 0, true
+	}
+	if rate < 1 {
+		return 0, false
+	}
+	return time.Duration(float64(remaining) / rate * float64(time.Second)), true
+}
@@ -0,0 +1,66 @@
+// Package split picks a slow chunk whose remaining range is worth handing
+// in part to another connection. Against servers and CDNs that rate-limit
+// each connection, a chunk left crawling after the others finish otherwise
+// holds up the whole download at a single connection's speed.
+package split
+
+import "time"
+
+const (
+	// MinPiece is the smallest range either side of a split may be left
+	// with.
+	MinPiece = 2 << 20
+
+	// MinETA is how long a chunk must still be expected to take before it
+	// is worth splitting; shorter tails finish before a new connection
+	// gets going.
+	MinETA = 10 * time.Second
+
+	// Align is the granularity of split points, which keeps them usable
+	// for direct I/O.
+	Align = 64 << 10
+
+	// Lag is how many times slower than a typical connection of the
+	// download a chunk must move to be split while others are running.
+	Lag = 4
+)
+
+// Lagging reports whether a chunk moving at rate bytes/s is dramatically
+// slower than the typical connection of its download, which moves at
+// typical bytes/s.
+func Lagging(rate, typical float64) bool {
+	return rate > 0 && rate*Lag < typical
+}
+
+// Chunk is a chunk with a request in flight.
+type Chunk struct {
+	ID   int
+	Pos  int64   // Absolute offset reached so far
+	End  int64   // Absolute offset the chunk ends before
+	Rate float64 // Bytes per second
+}
+
+// Pick returns the chunk expected to finish last and the offset from which
+// its remaining range should go to a new connection, which takes the second
+// half. It reports false when no chunk is slow and large enough to be
+// worth it. Chunks whose rate isn't known yet are skipped.
+func Pick(chunks []Chunk) (id int, at int64, ok bool) {
+	var slowest time.Duration
+	for _, c := range chunks {
+		remaining := c.End - c.Pos
+		if c.Rate <= 0 || remaining < 2*MinPiece {
+			continue
+		}
+		eta := time.Duration(float64(remaining) / c.Rate * float64(time.Second))
+		if eta < MinETA || eta <= slowest {
+			continue
+		}
+
+		mid := (c.Pos + remaining/2) &^ (Align - 1)
+		if mid-c.Pos < MinPiece || c.End-mid < MinPiece {
+			continue
+		}
+		slowest, id, at, ok = eta, c.ID, mid, true
+	}
+	return id, at, ok
+}
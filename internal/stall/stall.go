@@ -0,0 +1,96 @@
+// Package stall spots chunk transfers that have slowed to a crawl while the
+// rest of the download keeps moving, so their connection can be restarted.
+// A fresh connection often lands on a different server or path and picks
+// up the normal pace again.
+package stall
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSpeed is the throughput floor, in bytes per second, below
+	// which a chunk counts as stalled.
+	DefaultSpeed = 5 << 10
+
+	// DefaultTime is how long a chunk must stay below the floor before its
+	// connection is restarted.
+	DefaultTime = 30 * time.Second
+)
+
+// ErrStalled is the cancellation cause of a request dropped for being too
+// slow. The chunk is requested again from where it stopped.
+var ErrStalled = errors.New("connection stalled")
+
+type mark struct {
+	at  time.Time
+	pos int64
+}
+
+// Detector tracks how long each chunk has been moving below the floor. It
+// is safe for concurrent use.
+type Detector struct {
+	speed  float64
+	window time.Duration
+
+	mu    sync.Mutex
+	marks map[int]mark // Where each chunk was when it last kept up with the floor
+}
+
+// NewDetector returns a detector flagging chunks that average less than
+// speed bytes per second over window.
+func NewDetector(speed float64, window time.Duration) *Detector {
+	return &Detector{speed: speed, window: window, marks: make(map[int]mark)}
+}
+
+// Check takes the current position of every chunk with a request in flight
+// and returns the chunks that have stayed below the floor for the whole
+// window, provided at least one other chunk kept above it. When every chunk
+// is slow the server or link is simply slow, and restarting won't help.
+func (d *Detector) Check(positions map[int]int64) []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for id := range d.marks {
+		if _, ok := positions[id]; !ok {
+			delete(d.marks, id)
+		}
+	}
+
+	var slow []int
+	fast := false
+	for id, pos := range positions {
+		m, ok := d.marks[id]
+		if !ok || pos < m.pos {
+			d.marks[id] = mark{at: now, pos: pos}
+			continue
+		}
+
+		elapsed := now.Sub(m.at)
+		if elapsed <= 0 {
+			continue
+		}
+		if float64(pos-m.pos)/elapsed.Seconds() >= d.speed {
+			fast = true
+			d.marks[id] = mark{at: now, pos: pos}
+		} else if elapsed >= d.window {
+			slow = append(slow, id)
+		}
+	}
+
+	if !fast {
+		return nil
+	}
+	return slow
+}
+
+// Reset starts a new observation window for the chunk, after its
+// connection was restarted.
+func (d *Detector) Reset(id int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.marks, id)
+}
@@ -0,0 +1,76 @@
+// Package store keeps the server's download records in a BoltDB file, so
+// the history of finished downloads and the queue of unfinished ones
+// survive a restart. Records are stored as the JSON the caller hands in.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultFile is where the server keeps its downloads.
+const DefaultFile = "downloads.db"
+
+// openTimeout is how long Open waits for the file lock, so a second server
+// pointed at the same file fails instead of hanging.
+const openTimeout = time.Second
+
+var downloads = []byte("downloads")
+
+// Store is an open store file. It is safe for concurrent use.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the store in path, creating it if needed.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("failed to open %s: it is in use by another server", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(downloads)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the file.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put saves the record of the download with the given ID, replacing any
+// earlier one.
+func (s *Store) Put(id string, record []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(downloads).Put([]byte(id), record)
+	})
+}
+
+// Delete removes the record of the download with the given ID.
+func (s *Store) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(downloads).Delete([]byte(id))
+	})
+}
+
+// ForEach calls fn with every record, in the order of their IDs, stopping at
+// the first error fn returns.
+func (s *Store) ForEach(fn func(id string, record []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(downloads).ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
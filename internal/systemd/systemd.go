@@ -0,0 +1,101 @@
+// Package systemd tells the service manager how the server is doing, so it
+// can run as a Type=notify service with a watchdog, and takes over the
+// sockets it opens for socket activation. Everything here does nothing when
+// the server isn't started by systemd.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notify sends state, such as "READY=1", to the service manager. It reports
+// false without an error when there is no service manager listening.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// A leading @ names a socket in the abstract namespace
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns how often the service manager expects to hear
+// that the server is alive, or false if no watchdog is set for it.
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	// The watchdog may be meant for another process of the service
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+// StateDirectory returns the directory systemd created for the service with
+// StateDirectory=, or "" if there is none.
+func StateDirectory() string {
+	// Several directories are separated by colons; the first is the main one
+	dir, _, _ := strings.Cut(os.Getenv("STATE_DIRECTORY"), ":")
+	return dir
+}
+
+// listenFdsStart is the first file descriptor passed by socket activation.
+const listenFdsStart = 3
+
+// Listeners returns the sockets systemd opened for the server, with
+// ListenStream= in a .socket unit, or none when it wasn't socket
+// activated. The environment variables describing them are cleared, so
+// processes the server starts don't take them for their own.
+func Listeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	var listeners []net.Listener
+	for i := 0; i < count; i++ {
+		fd := listenFdsStart + i
+		name := "fd " + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		// FileListener works on a duplicate that is closed on exec
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("socket %s from systemd: %v", name, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
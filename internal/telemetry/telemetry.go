@@ -0,0 +1,173 @@
+// Package telemetry counts how the server's features are used and, only
+// when the operator opts in with a URL, reports the counts there once a day.
+// Reports hold the server version, platform and counts of events such as
+// "downloads.completed"; never URLs, file names, addresses or any ID.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is how often reports are sent.
+const DefaultInterval = 24 * time.Hour
+
+// Report is exactly what is sent.
+type Report struct {
+	Version   string           `json:"version"`
+	OS        string           `json:"os"`
+	Arch      string           `json:"arch"`
+	GoVersion string           `json:"goVersion"`
+	Since     string           `json:"since"` // Date the counts start from, in UTC
+	Counts    map[string]int64 `json:"counts"`
+}
+
+// Status describes the reporter and the report it would send next.
+type Status struct {
+	Enabled    bool       `json:"enabled"`
+	URL        string     `json:"url,omitempty"`
+	Interval   string     `json:"interval"`
+	LastSent   *time.Time `json:"lastSent,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+	NextReport Report     `json:"nextReport"`
+}
+
+// Reporter counts events and sends them to URL. A nil *Reporter ignores
+// events, so callers needn't check whether telemetry is set up.
+type Reporter struct {
+	// URL receives each report as a JSON POST; empty sends nothing, which
+	// is the default.
+	URL      string
+	Interval time.Duration
+	Version  string
+
+	client    *http.Client
+	mu        sync.Mutex
+	counts    map[string]int64
+	since     time.Time
+	lastSent  *time.Time
+	lastError string
+}
+
+func New(version string) *Reporter {
+	return &Reporter{
+		Interval: DefaultInterval,
+		Version:  version,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		counts:   make(map[string]int64),
+		since:    time.Now(),
+	}
+}
+
+// Count records one occurrence of event.
+func (r *Reporter) Count(event string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[event]++
+}
+
+// Report returns what would be sent now.
+func (r *Reporter) Report() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.report()
+}
+
+// report is Report with r.mu held.
+func (r *Reporter) report() Report {
+	counts := make(map[string]int64, len(r.counts))
+	for event, n := range r.counts {
+		counts[event] = n
+	}
+	return Report{
+		Version:   r.Version,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		Since:     r.since.UTC().Format(time.DateOnly),
+		Counts:    counts,
+	}
+}
+
+func (r *Reporter) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Status{
+		Enabled:    r.URL != "",
+		URL:        r.URL,
+		Interval:   r.Interval.String(),
+		LastSent:   r.lastSent,
+		LastError:  r.lastError,
+		NextReport: r.report(),
+	}
+}
+
+// Run sends a report every Interval until ctx is done. It returns at once
+// if no URL is set.
+func (r *Reporter) Run(ctx context.Context) {
+	if r.URL == "" {
+		return
+	}
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := r.send(ctx); err != nil {
+			log.Printf("Telemetry report not sent: %v", err)
+		}
+	}
+}
+
+// send posts the current report. The counts it held are taken off once it
+// is delivered; events counted meanwhile go in the next one.
+func (r *Reporter) send(ctx context.Context) error {
+	r.mu.Lock()
+	report := r.report()
+	r.mu.Unlock()
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", r.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("server returned status %s", resp.Status)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.lastError = err.Error()
+		return err
+	}
+	now := time.Now()
+	r.lastSent, r.lastError, r.since = &now, "", now
+	for event, n := range report.Counts {
+		if r.counts[event] -= n; r.counts[event] <= 0 {
+			delete(r.counts, event)
+		}
+	}
+	return nil
+}
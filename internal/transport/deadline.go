@@ -0,0 +1,81 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Deadline bounds how long a request may take to get its response headers,
+// dialing and the TLS handshake included, so the bound can differ between
+// downloads that share one transport. Reading the body isn't bounded.
+type Deadline struct {
+	Transport http.RoundTripper
+
+	// Timeout returns the bound for a request about to be sent; 0 leaves
+	// it to the transport.
+	Timeout func() time.Duration
+}
+
+// TimeoutError is returned for a request that got no response in time.
+type TimeoutError struct {
+	After time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("no response within %v", e.After)
+}
+
+// Timeout reports true, like the transport's own timeouts.
+func (e *TimeoutError) Timeout() bool { return true }
+
+// Temporary reports true, so the request is worth retrying.
+func (e *TimeoutError) Temporary() bool { return true }
+
+// RoundTrip sends req, giving up once the timeout passes without response
+// headers.
+func (d *Deadline) RoundTrip(req *http.Request) (*http.Response, error) {
+	timeout := d.Timeout()
+	if timeout <= 0 {
+		return d.Transport.RoundTrip(req)
+	}
+	ctx, cancel := context.WithCancelCause(req.Context())
+	expired := &TimeoutError{After: timeout}
+	timer := time.AfterFunc(timeout, func() { cancel(expired) })
+	resp, err := d.Transport.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() && context.Cause(ctx) == expired {
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel(nil)
+		return nil, expired
+	}
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	// The body is read under the same context, so it is only released once
+	// the body is closed
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { cancel(nil) }}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the wrapped transport's idle connections.
+func (d *Deadline) CloseIdleConnections() {
+	if t, ok := d.Transport.(interface{ CloseIdleConnections() }); ok {
+		t.CloseIdleConnections()
+	}
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Polite spaces out the requests sent through it to each host, so a queue
+// of hundreds of small files from one server reaches it like a mirror
+// client rather than a scraper. Requests to different hosts don't wait for
+// each other.
+type Polite struct {
+	Transport *http.Transport
+
+	mu    sync.Mutex
+	delay time.Duration
+	next  map[string]time.Time // When each host may be sent the next request
+}
+
+// NewPolite wraps t without any delay.
+func NewPolite(t *http.Transport) *Polite {
+	return &Polite{Transport: t, next: make(map[string]time.Time)}
+}
+
+// SetDelay changes the time between the starts of requests to one host; 0
+// sends them as soon as they are made.
+func (p *Polite) SetDelay(delay time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.delay = max(delay, 0)
+}
+
+// Delay returns the time between the starts of requests to one host.
+func (p *Polite) Delay() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.delay
+}
+
+// RoundTrip waits for the request's turn at its host, then sends it.
+func (p *Polite) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := p.wait(req.Context(), req.URL.Host); err != nil {
+		return nil, err
+	}
+	return p.Transport.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the wrapped transport's idle connections.
+func (p *Polite) CloseIdleConnections() {
+	p.Transport.CloseIdleConnections()
+}
+
+// wait reserves the host's next slot and sleeps until it comes.
+func (p *Polite) wait(ctx context.Context, host string) error {
+	now := time.Now()
+	p.mu.Lock()
+	if p.delay == 0 {
+		p.mu.Unlock()
+		return nil
+	}
+	at := now
+	if next := p.next[host]; next.After(at) {
+		at = next
+	}
+	p.next[host] = at.Add(p.delay)
+	// Forget hosts whose turn is long past
+	if len(p.next) > 256 {
+		for h, next := range p.next {
+			if next.Before(now) {
+				delete(p.next, h)
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	if !at.After(now) {
+		return nil
+	}
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
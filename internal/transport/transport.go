@@ -0,0 +1,111 @@
+// Package transport builds the HTTP transport shared by every chunk request
+// of a download, opens its connections ahead of time, tracks how often they
+// are reused, and can space out the requests sent to each host.
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/cloud"
+	"github.com/govind1331/Datablip/internal/ftp"
+)
+
+// New returns a transport tuned for many parallel range requests against the
+// same host. connectTimeout bounds dialing, the TLS handshake and the wait
+// for response headers; connsPerHost is how many idle connections are kept
+// per host so every chunk worker can reuse one.
+func New(connectTimeout time.Duration, connsPerHost int) *http.Transport {
+	if connsPerHost < 1 {
+		connsPerHost = 1
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   connsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: connectTimeout,
+		ExpectContinueTimeout: time.Second,
+		// Byte ranges refer to the stored representation, so never ask for
+		// transparent gzip
+		DisableCompression: true,
+	}
+	// FTP servers are asked the same questions in their own protocol, and
+	// object stores over HTTPS once the request is addressed and signed
+	ftpTransport := ftp.New(dialer.DialContext, connectTimeout)
+	t.RegisterProtocol("ftp", ftpTransport)
+	t.RegisterProtocol("ftps", ftpTransport)
+	cloudTransport := cloud.New(t)
+	for _, scheme := range cloud.Schemes {
+		t.RegisterProtocol(scheme, cloudTransport)
+	}
+	return t
+}
+
+// Stats counts the connections handed out to traced requests.
+type Stats struct {
+	opened atomic.Int64
+	reused atomic.Int64
+}
+
+// Conn describes the connection a single request ended up using.
+type Conn struct {
+	Reused   bool
+	WasIdle  bool
+	IdleTime time.Duration
+	Remote   string
+}
+
+// Trace returns a context that records the connection used by a request
+// made with it. onConn, if non-nil, is called with the details.
+func (s *Stats) Trace(ctx context.Context, onConn func(Conn)) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				s.reused.Add(1)
+			} else {
+				s.opened.Add(1)
+			}
+			if onConn == nil {
+				return
+			}
+			conn := Conn{
+				Reused:   info.Reused,
+				WasIdle:  info.WasIdle,
+				IdleTime: info.IdleTime,
+			}
+			if info.Conn != nil {
+				conn.Remote = info.Conn.RemoteAddr().String()
+			}
+			onConn(conn)
+		},
+	})
+}
+
+// Opened is the number of new connections dialed.
+func (s *Stats) Opened() int64 {
+	return s.opened.Load()
+}
+
+// Reused is the number of requests served over an existing connection.
+func (s *Stats) Reused() int64 {
+	return s.reused.Load()
+}
+
+func (s *Stats) String() string {
+	return fmt.Sprintf("%d opened, %d reused", s.Opened(), s.Reused())
+}
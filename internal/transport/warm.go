@@ -0,0 +1,230 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// warmTTL is how long a pre-warmed connection waits to be used before it is
+// closed; servers drop connections that sit idle before their first request.
+const warmTTL = 10 * time.Second
+
+type warmConn struct {
+	conn   net.Conn
+	expiry time.Time
+}
+
+// Warmer opens connections ahead of the requests that will use them, so a
+// download's chunks all start transferring at once rather than each waiting
+// for its own DNS lookup, TCP handshake and TLS handshake. It is safe for
+// concurrent use.
+type Warmer struct {
+	dial             func(ctx context.Context, network, addr string) (net.Conn, error)
+	tlsConfig        *tls.Config
+	handshakeTimeout time.Duration
+	proxy            func(*http.Request) (*url.URL, error)
+
+	mu    sync.Mutex
+	conns map[string][]warmConn // By "tcp " or "tls " plus host:port
+}
+
+// NewWarmer hooks a warmer into t's dialing. It must be called before t is
+// first used.
+func NewWarmer(t *http.Transport) *Warmer {
+	w := &Warmer{
+		dial:             t.DialContext,
+		handshakeTimeout: t.TLSHandshakeTimeout,
+		proxy:            t.Proxy,
+		conns:            make(map[string][]warmConn),
+	}
+	if w.dial == nil {
+		w.dial = (&net.Dialer{}).DialContext
+	}
+	if t.TLSClientConfig != nil {
+		w.tlsConfig = t.TLSClientConfig.Clone()
+	} else {
+		w.tlsConfig = &tls.Config{}
+	}
+	if t.ForceAttemptHTTP2 && len(w.tlsConfig.NextProtos) == 0 {
+		w.tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	t.DialContext = w.dialContext
+	t.DialTLSContext = w.dialTLSContext
+	return w
+}
+
+// Prewarm opens n connections to the host of rawURL in parallel, completing
+// the TLS handshake for https, and keeps them for the transport's next
+// dials. Connections not picked up within a few seconds are closed. It
+// returns how many were opened; nothing is warmed when a proxy is in use,
+// or for FTP, whose requests each log in on a connection of their own, and
+// object store URLs, whose host isn't the one dialed.
+func (w *Warmer) Prewarm(ctx context.Context, rawURL string, n int) (int, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return 0, nil
+	}
+	if w.proxy != nil {
+		if proxyURL, err := w.proxy(&http.Request{URL: u}); err != nil || proxyURL != nil {
+			return 0, err
+		}
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	var wg sync.WaitGroup
+	conns := make(chan net.Conn, n)
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var conn net.Conn
+			var err error
+			if u.Scheme == "https" {
+				conn, err = w.handshake(ctx, addr)
+			} else {
+				conn, err = w.dial(ctx, "tcp", addr)
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			conns <- conn
+		}()
+	}
+	wg.Wait()
+	close(conns)
+	close(errs)
+
+	key := "tcp " + addr
+	if u.Scheme == "https" {
+		key = "tls " + addr
+	}
+	expiry := time.Now().Add(warmTTL)
+	opened := 0
+	w.mu.Lock()
+	for conn := range conns {
+		w.conns[key] = append(w.conns[key], warmConn{conn: conn, expiry: expiry})
+		opened++
+	}
+	w.mu.Unlock()
+	if opened > 0 {
+		time.AfterFunc(warmTTL, w.expire)
+	}
+
+	if opened == 0 && n > 0 {
+		return 0, <-errs
+	}
+	return opened, nil
+}
+
+// Close closes every pre-warmed connection not yet handed out.
+func (w *Warmer) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for key, conns := range w.conns {
+		for _, wc := range conns {
+			wc.conn.Close()
+		}
+		delete(w.conns, key)
+	}
+}
+
+func (w *Warmer) expire() {
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for key, conns := range w.conns {
+		kept := conns[:0]
+		for _, wc := range conns {
+			if now.Before(wc.expiry) {
+				kept = append(kept, wc)
+			} else {
+				wc.conn.Close()
+			}
+		}
+		if len(kept) == 0 {
+			delete(w.conns, key)
+		} else {
+			w.conns[key] = kept
+		}
+	}
+}
+
+// take hands out a pre-warmed connection for key, if one is still fresh.
+func (w *Warmer) take(key string) net.Conn {
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for conns := w.conns[key]; len(conns) > 0; conns = w.conns[key] {
+		wc := conns[len(conns)-1]
+		w.conns[key] = conns[:len(conns)-1]
+		if now.Before(wc.expiry) {
+			return wc.conn
+		}
+		wc.conn.Close()
+	}
+	return nil
+}
+
+func (w *Warmer) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if conn := w.take("tcp " + addr); conn != nil {
+		return conn, nil
+	}
+	return w.dial(ctx, network, addr)
+}
+
+// dialTLSContext stands in for the transport's own TLS dialing, which it
+// skips once a custom TLS dialer is set.
+func (w *Warmer) dialTLSContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if conn := w.take("tls " + addr); conn != nil {
+		return conn, nil
+	}
+	return w.handshake(ctx, addr)
+}
+
+func (w *Warmer) handshake(ctx context.Context, addr string) (net.Conn, error) {
+	conn, err := w.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	config := w.tlsConfig.Clone()
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		config.ServerName = host
+	}
+
+	if w.handshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.handshakeTimeout)
+		defer cancel()
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,36 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// RcloneCommand is the rclone executable, looked up on PATH by default.
+var RcloneCommand = "rclone"
+
+// Rclone streams files to an rclone remote with "rclone rcat", so the
+// remote, its credentials and its options all come from the rclone config.
+type Rclone struct {
+	Target string // remote:path
+}
+
+func (u *Rclone) Upload(ctx context.Context, r io.Reader, size int64, name string) (string, error) {
+	dest := joinKey(u.Target, name)
+
+	// "--" keeps a dest starting with "-" from being read as a flag
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, RcloneCommand, "rcat", "--", dest)
+	cmd.Stdin = r
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("rclone rcat %s: %v: %s", dest, err, msg)
+		}
+		return "", fmt.Errorf("rclone rcat %s: %v", dest, err)
+	}
+	return dest, nil
+}
@@ -0,0 +1,106 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/cloud"
+)
+
+// maxS3Put is the largest object S3 accepts in a single PUT.
+const maxS3Put = 5 << 30
+
+// S3 uploads with a single signed PUT per file. Credentials and the region
+// come from the usual AWS_* environment variables; AWS_ENDPOINT_URL points
+// it at an S3-compatible service such as MinIO, addressed path-style.
+type S3 struct {
+	Bucket   string
+	Prefix   string
+	Region   string
+	Endpoint string // Empty for AWS itself
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	Client *http.Client
+}
+
+func newS3(bucket, prefix string) (*S3, error) {
+	u := &S3{
+		Bucket:       bucket,
+		Prefix:       prefix,
+		Region:       firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		Endpoint:     firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		Client:       http.DefaultClient,
+	}
+	if u.Region == "" {
+		u.Region = "us-east-1"
+	}
+	if u.AccessKey == "" || u.SecretKey == "" {
+		return nil, fmt.Errorf("uploading to s3://%s needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY", bucket)
+	}
+	return u, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (u *S3) Upload(ctx context.Context, r io.Reader, size int64, name string) (string, error) {
+	if size > maxS3Put {
+		return "", fmt.Errorf("%d bytes is over the 5 GiB S3 single upload limit; use an rclone remote instead", size)
+	}
+
+	key := joinKey(u.Prefix, name)
+	objectURL, err := u.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", objectURL.String(), io.NopCloser(r))
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	// The body is streamed from disk, so it isn't hashed up front
+	keys := cloud.AWSKeys{AccessKey: u.AccessKey, SecretKey: u.SecretKey, SessionToken: u.SessionToken}
+	cloud.SignAWS(req, keys, u.Region, "UNSIGNED-PAYLOAD", time.Now())
+
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("S3 returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return fmt.Sprintf("s3://%s/%s", u.Bucket, key), nil
+}
+
+func (u *S3) objectURL(key string) (*url.URL, error) {
+	if u.Endpoint == "" {
+		return url.Parse(fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", u.Bucket, u.Region, cloud.URIEncode(key, false)))
+	}
+	endpoint, err := url.Parse(u.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: %v", u.Endpoint, err)
+	}
+	return endpoint.Parse("/" + cloud.URIEncode(u.Bucket, true) + "/" + cloud.URIEncode(key, false))
+}
@@ -0,0 +1,44 @@
+// Package upload delivers finished downloads to remote storage: an S3
+// bucket, or any remote the rclone tool is configured for.
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Uploader stores a file at its destination.
+type Uploader interface {
+	// Upload stores size bytes read from r under name and returns where
+	// they ended up.
+	Upload(ctx context.Context, r io.Reader, size int64, name string) (location string, err error)
+}
+
+// New returns the uploader for target, which is either s3://bucket/prefix
+// or an rclone remote:path. Files are stored under the target with their
+// own name appended.
+func New(target string) (Uploader, error) {
+	if rest, ok := strings.CutPrefix(target, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("invalid upload target %q: missing bucket", target)
+		}
+		return newS3(bucket, prefix)
+	}
+
+	remote, _, ok := strings.Cut(target, ":")
+	if !ok || remote == "" || strings.Contains(remote, "/") {
+		return nil, fmt.Errorf("invalid upload target %q: want s3://bucket/prefix or an rclone remote:path", target)
+	}
+	return &Rclone{Target: target}, nil
+}
+
+// joinKey appends name to a prefix that may or may not end with a slash.
+func joinKey(prefix, name string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") || strings.HasSuffix(prefix, ":") {
+		return prefix + name
+	}
+	return prefix + "/" + name
+}
@@ -0,0 +1,175 @@
+// Package urlnorm brings URLs that fetch the same file to one form, so the
+// queue can recognize a download it already has: the scheme and host are
+// lowercased, international hosts spelled in ASCII, percent-escapes made
+// uppercase or decoded where they needn't be, default ports and fragments
+// dropped, and tracking parameters such as utm_source removed following a
+// list of rules.
+package urlnorm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Rules are query parameters removed from URLs, such as "fbclid", with
+// "utm_*" style wildcards. Names are matched without regard to case.
+type Rules []string
+
+// DefaultRules strip the parameters analytics and ad platforms append to
+// shared links; none of them changes what a server sends.
+var DefaultRules = Rules{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"gbraid",
+	"wbraid",
+	"msclkid",
+	"yclid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"_ga",
+	"_gl",
+}
+
+// LoadRules reads a JSON array of parameter patterns from file.
+func LoadRules(file string) (Rules, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid URL rules in %s: %v", file, err)
+	}
+	for _, pattern := range rules {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid URL rule %q in %s: %v", pattern, file, err)
+		}
+	}
+	return rules, nil
+}
+
+// strips reports whether the rules remove the query parameter name.
+func (rules Rules) strips(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range rules {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var defaultPorts = map[string]string{"http": "80", "https": "443", "ftp": "21", "ftps": "990"}
+
+// objectSchemes name a bucket or storage account where other URLs have a
+// host, so they have no ports.
+var objectSchemes = map[string]bool{"s3": true, "gs": true, "az": true}
+
+// Supported reports whether URLs of scheme can be downloaded: http, https,
+// ftp and ftps, and the s3, gs and az object stores.
+func Supported(scheme string) bool {
+	scheme = strings.ToLower(scheme)
+	_, ok := defaultPorts[scheme]
+	return ok || objectSchemes[scheme]
+}
+
+// Normalize returns raw in normal form. Only URLs of supported schemes are
+// accepted. The path and the order of the remaining query parameters are
+// kept, since servers may tell them apart.
+func Normalize(raw string, rules Rules) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if !Supported(u.Scheme) {
+		return "", fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("URL %q has no host", raw)
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		host = ascii
+	}
+	host = strings.ToLower(host)
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6
+	}
+	if port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	u.Host = host
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawPath = normalizeEscapes(u.EscapedPath())
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	u.RawQuery = normalizeEscapes(u.RawQuery)
+	u.Fragment, u.RawFragment = "", ""
+
+	if u.RawQuery != "" && len(rules) > 0 {
+		var kept []string
+		for _, param := range strings.Split(u.RawQuery, "&") {
+			name, _, _ := strings.Cut(param, "=")
+			if unescaped, err := url.QueryUnescape(name); err == nil {
+				name = unescaped
+			}
+			if param != "" && !rules.strips(name) {
+				kept = append(kept, param)
+			}
+		}
+		u.RawQuery = strings.Join(kept, "&")
+	}
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+// normalizeEscapes writes the percent-escapes in s with uppercase hex
+// digits, and decodes those of letters, digits and "-._~", which mean the
+// same either way.
+func normalizeEscapes(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if unreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func unreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
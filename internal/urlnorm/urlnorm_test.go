@@ -0,0 +1,93 @@
+package urlnorm
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string // Empty if the URL is refused
+	}{
+		// Scheme and host case
+		{"HTTPS://Example.COM/File.iso", "https://example.com/File.iso"},
+		{"  https://example.com/a.iso  ", "https://example.com/a.iso"},
+		{"https://example.com", "https://example.com/"},
+
+		// Default ports
+		{"http://example.com:80/a", "http://example.com/a"},
+		{"https://example.com:443/a", "https://example.com/a"},
+		{"ftp://example.com:21/a", "ftp://example.com/a"},
+		{"ftps://example.com:990/a", "ftps://example.com/a"},
+		{"https://example.com:80/a", "https://example.com:80/a"},
+		{"http://example.com:8080/a", "http://example.com:8080/a"},
+		{"http://[2001:DB8::1]:80/a", "http://[2001:db8::1]/a"},
+		{"http://[2001:db8::1]:8080/a", "http://[2001:db8::1]:8080/a"},
+
+		// Percent-escapes
+		{"https://example.com/a%2fb", "https://example.com/a%2Fb"},
+		{"https://example.com/%7euser/a%2Db", "https://example.com/~user/a-b"},
+		{"https://example.com/caf%c3%a9", "https://example.com/caf%C3%A9"},
+		{"https://example.com/a%20b", "https://example.com/a%20b"},
+		{"https://example.com/a?q=%2f%7E&r=%e2%82%ac", "https://example.com/a?q=%2F~&r=%E2%82%AC"},
+
+		// Fragments
+		{"https://example.com/a.iso#top", "https://example.com/a.iso"},
+		{"https://example.com/a.iso?v=1#", "https://example.com/a.iso?v=1"},
+		{"https://example.com/a.iso?#x", "https://example.com/a.iso"},
+
+		// International hosts
+		{"https://bücher.example/a", "https://xn--bcher-kva.example/a"},
+		{"https://BÜCHER.example/a", "https://xn--bcher-kva.example/a"},
+		{"https://XN--BCHER-KVA.example/a", "https://xn--bcher-kva.example/a"},
+		{"https://b%C3%BCcher.example/a", "https://xn--bcher-kva.example/a"},
+		{"https://my_host.example/a", "https://my_host.example/a"},
+
+		// Tracking parameters
+		{"https://example.com/a?utm_source=x&id=1&UTM_Medium=y&fbclid=z", "https://example.com/a?id=1"},
+		{"https://example.com/a?utm_source=x", "https://example.com/a"},
+		{"https://example.com/a?b=2&a=1", "https://example.com/a?b=2&a=1"},
+		{"https://example.com/a?utm%5Fsource=x&id=1", "https://example.com/a?id=1"},
+
+		// Object stores
+		{"S3://Bucket/Key", "s3://bucket/Key"},
+
+		// Refused
+		{"file:///etc/passwd", ""},
+		{"https:///a", ""},
+		{"https://example.com:port/a", ""},
+	}
+	for _, test := range tests {
+		got, err := Normalize(test.raw, DefaultRules)
+		switch {
+		case test.want == "" && err == nil:
+			t.Errorf("Normalize(%q) = %q, want an error", test.raw, got)
+		case test.want != "" && err != nil:
+			t.Errorf("Normalize(%q): %v", test.raw, err)
+		case got != test.want:
+			t.Errorf("Normalize(%q) = %q, want %q", test.raw, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeSameFile(t *testing.T) {
+	same := []string{
+		"https://bücher.example/caf%c3%a9/%7Ea.iso?utm_source=x#part",
+		"HTTPS://xn--bcher-kva.EXAMPLE:443/caf%C3%A9/~a.iso",
+		"https://BÜCHER.example/caf%C3%a9/%7ea.iso?fbclid=y",
+	}
+	want, err := Normalize(same[0], DefaultRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range same[1:] {
+		if got, err := Normalize(raw, DefaultRules); err != nil || got != want {
+			t.Errorf("Normalize(%q) = %q, %v, want %q", raw, got, err, want)
+		}
+	}
+}
+
+func TestNormalizeWithoutRules(t *testing.T) {
+	const raw = "https://example.com/a?utm_source=x&id=1"
+	if got, err := Normalize(raw, nil); err != nil || got != raw {
+		t.Errorf("Normalize(%q, nil) = %q, %v, want it unchanged", raw, got, err)
+	}
+}
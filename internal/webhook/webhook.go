@@ -0,0 +1,180 @@
+// Package webhook posts events to URLs that other systems listen on, such
+// as a pipeline that picks up finished downloads. Each event is a JSON
+// POST, signed with HMAC-SHA256 when the hook has a secret so the receiver
+// can tell it came from this server. Deliveries that fail are retried with
+// a growing pause.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// The events a hook can ask for.
+const (
+	Completed   = "completed"
+	Failed      = "failed"
+	Paused      = "paused"
+	Resumed     = "resumed"
+	Quarantined = "quarantined"
+)
+
+// Events lists every event.
+var Events = []string{Completed, Failed, Paused, Resumed, Quarantined}
+
+const (
+	// EventHeader names the event of a delivery.
+	EventHeader = "X-Datablip-Event"
+	// DeliveryHeader identifies a delivery; retries of it keep the ID, so
+	// receivers can drop duplicates.
+	DeliveryHeader = "X-Datablip-Delivery"
+	// TimestampHeader is the Unix time a delivery attempt was signed at.
+	TimestampHeader = "X-Datablip-Timestamp"
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256, keyed with
+	// the hook's secret, of the timestamp, a dot and the body.
+	SignatureHeader = "X-Datablip-Signature"
+
+	// DefaultAttempts is how many times a delivery is tried.
+	DefaultAttempts = 5
+	// DefaultBackoff is the pause before the first retry, doubled for each
+	// one after up to maxBackoff.
+	DefaultBackoff = 2 * time.Second
+
+	maxBackoff = time.Minute
+	timeout    = 10 * time.Second
+)
+
+// Hook is a URL that receives events.
+type Hook struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"` // Signs deliveries; unsigned without one
+	Events []string `json:"events,omitempty"` // Empty for every event
+}
+
+// Wants reports whether the hook receives event.
+func (h Hook) Wants(event string) bool {
+	return len(h.Events) == 0 || slices.Contains(h.Events, event)
+}
+
+// Validate reports a hook that can't be delivered to.
+func (h Hook) Validate() error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url %q must be an http or https URL", h.URL)
+	}
+	for _, event := range h.Events {
+		if !slices.Contains(Events, event) {
+			return fmt.Errorf("unknown event %q; known events are %v", event, Events)
+		}
+	}
+	return nil
+}
+
+// Load reads a JSON array of hooks from the file at path.
+func Load(path string) ([]Hook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var hooks []Hook
+	if err := json.Unmarshal(data, &hooks); err != nil {
+		return nil, fmt.Errorf("invalid webhooks in %s: %v", path, err)
+	}
+	for i, hook := range hooks {
+		if err := hook.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid webhook %d in %s: %v", i+1, path, err)
+		}
+	}
+	return hooks, nil
+}
+
+// Sign returns the SignatureHeader value for body sent at timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sender delivers events.
+type Sender struct {
+	Client   *http.Client
+	Attempts int
+	Backoff  time.Duration
+}
+
+// NewSender returns a sender with the default attempts and backoff.
+func NewSender() *Sender {
+	return &Sender{
+		Client:   &http.Client{Timeout: timeout},
+		Attempts: DefaultAttempts,
+		Backoff:  DefaultBackoff,
+	}
+}
+
+// Deliver posts body, the JSON of event, to hook until it is accepted with
+// a 2xx status, the attempts run out, or ctx is done. A 4xx status other
+// than 408 or 429 means the receiver rejects the event, so it isn't
+// retried.
+func (s *Sender) Deliver(ctx context.Context, hook Hook, event, id string, body []byte) error {
+	backoff := s.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		if retry, err = s.post(ctx, hook, event, id, body); err == nil || !retry || attempt >= s.Attempts {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// post makes one attempt at a delivery, reporting whether a failure is
+// worth retrying.
+func (s *Sender) post(ctx context.Context, hook Hook, event, id string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Datablip-Webhook")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, id)
+	if hook.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, timestamp, body))
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return false, fmt.Errorf("%s rejected the event: %s", hook.URL, resp.Status)
+	default:
+		return true, fmt.Errorf("%s returned %s", hook.URL, resp.Status)
+	}
+}
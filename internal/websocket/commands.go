@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/govind1331/Datablip/internal/api"
+)
+
+// command asks the server to act on a download, as the REST API would.
+type command struct {
+	Type       string                     `json:"type"`                 // add, pause, resume, cancel or setLimit
+	ID         string                     `json:"id,omitempty"`         // Echoed in the ack, to match it up
+	DownloadID string                     `json:"downloadId,omitempty"` // For all but add
+	RateLimit  int64                      `json:"rateLimit,omitempty"`  // For setLimit: bytes/s, 0 removes the limit
+	Download   *api.CreateDownloadRequest `json:"download,omitempty"`   // For add
+}
+
+// ack answers a command, once it has been carried out or has failed.
+type ack struct {
+	Type    string `json:"type"` // Always "ack"
+	ID      string `json:"id,omitempty"`
+	Command string `json:"command,omitempty"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Data    any    `json:"data,omitempty"` // The download, for add
+}
+
+// reply is an ack on its way to client.
+type reply struct {
+	client *Client
+	data   []byte
+}
+
+// execute carries out cmd and returns its ack.
+func (h *Hub) execute(cmd command) ack {
+	data, err := h.run(cmd)
+	if err != nil {
+		return ack{Type: "ack", ID: cmd.ID, Command: cmd.Type, Error: err.Error()}
+	}
+	return ack{Type: "ack", ID: cmd.ID, Command: cmd.Type, OK: true, Data: data}
+}
+
+func (h *Hub) run(cmd command) (any, error) {
+	switch cmd.Type {
+	case "add":
+		req := cmd.Download
+		if req == nil {
+			return nil, fmt.Errorf("add needs a download")
+		}
+		return h.manager.AddDownload(req.URL, req.AddOptions())
+	case "pause":
+		return nil, h.manager.PauseDownload(cmd.DownloadID)
+	case "resume":
+		return nil, h.manager.ResumeDownload(cmd.DownloadID)
+	case "cancel":
+		return nil, h.manager.DeleteDownload(cmd.DownloadID)
+	case "setLimit":
+		return nil, h.manager.SetDownloadRateLimit(cmd.DownloadID, cmd.RateLimit)
+	}
+	return nil, fmt.Errorf("unknown command %q", cmd.Type)
+}
+
+// handle acts on a message from the client other than its ticket: a
+// subscription, which isn't acked, or a command.
+func (c *Client) handle(data []byte) {
+	var kind struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &kind); err != nil {
+		c.reply(ack{Type: "ack", Error: "invalid message: " + err.Error()})
+		return
+	}
+	if kind.Type == "subscribe" {
+		var message subscribeMessage
+		if err := json.Unmarshal(data, &message); err == nil {
+			c.subscribe(newFilter(message))
+		}
+		return
+	}
+	var cmd command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		c.reply(ack{Type: "ack", Command: kind.Type, Error: "invalid command: " + err.Error()})
+		return
+	}
+	c.reply(c.hub.execute(cmd))
+}
+
+// subscribe hands the client's new filter to Run.
+func (c *Client) subscribe(f filter) {
+	select {
+	case c.hub.subscribe <- subscription{client: c, filter: f}:
+	case <-c.hub.stopped:
+	}
+}
+
+// reply hands a to Run, which sends it unless the client is gone.
+func (c *Client) reply(a ack) {
+	data, _ := json.Marshal(a)
+	select {
+	case c.hub.replies <- reply{client: c, data: data}:
+	case <-c.hub.stopped:
+	}
+}
@@ -4,29 +4,118 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/govind1331/Datablip/internal/downloader"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins in development
-	},
-}
+// closeTimeout bounds how long a client's close frame may take to send.
+const closeTimeout = time.Second
+
+// authTimeout bounds how long a client that connected without a ticket may
+// take to send one.
+const authTimeout = 10 * time.Second
+
+// maxAuthMessage bounds the first message of a client not yet authorized.
+const maxAuthMessage = 1024
+
+const (
+	// writeTimeout bounds how long a message may take to send, so a client
+	// that stopped reading is dropped rather than holding its writer.
+	writeTimeout = 10 * time.Second
+	// pongTimeout is how long a client may go without answering a ping, or
+	// sending anything, before its connection is taken for dead.
+	pongTimeout = 60 * time.Second
+	// pingInterval leaves a ping time to be answered within pongTimeout.
+	pingInterval = pongTimeout * 9 / 10
+)
 
 type Hub struct {
 	clients    map[*Client]bool
 	broadcast  chan []byte
 	register   chan *Client
 	unregister chan *Client
+	subscribe  chan subscription
+	replies    chan reply
 	manager    *downloader.Manager
+	stop       chan struct{} // Closed by Close
+	stopped    chan struct{} // Closed once Run has closed every client
+	lastSeq    uint64        // Of the last update Run broadcast
+
+	// Authorize, if set, reports whether a client may connect, given the
+	// ticket it brought, or "" to check the request alone. Clients that
+	// aren't authorized by the request must send their ticket as the first
+	// message, {"type": "auth", "ticket": "..."}, or are disconnected
+	// before receiving anything.
+	Authorize func(r *http.Request, ticket string) bool
+
+	// CheckOrigin, if set, reports whether the page a browser client was
+	// opened from may connect; otherwise only the server's own may.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// authMessage is the first message of a client that connected without a
+// ticket.
+type authMessage struct {
+	Type   string `json:"type"`
+	Ticket string `json:"ticket"`
+}
+
+// subscribeMessage narrows the updates a client receives to those of the
+// downloads and of the types listed. An empty list doesn't narrow, so
+// {"type": "subscribe"} alone brings back every update.
+type subscribeMessage struct {
+	Type      string   `json:"type"`
+	Downloads []string `json:"downloads,omitempty"`
+	Types     []string `json:"types,omitempty"`
+}
+
+// filter is what a client subscribed to; a nil set lets everything through.
+type filter struct {
+	downloads map[string]bool
+	types     map[string]bool
+}
+
+func newFilter(message subscribeMessage) filter {
+	return filter{downloads: set(message.Downloads), types: set(message.Types)}
+}
+
+// set returns values as a set, or nil if there are none.
+func set(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	s := make(map[string]bool, len(values))
+	for _, v := range values {
+		s[v] = true
+	}
+	return s
+}
+
+// matches reports whether update passes f.
+func (f filter) matches(update downloader.DownloadUpdate) bool {
+	return (f.downloads == nil || f.downloads[update.DownloadID]) &&
+		(f.types == nil || f.types[update.Type])
+}
+
+// subscription changes the filter of client.
+type subscription struct {
+	client *Client
+	filter filter
 }
 
 type Client struct {
-	hub  *Hub
-	conn *websocket.Conn
-	send chan []byte
+	hub    *Hub
+	conn   *websocket.Conn
+	send   chan []byte
+	filter filter // Only used by Run
+
+	// since, with replay, is the sequence number of the last update the
+	// client got before it reconnected.
+	since  uint64
+	replay bool
 }
 
 func NewHub(manager *downloader.Manager) *Hub {
@@ -35,7 +124,11 @@ func NewHub(manager *downloader.Manager) *Hub {
 		broadcast:  make(chan []byte),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		subscribe:  make(chan subscription),
+		replies:    make(chan reply),
 		manager:    manager,
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
 	}
 }
 
@@ -45,9 +138,21 @@ func (h *Hub) Run() {
 
 	for {
 		select {
+		case <-h.stop:
+			for client := range h.clients {
+				goingAway(client.conn)
+				delete(h.clients, client)
+				close(client.send)
+			}
+			close(h.stopped)
+			return
+
 		case client := <-h.register:
 			h.clients[client] = true
 			log.Println("Client connected")
+			if client.replay {
+				h.replay(client)
+			}
 
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
@@ -56,6 +161,22 @@ func (h *Hub) Run() {
 				log.Println("Client disconnected")
 			}
 
+		case sub := <-h.subscribe:
+			if _, ok := h.clients[sub.client]; ok {
+				sub.client.filter = sub.filter
+			}
+
+		case r := <-h.replies:
+			if _, ok := h.clients[r.client]; !ok {
+				break
+			}
+			select {
+			case r.client.send <- r.data:
+			default:
+				close(r.client.send)
+				delete(h.clients, r.client)
+			}
+
 		case message := <-h.broadcast:
 			for client := range h.clients {
 				select {
@@ -67,9 +188,13 @@ func (h *Hub) Run() {
 			}
 
 		case update := <-updates:
-			// Broadcast download updates to all clients
+			h.lastSeq = update.Seq
+			// Broadcast download updates to the clients subscribed to them
 			data, _ := json.Marshal(update)
 			for client := range h.clients {
+				if !client.filter.matches(update) {
+					continue
+				}
 				select {
 				case client.send <- data:
 				default:
@@ -81,45 +206,167 @@ func (h *Hub) Run() {
 	}
 }
 
+// replay sends client the updates it missed while it was away: those after
+// client.since up to the last one broadcast, as the rest are on their way.
+// If they are no longer all kept, or wouldn't fit in its buffer, it gets a
+// resync update instead, telling it to fetch every download again. Run
+// calls it.
+func (h *Hub) replay(client *Client) {
+	missed, ok := h.manager.EventsSince(client.since)
+	for len(missed) > 0 && missed[len(missed)-1].Seq > h.lastSeq {
+		missed = missed[:len(missed)-1]
+	}
+	if !ok || len(missed) > cap(client.send) {
+		data, _ := json.Marshal(downloader.DownloadUpdate{Type: "resync", Seq: h.lastSeq})
+		client.send <- data
+		return
+	}
+	for _, update := range missed {
+		data, _ := json.Marshal(update)
+		client.send <- data
+	}
+}
+
+// Close sends every client a close frame saying the server is going away
+// and disconnects it. It returns once they are all closed; Run then
+// returns.
+func (h *Hub) Close() {
+	close(h.stop)
+	<-h.stopped
+}
+
+// goingAway tells the client on conn that the server is shutting down.
+func goingAway(conn *websocket.Conn) {
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeTimeout))
+}
+
 func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	replay := r.URL.Query().Has("since")
+	if replay {
+		var err error
+		if since, err = strconv.ParseUint(r.URL.Query().Get("since"), 10, 64); err != nil {
+			http.Error(w, "since must be the seq of an update", http.StatusBadRequest)
+			return
+		}
+	}
+
+	authorized := h.Authorize == nil
+	if !authorized {
+		if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+			if !h.Authorize(r, ticket) {
+				http.Error(w, "invalid or expired ticket", http.StatusUnauthorized)
+				return
+			}
+			authorized = true
+		} else {
+			authorized = h.Authorize(r, "")
+		}
+	}
+
+	upgrader := websocket.Upgrader{CheckOrigin: h.CheckOrigin}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
+	if !authorized && !h.authenticate(r, conn) {
+		conn.Close()
+		return
+	}
 
 	client := &Client{
-		hub:  h,
-		conn: conn,
-		send: make(chan []byte, 256),
+		hub:    h,
+		conn:   conn,
+		send:   make(chan []byte, 256),
+		since:  since,
+		replay: replay,
 	}
 
-	client.hub.register <- client
+	select {
+	case client.hub.register <- client:
+	case <-h.stopped:
+		goingAway(conn)
+		conn.Close()
+		return
+	}
 
 	go client.writePump()
 	go client.readPump()
 }
 
+// authenticate waits for the ticket of the client on conn, telling it why it
+// is disconnected if it doesn't send a valid one in time.
+func (h *Hub) authenticate(r *http.Request, conn *websocket.Conn) bool {
+	conn.SetReadLimit(maxAuthMessage)
+	conn.SetReadDeadline(time.Now().Add(authTimeout))
+	var message authMessage
+	if err := conn.ReadJSON(&message); err != nil || message.Type != "auth" {
+		refuse(conn, "authentication required")
+		return false
+	}
+	if !h.Authorize(r, message.Ticket) {
+		refuse(conn, "invalid or expired ticket")
+		return false
+	}
+	conn.SetReadLimit(0)
+	conn.SetReadDeadline(time.Time{})
+	return true
+}
+
+// refuse tells the client on conn that it isn't authorized.
+func refuse(conn *websocket.Conn, reason string) {
+	message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeTimeout))
+}
+
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.stopped:
+		}
 		c.conn.Close()
 	}()
 
+	// Connections that went away without closing, such as those dropped
+	// by a NAT, stop answering pings and hit the deadline
+	c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			break
 		}
+		c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+		c.handle(data)
 	}
 }
 
 func (c *Client) writePump() {
-	defer c.conn.Close()
+	ticker := time.NewTicker(pingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
 
-	for message := range c.send {
-		if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			break
+	for {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				return // Dropped by the hub; closing makes readPump return
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
 		}
 	}
 }
@@ -0,0 +1,94 @@
+package datablip
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/govind1331/Datablip/internal/conflict"
+)
+
+// resolveConflict applies OnConflict if OutputPath already exists and no
+// partial download of it is waiting to resume.
+func (d *Downloader) resolveConflict(ranges bool) error {
+	d.adoptSize = 0
+	info, err := os.Stat(d.OutputPath)
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(ResumeMetadataPath(d.OutputPath)); err == nil {
+		return nil
+	}
+	policy, err := conflict.Parse(d.OnConflict)
+	if err != nil {
+		return err
+	}
+
+	switch policy {
+	case conflict.Overwrite:
+		d.notify("Overwriting %s once the download is verified", d.OutputPath)
+	case conflict.Fail:
+		return fmt.Errorf("%s already exists", d.OutputPath)
+	case conflict.Resume:
+		switch {
+		case !ranges || d.fileSize <= 0:
+			return fmt.Errorf("%s already exists and can't be resumed: the server doesn't support range requests or send a size", d.OutputPath)
+		case info.Size() > d.fileSize:
+			return fmt.Errorf("%s already exists and is larger than the download (%d > %d bytes)", d.OutputPath, info.Size(), d.fileSize)
+		}
+		d.adoptSize = info.Size()
+		d.notify("Resuming from the %s already in %s", FormatBytes(d.adoptSize), d.OutputPath)
+	default:
+		existing := d.OutputPath
+		dir, base := filepath.Split(existing)
+		for n := 2; taken(d.OutputPath); n++ {
+			d.OutputPath = filepath.Join(dir, conflict.Numbered(base, n))
+		}
+		d.notify("%s already exists; saving as %s", existing, d.OutputPath)
+	}
+	d.logf("conflict: %s exists, policy=%s output=%s", info.Name(), policy, d.OutputPath)
+	return nil
+}
+
+// taken reports whether a file, or the part or control file of a download,
+// is at path.
+func taken(path string) bool {
+	for _, candidate := range []string{path, path + ".part", ResumeMetadataPath(path)} {
+		if _, err := os.Lstat(candidate); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// adoptOutput copies the first adoptSize bytes of the existing output file
+// into the chunk files of a fresh download, so its chunks carry on from them
+// and the merged result replaces the file once verified.
+func (d *Downloader) adoptOutput(meta *ResumeMetadata) error {
+	existing, err := os.Open(d.OutputPath)
+	if err != nil {
+		return fmt.Errorf("failed to resume from %s: %w", d.OutputPath, err)
+	}
+	defer existing.Close()
+
+	for _, chunk := range meta.Chunks {
+		n := min(d.adoptSize-chunk.StartByte, chunk.Size)
+		if n <= 0 {
+			continue
+		}
+		file, err := os.Create(meta.ChunkFile(chunk.ID))
+		if err != nil {
+			return fmt.Errorf("failed to resume from %s: %w", d.OutputPath, err)
+		}
+		_, err = io.Copy(file, io.NewSectionReader(existing, chunk.StartByte, n))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to resume from %s: %w", d.OutputPath, err)
+		}
+	}
+	d.logf("conflict: seeded chunks with %d bytes of %s", d.adoptSize, d.OutputPath)
+	return nil
+}
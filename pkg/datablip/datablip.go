@@ -0,0 +1,100 @@
+// Package datablip downloads a file over several HTTP range requests at
+// once, the engine behind the datablip command.
+//
+// Download covers the common case:
+//
+//	err := datablip.Download(ctx, datablip.Options{
+//		URL:    "https://example.com/file.iso",
+//		Output: "file.iso",
+//		Progress: func(p datablip.Progress) {
+//			fmt.Printf("\r%.1f%% %s", p.Percent(), datablip.FormatSpeed(p.Speed))
+//		},
+//	})
+//
+// A Downloader gives access to every setting, and can be paused, resumed and
+// have its speed limit changed while it runs. Cancelling the context stops
+// the download and, unless KeepPartial is off, keeps what was fetched so a
+// later download of the same URL to the same output carries on from there.
+package datablip
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Options configures Download. Only URL and Output are required; zero
+// values pick the defaults.
+type Options struct {
+	URL            string
+	Mirrors        []string // More URLs of the same file; chunks are spread across all of them
+	Output         string
+	Connections    int   // Number of chunks downloaded concurrently; 0 picks from the file size and round trip
+	ChunkSize      int64 // Split by size instead of Connections when > 0
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	MaxTime        time.Duration // Abort the whole download after this long when > 0
+	RateLimit      float64       // Cap on the combined speed in bytes/s; 0 is unlimited
+	Checksum       string        // The file must match this, such as "sha256:9f86d081..."
+	DiscardPartial bool          // Remove what was fetched when the download fails
+	Retries        int           // Times in a row a failed chunk is retried; 0 picks the default, < 0 disables
+	RetryBackoff   time.Duration // Pause before the first retry, doubled for each one after
+	MaxRedirects   int           // Redirects in a row a request follows; 0 picks the default, < 0 follows none
+
+	// Headers are sent with every request. Cookie and, when Username is
+	// set, basic auth only go to the host of URL, not to mirrors elsewhere.
+	Headers  map[string]string
+	Cookie   string
+	Username string
+	Password string
+
+	// CookiesFile is a browser's cookies.txt export, sent as it would be.
+	CookiesFile string
+
+	// Progress, if set, is called every ProgressInterval with the state of
+	// the download.
+	Progress func(Progress)
+
+	// Log, if set, receives a detailed log of every request and chunk.
+	Log io.Writer
+}
+
+// Download fetches opts.URL into opts.Output and returns once the file is
+// complete and verified, or the download failed or ctx was cancelled. A
+// checksum that doesn't match gives an error wrapping ErrChecksumMismatch.
+func Download(ctx context.Context, opts Options) error {
+	d := NewDownloader(opts.URL, opts.Output, opts.Connections)
+	d.Mirrors = opts.Mirrors
+	d.ChunkSize = opts.ChunkSize
+	if opts.ConnectTimeout > 0 {
+		d.ConnectTimeout = opts.ConnectTimeout
+	}
+	if opts.ReadTimeout > 0 {
+		d.ReadTimeout = opts.ReadTimeout
+	}
+	d.MaxTime = opts.MaxTime
+	if opts.Retries != 0 {
+		d.Retries = max(opts.Retries, 0)
+	}
+	if opts.RetryBackoff > 0 {
+		d.RetryBackoff = opts.RetryBackoff
+	}
+	if opts.MaxRedirects != 0 {
+		d.MaxRedirects = max(opts.MaxRedirects, 0)
+	}
+	d.Checksum = opts.Checksum
+	d.Headers = opts.Headers
+	d.Cookie = opts.Cookie
+	d.Username = opts.Username
+	d.Password = opts.Password
+	d.CookiesFile = opts.CookiesFile
+	d.KeepPartial = !opts.DiscardPartial
+	d.Progress = opts.Progress
+	if opts.RateLimit > 0 {
+		d.SetRateLimit(opts.RateLimit)
+	}
+	if opts.Log != nil {
+		d.SetLogOutput(opts.Log)
+	}
+	return d.Download(ctx)
+}
@@ -0,0 +1,1265 @@
+package datablip
+
+import (
+	"cmp"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/autochunk"
+	"github.com/govind1331/Datablip/internal/bufpool"
+	"github.com/govind1331/Datablip/internal/conflict"
+	"github.com/govind1331/Datablip/internal/cookiestxt"
+	"github.com/govind1331/Datablip/internal/digest"
+	"github.com/govind1331/Datablip/internal/endgame"
+	"github.com/govind1331/Datablip/internal/fastcopy"
+	"github.com/govind1331/Datablip/internal/idle"
+	"github.com/govind1331/Datablip/internal/mirror"
+	"github.com/govind1331/Datablip/internal/nametemplate"
+	"github.com/govind1331/Datablip/internal/netwait"
+	"github.com/govind1331/Datablip/internal/pause"
+	"github.com/govind1331/Datablip/internal/rangeprobe"
+	"github.com/govind1331/Datablip/internal/ratelimit"
+	"github.com/govind1331/Datablip/internal/redirect"
+	"github.com/govind1331/Datablip/internal/reqauth"
+	"github.com/govind1331/Datablip/internal/retry"
+	"github.com/govind1331/Datablip/internal/savename"
+	"github.com/govind1331/Datablip/internal/stall"
+	"github.com/govind1331/Datablip/internal/transport"
+)
+
+// errShortRange means a response ended before the whole requested range
+// arrived.
+var errShortRange = errors.New("response ended early")
+
+// errRangeIgnored means the server answered a range request with the whole
+// file, so the download can't be split across connections.
+var errRangeIgnored = errors.New("server ignored range request")
+
+// maxTailRequests is how many requests in a row for a short chunk's missing
+// tail may come back empty before the chunk fails.
+const maxTailRequests = 3
+
+// ErrChecksumMismatch is returned, wrapped, when the downloaded file doesn't
+// match Checksum or a checksum the server advertised.
+var ErrChecksumMismatch = digest.ErrMismatch
+
+const (
+	DefaultConnectTimeout = 30 * time.Second // Connection timeout
+	DefaultReadTimeout    = 5 * time.Minute  // Per-chunk read timeout
+)
+
+// ChunkInfo is the byte range of the file one chunk covers.
+type ChunkInfo struct {
+	ID        int   `json:"id"`
+	StartByte int64 `json:"startByte"`
+	EndByte   int64 `json:"endByte"`
+	Size      int64 `json:"size"`
+}
+
+// Downloader fetches one file. Set its fields before calling Download; the
+// rate limit, Pause and Resume may be changed while it runs.
+type Downloader struct {
+	URL             string
+	Mirrors         []string // More URLs of the same file; chunks are spread across all of them
+	OutputPath      string
+	OutputTemplate  string // Replaces OutputPath once the file is probed, such as "{date}/{host}/{basename}"
+	OnConflict      string // If OutputPath exists: "rename" (the default), "overwrite", "resume" or "fail"
+	Chunks          int    // Number of chunks, and the number downloaded concurrently; 0 picks automatically
+	ChunkSize       int64  // Split by size instead of count when > 0
+	ConnectTimeout  time.Duration
+	ReadTimeout     time.Duration
+	MaxTime         time.Duration // Abort the whole download after this long when > 0
+	KeepPartial     bool          // Keep resumable state when the download fails
+	Endgame         bool          // Race a second connection against straggling chunks near the end
+	TempDir         string        // Where chunk files are kept; empty uses the output file's directory
+	StallSpeed      float64       // Restart a chunk's connection below this many bytes/s; 0 disables
+	StallTime       time.Duration // How long a chunk may stay below StallSpeed
+	Hosts           HostStats     // Records the throughput of finished downloads when set
+	AutoConnections bool          // Use no more automatic chunks than Hosts recommends
+	Checksum        string        // The file must match this checksum, such as "sha256:9f86d081..."
+	Retries         int           // Times in a row a failed chunk is requested again from where it stopped
+	RetryBackoff    time.Duration // Pause before the first retry, doubled for each one after
+	MaxRedirects    int           // Redirects in a row a request follows; Authorization and cookies stay with the first host
+
+	// Headers are sent with every request, to mirrors too. Cookie and, when
+	// Username is set, basic auth only go to the host of URL.
+	Headers  map[string]string
+	Cookie   string
+	Username string
+	Password string
+
+	// CookiesFile is a cookies.txt a browser exported, whose cookies are
+	// sent to the hosts that set them, as the browser would.
+	CookiesFile string
+
+	// Progress, if set, is called every ProgressInterval while the chunks
+	// download and while they are merged, and once more when each ends.
+	Progress func(Progress)
+
+	// Notify, if set, receives a line for each step of the download, such
+	// as the chunk count picked or a fallback to a single connection. The
+	// format is always a constant, so it can serve as a translation key.
+	Notify func(format string, args ...any)
+
+	singleStream    bool              // Fetch the whole file in one plain GET after ranges were ignored
+	checksum        []digest.Expected // Parsed from Checksum
+	client          *http.Client      // Shared by the probe and every chunk request
+	connStats       transport.Stats
+	warmer          *transport.Warmer
+	digests         []digest.Expected // Checksums advertised by the server
+	etag            string            // ETag advertised by the server
+	nameVars        nametemplate.Vars // What the probe learned for OutputTemplate
+	adoptSize       int64             // Bytes of an existing output file to resume from
+	fileSize        int64             // Once probed
+	journal         *Journal
+	trusted         map[int]int64 // Journaled bytes per chunk from an earlier run
+	progressManager *progressTracker
+	logger          *log.Logger
+	races           map[int]*chunkRace // Chunks in flight, by ID
+	racesMu         sync.Mutex
+	attempts        map[int]context.CancelCauseFunc // Cancels each chunk's request in flight
+	sources         map[int]string                  // Mirror of each chunk's request in flight
+	mirrors         *mirror.Set                     // URL and Mirrors
+	attemptsMu      sync.Mutex
+	pause           pause.Gate
+	limiter         *ratelimit.Limiter // Shared by every connection of the download
+}
+
+// NewDownloader returns a downloader of url into outputPath over the given
+// number of chunks, 0 picking a count once the file is probed, with every
+// other setting at its default.
+func NewDownloader(url, outputPath string, chunks int) *Downloader {
+	return &Downloader{
+		URL:            url,
+		OutputPath:     outputPath,
+		Chunks:         chunks,
+		ConnectTimeout: DefaultConnectTimeout,
+		ReadTimeout:    DefaultReadTimeout,
+		KeepPartial:    true,
+		Endgame:        true,
+		StallSpeed:     stall.DefaultSpeed,
+		StallTime:      stall.DefaultTime,
+		Retries:        retry.DefaultMax,
+		RetryBackoff:   retry.DefaultBackoff,
+		MaxRedirects:   redirect.DefaultMax,
+		client:         &http.Client{},
+		logger:         log.New(io.Discard, "", 0),
+		limiter:        ratelimit.New(0),
+	}
+}
+
+func (d *Downloader) SetTimeouts(connectTimeout, readTimeout time.Duration) {
+	d.ConnectTimeout = connectTimeout
+	d.ReadTimeout = readTimeout
+}
+
+// SetRateLimit caps the download's combined speed at bytesPerSec across all
+// connections; 0 removes the cap. It may be changed while downloading.
+func (d *Downloader) SetRateLimit(bytesPerSec float64) {
+	d.limiter.SetRate(bytesPerSec)
+	if bytesPerSec > 0 {
+		d.logf("download: rate limit set to %s", FormatSpeed(bytesPerSec))
+	} else {
+		d.logf("download: rate limit removed")
+	}
+}
+
+// RateLimit returns the speed cap in bytes per second, 0 when unlimited.
+func (d *Downloader) RateLimit() float64 {
+	return d.limiter.Rate()
+}
+
+// Pause stops every connection until Resume is called. Chunks keep what
+// they have fetched and carry on from there.
+func (d *Downloader) Pause() {
+	if d.pause.Pause() {
+		d.logf("download: paused")
+	}
+}
+
+func (d *Downloader) Resume() {
+	if d.pause.Resume() {
+		d.logf("download: resumed")
+	}
+}
+
+// Paused reports whether the download is paused.
+func (d *Downloader) Paused() bool {
+	return d.pause.Paused()
+}
+
+// SetLogOutput enables the detailed download log, written to w with
+// microsecond timestamps.
+func (d *Downloader) SetLogOutput(w io.Writer) {
+	d.logger = log.New(w, "", log.LstdFlags|log.Lmicroseconds)
+}
+
+// Logf adds a line to the detailed download log.
+func (d *Downloader) Logf(format string, args ...interface{}) {
+	d.logger.Printf(format, args...)
+}
+
+func (d *Downloader) logf(format string, args ...interface{}) {
+	d.logger.Printf(format, args...)
+}
+
+func (d *Downloader) notify(format string, args ...any) {
+	if d.Notify != nil {
+		d.Notify(format, args...)
+	}
+}
+
+// report passes p to d.Progress, if set.
+func (d *Downloader) report(p Progress) {
+	if d.Progress != nil {
+		p.Paused = d.Paused()
+		d.Progress(p)
+	}
+}
+
+// traceConn returns a request context that records which connection the
+// request used, logging it under label.
+func (d *Downloader) traceConn(ctx context.Context, label string) context.Context {
+	return d.connStats.Trace(ctx, func(conn transport.Conn) {
+		d.logf("%s: connection remote=%s reused=%v idle=%v", label, conn.Remote, conn.Reused, conn.IdleTime)
+	})
+}
+
+func (d *Downloader) auth() reqauth.Auth {
+	return reqauth.Auth{Headers: d.Headers, Cookie: d.Cookie, Username: d.Username, Password: d.Password}
+}
+
+// prepareClient has the client follow MaxRedirects and fills its cookie
+// jar from CookiesFile.
+func (d *Downloader) prepareClient() error {
+	d.client.CheckRedirect = redirect.Policy(max(d.MaxRedirects, 0))
+	d.client.Jar = nil
+	if d.CookiesFile == "" {
+		return nil
+	}
+	f, err := os.Open(d.CookiesFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	jar, loaded, err := cookiestxt.Read(f)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", d.CookiesFile, err)
+	}
+	d.client.Jar = jar
+	d.logf("cookies: loaded %d from %s", loaded, d.CookiesFile)
+	d.notify("Loaded %d cookies from %s", loaded, d.CookiesFile)
+	return nil
+}
+
+// authorize adds Headers to req, and Cookie and the credentials when req
+// goes to the host of URL rather than a mirror elsewhere.
+func (d *Downloader) authorize(req *http.Request) {
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return
+	}
+	d.auth().Apply(req, u.Host)
+}
+
+// FileInfo is what a probe learned about the remote file.
+type FileInfo struct {
+	Size   int64
+	Ranges bool // The server accepts range requests
+	HTTP2  bool
+	RTT    time.Duration // Round trip of the probe's connection
+}
+
+// Probe sends a HEAD request for the URL, without downloading anything, to
+// learn the file size, whether ranges are supported and how far away the
+// server is.
+func (d *Downloader) Probe(ctx context.Context) (FileInfo, error) {
+	if d.client.Transport == nil {
+		httpTransport := transport.New(d.ConnectTimeout, 1)
+		defer httpTransport.CloseIdleConnections()
+		d.client.Transport = httpTransport
+		defer func() { d.client.Transport = nil }()
+	}
+	if err := d.prepareClient(); err != nil {
+		return FileInfo{}, err
+	}
+	probe, err := d.probeFile(ctx)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{Size: probe.Size, Ranges: probe.Ranges, HTTP2: probe.HTTP2, RTT: probe.RTT}, nil
+}
+
+// probeFile sends a HEAD request to learn the file size, whether ranges are
+// supported and how far away the server is.
+func (d *Downloader) probeFile(ctx context.Context) (autochunk.Probe, error) {
+	d.notify("Getting file information from: %s", d.URL)
+	d.logf("probe: HEAD %s", d.URL)
+
+	ctx, rtt := autochunk.TraceRTT(d.traceConn(ctx, "probe"))
+	req, err := http.NewRequestWithContext(ctx, "HEAD", d.URL, nil)
+	if err != nil {
+		return autochunk.Probe{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	d.authorize(req)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		d.logf("probe: request failed: %v", err)
+	} else {
+		resp.Body.Close()
+		d.logf("probe: status=%d content-length=%d accept-ranges=%q etag=%q last-modified=%q final-url=%s",
+			resp.StatusCode, resp.ContentLength, resp.Header.Get("Accept-Ranges"),
+			resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), resp.Request.URL)
+	}
+	probe := autochunk.Probe{Size: -1, RTT: rtt()}
+	if err == nil {
+		probe.Size, probe.Ranges = resp.ContentLength, resp.Header.Get("Accept-Ranges") == "bytes"
+	}
+
+	// Some servers, and URLs signed for GET alone, reject HEAD or leave
+	// the size or range support out, while a GET, which may be sent to
+	// another CDN, answers both
+	if rangeprobe.Needed(resp) {
+		get, found, getErr := d.probeGet(ctx)
+		if getErr != nil {
+			d.logf("probe: ranged GET failed: %v", getErr)
+		} else {
+			resp, err = get, nil
+			probe.Size, probe.Ranges = found.Size, found.Ranges
+		}
+	}
+	if err != nil {
+		return autochunk.Probe{}, fmt.Errorf("failed to get file info: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return autochunk.Probe{}, fmt.Errorf("server returned status code %d", resp.StatusCode)
+	}
+	probe.HTTP2 = resp.ProtoMajor == 2
+	if probe.Size <= 0 {
+		return autochunk.Probe{}, fmt.Errorf("could not determine file size or server doesn't support range requests")
+	}
+	d.logf("probe: rtt=%v ranges=%v http2=%v", probe.RTT, probe.Ranges, probe.HTTP2)
+
+	d.digests = slices.Concat(d.checksum, digest.FromHeaders(resp.Header))
+	d.etag = resp.Header.Get("ETag")
+	d.nameVars = nametemplate.Vars{
+		URL:         resp.Request.URL,
+		Basename:    cmp.Or(savename.FromResponse(resp.Header, resp.Request.URL), "download"),
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	for _, expected := range d.digests {
+		d.logf("probe: server digest %s from %s", expected.Algorithm, expected.Source)
+	}
+
+	return probe, nil
+}
+
+// probeGet asks for the first byte of the file, to learn what a HEAD
+// request didn't.
+func (d *Downloader) probeGet(ctx context.Context) (*http.Response, rangeprobe.Result, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", d.URL, nil)
+	if err != nil {
+		return nil, rangeprobe.Result{}, err
+	}
+	d.authorize(req)
+	resp, found, err := rangeprobe.Get(d.client, req)
+	if err == nil {
+		d.logf("probe: GET first byte status=%d size=%d ranges=%v final-url=%s", resp.StatusCode, found.Size, found.Ranges, resp.Request.URL)
+	}
+	return resp, found, err
+}
+
+// createChunks splits the file into d.Chunks equal ranges, or into ranges of
+// d.ChunkSize bytes when a chunk size was requested.
+func (d *Downloader) createChunks(fileSize int64) []ChunkInfo {
+	var chunks []ChunkInfo
+	count := d.Chunks
+	chunkSize := fileSize / int64(count)
+
+	if d.ChunkSize > 0 {
+		chunkSize = d.ChunkSize
+		count = int((fileSize + chunkSize - 1) / chunkSize)
+	}
+	if chunkSize == 0 {
+		count, chunkSize = 1, fileSize
+	}
+
+	for i := 0; i < count; i++ {
+		startByte := int64(i) * chunkSize
+		endByte := startByte + chunkSize - 1
+
+		if i == count-1 {
+			endByte = fileSize - 1
+		}
+
+		chunkInfo := ChunkInfo{
+			ID:        i,
+			StartByte: startByte,
+			EndByte:   endByte,
+			Size:      endByte - startByte + 1,
+		}
+
+		chunks = append(chunks, chunkInfo)
+	}
+
+	return chunks
+}
+
+func (d *Downloader) downloadChunk(ctx context.Context, chunk ChunkInfo, outputFile string) error {
+	chunkProgress := d.progressManager.GetChunkProgress(chunk.ID)
+
+	// Pick up where an earlier run left off if the chunk file already exists
+	var existing int64
+	if info, err := os.Stat(outputFile); err == nil {
+		// A chunk split during an earlier run keeps the bytes it had
+		// fetched past its new end; they belong to the chunk split off
+		existing = min(info.Size(), chunk.Size)
+	}
+	// After a crash the file may be longer than what reached the disk
+	if trusted, ok := d.trustedBytes(chunk.ID); ok && trusted < existing {
+		d.logf("chunk %d: %d bytes on disk but only %d journaled, discarding the rest", chunk.ID, existing, trusted)
+		existing = trusted
+	}
+	chunkProgress.SetResumed(existing)
+	if existing == chunk.Size {
+		d.logf("chunk %d: already complete on disk (%d bytes)", chunk.ID, existing)
+		chunkProgress.SetStatus("completed")
+		return nil
+	}
+
+	chunkProgress.SetStatus("downloading")
+
+	output, err := os.OpenFile(outputFile, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		chunkProgress.SetStatus("failed")
+		return fmt.Errorf("failed to create output file for chunk %d: %w", chunk.ID, err)
+	}
+	defer output.Close()
+
+	if err := output.Truncate(existing); err != nil {
+		chunkProgress.SetStatus("failed")
+		return fmt.Errorf("failed to prepare output file for chunk %d: %w", chunk.ID, err)
+	}
+	d.checkpoint("start", chunk.ID, output, existing)
+	stopCheckpoints := d.checkpoints(chunk.ID, output, chunkProgress)
+
+	// Register the chunk so endgame mode can race a second connection
+	// against it if it falls behind
+	raceCtx, race := endgame.New(ctx)
+	d.trackRace(chunk, outputFile, race)
+	defer d.untrackRace(chunk.ID)
+
+	started := time.Now()
+	label := fmt.Sprintf("chunk %d", chunk.ID)
+	pos := existing
+	for stalled, reconnects, retries := 0, 0, 0; ; {
+		var written int64
+		written, err = d.fetchAttempt(raceCtx, label, chunk, pos, output, chunkProgress)
+		pos += written
+		if written > 0 {
+			stalled, reconnects, retries = 0, 0, 0
+		}
+
+		if size := chunkProgress.Total(); size < chunk.Size {
+			// The splitter handed the rest of the chunk to a new one
+			chunk.Size, chunk.EndByte = size, chunk.StartByte+size-1
+			if pos >= size {
+				if pos > size {
+					if err = output.Truncate(size); err != nil {
+						err = fmt.Errorf("failed to trim split chunk %d: %w", chunk.ID, err)
+						break
+					}
+					chunkProgress.SetTotal(size)
+				}
+				pos, err = size, nil
+				break
+			}
+		}
+		if errors.Is(err, errSplit) {
+			d.logf("%s: split, requesting again up to offset %d", label, chunk.Size)
+			continue
+		}
+
+		if errors.Is(err, pause.ErrPaused) {
+			chunkProgress.SetStatus("paused")
+			if err = d.pause.Wait(raceCtx); err != nil {
+				break
+			}
+			chunkProgress.SetStatus("downloading")
+			continue
+		}
+
+		if errors.Is(err, mirror.ErrDropped) {
+			d.logf("%s: moving to another mirror at offset %d", label, pos)
+			continue
+		}
+
+		if errors.Is(err, stall.ErrStalled) {
+			chunkProgress.AddRestart()
+			d.logf("%s: stalled, requesting again from offset %d", label, pos)
+			continue
+		}
+
+		if netwait.Dropped(err) && reconnects < netwait.MaxReconnects {
+			reconnects++
+			if err = d.awaitNetwork(raceCtx, label, pos, err, chunkProgress); err != nil {
+				break
+			}
+			continue
+		}
+
+		if written == 0 {
+			stalled++
+		}
+		if errors.Is(err, errShortRange) && stalled <= maxTailRequests {
+			// Ask again for just the bytes that didn't arrive
+			d.logf("%s: %v; requesting the missing %d bytes", label, err, chunk.Size-pos)
+			continue
+		}
+
+		if err == nil || errors.Is(err, errRangeIgnored) || retries >= d.Retries || raceCtx.Err() != nil {
+			break
+		}
+		retries++
+		d.logf("%s: %v; retry %d of %d from offset %d in %v", label, err, retries, d.Retries, pos, retry.Delay(d.RetryBackoff, retries))
+		chunkProgress.SetStatus("reconnecting")
+		if err = retry.Wait(raceCtx, d.RetryBackoff, retries); err != nil {
+			break
+		}
+		chunkProgress.SetStatus("downloading")
+		stalled = 0
+	}
+
+	byHelper, err := race.Finish(err)
+	stopCheckpoints()
+	if err != nil {
+		if race.Helping() {
+			// A failed helper may have written past the contiguous prefix,
+			// which resume relies on
+			output.Truncate(pos)
+		}
+		d.checkpoint("checkpoint", chunk.ID, output, pos)
+		chunkProgress.SetStatus("failed")
+		return err
+	}
+	d.checkpoint("complete", chunk.ID, output, chunk.Size)
+
+	if byHelper {
+		d.logf("chunk %d: completed by endgame connection after %v", chunk.ID, time.Since(started).Round(time.Millisecond))
+	} else {
+		d.logf("chunk %d: completed %d bytes in %v", chunk.ID, pos-existing, time.Since(started).Round(time.Millisecond))
+	}
+	chunkProgress.SetStatus("completed")
+	return nil
+}
+
+// prewarm opens connections for the chunks that will start at once, so
+// they don't each wait for their own handshakes. The probe's connection is
+// still idle in the pool, so one fewer is needed.
+func (d *Downloader) prewarm(ctx context.Context, connections int) {
+	if d.warmer == nil || connections < 2 {
+		return
+	}
+	started := time.Now()
+	opened, err := d.warmer.Prewarm(ctx, d.URL, connections-1)
+	if err != nil {
+		d.logf("download: pre-warming connections failed: %v", err)
+		return
+	}
+	d.logf("download: pre-warmed %d connections in %v", opened, time.Since(started).Round(time.Millisecond))
+}
+
+// awaitNetwork waits for the server to become reachable again after the
+// chunk's connection dropped at pos, so the chunk can carry on from there.
+// Connections pooled before the drop are discarded, since a network change
+// leaves them dead.
+func (d *Downloader) awaitNetwork(ctx context.Context, label string, pos int64, cause error, chunkProgress *chunkState) error {
+	d.logf("%s: connection lost at offset %d: %v; waiting for the network", label, pos, cause)
+	chunkProgress.SetStatus("reconnecting")
+
+	started := time.Now()
+	if err := netwait.WaitForHost(ctx, d.URL, netwait.MaxOutage); err != nil {
+		d.logf("%s: network did not come back: %v", label, err)
+		return fmt.Errorf("%w (waiting to reconnect: %v)", cause, err)
+	}
+	d.client.CloseIdleConnections()
+
+	d.logf("%s: server reachable again after %v, resuming at offset %d", label, time.Since(started).Round(time.Millisecond), pos)
+	chunkProgress.SetStatus("downloading")
+	return nil
+}
+
+// fetchRange downloads the chunk from offset onwards from url, one of the
+// mirrors, into file, reporting progress as it goes, and returns the number
+// of bytes written. It never writes past the end of the chunk, and a
+// response that ends early returns an error wrapping errShortRange.
+func (d *Downloader) fetchRange(ctx context.Context, url, label string, chunk ChunkInfo, offset int64, file *os.File, chunkProgress *chunkState) (int64, error) {
+	// The watchdog cancels the request if no data arrives for ReadTimeout,
+	// which aborts a body read that would otherwise block indefinitely
+	chunkCtx, watchdog := idle.WithTimeout(ctx, d.ReadTimeout)
+	defer watchdog.Stop()
+
+	req, err := http.NewRequestWithContext(d.traceConn(chunkCtx, label), "GET", url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if d.singleStream {
+		d.logf("%s: start without range resumed=%d", label, offset)
+	} else {
+		rangeHeader := fmt.Sprintf("bytes=%d-%d", chunk.StartByte+offset, chunk.EndByte)
+		d.logf("%s: start range=%s resumed=%d", label, rangeHeader, offset)
+		req.Header.Set("Range", rangeHeader)
+	}
+	req.Header.Set("User-Agent", "MultiPartDownloader/1.0")
+	d.authorize(req)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to make request for %s: %w", label, idle.Cause(chunkCtx, err))
+	}
+	defer resp.Body.Close()
+
+	d.logf("%s: response status=%d content-length=%d content-range=%q",
+		label, resp.StatusCode, resp.ContentLength, resp.Header.Get("Content-Range"))
+
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s: server returned status code %d", label, resp.StatusCode)
+	}
+
+	// A full response only fits a request for the whole file; anything else
+	// would write the start of the file at this chunk's offset
+	remaining := chunk.Size - offset
+	if resp.StatusCode == http.StatusOK {
+		wholeFile := chunk.StartByte+offset == 0 && (resp.ContentLength == remaining || d.singleStream)
+		if !wholeFile {
+			return 0, fmt.Errorf("%s: %w (status %d, %d bytes)", label, errRangeIgnored, resp.StatusCode, resp.ContentLength)
+		}
+	}
+
+	// The request may have been redirected to another server than the
+	// probe was, which can hold another version of the file
+	if size, ok := mirror.FileSize(resp); ok && size != d.fileSize {
+		if url == d.URL {
+			return 0, fmt.Errorf("%s: %s has a file of %d bytes instead of %d", label, resp.Request.URL.Redacted(), size, d.fileSize)
+		}
+		return 0, fmt.Errorf("%s: mirror %s has a file of %d bytes instead of %d", label, url, size, d.fileSize)
+	}
+
+	progressWriter := &chunkWriter{
+		writer:        io.NewOffsetWriter(file, offset),
+		chunkProgress: chunkProgress,
+		pos:           offset,
+		mirrors:       d.mirrors,
+		url:           url,
+	}
+
+	body := d.limiter.Reader(chunkCtx, watchdog.Reader(resp.Body))
+	written, err := bufpool.Copy(progressWriter, io.LimitReader(body, remaining))
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		// The connection dropped mid-body; what arrived is still good
+		err = nil
+	}
+	if err != nil {
+		return written, fmt.Errorf("failed to write data for %s: %w", label, idle.Cause(chunkCtx, err))
+	}
+
+	if written < remaining {
+		return written, fmt.Errorf("%s: %w: got %d of %d bytes", label, errShortRange, written, remaining)
+	}
+	if resp.StatusCode == http.StatusPartialContent {
+		if n, _ := resp.Body.Read(make([]byte, 1)); n > 0 {
+			return written, fmt.Errorf("%s: server sent more than the %d bytes requested", label, remaining)
+		}
+	}
+	return written, nil
+}
+
+func (d *Downloader) verifyChunks(chunkFiles []string, expectedChunks []ChunkInfo) error {
+	d.notify("Verifying downloaded chunks...")
+	var totalDownloadedSize int64
+
+	for i, chunkFile := range chunkFiles {
+		info, err := os.Stat(chunkFile)
+		if err != nil {
+			return fmt.Errorf("chunk %d verification failed - file not found (%s): %w", i, chunkFile, err)
+		}
+
+		actualSize := info.Size()
+		expectedSize := expectedChunks[i].Size
+		totalDownloadedSize += actualSize
+
+		if actualSize == 0 {
+			return fmt.Errorf("chunk %d verification failed - file is empty (%s)", i, chunkFile)
+		}
+
+		d.logf("verify: chunk %d size=%d expected=%d", i, actualSize, expectedSize)
+		if actualSize != expectedSize {
+			return fmt.Errorf("chunk %d verification failed - expected %d bytes, got %d bytes (%s)",
+				i, expectedSize, actualSize, chunkFile)
+		}
+
+		d.notify("  ✓ Chunk %d: %s (%s)", i, chunkFile, FormatBytes(actualSize))
+	}
+
+	d.notify("✓ All %d chunks verified (total: %s)", len(chunkFiles), FormatBytes(totalDownloadedSize))
+	return nil
+}
+
+func (d *Downloader) mergeChunks(chunkFiles []string) error {
+	var totalMergeSize int64
+	chunkSizes := make([]int64, len(chunkFiles))
+
+	for i, chunkFile := range chunkFiles {
+		info, err := os.Stat(chunkFile)
+		if err != nil {
+			return fmt.Errorf("failed to stat chunk %d (%s): %w", i, chunkFile, err)
+		}
+		chunkSizes[i] = info.Size()
+		totalMergeSize += info.Size()
+	}
+
+	d.notify("Merging %d chunks (total: %s)...", len(chunkFiles), FormatBytes(totalMergeSize))
+
+	// Merge under a temporary name so nothing sees a half-written file
+	partPath := d.partPath()
+	output, err := os.Create(partPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer output.Close()
+
+	merged := &mergeProgress{
+		totalSize: totalMergeSize,
+		startTime: time.Now(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.reportProgress(ctx, merged.snapshot)
+
+	// Hash the chunk stream alongside the merge so the final digest is ready
+	// as soon as the copy finishes
+	hashResult := make(chan error, 1)
+	hasher := digest.ForExpected(d.digests)
+	go func() { hashResult <- hashFiles(chunkFiles, hasher) }()
+
+	for i, chunkFile := range chunkFiles {
+		input, err := os.Open(chunkFile)
+		if err != nil {
+			return fmt.Errorf("failed to open chunk %d (%s): %w", i, chunkFile, err)
+		}
+
+		written, err := fastcopy.File(output, input, chunkSizes[i], merged.AddBytes)
+		input.Close()
+
+		if err != nil {
+			return fmt.Errorf("failed to copy chunk %d: %w", i, err)
+		}
+
+		if written != chunkSizes[i] {
+			return fmt.Errorf("chunk %d: expected to copy %d bytes, but copied %d bytes",
+				i, chunkSizes[i], written)
+		}
+
+	}
+
+	cancel()
+	d.report(merged.snapshot())
+
+	if err := output.Sync(); err != nil {
+		return fmt.Errorf("failed to sync output file: %w", err)
+	}
+
+	output.Close()
+
+	if err := <-hashResult; err != nil {
+		d.notify("Warning: could not hash merged data: %v", err)
+		hasher = nil
+	}
+	if err := d.verifyFinalFile(partPath, totalMergeSize, hasher); err != nil {
+		return err
+	}
+
+	if err := os.Rename(partPath, d.OutputPath); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", partPath, err)
+	}
+	d.logf("merge: renamed %s to %s", partPath, d.OutputPath)
+	d.notify("✓ Saved to %s", d.OutputPath)
+	return nil
+}
+
+// partPath is where the merged file is written until it has been verified.
+func (d *Downloader) partPath() string {
+	return d.OutputPath + ".part"
+}
+
+// hashFiles feeds the files, concatenated in order, to hasher.
+func hashFiles(paths []string, hasher *digest.Hasher) error {
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = fastcopy.Reader(hasher, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyFinalFile checks the merged file at path for its size and, when
+// hasher is set, its digests against any the server published.
+func (d *Downloader) verifyFinalFile(path string, expectedSize int64, hasher *digest.Hasher) error {
+	d.notify("Performing final file verification...")
+
+	finalInfo, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("final file verification failed - file not found (%s): %w", path, err)
+	}
+
+	actualSize := finalInfo.Size()
+
+	d.logf("verify: final file %s size=%d expected=%d", path, actualSize, expectedSize)
+	if actualSize != expectedSize {
+		return fmt.Errorf("final file verification failed - expected %d bytes, got %d bytes (%s)",
+			expectedSize, actualSize, path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("final file verification failed - cannot open file (%s): %w", path, err)
+	}
+	defer file.Close()
+
+	buffer := make([]byte, 1024)
+	n, err := file.Read(buffer)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("final file verification failed - cannot read file (%s): %w", path, err)
+	}
+	if n == 0 && actualSize > 0 {
+		return fmt.Errorf("final file verification failed - file appears to be empty or corrupted (%s)", path)
+	}
+
+	if hasher != nil && len(d.digests) > 0 {
+		results := digest.Check(d.digests, hasher)
+		for _, result := range results {
+			d.logf("verify: %s from %s expected=%s actual=%s match=%v",
+				result.Algorithm, result.Source, result.Expected, result.Actual, result.Match)
+			source := "server " + result.Source
+			if len(d.checksum) > 0 && result.Source == d.checksum[0].Source {
+				source = "the expected checksum"
+			}
+			switch {
+			case result.Match:
+				d.notify("✓ %s matches %s", strings.ToUpper(result.Algorithm), source)
+			case result.Advisory:
+				d.notify("! %s differs from %s (not necessarily a checksum)", strings.ToUpper(result.Algorithm), source)
+			default:
+				d.notify("✗ %s does not match %s", strings.ToUpper(result.Algorithm), source)
+			}
+		}
+		if err := digest.Failed(results); err != nil {
+			return fmt.Errorf("final file verification failed - %w", err)
+		}
+	}
+
+	d.notify("✓ Final file verification successful: %s", path)
+	d.notify("  File size: %s (%d bytes)", FormatBytes(actualSize), actualSize)
+	if hasher != nil {
+		sum := hex.EncodeToString(hasher.Sum(digest.SHA256))
+		d.notify("  SHA-256: %s", sum)
+		d.logf("verify: sha256=%s", sum)
+	}
+	d.notify("  File permissions: %v", finalInfo.Mode())
+	d.notify("  Modified: %v", finalInfo.ModTime())
+
+	return nil
+}
+
+func (d *Downloader) ensureMergeCompletion(chunkFiles []string, maxRetries int) error {
+	var lastErr error
+
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		d.notify("Merge attempt %d of %d...", attempt, maxRetries)
+		d.logf("merge: attempt %d of %d", attempt, maxRetries)
+
+		if attempt > 1 {
+			if err := os.Remove(d.partPath()); err != nil && !os.IsNotExist(err) {
+				d.notify("Warning: failed to remove partial file: %v", err)
+			}
+		}
+
+		err := d.mergeChunks(chunkFiles)
+		if err == nil {
+			d.notify("✓ Merge completed successfully on attempt %d", attempt)
+			d.logf("merge: completed on attempt %d", attempt)
+			return nil
+		}
+
+		lastErr = err
+		d.notify("✗ Merge attempt %d failed: %v", attempt, err)
+		d.logf("merge: attempt %d failed: %v", attempt, err)
+
+		// The downloaded data itself is wrong; merging again won't help
+		if errors.Is(err, digest.ErrMismatch) {
+			return err
+		}
+
+		if attempt < maxRetries {
+			d.notify("Retrying in 2 seconds...")
+			time.Sleep(2 * time.Second)
+		}
+	}
+
+	return fmt.Errorf("merge failed after %d attempts, last error: %w", maxRetries, lastErr)
+}
+
+// finishPartial keeps or discards the state of a download that did not
+// complete, depending on KeepPartial.
+func (d *Downloader) finishPartial(meta *ResumeMetadata) {
+	if d.KeepPartial {
+		d.logf("download: partial download kept in %s", ResumeMetadataPath(d.OutputPath))
+		return
+	}
+	if err := meta.Remove(); err != nil {
+		d.notify("Warning: %v", err)
+	}
+}
+
+// prepareResume loads the control file for the output path if it describes
+// the same remote file, or starts a fresh one otherwise.
+func (d *Downloader) prepareResume(fileSize int64) (*ResumeMetadata, error) {
+	metaPath := ResumeMetadataPath(d.OutputPath)
+	meta, err := LoadResumeMetadata(metaPath)
+	switch {
+	case err == nil && meta.Matches(d.URL, fileSize, d.etag):
+		d.logf("resume: continuing from %s", metaPath)
+		d.notify("Resuming partial download (%s already on disk)", FormatBytes(meta.DownloadedBytes()))
+		d.trusted, err = LoadJournal(d.OutputPath)
+		if err != nil && !os.IsNotExist(err) {
+			d.notify("Warning: ignoring unreadable journal: %v", err)
+		}
+		return meta, nil
+	case err == nil:
+		d.logf("resume: discarding stale metadata %s (url=%s size=%d etag=%q)", metaPath, meta.URL, meta.TotalSize, meta.ETag)
+		d.notify("Discarding stale partial download for %s", d.OutputPath)
+		if err := meta.Remove(); err != nil {
+			return nil, err
+		}
+	case !os.IsNotExist(err):
+		d.notify("Warning: ignoring unreadable resume metadata: %v", err)
+	}
+
+	d.trusted = nil
+	if err := os.Remove(journalPath(d.OutputPath)); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale journal: %w", err)
+	}
+
+	// Keep chunks next to the output by default so the merge stays on one
+	// filesystem rather than filling a small system temp directory
+	tempDir := d.TempDir
+	if tempDir == "" {
+		tempDir = filepath.Dir(d.OutputPath)
+	}
+	// The metadata may be resumed from another working directory
+	tempDir, err = filepath.Abs(tempDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve temp directory: %w", err)
+	}
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	chunkDir, err := os.MkdirTemp(tempDir, "download-chunks-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	meta = &ResumeMetadata{
+		Version:     ResumeFormatVersion,
+		URL:         d.URL,
+		OutputPath:  d.OutputPath,
+		TotalSize:   fileSize,
+		ETag:        d.etag,
+		ChunkDir:    chunkDir,
+		Chunks:      d.createChunks(fileSize),
+		Connections: d.Chunks,
+		CreatedAt:   time.Now(),
+	}
+	if err := meta.Save(); err != nil {
+		os.RemoveAll(chunkDir)
+		return nil, err
+	}
+	return meta, nil
+}
+
+// Download fetches the file. Cancelling ctx stops every chunk transfer and
+// keeps resumable state according to KeepPartial.
+func (d *Downloader) Download(ctx context.Context) error {
+	started := time.Now()
+	d.logf("download: start url=%s output=%s chunks=%d connect-timeout=%v read-timeout=%v",
+		d.URL, cmp.Or(d.OutputTemplate, d.OutputPath), d.Chunks, d.ConnectTimeout, d.ReadTimeout)
+	if err := nametemplate.Validate(d.OutputTemplate); err != nil {
+		return err
+	}
+	if _, err := conflict.Parse(d.OnConflict); err != nil {
+		return err
+	}
+
+	d.checksum = nil
+	if d.Checksum != "" {
+		expected, err := digest.Parse(d.Checksum)
+		if err != nil {
+			return err
+		}
+		d.checksum = []digest.Expected{expected}
+	}
+	if err := d.auth().Validate(); err != nil {
+		return err
+	}
+	if err := d.prepareClient(); err != nil {
+		return err
+	}
+
+	// One transport for the whole download so chunk requests reuse the
+	// connections opened by earlier ones
+	connections := d.Chunks
+	if connections <= 0 {
+		connections = autochunk.MaxChunks
+	}
+	httpTransport := transport.New(d.ConnectTimeout, connections)
+	defer httpTransport.CloseIdleConnections()
+	d.warmer = transport.NewWarmer(httpTransport)
+	defer d.warmer.Close()
+	d.client.Transport = httpTransport
+
+	downloadCtx := ctx
+	if d.MaxTime > 0 {
+		var cancelDeadline context.CancelFunc
+		downloadCtx, cancelDeadline = context.WithTimeout(downloadCtx, d.MaxTime)
+		defer cancelDeadline()
+	}
+
+	probe, err := d.probeFile(downloadCtx)
+	if err != nil {
+		d.logf("download: probe failed: %v", err)
+		return err
+	}
+	fileSize := probe.Size
+	d.fileSize = fileSize
+	if d.OutputTemplate != "" {
+		d.nameVars.Time = started
+		d.OutputPath = filepath.FromSlash(nametemplate.Render(d.OutputTemplate, d.nameVars))
+		d.notify("Saving as %s", d.OutputPath)
+		d.logf("download: output=%s from template %s", d.OutputPath, d.OutputTemplate)
+	}
+	if err := d.resolveConflict(probe.Ranges); err != nil {
+		return err
+	}
+	d.mirrors = mirror.New(append([]string{d.URL}, d.Mirrors...))
+	if len(d.Mirrors) > 0 {
+		d.notify("Spreading chunks across %d mirrors", len(d.Mirrors)+1)
+	}
+
+	if d.Chunks <= 0 {
+		d.Chunks = autochunk.Count(probe)
+		d.notify("Auto-selected %d chunks (round trip %v, ranges supported: %v)",
+			d.Chunks, probe.RTT.Round(time.Microsecond), probe.Ranges)
+		d.logf("download: auto-selected chunks=%d", d.Chunks)
+		d.applyRecommendation()
+	}
+
+	d.notify("File size: %d bytes (%.2f MB)", fileSize, float64(fileSize)/(1024*1024))
+
+	if err := os.MkdirAll(filepath.Dir(d.OutputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	return d.transfer(downloadCtx, fileSize)
+}
+
+// transfer downloads the chunks, merges them and verifies the result. If the
+// server turns out to ignore range requests, the parallel attempt is
+// abandoned and the file is fetched again over a single connection.
+func (d *Downloader) transfer(downloadCtx context.Context, fileSize int64) error {
+	meta, err := d.prepareResume(fileSize)
+	if err != nil {
+		return err
+	}
+	if d.adoptSize > 0 && !d.singleStream {
+		if err := d.adoptOutput(meta); err != nil {
+			meta.Remove()
+			return err
+		}
+	}
+
+	d.journal, err = openJournal(d.OutputPath)
+	if err != nil {
+		d.notify("Warning: %v; an interrupted download will trust chunk file sizes", err)
+	}
+	defer d.journal.Close()
+	chunks := meta.Chunks
+	d.progressManager = newProgressTracker(chunks)
+
+	d.notify("Created %d chunks for concurrent download (%d connections)", len(chunks), min(d.Chunks, len(chunks)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// One chunk getting the whole file back aborts all the others
+	chunksCtx, abortChunks := context.WithCancel(downloadCtx)
+	defer abortChunks()
+
+	go d.reportProgress(ctx, d.progressManager.snapshot)
+	if d.Endgame && !d.singleStream {
+		go d.runEndgame(ctx, chunksCtx, min(d.Chunks, len(chunks)))
+	}
+	if d.StallSpeed > 0 {
+		go d.runStallMonitor(ctx)
+	}
+	if len(d.Mirrors) > 0 {
+		go d.runMirrorMonitor(ctx)
+	}
+
+	if !d.singleStream {
+		d.prewarm(chunksCtx, min(d.Chunks, len(chunks)))
+	}
+
+	d.notify("Starting concurrent download of %d chunks...", len(chunks))
+	clock := d.startClock()
+
+	var wg sync.WaitGroup
+	var downloadErrors []error
+	var errorsMu sync.Mutex
+	addError := func(err error) {
+		errorsMu.Lock()
+		defer errorsMu.Unlock()
+		downloadErrors = append(downloadErrors, err)
+	}
+	slots := make(chan struct{}, max(d.Chunks, 1))
+
+	// startChunk downloads the chunk once it gets a slot, or in the slot
+	// already taken for it
+	startChunk := func(c ChunkInfo, slotHeld bool) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !slotHeld {
+				select {
+				case slots <- struct{}{}:
+				case <-chunksCtx.Done():
+					addError(fmt.Errorf("chunk %d not started: %w", c.ID, chunksCtx.Err()))
+					return
+				}
+			}
+			defer func() { <-slots }()
+
+			if err := d.downloadChunk(chunksCtx, c, meta.ChunkFile(c.ID)); err != nil {
+				d.logf("chunk %d: failed: %v", c.ID, err)
+				if errors.Is(err, errRangeIgnored) {
+					abortChunks()
+				}
+				addError(fmt.Errorf("chunk %d failed: %w", c.ID, err))
+			}
+		}()
+	}
+
+	for _, chunk := range chunks {
+		startChunk(chunk, false)
+	}
+	if !d.singleStream {
+		go d.runSplitter(ctx, meta, slots, func(c ChunkInfo) { startChunk(c, true) })
+	}
+
+	wg.Wait()
+
+	cancel() // Stop progress reports
+	d.logf("download: connections %s", &d.connStats)
+	d.report(d.progressManager.snapshot())
+
+	rangeIgnored := false
+	for _, err := range downloadErrors {
+		rangeIgnored = rangeIgnored || errors.Is(err, errRangeIgnored)
+	}
+
+	if errors.Is(downloadCtx.Err(), context.DeadlineExceeded) {
+		d.logf("download: aborted after exceeding max time %v", d.MaxTime)
+		d.finishPartial(meta)
+		return fmt.Errorf("download aborted: exceeded max time of %v", d.MaxTime)
+	}
+
+	if errors.Is(downloadCtx.Err(), context.Canceled) {
+		d.logf("download: interrupted")
+		d.finishPartial(meta)
+		return fmt.Errorf("download interrupted")
+	}
+
+	if rangeIgnored && !d.singleStream {
+		d.notify("Server ignored range requests, falling back to a single connection")
+		d.logf("download: range request ignored, restarting as a single stream")
+		d.journal.Close()
+		if err := meta.Remove(); err != nil {
+			return err
+		}
+		d.singleStream = true
+		d.Chunks, d.ChunkSize = 1, 0
+		return d.transfer(downloadCtx, fileSize)
+	}
+
+	if len(downloadErrors) > 0 {
+		d.notify("Download failed with %d errors:", len(downloadErrors))
+		for _, err := range downloadErrors {
+			d.notify("  - %v", err)
+		}
+		d.finishPartial(meta)
+		return fmt.Errorf("download failed with %d chunk errors", len(downloadErrors))
+	}
+
+	// Chunks split off others were appended; merge them in file order
+	chunks = slices.Clone(meta.Chunks)
+	slices.SortFunc(chunks, func(a, b ChunkInfo) int { return cmp.Compare(a.StartByte, b.StartByte) })
+	chunkFiles := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		chunkFiles[i] = meta.ChunkFile(chunk.ID)
+	}
+
+	d.notify("✓ All %d chunks downloaded successfully", len(chunks))
+
+	if err := d.verifyChunks(chunkFiles, chunks); err != nil {
+		return fmt.Errorf("chunk verification failed: %w", err)
+	}
+
+	if err := d.ensureMergeCompletion(chunkFiles, 3); err != nil {
+		return fmt.Errorf("merge completion failed: %w", err)
+	}
+
+	d.journal.Close()
+	if err := meta.Remove(); err != nil {
+		d.notify("Warning: %v", err)
+	}
+	d.recordThroughput(min(d.Chunks, len(chunks)), clock)
+
+	elapsed := time.Since(d.progressManager.startTime)
+	avgSpeed := float64(fileSize) / elapsed.Seconds()
+
+	d.logf("download: completed %s (%d bytes) in %v", d.OutputPath, fileSize, elapsed)
+	d.notify("🎉 Download completed successfully: %s", d.OutputPath)
+	d.notify("Total time: %v, Average speed: %s", elapsed.Round(time.Second), FormatSpeed(avgSpeed))
+
+	return nil
+}
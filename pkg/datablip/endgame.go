@@ -0,0 +1,132 @@
+package datablip
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/endgame"
+)
+
+// chunkRace is a chunk currently being transferred that endgame mode may
+// send a second connection after.
+type chunkRace struct {
+	chunk ChunkInfo
+	file  string
+	race  *endgame.Race
+}
+
+func (d *Downloader) trackRace(chunk ChunkInfo, file string, race *endgame.Race) {
+	d.racesMu.Lock()
+	defer d.racesMu.Unlock()
+	if d.races == nil {
+		d.races = make(map[int]*chunkRace)
+	}
+	d.races[chunk.ID] = &chunkRace{chunk: chunk, file: file, race: race}
+}
+
+func (d *Downloader) untrackRace(id int) {
+	d.racesMu.Lock()
+	defer d.racesMu.Unlock()
+	delete(d.races, id)
+}
+
+// runEndgame watches the download once it is nearly complete and starts a
+// helper connection for any chunk that is crawling behind the rest.
+// Helpers are tied to downloadCtx; the loop itself stops when ctx is done.
+func (d *Downloader) runEndgame(ctx, downloadCtx context.Context, connections int) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if d.pause.Paused() {
+			continue
+		}
+		downloaded, total, _, _ := d.progressManager.GetOverallProgress()
+		if total == 0 || float64(downloaded) < endgame.Threshold*float64(total) {
+			continue
+		}
+
+		// A chunk still waiting for a slot will use the next free
+		// connection, so don't add more while there are any
+		waiting := false
+		for _, cp := range d.progressManager.chunks() {
+			if _, _, _, _, status := cp.GetProgress(); status == "waiting" {
+				waiting = true
+				break
+			}
+		}
+		if waiting {
+			continue
+		}
+
+		// Compare against the whole download's pace: by now the recent
+		// rate is mostly the straggler itself
+		typical := d.progressManager.AverageSpeed() / float64(max(connections, 1))
+
+		d.racesMu.Lock()
+		races := make([]*chunkRace, 0, len(d.races))
+		for _, cr := range d.races {
+			races = append(races, cr)
+		}
+		d.racesMu.Unlock()
+
+		for _, cr := range races {
+			chunkProgress := d.progressManager.GetChunkProgress(cr.chunk.ID)
+			chunkDownloaded, chunkTotal, _, chunkSpeed, _ := chunkProgress.GetProgress()
+			if cr.race.Helping() || !endgame.Straggler(chunkTotal-chunkDownloaded, chunkSpeed, typical) {
+				continue
+			}
+
+			from := chunkDownloaded
+			started := cr.race.Help(downloadCtx, func(helperCtx context.Context) error {
+				return d.helpChunk(helperCtx, cr, from, chunkProgress)
+			})
+			if started {
+				d.logf("chunk %d: endgame connection started at offset %d (%s/s vs typical %s/s)",
+					cr.chunk.ID, from, FormatBytes(int64(chunkSpeed)), FormatBytes(int64(typical)))
+			}
+		}
+	}
+}
+
+// helpChunk fetches the chunk from offset from onwards into the same chunk
+// file as the original connection. Both write identical bytes at the same
+// offsets, so it doesn't matter which of them gets there first.
+func (d *Downloader) helpChunk(ctx context.Context, cr *chunkRace, from int64, chunkProgress *chunkState) error {
+	label := fmt.Sprintf("chunk %d endgame", cr.chunk.ID)
+	ctx, release := d.pause.Track(ctx)
+	defer release()
+
+	output, err := os.OpenFile(cr.file, os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open output file for %s: %w", label, err)
+	}
+	defer output.Close()
+
+	url := d.mirrors.Pick()
+	written, err := d.fetchRange(ctx, url, label, cr.chunk, from, output, chunkProgress)
+	d.mirrors.Done(url, err != nil && ctx.Err() == nil)
+	if err != nil {
+		d.logf("%s: failed: %v", label, err)
+		return err
+	}
+	if from+written != cr.chunk.Size {
+		err := fmt.Errorf("%s: expected %d bytes, got %d bytes", label, cr.chunk.Size-from, written)
+		d.logf("%v", err)
+		return err
+	}
+	if err := output.Close(); err != nil {
+		return fmt.Errorf("failed to close output file for %s: %w", label, err)
+	}
+
+	d.logf("%s: finished %d bytes first", label, written)
+	return nil
+}
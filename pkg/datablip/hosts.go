@@ -0,0 +1,60 @@
+package datablip
+
+import (
+	"time"
+
+	"github.com/govind1331/Datablip/internal/hoststats"
+)
+
+// HostStats keeps the throughput of finished downloads per host, keyed by
+// host name, and recommends how many connections a host is worth.
+type HostStats interface {
+	// Record adds a download that moved bytes from host in elapsed over
+	// the given number of connections, reporting whether it counted.
+	Record(host string, connections int, bytes int64, elapsed time.Duration) bool
+
+	// Recommend returns the connections recommended for host, if more
+	// were seen to be no faster.
+	Recommend(host string) (int, bool)
+}
+
+// transferClock measures a transfer so its throughput can be recorded.
+type transferClock struct {
+	start   time.Time
+	pauses  int
+	limited bool
+}
+
+func (d *Downloader) startClock() transferClock {
+	return transferClock{start: time.Now(), pauses: d.pause.Pauses(), limited: d.RateLimit() > 0}
+}
+
+// recordThroughput adds a finished transfer to d.Hosts. Transfers that were
+// paused or held to a speed limit are left out, since they say nothing about
+// what the host can deliver.
+func (d *Downloader) recordThroughput(connections int, clock transferClock) {
+	if d.Hosts == nil || clock.limited || d.RateLimit() > 0 || d.pause.Pauses() != clock.pauses {
+		return
+	}
+	host := hoststats.Key(d.URL)
+	downloaded, resumed := d.progressManager.totals()
+	bytes := downloaded - resumed
+	elapsed := time.Since(clock.start)
+	if d.Hosts.Record(host, connections, bytes, elapsed) {
+		d.logf("download: throughput host=%s connections=%d speed=%.0f", host, connections, float64(bytes)/elapsed.Seconds())
+	}
+}
+
+// applyRecommendation lowers an automatically picked chunk count to the
+// connections d.Hosts recommends for the host.
+func (d *Downloader) applyRecommendation() {
+	if !d.AutoConnections || d.Hosts == nil {
+		return
+	}
+	host := hoststats.Key(d.URL)
+	if recommended, ok := d.Hosts.Recommend(host); ok && recommended < d.Chunks {
+		d.Chunks = recommended
+		d.notify("Using %d connections, where %s saturates", recommended, host)
+		d.logf("download: host %s saturates at %d connections", host, recommended)
+	}
+}
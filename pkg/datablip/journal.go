@@ -0,0 +1,167 @@
+package datablip
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// JournalSuffix is appended to the output path to name the log of chunk
+	// progress kept alongside the resume metadata.
+	JournalSuffix = ResumeSuffix + ".journal"
+
+	// checkpointInterval is how often an in-flight chunk file is synced and
+	// its position journaled.
+	checkpointInterval = 5 * time.Second
+)
+
+func journalPath(outputPath string) string {
+	return outputPath + JournalSuffix
+}
+
+type journalEntry struct {
+	Event  string    `json:"event"` // "start", "checkpoint" or "complete"
+	Chunk  int       `json:"chunk"`
+	Offset int64     `json:"offset"` // Bytes of the chunk known to be on disk
+	Time   time.Time `json:"time"`
+}
+
+// Journal is an append-only record of chunk progress. An entry is only
+// written once the chunk data it vouches for has been synced, and the
+// journal itself is synced after every entry, so after a crash each chunk
+// file can be trusted up to the last offset journaled for it.
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openJournal(outputPath string) (*Journal, error) {
+	path := journalPath(outputPath)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal (%s): %w", path, err)
+	}
+	// Only a sign the download is running, for partials clean; a second
+	// download of the same file isn't stopped
+	lockFile(file)
+	return &Journal{file: file}, nil
+}
+
+// Record appends an entry and syncs it to disk. A nil or closed journal
+// records nothing.
+func (j *Journal) Record(event string, chunk int, offset int64) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(journalEntry{Event: event, Chunk: chunk, Offset: offset, Time: time.Now()})
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	return nil
+}
+
+// Close closes the journal; it is safe to call more than once.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// LoadJournal returns how many bytes of each chunk the journal for the
+// output path vouches for. Chunks without an entry are absent from the map.
+// A torn final line left by a crash mid-write is ignored.
+func LoadJournal(outputPath string) (map[int]int64, error) {
+	file, err := os.Open(journalPath(outputPath))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	trusted := make(map[int]int64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			break
+		}
+		// Later entries supersede earlier ones: a restarted chunk is
+		// truncated back to its start offset
+		trusted[entry.Chunk] = entry.Offset
+	}
+	return trusted, scanner.Err()
+}
+
+// trustedBytes reports how much of the chunk an earlier run journaled as
+// safely on disk. It reports false for a chunk the journal never mentions:
+// nothing is written to a chunk before its start entry, so its file size
+// can be trusted as is.
+func (d *Downloader) trustedBytes(id int) (int64, bool) {
+	trusted, ok := d.trusted[id]
+	return trusted, ok
+}
+
+// checkpoint syncs the chunk file and journals that pos bytes of it are on
+// disk.
+func (d *Downloader) checkpoint(event string, id int, file *os.File, pos int64) {
+	if d.journal == nil {
+		return
+	}
+	if err := file.Sync(); err != nil {
+		d.logf("chunk %d: sync failed, not journaling %s: %v", id, event, err)
+		return
+	}
+	if err := d.journal.Record(event, id, pos); err != nil {
+		d.logf("chunk %d: %v", id, err)
+	}
+}
+
+// checkpoints journals the chunk's progress every checkpointInterval until
+// the returned function is called.
+func (d *Downloader) checkpoints(id int, file *os.File, chunkProgress *chunkState) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// Read the position before syncing so the sync covers it
+				pos, _, _, _, _ := chunkProgress.GetProgress()
+				d.checkpoint("checkpoint", id, file, pos)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd)
+
+package datablip
+
+import "os"
+
+func lockFile(file *os.File) error {
+	return nil
+}
+
+func fileLocked(path string) bool {
+	return false
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+
+package datablip
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an advisory lock on file, held until it is closed, so other
+// processes can tell a download is using it.
+func lockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// fileLocked reports whether another open file holds the lock on path.
+func fileLocked(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	return lockFile(file) == syscall.EWOULDBLOCK
+}
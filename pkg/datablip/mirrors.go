@@ -0,0 +1,43 @@
+package datablip
+
+import (
+	"context"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/mirror"
+)
+
+// runMirrorMonitor measures the mirrors every second until ctx is done,
+// dropping those that stay far slower than the fastest one.
+func (d *Downloader) runMirrorMonitor(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if d.pause.Paused() {
+			continue
+		}
+		for _, url := range d.mirrors.Check() {
+			d.notify("Dropped mirror %s for being too slow", url)
+			d.logf("download: dropped mirror %s, below %.0f%% of the fastest mirror's speed", url, mirror.SlowFactor*100)
+			d.abortMirror(url)
+		}
+	}
+}
+
+// abortMirror cancels the requests in flight to a dropped mirror, so their
+// chunks carry on from where they are on the others.
+func (d *Downloader) abortMirror(url string) {
+	d.attemptsMu.Lock()
+	defer d.attemptsMu.Unlock()
+	for id, source := range d.sources {
+		if source == url {
+			d.attempts[id](mirror.ErrDropped)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package datablip
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/mirror"
+	"github.com/govind1331/Datablip/internal/speed"
+)
+
+// ProgressInterval is how often a Downloader's Progress func is called.
+const ProgressInterval = 200 * time.Millisecond
+
+// Stage is the part of a download a Progress snapshot was taken in.
+type Stage string
+
+const (
+	StageDownloading Stage = "downloading"
+	StageMerging     Stage = "merging"
+)
+
+// Progress is a snapshot of a running download.
+type Progress struct {
+	Stage      Stage
+	Downloaded int64   // Bytes on disk, or merged so far while merging
+	Total      int64   // Bytes in the file
+	Speed      float64 // Bytes/s over the last few seconds; since the start while merging
+	Paused     bool
+	Chunks     []ChunkStatus // Every chunk, while downloading
+}
+
+// Percent is how far the current stage has got, from 0 to 100.
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return 0
+	}
+	return float64(p.Downloaded) / float64(p.Total) * 100
+}
+
+// ChunkStatus is the progress of one chunk of a download.
+type ChunkStatus struct {
+	ID         int
+	State      string // "waiting", "downloading", "reconnecting", "paused", "completed" or "failed"
+	Downloaded int64
+	Total      int64
+	Speed      float64 // Bytes/s over the last few seconds
+	Restarts   int64   // Stalled connections restarted
+}
+
+// Percent is how much of the chunk is on disk, from 0 to 100.
+func (c ChunkStatus) Percent() float64 {
+	if c.Total <= 0 {
+		return 0
+	}
+	return float64(c.Downloaded) / float64(c.Total) * 100
+}
+
+// chunkState tracks individual chunk download progress
+type chunkState struct {
+	ID              int
+	downloadedBytes int64
+	resumedBytes    int64
+	restarts        int64 // Stalled connections restarted
+	totalBytes      int64
+	status          string // "waiting", "downloading", "reconnecting", "completed", "failed"
+	meter           *speed.Meter
+	mu              sync.RWMutex
+}
+
+func newChunkState(id int, totalBytes int64) *chunkState {
+	return &chunkState{
+		ID:         id,
+		totalBytes: totalBytes,
+		status:     "waiting",
+		meter:      speed.New(speed.DefaultWindow),
+	}
+}
+
+// SetTotal shrinks the chunk to size bytes after the rest of it was split
+// off. Bytes already counted past the new end are dropped.
+func (cp *chunkState) SetTotal(size int64) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.totalBytes = size
+	if atomic.LoadInt64(&cp.downloadedBytes) > size {
+		atomic.StoreInt64(&cp.downloadedBytes, size)
+	}
+}
+
+func (cp *chunkState) Total() int64 {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.totalBytes
+}
+
+func (cp *chunkState) SetStatus(status string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.status = status
+}
+
+// SetResumed records bytes already on disk from an earlier run so they count
+// towards progress but not towards the measured speed.
+func (cp *chunkState) SetResumed(bytes int64) {
+	atomic.StoreInt64(&cp.downloadedBytes, bytes)
+	atomic.StoreInt64(&cp.resumedBytes, bytes)
+}
+
+// Advance raises the chunk's downloaded byte count to pos. Connections
+// racing over the same range report positions rather than increments so
+// overlapping bytes are only counted once.
+func (cp *chunkState) Advance(pos int64) {
+	for {
+		current := atomic.LoadInt64(&cp.downloadedBytes)
+		if pos <= current {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&cp.downloadedBytes, current, pos) {
+			break
+		}
+	}
+	cp.meter.Set(pos - atomic.LoadInt64(&cp.resumedBytes))
+}
+
+// AddRestart counts a restart of the chunk's stalled connection.
+func (cp *chunkState) AddRestart() {
+	atomic.AddInt64(&cp.restarts, 1)
+}
+
+func (cp *chunkState) Restarts() int64 {
+	return atomic.LoadInt64(&cp.restarts)
+}
+
+func (cp *chunkState) GetProgress() (downloaded, total int64, percentage float64, speed float64, status string) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	downloaded = atomic.LoadInt64(&cp.downloadedBytes)
+	total = cp.totalBytes
+	if total > 0 {
+		percentage = float64(downloaded) / float64(total) * 100
+	}
+	speed = cp.meter.Rate()
+	status = cp.status
+	return
+}
+
+// progressTracker manages all chunk progress tracking
+type progressTracker struct {
+	chunkProgresses []*chunkState
+	totalSize       int64
+	startTime       time.Time
+	meter           *speed.Meter
+	mu              sync.RWMutex
+}
+
+func newProgressTracker(chunks []ChunkInfo) *progressTracker {
+	pm := &progressTracker{
+		chunkProgresses: make([]*chunkState, len(chunks)),
+		startTime:       time.Now(),
+		meter:           speed.New(speed.DefaultWindow),
+	}
+
+	for i, chunk := range chunks {
+		pm.chunkProgresses[i] = newChunkState(i, chunk.Size)
+		pm.totalSize += chunk.Size
+	}
+
+	return pm
+}
+
+func (pm *progressTracker) GetChunkProgress(chunkID int) *chunkState {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if chunkID >= 0 && chunkID < len(pm.chunkProgresses) {
+		return pm.chunkProgresses[chunkID]
+	}
+	return nil
+}
+
+// AddChunk starts tracking a chunk split off another; its bytes are already
+// part of the total.
+func (pm *progressTracker) AddChunk(chunk ChunkInfo) *chunkState {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	cp := newChunkState(chunk.ID, chunk.Size)
+	pm.chunkProgresses = append(pm.chunkProgresses, cp)
+	return cp
+}
+
+// chunks returns the chunks tracked so far.
+func (pm *progressTracker) chunks() []*chunkState {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.chunkProgresses
+}
+
+// totals sums the bytes present across chunks and how many of them were
+// already on disk when the download started.
+func (pm *progressTracker) totals() (downloaded, resumed int64) {
+	for _, cp := range pm.chunks() {
+		downloaded += atomic.LoadInt64(&cp.downloadedBytes)
+		resumed += atomic.LoadInt64(&cp.resumedBytes)
+	}
+	return downloaded, resumed
+}
+
+// GetOverallProgress reports overall progress, with speed measured over the
+// recent window rather than the whole download.
+func (pm *progressTracker) GetOverallProgress() (downloaded, total int64, percentage float64, speed float64) {
+	downloaded, resumed := pm.totals()
+
+	total = pm.totalSize
+	if total > 0 {
+		percentage = float64(downloaded) / float64(total) * 100
+	}
+
+	pm.meter.Set(downloaded - resumed)
+	return downloaded, total, percentage, pm.meter.Rate()
+}
+
+// AverageSpeed is the transfer rate since the download started.
+func (pm *progressTracker) AverageSpeed() float64 {
+	downloaded, resumed := pm.totals()
+	elapsed := time.Since(pm.startTime).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(downloaded-resumed) / elapsed
+}
+
+// snapshot returns the progress of the download and each of its chunks.
+func (pm *progressTracker) snapshot() Progress {
+	downloaded, total, _, rate := pm.GetOverallProgress()
+	p := Progress{Stage: StageDownloading, Downloaded: downloaded, Total: total, Speed: rate}
+	for _, cp := range pm.chunks() {
+		downloaded, total, _, rate, status := cp.GetProgress()
+		p.Chunks = append(p.Chunks, ChunkStatus{
+			ID:         cp.ID,
+			State:      status,
+			Downloaded: downloaded,
+			Total:      total,
+			Speed:      rate,
+			Restarts:   cp.Restarts(),
+		})
+	}
+	return p
+}
+
+// FormatSpeed formats a transfer rate, such as "1.5 MB/s".
+func FormatSpeed(bytesPerSec float64) string {
+	if bytesPerSec < 1024 {
+		return fmt.Sprintf("%.0f B/s", bytesPerSec)
+	} else if bytesPerSec < 1024*1024 {
+		return fmt.Sprintf("%.1f KB/s", bytesPerSec/1024)
+	} else {
+		return fmt.Sprintf("%.1f MB/s", bytesPerSec/(1024*1024))
+	}
+}
+
+// FormatBytes formats a byte count, such as "12.5 MB".
+func FormatBytes(bytes int64) string {
+	if bytes < 1024 {
+		return fmt.Sprintf("%d B", bytes)
+	} else if bytes < 1024*1024 {
+		return fmt.Sprintf("%.1f KB", float64(bytes)/1024)
+	} else {
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
+	}
+}
+
+type mergeProgress struct {
+	totalSize   int64
+	mergedBytes int64
+	startTime   time.Time
+}
+
+func (mp *mergeProgress) AddBytes(bytes int64) {
+	atomic.AddInt64(&mp.mergedBytes, bytes)
+}
+
+// snapshot returns the progress of the merge.
+func (mp *mergeProgress) snapshot() Progress {
+	p := Progress{Stage: StageMerging, Downloaded: atomic.LoadInt64(&mp.mergedBytes), Total: mp.totalSize}
+	if elapsed := time.Since(mp.startTime).Seconds(); elapsed > 0 {
+		p.Speed = float64(p.Downloaded) / elapsed
+	}
+	return p
+}
+
+// chunkWriter reports progress as data is written, so the chunk's position
+// never runs ahead of what is actually in the file.
+type chunkWriter struct {
+	writer        io.Writer
+	chunkProgress *chunkState
+	pos           int64       // Offset within the chunk reached so far
+	mirrors       *mirror.Set // Credited with what arrives from url
+	url           string
+}
+
+func (cpw *chunkWriter) Write(p []byte) (n int, err error) {
+	n, err = cpw.writer.Write(p)
+	if n > 0 {
+		cpw.pos += int64(n)
+		cpw.chunkProgress.Advance(cpw.pos)
+		cpw.mirrors.Count(cpw.url, n)
+	}
+	return
+}
+
+// reportProgress passes a snapshot from take to d.Progress every
+// ProgressInterval until ctx is done.
+func (d *Downloader) reportProgress(ctx context.Context, take func() Progress) {
+	if d.Progress == nil {
+		return
+	}
+	ticker := time.NewTicker(ProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.report(take())
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package datablip
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// ResumeSuffix is appended to the output path to name the control file
+	// describing an unfinished download.
+	ResumeSuffix = ".datablip"
+
+	// ResumeFormatVersion versions the control file format.
+	ResumeFormatVersion = 1
+)
+
+// ResumeMetadata is the control file kept next to an in-progress download so
+// an interrupted transfer can be found and continued later.
+type ResumeMetadata struct {
+	Version     int         `json:"version"`
+	URL         string      `json:"url"`
+	OutputPath  string      `json:"outputPath"`
+	TotalSize   int64       `json:"totalSize"`
+	ETag        string      `json:"etag,omitempty"` // Of the remote file when it was started
+	ChunkDir    string      `json:"chunkDir"`
+	Chunks      []ChunkInfo `json:"chunks"`
+	Connections int         `json:"connections,omitempty"` // Chunks transferred concurrently
+	CreatedAt   time.Time   `json:"createdAt"`
+	UpdatedAt   time.Time   `json:"updatedAt"`
+}
+
+// ResumeMetadataPath is where the control file of a download to outputPath
+// is kept.
+func ResumeMetadataPath(outputPath string) string {
+	return outputPath + ResumeSuffix
+}
+
+// LoadResumeMetadata reads the control file at path.
+func LoadResumeMetadata(path string) (*ResumeMetadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta ResumeMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("invalid resume metadata (%s): %w", path, err)
+	}
+	if meta.Version != ResumeFormatVersion {
+		return nil, fmt.Errorf("unsupported resume metadata version %d (%s)", meta.Version, path)
+	}
+	return &meta, nil
+}
+
+// Save writes the metadata atomically so a crash never leaves a truncated
+// control file behind.
+func (rm *ResumeMetadata) Save() error {
+	rm.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(rm, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode resume metadata: %w", err)
+	}
+
+	path := ResumeMetadataPath(rm.OutputPath)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write resume metadata: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write resume metadata: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the control file, its journal and every chunk file it
+// references.
+func (rm *ResumeMetadata) Remove() error {
+	if rm.ChunkDir != "" {
+		if err := os.RemoveAll(rm.ChunkDir); err != nil {
+			return fmt.Errorf("failed to remove chunk directory (%s): %w", rm.ChunkDir, err)
+		}
+	}
+	if err := os.Remove(journalPath(rm.OutputPath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove journal: %w", err)
+	}
+	if err := os.Remove(ResumeMetadataPath(rm.OutputPath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove resume metadata: %w", err)
+	}
+	return nil
+}
+
+// Locked reports whether a download running in another process holds the
+// journal of the partial download.
+func (rm *ResumeMetadata) Locked() bool {
+	return fileLocked(journalPath(rm.OutputPath))
+}
+
+// LastWrite returns when the control file, journal or a chunk file of the
+// partial download was last written.
+func (rm *ResumeMetadata) LastWrite() time.Time {
+	var last time.Time
+	paths := []string{ResumeMetadataPath(rm.OutputPath), journalPath(rm.OutputPath)}
+	for _, chunk := range rm.Chunks {
+		paths = append(paths, rm.ChunkFile(chunk.ID))
+	}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last
+}
+
+func (rm *ResumeMetadata) ChunkFile(id int) string {
+	return filepath.Join(rm.ChunkDir, fmt.Sprintf("chunk-%d", id))
+}
+
+// Matches reports whether the metadata describes the same remote file. An
+// ETag is only compared when both sides have one.
+func (rm *ResumeMetadata) Matches(url string, size int64, etag string) bool {
+	return rm.URL == url && rm.TotalSize == size && (rm.ETag == "" || etag == "" || rm.ETag == etag)
+}
+
+// DownloadedBytes sums the bytes already present in the chunk files.
+func (rm *ResumeMetadata) DownloadedBytes() int64 {
+	var total int64
+	for _, chunk := range rm.Chunks {
+		if info, err := os.Stat(rm.ChunkFile(chunk.ID)); err == nil {
+			total += min(info.Size(), chunk.Size)
+		}
+	}
+	return total
+}
@@ -0,0 +1,125 @@
+package datablip
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/endgame"
+	"github.com/govind1331/Datablip/internal/split"
+)
+
+// errSplit is the cancellation cause of a request whose chunk had the rest
+// of its range handed to a new chunk. The chunk carries on up to its new end.
+var errSplit = errors.New("chunk split")
+
+// runSplitter hands half of the remaining range of the chunk expected to
+// finish last to a new chunk whenever a connection slot is free, until ctx
+// is done. start is called with the new chunk while a slot is held for it
+// and must release the slot when the chunk finishes.
+func (d *Downloader) runSplitter(ctx context.Context, meta *ResumeMetadata, slots chan struct{}, start func(ChunkInfo)) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if d.pause.Paused() {
+			continue
+		}
+
+		// Endgame mode takes over stragglers near the end
+		downloaded, total, _, _ := d.progressManager.GetOverallProgress()
+		if d.Endgame && float64(downloaded) >= endgame.Threshold*float64(total) {
+			continue
+		}
+
+		// Chunks still waiting for a slot get the next free one
+		waiting := false
+		for _, cp := range d.progressManager.chunks() {
+			if _, _, _, _, status := cp.GetProgress(); status == "waiting" {
+				waiting = true
+				break
+			}
+		}
+		if waiting {
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			continue
+		}
+		if !d.splitSlowest(meta, start) {
+			<-slots
+		}
+	}
+}
+
+// splitSlowest splits the chunk expected to finish last, if any is worth
+// it, and starts the new chunk.
+func (d *Downloader) splitSlowest(meta *ResumeMetadata, start func(ChunkInfo)) bool {
+	// Hold attemptsMu throughout so the chunk can't finish in between
+	d.attemptsMu.Lock()
+	defer d.attemptsMu.Unlock()
+
+	d.racesMu.Lock()
+	defer d.racesMu.Unlock()
+
+	var candidates []split.Chunk
+	for id := range d.attempts {
+		cr := d.races[id]
+		if cr == nil || cr.race.Helping() {
+			continue
+		}
+		downloaded, size, _, rate, _ := d.progressManager.GetChunkProgress(id).GetProgress()
+		candidates = append(candidates, split.Chunk{
+			ID:   id,
+			Pos:  cr.chunk.StartByte + downloaded,
+			End:  cr.chunk.StartByte + size,
+			Rate: rate,
+		})
+	}
+
+	id, at, ok := split.Pick(candidates)
+	if !ok {
+		return false
+	}
+
+	cr := d.races[id]
+	shrunk := cr.chunk
+	shrunk.EndByte = at - 1
+	shrunk.Size = at - shrunk.StartByte
+	added := ChunkInfo{
+		ID:        len(meta.Chunks),
+		StartByte: at,
+		EndByte:   cr.chunk.EndByte,
+		Size:      cr.chunk.EndByte - at + 1,
+	}
+
+	// Record the split before acting on it, so a resumed download doesn't
+	// fetch the tail twice or lose it
+	meta.Chunks[id] = shrunk
+	meta.Chunks = append(meta.Chunks, added)
+	if err := meta.Save(); err != nil {
+		d.logf("chunk %d: not splitting: %v", id, err)
+		meta.Chunks[id] = cr.chunk
+		meta.Chunks = meta.Chunks[:added.ID]
+		return false
+	}
+
+	d.progressManager.GetChunkProgress(id).SetTotal(shrunk.Size)
+	d.progressManager.AddChunk(added)
+	d.races[id] = &chunkRace{chunk: shrunk, file: cr.file, race: cr.race}
+	d.attempts[id](errSplit)
+
+	d.logf("chunk %d: split at offset %d, bytes %d-%d go to new chunk %d",
+		id, at, added.StartByte, added.EndByte, added.ID)
+	start(added)
+	return true
+}
@@ -0,0 +1,80 @@
+package datablip
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/govind1331/Datablip/internal/mirror"
+	"github.com/govind1331/Datablip/internal/stall"
+)
+
+// fetchAttempt runs fetchRange against the next mirror, with a request the
+// stall and mirror monitors and pausing can cancel.
+func (d *Downloader) fetchAttempt(ctx context.Context, label string, chunk ChunkInfo, offset int64, file *os.File, chunkProgress *chunkState) (int64, error) {
+	ctx, release := d.pause.Track(ctx)
+	defer release()
+	attemptCtx, abort := context.WithCancelCause(ctx)
+	url := d.mirrors.Pick()
+	d.attemptsMu.Lock()
+	if d.attempts == nil {
+		d.attempts = make(map[int]context.CancelCauseFunc)
+		d.sources = make(map[int]string)
+	}
+	d.attempts[chunk.ID] = abort
+	d.sources[chunk.ID] = url
+	d.attemptsMu.Unlock()
+
+	defer func() {
+		d.attemptsMu.Lock()
+		delete(d.attempts, chunk.ID)
+		delete(d.sources, chunk.ID)
+		d.attemptsMu.Unlock()
+		abort(nil)
+	}()
+	n, err := d.fetchRange(attemptCtx, url, label, chunk, offset, file, chunkProgress)
+	// Requests cancelled on purpose, such as by a pause, don't count
+	// against the mirror
+	if d.mirrors.Done(url, err != nil && attemptCtx.Err() == nil) {
+		d.notify("Dropped mirror %s after repeated failures", url)
+		d.logf("%s: dropped mirror %s after %d failed requests in a row", label, url, mirror.MaxFailures)
+		d.abortMirror(url)
+	}
+	return n, err
+}
+
+// runStallMonitor restarts the request of any chunk that has crawled below
+// StallSpeed for StallTime while other chunks keep up, until ctx is done.
+func (d *Downloader) runStallMonitor(ctx context.Context) {
+	detector := stall.NewDetector(d.StallSpeed, d.StallTime)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		positions := make(map[int]int64)
+		d.attemptsMu.Lock()
+		for id := range d.attempts {
+			pos, _, _, _, _ := d.progressManager.GetChunkProgress(id).GetProgress()
+			positions[id] = pos
+		}
+		d.attemptsMu.Unlock()
+
+		for _, id := range detector.Check(positions) {
+			d.attemptsMu.Lock()
+			abort := d.attempts[id]
+			d.attemptsMu.Unlock()
+			if abort == nil {
+				continue
+			}
+			d.logf("chunk %d: below %s/s for %v, restarting its connection", id, FormatBytes(int64(d.StallSpeed)), d.StallTime)
+			abort(stall.ErrStalled)
+			detector.Reset(id)
+		}
+	}
+}
@@ -4,7 +4,7 @@ import {
   Clock, Zap, HardDrive, X, CheckCircle, AlertCircle, 
   Loader, FolderOpen, Globe,
   Activity, BarChart3, FileDown, Link2, Menu, Bell,
-  Wifi, WifiOff
+  Wifi, WifiOff, Upload, Archive, Lock, LogOut
 } from 'lucide-react';
 import apiClient from './api/client';
 import './App.css';
@@ -29,20 +29,112 @@ const DatablipUI = () => {
     output: '',
     chunks: 4,
     connectTimeout: '30s',
-    readTimeout: '10m'
+    readTimeout: '10m',
+    uploadTo: '',
+    deleteAfterUpload: false,
+    moveTo: '',
+    keepLocal: false,
+    extractTo: '',
+    dependsOn: '',
+    monitor: ''
   });
 
   const [activeTab, setActiveTab] = useState('active');
   const [selectedDownload, setSelectedDownload] = useState(null);
+  const [downloadLog, setDownloadLog] = useState(null);
+  const [serverInfo, setServerInfo] = useState(null);
+  const [files, setFiles] = useState([]);
+  const [filesPath, setFilesPath] = useState('');
+  const [filesError, setFilesError] = useState(null);
+  const [filesToken, setFilesToken] = useState('');
+  // Shown when the server wants an API key or a session token
+  const [showLogin, setShowLogin] = useState(false);
+  const [login, setLogin] = useState({ method: 'password', secret: '', error: null });
   const wsRef = useRef(null);
 
+  // The log is fetched on demand for whichever download is open
+  const selectedId = selectedDownload?.id;
+  useEffect(() => {
+    setDownloadLog(null);
+  }, [selectedId]);
+
+  const loadLog = async (id) => {
+    try {
+      setDownloadLog(await apiClient.getLog(id));
+    } catch (err) {
+      setDownloadLog(`Failed to load log: ${err.message}`);
+    }
+  };
+
+  const loadFiles = async (path) => {
+    try {
+      const listing = await apiClient.listFiles(path);
+      setFiles(listing.files);
+      setFilesPath(listing.path === '.' ? '' : listing.path);
+      setFilesError(null);
+    } catch (err) {
+      setFilesError(err.message);
+    }
+  };
+
+  useEffect(() => {
+    if (activeTab === 'files') {
+      loadFiles(filesPath);
+    }
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [activeTab]);
+
+  // Renames, moves and deletes a file, asking for the files token if the
+  // server wants one
+  const fileAction = async (action, file, token = filesToken) => {
+    let input;
+    if (action === 'rename') {
+      input = window.prompt(`Rename ${file.name} to`, file.name);
+    } else if (action === 'move') {
+      input = window.prompt(`Move ${file.name} to folder`, filesPath);
+    } else if (!window.confirm(`Delete ${file.path}?`)) {
+      return;
+    }
+    if (input === null) {
+      return;
+    }
+
+    try {
+      if (action === 'rename') {
+        await apiClient.changeFile('rename', { path: file.path, name: input }, token);
+      } else if (action === 'move') {
+        await apiClient.changeFile('move', { path: file.path, to: input }, token);
+      } else {
+        await apiClient.deleteFile(file.path, token);
+      }
+      loadFiles(filesPath);
+    } catch (err) {
+      if (err.status === 403) {
+        const entered = window.prompt('This server requires its files token to change files');
+        if (entered) {
+          setFilesToken(entered);
+        }
+      } else {
+        setFilesError(err.message);
+      }
+    }
+  };
+
+  // Server details are shown in the settings modal, fresh each time it opens
+  useEffect(() => {
+    if (showSettingsModal) {
+      apiClient.getServerInfo().then(setServerInfo).catch(() => setServerInfo(null));
+    }
+  }, [showSettingsModal]);
+
   // Initialize connection to backend
   useEffect(() => {
+    apiClient.onUnauthorized = () => setShowLogin(true);
     initializeApp();
     
     return () => {
       if (wsRef.current) {
-        wsRef.current.close();
+        wsRef.current.socket?.close();
       }
     };
   }, []);
@@ -69,6 +161,34 @@ const DatablipUI = () => {
     }
   };
 
+  // Keeps the password's session token or the API key, then loads what
+  // the server refused before; the WebSocket reconnects by itself
+  const signIn = async () => {
+    try {
+      if (login.method === 'password') {
+        await apiClient.login(login.secret);
+      } else {
+        await apiClient.useApiKey(login.secret);
+      }
+      setLogin({ ...login, secret: '', error: null });
+      setShowLogin(false);
+      setError(null);
+      await loadSettings();
+      await loadDownloads();
+    } catch (err) {
+      setLogin({ ...login, error: err.message });
+    }
+  };
+
+  // The socket closes too, and won't reconnect without new credentials
+  const signOut = () => {
+    apiClient.setCredential(null);
+    wsRef.current?.socket?.close();
+    setShowSettingsModal(false);
+    setDownloads([]);
+    setShowLogin(true);
+  };
+
   const loadSettings = async () => {
     try {
       const settings = await apiClient.getSettings();
@@ -139,8 +259,11 @@ const DatablipUI = () => {
             ? { ...d, status: 'completed', progress: 100, speed: 0 } 
             : d
         ));
-        // Automatically trigger download of completed file
-        downloadCompletedFile(update.downloadId);
+        // Automatically trigger download of completed file, unless it
+        // was uploaded elsewhere and removed from the server
+        if (!update.data?.deleteAfterUpload) {
+          downloadCompletedFile(update.downloadId);
+        }
         break;
         
       case 'error':
@@ -158,6 +281,12 @@ const DatablipUI = () => {
             : d
         ));
         break;
+
+      case 'quarantined':
+        setDownloads(prev => prev.map(d => 
+          d.id === update.downloadId ? { ...d, ...update.data } : d
+        ));
+        break;
         
       case 'resumed':
         setDownloads(prev => prev.map(d => 
@@ -167,6 +296,11 @@ const DatablipUI = () => {
         ));
         break;
         
+      case 'resync':
+        // Missed more updates than the server kept while disconnected
+        loadDownloads();
+        break;
+
       default:
         console.log('Unknown update type:', update.type);
     }
@@ -187,6 +321,13 @@ const DatablipUI = () => {
         chunks: parseInt(newDownload.chunks) || globalSettings.defaultChunks,
         connectTimeout: newDownload.connectTimeout || globalSettings.connectTimeout,
         readTimeout: newDownload.readTimeout || globalSettings.readTimeout,
+        uploadTo: newDownload.uploadTo || undefined,
+        deleteAfterUpload: newDownload.uploadTo ? newDownload.deleteAfterUpload : undefined,
+        moveTo: newDownload.moveTo || undefined,
+        keepLocal: newDownload.moveTo ? newDownload.keepLocal : undefined,
+        extractTo: newDownload.extractTo || undefined,
+        dependsOn: newDownload.dependsOn ? [newDownload.dependsOn] : undefined,
+        monitor: newDownload.monitor || undefined,
       };
       
       console.log('Creating download:', downloadData);
@@ -201,7 +342,14 @@ const DatablipUI = () => {
         output: '',
         chunks: globalSettings.defaultChunks,
         connectTimeout: globalSettings.connectTimeout,
-        readTimeout: globalSettings.readTimeout
+        readTimeout: globalSettings.readTimeout,
+        uploadTo: '',
+        deleteAfterUpload: false,
+        moveTo: '',
+        keepLocal: false,
+        extractTo: '',
+        dependsOn: '',
+        monitor: ''
       });
       
       setShowAddModal(false);
@@ -246,20 +394,21 @@ const DatablipUI = () => {
   const saveSettings = async () => {
     try {
       setError(null);
-      await apiClient.updateSettings(globalSettings);
+      const saved = await apiClient.updateSettings(globalSettings);
+      setGlobalSettings(prev => ({ ...prev, ...saved }));
       setShowSettingsModal(false);
       
       // Update new download defaults
       setNewDownload(prev => ({
         ...prev,
-        chunks: globalSettings.defaultChunks,
-        connectTimeout: globalSettings.connectTimeout,
-        readTimeout: globalSettings.readTimeout
+        chunks: saved.defaultChunks,
+        connectTimeout: saved.connectTimeout,
+        readTimeout: saved.readTimeout
       }));
       
     } catch (error) {
       console.error('Failed to save settings:', error);
-      setError('Failed to save settings');
+      setError(`Failed to save settings: ${error.message}`);
     }
   };
 
@@ -289,6 +438,13 @@ const DatablipUI = () => {
   const getStatusColor = (status) => {
     switch (status) {
       case 'downloading': return 'text-blue-600';
+      case 'queued': return 'text-gray-600';
+      case 'waiting': return 'text-gray-600';
+      case 'uploading': return 'text-purple-600';
+      case 'moving': return 'text-purple-600';
+      case 'scanning': return 'text-purple-600';
+      case 'extracting': return 'text-purple-600';
+      case 'quarantined': return 'text-orange-600';
       case 'completed': return 'text-green-600';
       case 'paused': return 'text-yellow-600';
       case 'error': return 'text-red-600';
@@ -299,6 +455,13 @@ const DatablipUI = () => {
   const getStatusBg = (status) => {
     switch (status) {
       case 'downloading': return 'bg-blue-50';
+      case 'queued': return 'bg-gray-50';
+      case 'waiting': return 'bg-gray-50';
+      case 'uploading': return 'bg-purple-50';
+      case 'moving': return 'bg-purple-50';
+      case 'scanning': return 'bg-purple-50';
+      case 'extracting': return 'bg-purple-50';
+      case 'quarantined': return 'bg-orange-50';
       case 'completed': return 'bg-green-50';
       case 'paused': return 'bg-yellow-50';
       case 'error': return 'bg-red-50';
@@ -310,6 +473,19 @@ const DatablipUI = () => {
     switch (status) {
       case 'downloading':
         return <Loader className="w-4 h-4 animate-spin" />;
+      case 'queued':
+      case 'waiting':
+        return <Clock className="w-4 h-4" />;
+      case 'uploading':
+        return <Upload className="w-4 h-4" />;
+      case 'moving':
+        return <FolderOpen className="w-4 h-4" />;
+      case 'scanning':
+        return <Loader className="w-4 h-4 animate-spin" />;
+      case 'extracting':
+        return <Archive className="w-4 h-4" />;
+      case 'quarantined':
+        return <AlertCircle className="w-4 h-4" />;
       case 'completed':
         return <CheckCircle className="w-4 h-4" />;
       case 'paused':
@@ -322,9 +498,9 @@ const DatablipUI = () => {
   };
 
   const filteredDownloads = downloads.filter(download => {
-    if (activeTab === 'active') return ['downloading', 'paused'].includes(download.status);
+    if (activeTab === 'active') return ['queued', 'waiting', 'downloading', 'paused', 'scanning', 'extracting', 'uploading', 'moving'].includes(download.status);
     if (activeTab === 'completed') return download.status === 'completed';
-    if (activeTab === 'failed') return download.status === 'error';
+    if (activeTab === 'failed') return ['error', 'quarantined'].includes(download.status);
     return true;
   });
 
@@ -372,7 +548,8 @@ const DatablipUI = () => {
                 { id: 'active', icon: Activity, label: 'Active Downloads' },
                 { id: 'completed', icon: CheckCircle, label: 'Completed' },
                 { id: 'failed', icon: AlertCircle, label: 'Failed' },
-                { id: 'all', icon: BarChart3, label: 'All Downloads' }
+                { id: 'all', icon: BarChart3, label: 'All Downloads' },
+                { id: 'files', icon: FolderOpen, label: 'Files' }
               ].map(item => (
                 <button
                   key={item.id}
@@ -419,16 +596,16 @@ const DatablipUI = () => {
               <div className="bg-gray-50 rounded-lg p-3">
                 <div className="flex items-center justify-between mb-2">
                   <span className="text-xs font-semibold text-gray-600">Connection Status</span>
-                  {wsRef.current?.readyState === 1 ? (
+                  {wsRef.current?.socket?.readyState === 1 ? (
                     <Wifi className="w-4 h-4 text-green-600" />
                   ) : (
                     <WifiOff className="w-4 h-4 text-red-600" />
                   )}
                 </div>
                 <div className="flex items-center space-x-2">
-                  <div className={`w-2 h-2 rounded-full ${wsRef.current?.readyState === 1 ? 'bg-green-500' : 'bg-red-500'}`} />
+                  <div className={`w-2 h-2 rounded-full ${wsRef.current?.socket?.readyState === 1 ? 'bg-green-500' : 'bg-red-500'}`} />
                   <span className="text-xs text-gray-600">
-                    {wsRef.current?.readyState === 1 ? 'Connected' : 'Disconnected'}
+                    {wsRef.current?.socket?.readyState === 1 ? 'Connected' : 'Disconnected'}
                   </span>
                 </div>
               </div>
@@ -456,6 +633,7 @@ const DatablipUI = () => {
                     {activeTab === 'completed' && 'Completed Downloads'}
                     {activeTab === 'failed' && 'Failed Downloads'}
                     {activeTab === 'all' && 'All Downloads'}
+                    {activeTab === 'files' && 'Files'}
                   </h2>
                   <p className="text-sm text-gray-600">Manage and monitor your downloads</p>
                 </div>
@@ -537,8 +715,61 @@ const DatablipUI = () => {
               </div>
             </div>
 
+            {/* File Browser */}
+            {activeTab === 'files' && (
+              <div className="bg-white rounded-lg border border-gray-200">
+                <div className="flex items-center justify-between px-6 py-3 border-b border-gray-200">
+                  <div className="flex items-center space-x-1 text-sm">
+                    <button onClick={() => loadFiles('')} className="text-blue-600 hover:text-blue-700">downloads</button>
+                    {filesPath && filesPath.split('/').map((part, index, parts) => (
+                      <span key={index}>
+                        <span className="text-gray-400 mx-1">/</span>
+                        <button
+                          onClick={() => loadFiles(parts.slice(0, index + 1).join('/'))}
+                          className="text-blue-600 hover:text-blue-700"
+                        >
+                          {part}
+                        </button>
+                      </span>
+                    ))}
+                  </div>
+                  {filesError && <span className="text-xs text-red-600">{filesError}</span>}
+                </div>
+                {files.length === 0 ? (
+                  <div className="p-12 text-center text-sm text-gray-600">This folder is empty</div>
+                ) : (
+                  <div className="divide-y divide-gray-200">
+                    {files.map(file => (
+                      <div key={file.path} className="flex items-center justify-between px-6 py-3 hover:bg-gray-50">
+                        <div className="flex items-center space-x-3 min-w-0">
+                          {file.dir
+                            ? <FolderOpen className="w-4 h-4 text-blue-500 flex-shrink-0" />
+                            : <FileDown className="w-4 h-4 text-gray-400 flex-shrink-0" />}
+                          {file.dir ? (
+                            <button onClick={() => loadFiles(file.path)} className="text-sm text-gray-900 truncate hover:text-blue-600">
+                              {file.name}
+                            </button>
+                          ) : (
+                            <a href={apiClient.fileContentUrl(file.path)} className="text-sm text-gray-900 truncate hover:text-blue-600">
+                              {file.name}
+                            </a>
+                          )}
+                          {!file.dir && <span className="text-xs text-gray-500">{formatBytes(file.size)}</span>}
+                        </div>
+                        <div className="flex items-center space-x-3 text-xs">
+                          <button onClick={() => fileAction('rename', file)} className="text-gray-600 hover:text-gray-900">Rename</button>
+                          <button onClick={() => fileAction('move', file)} className="text-gray-600 hover:text-gray-900">Move</button>
+                          <button onClick={() => fileAction('delete', file)} className="text-red-600 hover:text-red-700">Delete</button>
+                        </div>
+                      </div>
+                    ))}
+                  </div>
+                )}
+              </div>
+            )}
+
             {/* Downloads List */}
-            <div className="bg-white rounded-lg border border-gray-200">
+            <div className={`bg-white rounded-lg border border-gray-200 ${activeTab === 'files' ? 'hidden' : ''}`}>
               {filteredDownloads.length === 0 ? (
                 <div className="p-12 text-center">
                   <FileDown className="w-12 h-12 text-gray-400 mx-auto mb-4" />
@@ -561,9 +792,17 @@ const DatablipUI = () => {
                     >
                       <div className="flex items-center justify-between mb-4">
                         <div className="flex items-center space-x-4 flex-1">
-                          <div className={`p-2 rounded-lg ${getStatusBg(download.status)}`}>
-                            <FileDown className={`w-5 h-5 ${getStatusColor(download.status)}`} />
-                          </div>
+                          {download.thumbnail ? (
+                            <img
+                              src={apiClient.thumbnailUrl(download.id)}
+                              alt=""
+                              className="w-16 h-10 object-cover rounded-lg bg-gray-100"
+                            />
+                          ) : (
+                            <div className={`p-2 rounded-lg ${getStatusBg(download.status)}`}>
+                              <FileDown className={`w-5 h-5 ${getStatusColor(download.status)}`} />
+                            </div>
+                          )}
                           <div className="flex-1 min-w-0">
                             <div className="flex items-center space-x-3">
                               <h3 className="text-sm font-semibold text-gray-900 truncate">{download.filename}</h3>
@@ -582,7 +821,7 @@ const DatablipUI = () => {
                         </div>
                         
                         <div className="flex items-center space-x-2 ml-4">
-                          {download.status !== 'completed' && download.status !== 'error' && (
+                          {['downloading', 'paused'].includes(download.status) && (
                             <button
                               onClick={(e) => {
                                 e.stopPropagation();
@@ -641,6 +880,76 @@ const DatablipUI = () => {
                           </div>
                         </div>
 
+                        {['scanning', 'extracting', 'uploading', 'moving'].includes(download.status) && (
+                          <div className="space-y-1">
+                            <div className="flex justify-between text-xs text-gray-600">
+                              <span className="truncate">
+                                {download.status === 'scanning' ? 'Scanning for malware' :
+                                  download.status === 'extracting' ? `Extracting ${download.extracting || ''}` :
+                                  download.status === 'uploading' ? `Uploading to ${download.uploadTo}` :
+                                  `${download.keepLocal ? 'Copying' : 'Moving'} to ${download.moveTo}`}
+                              </span>
+                              <span>{(download.stageProgress || 0).toFixed(1)}%</span>
+                            </div>
+                            <div className="h-1 bg-gray-100 rounded-full overflow-hidden">
+                              <div
+                                className="h-full bg-purple-500 transition-all duration-300"
+                                style={{ width: `${download.stageProgress || 0}%` }}
+                              />
+                            </div>
+                          </div>
+                        )}
+                        {download.status === 'completed' && download.uploadedTo && (
+                          <div className="text-xs text-gray-500 truncate">
+                            Uploaded to {download.uploadedTo}
+                            {download.deleteAfterUpload && ' · local copy removed'}
+                          </div>
+                        )}
+                        {download.status === 'waiting' && (
+                          <div className="text-xs text-gray-500 truncate">
+                            Waiting for {(download.dependsOn || []).map(id => downloads.find(d => d.id === id)?.filename || id).join(', ')}
+                          </div>
+                        )}
+                        {download.status === 'quarantined' && (
+                          <div className="text-xs text-orange-600 truncate">
+                            {download.threat} found
+                            {download.quarantinedTo ? ` · quarantined in ${download.quarantinedTo}` : ' · file deleted'}
+                          </div>
+                        )}
+                        {download.status === 'completed' && download.movedTo && (
+                          <div className="text-xs text-gray-500 truncate">
+                            {download.keepLocal ? 'Copied' : 'Moved'} to {download.movedTo}
+                          </div>
+                        )}
+                        {download.media && (
+                          <div className="text-xs text-gray-500 truncate">
+                            {[
+                              download.media.width > 0 && `${download.media.width}×${download.media.height}`,
+                              download.media.duration > 0 && formatTime(Math.round(download.media.duration)),
+                              [download.media.videoCodec, download.media.audioCodec].filter(Boolean).join(' / '),
+                              download.media.bitrate > 0 && `${Math.round(download.media.bitrate / 1000)} kb/s`,
+                            ].filter(Boolean).join(' · ')}
+                          </div>
+                        )}
+                        {download.monitor && (
+                          <div className="text-xs text-gray-500 truncate">
+                            Checked for changes every {download.monitor}
+                            {download.refreshes > 0 && ` · refreshed ${download.refreshes} times`}
+                            {download.lastChecked && ` · last checked ${new Date(download.lastChecked).toLocaleTimeString()}`}
+                          </div>
+                        )}
+                        {download.status === 'completed' && download.contentType && (
+                          <div className="text-xs text-gray-500 truncate">
+                            {download.contentType}
+                            {download.routedTo && ` · sorted into ${download.routedTo}/`}
+                          </div>
+                        )}
+                        {download.status === 'completed' && download.extractTo && (
+                          <div className="text-xs text-gray-500 truncate" title={(download.extracted || []).join('\n')}>
+                            Extracted {(download.extracted || []).length} files to {download.extractTo}
+                          </div>
+                        )}
+
                         {/* Chunk Progress Visualization */}
                         {download.chunkProgress && download.chunkProgress.length > 0 && download.status === 'downloading' && (
                           <div className="space-y-2">
@@ -649,7 +958,10 @@ const DatablipUI = () => {
                               {download.chunkProgress.map((chunkProgress, index) => (
                                 <div key={index} className="space-y-1">
                                   <div className="flex justify-between text-xs text-gray-600">
-                                    <span>Chunk {index + 1}</span>
+                                    <span>
+                                      Chunk {index + 1}
+                                      {download.chunkRestarts?.[index] > 0 && ` · ${download.chunkRestarts[index]} restarts`}
+                                    </span>
                                     <span>{chunkProgress.toFixed(1)}%</span>
                                   </div>
                                   <div className="h-1 bg-gray-100 rounded-full overflow-hidden">
@@ -786,6 +1098,94 @@ const DatablipUI = () => {
                   />
                 </div>
               </div>
+
+              <div>
+                <label className="block text-sm font-medium text-gray-700 mb-2">
+                  Upload To
+                </label>
+                <input
+                  type="text"
+                  value={newDownload.uploadTo}
+                  onChange={(e) => setNewDownload({...newDownload, uploadTo: e.target.value})}
+                  className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-blue-500"
+                  placeholder="s3://bucket/prefix or remote:path (optional)"
+                />
+                {newDownload.uploadTo && (
+                  <label className="flex items-center space-x-2 mt-2 text-sm text-gray-700">
+                    <input
+                      type="checkbox"
+                      checked={newDownload.deleteAfterUpload}
+                      onChange={(e) => setNewDownload({...newDownload, deleteAfterUpload: e.target.checked})}
+                    />
+                    <span>Delete the local copy once uploaded</span>
+                  </label>
+                )}
+              </div>
+
+              <div>
+                <label className="block text-sm font-medium text-gray-700 mb-2">
+                  Move To
+                </label>
+                <input
+                  type="text"
+                  value={newDownload.moveTo}
+                  onChange={(e) => setNewDownload({...newDownload, moveTo: e.target.value})}
+                  className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-blue-500"
+                  placeholder="/mnt/nas/downloads (optional)"
+                />
+                {newDownload.moveTo && (
+                  <label className="flex items-center space-x-2 mt-2 text-sm text-gray-700">
+                    <input
+                      type="checkbox"
+                      checked={newDownload.keepLocal}
+                      onChange={(e) => setNewDownload({...newDownload, keepLocal: e.target.checked})}
+                    />
+                    <span>Copy instead of move, keeping the local file</span>
+                  </label>
+                )}
+              </div>
+
+              <div>
+                <label className="block text-sm font-medium text-gray-700 mb-2">
+                  Extract To
+                </label>
+                <input
+                  type="text"
+                  value={newDownload.extractTo}
+                  onChange={(e) => setNewDownload({...newDownload, extractTo: e.target.value})}
+                  className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-blue-500"
+                  placeholder="Folder to unpack .zip or .tar archives into (optional)"
+                />
+              </div>
+
+              <div>
+                <label className="block text-sm font-medium text-gray-700 mb-2">
+                  Keep Updated
+                </label>
+                <input
+                  type="text"
+                  value={newDownload.monitor}
+                  onChange={(e) => setNewDownload({...newDownload, monitor: e.target.value})}
+                  className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-blue-500"
+                  placeholder="Check the source for changes every, e.g. 1h (optional)"
+                />
+              </div>
+
+              <div>
+                <label className="block text-sm font-medium text-gray-700 mb-2">
+                  Start After
+                </label>
+                <select
+                  value={newDownload.dependsOn}
+                  onChange={(e) => setNewDownload({...newDownload, dependsOn: e.target.value})}
+                  className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-blue-500"
+                >
+                  <option value="">Start right away</option>
+                  {downloads.filter(d => !['error', 'quarantined'].includes(d.status)).map(d => (
+                    <option key={d.id} value={d.id}>{d.filename} completes</option>
+                  ))}
+                </select>
+              </div>
             </div>
 
             <div className="flex items-center justify-end space-x-3 mt-6 pt-6 border-t border-gray-200">
@@ -899,9 +1299,39 @@ const DatablipUI = () => {
                   </button>
                 </div>
               </div>
+
+              {serverInfo && (
+                <div className="pt-4 border-t border-gray-200">
+                  <label className="text-sm font-medium text-gray-700">Server</label>
+                  <div className="mt-2 space-y-1 text-xs text-gray-500">
+                    <p>
+                      Datablip {serverInfo.version} ({serverInfo.commit?.slice(0, 7)}) · {serverInfo.platform} · up {serverInfo.uptime}
+                    </p>
+                    <p className="break-all">
+                      Saving to {serverInfo.downloadsDir}
+                      {serverInfo.disk && ` · ${formatBytes(serverInfo.disk.free)} free of ${formatBytes(serverInfo.disk.total)}`}
+                    </p>
+                    <p>
+                      {serverInfo.limits.workers} workers · {serverInfo.features.writeMode} writes
+                      {serverInfo.features.scanning && ' · scanning'}
+                      {serverInfo.features.routing && ' · routing'}
+                      {serverInfo.features.mediaInfo && ' · media info'}
+                    </p>
+                  </div>
+                </div>
+              )}
             </div>
 
             <div className="flex items-center justify-end space-x-3 mt-6 pt-6 border-t border-gray-200">
+              {serverInfo?.features?.auth && (
+                <button
+                  onClick={signOut}
+                  className="mr-auto inline-flex items-center px-4 py-2 text-gray-700 hover:text-gray-900 font-medium transition-colors"
+                >
+                  <LogOut className="w-4 h-4 mr-2" />
+                  Sign Out
+                </button>
+              )}
               <button
                 onClick={() => setShowSettingsModal(false)}
                 className="px-4 py-2 text-gray-700 hover:text-gray-900 font-medium transition-colors"
@@ -919,6 +1349,69 @@ const DatablipUI = () => {
         </div>
       )}
 
+      {/* Login Modal */}
+      {showLogin && (
+        <div className="fixed inset-0 bg-black bg-opacity-50 flex items-center justify-center p-4 z-50">
+          <div className="bg-white rounded-xl p-6 w-full max-w-sm">
+            <div className="mb-6">
+              <h2 className="text-xl font-bold text-gray-900">Sign In</h2>
+              <p className="text-sm text-gray-600 mt-1">This server needs its password or an API key</p>
+            </div>
+
+            <form
+              onSubmit={(e) => {
+                e.preventDefault();
+                signIn();
+              }}
+              className="space-y-4"
+            >
+              <div>
+                <label className="block text-sm font-medium text-gray-700 mb-2">
+                  Sign in with
+                </label>
+                <select
+                  value={login.method}
+                  onChange={(e) => setLogin({...login, method: e.target.value, error: null})}
+                  className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-blue-500"
+                >
+                  <option value="password">Password</option>
+                  <option value="key">API key</option>
+                </select>
+              </div>
+
+              <div>
+                <label className="block text-sm font-medium text-gray-700 mb-2">
+                  {login.method === 'password' ? 'Password' : 'API Key'}
+                </label>
+                <div className="relative">
+                  <Lock className="absolute left-3 top-1/2 transform -translate-y-1/2 w-4 h-4 text-gray-400" />
+                  <input
+                    type="password"
+                    autoFocus
+                    value={login.secret}
+                    onChange={(e) => setLogin({...login, secret: e.target.value})}
+                    className="w-full pl-10 pr-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-blue-500"
+                  />
+                </div>
+                {login.error && (
+                  <p className="text-sm text-red-600 mt-2">{login.error}</p>
+                )}
+              </div>
+
+              <div className="flex items-center justify-end pt-2">
+                <button
+                  type="submit"
+                  disabled={!login.secret}
+                  className="px-6 py-2 bg-blue-600 hover:bg-blue-700 disabled:bg-gray-300 disabled:cursor-not-allowed text-white font-medium rounded-lg transition-colors"
+                >
+                  Sign In
+                </button>
+              </div>
+            </form>
+          </div>
+        </div>
+      )}
+
       {/* Download Details Sidebar */}
       {selectedDownload && (
         <div className="fixed right-0 top-0 h-full w-96 bg-white shadow-xl z-40">
@@ -981,6 +1474,20 @@ const DatablipUI = () => {
               </div>
             </div>
 
+            {/* Preview plays what has arrived so far while downloading */}
+            {/\.(mp4|m4v|webm|mov|mp3|m4a|ogg|opus|wav|flac)$/i.test(selectedDownload.filename) &&
+              ['downloading', 'paused', 'completed'].includes(selectedDownload.status) && (
+              <div>
+                <h4 className="text-sm font-medium text-gray-700 mb-2">Preview</h4>
+                <video
+                  controls
+                  preload="metadata"
+                  src={apiClient.fileUrl(selectedDownload.id)}
+                  className="w-full rounded-lg bg-black"
+                />
+              </div>
+            )}
+
             {/* Chunk Progress Section in Modal */}
             {selectedDownload.chunkProgress && selectedDownload.chunkProgress.length > 0 && selectedDownload.status === 'downloading' && (
               <div>
@@ -989,7 +1496,10 @@ const DatablipUI = () => {
                   {selectedDownload.chunkProgress.map((chunkProgress, index) => (
                     <div key={index} className="space-y-1">
                       <div className="flex justify-between text-sm">
-                        <span className="text-gray-500">Chunk {index + 1}</span>
+                        <span className="text-gray-500">
+                          Chunk {index + 1}
+                          {selectedDownload.chunkRestarts?.[index] > 0 && ` · ${selectedDownload.chunkRestarts[index]} restarts`}
+                        </span>
                         <span className="text-gray-900 font-medium">{chunkProgress.toFixed(1)}%</span>
                       </div>
                       <div className="h-1.5 bg-gray-100 rounded-full overflow-hidden">
@@ -1027,6 +1537,30 @@ const DatablipUI = () => {
               <div className="p-3 bg-gray-50 rounded-lg">
                 <p className="text-xs text-gray-600 break-all">{selectedDownload.url}</p>
               </div>
+              <a
+                href={apiClient.metalinkUrl(selectedDownload.id)}
+                className="inline-flex items-center mt-2 text-xs text-blue-600 hover:text-blue-700"
+              >
+                <Link2 className="w-3 h-3 mr-1" />
+                Export as Metalink
+              </a>
+            </div>
+
+            <div>
+              <div className="flex items-center justify-between mb-2">
+                <h4 className="text-sm font-medium text-gray-700">Log</h4>
+                <button
+                  onClick={() => loadLog(selectedDownload.id)}
+                  className="text-xs text-blue-600 hover:text-blue-700"
+                >
+                  {downloadLog === null ? 'Show' : 'Refresh'}
+                </button>
+              </div>
+              {downloadLog !== null && (
+                <pre className="p-3 bg-gray-50 rounded-lg text-xs text-gray-600 max-h-64 overflow-auto whitespace-pre-wrap">
+                  {downloadLog || 'Nothing logged yet'}
+                </pre>
+              )}
             </div>
           </div>
         </div>
@@ -1,9 +1,80 @@
-const API_BASE_URL = process.env.REACT_APP_API_URL || 'http://localhost:8080/api';
-const WS_URL = process.env.REACT_APP_WS_URL || 'ws://localhost:8080/ws';
+// Same origin as the page by default, so the UI works over HTTPS too
+const API_BASE_URL = process.env.REACT_APP_API_URL || `${window.location.origin}/api`;
+const WS_URL = process.env.REACT_APP_WS_URL ||
+  `${window.location.protocol === 'https:' ? 'wss' : 'ws'}://${window.location.host}/ws`;
+
+// Once the server has an API key or password, every request carries one or
+// a session token from logging in. It is kept in localStorage so it
+// survives reloads, and sent in X-API-Key since Authorization carries the
+// files token.
+const KEY_HEADER = 'X-API-Key';
+const CREDENTIAL_STORAGE_KEY = 'datablip.credential';
 
 class ApiClient {
+  constructor() {
+    this.credential = localStorage.getItem(CREDENTIAL_STORAGE_KEY);
+    // Called when the server wants credentials, to ask the user for them
+    this.onUnauthorized = null;
+  }
+
+  setCredential(credential) {
+    this.credential = credential;
+    if (credential) {
+      localStorage.setItem(CREDENTIAL_STORAGE_KEY, credential);
+    } else {
+      localStorage.removeItem(CREDENTIAL_STORAGE_KEY);
+    }
+  }
+
+  // fetch with the stored credential; a 401 drops it, as it is missing,
+  // expired or revoked, and asks for another
+  async request(path, options = {}) {
+    const response = await fetch(`${API_BASE_URL}${path}`, {
+      ...options,
+      headers: {
+        ...options.headers,
+        ...(this.credential && { [KEY_HEADER]: this.credential }),
+      },
+    });
+    if (response.status === 401) {
+      this.setCredential(null);
+      if (this.onUnauthorized) {
+        this.onUnauthorized();
+      }
+      throw Object.assign(new Error(await response.text()), { status: response.status });
+    }
+    return response;
+  }
+
+  // Trades the server's password for a session token
+  async login(password) {
+    const response = await fetch(`${API_BASE_URL}/login`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ password }),
+    });
+    if (!response.ok) {
+      throw new Error(await response.text());
+    }
+    const { token } = await response.json();
+    this.setCredential(token);
+  }
+
+  // Keeps an API key once the server has accepted it
+  async useApiKey(key) {
+    const response = await fetch(`${API_BASE_URL}/server`, {
+      headers: { [KEY_HEADER]: key },
+    });
+    if (!response.ok) {
+      throw new Error(await response.text());
+    }
+    this.setCredential(key);
+  }
+
   async createDownload(data) {
-    const response = await fetch(`${API_BASE_URL}/downloads`, {
+    const response = await this.request('/downloads', {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
@@ -14,52 +85,173 @@ class ApiClient {
   }
 
   async getDownloads() {
-    const response = await fetch(`${API_BASE_URL}/downloads`);
+    const response = await this.request('/downloads');
     return response.json();
   }
 
   async pauseDownload(id) {
-    await fetch(`${API_BASE_URL}/downloads/${id}/pause`, {
+    await this.request(`/downloads/${id}/pause`, {
       method: 'POST',
     });
   }
 
   async resumeDownload(id) {
-    await fetch(`${API_BASE_URL}/downloads/${id}/resume`, {
+    await this.request(`/downloads/${id}/resume`, {
       method: 'POST',
     });
   }
 
+  // Bytes/s, 0 for no limit; takes effect without restarting the download
+  async setDownloadLimit(id, rateLimit) {
+    await this.request(`/downloads/${id}/limit`, {
+      method: 'PATCH',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ rateLimit }),
+    });
+  }
+
   async deleteDownload(id) {
-    await fetch(`${API_BASE_URL}/downloads/${id}`, {
+    await this.request(`/downloads/${id}`, {
       method: 'DELETE',
     });
   }
 
+  thumbnailUrl(id) {
+    return `${API_BASE_URL}/downloads/${id}/thumbnail`;
+  }
+
+  fileUrl(id) {
+    return `${API_BASE_URL}/downloads/${id}/file?inline=1`;
+  }
+
+  async getLog(id) {
+    const response = await this.request(`/downloads/${id}/log`);
+    return response.text();
+  }
+
+  metalinkUrl(id) {
+    return `${API_BASE_URL}/downloads/${id}/metalink`;
+  }
+
+  async listFiles(path = '') {
+    const response = await this.request(`/files?path=${encodeURIComponent(path)}`);
+    if (!response.ok) {
+      throw new Error(await response.text());
+    }
+    return response.json();
+  }
+
+  fileContentUrl(path) {
+    return `${API_BASE_URL}/files/content?path=${encodeURIComponent(path)}`;
+  }
+
+  // Renames, moves and deletes need the server's files token when it has one
+  async changeFile(action, data, token) {
+    const response = await this.request(`/files/${action}`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+        ...(token && { Authorization: `Bearer ${token}` }),
+      },
+      body: JSON.stringify(data),
+    });
+    if (!response.ok) {
+      throw Object.assign(new Error(await response.text()), { status: response.status });
+    }
+    return response.json();
+  }
+
+  async deleteFile(path, token) {
+    const response = await this.request(`/files?path=${encodeURIComponent(path)}&recursive=1`, {
+      method: 'DELETE',
+      headers: token ? { Authorization: `Bearer ${token}` } : {},
+    });
+    if (!response.ok) {
+      throw Object.assign(new Error(await response.text()), { status: response.status });
+    }
+  }
+
+  async getServerInfo() {
+    const response = await this.request('/server');
+    return response.json();
+  }
+
   async getSettings() {
-    const response = await fetch(`${API_BASE_URL}/settings`);
+    const response = await this.request('/settings');
     return response.json();
   }
 
   async updateSettings(settings) {
-    await fetch(`${API_BASE_URL}/settings`, {
+    const response = await this.request('/settings', {
       method: 'PUT',
       headers: {
         'Content-Type': 'application/json',
       },
       body: JSON.stringify(settings),
     });
+    if (!response.ok) {
+      throw new Error(await response.text());
+    }
+    return response.json();
   }
 
-  connectWebSocket(onMessage) {
-    const ws = new WebSocket(WS_URL);
-    
+  async getSpeedLimit() {
+    const response = await this.request('/settings/speed-limit');
+    return response.json();
+  }
+
+  // Caps all downloads together, in bytes/s, 0 for no limit
+  async setSpeedLimit(rateLimit) {
+    const response = await this.request('/settings/speed-limit', {
+      method: 'PATCH',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ rateLimit }),
+    });
+    return response.json();
+  }
+
+  // A ticket opens one WebSocket; it is sent as the first message rather
+  // than in the URL, so it stays out of logs
+  async getWebSocketTicket() {
+    const response = await this.request('/ws-token', { method: 'POST' });
+    if (!response.ok) {
+      throw new Error(await response.text());
+    }
+    const { ticket } = await response.json();
+    return ticket;
+  }
+
+  // Returns a handle whose socket is replaced on every reconnect
+  connectWebSocket(onMessage, handle = {}) {
+    this.getWebSocketTicket()
+      .then((ticket) => this.openWebSocket(ticket, onMessage, handle))
+      .catch((error) => {
+        console.error('WebSocket ticket error:', error);
+        setTimeout(() => this.connectWebSocket(onMessage, handle), 3000);
+      });
+    return handle;
+  }
+
+  openWebSocket(ticket, onMessage, handle) {
+    // After a reconnect, ask for the updates missed in between
+    const url = handle.lastSeq ? `${WS_URL}?since=${handle.lastSeq}` : WS_URL;
+    const ws = new WebSocket(url);
+    handle.socket = ws;
+
     ws.onopen = () => {
+      ws.send(JSON.stringify({ type: 'auth', ticket }));
       console.log('WebSocket connected');
     };
     
     ws.onmessage = (event) => {
       const update = JSON.parse(event.data);
+      if (update.seq) {
+        handle.lastSeq = update.seq;
+      }
       onMessage(update);
     };
     
@@ -70,10 +262,8 @@ class ApiClient {
     ws.onclose = () => {
       console.log('WebSocket disconnected');
       // Attempt to reconnect after 3 seconds
-      setTimeout(() => this.connectWebSocket(onMessage), 3000);
+      setTimeout(() => this.connectWebSocket(onMessage, handle), 3000);
     };
-    
-    return ws;
   }
 }
 
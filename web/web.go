@@ -0,0 +1,25 @@
+// Package web holds the frontend built into the server, so the binary can
+// serve it without the build directory next to it. `make frontend` builds
+// it into dist before the server is compiled.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// Frontend returns the built frontend, or false if the binary was compiled
+// before it was built.
+func Frontend() (fs.FS, bool) {
+	ui, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil, false
+	}
+	if _, err := fs.Stat(ui, "index.html"); err != nil {
+		return nil, false
+	}
+	return ui, true
+}